@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package main
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// drainerMock blocks until released or the context of the drain is done
+type drainerMock struct {
+	started  chan struct{}
+	released chan struct{}
+}
+
+func newDrainerMock() *drainerMock {
+	return &drainerMock{started: make(chan struct{}), released: make(chan struct{})}
+}
+
+func (d *drainerMock) Drain(ctx context.Context) error {
+	close(d.started)
+	select {
+	case <-d.released:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// awaitDrain runs the drain in the background and returns a channel, which is closed once the drain returned
+func awaitDrain(target *drainerMock, signals <-chan os.Signal) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		drain(target, time.Minute, signals)
+	}()
+	<-target.started
+	return done
+}
+
+func TestDrain(t *testing.T) {
+	t.Run("Should ignore further drain requests while draining", func(t *testing.T) {
+		target := newDrainerMock()
+		signals := make(chan os.Signal, 2)
+		done := awaitDrain(target, signals)
+
+		signals <- syscall.SIGUSR1
+		signals <- syscall.SIGUSR1
+		select {
+		case <-done:
+			t.Fatal("Expected a further SIGUSR1 not to abort the drain")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(target.released)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Expected the drain to finish")
+		}
+	})
+
+	for _, sig := range []os.Signal{os.Interrupt, syscall.SIGTERM} {
+		t.Run("Should abort the drain on "+sig.String(), func(t *testing.T) {
+			target := newDrainerMock()
+			signals := make(chan os.Signal, 2)
+			done := awaitDrain(target, signals)
+
+			signals <- syscall.SIGUSR1
+			signals <- sig
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("Expected the shutdown signal to abort the drain")
+			}
+			assert.Len(t, signals, 0, "Expected every signal to be consumed")
+		})
+	}
+}
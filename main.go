@@ -7,6 +7,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"io"
 	"log"
 	"os"
 	"os/signal"
@@ -16,8 +18,9 @@ import (
 
 	"github.com/Templum/rabbitmq-connector/pkg/config"
 	"github.com/Templum/rabbitmq-connector/pkg/connector"
+	"github.com/Templum/rabbitmq-connector/pkg/logging"
 	"github.com/Templum/rabbitmq-connector/pkg/openfaas"
-	"github.com/Templum/rabbitmq-connector/pkg/rabbitmq"
+	"github.com/Templum/rabbitmq-connector/pkg/server"
 	"github.com/Templum/rabbitmq-connector/pkg/types"
 	"github.com/Templum/rabbitmq-connector/pkg/version"
 	"github.com/spf13/afero"
@@ -26,6 +29,10 @@ import (
 )
 
 func main() {
+	dump := flag.Bool("dump", false, "Crawl the gateway once, print the resolved config and topic map as json and exit")
+	dumpDOT := flag.Bool("dump-dot", false, "Crawl the gateway once, print the topic map as Graphviz DOT graph and exit")
+	flag.Parse()
+
 	commit, tag := version.GetReleaseInfo()
 	log.Printf("OpenFaaS RabbitMQ Connector [Version: %s Commit: %s]", tag, commit)
 
@@ -41,38 +48,147 @@ func main() {
 	if validationErr != nil {
 		log.Fatalf("During Config validation %s occurred.", validationErr)
 	}
+	logging.SetLevel(conf.LogLevel)
+
+	httpClient := types.MakeHTTPClient(conf.InsecureSkipVerify, conf.MaxClientsPerHost, 60*time.Second, conf.GatewayIdleConnTimeout)
+	crawler := openfaas.NewClient(httpClient, conf.BasicAuth, conf.GatewayURL, conf.NamespaceInvocationStyle).
+		WithAsyncQueue(conf.AsyncQueueName).
+		WithKeepAlives(!conf.GatewayDisableKeepAlives).
+		WithHeaders(conf.InvocationHeaders).
+		WithHMACSecret(conf.InvocationHMACSecret).
+		WithContentTypeSniffing(conf.SniffContentType, conf.DefaultContentType).
+		WithFallbackGateways(conf.FallbackGatewayURLs...).
+		WithHostHeader(conf.GatewayHostHeader)
+
+	c, err := connector.New(conf, crawler)
+	if err != nil {
+		log.Fatalf("Received %s during Connector setup", err)
+	}
+
+	if *dump {
+		dumpCtx, dumpCancel := context.WithTimeout(context.Background(), conf.InvokeTimeout)
+		defer dumpCancel()
+
+		if err := c.Dump(dumpCtx, os.Stdout); err != nil {
+			log.Fatalf("Received %s during crawling the gateway", err)
+		}
+		return
+	}
+
+	if *dumpDOT {
+		dumpCtx, dumpCancel := context.WithTimeout(context.Background(), conf.InvokeTimeout)
+		defer dumpCancel()
+
+		if err := c.DumpDOT(dumpCtx, os.Stdout); err != nil {
+			log.Fatalf("Received %s during crawling the gateway", err)
+		}
+		return
+	}
 
 	// Setup Application Context to ensure gracefully shutdowns
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	httpClient := types.MakeHTTPClient(conf.InsecureSkipVerify, conf.MaxClientsPerHost, 60*time.Second)
-	// Setup OpenFaaS Controller which is used for querying and more
-	ofSDK := openfaas.NewController(conf, openfaas.NewClient(httpClient, conf.BasicAuth, conf.GatewayURL), openfaas.NewTopicFunctionCache())
-	go ofSDK.Start(ctx)
-	log.Printf("Started Cache Task which populates the topic map")
+	srv := server.New(conf.ListenAddress)
+	srv.Start()
 
-	c := connector.New(rabbitmq.NewConnectionManager(rabbitmq.NewBroker(), conf.TLSConfig), rabbitmq.NewFactory(), ofSDK, conf)
-	err := c.Run()
+	srv.Handle("/stats/functions", server.JSONHandler(func() interface{} {
+		return c.Controller().FunctionStats()
+	}))
+	srv.Handle("/stats/refresh", server.JSONHandler(func() interface{} {
+		return c.Controller().RefreshStats()
+	}))
+	srv.Handle("/stats/topics/health", server.JSONHandler(func() interface{} {
+		return c.Controller().TopicHealth()
+	}))
+	srv.Handle("/status/consumer", server.JSONHandler(func() interface{} {
+		return c.ConsumerStatus()
+	}))
+	srv.Handle("/status/amqp", server.JSONHandler(func() interface{} {
+		return c.AMQPStatus()
+	}))
+	srv.Handle(server.ReadyPath, server.ReadyHandler(c.Controller().Ready))
 
+	signalChannel := make(chan os.Signal, 2)
+	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGUSR1)
+	srv.Handle(server.DrainPath, server.DrainHandler(func() {
+		select {
+		case signalChannel <- syscall.SIGUSR1:
+		default:
+		}
+	}))
+
+	if conf.EnableDebugEndpoints {
+		log.Printf("Debug endpoints are enabled, topics can be invoked via %s, the topic map is rendered via %s and recent messages are served via %s", server.InvokePath, server.DOTPath, server.RecentPath)
+		srv.Handle(server.InvokePath, server.InvokeHandler(c.Controller()))
+		srv.Handle(server.DOTPath, server.DOTHandler(func(w io.Writer) error {
+			return openfaas.WriteDOT(w, c.Controller().TopicMap())
+		}))
+		srv.Handle(server.RecentPath, server.RecentHandler(c.RecentMessages))
+	}
+	if conf.EnablePprof {
+		log.Printf("WARNING: Runtime profiles are exposed unauthenticated via %s", server.PprofPath)
+		srv.EnablePprof()
+	}
+
+	err = c.Start(ctx)
 	if err != nil {
 		log.Fatalf("Received %s during Connector starting", err)
 	}
 
-	signalChannel := make(chan os.Signal, 2)
-	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
 	log.Printf(" [*] Waiting for messages. To exit press CTRL+C")
 
 	sig := <-signalChannel
 	switch sig {
 	case os.Interrupt:
 		log.Printf("Received SIGINT preparing for shutdown")
-
-		c.Shutdown()
-		cancel()
 	case syscall.SIGTERM:
 		log.Printf("Received SIGTERM shutting down")
-		c.Shutdown()
-		cancel()
+	case syscall.SIGUSR1:
+		log.Printf("Received SIGUSR1 draining before shutdown")
+		drain(c, conf.DrainTimeout, signalChannel)
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+
+	if err := c.Stop(shutdownCtx); err != nil {
+		log.Printf("Received %s during Connector shutdown", err)
+	}
+	cancel()
+	srv.Shutdown(shutdownCtx)
+}
+
+// drainer is implemented by connector.Connector
+type drainer interface {
+	Drain(ctx context.Context) error
+}
+
+// drain finishes the in-flight invocations, it is aborted once the timeout elapsed or a shutdown signal is received,
+// e.g. SIGTERM of an impatient orchestrator. Further drain requests via SIGUSR1 are ignored, as the drain is
+// already in progress.
+func drain(c drainer, timeout time.Duration, signals <-chan os.Signal) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig == syscall.SIGUSR1 {
+					log.Printf("Received SIGUSR1 during drain, which is already in progress")
+					continue
+				}
+				log.Printf("Received %s during drain, shutting down", sig)
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if err := c.Drain(ctx); err != nil {
+		log.Printf("Received %s during Connector drain", err)
 	}
 }
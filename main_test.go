@@ -50,8 +50,8 @@ func TestMain(m *testing.M) {
 }
 
 func getOpenFaaSClient() openfaas.FunctionFetcher {
-	httpClient := types.MakeHTTPClient(false, 256, 60*time.Second)
-	ofClient := openfaas.NewClient(httpClient, nil, os.Getenv("OPEN_FAAS_GW_URL"))
+	httpClient := types.MakeHTTPClient(false, 256, 60*time.Second, 5*time.Second)
+	ofClient := openfaas.NewClient(httpClient, nil, os.Getenv("OPEN_FAAS_GW_URL"), "")
 	return ofClient
 }
 
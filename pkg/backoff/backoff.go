@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package backoff
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Jitter determines how the exponential delay is randomized
+type Jitter string
+
+const (
+	// JitterNone uses the exponential delay as is
+	JitterNone Jitter = "none"
+	// JitterFull picks a random delay between zero and the exponential delay
+	JitterFull Jitter = "full"
+	// JitterDecorrelated picks a random delay between the base and the previous delay scaled by the multiplier
+	JitterDecorrelated Jitter = "decorrelated"
+)
+
+// ParseJitter returns the jitter strategy of the provided name, ignoring its case
+func ParseJitter(name string) (Jitter, error) {
+	switch jitter := Jitter(strings.ToLower(strings.TrimSpace(name))); jitter {
+	case JitterNone, JitterFull, JitterDecorrelated:
+		return jitter, nil
+	default:
+		return "", fmt.Errorf("jitter %s is not one of none, full, decorrelated", name)
+	}
+}
+
+// Config describes a capped exponential backoff, the delay of attempt n is Base * Multiplier^n but never exceeds Max
+type Config struct {
+	Base       time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     Jitter
+}
+
+// normalized replaces invalid values, so that every config results in a usable backoff
+func (c Config) normalized() Config {
+	if c.Base <= 0 {
+		c.Base = time.Second
+	}
+	if c.Max < c.Base {
+		c.Max = c.Base
+	}
+	if c.Multiplier < 1 {
+		c.Multiplier = 2
+	}
+	if len(c.Jitter) == 0 {
+		c.Jitter = JitterNone
+	}
+	return c
+}
+
+var (
+	randomLock sync.Mutex
+	randomSrc  = rand.New(rand.NewSource(time.Now().UnixNano())) // #nosec G404 jitter does not need a secure source
+)
+
+// random returns a duration within [0, n), it is guarded as rand.Rand is not safe for concurrent use
+func random(n time.Duration) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+
+	randomLock.Lock()
+	defer randomLock.Unlock()
+	return time.Duration(randomSrc.Int63n(int64(n)))
+}
+
+// Backoff calculates the delays of consecutive attempts, it is not safe for concurrent use
+type Backoff struct {
+	conf     Config
+	attempt  int
+	previous time.Duration
+	random   func(n time.Duration) time.Duration
+}
+
+// New returns a backoff starting at the first attempt
+func New(conf Config) *Backoff {
+	return &Backoff{conf: conf.normalized(), random: random}
+}
+
+// Next returns the delay to wait before the next attempt
+func (b *Backoff) Next() time.Duration {
+	var delay time.Duration
+
+	switch b.conf.Jitter {
+	case JitterFull:
+		delay = b.random(b.exponential() + 1)
+	case JitterDecorrelated:
+		previous := b.previous
+		if previous < b.conf.Base {
+			previous = b.conf.Base
+		}
+		upper := b.capped(float64(previous) * b.conf.Multiplier)
+		delay = b.conf.Base + b.random(upper-b.conf.Base+1)
+	default:
+		delay = b.exponential()
+	}
+
+	b.attempt++
+	b.previous = delay
+	return delay
+}
+
+// Reset starts over at the first attempt, e.g. after an attempt succeeded
+func (b *Backoff) Reset() {
+	b.attempt = 0
+	b.previous = 0
+}
+
+func (b *Backoff) exponential() time.Duration {
+	return b.capped(float64(b.conf.Base) * math.Pow(b.conf.Multiplier, float64(b.attempt)))
+}
+
+func (b *Backoff) capped(delay float64) time.Duration {
+	if delay >= float64(b.conf.Max) {
+		return b.conf.Max
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package backoff
+
+import (
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJitter(t *testing.T) {
+	t.Run("Should accept known strategies ignoring case", func(t *testing.T) {
+		for name, expected := range map[string]Jitter{"none": JitterNone, "Full": JitterFull, " DECORRELATED ": JitterDecorrelated} {
+			jitter, err := ParseJitter(name)
+			assert.NoError(t, err, "should not throw")
+			assert.Equal(t, expected, jitter)
+		}
+	})
+
+	t.Run("Should return error for unknown strategies", func(t *testing.T) {
+		_, err := ParseJitter("equal")
+		assert.Error(t, err, "should throw")
+	})
+}
+
+func TestBackoff_Next(t *testing.T) {
+	t.Run("Should grow exponentially up to the max", func(t *testing.T) {
+		target := New(Config{Base: 100 * time.Millisecond, Max: time.Second, Multiplier: 2, Jitter: JitterNone})
+
+		delays := []time.Duration{}
+		for i := 0; i < 6; i++ {
+			delays = append(delays, target.Next())
+		}
+
+		assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}, delays)
+	})
+
+	t.Run("Should start over after reset", func(t *testing.T) {
+		target := New(Config{Base: time.Second, Max: time.Minute, Multiplier: 3})
+		target.Next()
+		target.Next()
+
+		target.Reset()
+		assert.Equal(t, time.Second, target.Next())
+	})
+
+	t.Run("Should fallback to usable defaults for invalid configs", func(t *testing.T) {
+		target := New(Config{Max: -1, Multiplier: 0.5})
+
+		assert.Equal(t, time.Second, target.Next())
+		assert.Equal(t, time.Second, target.Next(), "Expected max to be raised to base")
+	})
+
+	t.Run("Should not overflow for many attempts", func(t *testing.T) {
+		target := New(Config{Base: time.Second, Max: time.Hour, Multiplier: 10})
+
+		for i := 0; i < 1000; i++ {
+			target.Next()
+		}
+		assert.Equal(t, time.Hour, target.Next())
+	})
+}
+
+// property describes the random inputs of a backoff, which are scaled to sensible ranges
+type property struct {
+	Base       uint16
+	Max        uint32
+	Multiplier uint8
+	Attempts   uint8
+}
+
+func (p property) config(jitter Jitter) Config {
+	return Config{
+		Base:       time.Duration(p.Base) * time.Millisecond,
+		Max:        time.Duration(p.Max%600000) * time.Millisecond,
+		Multiplier: 1 + float64(p.Multiplier%40)/10,
+		Jitter:     jitter,
+	}
+}
+
+func TestBackoff_Properties(t *testing.T) {
+	for _, jitter := range []Jitter{JitterNone, JitterFull, JitterDecorrelated} {
+		jitter := jitter
+
+		t.Run("Should never exceed max with jitter "+string(jitter), func(t *testing.T) {
+			err := quick.Check(func(p property) bool {
+				conf := p.config(jitter)
+				normalized := conf.normalized()
+				target := New(conf)
+
+				for i := 0; i < int(p.Attempts); i++ {
+					if delay := target.Next(); delay < 0 || delay > normalized.Max {
+						return false
+					}
+				}
+				return true
+			}, nil)
+			assert.NoError(t, err, "property should hold")
+		})
+	}
+
+	t.Run("Should keep full jitter within zero and the exponential delay", func(t *testing.T) {
+		err := quick.Check(func(p property) bool {
+			conf := p.config(JitterFull)
+			target := New(conf)
+			reference := New(Config{Base: conf.Base, Max: conf.Max, Multiplier: conf.Multiplier, Jitter: JitterNone})
+
+			for i := 0; i < int(p.Attempts); i++ {
+				if delay, upper := target.Next(), reference.Next(); delay < 0 || delay > upper {
+					return false
+				}
+			}
+			return true
+		}, nil)
+		assert.NoError(t, err, "property should hold")
+	})
+
+	t.Run("Should keep decorrelated jitter at least at base", func(t *testing.T) {
+		err := quick.Check(func(p property) bool {
+			conf := p.config(JitterDecorrelated)
+			normalized := conf.normalized()
+			target := New(conf)
+
+			for i := 0; i < int(p.Attempts); i++ {
+				if target.Next() < normalized.Base {
+					return false
+				}
+			}
+			return true
+		}, nil)
+		assert.NoError(t, err, "property should hold")
+	})
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package config
+
+import (
+	"crypto/x509"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// loadCADir appends every *.pem and *.crt file of the directory to the pool, e.g. CAs mounted by
+// cert-manager or trust-manager. Files that do not contain a certificate are skipped.
+func loadCADir(fs afero.Fs, dir string, pool *x509.CertPool) error {
+	entries, err := afero.ReadDir(fs, dir)
+	if err != nil {
+		return fmt.Errorf("Ca Dir at %s is not accessible %s", dir, err)
+	}
+
+	loaded := 0
+	for _, entry := range entries {
+		extension := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (extension != ".pem" && extension != ".crt") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		content, err := afero.ReadFile(fs, path)
+		if err != nil {
+			log.Printf("Received %s while reading CA %s, will skip it", err, path)
+			continue
+		}
+
+		if !pool.AppendCertsFromPEM(content) {
+			log.Printf("CA %s does not contain a PEM encoded certificate, will skip it", path)
+			continue
+		}
+		loaded++
+	}
+
+	if loaded == 0 {
+		return fmt.Errorf("Ca Dir at %s does not contain a valid certificate", dir)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package config
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func isTrusted(t *testing.T, pool *x509.CertPool, content []byte) bool {
+	block, _ := pem.Decode(content)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	return err == nil
+}
+
+func TestLoadCADir(t *testing.T) {
+	fs := afero.NewOsFs()
+
+	t.Run("Should load all CAs of the directory", func(t *testing.T) {
+		dir := t.TempDir()
+		firstCA, _ := generateCertificate(t, "first-issuer")
+		secondCA, _ := generateCertificate(t, "second-issuer")
+		otherCA, _ := generateCertificate(t, "other-issuer")
+
+		_ = afero.WriteFile(fs, filepath.Join(dir, "first.pem"), firstCA, 0644)
+		_ = afero.WriteFile(fs, filepath.Join(dir, "second.crt"), secondCA, 0644)
+		_ = afero.WriteFile(fs, filepath.Join(dir, "README.md"), []byte("mounted by trust-manager"), 0644)
+		_ = afero.WriteFile(fs, filepath.Join(dir, "broken.pem"), []byte("not a certificate"), 0644)
+
+		pool := x509.NewCertPool()
+		err := loadCADir(fs, dir, pool)
+
+		assert.NoError(t, err, "should not throw")
+		assert.True(t, isTrusted(t, pool, firstCA), "Expected first CA to be loaded")
+		assert.True(t, isTrusted(t, pool, secondCA), "Expected second CA to be loaded")
+		assert.False(t, isTrusted(t, pool, otherCA), "Expected only CAs of the directory")
+	})
+
+	t.Run("Should fail if the directory contains no valid certificate", func(t *testing.T) {
+		dir := t.TempDir()
+		_ = afero.WriteFile(fs, filepath.Join(dir, "broken.pem"), []byte("not a certificate"), 0644)
+
+		err := loadCADir(fs, dir, x509.NewCertPool())
+		assert.Error(t, err, "should throw")
+		assert.Contains(t, err.Error(), "does not contain a valid certificate")
+	})
+
+	t.Run("Should fail if the directory does not exist", func(t *testing.T) {
+		err := loadCADir(fs, filepath.Join(t.TempDir(), "missing"), x509.NewCertPool())
+		assert.Error(t, err, "should throw")
+	})
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package config
+
+import (
+	"crypto/tls"
+	"log"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// certificateReloader reads the client certificate from disk on every handshake, so that rotated
+// certificates are presented without a restart. If reading fails the last valid certificate is used.
+type certificateReloader struct {
+	fs       afero.Fs
+	certPath string
+	keyPath  string
+
+	lock    sync.Mutex
+	current *tls.Certificate
+}
+
+func newCertificateReloader(fs afero.Fs, certPath string, keyPath string) (*certificateReloader, error) {
+	reloader := &certificateReloader{fs: fs, certPath: certPath, keyPath: keyPath}
+
+	cert, err := reloader.load()
+	if err != nil {
+		return nil, err
+	}
+
+	reloader.current = cert
+	return reloader, nil
+}
+
+// GetClientCertificate implements the callback of tls.Config
+func (r *certificateReloader) GetClientCertificate(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	cert, err := r.load()
+	if err != nil {
+		log.Printf("Received %s while reloading the client certificate, will continue with the previous one", err)
+		return r.current, nil
+	}
+
+	r.current = cert
+	return cert, nil
+}
+
+func (r *certificateReloader) load() (*tls.Certificate, error) {
+	cert, err := afero.ReadFile(r.fs, r.certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := afero.ReadFile(r.fs, r.keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pair, nil
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func generateCertificate(t *testing.T, commonName string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawKey, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: rawKey})
+}
+
+// presentedCertificate performs a handshake against a server that records the client certificate
+func presentedCertificate(t *testing.T, client *tls.Config) string {
+	serverCert, serverKey := generateCertificate(t, "server")
+	pair, _ := tls.X509KeyPair(serverCert, serverKey)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		ClientAuth:   tls.RequireAnyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- ""
+			return
+		}
+		defer conn.Close()
+
+		tlsConn := conn.(*tls.Conn)
+		if err := tlsConn.Handshake(); err != nil || len(tlsConn.ConnectionState().PeerCertificates) == 0 {
+			received <- ""
+			return
+		}
+		received <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}()
+
+	cfg := client.Clone()
+	cfg.InsecureSkipVerify = true
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	return <-received
+}
+
+func TestCertificateReloader(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	initialCert, initialKey := generateCertificate(t, "initial")
+	_ = afero.WriteFile(fs, "client.crt", initialCert, 0644)
+	_ = afero.WriteFile(fs, "client.key", initialKey, 0644)
+
+	reloader, err := newCertificateReloader(fs, "client.crt", "client.key")
+	assert.NoError(t, err, "should not throw")
+	client := &tls.Config{GetClientCertificate: reloader.GetClientCertificate}
+
+	t.Run("Should present the initial certificate", func(t *testing.T) {
+		assert.Equal(t, "initial", presentedCertificate(t, client))
+	})
+
+	t.Run("Should present the rotated certificate on the next handshake", func(t *testing.T) {
+		rotatedCert, rotatedKey := generateCertificate(t, "rotated")
+		_ = afero.WriteFile(fs, "client.crt", rotatedCert, 0644)
+		_ = afero.WriteFile(fs, "client.key", rotatedKey, 0644)
+
+		assert.Equal(t, "rotated", presentedCertificate(t, client))
+	})
+
+	t.Run("Should keep presenting the previous certificate if the files are invalid", func(t *testing.T) {
+		_ = afero.WriteFile(fs, "client.key", []byte("rotation in progress"), 0644)
+
+		assert.Equal(t, "rotated", presentedCertificate(t, client))
+	})
+
+	t.Run("Should fail if the initial certificate can not be read", func(t *testing.T) {
+		_, err := newCertificateReloader(fs, "missing.crt", "client.key")
+		assert.Error(t, err, "should throw")
+	})
+}
@@ -11,15 +11,23 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Templum/rabbitmq-connector/pkg/backoff"
+	"github.com/Templum/rabbitmq-connector/pkg/decoder"
+	"github.com/Templum/rabbitmq-connector/pkg/labels"
+	"github.com/Templum/rabbitmq-connector/pkg/logging"
+	"github.com/Templum/rabbitmq-connector/pkg/schema"
 	internal "github.com/Templum/rabbitmq-connector/pkg/types"
 	"github.com/openfaas/connector-sdk/types"
 	"github.com/openfaas/faas-provider/auth"
 	"github.com/spf13/afero"
+	"golang.org/x/net/http/httpguts"
+	"gopkg.in/yaml.v2"
 )
 
 // Controller is the config needed for the connector
@@ -27,18 +35,207 @@ type Controller struct {
 	GatewayURL          string
 	RabbitConnectionURL string
 	RabbitSanitizedURL  string
+	RabbitProxyURL      string
+	// RabbitVHost overrides the vhost of RabbitConnectionURL, it is not escaped
+	RabbitVHost string
+	// RabbitConnectionName identifies the connections of the connector in the management UI of RabbitMQ
+	RabbitConnectionName string
 
 	IsTLSEnabled bool
 	TLSConfig    *tls.Config
+	CADir        string
 
 	Topology internal.Topology
+	// ExchangeType overrides the type of every exchange of the topology, if set
+	ExchangeType string
+	// ExchangeDurable, ExchangeAutoDelete and ExchangeInternal are enforced on every exchange of the topology, if set
+	ExchangeDurable    bool
+	ExchangeAutoDelete bool
+	ExchangeInternal   bool
 
 	TopicRefreshTime   time.Duration
 	BasicAuth          *auth.BasicAuthCredentials
 	InsecureSkipVerify bool
 	MaxClientsPerHost  int
+	InvokeTimeout      time.Duration
+
+	GatewayIdleConnTimeout   time.Duration
+	GatewayDisableKeepAlives bool
+	// FallbackGatewayURLs are tried in order, while the gateway is unreachable
+	FallbackGatewayURLs []string
+	// GatewayHostHeader overrides the Host header of the requests to the gateway, e.g. behind a shared ingress
+	GatewayHostHeader string
+
+	StatusExchange   string
+	StatusRoutingKey string
+	// StatusSampleRate is the fraction of successful invocations between 0 and 1, whose status record is published
+	StatusSampleRate float64
+	// StatusRecordFailures publishes the status records of all failed invocations, regardless of StatusSampleRate
+	StatusRecordFailures bool
+	// StatusBatchSize of status records that are published together as a gzip compressed json array, values below 2
+	// publish every record individually. StatusFlushInterval bounds how long a partial batch is held back.
+	StatusBatchSize     int
+	StatusFlushInterval time.Duration
+	// HeartbeatExchange receives a heartbeat every HeartbeatInterval, heartbeats are disabled while it and the routing key are empty
+	HeartbeatExchange   string
+	HeartbeatRoutingKey string
+	HeartbeatInterval   time.Duration
+	// QuarantineExchange receives deliveries that failed with a non-retryable error, DeadLetterExchange the ones
+	// that exhausted MaxDeliveryAttempts. Both are disabled while empty.
+	QuarantineExchange string
+	DeadLetterExchange string
+
+	NamespaceInvocationStyle string
+	TopicSource              string
+	MaxDeliveryAttempts      int
+	TopicMappingPath         string
+	TopicEnvKey              string
+	PausedFunctions          []string
+	ConsumerPriority         int
+	AutoPauseErrorRatio      float64
+	AutoPauseWindow          time.Duration
+	CrawlConcurrency         int
+	CrawlMinInterval         time.Duration
+	CrawlMaxInterval         time.Duration
+	StartupSplay             time.Duration
+	FunctionRemovalGrace     time.Duration
+	ReconnectBackoff         backoff.Config
+	RefreshBackoff           backoff.Config
+	RetryBackoff             backoff.Config
+	RetryDelayExchange       string
+	AckBatchSize             int
+	AckFlushInterval         time.Duration
+	AsyncQueueName           string
+	InterInvocationDelay     time.Duration
+	QueuePerTopic            bool
+	// AffinityKeySource extracts the key of a message like TopicSource, its hash is passed on as X-Hash-Key header.
+	// If empty no hash is passed on.
+	AffinityKeySource string
+	// StreamCheckpointFile persists the committed offsets of stream queues every StreamCheckpointInterval, so that a
+	// restart resumes after them. The offsets are kept per StreamConsumerReference. Empty disables checkpointing.
+	StreamCheckpointFile     string
+	StreamCheckpointInterval time.Duration
+	StreamConsumerReference  string
+	// LazyQueue declares the queues of every exchange as lazy, which is not supported by stream queues
+	LazyQueue bool
+	// EmitKubeEvents records Kubernetes events for subscription changes on KubeEventObject, which requires RBAC for events
+	EmitKubeEvents bool
+	// KubeEventObject is the kind/name of the object in the namespace of the connector, e.g. Deployment/connector.
+	// If empty the events are recorded on the pod of the connector.
+	KubeEventObject string
+	// MaxInFlightPerFunction limits the concurrent invocations of every function, unless annotated otherwise. 0 disables the limit.
+	MaxInFlightPerFunction int
+	// AdaptiveConcurrencyMin and AdaptiveConcurrencyMax bound the concurrency limit of every function, which adapts to
+	// the observed latency. A max of 0 disables the adaptive limit.
+	AdaptiveConcurrencyMin int
+	AdaptiveConcurrencyMax int
+	// InvocationPoolSize caps the concurrent invocations across all functions, once it is saturated the slots are
+	// shared by the weight of the functions. 0 disables the cap.
+	InvocationPoolSize int
+	// MaxTopics caps the number of cached topics, functions of further topics are rejected. 0 disables the cap.
+	MaxTopics int
+	// MaxInFlightMessages caps the deliveries that are invoked at once across all exchanges. 0 disables the cap.
+	MaxInFlightMessages int
+	// QueuePriorities lists queues highest priority first, once MaxInFlightMessages is reached the freed slots are
+	// handed to the deliveries of the first queue with waiting ones. Other queues are served last.
+	QueuePriorities []string
+	// PriorityDispatch invokes the buffered deliveries of a queue highest AMQP priority first instead of in order.
+	// Deliveries are only buffered while they wait for MaxInFlightMessages or the async queue gate.
+	PriorityDispatch bool
+	// StaticMappings maps topics to functions, referenced as name or name.namespace, or to http(s) urls, which are
+	// invoked in addition to the discovered functions
+	StaticMappings map[string][]string
+	// StaticMappingsPath is the file the static mappings were read from, which is reread on every refresh
+	StaticMappingsPath string
+	// Settings were read from SettingsPath on startup, the reloadable ones are reread on every refresh, see Settings.
+	// Settings is nil without a settings file.
+	Settings     *Settings
+	SettingsPath string
+	// Schemas validate the messages of the topic named like them, or of the functions referencing them via annotation
+	Schemas *schema.Registry
+	// Decoders decode the binary messages of their topic and expose selected fields as headers, e.g. for TopicSource
+	Decoders map[string]decoder.Decoder
+	// TopicAliases maps an incoming topic to the topics whose subscribers additionally receive its messages
+	TopicAliases map[string][]string
+	// ArchiveSink receives every consumed message for replays, either noop or file:<dir>. Empty disables archiving.
+	ArchiveSink string
+	// TraceFilePath receives a json line per invocation, which is rotated once it would exceed TraceFileMaxBytes.
+	// Empty disables the trace file.
+	TraceFilePath     string
+	TraceFileMaxBytes int64
+	// EnableReplies invokes messages with reply_to synchronously and publishes the response to the reply_to queue
+	EnableReplies bool
+	// EnableWarmups invokes functions annotated with warmup in its interval, which keeps them from scaling to zero
+	EnableWarmups bool
+	// SniffContentType detects the content type of messages without one from their body, see DefaultContentType
+	SniffContentType bool
+	// DefaultContentType is sent for messages without content type, unless it was sniffed. Empty sends none.
+	DefaultContentType string
+	// FunctionLabelSelector restricts the crawled functions to the ones with matching labels. Empty matches all.
+	FunctionLabelSelector labels.Selector
+	// AllowedTopics restricts the topic map, and thereby the bindings and invocations, to these topics. Empty allows all.
+	AllowedTopics []string
+	// AllowedAnnotationOverrides are the annotations altering the invocation of a function, like invoke-method, that
+	// are honored, * honors all of them. Topic subscriptions are always honored. NewConfig defaults to none, while nil
+	// honors all of them.
+	AllowedAnnotationOverrides []string
+	// InvocationHeaders are set on every invocation, with ${ENV} references in their values already expanded
+	InvocationHeaders map[string]string
+	// InvocationHMACSecret signs the body of every invocation, which allows functions to verify its origin. Empty
+	// disables signing.
+	InvocationHMACSecret string
+	// AsyncQueueDepthThreshold above which consumption is paused until the async queue drained, 0 disables the gating
+	AsyncQueueDepthThreshold int
+	// AsyncQueueDepthPollInterval in which the async queue depth is scraped from AsyncQueueMetricsURL
+	AsyncQueueDepthPollInterval time.Duration
+	// AsyncQueueMetricsURL exposes the async queue depth in the prometheus text format as AsyncQueueDepthMetric
+	AsyncQueueMetricsURL  string
+	AsyncQueueDepthMetric string
+
+	ListenAddress        string
+	EnableDebugEndpoints bool
+	// RecentMessageBufferSize is the amount of processed deliveries kept per topic for the debug endpoints, 0 keeps
+	// none. Their bodies are only kept with RecentMessageBodies, as messages may contain personal data.
+	RecentMessageBufferSize int
+	RecentMessageBodies     bool
+	// EnablePprof serves the runtime profiles under /debug/pprof/, which are sensitive and not authenticated
+	EnablePprof bool
+	// DrainTimeout bounds how long a drain, triggered by SIGUSR1 or /drain, waits for in-flight invocations
+	DrainTimeout time.Duration
+	// MaxCacheStaleness flips the readiness probe to not ready once the topic map was not refreshed successfully
+	// for longer, 0 disables it
+	MaxCacheStaleness time.Duration
+	// PauseWhileStale holds back deliveries until the first refresh succeeded and while the topic map exceeds the
+	// MaxCacheStaleness, so that they stay in the queue rather than being dropped for lack of subscribers
+	PauseWhileStale bool
+	// ShutdownRequeueDelay after which in-flight deliveries that did not finish before shutdown are redelivered via
+	// the DelayedExchange, 0 leaves them to be redelivered right away
+	ShutdownRequeueDelay time.Duration
+	// DelayedExchange of the rabbitmq_delayed_message_exchange plugin, it is declared during shutdown if required
+	DelayedExchange string
+	// ConsumerIdleAfter without deliveries the consumer reports itself as idle, e.g. as standby of a higher priority one
+	ConsumerIdleAfter time.Duration
+	// LogLevel is either info or debug, debug additionally logs every refresh of the topic map
+	LogLevel string
+	// TransformPlugin is a WebAssembly module transforming the payload of every delivery before it is invoked, see
+	// wasm.Mapper. Empty disables the transformation.
+	TransformPlugin string
+	// TransformTimeout bounds every transformation and TransformMemoryLimit the memory of the plugin in bytes
+	TransformTimeout     time.Duration
+	TransformMemoryLimit int
+	// TransformFailOpen invokes the original payload once a transformation failed, otherwise the delivery is dropped
+	TransformFailOpen bool
 }
 
+const (
+	// NamespaceStyleSuffix invokes functions as name.namespace, which is the OpenFaaS convention
+	NamespaceStyleSuffix = "suffix"
+	// NamespaceStylePath invokes functions as namespace/name
+	NamespaceStylePath = "path"
+	// NamespaceStyleHeader invokes functions by name and transmits the namespace as header
+	NamespaceStyleHeader = "header"
+)
+
 // NewConfig reads the connector config from environment variables and further validates them,
 // in some cases it will leverage default values.
 func NewConfig(fs afero.Fs) (*Controller, error) {
@@ -72,40 +269,427 @@ func NewConfig(fs afero.Fs) (*Controller, error) {
 		skipVerify = false
 	}
 
+	disableKeepAlives, err := strconv.ParseBool(readFromEnv(envGatewayDisableKeepAlives, "false"))
+	if err != nil {
+		disableKeepAlives = false
+	}
+
+	fallbackGatewayURLs, err := getFallbackGatewayURLs()
+	if err != nil {
+		return nil, err
+	}
+
 	topology, err := getTopology(fs)
 	if err != nil {
 		return nil, err
 	}
 
+	lazyQueue, err := getLazyQueue(topology)
+	if err != nil {
+		return nil, err
+	}
+
+	exchangeType, err := getExchangeType()
+	if err != nil {
+		return nil, err
+	}
+
+	archiveSink, err := getArchiveSink()
+	if err != nil {
+		return nil, err
+	}
+
+	traceFileMaxBytes, err := getTraceFileMaxBytes()
+	if err != nil {
+		return nil, err
+	}
+
 	maxClients, err := getMaxClients()
 	if err != nil {
 		maxClients = 256
 	}
 
-	return &Controller{
+	namespaceStyle, err := getNamespaceInvocationStyle()
+	if err != nil {
+		return nil, err
+	}
+
+	topicSource, err := getTopicSource()
+	if err != nil {
+		return nil, err
+	}
+
+	affinityKeySource, err := getAffinityKeySource()
+	if err != nil {
+		return nil, err
+	}
+
+	maxDeliveryAttempts, err := getMaxDeliveryAttempts()
+	if err != nil {
+		return nil, err
+	}
+
+	proxyURL, err := getRabbitProxyURL()
+	if err != nil {
+		return nil, err
+	}
+
+	reconnectBackoff, err := getReconnectBackoff()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshBackoff, err := getBackoff("refresh", envRefreshBackoffBase, envRefreshBackoffMax, envRefreshBackoffFactor, envRefreshBackoffJitter, "1s", "30s")
+	if err != nil {
+		return nil, err
+	}
+
+	retryBackoff, err := getBackoff("retry", envRetryBackoffBase, envRetryBackoffMax, envRetryBackoffFactor, envRetryBackoffJitter, "1s", "60s")
+	if err != nil {
+		return nil, err
+	}
+
+	asyncQueueName, err := getAsyncQueueName()
+	if err != nil {
+		return nil, err
+	}
+
+	invocationHeaders, err := getInvocationHeaders()
+	if err != nil {
+		return nil, err
+	}
+
+	topicAliases, err := getTopicAliases()
+	if err != nil {
+		return nil, err
+	}
+
+	staticMappings, err := getStaticMappings(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := getSettings(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	transformMemoryLimit, err := getTransformMemoryLimit()
+	if err != nil {
+		return nil, err
+	}
+
+	schemas, err := getSchemas(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	decoders, err := getDecoders(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	functionLabelSelector, err := getFunctionLabelSelector()
+	if err != nil {
+		return nil, err
+	}
+
+	hmacSecret, err := getInvocationHMACSecret(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	asyncQueueDepthThreshold, err := getAsyncQueueDepthThreshold()
+	if err != nil {
+		return nil, err
+	}
+
+	asyncQueueMetricsURL, asyncQueueDepthMetric, err := getAsyncQueueMetrics(gatewayURL, asyncQueueDepthThreshold)
+	if err != nil {
+		return nil, err
+	}
+
+	maxInFlight, err := getMaxInFlightPerFunction()
+	if err != nil {
+		return nil, err
+	}
+
+	adaptiveMin, adaptiveMax, err := getAdaptiveConcurrency()
+	if err != nil {
+		return nil, err
+	}
+
+	poolSize, err := getInvocationPoolSize()
+	if err != nil {
+		return nil, err
+	}
+
+	recentSize, err := getRecentMessageBufferSize()
+	if err != nil {
+		return nil, err
+	}
+
+	maxTopics, err := getMaxTopics()
+	if err != nil {
+		return nil, err
+	}
+
+	maxInFlightMessages, err := getMaxInFlightMessages()
+	if err != nil {
+		return nil, err
+	}
+
+	queuePriorities, err := getQueuePriorities(maxInFlightMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	logLevel, err := getLogLevel()
+	if err != nil {
+		return nil, err
+	}
+
+	ackBatchSize, err := getAckBatchSize()
+	if err != nil {
+		return nil, err
+	}
+
+	crawlConcurrency, err := getCrawlConcurrency()
+	if err != nil {
+		return nil, err
+	}
+
+	crawlMinInterval, crawlMaxInterval, err := getCrawlIntervals()
+	if err != nil {
+		return nil, err
+	}
+
+	autoPauseErrorRatio, err := getAutoPauseErrorRatio()
+	if err != nil {
+		return nil, err
+	}
+
+	statusSampleRate, err := getStatusSampleRate()
+	if err != nil {
+		return nil, err
+	}
+
+	statusBatchSize, err := getStatusBatchSize()
+	if err != nil {
+		return nil, err
+	}
+
+	consumerPriority, err := strconv.Atoi(readFromEnv(envConsumerPriority, "0"))
+	if err != nil {
+		return nil, fmt.Errorf("Provided consumer priority %s is not a number", readFromEnv(envConsumerPriority, "0"))
+	}
+
+	conf := &Controller{
 		GatewayURL: gatewayURL,
 		BasicAuth:  types.GetCredentials(),
 
 		TLSConfig: tlsConfig,
+		CADir:     readFromEnv(envPathToCADir, ""),
 
 		RabbitConnectionURL: rabbitURL,
 		RabbitSanitizedURL:  sanitizedURL,
+		RabbitProxyURL:      proxyURL,
+		RabbitVHost:         readFromEnv(envRabbitVHost, ""),
+
+		RabbitConnectionName: getRabbitConnectionName(),
 
-		Topology: topology,
+		Topology:           topology,
+		ExchangeType:       exchangeType,
+		ExchangeDurable:    getExchangeFlag(envExchangeDurable),
+		ExchangeAutoDelete: getExchangeFlag(envExchangeAutoDelete),
+		ExchangeInternal:   getExchangeFlag(envExchangeInternal),
 
 		TopicRefreshTime:   getRefreshTime(),
 		InsecureSkipVerify: skipVerify,
 		MaxClientsPerHost:  maxClients,
-	}, nil
+		InvokeTimeout:      getInvokeTimeout(),
+
+		GatewayIdleConnTimeout:   getGatewayIdleConnTimeout(),
+		GatewayDisableKeepAlives: disableKeepAlives,
+		FallbackGatewayURLs:      fallbackGatewayURLs,
+		GatewayHostHeader:        readFromEnv(envGatewayHostHeader, ""),
+
+		StatusExchange:   readFromEnv(envStatusExchange, ""),
+		StatusRoutingKey: readFromEnv(envStatusRoutingKey, ""),
+
+		StatusSampleRate:     statusSampleRate,
+		StatusRecordFailures: getStatusRecordFailures(),
+		StatusBatchSize:      statusBatchSize,
+		StatusFlushInterval:  getStatusFlushInterval(),
+
+		HeartbeatExchange:   readFromEnv(envHeartbeatExchange, ""),
+		HeartbeatRoutingKey: readFromEnv(envHeartbeatRoutingKey, ""),
+		HeartbeatInterval:   getHeartbeatInterval(),
+
+		QuarantineExchange: readFromEnv(envQuarantineExchange, ""),
+		DeadLetterExchange: readFromEnv(envDeadLetterExchange, ""),
+
+		NamespaceInvocationStyle: namespaceStyle,
+		TopicSource:              topicSource,
+		StreamCheckpointFile:     readFromEnv(envStreamCheckpointFile, ""),
+		StreamCheckpointInterval: getStreamCheckpointInterval(),
+		StreamConsumerReference:  readFromEnv(envStreamConsumerReference, "rabbitmq-connector"),
+		LazyQueue:                lazyQueue,
+		AffinityKeySource:        affinityKeySource,
+		MaxDeliveryAttempts:      maxDeliveryAttempts,
+		TopicMappingPath:         readFromEnv(envPathToTopicMapping, ""),
+		TopicEnvKey:              strings.TrimSpace(readFromEnv(envTopicEnvKey, "")),
+		PausedFunctions:          getPausedFunctions(),
+		ConsumerPriority:         consumerPriority,
+		AutoPauseErrorRatio:      autoPauseErrorRatio,
+		AutoPauseWindow:          getAutoPauseWindow(),
+		CrawlConcurrency:         crawlConcurrency,
+		CrawlMinInterval:         crawlMinInterval,
+		CrawlMaxInterval:         crawlMaxInterval,
+		StartupSplay:             getStartupSplay(),
+		FunctionRemovalGrace:     getFunctionRemovalGrace(),
+		ReconnectBackoff:         reconnectBackoff,
+		RefreshBackoff:           refreshBackoff,
+		RetryBackoff:             retryBackoff,
+		RetryDelayExchange:       readFromEnv(envRetryDelayExchange, ""),
+		AckBatchSize:             ackBatchSize,
+		AckFlushInterval:         getAckFlushInterval(),
+		AsyncQueueName:           asyncQueueName,
+		InterInvocationDelay:     getInterInvocationDelay(),
+		QueuePerTopic:            getQueuePerTopic(),
+		EmitKubeEvents:           getEmitKubeEvents(),
+		KubeEventObject:          readFromEnv(envKubeEventObject, ""),
+		MaxInFlightPerFunction:   maxInFlight,
+		AdaptiveConcurrencyMin:   adaptiveMin,
+		AdaptiveConcurrencyMax:   adaptiveMax,
+		InvocationPoolSize:       poolSize,
+		MaxTopics:                maxTopics,
+		MaxInFlightMessages:      maxInFlightMessages,
+		QueuePriorities:          queuePriorities,
+		PriorityDispatch:         getPriorityDispatch(),
+		StaticMappings:           staticMappings,
+		StaticMappingsPath:       readFromEnv(envPathToStaticMappings, ""),
+		Settings:                 settings,
+		SettingsPath:             readFromEnv(envPathToSettings, ""),
+		Schemas:                  schemas,
+		Decoders:                 decoders,
+		InvocationHeaders:        invocationHeaders,
+		InvocationHMACSecret:     hmacSecret,
+		TopicAliases:             topicAliases,
+		FunctionLabelSelector:    functionLabelSelector,
+		AllowedTopics:            getAllowedTopics(),
+		ArchiveSink:              archiveSink,
+		TraceFilePath:            readFromEnv(envTraceFilePath, ""),
+		TraceFileMaxBytes:        traceFileMaxBytes,
+		EnableReplies:            getEnableReplies(),
+		EnableWarmups:            getEnableWarmups(),
+		SniffContentType:         getSniffContentType(),
+		DefaultContentType:       readFromEnv(envDefaultContentType, ""),
+
+		AsyncQueueDepthThreshold:    asyncQueueDepthThreshold,
+		AsyncQueueDepthPollInterval: getAsyncQueueDepthPollInterval(),
+		AsyncQueueMetricsURL:        asyncQueueMetricsURL,
+		AsyncQueueDepthMetric:       asyncQueueDepthMetric,
+
+		ListenAddress:        readFromEnv(envListenAddress, ":8081"),
+		EnableDebugEndpoints: getEnableDebugEndpoints(),
+		EnablePprof:          getEnablePprof(),
+		DrainTimeout:         getDrainTimeout(),
+		MaxCacheStaleness:    getMaxCacheStaleness(),
+		PauseWhileStale:      getPauseWhileStale(),
+		ShutdownRequeueDelay: getShutdownRequeueDelay(),
+		DelayedExchange:      readFromEnv(envDelayedExchange, "rabbitmq-connector.delayed"),
+		ConsumerIdleAfter:    getConsumerIdleAfter(),
+		LogLevel:             logLevel,
+
+		AllowedAnnotationOverrides: getAllowedAnnotationOverrides(),
+		RecentMessageBufferSize:    recentSize,
+		RecentMessageBodies:        getRecentMessageBodies(),
+
+		TransformPlugin:      readFromEnv(envTransformPlugin, ""),
+		TransformTimeout:     getTransformTimeout(),
+		TransformMemoryLimit: transformMemoryLimit,
+		TransformFailOpen:    getTransformFailOpen(),
+	}
+	if settings != nil {
+		conf.applyStartupSettings(settings)
+	}
+
+	return conf, nil
+}
+
+// redactedValue replaces secrets in the redacted config
+const redactedValue = "xxxxx"
+
+// Redacted returns a copy of the config that is safe to print. Credentials, including those within urls, the HMAC
+// secret and the values of the invocation headers, which may contain secrets, are replaced. The TLS config is omitted.
+func (c *Controller) Redacted() Controller {
+	redacted := *c
+	redacted.GatewayURL = redactURL(c.GatewayURL)
+	redacted.FallbackGatewayURLs = make([]string, len(c.FallbackGatewayURLs))
+	for i, fallback := range c.FallbackGatewayURLs {
+		redacted.FallbackGatewayURLs[i] = redactURL(fallback)
+	}
+	redacted.RabbitConnectionURL = c.RabbitSanitizedURL
+	redacted.RabbitProxyURL = redactURL(c.RabbitProxyURL)
+	redacted.AsyncQueueMetricsURL = redactURL(c.AsyncQueueMetricsURL)
+	redacted.TLSConfig = nil
+
+	if c.BasicAuth != nil {
+		redacted.BasicAuth = &auth.BasicAuthCredentials{User: c.BasicAuth.User, Password: redactedValue}
+	}
+
+	if len(c.InvocationHMACSecret) > 0 {
+		redacted.InvocationHMACSecret = redactedValue
+	}
+
+	redacted.InvocationHeaders = redactHeaders(c.InvocationHeaders)
+
+	if c.Settings != nil {
+		settings := *c.Settings
+		settings.RabbitURL = redactURL(settings.RabbitURL)
+		settings.InvocationHeaders = redactHeaders(settings.InvocationHeaders)
+		redacted.Settings = &settings
+	}
+
+	return redacted
+}
+
+// redactHeaders replaces the values of the headers, as they may contain secrets
+func redactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+
+	redacted := make(map[string]string, len(headers))
+	for name := range headers {
+		redacted[name] = redactedValue
+	}
+	return redacted
+}
+
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return redactedValue
+	}
+	return parsed.Redacted()
 }
 
 const (
 	envFaaSGwURL         = "OPEN_FAAS_GW_URL"
 	envSkipVerify        = "INSECURE_SKIP_VERIFY"
 	envMaxClientsPerHost = "MAX_CLIENT_PER_HOST"
+	envInvokeTimeout     = "INVOKE_TIMEOUT"
+
+	envGatewayIdleConnTimeout   = "GATEWAY_IDLE_CONN_TIMEOUT"
+	envGatewayDisableKeepAlives = "GATEWAY_DISABLE_KEEP_ALIVES"
+	envFallbackGatewayURLs      = "FALLBACK_GATEWAY_URLS"
+	envGatewayHostHeader        = "GATEWAY_HOST_HEADER"
 
 	envUseTLS           = "TLS_ENABLED"
 	envPathToCACert     = "TLS_CA_CERT_PATH"
+	envPathToCADir      = "TLS_CA_DIR"
 	envPathToServerCert = "TLS_SERVER_CERT_PATH"
 	envPathToServerKey  = "TLS_SERVER_KEY_PATH"
 
@@ -114,76 +698,422 @@ const (
 	envRabbitHost  = "RMQ_HOST"
 	envRabbitPort  = "RMQ_PORT"
 	envRabbitVHost = "RMQ_VHOST"
+	envRabbitProxy = "RMQ_PROXY_URL"
+
+	envRabbitConnName = "RMQ_CONNECTION_NAME"
 
 	envPathToTopology = "PATH_TO_TOPOLOGY"
 	envRefreshTime    = "TOPIC_MAP_REFRESH_TIME"
+
+	envExchangeType       = "EXCHANGE_TYPE"
+	envExchangeDurable    = "EXCHANGE_DURABLE"
+	envExchangeAutoDelete = "EXCHANGE_AUTO_DELETE"
+	envExchangeInternal   = "EXCHANGE_INTERNAL"
+
+	envStatusExchange   = "STATUS_EXCHANGE"
+	envStatusRoutingKey = "STATUS_ROUTING_KEY"
+
+	envStatusSampleRate     = "STATUS_SAMPLE_RATE"
+	envStatusRecordFailures = "STATUS_RECORD_FAILURES"
+	envStatusBatchSize      = "STATUS_BATCH_SIZE"
+	envStatusFlushInterval  = "STATUS_FLUSH_INTERVAL"
+
+	envHeartbeatExchange   = "HEARTBEAT_EXCHANGE"
+	envHeartbeatRoutingKey = "HEARTBEAT_ROUTING_KEY"
+	envHeartbeatInterval   = "HEARTBEAT_INTERVAL"
+
+	envQuarantineExchange = "QUARANTINE_EXCHANGE"
+	envDeadLetterExchange = "DEAD_LETTER_EXCHANGE"
+
+	envNamespaceInvocationStyle = "NAMESPACE_INVOCATION_STYLE"
+	envTopicSource              = "TOPIC_SOURCE"
+	envAffinityKeySource        = "AFFINITY_KEY_SOURCE"
+	envMaxDeliveryAttempts      = "MAX_DELIVERY_ATTEMPTS"
+	envPathToTopicMapping       = "PATH_TO_TOPIC_MAPPING"
+	envTopicEnvKey              = "TOPIC_ENV_KEY"
+	envPausedFunctions          = "PAUSED_FUNCTIONS"
+	envConsumerPriority         = "CONSUMER_PRIORITY"
+	envAutoPauseErrorRatio      = "AUTO_PAUSE_ERROR_RATIO"
+	envAutoPauseWindow          = "AUTO_PAUSE_WINDOW"
+	envCrawlConcurrency         = "CRAWL_CONCURRENCY"
+	envCrawlMinInterval         = "CRAWL_MIN_INTERVAL"
+	envCrawlMaxInterval         = "CRAWL_MAX_INTERVAL"
+	envStartupSplay             = "STARTUP_SPLAY"
+	envFunctionRemovalGrace     = "FUNCTION_REMOVAL_GRACE"
+	envReconnectBackoffBase     = "RECONNECT_BACKOFF_BASE"
+	envReconnectBackoffMax      = "RECONNECT_BACKOFF_MAX"
+	envReconnectBackoffFactor   = "RECONNECT_BACKOFF_MULTIPLIER"
+	envReconnectBackoffJitter   = "RECONNECT_BACKOFF_JITTER"
+	envRefreshBackoffBase       = "REFRESH_BACKOFF_BASE"
+	envRefreshBackoffMax        = "REFRESH_BACKOFF_MAX"
+	envRefreshBackoffFactor     = "REFRESH_BACKOFF_MULTIPLIER"
+	envRefreshBackoffJitter     = "REFRESH_BACKOFF_JITTER"
+	envRetryBackoffBase         = "RETRY_BACKOFF_BASE"
+	envRetryBackoffMax          = "RETRY_BACKOFF_MAX"
+	envRetryBackoffFactor       = "RETRY_BACKOFF_MULTIPLIER"
+	envRetryBackoffJitter       = "RETRY_BACKOFF_JITTER"
+	envRetryDelayExchange       = "RETRY_DELAY_EXCHANGE"
+	envAckBatchSize             = "ACK_BATCH_SIZE"
+	envAckFlushInterval         = "ACK_FLUSH_INTERVAL"
+	envStreamCheckpointFile     = "STREAM_CHECKPOINT_FILE"
+	envStreamCheckpointInterval = "STREAM_CHECKPOINT_INTERVAL"
+	envStreamConsumerReference  = "STREAM_CONSUMER_REFERENCE"
+	envLazyQueue                = "LAZY_QUEUE"
+	envAsyncQueueName           = "ASYNC_QUEUE_NAME"
+	envInterInvocationDelay     = "INTER_INVOCATION_DELAY"
+	envQueuePerTopic            = "QUEUE_PER_TOPIC"
+	envEmitKubeEvents           = "EMIT_KUBE_EVENTS"
+	envKubeEventObject          = "KUBE_EVENT_OBJECT"
+	envInvocationHeaders        = "INVOCATION_HEADERS"
+	envInvocationHMACSecret     = "INVOCATION_HMAC_SECRET"
+	envInvocationHMACSecretFile = "INVOCATION_HMAC_SECRET_FILE"
+	envTopicAliases             = "TOPIC_ALIASES"
+	envAllowedTopics            = "ALLOWED_TOPICS"
+	envFunctionLabelSelector    = "FUNCTION_LABEL_SELECTOR"
+	envAllowedOverrides         = "ALLOWED_ANNOTATION_OVERRIDES"
+	envRecentMessageBufferSize  = "RECENT_MESSAGE_BUFFER_SIZE"
+	envRecentMessageBodies      = "RECENT_MESSAGE_BODIES"
+	envArchiveSink              = "ARCHIVE_SINK"
+	envTraceFilePath            = "TRACE_FILE_PATH"
+	envTraceFileMaxBytes        = "TRACE_FILE_MAX_BYTES"
+	envEnableReplies            = "ENABLE_REPLIES"
+	envEnableWarmups            = "ENABLE_WARMUPS"
+	envSniffContentType         = "SNIFF_CONTENT_TYPE"
+	envDefaultContentType       = "DEFAULT_CONTENT_TYPE"
+	envPathToStaticMappings     = "PATH_TO_STATIC_MAPPINGS"
+	envPathToSettings           = "PATH_TO_SETTINGS"
+	envTransformPlugin          = "TRANSFORM_PLUGIN"
+	envTransformTimeout         = "TRANSFORM_TIMEOUT"
+	envTransformMemoryLimit     = "TRANSFORM_MEMORY_LIMIT"
+	envTransformFailOpen        = "TRANSFORM_FAIL_OPEN"
+	envSchemaDirectory          = "SCHEMA_DIRECTORY"
+	envPathToDecoders           = "PATH_TO_DECODERS"
+	envMaxTopics                = "MAX_TOPICS"
+	envMaxInFlightMessages      = "MAX_INFLIGHT_MESSAGES"
+	envQueuePriorities          = "QUEUE_PRIORITIES"
+	envPriorityDispatch         = "PRIORITY_DISPATCH"
+	envMaxInFlightPerFunction   = "MAX_INFLIGHT_PER_FUNCTION"
+	envInvocationPoolSize       = "INVOCATION_POOL_SIZE"
+	envAdaptiveConcurrencyMin   = "ADAPTIVE_CONCURRENCY_MIN"
+	envAdaptiveConcurrencyMax   = "ADAPTIVE_CONCURRENCY_MAX"
+
+	envAsyncQueueDepthThreshold    = "ASYNC_QUEUE_DEPTH_THRESHOLD"
+	envAsyncQueueDepthPollInterval = "ASYNC_QUEUE_DEPTH_POLL_INTERVAL"
+	envAsyncQueueMetricsURL        = "ASYNC_QUEUE_METRICS_URL"
+	envAsyncQueueDepthMetric       = "ASYNC_QUEUE_DEPTH_METRIC"
+
+	envListenAddress        = "HTTP_LISTEN_ADDRESS"
+	envEnableDebugEndpoints = "ENABLE_DEBUG_ENDPOINTS"
+	envEnablePprof          = "ENABLE_PPROF"
+	envDrainTimeout         = "DRAIN_TIMEOUT"
+	envMaxCacheStaleness    = "MAX_CACHE_STALENESS"
+	envPauseWhileStale      = "PAUSE_WHILE_STALE"
+	envShutdownRequeueDelay = "SHUTDOWN_REQUEUE_DELAY"
+	envDelayedExchange      = "DELAYED_EXCHANGE"
+	envConsumerIdleAfter    = "CONSUMER_IDLE_AFTER"
+	envLogLevel             = "LOG_LEVEL"
 )
 
 func getMaxClients() (int, error) {
 	return strconv.Atoi(readFromEnv(envMaxClientsPerHost, "256"))
 }
 
-func getOpenFaaSUrl() (string, error) {
-	url := readFromEnv(envFaaSGwURL, "http://gateway:8080")
-	if !(strings.HasPrefix(url, "http://")) && !(strings.HasPrefix(url, "https://")) {
-		message := fmt.Sprintf("Provided url %s does not include the protocol http / https", url)
-		return "", errors.New(message)
+func getNamespaceInvocationStyle() (string, error) {
+	style := strings.ToLower(readFromEnv(envNamespaceInvocationStyle, NamespaceStyleSuffix))
+
+	switch style {
+	case NamespaceStyleSuffix, NamespaceStylePath, NamespaceStyleHeader:
+		return style, nil
+	default:
+		return "", fmt.Errorf("Provided namespace invocation style %s is not one of suffix, path or header", style)
 	}
-	return url, nil
 }
 
-func generateTlsConfig(fs afero.Fs) (*tls.Config, error) {
-	caCertPath := readFromEnv(envPathToCACert, "")
-	if exists, err := afero.Exists(fs, caCertPath); !exists {
-		return nil, fmt.Errorf("Ca Cert at %s does not exist or is not accessible %s", caCertPath, err)
+func getLogLevel() (string, error) {
+	level, err := logging.ParseLevel(readFromEnv(envLogLevel, logging.LevelInfo))
+	if err != nil {
+		return "", fmt.Errorf("Provided %s", err.Error())
 	}
 
-	serverCertPath := readFromEnv(envPathToServerCert, "")
-	if exists, err := afero.Exists(fs, serverCertPath); !exists {
-		return nil, fmt.Errorf("Server Cert at %s does not exist or is not accessible %s", serverCertPath, err)
+	return level, nil
+}
+
+func getExchangeType() (string, error) {
+	exchangeType := strings.ToLower(strings.TrimSpace(readFromEnv(envExchangeType, "")))
+
+	switch exchangeType {
+	case "", "direct", "topic", "fanout", "headers":
+		return exchangeType, nil
+	default:
+		return "", fmt.Errorf("Provided exchange type %s is not one of direct, topic, fanout or headers", exchangeType)
 	}
+}
 
-	serverKeyPath := readFromEnv(envPathToServerKey, "")
-	if exists, err := afero.Exists(fs, serverKeyPath); !exists {
-		return nil, fmt.Errorf("Server Key at %s does not exist or is not accessible %s", serverKeyPath, err)
+func getTraceFileMaxBytes() (int64, error) {
+	maxBytes, err := strconv.ParseInt(readFromEnv(envTraceFileMaxBytes, "104857600"), 10, 64)
+	if err != nil || maxBytes <= 0 {
+		return 0, fmt.Errorf("Provided trace file max bytes %s is not a number above 0", readFromEnv(envTraceFileMaxBytes, "104857600"))
 	}
 
-	// At this point we know every required file is present and accessible
-	cfg := new(tls.Config)
-	cfg.RootCAs = x509.NewCertPool()
+	return maxBytes, nil
+}
 
-	if ca, err := afero.ReadFile(fs, caCertPath); err == nil {
-		cfg.RootCAs.AppendCertsFromPEM(ca)
-	} else {
-		return nil, err
+func getArchiveSink() (string, error) {
+	sink := strings.TrimSpace(readFromEnv(envArchiveSink, ""))
+
+	if sink == "" || sink == "noop" || (strings.HasPrefix(sink, "file:") && len(strings.TrimPrefix(sink, "file:")) > 0) {
+		return sink, nil
 	}
+	return "", fmt.Errorf("Provided archive sink %s is not one of noop or file:<dir>", sink)
+}
 
-	if cert, err := afero.ReadFile(fs, serverCertPath); err == nil {
-		if key, err := afero.ReadFile(fs, serverKeyPath); err == nil {
-			if cert, err := tls.X509KeyPair(cert, key); err == nil {
-				cfg.Certificates = append(cfg.Certificates, cert)
-			} else {
-				return nil, err
-			}
-		} else {
-			return nil, err
+// getRabbitConnectionName expands the {hostname} placeholder, which is the pod name within Kubernetes, alongside
+// references like ${POD_NAMESPACE} from the environment
+func getRabbitConnectionName() string {
+	name := os.ExpandEnv(readFromEnv(envRabbitConnName, "rabbitmq-connector-{hostname}"))
+	if strings.Contains(name, "{hostname}") {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Printf("Failed to determine the hostname for the connection name due to %s", err)
+			hostname = "unknown"
 		}
-	} else {
-		return nil, err
+		name = strings.ReplaceAll(name, "{hostname}", hostname)
 	}
 
-	return cfg, nil
+	return strings.TrimSpace(name)
 }
 
-// getRabbitMQConnectionURL returns the fully build url and the sanitized version for usage in logging
-func getRabbitMQConnectionURL(isTls bool) (string, string, error) {
-	user := readFromEnv(envRabbitUser, "")
-	pass := readFromEnv(envRabbitPass, "")
-	host := readFromEnv(envRabbitHost, "localhost")
-	port := readFromEnv(envRabbitPort, "5672")
-	vhost := readFromEnv(envRabbitVHost, "")
-	protocol := "amqp"
-	if isTls {
+func getEnableReplies() bool {
+	enabled, err := strconv.ParseBool(readFromEnv(envEnableReplies, "false"))
+	if err != nil {
+		return false
+	}
+
+	return enabled
+}
+
+func getEnableWarmups() bool {
+	enabled, err := strconv.ParseBool(readFromEnv(envEnableWarmups, "false"))
+	if err != nil {
+		return false
+	}
+
+	return enabled
+}
+
+func getSniffContentType() bool {
+	enabled, err := strconv.ParseBool(readFromEnv(envSniffContentType, "false"))
+	if err != nil {
+		return false
+	}
+
+	return enabled
+}
+
+func getExchangeFlag(env string) bool {
+	enabled, err := strconv.ParseBool(readFromEnv(env, "false"))
+	if err != nil {
+		return false
+	}
+
+	return enabled
+}
+
+func getTopicSource() (string, error) {
+	source := strings.TrimSpace(readFromEnv(envTopicSource, "routing-key"))
+
+	if source == "routing-key" {
+		return source, nil
+	}
+
+	for _, prefix := range []string{"header:", "jsonpath:"} {
+		if strings.HasPrefix(source, prefix) && len(strings.TrimSpace(strings.TrimPrefix(source, prefix))) > 0 {
+			return source, nil
+		}
+	}
+
+	return "", fmt.Errorf("Provided topic source %s is not one of routing-key, header:<name> or jsonpath:<expr>", source)
+}
+
+func getAffinityKeySource() (string, error) {
+	source := strings.TrimSpace(readFromEnv(envAffinityKeySource, ""))
+	if len(source) == 0 || source == "routing-key" {
+		return source, nil
+	}
+
+	for _, prefix := range []string{"header:", "jsonpath:"} {
+		if strings.HasPrefix(source, prefix) && len(strings.TrimSpace(strings.TrimPrefix(source, prefix))) > 0 {
+			return source, nil
+		}
+	}
+
+	return "", fmt.Errorf("Provided affinity key source %s is not one of routing-key, header:<name> or jsonpath:<expr>", source)
+}
+
+func getMaxDeliveryAttempts() (int, error) {
+	attempts, err := strconv.Atoi(readFromEnv(envMaxDeliveryAttempts, "0"))
+	if err != nil || attempts < 0 {
+		return 0, fmt.Errorf("Provided max delivery attempts %s is not a positive number", readFromEnv(envMaxDeliveryAttempts, "0"))
+	}
+
+	return attempts, nil
+}
+
+func getEnableDebugEndpoints() bool {
+	enabled, err := strconv.ParseBool(readFromEnv(envEnableDebugEndpoints, "false"))
+	if err != nil {
+		return false
+	}
+
+	return enabled
+}
+
+func getEnablePprof() bool {
+	enabled, err := strconv.ParseBool(readFromEnv(envEnablePprof, "false"))
+	if err != nil {
+		return false
+	}
+
+	return enabled
+}
+
+func getQueuePerTopic() bool {
+	enabled, err := strconv.ParseBool(readFromEnv(envQueuePerTopic, "false"))
+	if err != nil {
+		return false
+	}
+
+	return enabled
+}
+
+func getEmitKubeEvents() bool {
+	enabled, err := strconv.ParseBool(readFromEnv(envEmitKubeEvents, "false"))
+	if err != nil {
+		return false
+	}
+
+	return enabled
+}
+
+func getPriorityDispatch() bool {
+	enabled, err := strconv.ParseBool(readFromEnv(envPriorityDispatch, "false"))
+	if err != nil {
+		return false
+	}
+
+	return enabled
+}
+
+func getStartupSplay() time.Duration {
+	splay, err := time.ParseDuration(readFromEnv(envStartupSplay, "0s"))
+	if err != nil || splay < 0 {
+		log.Println("Provided Startup Splay was not a valid Duration, like 5s or 500ms. Falling back to 0s")
+		splay = 0
+	}
+
+	return splay
+}
+
+func getCrawlConcurrency() (int, error) {
+	concurrency, err := strconv.Atoi(readFromEnv(envCrawlConcurrency, "4"))
+	if err != nil || concurrency < 1 {
+		return 0, fmt.Errorf("Provided crawl concurrency %s is not a positive number", readFromEnv(envCrawlConcurrency, "4"))
+	}
+
+	return concurrency, nil
+}
+
+func getOpenFaaSUrl() (string, error) {
+	url := readFromEnv(envFaaSGwURL, "http://gateway:8080")
+	if !(strings.HasPrefix(url, "http://")) && !(strings.HasPrefix(url, "https://")) {
+		message := fmt.Sprintf("Provided url %s does not include the protocol http / https", url)
+		return "", errors.New(message)
+	}
+	return url, nil
+}
+
+// getFallbackGatewayURLs parses a comma separated list of gateway urls, which have to include the protocol like the gateway url
+func getFallbackGatewayURLs() ([]string, error) {
+	urls := []string{}
+	for _, url := range strings.Split(readFromEnv(envFallbackGatewayURLs, ""), ",") {
+		url = strings.TrimSpace(url)
+		if len(url) == 0 {
+			continue
+		}
+
+		if !(strings.HasPrefix(url, "http://")) && !(strings.HasPrefix(url, "https://")) {
+			return nil, fmt.Errorf("Provided fallback gateway url %s does not include the protocol http / https", url)
+		}
+		urls = append(urls, url)
+	}
+
+	return urls, nil
+}
+
+func generateTlsConfig(fs afero.Fs) (*tls.Config, error) {
+	caDir := readFromEnv(envPathToCADir, "")
+	caCertPath := readFromEnv(envPathToCACert, "")
+	// With a CA directory the single CA file becomes optional
+	if len(caDir) == 0 || len(caCertPath) > 0 {
+		if exists, err := afero.Exists(fs, caCertPath); !exists {
+			return nil, fmt.Errorf("Ca Cert at %s does not exist or is not accessible %s", caCertPath, err)
+		}
+	}
+
+	serverCertPath := readFromEnv(envPathToServerCert, "")
+	if exists, err := afero.Exists(fs, serverCertPath); !exists {
+		return nil, fmt.Errorf("Server Cert at %s does not exist or is not accessible %s", serverCertPath, err)
+	}
+
+	serverKeyPath := readFromEnv(envPathToServerKey, "")
+	if exists, err := afero.Exists(fs, serverKeyPath); !exists {
+		return nil, fmt.Errorf("Server Key at %s does not exist or is not accessible %s", serverKeyPath, err)
+	}
+
+	// At this point we know every required file is present and accessible
+	cfg := new(tls.Config)
+	cfg.RootCAs = x509.NewCertPool()
+
+	if len(caDir) > 0 {
+		// CAs of a directory extend the system pool, instead of replacing it
+		if pool, err := x509.SystemCertPool(); err == nil {
+			cfg.RootCAs = pool
+		}
+
+		if err := loadCADir(fs, caDir, cfg.RootCAs); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(caCertPath) > 0 {
+		if ca, err := afero.ReadFile(fs, caCertPath); err == nil {
+			cfg.RootCAs.AppendCertsFromPEM(ca)
+		} else {
+			return nil, err
+		}
+	}
+
+	// The certificate is reloaded during every handshake, so that rotated certificates are picked up on reconnect
+	reloader, err := newCertificateReloader(fs, serverCertPath, serverKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Certificates = append(cfg.Certificates, *reloader.current)
+	cfg.GetClientCertificate = reloader.GetClientCertificate
+
+	return cfg, nil
+}
+
+// getRabbitMQConnectionURL returns the fully build url and the sanitized version for usage in logging
+func getRabbitMQConnectionURL(isTls bool) (string, string, error) {
+	user := readFromEnv(envRabbitUser, "")
+	pass := readFromEnv(envRabbitPass, "")
+	host := readFromEnv(envRabbitHost, "localhost")
+	port := readFromEnv(envRabbitPort, "5672")
+	// Slashes and other special characters of the vhost have to be escaped to be part of the path
+	vhost := url.PathEscape(readFromEnv(envRabbitVHost, ""))
+	protocol := "amqp"
+	if isTls {
 		protocol = "amqps"
 	}
 
@@ -226,6 +1156,652 @@ func getRefreshTime() time.Duration {
 	return refreshTime
 }
 
+func getRabbitProxyURL() (string, error) {
+	proxyURL := readFromEnv(envRabbitProxy, "")
+	if len(proxyURL) == 0 {
+		return "", nil
+	}
+
+	parsed, err := url.Parse(proxyURL)
+	if err != nil || len(parsed.Host) == 0 {
+		return "", fmt.Errorf("Provided proxy url %s is not a valid url", proxyURL)
+	}
+
+	switch parsed.Scheme {
+	case "socks5", "socks5h", "http":
+		return proxyURL, nil
+	default:
+		return "", fmt.Errorf("Provided proxy url %s does not use one of socks5, socks5h or http", proxyURL)
+	}
+}
+
+func getPausedFunctions() []string {
+	paused := []string{}
+	for _, name := range strings.Split(readFromEnv(envPausedFunctions, ""), ",") {
+		if trimmed := strings.TrimSpace(name); len(trimmed) > 0 {
+			paused = append(paused, trimmed)
+		}
+	}
+
+	return paused
+}
+
+func getAllowedTopics() []string {
+	allowed := []string{}
+	for _, topic := range strings.Split(readFromEnv(envAllowedTopics, ""), ",") {
+		if trimmed := strings.TrimSpace(topic); len(trimmed) > 0 {
+			allowed = append(allowed, trimmed)
+		}
+	}
+
+	return allowed
+}
+
+func getAllowedAnnotationOverrides() []string {
+	allowed := []string{}
+	for _, annotation := range strings.Split(readFromEnv(envAllowedOverrides, ""), ",") {
+		if trimmed := strings.TrimSpace(annotation); len(trimmed) > 0 {
+			allowed = append(allowed, trimmed)
+		}
+	}
+
+	return allowed
+}
+
+func getFunctionLabelSelector() (labels.Selector, error) {
+	expr := readFromEnv(envFunctionLabelSelector, "")
+	selector, err := labels.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("Provided function label selector %s is invalid: %s", expr, err)
+	}
+
+	return selector, nil
+}
+
+// getInvocationHMACSecret reads the secret either from the env or from a file, e.g. a mounted Kubernetes secret.
+// Surrounding whitespace is trimmed, as secret files typically end in a newline.
+func getInvocationHMACSecret(fs afero.Fs) (string, error) {
+	secret := readFromEnv(envInvocationHMACSecret, "")
+	path := readFromEnv(envInvocationHMACSecretFile, "")
+	if len(path) == 0 {
+		return secret, nil
+	}
+	if len(secret) > 0 {
+		return "", fmt.Errorf("Provided %s and %s are mutually exclusive", envInvocationHMACSecret, envInvocationHMACSecretFile)
+	}
+
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return "", fmt.Errorf("Provided HMAC secret file %s can not be read: %s", path, err)
+	}
+	secret = strings.TrimSpace(string(content))
+	if len(secret) == 0 {
+		return "", fmt.Errorf("Provided HMAC secret file %s is empty", path)
+	}
+	return secret, nil
+}
+
+// getInvocationHeaders parses a comma separated list of Name=Value pairs. References like ${TOKEN} in the values
+// are expanded from the environment, which keeps secrets out of the plain config.
+func getInvocationHeaders() (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(readFromEnv(envInvocationHeaders, ""), ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+
+		name, value, found := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !found || !httpguts.ValidHeaderFieldName(name) {
+			return nil, fmt.Errorf("Provided invocation header %s is not of the form Name=Value", pair)
+		}
+
+		value, err := expandInvocationHeader(name, value)
+		if err != nil {
+			return nil, err
+		}
+		headers[name] = value
+	}
+
+	return headers, nil
+}
+
+// expandInvocationHeader expands the references of the value from the environment and validates the resulting value
+func expandInvocationHeader(name string, value string) (string, error) {
+	value = os.ExpandEnv(strings.TrimSpace(value))
+	if !httpguts.ValidHeaderFieldValue(value) {
+		return "", fmt.Errorf("Provided value of invocation header %s contains invalid characters", name)
+	}
+	return value, nil
+}
+
+// getTopicAliases parses a comma separated list of alias=topic pairs, an alias may be listed repeatedly in order to
+// map it to several topics
+func getTopicAliases() (map[string][]string, error) {
+	aliases := map[string][]string{}
+	for _, pair := range strings.Split(readFromEnv(envTopicAliases, ""), ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+
+		alias, topic, found := strings.Cut(pair, "=")
+		alias, topic = strings.TrimSpace(alias), strings.TrimSpace(topic)
+		if !found || len(alias) == 0 || len(topic) == 0 {
+			return nil, fmt.Errorf("Provided topic alias %s is not of the form alias=topic", pair)
+		}
+
+		aliases[alias] = append(aliases[alias], topic)
+	}
+
+	return aliases, nil
+}
+
+// getStaticMappings reads the yaml file mapping topics to lists of function refs or urls, if a path is provided
+func getStaticMappings(fs afero.Fs) (map[string][]string, error) {
+	path := readFromEnv(envPathToStaticMappings, "")
+	if len(path) == 0 {
+		return map[string][]string{}, nil
+	}
+
+	return ReadStaticMappings(fs, path)
+}
+
+// getSettings reads the settings file, if a path is provided
+func getSettings(fs afero.Fs) (*Settings, error) {
+	path := readFromEnv(envPathToSettings, "")
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	return ReadSettings(fs, path)
+}
+
+func getSchemas(fs afero.Fs) (*schema.Registry, error) {
+	dir := readFromEnv(envSchemaDirectory, "")
+	if len(dir) == 0 {
+		return nil, nil
+	}
+
+	schemas, err := schema.Load(fs, dir)
+	if err != nil {
+		return nil, fmt.Errorf("Provided schema directory %s is invalid: %s", dir, err)
+	}
+	return schemas, nil
+}
+
+func getDecoders(fs afero.Fs) (map[string]decoder.Decoder, error) {
+	path := readFromEnv(envPathToDecoders, "")
+	if len(path) == 0 {
+		return map[string]decoder.Decoder{}, nil
+	}
+
+	decoders, err := decoder.Load(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("Provided decoders %s are invalid: %s", path, err)
+	}
+	return decoders, nil
+}
+
+// ReadStaticMappings reads and validates the yaml file mapping topics to lists of function refs or urls
+func ReadStaticMappings(fs afero.Fs, path string) (map[string][]string, error) {
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("Provided static mappings %s can not be read: %s", path, err)
+	}
+
+	mappings := map[string][]string{}
+	if err := yaml.Unmarshal(content, &mappings); err != nil {
+		return nil, fmt.Errorf("Provided static mappings %s are not a map of topics to lists: %s", path, err)
+	}
+
+	if err := validateStaticMappings(mappings); err != nil {
+		return nil, err
+	}
+
+	return mappings, nil
+}
+
+// validateStaticMappings ensures that every target is either a function ref or a valid http(s) url
+func validateStaticMappings(mappings map[string][]string) error {
+	for topic, targets := range mappings {
+		for _, target := range targets {
+			if len(strings.TrimSpace(target)) == 0 {
+				return fmt.Errorf("Provided static mappings of topic %s contain an empty target", topic)
+			}
+
+			if !strings.Contains(target, "://") {
+				continue
+			}
+
+			parsed, err := url.Parse(target)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+				return fmt.Errorf("Provided static mapping %s of topic %s is not a valid http(s) url", target, topic)
+			}
+		}
+	}
+	return nil
+}
+
+func getAutoPauseErrorRatio() (float64, error) {
+	raw := readFromEnv(envAutoPauseErrorRatio, "0")
+	ratio, err := strconv.ParseFloat(raw, 64)
+	if err != nil || ratio < 0 || ratio >= 1 {
+		return 0, fmt.Errorf("Provided auto pause error ratio %s is not a number between 0 and 1", raw)
+	}
+
+	return ratio, nil
+}
+
+func getStatusSampleRate() (float64, error) {
+	raw := readFromEnv(envStatusSampleRate, "1")
+	rate, err := strconv.ParseFloat(raw, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("Provided status sample rate %s is not a number between 0 and 1", raw)
+	}
+
+	return rate, nil
+}
+
+func getStatusRecordFailures() bool {
+	enabled, err := strconv.ParseBool(readFromEnv(envStatusRecordFailures, "true"))
+	if err != nil {
+		return true
+	}
+
+	return enabled
+}
+
+func getStatusBatchSize() (int, error) {
+	size, err := strconv.Atoi(readFromEnv(envStatusBatchSize, "1"))
+	if err != nil || size < 1 {
+		return 0, fmt.Errorf("Provided status batch size %s is not a positive number", readFromEnv(envStatusBatchSize, "1"))
+	}
+
+	return size, nil
+}
+
+func getStatusFlushInterval() time.Duration {
+	interval, err := time.ParseDuration(readFromEnv(envStatusFlushInterval, "1s"))
+	if err != nil || interval <= 0 {
+		log.Println("Provided Status Flush Interval was not a valid Duration, like 30s or 60ms. Falling back to 1s")
+		interval = time.Second
+	}
+
+	return interval
+}
+
+func getAutoPauseWindow() time.Duration {
+	window, err := time.ParseDuration(readFromEnv(envAutoPauseWindow, "1m"))
+	if err != nil || window <= 0 {
+		log.Println("Provided Auto Pause Window was not a valid Duration, like 30s or 60ms. Falling back to 1m")
+		window = time.Minute
+	}
+
+	return window
+}
+
+func getReconnectBackoff() (backoff.Config, error) {
+	return getBackoff("reconnect", envReconnectBackoffBase, envReconnectBackoffMax, envReconnectBackoffFactor, envReconnectBackoffJitter, "1s", "30s")
+}
+
+// getBackoff reads the backoff of the kind from the provided envs, using full jitter by default
+func getBackoff(kind string, envBase string, envMax string, envMultiplier string, envJitter string, defaultBase string, defaultMax string) (backoff.Config, error) {
+	base, err := time.ParseDuration(readFromEnv(envBase, defaultBase))
+	if err != nil || base <= 0 {
+		return backoff.Config{}, fmt.Errorf("Provided %s backoff base %s is not a positive duration", kind, readFromEnv(envBase, defaultBase))
+	}
+
+	max, err := time.ParseDuration(readFromEnv(envMax, defaultMax))
+	if err != nil || max < base {
+		return backoff.Config{}, fmt.Errorf("Provided %s backoff max %s is not a duration of at least the base", kind, readFromEnv(envMax, defaultMax))
+	}
+
+	multiplier, err := strconv.ParseFloat(readFromEnv(envMultiplier, "2"), 64)
+	if err != nil || multiplier < 1 {
+		return backoff.Config{}, fmt.Errorf("Provided %s backoff multiplier %s is not a number of at least 1", kind, readFromEnv(envMultiplier, "2"))
+	}
+
+	jitter, err := backoff.ParseJitter(readFromEnv(envJitter, string(backoff.JitterFull)))
+	if err != nil {
+		return backoff.Config{}, err
+	}
+
+	return backoff.Config{Base: base, Max: max, Multiplier: multiplier, Jitter: jitter}, nil
+}
+
+func getAsyncQueueName() (string, error) {
+	name := readFromEnv(envAsyncQueueName, "")
+	for _, char := range name {
+		valid := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || strings.ContainsRune("-_.", char)
+		if !valid {
+			return "", fmt.Errorf("Provided async queue name %s must only contain letters, digits, '-', '_' or '.'", name)
+		}
+	}
+
+	return name, nil
+}
+
+func getMaxInFlightPerFunction() (int, error) {
+	maxInFlight, err := strconv.Atoi(readFromEnv(envMaxInFlightPerFunction, "0"))
+	if err != nil || maxInFlight < 0 {
+		return 0, fmt.Errorf("Provided max in-flight per function %s is not a positive number", readFromEnv(envMaxInFlightPerFunction, "0"))
+	}
+
+	return maxInFlight, nil
+}
+
+func getInvocationPoolSize() (int, error) {
+	size, err := strconv.Atoi(readFromEnv(envInvocationPoolSize, "0"))
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("Provided invocation pool size %s is not a positive number", readFromEnv(envInvocationPoolSize, "0"))
+	}
+
+	return size, nil
+}
+
+// getAdaptiveConcurrency returns the bounds of the adaptive concurrency limit, the min only applies with a max
+func getAdaptiveConcurrency() (int, int, error) {
+	min, err := strconv.Atoi(readFromEnv(envAdaptiveConcurrencyMin, "1"))
+	if err != nil || min < 1 {
+		return 0, 0, fmt.Errorf("Provided adaptive concurrency min %s is not a number above 0", readFromEnv(envAdaptiveConcurrencyMin, "1"))
+	}
+
+	max, err := strconv.Atoi(readFromEnv(envAdaptiveConcurrencyMax, "0"))
+	if err != nil || max < 0 {
+		return 0, 0, fmt.Errorf("Provided adaptive concurrency max %s is not a positive number", readFromEnv(envAdaptiveConcurrencyMax, "0"))
+	}
+	if max > 0 && max < min {
+		return 0, 0, fmt.Errorf("Provided adaptive concurrency max %d is below the min %d", max, min)
+	}
+
+	return min, max, nil
+}
+
+func getMaxTopics() (int, error) {
+	maxTopics, err := strconv.Atoi(readFromEnv(envMaxTopics, "0"))
+	if err != nil || maxTopics < 0 {
+		return 0, fmt.Errorf("Provided max topics %s is not a positive number", readFromEnv(envMaxTopics, "0"))
+	}
+
+	return maxTopics, nil
+}
+
+func getMaxInFlightMessages() (int, error) {
+	limit, err := strconv.Atoi(readFromEnv(envMaxInFlightMessages, "0"))
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("Provided max in-flight messages %s is not a positive number", readFromEnv(envMaxInFlightMessages, "0"))
+	}
+
+	return limit, nil
+}
+
+// getQueuePriorities parses a comma separated list of queue names, highest priority first. As priorities only apply
+// while deliveries wait for a slot, they require the in-flight messages to be capped.
+func getQueuePriorities(maxInFlightMessages int) ([]string, error) {
+	queues := []string{}
+	seen := map[string]struct{}{}
+	for _, queue := range strings.Split(readFromEnv(envQueuePriorities, ""), ",") {
+		queue = strings.TrimSpace(queue)
+		if len(queue) == 0 {
+			continue
+		}
+		if _, exists := seen[queue]; exists {
+			return nil, fmt.Errorf("Provided queue priorities %s list queue %s more than once", readFromEnv(envQueuePriorities, ""), queue)
+		}
+
+		seen[queue] = struct{}{}
+		queues = append(queues, queue)
+	}
+
+	if len(queues) > 0 && maxInFlightMessages == 0 {
+		return nil, fmt.Errorf("Provided queue priorities %s require %s to be set", readFromEnv(envQueuePriorities, ""), envMaxInFlightMessages)
+	}
+	return queues, nil
+}
+
+func getAckBatchSize() (int, error) {
+	size, err := strconv.Atoi(readFromEnv(envAckBatchSize, "1"))
+	if err != nil || size < 1 {
+		return 0, fmt.Errorf("Provided ack batch size %s is not a positive number", readFromEnv(envAckBatchSize, "1"))
+	}
+
+	return size, nil
+}
+
+func getAckFlushInterval() time.Duration {
+	interval, err := time.ParseDuration(readFromEnv(envAckFlushInterval, "1s"))
+	if err != nil || interval <= 0 {
+		log.Println("Provided Ack Flush Interval was not a valid Duration, like 30s or 60ms. Falling back to 1s")
+		interval = time.Second
+	}
+
+	return interval
+}
+
+// getLazyQueue rejects lazy queues for exchanges declaring stream queues, as their type has no queue mode
+func getLazyQueue(topology internal.Topology) (bool, error) {
+	lazy, err := strconv.ParseBool(readFromEnv(envLazyQueue, "false"))
+	if err != nil {
+		lazy = false
+	}
+
+	for _, ex := range topology {
+		if ex.Stream && (lazy || ex.Lazy) {
+			return false, fmt.Errorf("Exchange %s declares stream queues, which can not be lazy. Disable %s or lazy for the exchange", ex.Name, envLazyQueue)
+		}
+	}
+	return lazy, nil
+}
+
+func getStreamCheckpointInterval() time.Duration {
+	interval, err := time.ParseDuration(readFromEnv(envStreamCheckpointInterval, "5s"))
+	if err != nil || interval <= 0 {
+		log.Println("Provided Stream Checkpoint Interval was not a valid Duration, like 30s or 60ms. Falling back to 5s")
+		interval = 5 * time.Second
+	}
+
+	return interval
+}
+
+func getHeartbeatInterval() time.Duration {
+	interval, err := time.ParseDuration(readFromEnv(envHeartbeatInterval, "30s"))
+	if err != nil || interval <= 0 {
+		log.Println("Provided Heartbeat Interval was not a valid Duration, like 30s or 60ms. Falling back to 30s")
+		interval = 30 * time.Second
+	}
+
+	return interval
+}
+
+func getDrainTimeout() time.Duration {
+	timeout, err := time.ParseDuration(readFromEnv(envDrainTimeout, "60s"))
+	if err != nil || timeout <= 0 {
+		log.Println("Provided Drain Timeout was not a valid Duration, like 60s or 5m. Falling back to 60s")
+		timeout = 60 * time.Second
+	}
+
+	return timeout
+}
+
+func getAsyncQueueDepthThreshold() (int, error) {
+	threshold, err := strconv.Atoi(readFromEnv(envAsyncQueueDepthThreshold, "0"))
+	if err != nil || threshold < 0 {
+		return 0, fmt.Errorf("Provided async queue depth threshold %s is not a positive number", readFromEnv(envAsyncQueueDepthThreshold, "0"))
+	}
+
+	return threshold, nil
+}
+
+func getMaxCacheStaleness() time.Duration {
+	staleness, err := time.ParseDuration(readFromEnv(envMaxCacheStaleness, "0s"))
+	if err != nil || staleness < 0 {
+		log.Println("Provided Max Cache Staleness was not a valid Duration, like 5m or 90s. Falling back to 0s")
+		staleness = 0
+	}
+
+	return staleness
+}
+
+func getRecentMessageBufferSize() (int, error) {
+	size, err := strconv.Atoi(readFromEnv(envRecentMessageBufferSize, "20"))
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("Provided recent message buffer size %s is not a positive number", readFromEnv(envRecentMessageBufferSize, "20"))
+	}
+
+	return size, nil
+}
+
+func getRecentMessageBodies() bool {
+	enabled, err := strconv.ParseBool(readFromEnv(envRecentMessageBodies, "false"))
+	if err != nil {
+		return false
+	}
+
+	return enabled
+}
+
+func getPauseWhileStale() bool {
+	enabled, err := strconv.ParseBool(readFromEnv(envPauseWhileStale, "false"))
+	if err != nil {
+		return false
+	}
+
+	return enabled
+}
+
+func getShutdownRequeueDelay() time.Duration {
+	delay, err := time.ParseDuration(readFromEnv(envShutdownRequeueDelay, "0s"))
+	if err != nil || delay < 0 {
+		log.Println("Provided Shutdown Requeue Delay was not a valid Duration, like 5s or 1m. Falling back to 0s")
+		delay = 0
+	}
+
+	return delay
+}
+
+func getTransformTimeout() time.Duration {
+	timeout, err := time.ParseDuration(readFromEnv(envTransformTimeout, "1s"))
+	if err != nil || timeout <= 0 {
+		log.Println("Provided Transform Timeout was not a valid Duration, like 1s or 500ms. Falling back to 1s")
+		timeout = time.Second
+	}
+
+	return timeout
+}
+
+// getTransformMemoryLimit returns the memory limit of the transform plugin in bytes, it is configured in MiB
+func getTransformMemoryLimit() (int, error) {
+	limit, err := strconv.Atoi(readFromEnv(envTransformMemoryLimit, "16"))
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("Provided transform memory limit %s is not a positive number of MiB", readFromEnv(envTransformMemoryLimit, "16"))
+	}
+
+	return limit * 1024 * 1024, nil
+}
+
+func getTransformFailOpen() bool {
+	enabled, err := strconv.ParseBool(readFromEnv(envTransformFailOpen, "false"))
+	if err != nil {
+		return false
+	}
+
+	return enabled
+}
+
+func getConsumerIdleAfter() time.Duration {
+	idleAfter, err := time.ParseDuration(readFromEnv(envConsumerIdleAfter, "60s"))
+	if err != nil || idleAfter <= 0 {
+		log.Println("Provided Consumer Idle After was not a valid Duration, like 60s or 5m. Falling back to 60s")
+		idleAfter = 60 * time.Second
+	}
+
+	return idleAfter
+}
+
+func getAsyncQueueDepthPollInterval() time.Duration {
+	interval, err := time.ParseDuration(readFromEnv(envAsyncQueueDepthPollInterval, "5s"))
+	if err != nil || interval <= 0 {
+		log.Println("Provided Async Queue Depth Poll Interval was not a valid Duration, like 30s or 60ms. Falling back to 5s")
+		interval = 5 * time.Second
+	}
+
+	return interval
+}
+
+// getAsyncQueueMetrics returns the url and name of the async queue depth metric, which is required once a threshold is set
+func getAsyncQueueMetrics(gatewayURL string, threshold int) (string, string, error) {
+	metricsURL := readFromEnv(envAsyncQueueMetricsURL, strings.TrimSuffix(gatewayURL, "/")+"/metrics")
+	if !(strings.HasPrefix(metricsURL, "http://")) && !(strings.HasPrefix(metricsURL, "https://")) {
+		return "", "", fmt.Errorf("Provided async queue metrics url %s does not include the protocol http / https", metricsURL)
+	}
+
+	metric := readFromEnv(envAsyncQueueDepthMetric, "")
+	if threshold > 0 && len(metric) == 0 {
+		return "", "", fmt.Errorf("%s is required once %s is set", envAsyncQueueDepthMetric, envAsyncQueueDepthThreshold)
+	}
+
+	return metricsURL, metric, nil
+}
+
+func getInterInvocationDelay() time.Duration {
+	delay, err := time.ParseDuration(readFromEnv(envInterInvocationDelay, "0s"))
+	if err != nil || delay < 0 {
+		log.Println("Provided Inter Invocation Delay was not a valid Duration, like 30s or 60ms. Falling back to 0s")
+		delay = 0
+	}
+
+	return delay
+}
+
+func getCrawlIntervals() (time.Duration, time.Duration, error) {
+	minInterval, err := time.ParseDuration(readFromEnv(envCrawlMinInterval, "0s"))
+	if err != nil || minInterval < 0 {
+		log.Println("Provided Crawl Min Interval was not a valid Duration, like 30s or 60ms. Falling back to 0s")
+		minInterval = 0
+	}
+
+	maxInterval, err := time.ParseDuration(readFromEnv(envCrawlMaxInterval, "0s"))
+	if err != nil || maxInterval < 0 {
+		log.Println("Provided Crawl Max Interval was not a valid Duration, like 30s or 60ms. Falling back to 0s")
+		maxInterval = 0
+	}
+
+	if maxInterval > 0 && maxInterval < minInterval {
+		return 0, 0, fmt.Errorf("Provided crawl max interval %s is below the crawl min interval %s", maxInterval, minInterval)
+	}
+	return minInterval, maxInterval, nil
+}
+
+func getFunctionRemovalGrace() time.Duration {
+	grace, err := time.ParseDuration(readFromEnv(envFunctionRemovalGrace, "0s"))
+	if err != nil || grace < 0 {
+		log.Println("Provided Function Removal Grace was not a valid Duration, like 30s or 60ms. Falling back to 0s")
+		grace = 0
+	}
+
+	return grace
+}
+
+func getGatewayIdleConnTimeout() time.Duration {
+	timeout, err := time.ParseDuration(readFromEnv(envGatewayIdleConnTimeout, "5s"))
+	if err != nil || timeout <= 0 {
+		log.Println("Provided Gateway Idle Conn Timeout was not a valid Duration, like 30s or 60ms. Falling back to 5s")
+		timeout = 5 * time.Second
+	}
+
+	return timeout
+}
+
+func getInvokeTimeout() time.Duration {
+	timeout, err := time.ParseDuration(readFromEnv(envInvokeTimeout, "60s"))
+	if err != nil || timeout <= 0 {
+		log.Println("Provided Invoke Timeout was not a valid Duration, like 30s or 60ms. Falling back to 60s")
+		timeout = 60 * time.Second
+	}
+
+	return timeout
+}
+
 // Helper Functions
 func readFromEnv(env string, fallback string) string {
 	if val, exists := os.LookupEnv(env); exists {
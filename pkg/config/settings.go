@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/afero"
+	"golang.org/x/net/http/httpguts"
+	"gopkg.in/yaml.v2"
+)
+
+// Settings are read from the yaml file at PATH_TO_SETTINGS. The topic annotations, invocation headers and static
+// mappings are reread on every refresh of the topics and applied without a restart, while the remaining settings
+// are only applied on startup.
+type Settings struct {
+	// TopicAnnotations replace the annotation keys the topics of a function are read from, if set
+	TopicAnnotations []string `yaml:"topic_annotations"`
+	// InvocationHeaders are merged with the ones of INVOCATION_HEADERS, taking precedence on conflicts
+	InvocationHeaders map[string]string `yaml:"invocation_headers"`
+	// StaticMappings are merged with the ones of PATH_TO_STATIC_MAPPINGS, replacing the targets of the same topic
+	StaticMappings map[string][]string `yaml:"static_mappings"`
+
+	// RabbitURL replaces the url built from the RMQ_* variables, changing it requires a restart
+	RabbitURL string `yaml:"rabbitmq_url"`
+	// MaxInFlightMessages and CrawlConcurrency replace their variables if positive, changing them requires a restart
+	MaxInFlightMessages int `yaml:"max_inflight_messages"`
+	CrawlConcurrency    int `yaml:"crawl_concurrency"`
+}
+
+// ReadSettings reads and validates the settings file, references like ${TOKEN} in the values of the invocation
+// headers are expanded from the environment
+func ReadSettings(fs afero.Fs, path string) (*Settings, error) {
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("Provided settings %s can not be read: %s", path, err)
+	}
+
+	settings := &Settings{}
+	if err := yaml.UnmarshalStrict(content, settings); err != nil {
+		return nil, fmt.Errorf("Provided settings %s are invalid: %s", path, err)
+	}
+
+	for i, key := range settings.TopicAnnotations {
+		settings.TopicAnnotations[i] = strings.TrimSpace(key)
+		if len(settings.TopicAnnotations[i]) == 0 {
+			return nil, fmt.Errorf("Provided settings %s contain an empty topic annotation", path)
+		}
+	}
+
+	for name, value := range settings.InvocationHeaders {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return nil, fmt.Errorf("Provided invocation header %s is not a valid header name", name)
+		}
+		if settings.InvocationHeaders[name], err = expandInvocationHeader(name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validateStaticMappings(settings.StaticMappings); err != nil {
+		return nil, err
+	}
+
+	if len(settings.RabbitURL) > 0 {
+		parsed, err := url.Parse(settings.RabbitURL)
+		if err != nil || (parsed.Scheme != "amqp" && parsed.Scheme != "amqps") || len(parsed.Host) == 0 {
+			return nil, fmt.Errorf("Provided rabbitmq url of the settings %s is not a valid amqp(s) url", path)
+		}
+	}
+
+	if settings.MaxInFlightMessages < 0 || settings.CrawlConcurrency < 0 {
+		return nil, fmt.Errorf("Provided settings %s contain a negative concurrency", path)
+	}
+
+	return settings, nil
+}
+
+// RestartRequired returns the names of the settings that changed compared to the previous ones, but are only
+// applied on startup
+func (s *Settings) RestartRequired(previous *Settings) []string {
+	if previous == nil {
+		previous = &Settings{}
+	}
+
+	var changed []string
+	if s.RabbitURL != previous.RabbitURL {
+		changed = append(changed, "rabbitmq_url")
+	}
+	if s.MaxInFlightMessages != previous.MaxInFlightMessages {
+		changed = append(changed, "max_inflight_messages")
+	}
+	if s.CrawlConcurrency != previous.CrawlConcurrency {
+		changed = append(changed, "crawl_concurrency")
+	}
+	return changed
+}
+
+// applyStartupSettings overrides the config with the settings that are only applied on startup
+func (c *Controller) applyStartupSettings(settings *Settings) {
+	if len(settings.RabbitURL) > 0 {
+		c.RabbitConnectionURL = settings.RabbitURL
+		c.RabbitSanitizedURL = redactURL(settings.RabbitURL)
+	}
+	if settings.MaxInFlightMessages > 0 {
+		c.MaxInFlightMessages = settings.MaxInFlightMessages
+	}
+	if settings.CrawlConcurrency > 0 {
+		c.CrawlConcurrency = settings.CrawlConcurrency
+	}
+}
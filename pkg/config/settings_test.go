@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadSettings(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	t.Run("Should read the settings and expand the invocation headers", func(t *testing.T) {
+		os.Setenv("SETTINGS_TOKEN", "s3cr3t")
+		defer os.Unsetenv("SETTINGS_TOKEN")
+		_ = afero.WriteFile(fs, "settings.yaml", []byte(`topic_annotations: [" subscribes "]
+invocation_headers:
+  X-Internal-Auth: Bearer ${SETTINGS_TOKEN}
+static_mappings:
+  billing: [invoicer.legacy]`), 0644)
+
+		settings, err := ReadSettings(fs, "settings.yaml")
+		assert.NoError(t, err, "Should not throw")
+		assert.Equal(t, []string{"subscribes"}, settings.TopicAnnotations)
+		assert.Equal(t, map[string]string{"X-Internal-Auth": "Bearer s3cr3t"}, settings.InvocationHeaders)
+		assert.Equal(t, map[string][]string{"billing": {"invoicer.legacy"}}, settings.StaticMappings)
+	})
+
+	t.Run("Should reject invalid settings", func(t *testing.T) {
+		invalid := map[string]string{
+			"unknown.yaml":    `topic_annotation: [topic]`,
+			"annotation.yaml": `topic_annotations: [""]`,
+			"header.yaml":     `invocation_headers: {"X Auth": token}`,
+			"value.yaml":      "invocation_headers: {X-Auth: \"to\\x01ken\"}",
+			"static.yaml":     `static_mappings: {billing: ["ftp://billing.example.com"]}`,
+			"url.yaml":        `rabbitmq_url: http://rabbit:5672/`,
+			"negative.yaml":   `crawl_concurrency: -1`,
+		}
+		for file, content := range invalid {
+			_ = afero.WriteFile(fs, file, []byte(content), 0644)
+
+			_, err := ReadSettings(fs, file)
+			assert.Error(t, err, "Should throw err for %s", file)
+		}
+
+		_, err := ReadSettings(fs, "missing.yaml")
+		assert.Error(t, err, "Should throw err for a missing file")
+	})
+}
+
+func TestSettings_RestartRequired(t *testing.T) {
+	startup := &Settings{RabbitURL: "amqp://rabbit:5672/", CrawlConcurrency: 4}
+
+	t.Run("Should ignore changes of the reloadable settings", func(t *testing.T) {
+		changed := &Settings{RabbitURL: "amqp://rabbit:5672/", CrawlConcurrency: 4, TopicAnnotations: []string{"subscribes"}}
+		assert.Empty(t, changed.RestartRequired(startup))
+	})
+
+	t.Run("Should list the changed settings that require a restart", func(t *testing.T) {
+		changed := &Settings{RabbitURL: "amqp://other:5672/", MaxInFlightMessages: 10, CrawlConcurrency: 4}
+		assert.Equal(t, []string{"rabbitmq_url", "max_inflight_messages"}, changed.RestartRequired(startup))
+	})
+
+	t.Run("Should compare to empty settings without startup settings", func(t *testing.T) {
+		changed := &Settings{CrawlConcurrency: 2}
+		assert.Equal(t, []string{"crawl_concurrency"}, changed.RestartRequired(nil))
+	})
+}
@@ -7,118 +7,445 @@ package connector
 
 import (
 	"log"
+	"os"
+	"sort"
+	"sync"
 
 	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+	"github.com/Templum/rabbitmq-connector/pkg/openfaas"
 	"github.com/Templum/rabbitmq-connector/pkg/rabbitmq"
 	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/Templum/rabbitmq-connector/pkg/version"
 	"github.com/streadway/amqp"
 )
 
 // RabbitToOpenFaaS defines the basic interactions for the connector
 type RabbitToOpenFaaS interface {
 	Run() error
+	Drain()
 	Shutdown()
 }
 
-// New creates a new connector instance using the provided parameters & config to build it up
-func New(manager rabbitmq.Manager, factory rabbitmq.Factory, invoker types.Invoker, conf *config.Controller) RabbitToOpenFaaS {
-	return &Connector{
+// NewBridge creates a new bridge instance using the provided parameters & config to build it up
+func NewBridge(manager rabbitmq.Manager, factory rabbitmq.Factory, invoker types.Invoker, conf *config.Controller) RabbitToOpenFaaS {
+	bridge := &Bridge{
 		client: invoker,
 
 		factory:    factory,
 		conManager: manager,
 		conf:       conf,
+		metrics:    metrics.Prometheus{},
+		activity:   rabbitmq.NewConsumerActivity(conf.ConsumerIdleAfter, conf.ConsumerPriority),
+		connection: rabbitmq.NewConnectionStats(conf.RabbitVHost, metrics.Prometheus{}),
 	}
+	if conf.MaxInFlightMessages > 0 {
+		bridge.limiter = rabbitmq.NewMessageLimiter(conf.MaxInFlightMessages)
+	}
+	if conf.ShutdownRequeueDelay > 0 {
+		bridge.inFlight = rabbitmq.NewInFlightDeliveries(conf.DelayedExchange, conf.ShutdownRequeueDelay)
+	}
+	return bridge
 }
 
-// Connector includes all relevant information that the connector needs to hold and maintain
-type Connector struct {
+// Bridge includes all relevant information that is needed to hold and maintain the consumption from RabbitMQ
+type Bridge struct {
 	client types.Invoker
 
 	factory    rabbitmq.Factory
 	conManager rabbitmq.Manager
 	conf       *config.Controller
 	exchanges  []rabbitmq.ExchangeOrganizer
+	status     *rabbitmq.StatusPublisher
+	heartbeat  *rabbitmq.HeartbeatPublisher
+	// limiter is shared by all exchanges and kept across reconnects, so the cap applies to the connector as a whole
+	limiter *rabbitmq.MessageLimiter
+	// activity counts the deliveries of all exchanges across reconnects, it is reported by /status/consumer
+	activity *rabbitmq.ConsumerActivity
+	// inFlight is present if the in-flight deliveries are requeued with a delay during shutdown, see requeueInFlight
+	inFlight *rabbitmq.InFlightDeliveries
+	// archiver is kept across reconnects as well and stopped once the bridge is shut down
+	archiver  *rabbitmq.AsyncArchiver
+	transform *rabbitmq.PayloadTransform
+	metrics   metrics.Sink
+	// checkpoints commit the offsets of stream queues, they are shared by the bridges of all vhosts
+	checkpoints *rabbitmq.StreamCheckpoints
+	// traces receive a span per invocation, they are shared by the bridges of all vhosts
+	traces *rabbitmq.TraceFile
+	// recent keeps the last processed deliveries of every topic, it is shared by the bridges of all vhosts
+	recent *rabbitmq.RecentMessages
+
+	// connection describes the connection to RabbitMQ across reconnects, it is reported by the heartbeat and /status/amqp
+	connection *rabbitmq.ConnectionStats
+
+	// topics are the discovered topics, which are consumed by every exchange if QueuePerTopic is enabled
+	lock   sync.Mutex
+	topics map[string]struct{}
+}
+
+// WithMetrics records the instrumentation of the exchanges using the sink instead of Prometheus, it applies to the
+// exchanges built by the next Run
+func (b *Bridge) WithMetrics(sink metrics.Sink) *Bridge {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.metrics = sink
+	b.connection.WithMetrics(sink)
+	return b
+}
+
+// WithArchiver archives every delivery in the background using the archiver, it applies to the exchanges built
+// by the next Run
+func (b *Bridge) WithArchiver(archiver rabbitmq.MessageArchiver) *Bridge {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.archiver != nil {
+		b.archiver.Stop()
+	}
+	b.archiver = rabbitmq.NewAsyncArchiver(archiver)
+	return b
+}
+
+// WithTraceFile writes a span per invocation to the trace file, it applies to the exchanges built by the next Run
+func (b *Bridge) WithTraceFile(traces *rabbitmq.TraceFile) *Bridge {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.traces = traces
+	return b
+}
+
+// WithRecentMessages records the last processed deliveries of every topic, it applies to the exchanges built by the
+// next Run
+func (b *Bridge) WithRecentMessages(recent *rabbitmq.RecentMessages) *Bridge {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.recent = recent
+	return b
+}
+
+// WithStreamCheckpoints commits the offsets of the stream queues using the checkpoints, it applies to the exchanges
+// built by the next Run
+func (b *Bridge) WithStreamCheckpoints(checkpoints *rabbitmq.StreamCheckpoints) *Bridge {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.checkpoints = checkpoints
+	return b
+}
+
+// WithPayloadTransform transforms the payload of every delivery before it is invoked, it applies to the exchanges
+// built by the next Run
+func (b *Bridge) WithPayloadTransform(transform *rabbitmq.PayloadTransform) *Bridge {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.transform = transform
+	return b
 }
 
 // Run starts the connector and creates a connection RabbitMQ. Further it implements the defined Topology.
 // Also it adds a listener that handles connection failures.
-func (c *Connector) Run() error {
+func (b *Bridge) Run() error {
 	log.Println("Started RabbitMQ <=> OpenFaaS Connector")
-	log.Printf("Will now establish connection to %s", c.conf.RabbitSanitizedURL)
+	log.Printf("Will now establish connection to %s", b.conf.RabbitSanitizedURL)
 
-	failureChan, conErr := c.conManager.Connect(c.conf.RabbitConnectionURL)
+	failureChan, conErr := b.conManager.Connect(b.conf.RabbitConnectionURL)
 	if conErr != nil {
 		return conErr
 	}
 
-	go c.HandleConnectionError(failureChan)
+	b.connection.Connected()
+	go b.HandleConnectionError(failureChan)
 
-	genErr := c.generateExchangesFrom(c.conf.Topology)
+	if b.conf.StatusExchange != "" || b.conf.StatusRoutingKey != "" {
+		channel, err := b.connection.Track(b.conManager).Channel()
+		if err != nil {
+			return err
+		}
+
+		b.status = rabbitmq.NewStatusPublisher(channel, b.conf.StatusExchange, b.conf.StatusRoutingKey).
+			WithSampling(b.conf.StatusSampleRate, b.conf.StatusRecordFailures).
+			WithBatching(b.conf.StatusBatchSize, b.conf.StatusFlushInterval)
+		log.Printf("Will publish status records to exchange '%s' using routing key '%s'", b.conf.StatusExchange, b.conf.StatusRoutingKey)
+	}
+
+	extractor, err := rabbitmq.NewTopicExtractor(b.conf.TopicSource)
+	if err != nil {
+		return err
+	}
+	var affinity rabbitmq.TopicExtractor
+	if len(b.conf.AffinityKeySource) > 0 {
+		if affinity, err = rabbitmq.NewTopicExtractor(b.conf.AffinityKeySource); err != nil {
+			return err
+		}
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	genErr := b.generateExchangesFrom(b.conf.Topology, extractor, affinity)
 	if genErr != nil {
 		return genErr
 	}
 
-	for _, ex := range c.exchanges {
+	b.reconcile()
+	for _, ex := range b.exchanges {
 		err := ex.Start()
 		if err != nil {
 			return err
 		}
 	}
 
+	if b.conf.HeartbeatExchange != "" || b.conf.HeartbeatRoutingKey != "" {
+		channel, err := b.connection.Track(b.conManager).Channel()
+		if err != nil {
+			return err
+		}
+
+		b.heartbeat = rabbitmq.NewHeartbeatPublisher(channel, b.conf.HeartbeatExchange, b.conf.HeartbeatRoutingKey, b.conf.HeartbeatInterval, b.collectHeartbeat)
+		log.Printf("Will publish heartbeats every %s to exchange '%s' using routing key '%s'", b.conf.HeartbeatInterval, b.conf.HeartbeatExchange, b.conf.HeartbeatRoutingKey)
+	}
+
 	return nil
 }
 
+// refreshStatsProvider is implemented by invokers maintaining a topic map, like the openfaas.Controller
+type refreshStatsProvider interface {
+	RefreshStats() openfaas.RefreshStats
+}
+
+// collectHeartbeat describes the connector, the stats of the topic map are included if the invoker provides them
+func (b *Bridge) collectHeartbeat() rabbitmq.Heartbeat {
+	commit, release := version.GetReleaseInfo()
+	pod, _ := os.Hostname()
+
+	connection := b.connection.Status()
+
+	heartbeat := rabbitmq.Heartbeat{
+		Pod:        pod,
+		Version:    release,
+		Commit:     commit,
+		Connected:  connection.State == rabbitmq.ConnectionConnected,
+		Reconnects: connection.Reconnects,
+	}
+
+	if provider, ok := b.client.(refreshStatsProvider); ok {
+		stats := provider.RefreshStats()
+		heartbeat.Topics = stats.Topics
+		heartbeat.Functions = stats.Functions
+		heartbeat.LastRefresh = stats.LastRefresh.UTC()
+		heartbeat.RefreshOverruns = stats.Overruns
+	}
+
+	return heartbeat
+}
+
+// TopicsChanged updates the discovered topics and reconciles the queues of the exchanges with them
+func (b *Bridge) TopicsChanged(added []string, removed []string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.topics == nil {
+		b.topics = map[string]struct{}{}
+	}
+	for _, topic := range added {
+		b.topics[topic] = struct{}{}
+	}
+	for _, topic := range removed {
+		delete(b.topics, topic)
+	}
+
+	b.reconcile()
+}
+
+// reconcile passes the discovered topics to every exchange, failed exchanges are reconciled again with the next change
+func (b *Bridge) reconcile() {
+	if !b.conf.QueuePerTopic {
+		return
+	}
+
+	topics := make([]string, 0, len(b.topics))
+	for topic := range b.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	for _, ex := range b.exchanges {
+		reconciler, ok := ex.(rabbitmq.TopicReconciler)
+		if !ok {
+			continue
+		}
+
+		if err := reconciler.Reconcile(topics); err != nil {
+			log.Printf("Received %s while reconciling the queues of the discovered topics", err)
+		}
+	}
+}
+
 // HandleConnectionError listens for incoming connection errors. If it is recoverable it will attempt a self-heal.
 // Otherwise it shutsdown the whole connector
-func (c *Connector) HandleConnectionError(ch <-chan *amqp.Error) {
+func (b *Bridge) HandleConnectionError(ch <-chan *amqp.Error) {
 	err := <-ch
 	log.Printf("Rabbit MQ Connection failed with %s Code: %d [Server=%t Recover=%t]", err.Reason, err.Code, err.Server, err.Recover)
 
 	if err.Recover {
-		for _, ex := range c.exchanges {
+		b.connection.Reconnecting(err.Reason)
+		b.lock.Lock()
+		for _, ex := range b.exchanges {
 			ex.Stop()
 		}
+		b.stopStatusPublisher()
+		b.stopHeartbeat()
 
 		// Release old exchange refs to garbage collection
-		c.exchanges = nil
-		err := c.Run()
+		b.exchanges = nil
+		b.lock.Unlock()
+
+		err := b.Run()
 		if err != nil {
 			log.Panicf("Received critical error: %s during restart, shutting down", err)
 		}
 	} else {
+		b.connection.Closed()
 		log.Panicf("Received critical error: %s, shutting down", err)
 	}
 }
 
+// Drain stops taking new deliveries, while the in-flight ones are finished and acknowledged. RabbitMQ redistributes
+// the remaining deliveries to the other consumers, e.g. further replicas. Afterwards the bridge is shut down.
+func (b *Bridge) Drain() {
+	log.Println("Draining RabbitMQ <=> OpenFaaS Connector")
+
+	b.lock.Lock()
+	for _, ex := range b.exchanges {
+		if drainer, ok := ex.(rabbitmq.Drainer); ok {
+			drainer.Drain()
+		}
+	}
+	b.lock.Unlock()
+
+	b.Shutdown()
+}
+
+// requeueInFlight republishes the in-flight deliveries onto the delayed exchange, so that they are redelivered after
+// a pause rather than right away once the connection is closed. It does not wait for the lock of the bridge, which
+// is held by a drain until the in-flight invocations finished.
+func (b *Bridge) requeueInFlight() {
+	if b.inFlight != nil {
+		b.inFlight.RequeueDelayed()
+	}
+}
+
 // Shutdown is usually called during graceful shutdown. It stops all exchanges and finally closes the connection
 // to RabbitMQ
-func (c *Connector) Shutdown() {
+func (b *Bridge) Shutdown() {
 	log.Println("Shutdown RabbitMQ <=> OpenFaaS Connector")
 
 	// Loop over Exchanges to close
-	for _, ex := range c.exchanges {
+	b.lock.Lock()
+	for _, ex := range b.exchanges {
 		ex.Stop()
 	}
+	b.stopStatusPublisher()
+	b.stopHeartbeat()
+	b.stopArchiver()
+	b.connection.Closed()
+	b.lock.Unlock()
 
 	// Close Connection
-	c.conManager.Disconnect()
+	b.conManager.Disconnect()
 }
 
-func (c *Connector) generateExchangesFrom(t types.Topology) error {
+func (b *Bridge) generateExchangesFrom(t types.Topology, extractor rabbitmq.TopicExtractor, affinity rabbitmq.TopicExtractor) error {
+	options := rabbitmq.ExchangeOptions{
+		Extractor:           extractor,
+		Affinity:            affinity,
+		MaxDeliveryAttempts: b.conf.MaxDeliveryAttempts,
+		QuarantineExchange:  b.conf.QuarantineExchange,
+		DeadLetterExchange:  b.conf.DeadLetterExchange,
+		RetryDelayExchange:  b.conf.RetryDelayExchange,
+		RetryBackoff:        b.conf.RetryBackoff,
+		ConsumerPriority:    b.conf.ConsumerPriority,
+		AckBatchSize:        b.conf.AckBatchSize,
+		AckFlushInterval:    b.conf.AckFlushInterval,
+		Limiter:             b.limiter,
+		QueuePriorities:     b.conf.QueuePriorities,
+		Activity:            b.activity,
+		InFlight:            b.inFlight,
+		Decoders:            b.conf.Decoders,
+		Metrics:             b.metrics,
+		Transform:           b.transform,
+		Replies:             b.conf.EnableReplies,
+		Checkpoints:         b.checkpoints,
+		PriorityDispatch:    b.conf.PriorityDispatch,
+		Recent:              b.recent,
+	}
+	if b.archiver != nil {
+		options.Archiver = b.archiver
+	}
+	var reporters rabbitmq.StatusReporters
+	if b.status != nil {
+		reporters = append(reporters, b.status)
+	}
+	if b.traces != nil {
+		reporters = append(reporters, b.traces)
+	}
+	if len(reporters) > 0 {
+		options.Reporter = reporters
+	}
+	if gate, ok := b.client.(rabbitmq.CapacityGate); ok && (b.conf.AsyncQueueDepthThreshold > 0 || b.conf.PauseWhileStale) {
+		options.Gate = gate
+	}
+
 	// Do we want to use a connection per Exchange or continue with channels ?
-	c.factory.WithChanCreator(c.conManager).WithInvoker(c.client)
+	b.factory.WithChanCreator(b.connection.Track(b.conManager)).WithInvoker(b.client).WithOptions(options)
 
-	for _, topology := range c.conf.Topology {
+	for _, topology := range b.conf.Topology {
 		tmp := types.Exchange(topology)
-		exchange, buildErr := c.factory.WithExchange(&tmp).Build()
+		b.applyExchangeDeclaration(&tmp)
+		exchange, buildErr := b.factory.WithExchange(&tmp).Build()
 
 		if buildErr != nil {
 			return buildErr
 		}
 
-		c.exchanges = append(c.exchanges, exchange)
+		b.exchanges = append(b.exchanges, exchange)
 	}
 
 	return nil
 }
+
+// applyExchangeDeclaration enforces the configured declaration parameters, so that the exchange matches existing policies
+func (b *Bridge) applyExchangeDeclaration(ex *types.Exchange) {
+	if len(b.conf.ExchangeType) > 0 {
+		ex.Type = b.conf.ExchangeType
+	}
+	ex.Durable = ex.Durable || b.conf.ExchangeDurable
+	ex.AutoDeleted = ex.AutoDeleted || b.conf.ExchangeAutoDelete
+	ex.Internal = ex.Internal || b.conf.ExchangeInternal
+	ex.Lazy = ex.Lazy || b.conf.LazyQueue
+}
+
+func (b *Bridge) stopStatusPublisher() {
+	if b.status != nil {
+		b.status.Stop()
+		b.status = nil
+	}
+}
+
+func (b *Bridge) stopArchiver() {
+	if b.archiver != nil {
+		b.archiver.Stop()
+		b.archiver = nil
+	}
+}
+
+func (b *Bridge) stopHeartbeat() {
+	if b.heartbeat != nil {
+		b.heartbeat.Stop()
+		b.heartbeat = nil
+	}
+}
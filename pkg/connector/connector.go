@@ -0,0 +1,380 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/Templum/rabbitmq-connector/pkg/kube"
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+	"github.com/Templum/rabbitmq-connector/pkg/openfaas"
+	"github.com/Templum/rabbitmq-connector/pkg/rabbitmq"
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/Templum/rabbitmq-connector/pkg/wasm"
+	"github.com/spf13/afero"
+)
+
+// Connector wires up the whole RabbitMQ to OpenFaaS pipeline, which allows it to be embedded into other services
+type Connector struct {
+	conf       *config.Controller
+	controller *openfaas.Controller
+	bridge     RabbitToOpenFaaS
+	// checkpoints persist the committed offsets of stream queues while running, if configured
+	checkpoints *rabbitmq.StreamCheckpoints
+	// traces receive a span per invocation while running, if configured
+	traces *rabbitmq.TraceFile
+	// recent keeps the last processed deliveries of every topic, if configured
+	recent *rabbitmq.RecentMessages
+
+	lock    sync.Mutex
+	cancel  context.CancelFunc
+	running bool
+	// drained is closed once the latest drain shut down, a Stop during the drain awaits it
+	drained chan struct{}
+}
+
+// New builds the pipeline from the provided config, using the crawler to discover and invoke functions
+func New(conf *config.Controller, crawler openfaas.FunctionCrawler) (*Connector, error) {
+	if conf == nil {
+		return nil, errors.New("config is required")
+	}
+	if crawler == nil {
+		return nil, errors.New("function crawler is required")
+	}
+
+	controller := openfaas.NewController(conf, crawler, openfaas.NewTopicFunctionCache())
+	if len(conf.TopicMappingPath) > 0 {
+		controller.WithTopicSources(openfaas.NewFileTopicSource(afero.NewOsFs(), conf.TopicMappingPath))
+	}
+	if len(conf.TopicEnvKey) > 0 {
+		controller.WithTopicSources(openfaas.NewEnvTopicSource(conf.TopicEnvKey))
+	}
+	if len(conf.StaticMappingsPath) > 0 {
+		controller.WithStaticMappingsFile(afero.NewOsFs(), conf.StaticMappingsPath)
+	}
+	if len(conf.SettingsPath) > 0 {
+		controller.WithSettingsFile(afero.NewOsFs(), conf.SettingsPath)
+	}
+	if conf.AsyncQueueDepthThreshold > 0 {
+		httpClient := types.MakeHTTPClient(conf.InsecureSkipVerify, 1, conf.AsyncQueueDepthPollInterval, conf.GatewayIdleConnTimeout)
+		controller.WithAsyncQueueGate(openfaas.NewAsyncQueueGate(httpClient, conf.AsyncQueueMetricsURL, conf.AsyncQueueDepthMetric, conf.AsyncQueueDepthThreshold, conf.AsyncQueueDepthPollInterval))
+	}
+
+	if conf.EmitKubeEvents {
+		recorder, err := kube.NewInClusterRecorder(conf.KubeEventObject)
+		if err != nil {
+			return nil, err
+		}
+		events := kube.NewSubscriptionEvents(recorder)
+		controller.WithSubscriptionListeners(events).WithFunctionListeners(events)
+	}
+
+	newManager := func(vhost string) (rabbitmq.Manager, error) {
+		broker := rabbitmq.NewBroker()
+		if len(conf.RabbitProxyURL) > 0 {
+			proxyBroker, err := rabbitmq.NewProxyBroker(conf.RabbitProxyURL)
+			if err != nil {
+				return nil, err
+			}
+			broker = proxyBroker
+		}
+		broker.WithVHost(vhost).WithConnectionName(conf.RabbitConnectionName)
+		return rabbitmq.NewConnectionManager(broker, conf.TLSConfig, conf.ReconnectBackoff), nil
+	}
+
+	// Every vhost of the topology is consumed using its own connection
+	var bridge RabbitToOpenFaaS
+	if groups := splitTopologyByVHost(conf); len(groups) > 1 {
+		bridges, err := newVHostBridges(groups, controller, conf, newManager)
+		if err != nil {
+			return nil, err
+		}
+		bridge = bridges
+	} else {
+		manager, err := newManager(conf.RabbitVHost)
+		if err != nil {
+			return nil, err
+		}
+		bridge = NewBridge(manager, rabbitmq.NewFactory(), controller, conf)
+	}
+
+	c := &Connector{
+		conf:       conf,
+		controller: controller,
+		bridge:     bridge,
+	}
+	if len(conf.ArchiveSink) > 0 {
+		archiver, err := rabbitmq.NewMessageArchiver(afero.NewOsFs(), conf.ArchiveSink)
+		if err != nil {
+			return nil, err
+		}
+		c.eachBridge(func(bridge *Bridge) { bridge.WithArchiver(archiver) })
+	}
+	if len(conf.StreamCheckpointFile) > 0 {
+		c.checkpoints = rabbitmq.NewStreamCheckpoints(afero.NewOsFs(), conf.StreamCheckpointFile, conf.StreamConsumerReference)
+		if err := c.checkpoints.Load(); err != nil {
+			return nil, err
+		}
+		c.eachBridge(func(bridge *Bridge) { bridge.WithStreamCheckpoints(c.checkpoints) })
+	}
+	if len(conf.TraceFilePath) > 0 {
+		traces, err := rabbitmq.NewTraceFile(afero.NewOsFs(), conf.TraceFilePath, conf.TraceFileMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		c.traces = traces
+		c.eachBridge(func(bridge *Bridge) { bridge.WithTraceFile(c.traces) })
+	}
+	if conf.RecentMessageBufferSize > 0 {
+		c.recent = rabbitmq.NewRecentMessages(conf.RecentMessageBufferSize, conf.RecentMessageBodies)
+		c.eachBridge(func(bridge *Bridge) { bridge.WithRecentMessages(c.recent) })
+	}
+	if len(conf.TransformPlugin) > 0 {
+		mapper, err := wasm.Load(context.Background(), afero.NewOsFs(), conf.TransformPlugin, conf.TransformMemoryLimit)
+		if err != nil {
+			return nil, err
+		}
+		transform := &rabbitmq.PayloadTransform{Mapper: mapper, Timeout: conf.TransformTimeout, FailOpen: conf.TransformFailOpen}
+		c.eachBridge(func(bridge *Bridge) { bridge.WithPayloadTransform(transform) })
+	}
+	if listener, ok := bridge.(openfaas.TopicListener); ok && conf.QueuePerTopic {
+		controller.WithTopicListeners(listener)
+	}
+
+	return c, nil
+}
+
+// eachBridge applies the func to the bridge of every vhost
+func (c *Connector) eachBridge(fn func(bridge *Bridge)) {
+	switch bridge := c.bridge.(type) {
+	case *Bridge:
+		fn(bridge)
+	case vhostBridges:
+		for _, vhostBridge := range bridge {
+			fn(vhostBridge)
+		}
+	}
+}
+
+// WithMetrics replaces the Prometheus instrumentation of the pipeline with the sink, it has to be called before Start.
+// The crawler provided to New keeps its own instrumentation, see openfaas.Client.WithMetrics.
+func (c *Connector) WithMetrics(sink metrics.Sink) *Connector {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.controller.WithMetrics(sink)
+	c.eachBridge(func(bridge *Bridge) { bridge.WithMetrics(sink) })
+	return c
+}
+
+// WithPayloadTransform transforms the payload of every delivery before it is invoked, see rabbitmq.PayloadTransform
+func (c *Connector) WithPayloadTransform(transform *rabbitmq.PayloadTransform) *Connector {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.eachBridge(func(bridge *Bridge) { bridge.WithPayloadTransform(transform) })
+	return c
+}
+
+// Start populates the topic map and afterwards begins consuming from RabbitMQ. The topic map is
+// refreshed until either the provided context is done or Stop is called.
+func (c *Connector) Start(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.running {
+		return errors.New("connector is already running")
+	}
+	if c.draining() {
+		return errors.New("connector is still draining")
+	}
+
+	cacheCtx, cancel := context.WithCancel(ctx)
+	c.controller.Start(cacheCtx)
+	log.Printf("Started Cache Task which populates the topic map")
+
+	if err := c.bridge.Run(); err != nil {
+		cancel()
+		return err
+	}
+
+	c.checkpoints.Start(c.conf.StreamCheckpointInterval)
+	c.traces.Start()
+	c.cancel = cancel
+	c.running = true
+	return nil
+}
+
+// Stop shuts down consumption and the topic map refresh. If the provided context is done before
+// the shutdown finished, its error is returned while the shutdown continues in the background. With a shutdown
+// requeue delay the in-flight deliveries are requeued with a delay beforehand. During a drain, e.g. one whose
+// context is done already, the shutdown of the drain is awaited instead.
+func (c *Connector) Stop(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.draining() {
+		select {
+		case <-c.drained:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if !c.running {
+		return nil
+	}
+
+	c.eachBridge(func(bridge *Bridge) { bridge.requeueInFlight() })
+
+	done := make(chan struct{})
+	go func() {
+		c.bridge.Shutdown()
+		c.stopCheckpoints()
+		c.stopTraces()
+		close(done)
+	}()
+
+	c.cancel()
+	c.running = false
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Drain stops taking new messages, finishes the in-flight invocations and afterwards shuts down like Stop. Unlike
+// Stop the topic map is refreshed until the drain finished, as the in-flight invocations still rely on it. If the
+// provided context is done before, its error is returned while the drain continues in the background. With a
+// shutdown requeue delay the unfinished deliveries are requeued with a delay in that case.
+func (c *Connector) Drain(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.running {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func(cancel context.CancelFunc) {
+		c.bridge.Drain()
+		c.stopCheckpoints()
+		c.stopTraces()
+		cancel()
+		close(done)
+	}(c.cancel)
+
+	c.running = false
+	c.drained = done
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		// The invocations that did not finish in time are not awaited any longer
+		c.eachBridge(func(bridge *Bridge) { bridge.requeueInFlight() })
+		return ctx.Err()
+	}
+}
+
+// draining is true until the latest drain shut down, the lock has to be held
+func (c *Connector) draining() bool {
+	if c.drained == nil {
+		return false
+	}
+	select {
+	case <-c.drained:
+		return false
+	default:
+		return true
+	}
+}
+
+// stopCheckpoints persists the offsets committed until the consumption was shut down
+func (c *Connector) stopCheckpoints() {
+	if err := c.checkpoints.Stop(); err != nil {
+		log.Printf("Failed to persist stream offsets due to %s", err)
+	}
+}
+
+// stopTraces writes the spans buffered until the consumption was shut down
+func (c *Connector) stopTraces() {
+	if err := c.traces.Stop(); err != nil {
+		log.Printf("Failed to write spans due to %s", err)
+	}
+}
+
+// Dump is the resolved config alongside the topic map of a single crawl
+type Dump struct {
+	Config config.Controller              `json:"config"`
+	Topics map[string][]openfaas.Function `json:"topics"`
+}
+
+// Dump crawls the gateway once and writes the redacted config and the resulting topic map as json, without consuming
+// from RabbitMQ. If the crawl fails its error is returned, after the dump was written.
+func (c *Connector) Dump(ctx context.Context, w io.Writer) error {
+	topics, crawlErr := c.controller.RefreshOnce(ctx)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(Dump{Config: c.conf.Redacted(), Topics: topics}); err != nil {
+		return err
+	}
+
+	return crawlErr
+}
+
+// DumpDOT crawls the gateway once and writes the resulting topic map as Graphviz DOT graph, see openfaas.WriteDOT.
+// If the crawl fails its error is returned, after the graph was written.
+func (c *Connector) DumpDOT(ctx context.Context, w io.Writer) error {
+	topics, crawlErr := c.controller.RefreshOnce(ctx)
+
+	if err := openfaas.WriteDOT(w, topics); err != nil {
+		return err
+	}
+
+	return crawlErr
+}
+
+// ConsumerStatus reports whether the connector is receiving deliveries or idle, e.g. as standby replica of one with
+// a higher consumer priority. The bridges of all vhosts share the activity.
+func (c *Connector) ConsumerStatus() rabbitmq.ConsumerStatus {
+	var status rabbitmq.ConsumerStatus
+	c.eachBridge(func(bridge *Bridge) { status = bridge.activity.Status() })
+	return status
+}
+
+// AMQPStatus describes the connection to every vhost, including how often and why it was reconnected
+func (c *Connector) AMQPStatus() []rabbitmq.ConnectionStatus {
+	var statuses []rabbitmq.ConnectionStatus
+	c.eachBridge(func(bridge *Bridge) { statuses = append(statuses, bridge.connection.Status()) })
+	return statuses
+}
+
+// RecentMessages returns the last processed deliveries of the topic, oldest first. It is empty without
+// RecentMessageBufferSize.
+func (c *Connector) RecentMessages(topic string) []rabbitmq.RecentMessage {
+	return c.recent.Recent(topic)
+}
+
+// Controller returns the controller maintaining the topic map and invoking the functions
+func (c *Connector) Controller() *openfaas.Controller {
+	return c.controller
+}
+
+// Config returns the config the connector was built from
+func (c *Connector) Config() *config.Controller {
+	return c.conf
+}
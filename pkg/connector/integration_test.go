@@ -0,0 +1,372 @@
+//go:build integration
+
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package connector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/Templum/rabbitmq-connector/pkg/openfaas"
+	"github.com/Templum/rabbitmq-connector/pkg/rabbitmq"
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/docker/go-connections/nat"
+	"github.com/spf13/afero"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// The integration suite runs the connector against a real RabbitMQ and a stub gateway, it is only built using
+// go test -tags integration ./... and skipped if docker is not available.
+
+const (
+	integrationExchange = "Billing"
+	integrationTopic    = "billing"
+)
+
+func skipIfDockerIsNotHealthy(t *testing.T) {
+	provider, err := testcontainers.ProviderDocker.GetProvider()
+	if err != nil {
+		t.Skipf("Docker is not running. TestContainers can't perform is work without it: %s", err)
+	}
+
+	if docker, ok := provider.(*testcontainers.DockerProvider); ok {
+		if err := docker.Health(context.Background()); err != nil {
+			t.Skipf("Docker is not running. TestContainers can't perform is work without it: %s", err)
+		}
+	}
+}
+
+// stubInvocation is an invocation received by the stub gateway
+type stubInvocation struct {
+	Path string
+	Body string
+}
+
+// stubGateway serves the function of the billing topic and records its invocations. Invocations are answered
+// using the status returned by respond, which defaults to accepting them.
+type stubGateway struct {
+	server      *httptest.Server
+	invocations chan stubInvocation
+
+	lock    sync.Mutex
+	respond func(invocation stubInvocation) int
+}
+
+func newStubGateway() *stubGateway {
+	gateway := &stubGateway{invocations: make(chan stubInvocation, 100)}
+	gateway.server = httptest.NewServer(http.HandlerFunc(gateway.serve))
+	return gateway
+}
+
+func (g *stubGateway) serve(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/system/namespaces":
+		_, _ = w.Write([]byte(`[]`))
+	case r.URL.Path == "/system/functions":
+		_, _ = w.Write([]byte(`[{"name": "biller", "availableReplicas": 1, "annotations": {"topic": "` + integrationTopic + `"}}]`))
+	case strings.HasPrefix(r.URL.Path, "/function/"), strings.HasPrefix(r.URL.Path, "/async-function/"):
+		body, _ := io.ReadAll(r.Body)
+		invocation := stubInvocation{Path: r.URL.Path, Body: string(body)}
+
+		status := http.StatusAccepted
+		if strings.HasPrefix(r.URL.Path, "/function/") {
+			status = http.StatusOK
+		}
+		g.lock.Lock()
+		respond := g.respond
+		g.lock.Unlock()
+		if respond != nil {
+			status = respond(invocation)
+		}
+
+		g.invocations <- invocation
+		w.WriteHeader(status)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (g *stubGateway) WithResponder(respond func(invocation stubInvocation) int) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.respond = respond
+}
+
+// Await returns the next invocation or fails once the timeout passed
+func (g *stubGateway) Await(t *testing.T, timeout time.Duration) stubInvocation {
+	t.Helper()
+	select {
+	case invocation := <-g.invocations:
+		return invocation
+	case <-time.After(timeout):
+		t.Fatalf("Expected the stub gateway to be invoked within %s", timeout)
+		return stubInvocation{}
+	}
+}
+
+// AssertNoInvocation fails if the stub gateway is invoked within the duration
+func (g *stubGateway) AssertNoInvocation(t *testing.T, duration time.Duration) {
+	t.Helper()
+	select {
+	case invocation := <-g.invocations:
+		t.Errorf("Expected no further invocation, received %s with %s", invocation.Path, invocation.Body)
+	case <-time.After(duration):
+	}
+}
+
+// integrationEnv starts RabbitMQ alongside the stub gateway and tears both down once the test finished
+type integrationEnv struct {
+	container testcontainers.Container
+	gateway   *stubGateway
+	url       string
+}
+
+func newIntegrationEnv(t *testing.T) *integrationEnv {
+	skipIfDockerIsNotHealthy(t)
+
+	ctx := context.Background()
+	req := testcontainers.ContainerRequest{
+		Image:        "rabbitmq:3.7.4",
+		ExposedPorts: []string{"5672/tcp"},
+		WaitingFor: wait.ForAll(
+			wait.ForListeningPort(nat.Port("5672/tcp")),
+			wait.ForLog("Server startup complete;"),
+		),
+		Env: map[string]string{"RABBITMQ_DEFAULT_USER": "user", "RABBITMQ_DEFAULT_PASS": "pass"},
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = container.Terminate(ctx) })
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := container.MappedPort(ctx, nat.Port("5672/tcp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gateway := newStubGateway()
+	t.Cleanup(gateway.server.Close)
+
+	for key, value := range map[string]string{
+		"RMQ_HOST":               host,
+		"RMQ_PORT":               port.Port(),
+		"RMQ_USER":               "user",
+		"RMQ_PASS":               "pass",
+		"OPEN_FAAS_GW_URL":       gateway.server.URL,
+		"PATH_TO_TOPOLOGY":       "topology.yaml",
+		"TOPIC_MAP_REFRESH_TIME": "1s",
+		"RECONNECT_BACKOFF_BASE": "100ms",
+		"RECONNECT_BACKOFF_MAX":  "1s",
+	} {
+		os.Setenv(key, value)
+		key := key
+		t.Cleanup(func() { os.Unsetenv(key) })
+	}
+
+	return &integrationEnv{
+		container: container,
+		gateway:   gateway,
+		url:       fmt.Sprintf("amqp://user:pass@%s:%s/", host, port.Port()),
+	}
+}
+
+// StartConnector runs the connector wired up like the binary, using a durable billing exchange as topology
+func (e *integrationEnv) StartConnector(t *testing.T) *Connector {
+	fs := afero.NewMemMapFs()
+	_ = afero.WriteFile(fs, "topology.yaml", []byte(`- name: `+integrationExchange+`
+  topics: [`+integrationTopic+`]
+  declare: true
+  type: "direct"
+  durable: true
+  auto-deleted: false`), 0644)
+
+	conf, err := config.NewConfig(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpClient := types.MakeHTTPClient(conf.InsecureSkipVerify, conf.MaxClientsPerHost, conf.InvokeTimeout, conf.GatewayIdleConnTimeout)
+	crawler := openfaas.NewClient(httpClient, conf.BasicAuth, conf.GatewayURL, conf.NamespaceInvocationStyle)
+
+	target, err := New(conf, crawler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = target.Stop(ctx)
+	})
+
+	assert.Eventually(t, func() bool {
+		return len(target.Controller().TopicMap()[integrationTopic]) > 0
+	}, 10*time.Second, 100*time.Millisecond, "Expected the topic map to be populated")
+	return target
+}
+
+// Publish sends a persistent message onto the billing topic using a connection of its own
+func (e *integrationEnv) Publish(t *testing.T, body string) {
+	t.Helper()
+	con, err := amqp.Dial(e.url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Close()
+
+	channel, err := con.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer channel.Close()
+
+	err = channel.Publish(integrationExchange, integrationTopic, false, false, amqp.Publishing{
+		ContentType:  "text/plain",
+		DeliveryMode: amqp.Persistent,
+		Body:         []byte(body),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Queue returns the state of the billing queue, it fails while the broker is unavailable
+func (e *integrationEnv) Queue() (amqp.Queue, error) {
+	con, err := amqp.Dial(e.url)
+	if err != nil {
+		return amqp.Queue{}, err
+	}
+	defer con.Close()
+
+	channel, err := con.Channel()
+	if err != nil {
+		return amqp.Queue{}, err
+	}
+	defer channel.Close()
+
+	return channel.QueueInspect(rabbitmq.GenerateQueueName(integrationExchange, integrationTopic))
+}
+
+// Restart stops and starts the RabbitMQ application within the container, which keeps the mapped port
+func (e *integrationEnv) Restart(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	for _, cmd := range [][]string{{"rabbitmqctl", "stop_app"}, {"rabbitmqctl", "start_app"}} {
+		code, _, err := e.container.Exec(ctx, cmd)
+		if err != nil || code != 0 {
+			t.Fatalf("Expected %s to succeed, exited with %d due to %v", strings.Join(cmd, " "), code, err)
+		}
+	}
+}
+
+func TestIntegration_Invocation(t *testing.T) {
+	env := newIntegrationEnv(t)
+	env.StartConnector(t)
+
+	t.Run("Should invoke the subscribed function and ack the delivery", func(t *testing.T) {
+		env.Publish(t, "invoice 1")
+
+		invocation := env.gateway.Await(t, 10*time.Second)
+		assert.Contains(t, invocation.Path, "biller", "Expected the subscribed function to be invoked")
+		assert.Equal(t, "invoice 1", invocation.Body, "Expected the message body to be passed on")
+
+		env.gateway.AssertNoInvocation(t, 2*time.Second)
+		queue, err := env.Queue()
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, 0, queue.Messages, "Expected the delivery to be acked")
+		assert.Equal(t, 1, queue.Consumers, "Expected the connector to consume")
+	})
+
+	t.Run("Should nack and requeue a failed delivery", func(t *testing.T) {
+		var once sync.Once
+		env.gateway.WithResponder(func(invocation stubInvocation) int {
+			status := http.StatusAccepted
+			once.Do(func() { status = http.StatusInternalServerError })
+			return status
+		})
+		defer env.gateway.WithResponder(nil)
+
+		env.Publish(t, "invoice 2")
+
+		failed := env.gateway.Await(t, 10*time.Second)
+		assert.Equal(t, "invoice 2", failed.Body, "Expected the message body to be passed on")
+		redelivered := env.gateway.Await(t, 10*time.Second)
+		assert.Equal(t, "invoice 2", redelivered.Body, "Expected the requeued delivery to be invoked again")
+
+		env.gateway.AssertNoInvocation(t, 2*time.Second)
+		queue, err := env.Queue()
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, 0, queue.Messages, "Expected the redelivery to be acked")
+	})
+}
+
+func TestIntegration_Reconnect(t *testing.T) {
+	env := newIntegrationEnv(t)
+	target := env.StartConnector(t)
+
+	t.Run("Should redeliver the unacked delivery after the broker restarted", func(t *testing.T) {
+		// The first invocation is held until the broker went down, so it is never acked
+		held := make(chan struct{})
+		var once sync.Once
+		env.gateway.WithResponder(func(invocation stubInvocation) int {
+			once.Do(func() { <-held })
+			return http.StatusAccepted
+		})
+		defer env.gateway.WithResponder(nil)
+
+		env.Publish(t, "invoice 3")
+		assert.Eventually(t, func() bool {
+			queue, err := env.Queue()
+			return err == nil && queue.Messages == 0
+		}, 10*time.Second, 100*time.Millisecond, "Expected the delivery to be consumed")
+
+		env.Restart(t)
+		close(held)
+
+		first := env.gateway.Await(t, 10*time.Second)
+		assert.Equal(t, "invoice 3", first.Body, "Expected the held delivery to be invoked")
+		redelivered := env.gateway.Await(t, 30*time.Second)
+		assert.Equal(t, "invoice 3", redelivered.Body, "Expected the unacked delivery to be redelivered")
+	})
+
+	t.Run("Should consume again after the broker restarted", func(t *testing.T) {
+		assert.Eventually(t, func() bool {
+			statuses := target.AMQPStatus()
+			queue, err := env.Queue()
+			return len(statuses) == 1 && statuses[0].Reconnects > 0 && err == nil && queue.Consumers == 1
+		}, 30*time.Second, 100*time.Millisecond, "Expected the connector to reconnect")
+
+		env.Publish(t, "invoice 4")
+
+		invocation := env.gateway.Await(t, 10*time.Second)
+		assert.Equal(t, "invoice 4", invocation.Body, "Expected the connector to consume after reconnecting")
+		env.gateway.AssertNoInvocation(t, 2*time.Second)
+	})
+}
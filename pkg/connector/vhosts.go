@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package connector
+
+import (
+	"sync"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/Templum/rabbitmq-connector/pkg/rabbitmq"
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+)
+
+// vhostTopology is the part of the topology, which is consumed from a single vhost
+type vhostTopology struct {
+	vhost    string
+	topology types.Topology
+}
+
+// splitTopologyByVHost groups the exchanges by their vhost in order of appearance, exchanges without a vhost
+// belong to the configured RabbitVHost
+func splitTopologyByVHost(conf *config.Controller) []vhostTopology {
+	var groups []vhostTopology
+	indexes := map[string]int{}
+
+	for _, exchange := range conf.Topology {
+		vhost := exchange.VHost
+		if len(vhost) == 0 {
+			vhost = conf.RabbitVHost
+		}
+
+		index, known := indexes[vhost]
+		if !known {
+			index = len(groups)
+			indexes[vhost] = index
+			groups = append(groups, vhostTopology{vhost: vhost})
+		}
+		groups[index].topology = append(groups[index].topology, exchange)
+	}
+
+	return groups
+}
+
+// vhostBridges consumes from several vhosts using a bridge per vhost, hence every vhost has its own connection,
+// which is reconnected independent of the others. The bridges share the invoker, the in-flight limiter and the
+// consumer activity.
+type vhostBridges []*Bridge
+
+// newVHostBridges creates a bridge for every vhost, using the provided func to create the connection manager of it
+func newVHostBridges(groups []vhostTopology, invoker types.Invoker, conf *config.Controller, newManager func(vhost string) (rabbitmq.Manager, error)) (vhostBridges, error) {
+	var limiter *rabbitmq.MessageLimiter
+	if conf.MaxInFlightMessages > 0 {
+		limiter = rabbitmq.NewMessageLimiter(conf.MaxInFlightMessages)
+	}
+
+	activity := rabbitmq.NewConsumerActivity(conf.ConsumerIdleAfter, conf.ConsumerPriority)
+
+	bridges := make(vhostBridges, 0, len(groups))
+	for _, group := range groups {
+		vhostConf := *conf
+		vhostConf.RabbitVHost = group.vhost
+		vhostConf.Topology = group.topology
+
+		manager, err := newManager(group.vhost)
+		if err != nil {
+			return nil, err
+		}
+
+		bridge := NewBridge(manager, rabbitmq.NewFactory(), invoker, &vhostConf).(*Bridge)
+		bridge.limiter = limiter
+		bridge.activity = activity
+		bridges = append(bridges, bridge)
+	}
+	return bridges, nil
+}
+
+// Run connects to every vhost, if one fails the already connected ones are shut down
+func (v vhostBridges) Run() error {
+	for i, bridge := range v {
+		if err := bridge.Run(); err != nil {
+			for _, started := range v[:i] {
+				started.Shutdown()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Drain drains the bridges concurrently, so that the in-flight deliveries of every vhost finish in the same time
+func (v vhostBridges) Drain() {
+	v.each(func(bridge *Bridge) { bridge.Drain() })
+}
+
+// Shutdown shuts the bridges down concurrently
+func (v vhostBridges) Shutdown() {
+	v.each(func(bridge *Bridge) { bridge.Shutdown() })
+}
+
+// TopicsChanged passes the discovered topics to every bridge
+func (v vhostBridges) TopicsChanged(added []string, removed []string) {
+	for _, bridge := range v {
+		bridge.TopicsChanged(added, removed)
+	}
+}
+
+func (v vhostBridges) each(fn func(bridge *Bridge)) {
+	var wg sync.WaitGroup
+	for _, bridge := range v {
+		wg.Add(1)
+		go func(bridge *Bridge) {
+			defer wg.Done()
+			fn(bridge)
+		}(bridge)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package decoder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Decoder decodes the binary body of a message and exposes selected fields as headers, e.g. to determine the topic
+// via a header topic source. The body itself is passed on unchanged.
+type Decoder interface {
+	Decode(body []byte) (map[string]string, error)
+}
+
+// DecodeError is returned for bodies that the decoder of their topic can not decode
+type DecodeError struct {
+	Message string
+	Reason  string
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("message can not be decoded as %s: %s", e.Message, e.Reason)
+}
+
+// Retryable is false, as the body does not change on redelivery
+func (e *DecodeError) Retryable() bool {
+	return false
+}
+
+// ProtoDecoder decodes protobuf messages of a type described by a FileDescriptorSet, like the one written by
+// protoc --descriptor_set_out --include_imports
+type ProtoDecoder struct {
+	message protoreflect.MessageDescriptor
+	// headers maps the name of every exposed header to the path of fields it is read from
+	headers map[string][]protoreflect.FieldDescriptor
+}
+
+// NewProtoDecoder creates a decoder for the message, which exposes the value found at the dotted field path of every
+// header, e.g. customer.region. The paths have to end in a scalar or enum field and must not cross repeated fields.
+func NewProtoDecoder(descriptorSet []byte, message string, headers map[string]string) (*ProtoDecoder, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(descriptorSet, set); err != nil {
+		return nil, fmt.Errorf("descriptor set is invalid: %w", err)
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("descriptor set is invalid: %w", err)
+	}
+
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(message))
+	if err != nil {
+		return nil, fmt.Errorf("message %s is not part of the descriptor set", message)
+	}
+	messageDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", message)
+	}
+
+	decoder := &ProtoDecoder{message: messageDescriptor, headers: make(map[string][]protoreflect.FieldDescriptor, len(headers))}
+	for header, path := range headers {
+		fields, err := resolvePath(messageDescriptor, path)
+		if err != nil {
+			return nil, fmt.Errorf("field %s of header %s is invalid: %s", path, header, err)
+		}
+		decoder.headers[header] = fields
+	}
+	return decoder, nil
+}
+
+func resolvePath(message protoreflect.MessageDescriptor, path string) ([]protoreflect.FieldDescriptor, error) {
+	segments := strings.Split(path, ".")
+	fields := make([]protoreflect.FieldDescriptor, 0, len(segments))
+
+	for i, segment := range segments {
+		if message == nil {
+			return nil, fmt.Errorf("%s is not a message", strings.Join(segments[:i], "."))
+		}
+
+		field := message.Fields().ByName(protoreflect.Name(segment))
+		if field == nil {
+			return nil, fmt.Errorf("%s has no field %s", message.FullName(), segment)
+		}
+		if field.IsList() || field.IsMap() {
+			return nil, fmt.Errorf("%s is repeated", segment)
+		}
+
+		fields = append(fields, field)
+		message = field.Message()
+	}
+
+	if message != nil {
+		return nil, fmt.Errorf("%s is a message, not a scalar", path)
+	}
+	return fields, nil
+}
+
+// Decode unmarshals the body and returns the exposed headers. Fields that are not set are exposed with their
+// default value, unless one of the enclosing messages is absent, in which case the header is omitted.
+func (d *ProtoDecoder) Decode(body []byte) (map[string]string, error) {
+	message := dynamicpb.NewMessage(d.message)
+	if err := proto.Unmarshal(body, message); err != nil {
+		return nil, &DecodeError{Message: string(d.message.FullName()), Reason: err.Error()}
+	}
+
+	headers := make(map[string]string, len(d.headers))
+	for header, fields := range d.headers {
+		if value, ok := lookup(message, fields); ok {
+			headers[header] = value
+		}
+	}
+	return headers, nil
+}
+
+func lookup(message protoreflect.Message, fields []protoreflect.FieldDescriptor) (string, bool) {
+	for _, field := range fields[:len(fields)-1] {
+		if !message.Has(field) {
+			return "", false
+		}
+		message = message.Get(field).Message()
+	}
+
+	leaf := fields[len(fields)-1]
+	value := message.Get(leaf)
+	switch leaf.Kind() {
+	case protoreflect.EnumKind:
+		if enum := leaf.Enum().Values().ByNumber(value.Enum()); enum != nil {
+			return string(enum.Name()), true
+		}
+		return strconv.Itoa(int(value.Enum())), true
+	case protoreflect.BytesKind:
+		return string(value.Bytes()), true
+	default:
+		return value.String(), true
+	}
+}
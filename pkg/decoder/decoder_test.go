@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package decoder
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// orderDescriptorSet describes the following proto, as written by protoc --descriptor_set_out
+//
+//	package shop.v1;
+//	enum Kind { KIND_UNSPECIFIED = 0; KIND_EXPRESS = 1; }
+//	message Customer { string region = 1; }
+//	message Order { string id = 1; Customer customer = 2; Kind kind = 3; repeated string items = 4; int64 amount = 5; }
+func orderDescriptorSet(t *testing.T) []byte {
+	field := func(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		descriptor := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), JsonName: proto.String(name), Number: proto.Int32(number), Type: kind.Enum(), Label: label.Enum()}
+		if len(typeName) > 0 {
+			descriptor.TypeName = proto.String(typeName)
+		}
+		return descriptor
+	}
+	optional, repeated := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("shop/v1/order.proto"),
+		Package: proto.String("shop.v1"),
+		Syntax:  proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Kind"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("KIND_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("KIND_EXPRESS"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Customer"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("region", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+			}},
+			{Name: proto.String("Order"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+				field("customer", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional, ".shop.v1.Customer"),
+				field("kind", 3, descriptorpb.FieldDescriptorProto_TYPE_ENUM, optional, ".shop.v1.Kind"),
+				field("items", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING, repeated, ""),
+				field("amount", 5, descriptorpb.FieldDescriptorProto_TYPE_INT64, optional, ""),
+			}},
+		},
+	}
+
+	set, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	assert.NoError(t, err, "should not throw")
+	return set
+}
+
+// newOrder encodes an order of the sample proto, customer is omitted if the region is empty
+func newOrder(t *testing.T, set []byte, id string, region string, kind protoreflect.EnumNumber) []byte {
+	files := &descriptorpb.FileDescriptorSet{}
+	assert.NoError(t, proto.Unmarshal(set, files))
+	registry, err := protodesc.NewFiles(files)
+	assert.NoError(t, err, "should not throw")
+
+	orderDescriptor, _ := registry.FindDescriptorByName("shop.v1.Order")
+	order := dynamicpb.NewMessage(orderDescriptor.(protoreflect.MessageDescriptor))
+	fields := order.Descriptor().Fields()
+	order.Set(fields.ByName("id"), protoreflect.ValueOfString(id))
+	order.Set(fields.ByName("kind"), protoreflect.ValueOfEnum(kind))
+	order.Set(fields.ByName("amount"), protoreflect.ValueOfInt64(42))
+	if len(region) > 0 {
+		customer := order.Mutable(fields.ByName("customer")).Message()
+		customer.Set(customer.Descriptor().Fields().ByName("region"), protoreflect.ValueOfString(region))
+	}
+
+	body, err := proto.Marshal(order)
+	assert.NoError(t, err, "should not throw")
+	return body
+}
+
+func TestProtoDecoder(t *testing.T) {
+	set := orderDescriptorSet(t)
+	headers := map[string]string{"x-region": "customer.region", "x-kind": "kind", "x-amount": "amount"}
+
+	t.Run("Should expose the fields of the message as headers", func(t *testing.T) {
+		target, err := NewProtoDecoder(set, "shop.v1.Order", headers)
+		assert.NoError(t, err, "should not throw")
+
+		decoded, err := target.Decode(newOrder(t, set, "order-42", "emea", 1))
+
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, map[string]string{"x-region": "emea", "x-kind": "KIND_EXPRESS", "x-amount": "42"}, decoded)
+	})
+
+	t.Run("Should omit fields of absent messages", func(t *testing.T) {
+		target, err := NewProtoDecoder(set, "shop.v1.Order", headers)
+		assert.NoError(t, err, "should not throw")
+
+		decoded, err := target.Decode(newOrder(t, set, "order-42", "", 0))
+
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, map[string]string{"x-kind": "KIND_UNSPECIFIED", "x-amount": "42"}, decoded)
+	})
+
+	t.Run("Should return a non-retryable error for bodies that are no such message", func(t *testing.T) {
+		target, err := NewProtoDecoder(set, "shop.v1.Order", headers)
+		assert.NoError(t, err, "should not throw")
+
+		_, err = target.Decode([]byte{0x0a, 0xff})
+
+		var decodeErr *DecodeError
+		assert.True(t, errors.As(err, &decodeErr), "Expected a decode error")
+		assert.Equal(t, "shop.v1.Order", decodeErr.Message)
+		assert.False(t, decodeErr.Retryable())
+	})
+
+	t.Run("Should reject unknown messages and invalid field paths", func(t *testing.T) {
+		_, err := NewProtoDecoder([]byte("not a descriptor set"), "shop.v1.Order", nil)
+		assert.Error(t, err)
+
+		_, err = NewProtoDecoder(set, "shop.v1.Invoice", nil)
+		assert.EqualError(t, err, "message shop.v1.Invoice is not part of the descriptor set")
+
+		_, err = NewProtoDecoder(set, "shop.v1.Order", map[string]string{"x-region": "customer.country"})
+		assert.EqualError(t, err, "field customer.country of header x-region is invalid: shop.v1.Customer has no field country")
+
+		_, err = NewProtoDecoder(set, "shop.v1.Order", map[string]string{"x-customer": "customer"})
+		assert.EqualError(t, err, "field customer of header x-customer is invalid: customer is a message, not a scalar")
+
+		_, err = NewProtoDecoder(set, "shop.v1.Order", map[string]string{"x-item": "items"})
+		assert.EqualError(t, err, "field items of header x-item is invalid: items is repeated")
+
+		_, err = NewProtoDecoder(set, "shop.v1.Order", map[string]string{"x-id": "id.value"})
+		assert.EqualError(t, err, "field id.value of header x-id is invalid: id is not a message")
+	})
+}
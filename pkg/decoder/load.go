@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package decoder
+
+import (
+	"fmt"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+// ProtoDefinition describes the protobuf decoder of a topic within the decoders file
+type ProtoDefinition struct {
+	DescriptorSet string            `yaml:"descriptor-set"`
+	Message       string            `yaml:"message"`
+	Headers       map[string]string `yaml:"headers"`
+}
+
+// Load reads the yaml file mapping topics to the definition of their protobuf decoder and creates the decoders.
+// An invalid definition fails the whole file.
+func Load(fs afero.Fs, path string) (map[string]Decoder, error) {
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read decoders %s: %w", path, err)
+	}
+
+	definitions := map[string]ProtoDefinition{}
+	if err := yaml.Unmarshal(content, &definitions); err != nil {
+		return nil, fmt.Errorf("decoders %s are not a map of topics to decoder definitions: %w", path, err)
+	}
+
+	decoders := make(map[string]Decoder, len(definitions))
+	for topic, definition := range definitions {
+		descriptorSet, err := afero.ReadFile(fs, definition.DescriptorSet)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read descriptor set of topic %s: %w", topic, err)
+		}
+
+		decoder, err := NewProtoDecoder(descriptorSet, definition.Message, definition.Headers)
+		if err != nil {
+			return nil, fmt.Errorf("decoder of topic %s is invalid: %w", topic, err)
+		}
+		decoders[topic] = decoder
+	}
+	return decoders, nil
+}
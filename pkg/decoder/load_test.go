@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package decoder
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	set := orderDescriptorSet(t)
+
+	t.Run("Should create the decoders of every topic", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		_ = afero.WriteFile(fs, "config/order.binpb", set, 0644)
+		_ = afero.WriteFile(fs, "config/decoders.yaml", []byte(`orders:
+  descriptor-set: config/order.binpb
+  message: shop.v1.Order
+  headers:
+    x-region: customer.region`), 0644)
+
+		decoders, err := Load(fs, "config/decoders.yaml")
+
+		assert.NoError(t, err, "should not throw")
+		assert.Len(t, decoders, 1)
+		decoded, err := decoders["orders"].Decode(newOrder(t, set, "order-42", "emea", 0))
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, map[string]string{"x-region": "emea"}, decoded)
+	})
+
+	t.Run("Should fail if a descriptor set is missing", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		_ = afero.WriteFile(fs, "config/decoders.yaml", []byte(`orders:
+  descriptor-set: config/order.binpb
+  message: shop.v1.Order`), 0644)
+
+		_, err := Load(fs, "config/decoders.yaml")
+
+		assert.ErrorContains(t, err, "unable to read descriptor set of topic orders")
+	})
+
+	t.Run("Should fail if a decoder is invalid", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		_ = afero.WriteFile(fs, "config/order.binpb", set, 0644)
+		_ = afero.WriteFile(fs, "config/decoders.yaml", []byte(`orders:
+  descriptor-set: config/order.binpb
+  message: shop.v1.Invoice`), 0644)
+
+		_, err := Load(fs, "config/decoders.yaml")
+
+		assert.EqualError(t, err, "decoder of topic orders is invalid: message shop.v1.Invoice is not part of the descriptor set")
+	})
+
+	t.Run("Should fail if the file is no map of topics", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		_ = afero.WriteFile(fs, "config/decoders.yaml", []byte(`- orders`), 0644)
+
+		_, err := Load(fs, "config/decoders.yaml")
+
+		assert.ErrorContains(t, err, "are not a map of topics to decoder definitions")
+	})
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+// Package kube records Kubernetes events via the API server, using the service account of the connector's pod.
+package kube
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// component is reported as source of the recorded events
+	component      = "rabbitmq-connector"
+	requestTimeout = 5 * time.Second
+)
+
+// ObjectReference identifies the object the events are recorded on
+type ObjectReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	UID        string `json:"uid,omitempty"`
+}
+
+// resources maps the supported kinds to their api version and resource
+var resources = map[string]struct{ apiVersion, resource string }{
+	"pod":         {"v1", "pods"},
+	"deployment":  {"apps/v1", "deployments"},
+	"statefulset": {"apps/v1", "statefulsets"},
+	"daemonset":   {"apps/v1", "daemonsets"},
+}
+
+// EventRecorder creates events on an object via the API server
+type EventRecorder struct {
+	client    *fasthttp.Client
+	server    string
+	tokenFile string
+
+	lock   sync.Mutex
+	object ObjectReference
+}
+
+// NewInClusterRecorder creates a recorder using the service account of the pod. The object is provided as kind/name
+// within the namespace of the pod, if empty the events are recorded on the pod itself.
+func NewInClusterRecorder(object string) (*EventRecorder, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if len(host) == 0 || len(port) == 0 {
+		return nil, fmt.Errorf("kubernetes events require running within a cluster, KUBERNETES_SERVICE_HOST or KUBERNETES_SERVICE_PORT is not set")
+	}
+
+	namespace, err := os.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read namespace of the service account due to %s", err)
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ca of the service account due to %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("failed to parse ca of the service account")
+	}
+
+	client := &fasthttp.Client{
+		Name:         component,
+		ReadTimeout:  requestTimeout,
+		WriteTimeout: requestTimeout,
+		TLSConfig:    &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+	}
+	server := "https://" + net.JoinHostPort(host, port)
+
+	return NewEventRecorder(client, server, serviceAccountDir+"/token", strings.TrimSpace(string(namespace)), object)
+}
+
+// NewEventRecorder creates a recorder for the API server, authenticating with the token read from tokenFile on every
+// request, so that rotated tokens are picked up. An empty tokenFile disables authentication.
+func NewEventRecorder(client *fasthttp.Client, server string, tokenFile string, namespace string, object string) (*EventRecorder, error) {
+	if len(object) == 0 {
+		pod := os.Getenv("POD_NAME")
+		if len(pod) == 0 {
+			pod, _ = os.Hostname()
+		}
+		object = "Pod/" + pod
+	}
+
+	kind, name, found := strings.Cut(object, "/")
+	resource, known := resources[strings.ToLower(kind)]
+	if !found || len(name) == 0 || !known {
+		return nil, fmt.Errorf("provided event object %s is not one of Pod, Deployment, StatefulSet or DaemonSet followed by /name", object)
+	}
+
+	return &EventRecorder{
+		client:    client,
+		server:    strings.TrimSuffix(server, "/"),
+		tokenFile: tokenFile,
+		object:    ObjectReference{APIVersion: resource.apiVersion, Kind: kind, Namespace: namespace, Name: name},
+	}, nil
+}
+
+// Record creates a normal event with the provided reason and message on the object
+func (r *EventRecorder) Record(reason string, message string) error {
+	object, err := r.resolve()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	body, err := json.Marshal(map[string]interface{}{
+		"metadata":           map[string]string{"generateName": object.Name + ".", "namespace": object.Namespace},
+		"involvedObject":     object,
+		"reason":             reason,
+		"message":            message,
+		"type":               "Normal",
+		"source":             map[string]string{"component": component},
+		"reportingComponent": component,
+		"firstTimestamp":     now,
+		"lastTimestamp":      now,
+		"count":              1,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.do(fasthttp.MethodPost, fmt.Sprintf("/api/v1/namespaces/%s/events", object.Namespace), body, fasthttp.StatusCreated)
+	return err
+}
+
+// resolve looks up the uid of the object once, which kubectl describe requires to match the events
+func (r *EventRecorder) resolve() (ObjectReference, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.object.UID) > 0 {
+		return r.object, nil
+	}
+
+	prefix := "/apis/" + r.object.APIVersion
+	if r.object.APIVersion == "v1" {
+		prefix = "/api/v1"
+	}
+	resource := resources[strings.ToLower(r.object.Kind)].resource
+	body, err := r.do(fasthttp.MethodGet, fmt.Sprintf("%s/namespaces/%s/%s/%s", prefix, r.object.Namespace, resource, r.object.Name), nil, fasthttp.StatusOK)
+	if err != nil {
+		return ObjectReference{}, err
+	}
+
+	var found struct {
+		Kind     string `json:"kind"`
+		Metadata struct {
+			UID string `json:"uid"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(body, &found); err != nil {
+		return ObjectReference{}, fmt.Errorf("failed to parse %s/%s due to %s", r.object.Kind, r.object.Name, err)
+	}
+	if len(found.Kind) > 0 {
+		r.object.Kind = found.Kind
+	}
+	r.object.UID = found.Metadata.UID
+
+	return r.object, nil
+}
+
+func (r *EventRecorder) do(method string, path string, body []byte, expected int) ([]byte, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.Header.SetMethod(method)
+	req.SetRequestURI(r.server + path)
+	req.Header.SetContentType("application/json")
+	if len(r.tokenFile) > 0 {
+		token, err := os.ReadFile(r.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account token due to %s", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	if body != nil {
+		req.SetBody(body)
+	}
+
+	if err := r.client.Do(req, resp); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != expected {
+		return nil, fmt.Errorf("received unexpected status %d for %s %s: %s", resp.StatusCode(), method, path, resp.Body())
+	}
+
+	return append([]byte(nil), resp.Body()...), nil
+}
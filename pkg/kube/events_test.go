@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package kube
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestNewEventRecorder(t *testing.T) {
+	t.Run("Should default to the pod of the connector", func(t *testing.T) {
+		t.Setenv("POD_NAME", "connector-0")
+
+		target, err := NewEventRecorder(&fasthttp.Client{}, "http://localhost", "", "openfaas", "")
+
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "openfaas", Name: "connector-0"}, target.object)
+	})
+
+	t.Run("Should reject unknown kinds and missing names", func(t *testing.T) {
+		for _, object := range []string{"Service/connector", "Deployment/", "connector"} {
+			_, err := NewEventRecorder(&fasthttp.Client{}, "http://localhost", "", "openfaas", object)
+			assert.Error(t, err, "Should throw for %s", object)
+		}
+	})
+}
+
+func TestEventRecorder_Record(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0600), "should not throw")
+
+	var lookups atomic.Int32
+	events := make(chan map[string]interface{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/apis/apps/v1/namespaces/openfaas/deployments/connector":
+			lookups.Add(1)
+			_, _ = w.Write([]byte(`{"kind":"Deployment","metadata":{"name":"connector","uid":"1234"}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/namespaces/openfaas/events":
+			body, _ := io.ReadAll(r.Body)
+			var event map[string]interface{}
+			_ = json.Unmarshal(body, &event)
+			events <- event
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("Should create events on the resolved object", func(t *testing.T) {
+		target, _ := NewEventRecorder(&fasthttp.Client{}, server.URL, tokenFile, "openfaas", "deployment/connector")
+
+		assert.NoError(t, target.Record(ReasonSubscribed, "Function biller subscribed to topic billing"), "should not throw")
+		assert.NoError(t, target.Record(ReasonUnsubscribed, "Function biller unsubscribed from topic billing"), "should not throw")
+
+		event := <-events
+		assert.Equal(t, ReasonSubscribed, event["reason"])
+		assert.Equal(t, "Function biller subscribed to topic billing", event["message"])
+		assert.Equal(t, "Normal", event["type"])
+		assert.Equal(t, map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "namespace": "openfaas", "name": "connector", "uid": "1234"}, event["involvedObject"])
+		assert.Equal(t, ReasonUnsubscribed, (<-events)["reason"])
+		assert.EqualValues(t, 1, lookups.Load(), "Expected the object to be resolved once")
+	})
+
+	t.Run("Should fail if the object can not be resolved", func(t *testing.T) {
+		target, _ := NewEventRecorder(&fasthttp.Client{}, server.URL, tokenFile, "openfaas", "Pod/missing")
+
+		assert.Error(t, target.Record(ReasonSubscribed, "Function biller subscribed to topic billing"), "should throw")
+		assert.Empty(t, events, "Expected no event")
+	})
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package kube
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/openfaas"
+)
+
+const (
+	// ReasonSubscribed is recorded once a function subscribed to a topic
+	ReasonSubscribed = "TopicSubscribed"
+	// ReasonUnsubscribed is recorded once a function unsubscribed from a topic
+	ReasonUnsubscribed = "TopicUnsubscribed"
+	// ReasonFunctionRemoved is recorded once a function vanished from the topic map, e.g. as it was deleted
+	ReasonFunctionRemoved = "FunctionRemoved"
+
+	// eventBurst of events that are recorded at once, afterwards one event is recorded per eventRefill
+	eventBurst  = 10
+	eventRefill = time.Second
+)
+
+// Recorder creates an event on the object of the connector
+type Recorder interface {
+	Record(reason string, message string) error
+}
+
+// SubscriptionEvents records an event for every subscription change. Events are rate limited, so that large
+// refreshes do not flood the API server, the ones beyond the limit are dropped and only logged.
+type SubscriptionEvents struct {
+	recorder Recorder
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+type subscriptionEvent struct {
+	reason  string
+	message string
+}
+
+// NewSubscriptionEvents creates a new listener, which records the events using the provided recorder
+func NewSubscriptionEvents(recorder Recorder) *SubscriptionEvents {
+	return &SubscriptionEvents{
+		recorder: recorder,
+		tokens:   eventBurst,
+		last:     time.Now(),
+		now:      time.Now,
+	}
+}
+
+// SubscriptionsChanged records the events in the background, so that the refresh is not blocked by the API server
+func (s *SubscriptionEvents) SubscriptionsChanged(subscribed []openfaas.Subscription, unsubscribed []openfaas.Subscription) {
+	events := make([]subscriptionEvent, 0, len(subscribed)+len(unsubscribed))
+	for _, subscription := range subscribed {
+		events = append(events, subscriptionEvent{ReasonSubscribed, fmt.Sprintf("Function %s subscribed to topic %s", subscription.Function, subscription.Topic)})
+	}
+	for _, subscription := range unsubscribed {
+		events = append(events, subscriptionEvent{ReasonUnsubscribed, fmt.Sprintf("Function %s unsubscribed from topic %s", subscription.Function, subscription.Topic)})
+	}
+
+	s.record(events)
+}
+
+// FunctionsRemoved records the events in the background, like SubscriptionsChanged
+func (s *SubscriptionEvents) FunctionsRemoved(removed []string) {
+	events := make([]subscriptionEvent, 0, len(removed))
+	for _, fn := range removed {
+		events = append(events, subscriptionEvent{ReasonFunctionRemoved, fmt.Sprintf("Function %s was removed", fn)})
+	}
+
+	s.record(events)
+}
+
+// record creates the events within the rate limit in the background
+func (s *SubscriptionEvents) record(events []subscriptionEvent) {
+	allowed := s.take(len(events))
+	if dropped := len(events) - allowed; dropped > 0 {
+		log.Printf("Dropped %d of %d subscription event(s) due to the rate limit", dropped, len(events))
+	}
+	if allowed == 0 {
+		return
+	}
+
+	go func(events []subscriptionEvent) {
+		for _, event := range events {
+			if err := s.recorder.Record(event.reason, event.message); err != nil {
+				log.Printf("Failed to record event %s due to %s", event.reason, err)
+			}
+		}
+	}(events[:allowed])
+}
+
+// take returns how many of the requested events may be recorded now
+func (s *SubscriptionEvents) take(requested int) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	s.tokens += float64(now.Sub(s.last)) / float64(eventRefill)
+	if s.tokens > eventBurst {
+		s.tokens = eventBurst
+	}
+	s.last = now
+
+	allowed := int(s.tokens)
+	if requested < allowed {
+		allowed = requested
+	}
+	s.tokens -= float64(allowed)
+	return allowed
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package kube
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/openfaas"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedEvent struct {
+	reason  string
+	message string
+}
+
+type recorderStub struct {
+	lock   sync.Mutex
+	events []recordedEvent
+}
+
+func (r *recorderStub) Record(reason string, message string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.events = append(r.events, recordedEvent{reason, message})
+	return nil
+}
+
+func (r *recorderStub) recorded() []recordedEvent {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]recordedEvent(nil), r.events...)
+}
+
+func TestSubscriptionEvents(t *testing.T) {
+	t.Run("Should record an event for an added and a removed subscription", func(t *testing.T) {
+		recorder := &recorderStub{}
+		target := NewSubscriptionEvents(recorder)
+
+		target.SubscriptionsChanged(
+			[]openfaas.Subscription{{Topic: "billing", Function: "biller.openfaas-fn"}},
+			[]openfaas.Subscription{{Topic: "transport", Function: "wrencher.openfaas-fn"}},
+		)
+
+		assert.Eventually(t, func() bool { return len(recorder.recorded()) == 2 }, time.Second, time.Millisecond)
+		assert.Equal(t, []recordedEvent{
+			{ReasonSubscribed, "Function biller.openfaas-fn subscribed to topic billing"},
+			{ReasonUnsubscribed, "Function wrencher.openfaas-fn unsubscribed from topic transport"},
+		}, recorder.recorded())
+	})
+
+	t.Run("Should record an event for a removed function", func(t *testing.T) {
+		recorder := &recorderStub{}
+		target := NewSubscriptionEvents(recorder)
+
+		target.FunctionsRemoved([]string{"biller.openfaas-fn"})
+
+		assert.Eventually(t, func() bool { return len(recorder.recorded()) == 1 }, time.Second, time.Millisecond)
+		assert.Equal(t, []recordedEvent{{ReasonFunctionRemoved, "Function biller.openfaas-fn was removed"}}, recorder.recorded())
+	})
+
+	t.Run("Should drop events beyond the rate limit", func(t *testing.T) {
+		recorder := &recorderStub{}
+		target := NewSubscriptionEvents(recorder)
+		now := target.last
+		target.now = func() time.Time { return now }
+
+		subscribed := make([]openfaas.Subscription, 0, 2*eventBurst)
+		for i := 0; i < 2*eventBurst; i++ {
+			subscribed = append(subscribed, openfaas.Subscription{Topic: fmt.Sprintf("topic-%d", i), Function: "biller"})
+		}
+		target.SubscriptionsChanged(subscribed, nil)
+		assert.Eventually(t, func() bool { return len(recorder.recorded()) == eventBurst }, time.Second, time.Millisecond)
+
+		target.SubscriptionsChanged(subscribed[:1], nil)
+		now = now.Add(2 * eventRefill)
+		target.SubscriptionsChanged(subscribed, nil)
+
+		assert.Eventually(t, func() bool { return len(recorder.recorded()) == eventBurst+2 }, time.Second, time.Millisecond, "Expected one event per refill")
+	})
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package labels
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Operators of a Requirement
+const (
+	Equals       = "="
+	NotEquals    = "!="
+	In           = "in"
+	NotIn        = "notin"
+	Exists       = "exists"
+	DoesNotExist = "!"
+)
+
+// Requirement restricts the value of a single label
+type Requirement struct {
+	Key      string
+	Operator string
+	Values   []string
+}
+
+// Matches reports whether the labels fulfill the requirement
+func (r Requirement) Matches(labels map[string]string) bool {
+	value, exists := labels[r.Key]
+
+	switch r.Operator {
+	case Equals, In:
+		return exists && r.has(value)
+	case NotEquals, NotIn:
+		return !exists || !r.has(value)
+	case Exists:
+		return exists
+	case DoesNotExist:
+		return !exists
+	default:
+		return false
+	}
+}
+
+func (r Requirement) has(value string) bool {
+	for _, candidate := range r.Values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Requirement) String() string {
+	switch r.Operator {
+	case Exists:
+		return r.Key
+	case DoesNotExist:
+		return DoesNotExist + r.Key
+	case In, NotIn:
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(r.Values, ","))
+	default:
+		return r.Key + r.Operator + r.Values[0]
+	}
+}
+
+// Selector is a Kubernetes style label selector, e.g. team=billing,tier!=canary,env in (prod,staging),!legacy.
+// Labels match if they fulfill all requirements, hence an empty or nil Selector matches everything.
+type Selector []Requirement
+
+// Matches reports whether the labels fulfill all requirements of the selector
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, requirement := range s {
+		if !requirement.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty reports whether the selector matches everything
+func (s Selector) Empty() bool {
+	return len(s) == 0
+}
+
+func (s Selector) String() string {
+	requirements := make([]string, 0, len(s))
+	for _, requirement := range s {
+		requirements = append(requirements, requirement.String())
+	}
+	return strings.Join(requirements, ",")
+}
+
+// Parse reads a comma separated list of requirements, which are either key=value, key==value, key!=value,
+// key in (values), key notin (values), key or !key. An empty expression yields an empty selector.
+func Parse(expr string) (Selector, error) {
+	var selector Selector
+
+	for _, part := range splitRequirements(expr) {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			return nil, fmt.Errorf("selector contains an empty requirement")
+		}
+
+		requirement, err := parseRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+		selector = append(selector, requirement)
+	}
+
+	return selector, nil
+}
+
+// splitRequirements splits the expression on commas outside of value sets
+func splitRequirements(expr string) []string {
+	if len(strings.TrimSpace(expr)) == 0 {
+		return nil
+	}
+
+	var parts []string
+	depth, start := 0, 0
+	for i, char := range expr {
+		switch char {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+func parseRequirement(part string) (Requirement, error) {
+	if strings.HasPrefix(part, DoesNotExist) && !strings.ContainsAny(part, "=") {
+		return newRequirement(strings.TrimSpace(part[1:]), DoesNotExist, nil)
+	}
+
+	if idx := strings.Index(part, "!="); idx >= 0 {
+		return newRequirement(part[:idx], NotEquals, []string{part[idx+2:]})
+	}
+	if idx := strings.Index(part, "=="); idx >= 0 {
+		return newRequirement(part[:idx], Equals, []string{part[idx+2:]})
+	}
+	if idx := strings.Index(part, "="); idx >= 0 {
+		return newRequirement(part[:idx], Equals, []string{part[idx+1:]})
+	}
+
+	if open := strings.Index(part, "("); open >= 0 {
+		fields := strings.Fields(part[:open])
+		if len(fields) != 2 || (fields[1] != In && fields[1] != NotIn) {
+			return Requirement{}, fmt.Errorf("requirement %s is not of the form key in (values) or key notin (values)", part)
+		}
+		if !strings.HasSuffix(part, ")") {
+			return Requirement{}, fmt.Errorf("values of requirement %s are not closed", part)
+		}
+
+		values := strings.Split(part[open+1:len(part)-1], ",")
+		return newRequirement(fields[0], fields[1], values)
+	}
+
+	return newRequirement(part, Exists, nil)
+}
+
+func newRequirement(key string, operator string, values []string) (Requirement, error) {
+	key = strings.TrimSpace(key)
+	if err := validateLabel(key, false); err != nil {
+		return Requirement{}, fmt.Errorf("key %q %w", key, err)
+	}
+
+	for i, value := range values {
+		values[i] = strings.TrimSpace(value)
+		if err := validateLabel(values[i], true); err != nil {
+			return Requirement{}, fmt.Errorf("value %q of key %s %w", values[i], key, err)
+		}
+	}
+	if (operator == In || operator == NotIn) && len(values) == 1 && len(values[0]) == 0 {
+		return Requirement{}, fmt.Errorf("key %s requires at least one value", key)
+	}
+
+	return Requirement{Key: key, Operator: operator, Values: values}, nil
+}
+
+// validateLabel rejects keys and values with characters Kubernetes does not allow within labels. Keys may
+// additionally be prefixed, e.g. com.openfaas/team.
+func validateLabel(label string, allowEmpty bool) error {
+	if len(label) == 0 {
+		if allowEmpty {
+			return nil
+		}
+		return fmt.Errorf("must not be empty")
+	}
+
+	for _, char := range label {
+		isAlphaNumeric := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+		if !isAlphaNumeric && !strings.ContainsRune("-_./", char) {
+			return fmt.Errorf("contains the invalid character %q", char)
+		}
+	}
+	return nil
+}
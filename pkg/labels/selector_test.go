@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package labels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("Should parse all kinds of requirements", func(t *testing.T) {
+		selector, err := Parse("team=billing, tier!=canary,env in (prod, staging),region notin (eu),com.openfaas/scale,!legacy,owner==ops")
+
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, Selector{
+			{Key: "team", Operator: Equals, Values: []string{"billing"}},
+			{Key: "tier", Operator: NotEquals, Values: []string{"canary"}},
+			{Key: "env", Operator: In, Values: []string{"prod", "staging"}},
+			{Key: "region", Operator: NotIn, Values: []string{"eu"}},
+			{Key: "com.openfaas/scale", Operator: Exists},
+			{Key: "legacy", Operator: DoesNotExist},
+			{Key: "owner", Operator: Equals, Values: []string{"ops"}},
+		}, selector)
+	})
+
+	t.Run("Should yield an empty selector for an empty expression", func(t *testing.T) {
+		selector, err := Parse(" ")
+
+		assert.NoError(t, err, "should not throw")
+		assert.True(t, selector.Empty())
+	})
+
+	t.Run("Should reject invalid expressions", func(t *testing.T) {
+		for _, expr := range []string{"team=billing,", "=billing", "team in billing", "team in (billing", "team in ()", "team=bill ing", "team within (billing)"} {
+			_, err := Parse(expr)
+			assert.Error(t, err, "should throw for %s", expr)
+		}
+	})
+}
+
+func TestSelector_Matches(t *testing.T) {
+	labels := map[string]string{"team": "billing", "env": "prod"}
+	matches := func(expr string) bool {
+		selector, err := Parse(expr)
+		assert.NoError(t, err, "should not throw")
+		return selector.Matches(labels)
+	}
+
+	t.Run("Should match if all requirements are fulfilled", func(t *testing.T) {
+		assert.True(t, matches("team=billing,env in (prod,staging)"))
+		assert.True(t, matches("team,!legacy"))
+		assert.True(t, matches("tier!=canary,region notin (eu)"), "Expected absent labels to fulfill exclusions")
+		assert.True(t, matches(""), "Expected an empty selector to match everything")
+	})
+
+	t.Run("Should not match if a requirement is not fulfilled", func(t *testing.T) {
+		assert.False(t, matches("team=billing,env=staging"))
+		assert.False(t, matches("env notin (prod)"))
+		assert.False(t, matches("!team"))
+		assert.False(t, matches("tier in (canary)"), "Expected absent labels to not fulfill inclusions")
+	})
+
+	t.Run("Should match everything without selector", func(t *testing.T) {
+		var selector Selector
+		assert.True(t, selector.Matches(nil))
+	})
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+// Package logging adds a debug level on top of the standard logger, which is used for messages that
+// would otherwise be logged on every refresh or invocation.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// LevelInfo logs everything except debug messages, which is the default
+	LevelInfo = "info"
+	// LevelDebug additionally logs debug messages
+	LevelDebug = "debug"
+)
+
+var debug atomic.Bool
+
+// ParseLevel validates the provided level, ignoring its case
+func ParseLevel(level string) (string, error) {
+	switch normalized := strings.ToLower(strings.TrimSpace(level)); normalized {
+	case LevelInfo, LevelDebug:
+		return normalized, nil
+	default:
+		return "", fmt.Errorf("log level %s is not one of %s or %s", level, LevelInfo, LevelDebug)
+	}
+}
+
+// SetLevel enables debug messages for LevelDebug and disables them for every other level
+func SetLevel(level string) {
+	debug.Store(level == LevelDebug)
+}
+
+// DebugEnabled reports whether debug messages are logged
+func DebugEnabled() bool {
+	return debug.Load()
+}
+
+// Debugf logs the message using the standard logger, if debug messages are enabled
+func Debugf(format string, v ...interface{}) {
+	if debug.Load() {
+		_ = log.Output(2, "DEBUG: "+fmt.Sprintf(format, v...))
+	}
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package logging
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLevel(t *testing.T) {
+	t.Run("Should accept the known levels regardless of their case", func(t *testing.T) {
+		level, err := ParseLevel(" DEBUG ")
+		assert.NoError(t, err, "Should not throw")
+		assert.Equal(t, LevelDebug, level)
+
+		level, err = ParseLevel("Info")
+		assert.NoError(t, err, "Should not throw")
+		assert.Equal(t, LevelInfo, level)
+	})
+
+	t.Run("Should reject unknown levels", func(t *testing.T) {
+		_, err := ParseLevel("verbose")
+		assert.Error(t, err, "Should throw")
+	})
+}
+
+func TestDebugf(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+	defer SetLevel(LevelInfo)
+
+	t.Run("Should not log debug messages by default", func(t *testing.T) {
+		Debugf("Crawling %s", "namespaces")
+
+		assert.False(t, DebugEnabled())
+		assert.Empty(t, out.String())
+	})
+
+	t.Run("Should log debug messages once enabled", func(t *testing.T) {
+		SetLevel(LevelDebug)
+		Debugf("Crawling %s", "namespaces")
+
+		assert.True(t, DebugEnabled())
+		assert.Contains(t, out.String(), "DEBUG: Crawling namespaces")
+	})
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DroppedPoisonMessages counts deliveries that were dropped after exceeding the maximum delivery attempts
+var DroppedPoisonMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "connector_dropped_poison_total",
+	Help: "Number of deliveries dropped after exceeding the maximum delivery attempts",
+}, []string{"topic"})
+
+// QuarantinedMessages counts deliveries that were published onto the quarantine exchange after a non-retryable error
+var QuarantinedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "connector_quarantined_total",
+	Help: "Number of deliveries published onto the quarantine exchange after a non-retryable error",
+}, []string{"topic"})
+
+// RejectedMessages counts deliveries that were rejected without requeue after a non-retryable error, as no quarantine
+// exchange is configured
+var RejectedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "connector_rejected_total",
+	Help: "Number of deliveries rejected without requeue after a non-retryable error, as no quarantine exchange is configured",
+}, []string{"topic"})
+
+// DeadLetteredMessages counts deliveries that were published onto the dead-letter exchange after exceeding the
+// maximum delivery attempts
+var DeadLetteredMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "connector_dead_lettered_total",
+	Help: "Number of deliveries published onto the dead-letter exchange after exceeding the maximum delivery attempts",
+}, []string{"topic"})
+
+// FunctionTopicInfo exposes the effective topic map, with a series of value 1 for every function subscribed to a topic.
+// Static mappings are distinguished by their source.
+var FunctionTopicInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "connector_function_topic_info",
+	Help: "Functions subscribed to a topic, the value is always 1. The source is crawled or static",
+}, []string{"function", "namespace", "topic", "source"})
+
+// RefreshOverruns counts refreshes of the topic map that took longer than the refresh interval
+var RefreshOverruns = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "connector_refresh_overrun_total",
+	Help: "Number of topic map refreshes that took longer than the refresh interval",
+})
+
+// RejectedTopics counts topics that were dropped during a refresh, as the maximum number of topics was reached
+var RejectedTopics = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "connector_topics_rejected_total",
+	Help: "Number of topics dropped during topic map refreshes, as the maximum number of topics was reached",
+})
+
+// AsyncQueueDepth exposes the last scraped depth of the OpenFaaS async queue, if back-pressure is enabled
+var AsyncQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "connector_async_queue_depth",
+	Help: "Last scraped depth of the OpenFaaS async queue, which is used to apply back-pressure",
+})
+
+// FunctionsCrawled counts the functions returned by the gateway per namespace, including all pages of paginated responses
+var FunctionsCrawled = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "connector_functions_crawled_total",
+	Help: "Number of functions crawled from the gateway, counted once per crawl of a namespace",
+}, []string{"namespace"})
+
+// CrawlErrors counts the failed crawls per namespace, kind is one of timeout, connection, 4xx, 5xx or other
+var CrawlErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "connector_crawl_errors_total",
+	Help: "Number of failed crawls of a namespace by kind of error",
+}, []string{"namespace", "kind"})
+
+// ConsumerReconfigures counts the reconfigurations of exchanges, which re-establish their channel with new bindings
+var ConsumerReconfigures = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "connector_consumer_reconfigure_total",
+	Help: "Number of exchange reconfigurations, which re-established the consumer channel with new bindings",
+})
+
+// Invocations counts the invocations of every function per topic, status is success or failure
+var Invocations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "connector_invocations_total",
+	Help: "Number of function invocations per topic, the status is success or failure",
+}, []string{"topic", "function", "namespace", "status"})
+
+// InvocationDuration observes the latency of the invocations of every function
+var InvocationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "connector_invocation_duration_seconds",
+	Help:    "Latency of the function invocations in seconds",
+	Buckets: prometheus.DefBuckets,
+}, []string{"function", "namespace"})
+
+// GatewayThrottled counts the requests the gateway rate limited with 429, operation is either crawl or invoke
+var GatewayThrottled = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "connector_gateway_throttled_total",
+	Help: "Number of requests rate limited by the gateway, the operation is crawl or invoke",
+}, []string{"operation"})
+
+// CacheAge exposes the seconds since the topic map was last refreshed successfully
+var CacheAge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "connector_cache_age_seconds",
+	Help: "Seconds since the topic map was last refreshed successfully",
+})
+
+// TopicReadySubscribers exposes the subscribers of every topic with a ready replica, 0 means nobody handles the topic
+var TopicReadySubscribers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "connector_topic_ready_subscribers",
+	Help: "Number of subscribers of a topic that are ready to handle its messages",
+}, []string{"topic"})
+
+// AMQPConnections exposes whether the connection to the vhost is established, the value is either 0 or 1
+var AMQPConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "connector_amqp_connections",
+	Help: "Number of established connections to RabbitMQ per vhost",
+}, []string{"vhost"})
+
+// AMQPChannels exposes the channels opened on the connection to the vhost, which were not closed yet
+var AMQPChannels = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "connector_amqp_channels",
+	Help: "Number of open channels on the connection to RabbitMQ per vhost",
+}, []string{"vhost"})
+
+// AMQPReconnects counts the attempts to recover a lost connection to the vhost
+var AMQPReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "connector_amqp_reconnects_total",
+	Help: "Number of reconnects after the connection to RabbitMQ was lost per vhost",
+}, []string{"vhost"})
+
+// ConcurrencyLimit exposes the concurrent invocations the adaptive concurrency currently allows every function
+var ConcurrencyLimit = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "connector_function_concurrency_limit",
+	Help: "Number of concurrent invocations the adaptive concurrency currently allows a function",
+}, []string{"function", "namespace"})
@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package metrics
+
+import "time"
+
+// Sink records the instrumentation of the connector. Prometheus is used by default, other backends like StatsD
+// are plugged in by implementing this interface, while NoOp disables the instrumentation.
+type Sink interface {
+	// IncInvocations counts an invocation of a function on the topic, status is success or failure
+	IncInvocations(topic string, function string, namespace string, status string)
+	// ObserveLatency records the latency of an invocation of a function
+	ObserveLatency(function string, namespace string, latency time.Duration)
+	// SetTopicGauge marks the function as subscribed to the topic, once unsubscribed the series is removed.
+	// The source is either crawled or static.
+	SetTopicGauge(function string, namespace string, topic string, source string, subscribed bool)
+	// IncRefreshOverruns counts a refresh of the topic map that took longer than the refresh interval
+	IncRefreshOverruns()
+	// IncRejectedTopics counts a topic that was dropped, as the maximum number of topics was reached
+	IncRejectedTopics()
+	// AddFunctionsCrawled counts the functions returned by the gateway for the namespace
+	AddFunctionsCrawled(namespace string, count int)
+	// IncCrawlErrors counts a failed crawl of the namespace, kind is one of timeout, connection, 4xx, 5xx or other
+	IncCrawlErrors(namespace string, kind string)
+	// SetAsyncQueueDepth records the last scraped depth of the async queue
+	SetAsyncQueueDepth(depth float64)
+	// IncConsumerReconfigures counts a reconfiguration of an exchange
+	IncConsumerReconfigures()
+	// IncDroppedPoison counts a delivery of the topic that was dropped after exceeding the maximum delivery attempts
+	IncDroppedPoison(topic string)
+	// IncQuarantined counts a delivery of the topic that was quarantined after a non-retryable error
+	IncQuarantined(topic string)
+	// IncRejected counts a delivery of the topic that was rejected without requeue after a non-retryable error
+	IncRejected(topic string)
+	// IncDeadLettered counts a delivery of the topic that was dead-lettered after exceeding the maximum delivery attempts
+	IncDeadLettered(topic string)
+	// IncGatewayThrottled counts a request the gateway rate limited, operation is either crawl or invoke
+	IncGatewayThrottled(operation string)
+	// SetCacheAge records the time since the topic map was last refreshed successfully
+	SetCacheAge(age time.Duration)
+	// SetTopicReadySubscribers records the ready subscribers of the topic, once the topic is gone the series is removed
+	SetTopicReadySubscribers(topic string, ready int, subscribed bool)
+	// SetAMQPConnection records whether the connection to the vhost is established and the channels open on it
+	SetAMQPConnection(vhost string, connected bool, channels int)
+	// IncAMQPReconnects counts a reconnect after the connection to the vhost was lost
+	IncAMQPReconnects(vhost string)
+	// SetConcurrencyLimit records the concurrent invocations the adaptive concurrency currently allows the function
+	SetConcurrencyLimit(function string, namespace string, limit int)
+}
+
+// Prometheus records the instrumentation using the collectors of this package, which are served under /metrics
+type Prometheus struct{}
+
+// IncInvocations see Sink.IncInvocations
+func (Prometheus) IncInvocations(topic string, function string, namespace string, status string) {
+	Invocations.WithLabelValues(topic, function, namespace, status).Inc()
+}
+
+// ObserveLatency see Sink.ObserveLatency
+func (Prometheus) ObserveLatency(function string, namespace string, latency time.Duration) {
+	InvocationDuration.WithLabelValues(function, namespace).Observe(latency.Seconds())
+}
+
+// SetTopicGauge see Sink.SetTopicGauge
+func (Prometheus) SetTopicGauge(function string, namespace string, topic string, source string, subscribed bool) {
+	if subscribed {
+		FunctionTopicInfo.WithLabelValues(function, namespace, topic, source).Set(1)
+		return
+	}
+	FunctionTopicInfo.DeleteLabelValues(function, namespace, topic, source)
+}
+
+// IncRefreshOverruns see Sink.IncRefreshOverruns
+func (Prometheus) IncRefreshOverruns() {
+	RefreshOverruns.Inc()
+}
+
+// IncRejectedTopics see Sink.IncRejectedTopics
+func (Prometheus) IncRejectedTopics() {
+	RejectedTopics.Inc()
+}
+
+// AddFunctionsCrawled see Sink.AddFunctionsCrawled
+func (Prometheus) AddFunctionsCrawled(namespace string, count int) {
+	FunctionsCrawled.WithLabelValues(namespace).Add(float64(count))
+}
+
+// IncCrawlErrors see Sink.IncCrawlErrors
+func (Prometheus) IncCrawlErrors(namespace string, kind string) {
+	CrawlErrors.WithLabelValues(namespace, kind).Inc()
+}
+
+// SetAsyncQueueDepth see Sink.SetAsyncQueueDepth
+func (Prometheus) SetAsyncQueueDepth(depth float64) {
+	AsyncQueueDepth.Set(depth)
+}
+
+// IncConsumerReconfigures see Sink.IncConsumerReconfigures
+func (Prometheus) IncConsumerReconfigures() {
+	ConsumerReconfigures.Inc()
+}
+
+// IncDroppedPoison see Sink.IncDroppedPoison
+func (Prometheus) IncDroppedPoison(topic string) {
+	DroppedPoisonMessages.WithLabelValues(topic).Inc()
+}
+
+// IncQuarantined see Sink.IncQuarantined
+func (Prometheus) IncQuarantined(topic string) {
+	QuarantinedMessages.WithLabelValues(topic).Inc()
+}
+
+// IncRejected see Sink.IncRejected
+func (Prometheus) IncRejected(topic string) {
+	RejectedMessages.WithLabelValues(topic).Inc()
+}
+
+// IncDeadLettered see Sink.IncDeadLettered
+func (Prometheus) IncDeadLettered(topic string) {
+	DeadLetteredMessages.WithLabelValues(topic).Inc()
+}
+
+// IncGatewayThrottled see Sink.IncGatewayThrottled
+func (Prometheus) IncGatewayThrottled(operation string) {
+	GatewayThrottled.WithLabelValues(operation).Inc()
+}
+
+// SetCacheAge see Sink.SetCacheAge
+func (Prometheus) SetCacheAge(age time.Duration) {
+	CacheAge.Set(age.Seconds())
+}
+
+// SetTopicReadySubscribers see Sink.SetTopicReadySubscribers
+func (Prometheus) SetTopicReadySubscribers(topic string, ready int, subscribed bool) {
+	if subscribed {
+		TopicReadySubscribers.WithLabelValues(topic).Set(float64(ready))
+		return
+	}
+	TopicReadySubscribers.DeleteLabelValues(topic)
+}
+
+// SetAMQPConnection see Sink.SetAMQPConnection
+func (Prometheus) SetAMQPConnection(vhost string, connected bool, channels int) {
+	value := 0.0
+	if connected {
+		value = 1
+	}
+	AMQPConnections.WithLabelValues(vhost).Set(value)
+	AMQPChannels.WithLabelValues(vhost).Set(float64(channels))
+}
+
+// IncAMQPReconnects see Sink.IncAMQPReconnects
+func (Prometheus) IncAMQPReconnects(vhost string) {
+	AMQPReconnects.WithLabelValues(vhost).Inc()
+}
+
+// SetConcurrencyLimit see Sink.SetConcurrencyLimit
+func (Prometheus) SetConcurrencyLimit(function string, namespace string, limit int) {
+	ConcurrencyLimit.WithLabelValues(function, namespace).Set(float64(limit))
+}
+
+// NoOp discards the instrumentation
+type NoOp struct{}
+
+// IncInvocations see Sink.IncInvocations
+func (NoOp) IncInvocations(string, string, string, string) {}
+
+// ObserveLatency see Sink.ObserveLatency
+func (NoOp) ObserveLatency(string, string, time.Duration) {}
+
+// SetTopicGauge see Sink.SetTopicGauge
+func (NoOp) SetTopicGauge(string, string, string, string, bool) {}
+
+// IncRefreshOverruns see Sink.IncRefreshOverruns
+func (NoOp) IncRefreshOverruns() {}
+
+// IncRejectedTopics see Sink.IncRejectedTopics
+func (NoOp) IncRejectedTopics() {}
+
+// AddFunctionsCrawled see Sink.AddFunctionsCrawled
+func (NoOp) AddFunctionsCrawled(string, int) {}
+
+// IncCrawlErrors see Sink.IncCrawlErrors
+func (NoOp) IncCrawlErrors(string, string) {}
+
+// SetAsyncQueueDepth see Sink.SetAsyncQueueDepth
+func (NoOp) SetAsyncQueueDepth(float64) {}
+
+// IncConsumerReconfigures see Sink.IncConsumerReconfigures
+func (NoOp) IncConsumerReconfigures() {}
+
+// IncDroppedPoison see Sink.IncDroppedPoison
+func (NoOp) IncDroppedPoison(string) {}
+
+// IncQuarantined see Sink.IncQuarantined
+func (NoOp) IncQuarantined(string) {}
+
+// IncRejected see Sink.IncRejected
+func (NoOp) IncRejected(string) {}
+
+// IncDeadLettered see Sink.IncDeadLettered
+func (NoOp) IncDeadLettered(string) {}
+
+// IncGatewayThrottled see Sink.IncGatewayThrottled
+func (NoOp) IncGatewayThrottled(string) {}
+
+// SetCacheAge see Sink.SetCacheAge
+func (NoOp) SetCacheAge(time.Duration) {}
+
+// SetTopicReadySubscribers see Sink.SetTopicReadySubscribers
+func (NoOp) SetTopicReadySubscribers(string, int, bool) {}
+
+// SetAMQPConnection see Sink.SetAMQPConnection
+func (NoOp) SetAMQPConnection(string, bool, int) {}
+
+// IncAMQPReconnects see Sink.IncAMQPReconnects
+func (NoOp) IncAMQPReconnects(string) {}
+
+// SetConcurrencyLimit see Sink.SetConcurrencyLimit
+func (NoOp) SetConcurrencyLimit(string, string, int) {}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheus(t *testing.T) {
+	var sink Sink = Prometheus{}
+
+	t.Run("Should count the invocations and observe their latency", func(t *testing.T) {
+		before := testutil.ToFloat64(Invocations.WithLabelValues("billing", "biller", "faas", "success"))
+
+		sink.IncInvocations("billing", "biller", "faas", "success")
+		sink.ObserveLatency("biller", "faas", 250*time.Millisecond)
+
+		assert.Equal(t, before+1, testutil.ToFloat64(Invocations.WithLabelValues("billing", "biller", "faas", "success")))
+		assert.Equal(t, 1, testutil.CollectAndCount(InvocationDuration, "connector_invocation_duration_seconds"))
+	})
+
+	t.Run("Should add and remove the series of the topic map", func(t *testing.T) {
+		sink.SetTopicGauge("biller", "faas", "billing", "crawled", true)
+		assert.Equal(t, 1.0, testutil.ToFloat64(FunctionTopicInfo.WithLabelValues("biller", "faas", "billing", "crawled")))
+
+		sink.SetTopicGauge("biller", "faas", "billing", "crawled", false)
+		assert.Equal(t, 0, testutil.CollectAndCount(FunctionTopicInfo))
+
+		sink.SetTopicReadySubscribers("billing", 2, true)
+		assert.Equal(t, 2.0, testutil.ToFloat64(TopicReadySubscribers.WithLabelValues("billing")))
+
+		sink.SetTopicReadySubscribers("billing", 0, false)
+		assert.Equal(t, 0, testutil.CollectAndCount(TopicReadySubscribers))
+	})
+
+	t.Run("Should record the refresh and consumer metrics", func(t *testing.T) {
+		crawled := testutil.ToFloat64(FunctionsCrawled.WithLabelValues("faas"))
+		crawlErrors := testutil.ToFloat64(CrawlErrors.WithLabelValues("faas", "timeout"))
+		poison := testutil.ToFloat64(DroppedPoisonMessages.WithLabelValues("billing"))
+		quarantined := testutil.ToFloat64(QuarantinedMessages.WithLabelValues("billing"))
+		rejected := testutil.ToFloat64(RejectedMessages.WithLabelValues("billing"))
+		deadLettered := testutil.ToFloat64(DeadLetteredMessages.WithLabelValues("billing"))
+		throttled := testutil.ToFloat64(GatewayThrottled.WithLabelValues("crawl"))
+
+		sink.AddFunctionsCrawled("faas", 3)
+		sink.IncCrawlErrors("faas", "timeout")
+		sink.IncDroppedPoison("billing")
+		sink.IncQuarantined("billing")
+		sink.IncRejected("billing")
+		sink.IncDeadLettered("billing")
+		sink.IncGatewayThrottled("crawl")
+		sink.SetAsyncQueueDepth(42)
+		sink.SetCacheAge(90 * time.Second)
+
+		assert.Equal(t, crawled+3, testutil.ToFloat64(FunctionsCrawled.WithLabelValues("faas")))
+		assert.Equal(t, crawlErrors+1, testutil.ToFloat64(CrawlErrors.WithLabelValues("faas", "timeout")))
+		assert.Equal(t, poison+1, testutil.ToFloat64(DroppedPoisonMessages.WithLabelValues("billing")))
+		assert.Equal(t, quarantined+1, testutil.ToFloat64(QuarantinedMessages.WithLabelValues("billing")))
+		assert.Equal(t, rejected+1, testutil.ToFloat64(RejectedMessages.WithLabelValues("billing")))
+		assert.Equal(t, deadLettered+1, testutil.ToFloat64(DeadLetteredMessages.WithLabelValues("billing")))
+		assert.Equal(t, throttled+1, testutil.ToFloat64(GatewayThrottled.WithLabelValues("crawl")))
+		assert.Equal(t, 42.0, testutil.ToFloat64(AsyncQueueDepth))
+		assert.Equal(t, 90.0, testutil.ToFloat64(CacheAge))
+	})
+
+	t.Run("Should record the state of the amqp connection", func(t *testing.T) {
+		reconnects := testutil.ToFloat64(AMQPReconnects.WithLabelValues("billing"))
+
+		sink.SetAMQPConnection("billing", true, 3)
+		sink.IncAMQPReconnects("billing")
+
+		assert.Equal(t, 1.0, testutil.ToFloat64(AMQPConnections.WithLabelValues("billing")))
+		assert.Equal(t, 3.0, testutil.ToFloat64(AMQPChannels.WithLabelValues("billing")))
+		assert.Equal(t, reconnects+1, testutil.ToFloat64(AMQPReconnects.WithLabelValues("billing")))
+
+		sink.SetAMQPConnection("billing", false, 0)
+		assert.Equal(t, 0.0, testutil.ToFloat64(AMQPConnections.WithLabelValues("billing")))
+		assert.Equal(t, 0.0, testutil.ToFloat64(AMQPChannels.WithLabelValues("billing")))
+	})
+
+	t.Run("Should record the concurrency limit of a function", func(t *testing.T) {
+		sink.SetConcurrencyLimit("biller", "faas", 12)
+
+		assert.Equal(t, 12.0, testutil.ToFloat64(ConcurrencyLimit.WithLabelValues("biller", "faas")))
+	})
+}
+
+func TestNoOp(t *testing.T) {
+	t.Run("Should not record anything", func(t *testing.T) {
+		var sink Sink = NoOp{}
+		before := testutil.ToFloat64(RefreshOverruns)
+
+		sink.IncRefreshOverruns()
+
+		assert.Equal(t, before, testutil.ToFloat64(RefreshOverruns))
+	})
+}
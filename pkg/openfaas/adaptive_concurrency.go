@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+	wrap "github.com/pkg/errors"
+)
+
+const (
+	// latencyTolerance is the factor of the baseline latency above which an invocation counts as congested
+	latencyTolerance = 2
+	// decreaseFactor is applied to the limit of a function once its invocations are congested
+	decreaseFactor = 0.5
+	// baselineDrift is the fraction by which the baseline follows a healthy latency above it, which allows it to
+	// adapt to functions that became slower for good
+	baselineDrift = 0.01
+)
+
+// adaptiveConcurrency bounds the concurrent invocations of every function by a limit, which adapts to the observed
+// latency using additive-increase/multiplicative-decrease. Each healthy invocation increases the limit by 1/limit,
+// hence by one once the limit of invocations completed. An invocation that failed, apart from being rejected with a
+// 4xx, or took longer than twice the baseline latency halves the limit. Invocations that were in flight before the
+// limit was halved do not halve it again, as they were congested by the same burst. The limit starts at min. A nil
+// adaptiveConcurrency does not limit at all.
+type adaptiveConcurrency struct {
+	min     int
+	max     int
+	metrics metrics.Sink
+
+	lock      sync.Mutex
+	functions map[string]*adaptiveLimit
+}
+
+type adaptiveLimit struct {
+	limit    float64
+	inFlight int
+	waiting  []*adaptiveWaiter
+	// baseline is the latency of an uncongested invocation, the lowest latency observed
+	baseline time.Duration
+	// epoch is increased whenever the limit is decreased
+	epoch uint64
+}
+
+type adaptiveWaiter struct {
+	ready chan struct{}
+	epoch uint64
+}
+
+func newAdaptiveConcurrency(min int, max int, sink metrics.Sink) *adaptiveConcurrency {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+
+	return &adaptiveConcurrency{min: min, max: max, metrics: sink, functions: map[string]*adaptiveLimit{}}
+}
+
+// Acquire waits until the function has less invocations in flight than its limit or the context is done. The
+// returned done has to be called with the latency and error of the invocation, which adapts the limit.
+func (a *adaptiveConcurrency) Acquire(ctx context.Context, fn Function) (func(latency time.Duration, err error), error) {
+	if a == nil {
+		return func(time.Duration, error) {}, nil
+	}
+
+	a.lock.Lock()
+	l := a.function(fn)
+	if l.inFlight < int(l.limit) && len(l.waiting) == 0 {
+		l.inFlight++
+		epoch := l.epoch
+		a.lock.Unlock()
+		return a.done(fn, l, epoch), nil
+	}
+
+	waiter := &adaptiveWaiter{ready: make(chan struct{})}
+	l.waiting = append(l.waiting, waiter)
+	a.lock.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return a.done(fn, l, waiter.epoch), nil
+	case <-ctx.Done():
+		a.lock.Lock()
+		defer a.lock.Unlock()
+
+		if !l.remove(waiter) {
+			// The slot was handed over meanwhile
+			l.inFlight--
+			a.wake(l)
+		}
+		return nil, wrap.Wrapf(ctx.Err(), "function %s has %d invocations in flight", fn, int(l.limit))
+	}
+}
+
+// Limit returns the current limit of the function
+func (a *adaptiveConcurrency) Limit(fn Function) int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return int(a.function(fn).limit)
+}
+
+// function returns the limit of the function, the lock has to be held
+func (a *adaptiveConcurrency) function(fn Function) *adaptiveLimit {
+	l, exists := a.functions[fn.String()]
+	if !exists {
+		l = &adaptiveLimit{limit: float64(a.min)}
+		a.functions[fn.String()] = l
+	}
+	return l
+}
+
+func (a *adaptiveConcurrency) done(fn Function, l *adaptiveLimit, epoch uint64) func(time.Duration, error) {
+	var once sync.Once
+	return func(latency time.Duration, err error) {
+		once.Do(func() {
+			a.lock.Lock()
+			defer a.lock.Unlock()
+
+			l.inFlight--
+			before := int(l.limit)
+			a.adapt(l, epoch, latency, err)
+			if int(l.limit) != before {
+				a.metrics.SetConcurrencyLimit(fn.Name, fn.Namespace, int(l.limit))
+			}
+			a.wake(l)
+		})
+	}
+}
+
+// adapt the limit to the outcome of an invocation acquired in the epoch, the lock has to be held
+func (a *adaptiveConcurrency) adapt(l *adaptiveLimit, epoch uint64, latency time.Duration, err error) {
+	if isCongested(err) || (l.baseline > 0 && latency > latencyTolerance*l.baseline) {
+		if epoch == l.epoch {
+			l.limit *= decreaseFactor
+			if l.limit < float64(a.min) {
+				l.limit = float64(a.min)
+			}
+			l.epoch++
+		}
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	if l.baseline == 0 || latency < l.baseline {
+		l.baseline = latency
+	} else {
+		l.baseline += time.Duration(float64(latency-l.baseline) * baselineDrift)
+	}
+
+	l.limit += 1 / l.limit
+	if l.limit > float64(a.max) {
+		l.limit = float64(a.max)
+	}
+}
+
+// wake hands the free slots of the function to the waiting invocations in order, the lock has to be held
+func (a *adaptiveConcurrency) wake(l *adaptiveLimit) {
+	for len(l.waiting) > 0 && l.inFlight < int(l.limit) {
+		waiter := l.waiting[0]
+		l.waiting = l.waiting[1:]
+
+		l.inFlight++
+		waiter.epoch = l.epoch
+		close(waiter.ready)
+	}
+}
+
+// remove drops the waiter, it returns false if the waiter was already handed a slot
+func (l *adaptiveLimit) remove(waiter *adaptiveWaiter) bool {
+	for i, candidate := range l.waiting {
+		if candidate == waiter {
+			l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// isCongested reports whether the error hints at an overloaded function, unlike a rejection with a 4xx. Throttling
+// by the gateway is a sign of overload as well.
+func isCongested(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var throttledErr *ThrottledError
+	if errors.As(err, &throttledErr) {
+		return true
+	}
+	return ErrorKind(err) != ErrorKind4xx
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestAdaptiveConcurrency(t *testing.T) {
+	fn := Function{Name: "biller", Namespace: "openfaas-fn"}
+
+	// invoke completes the invocations one after another with the latency
+	invoke := func(target *adaptiveConcurrency, count int, latency time.Duration, err error) {
+		for i := 0; i < count; i++ {
+			done, acquireErr := target.Acquire(context.Background(), fn)
+			assert.NoError(t, acquireErr, "should not throw")
+			done(latency, err)
+		}
+	}
+
+	t.Run("Should grow the limit while the latency stays low", func(t *testing.T) {
+		target := newAdaptiveConcurrency(1, 8, metrics.NoOp{})
+		assert.Equal(t, 1, target.Limit(fn), "Expected to start at the min")
+
+		invoke(target, 10, 10*time.Millisecond, nil)
+		assert.Greater(t, target.Limit(fn), 1)
+
+		invoke(target, 100, 10*time.Millisecond, nil)
+		assert.Equal(t, 8, target.Limit(fn), "Expected the limit to be capped by the max")
+	})
+
+	t.Run("Should shrink the limit once the latency goes up", func(t *testing.T) {
+		target := newAdaptiveConcurrency(2, 16, metrics.NoOp{})
+		invoke(target, 200, 10*time.Millisecond, nil)
+		assert.Equal(t, 16, target.Limit(fn))
+
+		invoke(target, 1, 50*time.Millisecond, nil)
+		assert.Equal(t, 8, target.Limit(fn), "Expected the limit to be halved")
+
+		invoke(target, 10, 50*time.Millisecond, nil)
+		assert.Equal(t, 2, target.Limit(fn), "Expected the limit to be bounded by the min")
+	})
+
+	t.Run("Should grow the limit again once the latency goes down", func(t *testing.T) {
+		target := newAdaptiveConcurrency(1, 16, metrics.NoOp{})
+		invoke(target, 200, 10*time.Millisecond, nil)
+		invoke(target, 10, 50*time.Millisecond, nil)
+		assert.Equal(t, 1, target.Limit(fn))
+
+		invoke(target, 200, 10*time.Millisecond, nil)
+		assert.Equal(t, 16, target.Limit(fn))
+	})
+
+	t.Run("Should shrink the limit on failures, but not on rejections", func(t *testing.T) {
+		target := newAdaptiveConcurrency(1, 16, metrics.NoOp{})
+		invoke(target, 200, 10*time.Millisecond, nil)
+
+		invoke(target, 5, 10*time.Millisecond, newStatusError(fasthttp.StatusBadRequest))
+		assert.Equal(t, 16, target.Limit(fn), "Expected rejections to keep the limit")
+
+		invoke(target, 1, 10*time.Millisecond, newStatusError(fasthttp.StatusServiceUnavailable))
+		assert.Equal(t, 8, target.Limit(fn))
+
+		invoke(target, 1, 10*time.Millisecond, &ThrottledError{})
+		assert.Equal(t, 4, target.Limit(fn), "Expected throttling to count as congestion")
+	})
+
+	t.Run("Should halve the limit once per burst of congested invocations", func(t *testing.T) {
+		target := newAdaptiveConcurrency(1, 8, metrics.NoOp{})
+		invoke(target, 100, 10*time.Millisecond, nil)
+
+		var dones []func(time.Duration, error)
+		for i := 0; i < 8; i++ {
+			done, err := target.Acquire(context.Background(), fn)
+			assert.NoError(t, err, "should not throw")
+			dones = append(dones, done)
+		}
+		for _, done := range dones {
+			done(50*time.Millisecond, nil)
+		}
+
+		assert.Equal(t, 4, target.Limit(fn), "Expected the invocations in flight to halve the limit once")
+	})
+
+	t.Run("Should wait for a free slot until the context is done", func(t *testing.T) {
+		target := newAdaptiveConcurrency(1, 8, metrics.NoOp{})
+		done, err := target.Acquire(context.Background(), fn)
+		assert.NoError(t, err, "should not throw")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = target.Acquire(ctx, fn)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "Expected to wait for the invocation in flight")
+
+		acquired := make(chan struct{})
+		go func() {
+			defer close(acquired)
+			next, err := target.Acquire(context.Background(), fn)
+			assert.NoError(t, err, "should not throw")
+			next(10*time.Millisecond, nil)
+		}()
+		done(10*time.Millisecond, nil)
+
+		select {
+		case <-acquired:
+		case <-time.After(time.Second):
+			t.Fatal("Expected the freed slot to be handed to the waiting invocation")
+		}
+	})
+
+	t.Run("Should not limit without adaptive concurrency", func(t *testing.T) {
+		assert.Nil(t, NewController(&config.Controller{}, nil, NewTopicFunctionCache()).adaptive)
+
+		var target *adaptiveConcurrency
+		done, err := target.Acquire(context.Background(), fn)
+		assert.NoError(t, err, "should not throw")
+		done(time.Second, nil)
+	})
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+// AllOverrides within the allowed annotation overrides honors every override annotation
+const AllOverrides = "*"
+
+// OverrideAnnotations alter how the connector invokes a function, unlike the annotations subscribing it to topics.
+// On a multi-tenant cluster they are only honored if the operator allows them.
+var OverrideAnnotations = []string{
+	TimeoutAnnotation,
+	"invoke-timeout",
+	MethodAnnotation,
+	MaxInFlightAnnotation,
+	WeightAnnotation,
+	DeliveryModeAnnotation,
+	EncodingAnnotation,
+	SchemaAnnotation,
+	WarmupAnnotation,
+	PausedAnnotation,
+}
+
+// annotationOverrides drops the override annotations of crawled functions that are not allowed, so that they are
+// treated as absent. Every ignored annotation of a function is warned about once.
+type annotationOverrides struct {
+	// allowed are the honored override annotations, nil honors all of them
+	allowed map[string]bool
+
+	lock   sync.Mutex
+	warned map[string]struct{}
+}
+
+func newAnnotationOverrides(allowed []string) *annotationOverrides {
+	overrides := &annotationOverrides{warned: map[string]struct{}{}}
+	if allowed == nil {
+		return overrides
+	}
+
+	overrides.allowed = map[string]bool{}
+	for _, annotation := range allowed {
+		if annotation == AllOverrides {
+			overrides.allowed = nil
+			return overrides
+		}
+		if !isOverrideAnnotation(annotation) {
+			log.Printf("WARNING: %s is not an override annotation, known ones are %s", annotation, strings.Join(OverrideAnnotations, ", "))
+		}
+		overrides.allowed[annotation] = true
+	}
+	return overrides
+}
+
+// Filter returns the function without the override annotations that are not allowed
+func (o *annotationOverrides) Filter(fn types.FunctionStatus, namespace string) types.FunctionStatus {
+	if o.allowed == nil || fn.Annotations == nil {
+		return fn
+	}
+
+	var filtered map[string]string
+	for _, annotation := range OverrideAnnotations {
+		if _, exists := (*fn.Annotations)[annotation]; !exists || o.allowed[annotation] {
+			continue
+		}
+
+		if filtered == nil {
+			filtered = make(map[string]string, len(*fn.Annotations))
+			for key, value := range *fn.Annotations {
+				filtered[key] = value
+			}
+		}
+		delete(filtered, annotation)
+		o.warn(Function{Name: fn.Name, Namespace: namespace}, annotation)
+	}
+
+	if filtered != nil {
+		fn.Annotations = &filtered
+	}
+	return fn
+}
+
+func (o *annotationOverrides) warn(fn Function, annotation string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	key := fn.String() + "/" + annotation
+	if _, warned := o.warned[key]; warned {
+		return
+	}
+	o.warned[key] = struct{}{}
+	log.Printf("WARNING: Ignoring the %s annotation of function %s, as it is not within the allowed annotation overrides", annotation, fn)
+}
+
+func isOverrideAnnotation(annotation string) bool {
+	for _, candidate := range OverrideAnnotations {
+		if candidate == annotation {
+			return true
+		}
+	}
+	return false
+}
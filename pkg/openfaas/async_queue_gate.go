@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/valyala/fasthttp"
+)
+
+// AsyncQueueGate applies back-pressure while the OpenFaaS async queue is backed up. It periodically scrapes the
+// queue depth from a prometheus endpoint and closes once the depth exceeds the threshold. If the depth can not be
+// determined the gate fails open, so that an unavailable metric never stops invocations.
+type AsyncQueueGate struct {
+	client    *fasthttp.Client
+	url       string
+	metric    string
+	threshold float64
+	interval  time.Duration
+	metrics   metrics.Sink
+
+	lock sync.Mutex
+	// open is closed while the gate is open, waiting on it blocks while the gate is closed
+	open   chan struct{}
+	closed bool
+	failed bool
+}
+
+// NewAsyncQueueGate creates an open gate, which closes once the depth of metric scraped from url exceeds the threshold
+func NewAsyncQueueGate(client *fasthttp.Client, url string, metric string, threshold int, interval time.Duration) *AsyncQueueGate {
+	open := make(chan struct{})
+	close(open)
+
+	return &AsyncQueueGate{
+		client:    client,
+		url:       url,
+		metric:    metric,
+		threshold: float64(threshold),
+		interval:  interval,
+		metrics:   metrics.Prometheus{},
+		open:      open,
+	}
+}
+
+// WithMetrics records the scraped depth using the sink instead of Prometheus
+func (g *AsyncQueueGate) WithMetrics(sink metrics.Sink) *AsyncQueueGate {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.metrics = sink
+	return g
+}
+
+// Start polls the queue depth until the context is done
+func (g *AsyncQueueGate) Start(ctx context.Context) {
+	g.poll(ctx)
+
+	go func() {
+		ticker := time.NewTicker(g.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				g.poll(ctx)
+			}
+		}
+	}()
+}
+
+// Wait blocks while the gate is closed, it returns early once the context is done
+func (g *AsyncQueueGate) Wait(ctx context.Context) error {
+	g.lock.Lock()
+	open := g.open
+	g.lock.Unlock()
+
+	select {
+	case <-open:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// IsOpen reports whether invocations currently may proceed
+func (g *AsyncQueueGate) IsOpen() bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return !g.closed
+}
+
+func (g *AsyncQueueGate) poll(ctx context.Context) {
+	timeout, cancel := context.WithTimeout(ctx, g.interval)
+	defer cancel()
+
+	depth, err := g.scrape(timeout)
+	g.update(depth, err)
+}
+
+// update closes the gate if the depth exceeds the threshold and opens it otherwise or if the depth is unknown
+func (g *AsyncQueueGate) update(depth float64, err error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if err != nil {
+		if !g.failed {
+			log.Printf("Received %s while reading the async queue depth, will not apply back-pressure until it is available again", err)
+		}
+		g.failed = true
+		g.setClosed(false)
+		return
+	}
+
+	if g.failed {
+		log.Printf("Async queue depth is available again")
+	}
+	g.failed = false
+	g.metrics.SetAsyncQueueDepth(depth)
+
+	switch exceeded := depth > g.threshold; {
+	case exceeded && !g.closed:
+		log.Printf("WARNING: Pausing consumption as the async queue depth %.0f exceeds %.0f", depth, g.threshold)
+	case !exceeded && g.closed:
+		log.Printf("Resuming consumption as the async queue depth %.0f drained below %.0f", depth, g.threshold)
+	}
+	g.setClosed(depth > g.threshold)
+}
+
+func (g *AsyncQueueGate) setClosed(closed bool) {
+	if closed == g.closed {
+		return
+	}
+
+	if closed {
+		g.open = make(chan struct{})
+	} else {
+		close(g.open)
+	}
+	g.closed = closed
+}
+
+// scrape reads the metric from the prometheus text format, summing up all of its series
+func (g *AsyncQueueGate) scrape(ctx context.Context) (float64, error) {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(g.url)
+	req.Header.SetMethod(fasthttp.MethodGet)
+	req.Header.Set("Accept", string(expfmt.FmtText))
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(g.interval)
+	}
+	if err := g.client.DoDeadline(req, resp, deadline); err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return 0, fmt.Errorf("unexpected Status Code %d from %s", resp.StatusCode(), g.url)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(resp.Body()))
+	if err != nil {
+		return 0, err
+	}
+
+	family, exists := families[g.metric]
+	if !exists {
+		return 0, fmt.Errorf("metric %s is not exposed by %s", g.metric, g.url)
+	}
+
+	depth := 0.0
+	for _, metric := range family.GetMetric() {
+		depth += sampleValue(metric)
+	}
+	return depth, nil
+}
+
+func sampleValue(metric *dto.Metric) float64 {
+	switch {
+	case metric.Gauge != nil:
+		return metric.GetGauge().GetValue()
+	case metric.Counter != nil:
+		return metric.GetCounter().GetValue()
+	default:
+		return metric.GetUntyped().GetValue()
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func waitReturns(gate *AsyncQueueGate, wait time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+
+	return gate.Wait(ctx) == nil
+}
+
+func TestAsyncQueueGate_Update(t *testing.T) {
+	gate := NewAsyncQueueGate(&fasthttp.Client{}, "http://gateway:8080/metrics", "queue_depth", 100, time.Second)
+
+	t.Run("Should be open initially", func(t *testing.T) {
+		assert.True(t, gate.IsOpen())
+		assert.True(t, waitReturns(gate, 10*time.Millisecond), "Expected wait to return")
+	})
+
+	t.Run("Should stay open while the depth is within the threshold", func(t *testing.T) {
+		gate.update(100, nil)
+
+		assert.True(t, gate.IsOpen())
+		assert.True(t, waitReturns(gate, 10*time.Millisecond), "Expected wait to return")
+	})
+
+	t.Run("Should close once the depth exceeds the threshold", func(t *testing.T) {
+		gate.update(101, nil)
+
+		assert.False(t, gate.IsOpen())
+		assert.False(t, waitReturns(gate, 10*time.Millisecond), "Expected wait to block")
+	})
+
+	t.Run("Should release waiting callers once the queue drained", func(t *testing.T) {
+		released := make(chan struct{})
+		go func() {
+			_ = gate.Wait(context.Background())
+			close(released)
+		}()
+
+		gate.update(20, nil)
+
+		select {
+		case <-released:
+		case <-time.After(time.Second):
+			t.Fatal("Expected waiting caller to be released")
+		}
+		assert.True(t, gate.IsOpen())
+	})
+
+	t.Run("Should fail open if the depth is unavailable", func(t *testing.T) {
+		gate.update(500, nil)
+		assert.False(t, gate.IsOpen())
+
+		gate.update(0, errors.New("connection refused"))
+		assert.True(t, gate.IsOpen())
+		assert.True(t, waitReturns(gate, 10*time.Millisecond), "Expected wait to return")
+	})
+}
+
+func TestAsyncQueueGate_Scrape(t *testing.T) {
+	var depth atomic.Value
+	depth.Store("350")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			w.WriteHeader(404)
+			return
+		}
+
+		_, _ = w.Write([]byte("# HELP queue_depth Pending messages\n# TYPE queue_depth gauge\n" +
+			"queue_depth{queue=\"a\"} " + depth.Load().(string) + "\nqueue_depth{queue=\"b\"} 50\nother_metric 9000\n"))
+	}))
+	defer server.Close()
+
+	t.Run("Should sum up all series of the metric", func(t *testing.T) {
+		gate := NewAsyncQueueGate(&fasthttp.Client{}, server.URL+"/metrics", "queue_depth", 100, time.Second)
+
+		value, err := gate.scrape(context.Background())
+		assert.NoError(t, err, "Should not fail")
+		assert.Equal(t, 400.0, value)
+	})
+
+	t.Run("Should close and reopen the gate while polling", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		gate := NewAsyncQueueGate(&fasthttp.Client{}, server.URL+"/metrics", "queue_depth", 100, 10*time.Millisecond)
+		gate.Start(ctx)
+		assert.False(t, gate.IsOpen(), "Expected the initial poll to close the gate")
+
+		depth.Store("0")
+		assert.True(t, waitReturns(gate, time.Second), "Expected the gate to reopen")
+	})
+
+	t.Run("Should fail if the metric is not exposed", func(t *testing.T) {
+		gate := NewAsyncQueueGate(&fasthttp.Client{}, server.URL+"/metrics", "missing_metric", 100, time.Second)
+
+		_, err := gate.scrape(context.Background())
+		assert.Error(t, err, "Should fail")
+		assert.Contains(t, err.Error(), "missing_metric")
+	})
+
+	t.Run("Should fail on unexpected status codes", func(t *testing.T) {
+		gate := NewAsyncQueueGate(&fasthttp.Client{}, server.URL+"/unknown", "queue_depth", 100, time.Second)
+
+		_, err := gate.scrape(context.Background())
+		assert.Error(t, err, "Should fail")
+	})
+}
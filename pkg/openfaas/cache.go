@@ -8,49 +8,130 @@ package openfaas
 import (
 	"log"
 	"sync"
+
+	"github.com/Templum/rabbitmq-connector/pkg/logging"
 )
 
 // TopicMap defines a interface for a topic map
 type TopicMap interface {
-	GetCachedValues(name string) []string
-	Refresh(update map[string][]string)
+	GetCachedValues(name string) []Function
+	GetDeliveryMode(name string) DeliveryMode
+	Refresh(update map[string][]Function)
 }
 
 // TopicFunctionCache contains a map of of topics to functions
 type TopicFunctionCache struct {
-	topicMap map[string][]string
+	topicMap map[string][]Function
+	active   map[string][]Function
+	modes    map[string]DeliveryMode
 	lock     sync.RWMutex
 }
 
 // NewTopicFunctionCache return a new instance
 func NewTopicFunctionCache() *TopicFunctionCache {
 	return &TopicFunctionCache{
-		topicMap: make(map[string][]string),
+		topicMap: make(map[string][]Function),
+		active:   make(map[string][]Function),
+		modes:    make(map[string]DeliveryMode),
 		lock:     sync.RWMutex{},
 	}
 }
 
-// GetCachedValues reads the cached functions for a given topic
-func (m *TopicFunctionCache) GetCachedValues(name string) []string {
+// GetCachedValues reads the cached functions for a given topic, excluding paused functions. The returned slice is
+// shared with the cache and is replaced rather than modified on refresh, hence callers must not modify it.
+func (m *TopicFunctionCache) GetCachedValues(name string) []Function {
 	m.lock.RLock()
 	defer m.lock.RUnlock()
 
-	var functions []string
-	for topic, function := range m.topicMap {
-		if topic == name {
-			functions = function
-			break
-		}
-	}
-
-	return functions
+	return m.active[name]
 }
 
-// Refresh updates the existing cache with new values while syncing ensuring no read conflicts
-func (m *TopicFunctionCache) Refresh(update map[string][]string) {
+// GetDeliveryMode returns the delivery mode of a topic, topics without best-effort functions are fail-fast
+func (m *TopicFunctionCache) GetDeliveryMode(name string) DeliveryMode {
 	m.lock.RLock()
 	defer m.lock.RUnlock()
 
-	log.Printf("Update cache with %d entries", len(update))
+	if mode, exists := m.modes[name]; exists {
+		return mode
+	}
+	return FailFast
+}
+
+// Refresh updates the existing cache with new values while syncing ensuring no read conflicts
+func (m *TopicFunctionCache) Refresh(update map[string][]Function) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	logging.Debugf("Update cache with %d entries", len(update))
 	m.topicMap = update
+	m.active = withoutPaused(update)
+	m.modes = deliveryModes(update)
+}
+
+// deliveryModes derives the delivery mode of every topic, only best-effort topics are stored
+func deliveryModes(update map[string][]Function) map[string]DeliveryMode {
+	modes := make(map[string]DeliveryMode)
+
+	for topic, functions := range update {
+		if mode := TopicDeliveryMode(topic, functions); mode == BestEffort {
+			modes[topic] = mode
+		}
+	}
+
+	return modes
+}
+
+// TopicDeliveryMode derives the delivery mode of a topic from its functions. A topic becomes best-effort if one of
+// its functions requests it, unless another function requests fail-fast, as fail-fast is the safer choice.
+func TopicDeliveryMode(topic string, functions []Function) DeliveryMode {
+	bestEffort, failFast := false, false
+	for _, fn := range functions {
+		switch fn.DeliveryMode {
+		case BestEffort:
+			bestEffort = true
+		case FailFast:
+			failFast = true
+		}
+	}
+
+	switch {
+	case bestEffort && failFast:
+		log.Printf("Functions of topic %s request conflicting delivery modes, will use %s", topic, FailFast)
+		return FailFast
+	case bestEffort:
+		return BestEffort
+	default:
+		return FailFast
+	}
+}
+
+// withoutPaused pre-builds the topic map used for lookups, only topics with paused functions require a new slice
+func withoutPaused(update map[string][]Function) map[string][]Function {
+	active := make(map[string][]Function, len(update))
+
+	for topic, functions := range update {
+		paused := 0
+		for _, fn := range functions {
+			if fn.Paused {
+				paused++
+			}
+		}
+
+		switch paused {
+		case 0:
+			active[topic] = functions
+		case len(functions):
+			log.Printf("All functions of topic %s are paused", topic)
+		default:
+			filtered := make([]Function, 0, len(functions)-paused)
+			for _, fn := range functions {
+				if !fn.Paused {
+					filtered = append(filtered, fn)
+				}
+			}
+			active[topic] = filtered
+		}
+	}
+
+	return active
 }
@@ -6,6 +6,7 @@
 package openfaas
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -14,7 +15,7 @@ import (
 func TestTopicMap(t *testing.T) {
 	t.Parallel()
 
-	update := map[string][]string{"billing": {"taxes", "notify"}}
+	update := map[string][]Function{"billing": {{Name: "taxes"}, {Name: "notify", Namespace: "faas"}}}
 
 	t.Run("Should override cache with update", func(t *testing.T) {
 		cache := NewTopicFunctionCache()
@@ -40,4 +41,55 @@ func TestTopicMap(t *testing.T) {
 		found := cache.GetCachedValues("billing")
 		assert.Len(t, found, 0, "Expected empty list for non existing topic")
 	})
+
+	t.Run("Should skip paused functions", func(t *testing.T) {
+		cache := NewTopicFunctionCache()
+		cache.Refresh(map[string][]Function{
+			"billing":   {{Name: "taxes", Paused: true}, {Name: "notify"}},
+			"transport": {{Name: "taxes", Paused: true}},
+		})
+
+		assert.Equal(t, []Function{{Name: "notify"}}, cache.GetCachedValues("billing"))
+		assert.Len(t, cache.GetCachedValues("transport"), 0, "Expected no functions if all are paused")
+	})
+
+	t.Run("Should include functions again once they are unpaused", func(t *testing.T) {
+		cache := NewTopicFunctionCache()
+		cache.Refresh(map[string][]Function{"billing": {{Name: "taxes", Paused: true}}})
+		cache.Refresh(map[string][]Function{"billing": {{Name: "taxes"}}})
+
+		assert.Equal(t, []Function{{Name: "taxes"}}, cache.GetCachedValues("billing"))
+	})
+
+	t.Run("Should derive the delivery mode of every topic", func(t *testing.T) {
+		cache := NewTopicFunctionCache()
+		cache.Refresh(map[string][]Function{
+			"billing":   {{Name: "taxes", DeliveryMode: BestEffort}, {Name: "notify"}},
+			"transport": {{Name: "taxes", DeliveryMode: BestEffort}, {Name: "notify", DeliveryMode: FailFast}},
+			"invoice":   {{Name: "notify"}},
+		})
+
+		assert.Equal(t, BestEffort, cache.GetDeliveryMode("billing"), "Expected best-effort if requested by a function")
+		assert.Equal(t, FailFast, cache.GetDeliveryMode("transport"), "Expected fail-fast to win conflicts")
+		assert.Equal(t, FailFast, cache.GetDeliveryMode("invoice"), "Expected fail-fast by default")
+		assert.Equal(t, FailFast, cache.GetDeliveryMode("unknown"), "Expected fail-fast for unknown topics")
+	})
+}
+
+func BenchmarkGetCachedValues(b *testing.B) {
+	builder := NewFunctionMapBuilder()
+	for i := 0; i < 500; i++ {
+		builder.Append(fmt.Sprintf("topic-%d", i), Function{Name: fmt.Sprintf("function-%d", i)})
+	}
+
+	cache := NewTopicFunctionCache()
+	cache.Refresh(builder.Build())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(cache.GetCachedValues("topic-250")) != 1 {
+			b.Fatal("expected function")
+		}
+	}
 }
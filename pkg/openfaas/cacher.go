@@ -7,61 +7,579 @@ package openfaas
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
 
+	"github.com/Templum/rabbitmq-connector/pkg/backoff"
 	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/Templum/rabbitmq-connector/pkg/logging"
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
 	"github.com/openfaas/faas-provider/types"
+	"github.com/spf13/afero"
 )
 
 // Copyright (c) Simon Pelczer 2019. All rights reserved.
 // Licensed under the MIT license. See LICENSE file in the project root for full license information.
 
+// TimeoutAnnotation overrides the global invoke timeout for a single function, e.g. 500ms or 5m
+const TimeoutAnnotation = "com.openfaas.topic.timeout"
+
+// MethodAnnotation selects the http method used for invoking a function, one of POST, PUT or PATCH
+const MethodAnnotation = "invoke-method"
+
+// MaxInFlightAnnotation limits the concurrent invocations of a single function, overriding the global default
+const MaxInFlightAnnotation = "max-inflight"
+
+// WeightAnnotation sets the share of the invocation pool a function receives while it is saturated, e.g. 5
+const WeightAnnotation = "invoke-weight"
+
+// DeliveryModeAnnotation selects the delivery mode of the topics of a function, either fail-fast or best-effort
+const DeliveryModeAnnotation = "topic-delivery-mode"
+
+// EncodingAnnotation selects how the message is encoded as body of an invocation, one of raw, json or form
+const EncodingAnnotation = "invoke-encoding"
+
+// SchemaAnnotation references the schema of the schema directory that messages are validated against before invocation
+const SchemaAnnotation = "schema"
+
+// PausedAnnotation excludes a function from invocation while it is set to true
+const PausedAnnotation = "com.openfaas.topic.paused"
+
 // Controller is responsible for building up and maintaining a
 // Cache with all of the deployed OpenFaaS Functions across
 // all namespaces
 type Controller struct {
-	conf   *config.Controller
-	client FunctionCrawler
-	cache  TopicMap
+	conf    *config.Controller
+	client  FunctionCrawler
+	invoker Invoker
+	cache   TopicMap
+	sources []TopicSource
+	health  *HealthTracker
+	removal *RemovalGrace
+	limiter *inFlightLimiter
+	info    *topicInfo
+	metrics metrics.Sink
+	static  map[string][]Function
+	aliases topicAliases
+	// adaptive limits the concurrent invocations of every function to a limit adapting to their latency, if configured
+	adaptive *adaptiveConcurrency
+	// pool caps the concurrent invocations across all functions, sharing them by weight, if configured
+	pool *weightedPool
+	// resolver resolves the invocation target of the crawled functions, if configured
+	resolver FunctionResolver
+	// overrides drops the override annotations of the crawled functions that are not allowed
+	overrides *annotationOverrides
+	// staticFile rereads the static mappings on every refresh, if configured
+	staticFile *staticMappingsFile
+	// settingsFile is polled on every refresh, the static mappings of it replace the ones of the same topic in static
+	settingsFile   *settingsFile
+	settingsStatic map[string][]Function
+	// annotations is the default topic source, whose keys are replaced by the settings
+	annotations *AnnotationTopicSource
+	// patterns are the subscriptions via topic-regex annotation, which are matched on every invocation
+	patterns *topicPatterns
+	// schedule adapts the crawl interval of every namespace to its changes, if configured
+	schedule *CrawlSchedule
+	// listeners are notified about topic changes, topics tracks the subscribed topics for them
+	listeners []TopicListener
+	topics    *topicDiff
+	// subscriptionListeners are notified about functions subscribing to or unsubscribing from topics
+	subscriptionListeners []SubscriptionListener
+	// functionListeners are notified about functions vanishing from the topic map, functions tracks the known functions for them
+	functionListeners []FunctionListener
+	functions         *functionDiff
+	// topicHealth tracks the ready subscribers of every topic
+	topicHealth *topicHealth
+	// previous is the topic map of the last refresh, which is used to log its changes
+	previous map[string][]Function
+	// namespaces are the ones listed last, which are crawled again while listing them fails
+	namespaces []string
+	// gate applies back-pressure while the async queue is backed up, if configured
+	gate *AsyncQueueGate
+	// freshness holds back deliveries while the topic map is cold or stale, if configured
+	freshness *freshnessGate
+	// warmups remembers the last warmup of every function annotated with warmup
+	warmups *warmups
+	// ctx is the context of Start, once it is done pending inter invocation delays are aborted
+	ctx     context.Context
+	ctxLock sync.RWMutex
+
+	statsLock sync.Mutex
+	stats     RefreshStats
+	// created is the time the cache age is measured from, until the first refresh succeeded
+	created time.Time
+	// stale is true while the cache age exceeds the max cache staleness, so that this is only warned about once
+	stale bool
+	// snapshot is the topic map of the last refresh, see TopicMap
+	snapshot map[string][]Function
+}
+
+// RefreshStats describes the refreshes of the topic map
+type RefreshStats struct {
+	LastRefresh  time.Time     `json:"last_refresh"`
+	LastDuration time.Duration `json:"last_duration_ns"`
+	// LastSuccess is the start of the last refresh without crawl errors, it is zero until the first one
+	LastSuccess time.Time `json:"last_success"`
+	// Overruns counts the refreshes that took longer than the refresh interval
+	Overruns int `json:"overruns"`
+	// Topics and Functions count the topics and distinct functions of the last refresh
+	Topics    int `json:"topics"`
+	Functions int `json:"functions"`
 }
 
-// NewController returns a new instance
+// NewController returns a new instance, which reads the topics from the function annotations
 func NewController(conf *config.Controller, client FunctionCrawler, cache TopicMap) *Controller {
+	health := NewHealthTracker(0, 0)
+	var removal *RemovalGrace
+	var schedule *CrawlSchedule
+	var adaptive *adaptiveConcurrency
+	var freshness *freshnessGate
+	var pool *weightedPool
+	static := map[string][]Function{}
+	var aliases topicAliases
+	var allowed []string
+	overrides := newAnnotationOverrides(nil)
+	annotations := &AnnotationTopicSource{}
+	if conf != nil {
+		allowed = conf.AllowedTopics
+		overrides = newAnnotationOverrides(conf.AllowedAnnotationOverrides)
+		static = newStaticMappings(conf.StaticMappings)
+		aliases = conf.TopicAliases
+		health = NewHealthTracker(conf.AutoPauseWindow, conf.AutoPauseErrorRatio)
+		if conf.FunctionRemovalGrace > 0 {
+			removal = NewRemovalGrace(conf.FunctionRemovalGrace)
+		}
+		if conf.CrawlMaxInterval > 0 {
+			schedule = NewCrawlSchedule(conf.CrawlMinInterval, conf.CrawlMaxInterval)
+		}
+		if conf.AdaptiveConcurrencyMax > 0 {
+			adaptive = newAdaptiveConcurrency(conf.AdaptiveConcurrencyMin, conf.AdaptiveConcurrencyMax, metrics.Prometheus{})
+		}
+		if conf.PauseWhileStale {
+			freshness = newFreshnessGate()
+		}
+		if conf.InvocationPoolSize > 0 {
+			pool = newWeightedPool(conf.InvocationPoolSize)
+		}
+	}
+
 	return &Controller{
-		conf:   conf,
-		client: client,
-		cache:  cache,
+		conf:     conf,
+		client:   client,
+		invoker:  client,
+		cache:    cache,
+		sources:  []TopicSource{annotations},
+		health:   health,
+		removal:  removal,
+		schedule: schedule,
+		limiter:  newInFlightLimiter(),
+		adaptive: adaptive,
+		pool:     pool,
+		info:     newTopicInfo(metrics.Prometheus{}),
+		metrics:  metrics.Prometheus{},
+		static:   static,
+		aliases:  aliases,
+		patterns: newTopicPatterns(allowed),
+		topics:   newTopicDiff(),
+		warmups:  newWarmups(),
+		ctx:      context.Background(),
+		created:  time.Now(),
+
+		annotations: annotations,
+		functions:   newFunctionDiff(),
+		overrides:   overrides,
+		freshness:   freshness,
+		topicHealth: newTopicHealth(metrics.Prometheus{}),
+	}
+}
+
+// WithInvoker replaces the invoker of the crawler, which allows invoking the discovered functions via another transport
+func (c *Controller) WithInvoker(invoker Invoker) *Controller {
+	c.invoker = invoker
+	return c
+}
+
+// WithTopicSources adds further sources, whose topics are merged with the annotation derived ones
+func (c *Controller) WithTopicSources(sources ...TopicSource) *Controller {
+	c.sources = append(c.sources, sources...)
+	return c
+}
+
+// WithTopicListeners adds listeners, which are notified about topic changes once the cache was refreshed
+func (c *Controller) WithTopicListeners(listeners ...TopicListener) *Controller {
+	c.listeners = append(c.listeners, listeners...)
+	return c
+}
+
+// WithSubscriptionListeners adds listeners, which are notified about subscription changes once the cache was refreshed
+func (c *Controller) WithSubscriptionListeners(listeners ...SubscriptionListener) *Controller {
+	c.subscriptionListeners = append(c.subscriptionListeners, listeners...)
+	return c
+}
+
+// WithFunctionListeners adds listeners, which are notified about removed functions once the cache was refreshed
+func (c *Controller) WithFunctionListeners(listeners ...FunctionListener) *Controller {
+	c.functionListeners = append(c.functionListeners, listeners...)
+	return c
+}
+
+// WithFunctionResolver resolves the target every crawled function is invoked by, see FunctionResolver. Static
+// mappings are not resolved, as they are not crawled.
+func (c *Controller) WithFunctionResolver(resolver FunctionResolver) *Controller {
+	c.resolver = resolver
+	return c
+}
+
+// WithStaticMappingsFile rereads the static mappings from the file on every refresh, so that changes are applied
+// without a restart. The mappings of the config are used until the file is read.
+func (c *Controller) WithStaticMappingsFile(fs afero.Fs, path string) *Controller {
+	var mappings map[string][]string
+	if c.conf != nil {
+		mappings = c.conf.StaticMappings
+	}
+	c.staticFile = &staticMappingsFile{fs: fs, path: path, mappings: mappings}
+	return c
+}
+
+// WithSettingsFile polls the modification time of the settings file on every refresh and applies the reloadable
+// settings once it changed, see config.Settings. The first refresh applies them right away.
+func (c *Controller) WithSettingsFile(fs afero.Fs, path string) *Controller {
+	var startup *config.Settings
+	if c.conf != nil {
+		startup = c.conf.Settings
+	}
+	c.settingsFile = &settingsFile{fs: fs, path: path, startup: startup}
+	return c
+}
+
+// WithAsyncQueueGate applies back-pressure via AwaitCapacity while the gate is closed, the gate is started with the controller
+func (c *Controller) WithAsyncQueueGate(gate *AsyncQueueGate) *Controller {
+	c.gate = gate
+	return c
+}
+
+// WithMetrics replaces the Prometheus instrumentation of the controller and its async queue gate with the sink
+func (c *Controller) WithMetrics(sink metrics.Sink) *Controller {
+	c.metrics = sink
+	c.info = newTopicInfo(sink)
+	c.topicHealth = newTopicHealth(sink)
+	if c.adaptive != nil {
+		c.adaptive.metrics = sink
+	}
+	if c.gate != nil {
+		c.gate.WithMetrics(sink)
 	}
+	return c
 }
 
-// Start setups the cache and starts continuous caching
+// Start setups the cache and starts continuous caching. If a startup splay is configured, the initial crawl is
+// delayed by the pod ordinal of the hostname times the splay. Start returns once the cache was populated.
 func (c *Controller) Start(ctx context.Context) {
+	c.ctxLock.Lock()
+	c.ctx = ctx
+	c.ctxLock.Unlock()
+	if c.gate != nil {
+		c.gate.Start(ctx)
+	}
+	if !c.awaitStartupSplay(ctx) {
+		return
+	}
 	hasNamespaceSupport, _ := c.client.HasNamespaceSupport(ctx)
 	timer := time.NewTicker(c.conf.TopicRefreshTime)
 
 	// Initial populating
-	c.refreshTick(ctx, hasNamespaceSupport)
-	go c.refresh(ctx, timer, hasNamespaceSupport)
+	_, err := c.refreshTick(ctx, hasNamespaceSupport)
+	go func() {
+		if err != nil {
+			c.retryInitialRefresh(ctx, hasNamespaceSupport)
+		}
+		c.refresh(ctx, timer, hasNamespaceSupport)
+	}()
+	if c.conf.EnableWarmups {
+		go c.warmup(ctx, time.NewTicker(warmupResolution))
+	}
+}
+
+// awaitStartupSplay waits for the startup splay, it returns false if the context ended meanwhile
+func (c *Controller) awaitStartupSplay(ctx context.Context) bool {
+	if c.conf == nil || c.conf.StartupSplay <= 0 {
+		return true
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Printf("Failed to determine the hostname for the startup splay due to %s, will start right away", err)
+		return true
+	}
+	delay := startupSplay(hostname, c.conf.StartupSplay)
+	if delay <= 0 {
+		return true
+	}
+
+	log.Printf("Delaying the initial crawl by %s due to the startup splay of %s", delay, hostname)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
-// Invoke triggers a call to all functions registered to the specified topic. It will abort invocation in case it encounters an error
-func (c *Controller) Invoke(topic string, invocation *types2.OpenFaaSInvocation) error {
-	functions := c.cache.GetCachedValues(topic)
+// Invoke triggers a call to all functions subscribed to the specified topic. Fail-fast topics abort on the first error,
+// while best-effort topics invoke all functions and return their errors combined, the results include the failed ones.
+func (c *Controller) Invoke(topic string, invocation *types2.OpenFaaSInvocation) ([]types2.InvocationResult, error) {
+	return c.InvokeContext(context.Background(), topic, invocation)
+}
+
+// InvokeContext invokes like Invoke, while the invocations inherit the values of the context. The trace carried by
+// the context is continued by the invoked functions, see types.ContextWithTrace.
+func (c *Controller) InvokeContext(ctx context.Context, topic string, invocation *types2.OpenFaaSInvocation) ([]types2.InvocationResult, error) {
+	topics := c.aliases.Expand(topic)
+	functions := withPatternSubscribers(subscribers(c.cache, topics), c.patterns.Match(topic))
+	results := make([]types2.InvocationResult, 0, len(functions))
+	bestEffort := deliveryMode(c.cache, topics) == BestEffort
+	var errs []error
+
+	if err := c.validateTopic(topic, invocation); err != nil {
+		log.Printf("Invocation for topic %s rejected due to %s", topic, err)
+		return results, err
+	}
 
 	for _, fn := range functions {
-		_, err := c.client.InvokeAsync(context.Background(), fn, invocation)
+		if c.health.IsPaused(fn) {
+			continue
+		}
+
+		if len(results) > 0 {
+			if err := c.awaitInterInvocationDelay(ctx, invocation); err != nil {
+				log.Printf("Invocation for topic %s aborted due to %s", topic, err)
+				return results, err
+			}
+		}
+
+		start := time.Now()
+		fnCtx, cancel := c.invocationContext(ctx, fn, invocation)
+		var response []byte
+		var release func()
+		var adapt func(time.Duration, error)
+		err := c.validateFunction(fn, invocation)
+		if err == nil {
+			release, err = c.limiter.Acquire(fnCtx, fn, c.maxInFlight(fn))
+		}
+		if err == nil {
+			var releaseSlot func()
+			if releaseSlot, err = c.pool.Acquire(fnCtx, fn); err != nil {
+				release()
+			} else {
+				releaseLimit := release
+				release = func() {
+					releaseSlot()
+					releaseLimit()
+				}
+			}
+		}
+		if err == nil {
+			if adapt, err = c.adaptive.Acquire(fnCtx, fn); err != nil {
+				release()
+			}
+		}
+		if err == nil {
+			invoked := time.Now()
+			if c.expectsReply(invocation) {
+				response, err = c.invoker.InvokeSync(fnCtx, fn, invocation)
+			} else {
+				_, err = c.invoker.InvokeAsync(fnCtx, fn, invocation)
+			}
+			adapt(time.Since(invoked), err)
+			release()
+			c.health.Record(fn, err != nil)
+		}
+		cancel()
+		result := newInvocationResult(topic, fn, invocation, start, err)
+		result.Response = response
+		c.metrics.IncInvocations(topic, fn.Name, fn.Namespace, result.Status)
+		c.metrics.ObserveLatency(fn.Name, fn.Namespace, result.Latency)
+		results = append(results, result)
+
 		if err != nil {
 			log.Printf("Invocation for topic %s failed due to err %s", topic, err)
-			return err
+			if !bestEffort {
+				return results, err
+			}
+			errs = append(errs, fmt.Errorf("function %s: %w", fn, err))
 		}
 	}
-	log.Printf("Invocation for topic %s finished on %d function(s)", topic, len(functions))
-	return nil
+
+	if len(errs) > 0 {
+		log.Printf("Invocation for topic %s failed on %d of %d function(s)", topic, len(errs), len(results))
+		return results, fmt.Errorf("%d of %d function(s) failed: %w", len(errs), len(results), errors.Join(errs...))
+	}
+	log.Printf("Invocation for topic %s finished on %d function(s)", topic, len(results))
+	return results, nil
+}
+
+// AwaitCapacity blocks while the async queue is backed up or, with PauseWhileStale, while the topic map is cold or
+// stale. It returns early once the context of Start is done.
+func (c *Controller) AwaitCapacity() {
+	ctx := c.startContext()
+	_ = c.freshness.Wait(ctx)
+	if c.gate == nil {
+		return
+	}
+
+	_ = c.gate.Wait(ctx)
+}
+
+// startContext returns the context of Start, which may be called while invoking already
+func (c *Controller) startContext() context.Context {
+	c.ctxLock.RLock()
+	defer c.ctxLock.RUnlock()
+
+	return c.ctx
+}
+
+// RefreshStats returns the stats of the topic map refreshes
+func (c *Controller) RefreshStats() RefreshStats {
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+
+	return c.stats
+}
+
+// TopicMap returns the topic map of the last refresh, like RefreshOnce does. It must not be modified.
+func (c *Controller) TopicMap() map[string][]Function {
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+
+	if c.snapshot == nil {
+		return map[string][]Function{}
+	}
+	return c.snapshot
+}
+
+// TopicHealth returns the ready subscribers of every topic of the last refresh, topics without ready subscriber are
+// flagged as unhandled. Subscribers via topic-regex annotation are not included, as they are matched on invocation.
+func (c *Controller) TopicHealth() []TopicHealth {
+	return c.topicHealth.Health()
+}
+
+// FunctionStats returns the invocation outcomes of every invoked function within the auto-pause window
+func (c *Controller) FunctionStats() []FunctionStats {
+	return c.health.Stats()
+}
+
+// awaitInterInvocationDelay pauses between two invoked functions, if an inter invocation delay is configured. It
+// returns early once the context of the invocation or of Start is done, or the deadline or expiry of the message passed.
+func (c *Controller) awaitInterInvocationDelay(ctx context.Context, invocation *types2.OpenFaaSInvocation) error {
+	if c.conf == nil || c.conf.InterInvocationDelay <= 0 {
+		return nil
+	}
+
+	ctx, cancel := messageContext(ctx, invocation)
+	defer cancel()
+	started := c.startContext()
+
+	timer := time.NewTimer(c.conf.InterInvocationDelay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-started.Done():
+		return started.Err()
+	}
+}
+
+// maxInFlight returns the max in-flight invocations annotated on the function, falling back to the global default.
+// Functions at their limit are waited for, which counts towards their invoke timeout.
+func (c *Controller) maxInFlight(fn Function) int {
+	if fn.MaxInFlight > 0 {
+		return fn.MaxInFlight
+	}
+	if c.conf == nil {
+		return 0
+	}
+	return c.conf.MaxInFlightPerFunction
+}
+
+// invokeTimeout returns the timeout annotated on the function, falling back to the global invoke timeout
+func (c *Controller) invokeTimeout(fn Function) time.Duration {
+	if fn.Timeout > 0 {
+		return fn.Timeout
+	}
+	if c.conf != nil && c.conf.InvokeTimeout > 0 {
+		return c.conf.InvokeTimeout
+	}
+	return 60 * time.Second
+}
+
+// expectsReply is true if replies are enabled and the requester awaits the response, which requires a synchronous
+// invocation whose result carries the response of the function
+func (c *Controller) expectsReply(invocation *types2.OpenFaaSInvocation) bool {
+	return c.conf != nil && c.conf.EnableReplies && invocation != nil && len(invocation.ReplyTo) > 0
+}
+
+// invocationContext is bound by the invoke timeout, capped by the deadline and the expiry of the message, so that
+// neither a far deadline extends the timeout nor an invocation outlives the TTL of its message.
+func (c *Controller) invocationContext(parent context.Context, fn Function, invocation *types2.OpenFaaSInvocation) (context.Context, context.CancelFunc) {
+	ctx, cancelMessage := messageContext(parent, invocation)
+	ctx, cancel := context.WithTimeout(ctx, c.invokeTimeout(fn))
+	return ctx, func() {
+		cancel()
+		cancelMessage()
+	}
+}
+
+// messageContext is bound by the deadline and the expiry of the message, whichever passes first
+func messageContext(parent context.Context, invocation *types2.OpenFaaSInvocation) (context.Context, context.CancelFunc) {
+	if invocation == nil {
+		return context.WithCancel(parent)
+	}
+
+	deadline := invocation.Deadline
+	if deadline.IsZero() || (!invocation.Expiry.IsZero() && invocation.Expiry.Before(deadline)) {
+		deadline = invocation.Expiry
+	}
+	if deadline.IsZero() {
+		return context.WithCancel(parent)
+	}
+	return context.WithDeadline(parent, deadline)
+}
+
+func newInvocationResult(topic string, fn Function, invocation *types2.OpenFaaSInvocation, start time.Time, err error) types2.InvocationResult {
+	result := types2.InvocationResult{
+		Topic:     topic,
+		Function:  fn.Name,
+		Namespace: fn.Namespace,
+		Status:    types2.StatusSuccess,
+		Latency:   time.Since(start),
+		Timestamp: start,
+		Error:     err,
+	}
+
+	if invocation != nil {
+		result.CorrelationID = invocation.CorrelationID
+	}
+
+	if err != nil {
+		result.Status = types2.StatusFailure
+	}
+
+	return result
 }
 
 func (c *Controller) refresh(ctx context.Context, ticker *time.Ticker, hasNamespaceSupport bool) {
@@ -78,60 +596,610 @@ loop:
 	}
 }
 
-func (c *Controller) refreshTick(ctx context.Context, hasNamespaceSupport bool) {
-	builder := NewFunctionMapBuilder()
+// retryInitialRefresh retries a failed initial refresh using the refresh backoff, instead of waiting for the next
+// refresh tick. It gives up once a refresh succeeded, the context ended or the delay reached the refresh interval, which
+// leaves it to the regular refresh.
+func (c *Controller) retryInitialRefresh(ctx context.Context, hasNamespaceSupport bool) {
+	delays := backoff.New(c.conf.RefreshBackoff)
+	for {
+		delay := delays.Next()
+		if delay >= c.conf.TopicRefreshTime {
+			return
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+
+		if _, err := c.refreshTick(ctx, hasNamespaceSupport); err == nil {
+			return
+		}
+		log.Printf("Initial refresh of the topic map failed, will retry it with a backoff")
+	}
+}
+
+// RefreshOnce crawls the gateway a single time and refreshes the topic map, without starting the continuous refresh.
+// In contrast to the continuous refresh, crawl errors are returned. The refreshed topic map is returned as well.
+func (c *Controller) RefreshOnce(ctx context.Context) (map[string][]Function, error) {
+	hasNamespaceSupport, err := c.client.HasNamespaceSupport(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.refreshTick(ctx, hasNamespaceSupport)
+}
+
+// refreshTick rebuilds the topic map, crawl errors are logged and the first one is returned alongside the new topic map
+func (c *Controller) refreshTick(ctx context.Context, hasNamespaceSupport bool) (map[string][]Function, error) {
+	start := time.Now()
+	var mapping map[string][]Function
+	var crawlErr error
+	defer func() { c.recordRefresh(start, time.Since(start), mapping, crawlErr) }()
+
+	builder := NewFunctionMapBuilder().WithMetrics(c.metrics)
+	if c.conf != nil {
+		builder.WithMaxTopics(c.conf.MaxTopics).WithPreviousTopics(c.previous).WithAllowedTopics(c.conf.AllowedTopics)
+	}
 	var namespaces []string
 	var err error
 
 	if hasNamespaceSupport {
-		log.Println("Crawling namespaces for functions")
+		logging.Debugf("Crawling namespaces for functions")
 		namespaces, err = c.client.GetNamespaces(ctx)
 		if err != nil {
-			log.Printf("Received the following error during fetching namespaces %s", err)
-			namespaces = []string{}
+			namespaces = c.fallbackNamespaces()
+			log.Printf("Received the following error during fetching namespaces %s, will crawl %s instead", err, describeNamespaces(namespaces))
+			crawlErr = err
+		} else {
+			c.namespaces = namespaces
 		}
 	} else {
 		namespaces = []string{""}
 	}
+	if c.schedule != nil && err == nil {
+		c.schedule.Retain(namespaces)
+	}
+
+	if c.settingsFile != nil {
+		if settings, changed := c.settingsFile.poll(); changed {
+			c.applySettings(settings)
+		}
+	}
+	for _, source := range c.sources {
+		source.Refresh()
+	}
+	c.patterns.Refresh()
+
+	if c.removal != nil {
+		c.removal.Begin()
+	}
+
+	logging.Debugf("Crawling for functions")
+	ready := map[string]bool{}
+	failed := map[string]bool{}
+	patterns, err := c.crawlFunctions(ctx, namespaces, builder, ready, failed)
+	if err != nil && crawlErr == nil {
+		crawlErr = err
+	}
 
-	log.Println("Crawling for functions")
-	c.crawlFunctions(ctx, namespaces, builder)
+	if c.removal != nil {
+		c.removal.Finish(builder.Append)
+	}
+	if c.staticFile != nil {
+		if static, changed := c.staticFile.reload(); changed {
+			c.static = static
+		}
+	}
+	c.appendStatic(builder)
 
-	log.Println("Crawling finished will now refresh the cache")
-	c.cache.Refresh(builder.Build())
+	logging.Debugf("Crawling finished will now refresh the cache")
+	mapping = builder.Build()
+	if rejected := builder.Rejected(); len(rejected) > 0 {
+		log.Printf("WARNING: Dropped %d topic(s) as the maximum of %d topics was reached: %s", len(rejected), c.conf.MaxTopics, strings.Join(rejected, ", "))
+	}
+	if ignored := builder.Ignored(); len(ignored) > 0 {
+		log.Printf("WARNING: Ignored %d subscription(s) to topics that are not allowed: %s", len(ignored), strings.Join(ignored, ", "))
+	}
+	c.cache.Refresh(mapping)
+	c.patterns.Update(patterns)
+	c.info.Update(mapping)
+	c.topicHealth.Update(mapping, ready)
+
+	if delta := diffTopicMaps(c.previous, mapping); !delta.IsEmpty() {
+		log.Printf("Topic map updated: %s", delta)
+		c.notifySubscriptionListeners(mapping)
+	}
+	c.previous = mapping
+
+	if len(c.listeners) > 0 {
+		added, removed := c.topics.Update(mapping)
+		if len(added) > 0 || len(removed) > 0 {
+			logging.Debugf("Topics changed, %d added and %d removed", len(added), len(removed))
+			for _, listener := range c.listeners {
+				listener.TopicsChanged(added, removed)
+			}
+		}
+	}
+
+	if len(c.functionListeners) > 0 {
+		if removed := c.functions.Update(mapping, patterns, failed); len(removed) > 0 {
+			logging.Debugf("Functions removed: %s", strings.Join(removed, ", "))
+			for _, listener := range c.functionListeners {
+				listener.FunctionsRemoved(removed)
+			}
+		}
+	}
+
+	return mapping, crawlErr
+}
+
+// fallbackNamespaces are crawled if listing the namespaces failed, so that a blip does not empty the topic map. These
+// are the namespaces listed last or, if they were never listed, the default namespace.
+func (c *Controller) fallbackNamespaces() []string {
+	if c.namespaces == nil {
+		return []string{""}
+	}
+	return c.namespaces
 }
 
-func (c *Controller) crawlFunctions(ctx context.Context, namespaces []string, builder TopicMapBuilder) {
+func describeNamespaces(namespaces []string) string {
+	described := make([]string, 0, len(namespaces))
 	for _, ns := range namespaces {
-		found, err := c.client.GetFunctions(ctx, ns)
-		if err != nil {
-			log.Printf("Received %s while fetching functions on namespace %s", err, ns)
-			found = []types.FunctionStatus{}
+		if len(ns) == 0 {
+			ns = "the default namespace"
+		}
+		described = append(described, ns)
+	}
+	if len(described) == 0 {
+		return "no namespaces"
+	}
+	return strings.Join(described, ", ")
+}
+
+// notifySubscriptionListeners reports the subscription changes since the previous refresh, unless this is the initial one
+func (c *Controller) notifySubscriptionListeners(mapping map[string][]Function) {
+	if len(c.subscriptionListeners) == 0 || c.previous == nil {
+		return
+	}
+
+	subscribed, unsubscribed := diffSubscriptions(c.previous, mapping)
+	if len(subscribed) == 0 && len(unsubscribed) == 0 {
+		return
+	}
+	for _, listener := range c.subscriptionListeners {
+		listener.SubscriptionsChanged(subscribed, unsubscribed)
+	}
+}
+
+// recordRefresh updates the stats and warns if the refresh took longer than the refresh interval, in which case
+// the next refresh starts right away. A refresh without crawl errors resets the cache age.
+func (c *Controller) recordRefresh(start time.Time, duration time.Duration, mapping map[string][]Function, crawlErr error) {
+	functions := map[string]struct{}{}
+	for _, subscribed := range mapping {
+		for _, fn := range subscribed {
+			functions[fn.String()] = struct{}{}
+		}
+	}
+
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+
+	c.stats.LastRefresh = start
+	c.stats.LastDuration = duration
+	c.stats.Topics = len(mapping)
+	c.stats.Functions = len(functions)
+	c.snapshot = mapping
+	if crawlErr == nil {
+		c.stats.LastSuccess = start
+	}
+	_ = c.checkStaleness(c.cacheAge())
+
+	if c.conf == nil || c.conf.TopicRefreshTime <= 0 || duration <= c.conf.TopicRefreshTime {
+		return
+	}
+
+	c.stats.Overruns++
+	c.metrics.IncRefreshOverruns()
+	log.Printf("WARNING: Refreshing the topic map took %s, which exceeds the refresh interval of %s. Consider raising TOPIC_MAP_REFRESH_TIME or CRAWL_CONCURRENCY", duration, c.conf.TopicRefreshTime)
+}
+
+// CacheAge returns the time since the last refresh without crawl errors, or since the creation of the controller
+// until the first one
+func (c *Controller) CacheAge() time.Duration {
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+
+	age := c.cacheAge()
+	c.metrics.SetCacheAge(age)
+	return age
+}
+
+// Ready returns an error once the cache age exceeds the max cache staleness, which is used as readiness probe
+func (c *Controller) Ready() error {
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+
+	return c.checkStaleness(c.cacheAge())
+}
+
+// cacheAge requires the stats lock to be held
+func (c *Controller) cacheAge() time.Duration {
+	since := c.stats.LastSuccess
+	if since.IsZero() {
+		since = c.created
+	}
+	return time.Since(since)
+}
+
+// checkStaleness updates the cache age gauge and returns an error if the age exceeds the max cache staleness. The
+// transitions are logged, it requires the stats lock to be held.
+func (c *Controller) checkStaleness(age time.Duration) error {
+	c.metrics.SetCacheAge(age)
+	if c.freshness != nil {
+		c.freshness.Update(!c.stats.LastSuccess.IsZero() && (c.conf.MaxCacheStaleness <= 0 || age <= c.conf.MaxCacheStaleness))
+	}
+	if c.conf == nil || c.conf.MaxCacheStaleness <= 0 {
+		return nil
+	}
+
+	if age <= c.conf.MaxCacheStaleness {
+		if c.stale {
+			log.Printf("Topic map was refreshed again, it is no longer stale")
+			c.stale = false
+		}
+		return nil
+	}
+
+	if !c.stale {
+		log.Printf("WARNING: Topic map was not refreshed successfully for %s, which exceeds MAX_CACHE_STALENESS of %s. Reporting not ready", age.Round(time.Second), c.conf.MaxCacheStaleness)
+		c.stale = true
+	}
+	return fmt.Errorf("topic map was not refreshed successfully for %s, which exceeds the max cache staleness of %s", age.Round(time.Second), c.conf.MaxCacheStaleness)
+}
+
+// appendStatic adds the static mappings, so that they are never evicted by a refresh. Static function refs
+// can be paused via the paused functions as well.
+func (c *Controller) appendStatic(builder TopicMapBuilder) {
+	for topic, functions := range c.static {
+		if _, replaced := c.settingsStatic[topic]; replaced {
+			continue
+		}
+		c.appendStaticTopic(builder, topic, functions)
+	}
+	for topic, functions := range c.settingsStatic {
+		c.appendStaticTopic(builder, topic, functions)
+	}
+}
+
+func (c *Controller) appendStaticTopic(builder TopicMapBuilder, topic string, functions []Function) {
+	for _, fn := range functions {
+		if len(fn.URL) == 0 {
+			fn.Paused = c.isPaused(types.FunctionStatus{Name: fn.Name}, fn.Namespace)
 		}
+		builder.Append(topic, fn)
+	}
+}
+
+// crawlFunctions appends the functions of all namespaces and returns their pattern subscriptions alongside the first
+// failure of a namespace. Pattern subscriptions are not subject to the removal grace, as they have no topic. The
+// functions with an available replica are recorded in ready, the namespaces that failed in failed.
+func (c *Controller) crawlFunctions(ctx context.Context, namespaces []string, builder TopicMapBuilder, ready map[string]bool, failed map[string]bool) ([]topicPattern, error) {
+	workers := c.crawlConcurrency()
+	if workers > len(namespaces) {
+		workers = len(namespaces)
+	}
 
-		for _, fn := range found {
-			topics := c.extractTopicsFromAnnotations(fn)
+	pending := make(chan string, len(namespaces))
+	for _, ns := range namespaces {
+		pending <- ns
+	}
+	close(pending)
+
+	var wg sync.WaitGroup
+	var errLock sync.Mutex
+	var crawlErr error
+	var patterns []topicPattern
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ns := range pending {
+				entries, err := c.crawlNamespace(ctx, ns)
+				if err != nil {
+					errLock.Lock()
+					if crawlErr == nil {
+						crawlErr = err
+					}
+					failed[ns] = true
+					errLock.Unlock()
+				}
 
-			for _, topic := range topics {
-				if len(ns) > 0 {
-					builder.Append(topic, fmt.Sprintf("%s.%s", fn.Name, ns)) // Include Namespace to call the correct function
-				} else {
-					builder.Append(topic, fn.Name)
+				for _, entry := range entries {
+					fn := entry.function
+					if entry.ready {
+						errLock.Lock()
+						ready[fn.String()] = true
+						errLock.Unlock()
+					}
+					if entry.pattern != nil {
+						errLock.Lock()
+						patterns = append(patterns, topicPattern{expr: entry.pattern, function: fn})
+						errLock.Unlock()
+						continue
+					}
+					if c.removal != nil {
+						var admitted bool
+						if fn, admitted = c.removal.Admit(entry.topic, fn, entry.ready); !admitted {
+							continue
+						}
+					}
+					builder.Append(entry.topic, fn)
 				}
 			}
+		}()
+	}
+
+	wg.Wait()
+	return patterns, crawlErr
+}
+
+// crawledEntry subscribes the function either to the topic or to the topics matching the pattern
+type crawledEntry struct {
+	topic    string
+	pattern  *regexp.Regexp
+	function Function
+	ready    bool
+}
+
+// crawlNamespace fetches the functions of a single namespace, errors are logged so that other namespaces are still crawled
+func (c *Controller) crawlNamespace(ctx context.Context, ns string) ([]crawledEntry, error) {
+	found, err := c.fetchFunctions(ctx, ns)
+	if err != nil {
+		kind := ErrorKind(err)
+		log.Printf("Received %s while fetching functions on namespace %s [kind=%s]", err, ns, kind)
+		c.metrics.IncCrawlErrors(ns, kind)
+		return nil, err
+	}
+
+	entries := []crawledEntry{}
+	for _, fn := range found {
+		if !c.selected(fn) {
+			continue
+		}
+		fn = c.overrides.Filter(fn, ns)
+
+		topics := c.collectTopics(fn, ns)
+		timeout := extractTimeoutFromAnnotations(fn)
+		method := extractMethodFromAnnotations(fn)
+		maxInFlight := extractMaxInFlightFromAnnotations(fn)
+		weight := extractWeightFromAnnotations(fn)
+		deliveryMode := extractDeliveryModeFromAnnotations(fn)
+		encoding := extractEncodingFromAnnotations(fn)
+		schemaRef := c.extractSchemaFromAnnotations(fn)
+		warmup := extractWarmupFromAnnotations(fn)
+		paused := c.isPaused(fn, ns)
+		ready := fn.AvailableReplicas > 0
+		var target string
+		if c.resolver != nil {
+			target = c.resolver.Resolve(fn, ns)
 		}
+
+		// Namespace is kept separately, the client decides how it is addressed during invocation
+		function := Function{Name: fn.Name, Namespace: ns, Timeout: timeout, Method: method, MaxInFlight: maxInFlight, Weight: weight, DeliveryMode: deliveryMode, Encoding: encoding, Schema: schemaRef, Warmup: warmup, Paused: paused, Target: target}
+		for _, topic := range topics {
+			entries = append(entries, crawledEntry{topic: topic, function: function, ready: ready})
+		}
+		if pattern := c.patterns.Compile(fn); pattern != nil {
+			entries = append(entries, crawledEntry{pattern: pattern, function: function, ready: ready})
+		}
+	}
+
+	return entries, nil
+}
+
+// fetchFunctions crawls the functions of the namespace, unless the crawl schedule reuses the ones of the previous crawl
+func (c *Controller) fetchFunctions(ctx context.Context, ns string) ([]types.FunctionStatus, error) {
+	if c.schedule == nil {
+		return c.client.GetFunctions(ctx, ns)
+	}
+
+	if found, cached := c.schedule.Cached(ns); cached {
+		return found, nil
+	}
+
+	found, err := c.client.GetFunctions(ctx, ns)
+	if err != nil {
+		return nil, err
+	}
+	c.schedule.Crawled(ns, found)
+	logging.Debugf("Crawled namespace %s, will crawl it again in %s", ns, c.schedule.Interval(ns))
+	return found, nil
+}
+
+// selected reports whether the labels of the function match the FunctionLabelSelector. The gateway does not filter
+// functions by label, hence the non-matching ones are dropped after they were crawled.
+func (c *Controller) selected(fn types.FunctionStatus) bool {
+	if c.conf == nil || c.conf.FunctionLabelSelector.Empty() {
+		return true
+	}
+
+	var labels map[string]string
+	if fn.Labels != nil {
+		labels = *fn.Labels
 	}
+	return c.conf.FunctionLabelSelector.Matches(labels)
 }
 
-func (c *Controller) extractTopicsFromAnnotations(fn types.FunctionStatus) []string {
+func (c *Controller) crawlConcurrency() int {
+	if c.conf == nil || c.conf.CrawlConcurrency < 1 {
+		return 1
+	}
+	return c.conf.CrawlConcurrency
+}
+
+func (c *Controller) collectTopics(fn types.FunctionStatus, namespace string) []string {
+	if len(c.sources) == 1 {
+		return c.sources[0].Topics(fn, namespace)
+	}
+
 	topics := []string{}
+	seen := map[string]bool{}
 
-	if fn.Annotations != nil {
-		annotations := *fn.Annotations
-		if topicNames, exist := annotations["topic"]; exist {
-			topics = strings.Split(topicNames, ",")
+	for _, source := range c.sources {
+		for _, topic := range source.Topics(fn, namespace) {
+			if !seen[topic] {
+				seen[topic] = true
+				topics = append(topics, topic)
+			}
 		}
 	}
 
 	return topics
 }
+
+// extractTimeoutFromAnnotations reads the invoke timeout of a function, returning zero if it is absent or unparseable
+func extractTimeoutFromAnnotations(fn types.FunctionStatus) time.Duration {
+	if fn.Annotations == nil {
+		return 0
+	}
+
+	annotations := *fn.Annotations
+	for _, key := range []string{TimeoutAnnotation, "invoke-timeout"} {
+		value, exist := annotations[key]
+		if !exist {
+			continue
+		}
+
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			log.Printf("Function %s has the invalid timeout %s, will use the global invoke timeout", fn.Name, value)
+			return 0
+		}
+		return timeout
+	}
+
+	return 0
+}
+
+// extractMethodFromAnnotations reads the invoke method of a function, returning empty for absent or not allowed methods
+func extractMethodFromAnnotations(fn types.FunctionStatus) string {
+	if fn.Annotations == nil {
+		return ""
+	}
+
+	value, exist := (*fn.Annotations)[MethodAnnotation]
+	if !exist {
+		return ""
+	}
+
+	method, err := ParseInvokeMethod(value)
+	if err != nil {
+		log.Printf("Function %s has the invalid %s annotation (%s), will use POST", fn.Name, MethodAnnotation, err)
+		return ""
+	}
+	return method
+}
+
+// extractMaxInFlightFromAnnotations reads the max in-flight annotation, invalid values fall back to the global default
+func extractMaxInFlightFromAnnotations(fn types.FunctionStatus) int {
+	if fn.Annotations == nil {
+		return 0
+	}
+
+	value, exist := (*fn.Annotations)[MaxInFlightAnnotation]
+	if !exist {
+		return 0
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		log.Printf("Function %s has the invalid %s annotation %s, will use the global default", fn.Name, MaxInFlightAnnotation, value)
+		return 0
+	}
+	return limit
+}
+
+// extractWeightFromAnnotations reads the weight annotation, invalid values fall back to the weight of 1
+func extractWeightFromAnnotations(fn types.FunctionStatus) int {
+	if fn.Annotations == nil {
+		return 0
+	}
+
+	value, exist := (*fn.Annotations)[WeightAnnotation]
+	if !exist {
+		return 0
+	}
+
+	weight, err := strconv.Atoi(value)
+	if err != nil || weight <= 0 {
+		log.Printf("Function %s has the invalid %s annotation %s, will use the weight of 1", fn.Name, WeightAnnotation, value)
+		return 0
+	}
+	return weight
+}
+
+// extractDeliveryModeFromAnnotations reads the delivery mode annotation, returning empty if it is absent or invalid
+func extractDeliveryModeFromAnnotations(fn types.FunctionStatus) DeliveryMode {
+	if fn.Annotations == nil {
+		return ""
+	}
+
+	value, exist := (*fn.Annotations)[DeliveryModeAnnotation]
+	if !exist {
+		return ""
+	}
+
+	mode, err := ParseDeliveryMode(value)
+	if err != nil {
+		log.Printf("Function %s has the invalid %s annotation (%s), will not request a delivery mode", fn.Name, DeliveryModeAnnotation, err)
+		return ""
+	}
+	return mode
+}
+
+// extractEncodingFromAnnotations reads the encoding annotation, invalid values fall back to passing the message through
+func extractEncodingFromAnnotations(fn types.FunctionStatus) InvokeEncoding {
+	if fn.Annotations == nil {
+		return ""
+	}
+
+	value, exist := (*fn.Annotations)[EncodingAnnotation]
+	if !exist {
+		return ""
+	}
+
+	encoding, err := ParseInvokeEncoding(value)
+	if err != nil {
+		log.Printf("Function %s has the invalid %s annotation (%s), will pass the message through", fn.Name, EncodingAnnotation, err)
+		return ""
+	}
+	if encoding == EncodingRaw {
+		return ""
+	}
+	return encoding
+}
+
+// isPaused checks the paused annotation and the configured paused functions, which may be listed as name or name.namespace
+func (c *Controller) isPaused(fn types.FunctionStatus, namespace string) bool {
+	if fn.Annotations != nil {
+		if paused, err := strconv.ParseBool((*fn.Annotations)[PausedAnnotation]); err == nil && paused {
+			return true
+		}
+	}
+
+	if c.conf == nil {
+		return false
+	}
+
+	qualified := Function{Name: fn.Name, Namespace: namespace}.String()
+	for _, candidate := range c.conf.PausedFunctions {
+		if candidate == fn.Name || candidate == qualified {
+			return true
+		}
+	}
+
+	return false
+}
@@ -6,18 +6,38 @@
 package openfaas
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
 
+	"github.com/Templum/rabbitmq-connector/pkg/backoff"
 	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/Templum/rabbitmq-connector/pkg/labels"
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+	"github.com/openfaas/faas-provider/auth"
 	"github.com/openfaas/faas-provider/types"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type MockTopicMap struct {
@@ -32,12 +52,16 @@ func (s *MockTopicMap) CalledNTimes() int {
 	return s.refreshCalls
 }
 
-func (s *MockTopicMap) GetCachedValues(name string) []string {
+func (s *MockTopicMap) GetCachedValues(name string) []Function {
 	args := s.Called(name)
-	return args.Get(0).([]string)
+	return args.Get(0).([]Function)
 }
 
-func (s *MockTopicMap) Refresh(update map[string][]string) {
+func (s *MockTopicMap) GetDeliveryMode(_ string) DeliveryMode {
+	return FailFast
+}
+
+func (s *MockTopicMap) Refresh(update map[string][]Function) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
@@ -48,13 +72,13 @@ type MockOpenFaaSClient struct {
 	mock.Mock
 }
 
-func (m *MockOpenFaaSClient) InvokeAsync(ctx context.Context, name string, invocation *types2.OpenFaaSInvocation) (bool, error) {
-	args := m.Called(ctx, name, invocation)
+func (m *MockOpenFaaSClient) InvokeAsync(ctx context.Context, fn Function, invocation *types2.OpenFaaSInvocation) (bool, error) {
+	args := m.Called(ctx, fn, invocation)
 	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockOpenFaaSClient) InvokeSync(ctx context.Context, name string, invocation *types2.OpenFaaSInvocation) ([]byte, error) {
-	args := m.Called(ctx, name, invocation)
+func (m *MockOpenFaaSClient) InvokeSync(ctx context.Context, fn Function, invocation *types2.OpenFaaSInvocation) ([]byte, error) {
+	args := m.Called(ctx, fn, invocation)
 	return args.Get(0).([]byte), args.Error(1)
 }
 
@@ -230,6 +254,7 @@ func TestCacher_Start_WithFailures(t *testing.T) {
 		clientMock := new(MockOpenFaaSClient)
 		clientMock.On("HasNamespaceSupport", mock.Anything).Return(true, nil)
 		clientMock.On("GetNamespaces", mock.Anything).Return([]string{}, errors.New("Swallow me"))
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{}, nil)
 		cacheMock := new(MockTopicMap)
 
 		cacher := NewController(conf, clientMock, cacheMock)
@@ -257,48 +282,1719 @@ func TestCacher_Start_WithFailures(t *testing.T) {
 	})
 }
 
-func TestCacher_Invoke(t *testing.T) {
-	cacheMock := new(MockTopicMap)
-	cacheMock.On("GetCachedValues", "Security").Return([]string{})
-	cacheMock.On("GetCachedValues", "Billing").Return([]string{"billing", "secret", "transport"})
+func TestCacher_InitialRefreshRetry(t *testing.T) {
+	annotations := map[string]string{"topic": "billing"}
 
-	const TOPIC = "Billing"
+	t.Run("Should retry a failed initial refresh using the refresh backoff", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("HasNamespaceSupport", mock.Anything).Return(false, nil)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{}, newStatusError(http.StatusBadGateway)).Once()
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
 
-	t.Run("Should invoke all functions for specified Topic", func(t *testing.T) {
+		conf := &config.Controller{
+			TopicRefreshTime: time.Hour,
+			RefreshBackoff:   backoff.Config{Base: 10 * time.Millisecond, Max: 10 * time.Millisecond, Multiplier: 2},
+		}
+		cache := NewTopicFunctionCache()
+		target := NewController(conf, clientMock, cache)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		target.Start(ctx)
+		assert.Empty(t, cache.GetCachedValues("billing"), "Expected the initial refresh to fail")
+		assert.Eventually(t, func() bool {
+			return len(cache.GetCachedValues("billing")) == 1
+		}, time.Second, 5*time.Millisecond, "Expected the retry to populate the topic map before the next refresh tick")
+	})
+
+	t.Run("Should leave it to the regular refresh once the backoff reaches the refresh interval", func(t *testing.T) {
 		clientMock := new(MockOpenFaaSClient)
-		clientMock.On("InvokeSync", mock.Anything, mock.Anything, mock.Anything).Return([]byte{}, nil)
+		clientMock.On("HasNamespaceSupport", mock.Anything).Return(false, nil)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{}, newStatusError(http.StatusBadGateway))
 
-		cacher := NewController(nil, clientMock, cacheMock)
+		conf := &config.Controller{
+			TopicRefreshTime: 20 * time.Millisecond,
+			RefreshBackoff:   backoff.Config{Base: 5 * time.Millisecond, Max: time.Second, Multiplier: 2},
+		}
+		target := NewController(conf, clientMock, NewTopicFunctionCache())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		target.retryInitialRefresh(ctx, false)
+		clientMock.AssertNumberOfCalls(t, "GetFunctions", 2)
+	})
+}
 
-		err := cacher.Invoke(TOPIC, nil)
+func TestCacher_NamespaceFailures(t *testing.T) {
+	annotations := map[string]string{"topic": "billing"}
+	newClient := func(namespaces []string, err error) *MockOpenFaaSClient {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetNamespaces", mock.Anything).Return(namespaces, err)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+		clientMock.On("GetFunctions", "faas").Return([]types.FunctionStatus{{Name: "invoicer", Annotations: &annotations}}, nil)
+		return clientMock
+	}
 
+	t.Run("Should crawl the namespaces listed last if listing them fails", func(t *testing.T) {
+		cache := NewTopicFunctionCache()
+		target := NewController(nil, newClient([]string{"faas"}, nil), cache)
+		_, err := target.refreshTick(context.Background(), true)
 		assert.NoError(t, err, "should not throw")
-		clientMock.AssertNumberOfCalls(t, "InvokeSync", 3)
-		clientMock.AssertExpectations(t)
+
+		target.client = newClient([]string{}, errors.New("expected"))
+		_, err = target.refreshTick(context.Background(), true)
+
+		assert.Error(t, err, "should report the failure")
+		assert.Equal(t, []Function{{Name: "invoicer", Namespace: "faas"}}, cache.GetCachedValues("billing"), "Expected the cache to not be emptied")
 	})
 
-	t.Run("Should abort invocation of functions on receiving first error further returning it", func(t *testing.T) {
+	t.Run("Should crawl the default namespace if listing the namespaces never succeeded", func(t *testing.T) {
+		cache := NewTopicFunctionCache()
+		target := NewController(nil, newClient([]string{}, errors.New("expected")), cache)
+
+		_, err := target.refreshTick(context.Background(), true)
+
+		assert.Error(t, err, "should report the failure")
+		assert.Equal(t, []Function{{Name: "biller"}}, cache.GetCachedValues("billing"), "Expected the cache to not be empty")
+	})
+}
+
+// namespaceCrawlerStub serves one function per namespace and tracks how many namespaces are crawled at the same time
+type namespaceCrawlerStub struct {
+	fakeCrawler
+	namespaces []string
+	failing    string
+	// perNamespaceTopic subscribes the function of every namespace to a topic named after the namespace
+	perNamespaceTopic bool
+
+	lock    sync.Mutex
+	active  int
+	maximum int
+}
+
+func (n *namespaceCrawlerStub) HasNamespaceSupport(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func (n *namespaceCrawlerStub) GetNamespaces(ctx context.Context) ([]string, error) {
+	return n.namespaces, nil
+}
+
+func (n *namespaceCrawlerStub) GetFunctions(ctx context.Context, namespace string) ([]types.FunctionStatus, error) {
+	n.lock.Lock()
+	n.active++
+	if n.active > n.maximum {
+		n.maximum = n.active
+	}
+	n.lock.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	n.lock.Lock()
+	n.active--
+	n.lock.Unlock()
+
+	if namespace == n.failing {
+		return nil, errors.New("expected")
+	}
+
+	annotations := map[string]string{"topic": "billing"}
+	if n.perNamespaceTopic {
+		annotations["topic"] = namespace
+	}
+	return []types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil
+}
+
+func newNamespaceCrawlerStub(count int, failing string) *namespaceCrawlerStub {
+	namespaces := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		namespaces = append(namespaces, fmt.Sprintf("namespace-%d", i))
+	}
+	return &namespaceCrawlerStub{namespaces: namespaces, failing: failing}
+}
+
+func TestCacher_CrawlConcurrency(t *testing.T) {
+	t.Run("Should crawl namespaces in parallel up to the configured concurrency", func(t *testing.T) {
+		crawler := newNamespaceCrawlerStub(20, "")
+		cache := NewTopicFunctionCache()
+
+		target := NewController(&config.Controller{CrawlConcurrency: 4}, crawler, cache)
+		target.refreshTick(context.Background(), true)
+
+		assert.Equal(t, 4, crawler.maximum, "Expected crawling to be bound by the concurrency")
+		assert.Len(t, cache.GetCachedValues("billing"), 20, "Expected functions of all namespaces")
+	})
+
+	t.Run("Should crawl sequential without a configured concurrency", func(t *testing.T) {
+		crawler := newNamespaceCrawlerStub(5, "")
+		cache := NewTopicFunctionCache()
+
+		target := NewController(&config.Controller{}, crawler, cache)
+		target.refreshTick(context.Background(), true)
+
+		assert.Equal(t, 1, crawler.maximum, "Expected a single namespace at a time")
+		assert.Len(t, cache.GetCachedValues("billing"), 5, "Expected functions of all namespaces")
+	})
+
+	t.Run("Should keep functions of other namespaces if one fails", func(t *testing.T) {
+		crawler := newNamespaceCrawlerStub(10, "namespace-3")
+		cache := NewTopicFunctionCache()
+
+		target := NewController(&config.Controller{CrawlConcurrency: 3}, crawler, cache)
+		target.refreshTick(context.Background(), true)
+
+		functions := cache.GetCachedValues("billing")
+		assert.Len(t, functions, 9, "Expected functions of all healthy namespaces")
+		assert.NotContains(t, functions, Function{Name: "biller", Namespace: "namespace-3"})
+	})
+}
+
+func TestCacher_RefreshOverrun(t *testing.T) {
+	t.Run("Should count refreshes that exceed the refresh interval", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.RefreshOverruns)
+
+		// Every namespace takes 20ms to crawl
+		target := NewController(&config.Controller{TopicRefreshTime: 5 * time.Millisecond}, newNamespaceCrawlerStub(1, ""), NewTopicFunctionCache())
+		target.refreshTick(context.Background(), true)
+
+		stats := target.RefreshStats()
+		assert.Equal(t, 1, stats.Overruns)
+		assert.GreaterOrEqual(t, stats.LastDuration, 20*time.Millisecond)
+		assert.False(t, stats.LastRefresh.IsZero(), "Expected the refresh to be recorded")
+		assert.Equal(t, before+1, testutil.ToFloat64(metrics.RefreshOverruns))
+	})
+
+	t.Run("Should not count refreshes within the refresh interval", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.RefreshOverruns)
+
+		target := NewController(&config.Controller{TopicRefreshTime: time.Minute}, newNamespaceCrawlerStub(1, ""), NewTopicFunctionCache())
+		target.refreshTick(context.Background(), true)
+
+		assert.Equal(t, 0, target.RefreshStats().Overruns)
+		assert.Equal(t, before, testutil.ToFloat64(metrics.RefreshOverruns))
+	})
+
+	t.Run("Should record the size of the topic map", func(t *testing.T) {
+		annotations := map[string]string{"topic": "billing,invoice"}
 		clientMock := new(MockOpenFaaSClient)
-		clientMock.On("InvokeSync", mock.Anything, mock.Anything, mock.Anything).Return([]byte{}, errors.New("failed"))
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}, {Name: "invoicer", Annotations: &annotations}}, nil)
 
-		cacher := NewController(nil, clientMock, cacheMock)
+		target := NewController(&config.Controller{}, clientMock, NewTopicFunctionCache())
+		target.refreshTick(context.Background(), false)
+
+		assert.Equal(t, 2, target.RefreshStats().Topics)
+		assert.Equal(t, 2, target.RefreshStats().Functions, "Expected functions to be counted once")
+	})
+}
 
-		err := cacher.Invoke(TOPIC, nil)
+func TestCacher_CacheAge(t *testing.T) {
+	annotations := map[string]string{"topic": "billing"}
+	healthy := new(MockOpenFaaSClient)
+	healthy.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+	broken := new(MockOpenFaaSClient)
+	broken.On("GetFunctions", "").Return([]types.FunctionStatus{}, newStatusError(http.StatusBadGateway))
 
-		assert.Error(t, err, "failed")
-		clientMock.AssertNumberOfCalls(t, "InvokeSync", 1)
-		clientMock.AssertExpectations(t)
+	t.Run("Should reset the cache age on a successful refresh", func(t *testing.T) {
+		target := NewController(&config.Controller{}, healthy, NewTopicFunctionCache())
+		target.created = time.Now().Add(-time.Hour)
+		assert.GreaterOrEqual(t, target.CacheAge(), time.Hour, "Expected the age to be measured from the creation")
+		assert.GreaterOrEqual(t, testutil.ToFloat64(metrics.CacheAge), time.Hour.Seconds())
+
+		target.refreshTick(context.Background(), false)
+
+		assert.Less(t, target.CacheAge(), time.Minute)
+		assert.Less(t, testutil.ToFloat64(metrics.CacheAge), time.Minute.Seconds())
+		assert.False(t, target.RefreshStats().LastSuccess.IsZero(), "Expected the successful refresh to be recorded")
 	})
 
-	t.Run("Should not invoke if there is no function for specified Topic", func(t *testing.T) {
+	t.Run("Should keep aging while refreshes fail", func(t *testing.T) {
+		sink := &recordingSink{}
+		target := NewController(&config.Controller{}, broken, NewTopicFunctionCache()).WithMetrics(sink)
+		target.created = time.Now().Add(-time.Hour)
+
+		target.refreshTick(context.Background(), false)
+
+		assert.GreaterOrEqual(t, target.CacheAge(), time.Hour)
+		assert.GreaterOrEqual(t, sink.cacheAge, time.Hour, "Expected the gauge to be updated on refresh")
+		assert.True(t, target.RefreshStats().LastSuccess.IsZero())
+	})
+
+	t.Run("Should not be ready once the max cache staleness is exceeded", func(t *testing.T) {
+		target := NewController(&config.Controller{MaxCacheStaleness: 10 * time.Minute}, broken, NewTopicFunctionCache())
+		assert.NoError(t, target.Ready(), "Expected a fresh controller to be ready")
+
+		target.created = time.Now().Add(-time.Hour)
+		target.refreshTick(context.Background(), false)
+		assert.Error(t, target.Ready(), "should throw")
+
+		target.client = healthy
+		target.refreshTick(context.Background(), false)
+		assert.NoError(t, target.Ready(), "Expected to be ready once refreshed")
+	})
+
+	t.Run("Should always be ready without max cache staleness", func(t *testing.T) {
+		target := NewController(&config.Controller{}, broken, NewTopicFunctionCache())
+		target.created = time.Now().Add(-time.Hour)
+
+		assert.NoError(t, target.Ready(), "should not throw")
+	})
+}
+
+func TestCacher_PauseWhileStale(t *testing.T) {
+	annotations := map[string]string{"topic": "billing"}
+	healthy := new(MockOpenFaaSClient)
+	healthy.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+	broken := new(MockOpenFaaSClient)
+	broken.On("GetFunctions", "").Return([]types.FunctionStatus{}, newStatusError(http.StatusBadGateway))
+
+	// awaiting reports once AwaitCapacity returned, which is the point a delivery is dispatched
+	awaiting := func(target *Controller) chan struct{} {
+		dispatched := make(chan struct{})
+		go func() {
+			target.AwaitCapacity()
+			close(dispatched)
+		}()
+		return dispatched
+	}
+
+	t.Run("Should not dispatch until the first refresh succeeded", func(t *testing.T) {
+		target := NewController(&config.Controller{PauseWhileStale: true}, broken, NewTopicFunctionCache())
+		target.refreshTick(context.Background(), false)
+
+		dispatched := awaiting(target)
+		select {
+		case <-dispatched:
+			assert.Fail(t, "Expected no dispatch while the cache is cold")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		target.client = healthy
+		target.refreshTick(context.Background(), false)
+
+		select {
+		case <-dispatched:
+		case <-time.After(time.Second):
+			assert.Fail(t, "Expected the dispatch to resume after the first successful refresh")
+		}
+	})
+
+	t.Run("Should pause dispatch while the max cache staleness is exceeded", func(t *testing.T) {
+		target := NewController(&config.Controller{PauseWhileStale: true, MaxCacheStaleness: 10 * time.Minute}, healthy, NewTopicFunctionCache())
+		target.refreshTick(context.Background(), false)
+		<-awaiting(target)
+
+		target.statsLock.Lock()
+		target.stats.LastSuccess = time.Now().Add(-time.Hour)
+		target.statsLock.Unlock()
+		target.client = broken
+		target.refreshTick(context.Background(), false)
+
+		dispatched := awaiting(target)
+		select {
+		case <-dispatched:
+			assert.Fail(t, "Expected no dispatch while the cache is stale")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		target.client = healthy
+		target.refreshTick(context.Background(), false)
+		<-dispatched
+	})
+
+	t.Run("Should dispatch on a cold cache without pause while stale", func(t *testing.T) {
+		target := NewController(&config.Controller{}, broken, NewTopicFunctionCache())
+		target.refreshTick(context.Background(), false)
+
+		<-awaiting(target)
+	})
+}
+
+type topicSourceStub struct {
+	topics    map[string][]string
+	refreshed int
+}
+
+func (s *topicSourceStub) Refresh() {
+	s.refreshed++
+}
+
+func (s *topicSourceStub) Topics(fn types.FunctionStatus, _ string) []string {
+	return s.topics[fn.Name]
+}
+
+func TestCacher_TopicSources(t *testing.T) {
+	annotations := map[string]string{"topic": "billing"}
+	functions := []types.FunctionStatus{
+		{Name: "biller", Annotations: &annotations},
+		{Name: "wrencher"},
+	}
+
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetFunctions", mock.Anything).Return(functions, nil)
+
+	t.Run("Should merge topics of additional sources with annotation derived ones", func(t *testing.T) {
+		source := &topicSourceStub{topics: map[string][]string{
+			"biller":   {"billing", "invoice"},
+			"wrencher": {"transport"},
+		}}
+
+		cache := NewTopicFunctionCache()
+		target := NewController(&config.Controller{}, clientMock, cache).WithTopicSources(source)
+		target.refreshTick(context.Background(), false)
+
+		assert.Equal(t, 1, source.refreshed, "Expected source to be refreshed once per crawl")
+		assert.Equal(t, []Function{{Name: "biller"}}, cache.GetCachedValues("billing"), "Expected no duplicates")
+		assert.Equal(t, []Function{{Name: "biller"}}, cache.GetCachedValues("invoice"))
+		assert.Equal(t, []Function{{Name: "wrencher"}}, cache.GetCachedValues("transport"))
+	})
+}
+
+type topicListenerStub struct {
+	added   [][]string
+	removed [][]string
+}
+
+func (l *topicListenerStub) TopicsChanged(added []string, removed []string) {
+	l.added = append(l.added, added)
+	l.removed = append(l.removed, removed)
+}
+
+func TestCacher_TopicListeners(t *testing.T) {
+	functions := []types.FunctionStatus{{Name: "biller"}}
+
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetFunctions", mock.Anything).Return(functions, nil)
+
+	t.Run("Should notify listeners only about changed topics", func(t *testing.T) {
+		source := &topicSourceStub{topics: map[string][]string{"biller": {"billing", "invoice"}}}
+		listener := &topicListenerStub{}
+
+		target := NewController(&config.Controller{}, clientMock, NewTopicFunctionCache()).
+			WithTopicSources(source).
+			WithTopicListeners(listener)
+
+		target.refreshTick(context.Background(), false)
+		target.refreshTick(context.Background(), false)
+		source.topics["biller"] = []string{"billing", "transport"}
+		target.refreshTick(context.Background(), false)
+
+		assert.Equal(t, [][]string{{"billing", "invoice"}, {"transport"}}, listener.added)
+		assert.Equal(t, [][]string{nil, {"invoice"}}, listener.removed)
+	})
+}
+
+type subscriptionListenerStub struct {
+	subscribed   [][]Subscription
+	unsubscribed [][]Subscription
+}
+
+func (l *subscriptionListenerStub) SubscriptionsChanged(subscribed []Subscription, unsubscribed []Subscription) {
+	l.subscribed = append(l.subscribed, subscribed)
+	l.unsubscribed = append(l.unsubscribed, unsubscribed)
+}
+
+func TestCacher_SubscriptionListeners(t *testing.T) {
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetFunctions", mock.Anything).Return([]types.FunctionStatus{{Name: "biller"}, {Name: "wrencher"}}, nil)
+
+	t.Run("Should notify listeners about changed subscriptions after the initial refresh", func(t *testing.T) {
+		source := &topicSourceStub{topics: map[string][]string{"biller": {"billing"}, "wrencher": {"transport"}}}
+		listener := &subscriptionListenerStub{}
+
+		target := NewController(&config.Controller{}, clientMock, NewTopicFunctionCache()).
+			WithTopicSources(source).
+			WithSubscriptionListeners(listener)
+
+		target.refreshTick(context.Background(), false)
+		target.refreshTick(context.Background(), false)
+		assert.Empty(t, listener.subscribed, "Expected neither the initial nor an unchanged refresh to be reported")
+
+		source.topics["biller"] = []string{"billing", "invoice"}
+		source.topics["wrencher"] = []string{}
+		target.refreshTick(context.Background(), false)
+
+		assert.Equal(t, [][]Subscription{{{Topic: "invoice", Function: "biller"}}}, listener.subscribed)
+		assert.Equal(t, [][]Subscription{{{Topic: "transport", Function: "wrencher"}}}, listener.unsubscribed)
+	})
+}
+
+type functionListenerStub struct {
+	removed [][]string
+}
+
+func (l *functionListenerStub) FunctionsRemoved(removed []string) {
+	l.removed = append(l.removed, removed)
+}
+
+func TestCacher_FunctionListeners(t *testing.T) {
+	billing := map[string]string{"topic": "billing,invoice"}
+	transport := map[string]string{"topic": "transport"}
+	// newClient lists the namespaces of the functions, crawling the failing namespace fails
+	newClient := func(functions map[string][]types.FunctionStatus, failing string) *MockOpenFaaSClient {
 		clientMock := new(MockOpenFaaSClient)
-		clientMock.On("InvokeSync", mock.Anything, mock.Anything, mock.Anything).Return([]byte{}, nil)
+		namespaces := []string{}
+		for ns, found := range functions {
+			namespaces = append(namespaces, ns)
+			if ns == failing {
+				clientMock.On("GetFunctions", ns).Return([]types.FunctionStatus{}, errors.New("expected"))
+			} else {
+				clientMock.On("GetFunctions", ns).Return(found, nil)
+			}
+		}
+		sort.Strings(namespaces)
+		clientMock.On("GetNamespaces", mock.Anything).Return(namespaces, nil)
+		return clientMock
+	}
 
-		cacher := NewController(nil, clientMock, cacheMock)
+	t.Run("Should report a removed function exactly once", func(t *testing.T) {
+		listener := &functionListenerStub{}
+		target := NewController(&config.Controller{}, newClient(map[string][]types.FunctionStatus{"faas": {
+			{Name: "biller", Annotations: &billing},
+			{Name: "wrencher", Annotations: &transport},
+		}}, ""), NewTopicFunctionCache()).
+			WithFunctionListeners(listener)
+
+		target.refreshTick(context.Background(), true)
+		assert.Empty(t, listener.removed, "Expected the initial refresh not to be reported")
+
+		target.client = newClient(map[string][]types.FunctionStatus{"faas": {{Name: "wrencher", Annotations: &transport}}}, "")
+		target.refreshTick(context.Background(), true)
+		target.refreshTick(context.Background(), true)
+		assert.Equal(t, [][]string{{"biller.faas"}}, listener.removed, "Expected the removal to be reported once, although subscribed to two topics")
+
+		target.client = newClient(map[string][]types.FunctionStatus{"faas": {}}, "")
+		target.refreshTick(context.Background(), true)
+		assert.Equal(t, [][]string{{"biller.faas"}, {"wrencher.faas"}}, listener.removed)
+	})
+
+	t.Run("Should not report the functions of a namespace that failed to be crawled", func(t *testing.T) {
+		functions := map[string][]types.FunctionStatus{
+			"faas":    {{Name: "biller", Annotations: &billing}},
+			"special": {{Name: "wrencher", Annotations: &transport}},
+		}
+		listener := &functionListenerStub{}
+		target := NewController(&config.Controller{}, newClient(functions, ""), NewTopicFunctionCache()).
+			WithFunctionListeners(listener)
+		target.refreshTick(context.Background(), true)
+
+		target.client = newClient(functions, "faas")
+		target.refreshTick(context.Background(), true)
+		assert.Empty(t, listener.removed, "Expected no removal while the namespace fails")
+
+		target.client = newClient(functions, "")
+		target.refreshTick(context.Background(), true)
+		assert.Empty(t, listener.removed, "Expected no removal once the function is crawled again")
+
+		target.client = newClient(map[string][]types.FunctionStatus{"special": functions["special"]}, "")
+		target.refreshTick(context.Background(), true)
+		assert.Equal(t, [][]string{{"biller.faas"}}, listener.removed, "Expected a removal once the namespace is gone")
+	})
+
+	t.Run("Should keep functions subscribed via topic-regex annotation", func(t *testing.T) {
+		listener := &functionListenerStub{}
+		target := NewController(&config.Controller{}, newClient(map[string][]types.FunctionStatus{"faas": {{Name: "auditor", Annotations: &billing}}}, ""), NewTopicFunctionCache()).
+			WithFunctionListeners(listener)
+		target.refreshTick(context.Background(), true)
+
+		target.client = newClient(map[string][]types.FunctionStatus{"faas": {{Name: "auditor", Annotations: &map[string]string{TopicRegexAnnotation: "^billing"}}}}, "")
+		target.refreshTick(context.Background(), true)
+
+		assert.Empty(t, listener.removed)
+	})
+}
+
+func TestCacher_PausedFunctions(t *testing.T) {
+	paused := map[string]string{"topic": "billing", PausedAnnotation: "true"}
+	active := map[string]string{"topic": "billing"}
+
+	t.Run("Should skip functions that are paused by annotation or config", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetFunctions", mock.Anything).Return([]types.FunctionStatus{
+			{Name: "annotated", Annotations: &paused},
+			{Name: "configured", Annotations: &active},
+			{Name: "active", Annotations: &active},
+		}, nil)
+
+		cache := NewTopicFunctionCache()
+		target := NewController(&config.Controller{PausedFunctions: []string{"configured"}}, clientMock, cache)
+		target.refreshTick(context.Background(), false)
+
+		assert.Equal(t, []Function{{Name: "active"}}, cache.GetCachedValues("billing"))
+	})
+
+	t.Run("Should match configured paused functions by name.namespace", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetNamespaces", mock.Anything).Return([]string{"faas", "special"}, nil)
+		clientMock.On("GetFunctions", mock.Anything).Return([]types.FunctionStatus{{Name: "biller", Annotations: &active}}, nil)
+
+		cache := NewTopicFunctionCache()
+		target := NewController(&config.Controller{PausedFunctions: []string{"biller.special"}}, clientMock, cache)
+		target.refreshTick(context.Background(), true)
+
+		assert.Equal(t, []Function{{Name: "biller", Namespace: "faas"}}, cache.GetCachedValues("billing"))
+	})
+
+	t.Run("Should include functions once they are unpaused on the next refresh", func(t *testing.T) {
+		annotations := map[string]string{"topic": "billing", PausedAnnotation: "true"}
+
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetFunctions", mock.Anything).Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+
+		cache := NewTopicFunctionCache()
+		target := NewController(&config.Controller{}, clientMock, cache)
+
+		target.refreshTick(context.Background(), false)
+		assert.Len(t, cache.GetCachedValues("billing"), 0, "Expected paused function to be skipped")
+
+		annotations[PausedAnnotation] = "false"
+		target.refreshTick(context.Background(), false)
+		assert.Equal(t, []Function{{Name: "biller"}}, cache.GetCachedValues("billing"))
+	})
+}
+
+func TestCacher_AutoPause(t *testing.T) {
+	failing := Function{Name: "failing"}
+	healthy := Function{Name: "healthy"}
+
+	t.Run("Should skip functions whose error ratio exceeds the threshold", func(t *testing.T) {
+		cacheMock := new(MockTopicMap)
+		cacheMock.On("GetCachedValues", "billing").Return([]Function{healthy, failing})
+
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("InvokeAsync", mock.Anything, healthy, mock.Anything).Return(true, nil)
+		clientMock.On("InvokeAsync", mock.Anything, failing, mock.Anything).Return(false, errors.New("failed"))
+
+		target := NewController(&config.Controller{AutoPauseErrorRatio: 0.5, AutoPauseWindow: time.Minute}, clientMock, cacheMock)
+		for i := 0; i < minHealthSamples; i++ {
+			_, _ = target.Invoke("billing", nil)
+		}
+
+		results, err := target.Invoke("billing", nil)
+		assert.NoError(t, err, "Expected failing function to be skipped")
+		assert.Len(t, results, 1)
+		assert.Equal(t, "healthy", results[0].Function)
+
+		clientMock.AssertNumberOfCalls(t, "InvokeAsync", 2*minHealthSamples+1)
+		assert.True(t, target.FunctionStats()[0].Paused, "Expected failing function to be reported as paused")
+	})
+}
+
+// concurrencyRecorder records the peak of concurrent invocations per function
+type concurrencyRecorder struct {
+	lock    sync.Mutex
+	current map[string]int
+	peak    map[string]int
+}
+
+func (r *concurrencyRecorder) InvokeSync(ctx context.Context, fn Function, invocation *types2.OpenFaaSInvocation) ([]byte, error) {
+	_, err := r.InvokeAsync(ctx, fn, invocation)
+	return nil, err
+}
 
-		err := cacher.Invoke("Security", nil)
+func (r *concurrencyRecorder) InvokeAsync(_ context.Context, fn Function, _ *types2.OpenFaaSInvocation) (bool, error) {
+	r.lock.Lock()
+	r.current[fn.Name]++
+	if r.current[fn.Name] > r.peak[fn.Name] {
+		r.peak[fn.Name] = r.current[fn.Name]
+	}
+	r.lock.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	r.lock.Lock()
+	r.current[fn.Name]--
+	r.lock.Unlock()
+	return true, nil
+}
+
+func TestCacher_MaxInFlight(t *testing.T) {
+	t.Run("Should read the max in-flight annotation", func(t *testing.T) {
+		annotations := map[string]string{"topic": "billing", MaxInFlightAnnotation: "2"}
+		invalid := map[string]string{"topic": "billing", MaxInFlightAnnotation: "many"}
+
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{
+			{Name: "biller", Annotations: &annotations},
+			{Name: "invoicer", Annotations: &invalid},
+		}, nil)
+
+		cache := NewTopicFunctionCache()
+		NewController(&config.Controller{}, clientMock, cache).refreshTick(context.Background(), false)
+
+		assert.ElementsMatch(t, []Function{{Name: "biller", MaxInFlight: 2}, {Name: "invoicer"}}, cache.GetCachedValues("billing"))
+	})
+
+	t.Run("Should never exceed the max in-flight invocations of a function", func(t *testing.T) {
+		recorder := &concurrencyRecorder{current: map[string]int{}, peak: map[string]int{}}
+		cache := NewTopicFunctionCache()
+		cache.Refresh(map[string][]Function{"billing": {{Name: "biller", MaxInFlight: 2}, {Name: "invoicer"}}})
+
+		target := NewController(&config.Controller{MaxInFlightPerFunction: 3, InvokeTimeout: time.Minute}, new(MockOpenFaaSClient), cache).WithInvoker(recorder)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing"})
+				assert.NoError(t, err, "should not throw")
+			}()
+		}
+		wg.Wait()
+
+		assert.LessOrEqual(t, recorder.peak["biller"], 2, "Expected the annotated limit to be respected")
+		assert.LessOrEqual(t, recorder.peak["invoicer"], 3, "Expected the global default to be respected")
+	})
+
+	t.Run("Should fail once the invoke timeout elapsed while waiting", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		cache := NewTopicFunctionCache()
+		cache.Refresh(map[string][]Function{"billing": {{Name: "biller", MaxInFlight: 1, Timeout: 10 * time.Millisecond}}})
+
+		target := NewController(&config.Controller{}, clientMock, cache)
+		release, _ := target.limiter.Acquire(context.Background(), Function{Name: "biller", MaxInFlight: 1, Timeout: 10 * time.Millisecond}, 1)
+		defer release()
+
+		results, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing"})
+
+		assert.Error(t, err, "should throw")
+		assert.Len(t, results, 1, "Expected the deferred invocation to be reported")
+		clientMock.AssertNotCalled(t, "InvokeAsync", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestCacher_TopicAliases(t *testing.T) {
+	shipper := Function{Name: "shipper", Namespace: "orders"}
+	legacy := Function{Name: "legacy"}
+
+	cache := NewTopicFunctionCache()
+	cache.Refresh(map[string][]Function{"orders": {shipper}, "v1.orders": {legacy}})
+	conf := &config.Controller{TopicAliases: map[string][]string{"v1.orders": {"orders"}}}
+
+	t.Run("Should invoke the subscribers of the canonical topic for aliased messages", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+		results, err := NewController(conf, clientMock, cache).Invoke("v1.orders", nil)
 
 		assert.NoError(t, err, "should not throw")
-		clientMock.AssertNotCalled(t, "InvokeSync")
+		assert.Len(t, results, 2, "Expected the functions of both topics to be invoked")
+		assert.Equal(t, "v1.orders", results[0].Topic)
+		clientMock.AssertCalled(t, "InvokeAsync", mock.Anything, legacy, mock.Anything)
+		clientMock.AssertCalled(t, "InvokeAsync", mock.Anything, shipper, mock.Anything)
+		clientMock.AssertNumberOfCalls(t, "InvokeAsync", 2)
+	})
+
+	t.Run("Should not apply aliases in reverse", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+		_, err := NewController(conf, clientMock, cache).Invoke("orders", nil)
+
+		assert.NoError(t, err, "should not throw")
+		clientMock.AssertCalled(t, "InvokeAsync", mock.Anything, shipper, mock.Anything)
+		clientMock.AssertNumberOfCalls(t, "InvokeAsync", 1)
+	})
+}
+
+func TestCacher_DeliveryMode(t *testing.T) {
+	failing := Function{Name: "failing", DeliveryMode: BestEffort}
+	healthy := Function{Name: "healthy"}
+
+	t.Run("Should read the delivery mode annotation", func(t *testing.T) {
+		annotations := map[string]string{"topic": "billing", DeliveryModeAnnotation: "Best-Effort"}
+		invalid := map[string]string{"topic": "billing", DeliveryModeAnnotation: "eventually"}
+
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{
+			{Name: "biller", Annotations: &annotations},
+			{Name: "invoicer", Annotations: &invalid},
+		}, nil)
+
+		cache := NewTopicFunctionCache()
+		NewController(&config.Controller{}, clientMock, cache).refreshTick(context.Background(), false)
+
+		assert.ElementsMatch(t, []Function{{Name: "biller", DeliveryMode: BestEffort}, {Name: "invoicer"}}, cache.GetCachedValues("billing"))
+		assert.Equal(t, BestEffort, cache.GetDeliveryMode("billing"))
+	})
+
+	t.Run("Should invoke all functions of best-effort topics and combine their errors", func(t *testing.T) {
+		cache := NewTopicFunctionCache()
+		cache.Refresh(map[string][]Function{"billing": {failing, healthy, failing}})
+
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("InvokeAsync", mock.Anything, healthy, mock.Anything).Return(true, nil)
+		clientMock.On("InvokeAsync", mock.Anything, failing, mock.Anything).Return(false, errors.New("failed"))
+
+		results, err := NewController(nil, clientMock, cache).Invoke("billing", nil)
+
+		assert.Error(t, err, "should throw")
+		assert.Contains(t, err.Error(), "2 of 3 function(s) failed")
+		assert.Len(t, results, 3, "should report a result per function")
+		assert.Equal(t, types2.StatusFailure, results[0].Status)
+		assert.Equal(t, types2.StatusSuccess, results[1].Status)
+		assert.Equal(t, types2.StatusFailure, results[2].Status)
+		clientMock.AssertNumberOfCalls(t, "InvokeAsync", 3)
+	})
+
+	t.Run("Should abort fail-fast topics on the first error", func(t *testing.T) {
+		cache := NewTopicFunctionCache()
+		cache.Refresh(map[string][]Function{"billing": {{Name: "failing", DeliveryMode: FailFast}, healthy}})
+
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(false, errors.New("failed"))
+
+		results, err := NewController(nil, clientMock, cache).Invoke("billing", nil)
+
+		assert.EqualError(t, err, "failed")
+		assert.Len(t, results, 1, "should only report the failed function")
+		clientMock.AssertNumberOfCalls(t, "InvokeAsync", 1)
+	})
+
+	t.Run("Should use fail-fast if the functions of a topic request conflicting modes", func(t *testing.T) {
+		cache := NewTopicFunctionCache()
+		cache.Refresh(map[string][]Function{"billing": {{Name: "failing", DeliveryMode: BestEffort}, {Name: "healthy", DeliveryMode: FailFast}}})
+
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(false, errors.New("failed"))
+
+		results, err := NewController(nil, clientMock, cache).Invoke("billing", nil)
+
+		assert.Error(t, err, "should throw")
+		assert.Len(t, results, 1, "should only report the failed function")
+		clientMock.AssertNumberOfCalls(t, "InvokeAsync", 1)
+	})
+}
+
+func TestCacher_PaginatedGateway(t *testing.T) {
+	t.Run("Should cache the functions of all pages", func(t *testing.T) {
+		annotations := map[string]string{"topic": "billing"}
+		var functions []types.FunctionStatus
+		for i := 0; i < 25; i++ {
+			functions = append(functions, types.FunctionStatus{Name: fmt.Sprintf("function-%d", i), Annotations: &annotations})
+		}
+		server := newPaginatedGateway(map[string][]types.FunctionStatus{"": functions}, 10)
+		defer server.Close()
+
+		cache := NewTopicFunctionCache()
+		client := NewClient(types2.MakeHTTPClient(true, 256, 30*time.Second, 5*time.Second), nil, server.URL, "")
+		_, err := NewController(&config.Controller{}, client, cache).refreshTick(context.Background(), false)
+
+		assert.NoError(t, err, "Should not fail")
+		assert.Len(t, cache.GetCachedValues("billing"), 25, "Expected the functions of all pages")
+	})
+}
+
+func TestCacher_CrawlErrors(t *testing.T) {
+	crawled := map[string]error{
+		"crawl-timeout":    errors.Wrap(context.DeadlineExceeded, "page 1"),
+		"crawl-connection": &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+		"crawl-4xx":        newStatusError(http.StatusForbidden),
+		"crawl-5xx":        newStatusError(http.StatusBadGateway),
+	}
+	kinds := map[string]string{
+		"crawl-timeout":    ErrorKindTimeout,
+		"crawl-connection": ErrorKindConnection,
+		"crawl-4xx":        ErrorKind4xx,
+		"crawl-5xx":        ErrorKind5xx,
+	}
+
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetNamespaces", mock.Anything).Return([]string{"crawl-timeout", "crawl-connection", "crawl-4xx", "crawl-5xx"}, nil)
+	for ns, err := range crawled {
+		clientMock.On("GetFunctions", ns).Return([]types.FunctionStatus{}, err)
+	}
+
+	t.Run("Should count the failed crawls by namespace and kind", func(t *testing.T) {
+		before := map[string]float64{}
+		for ns, kind := range kinds {
+			before[ns] = testutil.ToFloat64(metrics.CrawlErrors.WithLabelValues(ns, kind))
+		}
+
+		_, _ = NewController(&config.Controller{}, clientMock, NewTopicFunctionCache()).refreshTick(context.Background(), true)
+
+		for ns, kind := range kinds {
+			assert.Equal(t, before[ns]+1, testutil.ToFloat64(metrics.CrawlErrors.WithLabelValues(ns, kind)), "Expected a %s error for %s", kind, ns)
+			for _, other := range kinds {
+				if other != kind {
+					assert.Zero(t, testutil.ToFloat64(metrics.CrawlErrors.WithLabelValues(ns, other)), "Expected no %s error for %s", other, ns)
+				}
+			}
+		}
+	})
+}
+
+func TestCacher_RefreshLogging(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+
+	annotations := map[string]string{"topic": "billing,invoice"}
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+	target := NewController(&config.Controller{}, clientMock, NewTopicFunctionCache())
+
+	t.Run("Should summarize the changes of the topic map", func(t *testing.T) {
+		target.refreshTick(context.Background(), false)
+
+		assert.Contains(t, out.String(), "Topic map updated: +2/-0 topic(s), +1/-0 function(s)")
+		assert.NotContains(t, out.String(), "Crawling", "Expected the crawl progress to be logged at debug level")
+	})
+
+	t.Run("Should not log a change on a no-op refresh", func(t *testing.T) {
+		out.Reset()
+		target.refreshTick(context.Background(), false)
+
+		assert.NotContains(t, out.String(), "Topic map updated")
+		assert.Empty(t, out.String(), "Expected a steady state refresh to be quiet")
+	})
+}
+
+func TestCacher_RefreshOnce(t *testing.T) {
+	t.Run("Should return the refreshed topic map", func(t *testing.T) {
+		annotations := map[string]string{"topic": "billing"}
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("HasNamespaceSupport", mock.Anything).Return(false, nil)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+
+		cache := NewTopicFunctionCache()
+		mapping, err := NewController(&config.Controller{}, clientMock, cache).RefreshOnce(context.Background())
+
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, map[string][]Function{"billing": {{Name: "biller"}}}, mapping)
+		assert.Equal(t, []Function{{Name: "biller"}}, cache.GetCachedValues("billing"))
+	})
+
+	t.Run("Should return crawl errors", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("HasNamespaceSupport", mock.Anything).Return(true, nil)
+		clientMock.On("GetNamespaces", mock.Anything).Return([]string{"faas", "broken"}, nil)
+		clientMock.On("GetFunctions", "faas").Return([]types.FunctionStatus{}, nil)
+		clientMock.On("GetFunctions", "broken").Return([]types.FunctionStatus{}, errors.New("forbidden"))
+
+		_, err := NewController(&config.Controller{}, clientMock, NewTopicFunctionCache()).RefreshOnce(context.Background())
+
+		assert.EqualError(t, err, "forbidden")
+	})
+
+	t.Run("Should fail if the namespace support can not be determined", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("HasNamespaceSupport", mock.Anything).Return(false, errors.New("connection refused"))
+
+		_, err := NewController(&config.Controller{}, clientMock, NewTopicFunctionCache()).RefreshOnce(context.Background())
+
+		assert.Error(t, err, "should throw")
+		clientMock.AssertNotCalled(t, "GetFunctions", mock.Anything)
+	})
+}
+
+func TestCacher_WithInvoker(t *testing.T) {
+	t.Run("Should invoke via the plugged in invoker instead of the crawler", func(t *testing.T) {
+		crawlerMock := new(MockOpenFaaSClient)
+		invokerMock := new(MockOpenFaaSClient)
+		invokerMock.On("InvokeAsync", mock.Anything, Function{Name: "biller"}, mock.Anything).Return(true, nil)
+
+		cache := NewTopicFunctionCache()
+		cache.Refresh(map[string][]Function{"billing": {{Name: "biller"}}})
+		target := NewController(nil, crawlerMock, cache).WithInvoker(invokerMock)
+
+		results, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing"})
+
+		assert.NoError(t, err, "should not throw")
+		assert.Len(t, results, 1)
+		invokerMock.AssertExpectations(t)
+		crawlerMock.AssertNotCalled(t, "InvokeAsync", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestCacher_MaxTopics(t *testing.T) {
+	annotations := map[string]string{"topic": "billing,shipping,support"}
+
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+
+	t.Run("Should enforce the cap on every refresh", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.RejectedTopics)
+		cache := NewTopicFunctionCache()
+		target := NewController(&config.Controller{MaxTopics: 2}, clientMock, cache)
+
+		target.refreshTick(context.Background(), false)
+		target.refreshTick(context.Background(), false)
+
+		assert.Len(t, cache.topicMap, 2, "Expected the cap to be enforced")
+		assert.Empty(t, cache.GetCachedValues("support"), "Expected the last topic to be rejected")
+		assert.Equal(t, before+2, testutil.ToFloat64(metrics.RejectedTopics), "Expected the rejected topic to be counted per refresh")
+	})
+
+	t.Run("Should keep the same topics while crawling concurrently", func(t *testing.T) {
+		crawler := newNamespaceCrawlerStub(12, "")
+		crawler.perNamespaceTopic = true
+		cache := NewTopicFunctionCache()
+		target := NewController(&config.Controller{MaxTopics: 3, CrawlConcurrency: 6}, crawler, cache)
+
+		for i := 0; i < 5; i++ {
+			mapping, err := target.refreshTick(context.Background(), true)
+			assert.NoError(t, err, "should not throw")
+			assert.Len(t, mapping, 3, "Expected the cap to be enforced")
+			for _, topic := range []string{"namespace-0", "namespace-1", "namespace-10"} {
+				assert.Contains(t, mapping, topic, "Expected the first topics in sorted order to be kept")
+			}
+		}
+	})
+
+	t.Run("Should keep the previous topics once a new one sorts before them", func(t *testing.T) {
+		crawler := newNamespaceCrawlerStub(2, "")
+		crawler.perNamespaceTopic = true
+		target := NewController(&config.Controller{MaxTopics: 2, CrawlConcurrency: 2}, crawler, NewTopicFunctionCache())
+		target.refreshTick(context.Background(), true)
+
+		crawler.namespaces = append([]string{"archive"}, crawler.namespaces...)
+		mapping, _ := target.refreshTick(context.Background(), true)
+		assert.Contains(t, mapping, "namespace-0")
+		assert.Contains(t, mapping, "namespace-1")
+		assert.NotContains(t, mapping, "archive", "Expected the new topic to be rejected")
+	})
+}
+
+// recordingSink records the calls of the controller, it is safe for concurrent use as namespaces are crawled concurrently
+type recordingSink struct {
+	metrics.NoOp
+
+	lock        sync.Mutex
+	invocations []string
+	latencies   int
+	topics      []string
+	crawlErrors []string
+	cacheAge    time.Duration
+}
+
+func (s *recordingSink) IncInvocations(topic string, function string, namespace string, status string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.invocations = append(s.invocations, fmt.Sprintf("%s %s.%s %s", topic, function, namespace, status))
+}
+
+func (s *recordingSink) ObserveLatency(string, string, time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.latencies++
+}
+
+func (s *recordingSink) SetTopicGauge(function string, namespace string, topic string, source string, subscribed bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.topics = append(s.topics, fmt.Sprintf("%s %s.%s %s %t", topic, function, namespace, source, subscribed))
+}
+
+func (s *recordingSink) IncCrawlErrors(namespace string, kind string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.crawlErrors = append(s.crawlErrors, namespace+" "+kind)
+}
+
+func (s *recordingSink) SetCacheAge(age time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cacheAge = age
+}
+
+func TestCacher_WithMetrics(t *testing.T) {
+	annotations := map[string]string{"topic": "billing"}
+
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetNamespaces", mock.Anything).Return([]string{"faas", "broken"}, nil)
+	clientMock.On("GetFunctions", "faas").Return([]types.FunctionStatus{{Name: "biller", Namespace: "faas", Annotations: &annotations}}, nil)
+	clientMock.On("GetFunctions", "broken").Return([]types.FunctionStatus{}, newStatusError(http.StatusBadGateway))
+	clientMock.On("InvokeAsync", mock.Anything, Function{Name: "biller", Namespace: "faas"}, mock.Anything).Return(false, errors.New("failed")).Once()
+	clientMock.On("InvokeAsync", mock.Anything, Function{Name: "biller", Namespace: "faas"}, mock.Anything).Return(true, nil)
+
+	sink := &recordingSink{}
+	target := NewController(&config.Controller{}, clientMock, NewTopicFunctionCache()).WithMetrics(sink)
+
+	t.Run("Should record the refresh using the sink", func(t *testing.T) {
+		target.refreshTick(context.Background(), true)
+
+		assert.Equal(t, []string{"billing biller.faas crawled true"}, sink.topics)
+		assert.Equal(t, []string{"broken 5xx"}, sink.crawlErrors)
+	})
+
+	t.Run("Should record the invocations using the sink", func(t *testing.T) {
+		_, _ = target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing"})
+		_, _ = target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing"})
+
+		assert.Equal(t, []string{"billing biller.faas failure", "billing biller.faas success"}, sink.invocations)
+		assert.Equal(t, 2, sink.latencies)
+	})
+}
+
+func TestCacher_AllowedTopics(t *testing.T) {
+	annotations := map[string]string{"topic": "billing,rogue"}
+
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+	clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+	cache := NewTopicFunctionCache()
+	listener := &topicListenerStub{}
+	target := NewController(&config.Controller{AllowedTopics: []string{"billing"}}, clientMock, cache).
+		WithTopicListeners(listener)
+
+	t.Run("Should only honor the subscriptions to allowed topics", func(t *testing.T) {
+		target.refreshTick(context.Background(), false)
+
+		assert.Equal(t, []Function{{Name: "biller"}}, cache.GetCachedValues("billing"))
+		assert.Empty(t, cache.GetCachedValues("rogue"), "Expected the topic to be ignored")
+		assert.Equal(t, [][]string{{"billing"}}, listener.added, "Expected bindings only for the allowed topic")
+	})
+
+	t.Run("Should only invoke functions on allowed topics", func(t *testing.T) {
+		results, err := target.Invoke("rogue", &types2.OpenFaaSInvocation{Topic: "rogue"})
+		assert.NoError(t, err, "should not throw")
+		assert.Empty(t, results)
+		clientMock.AssertNotCalled(t, "InvokeAsync", mock.Anything, mock.Anything, mock.Anything)
+
+		results, err = target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing"})
+		assert.NoError(t, err, "should not throw")
+		assert.Len(t, results, 1)
+	})
+}
+
+func TestCacher_FunctionLabelSelector(t *testing.T) {
+	annotations := map[string]string{"topic": "billing"}
+	functions := []types.FunctionStatus{
+		{Name: "biller", Annotations: &annotations, Labels: &map[string]string{"team": "billing"}},
+		{Name: "canary", Annotations: &annotations, Labels: &map[string]string{"team": "billing", "tier": "canary"}},
+		{Name: "reporter", Annotations: &annotations, Labels: &map[string]string{"team": "reports"}},
+		{Name: "unlabeled", Annotations: &annotations},
+	}
+
+	crawl := func(expr string) []Function {
+		selector, err := labels.Parse(expr)
+		assert.NoError(t, err, "should not throw")
+
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetFunctions", "").Return(functions, nil)
+		cache := NewTopicFunctionCache()
+		NewController(&config.Controller{FunctionLabelSelector: selector}, clientMock, cache).refreshTick(context.Background(), false)
+
+		crawled := cache.GetCachedValues("billing")
+		sort.Slice(crawled, func(i, j int) bool { return crawled[i].Name < crawled[j].Name })
+		return crawled
+	}
+
+	t.Run("Should only keep the functions matching an include selector", func(t *testing.T) {
+		assert.Equal(t, []Function{{Name: "biller"}, {Name: "canary"}}, crawl("team=billing"))
+	})
+
+	t.Run("Should drop the functions matching an exclude selector", func(t *testing.T) {
+		assert.Equal(t, []Function{{Name: "biller"}, {Name: "reporter"}, {Name: "unlabeled"}}, crawl("tier!=canary"))
+		assert.Equal(t, []Function{{Name: "biller"}}, crawl("team=billing,!tier"))
+	})
+
+	t.Run("Should keep all functions without selector", func(t *testing.T) {
+		assert.Len(t, crawl(""), 4)
+	})
+}
+
+func TestCacher_AnnotationOverrides(t *testing.T) {
+	annotations := map[string]string{"topic": "billing", MethodAnnotation: "PUT", MaxInFlightAnnotation: "4"}
+
+	crawl := func(allowed []string) []Function {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+		cache := NewTopicFunctionCache()
+		NewController(&config.Controller{AllowedAnnotationOverrides: allowed}, clientMock, cache).refreshTick(context.Background(), false)
+		return cache.GetCachedValues("billing")
+	}
+
+	t.Run("Should ignore the overrides that are not allowed", func(t *testing.T) {
+		assert.Equal(t, []Function{{Name: "biller", Method: "PUT"}}, crawl([]string{MethodAnnotation}))
+		assert.Equal(t, "4", annotations[MaxInFlightAnnotation], "Expected the crawled annotations to be left untouched")
+	})
+
+	t.Run("Should only honor the topic subscription without allowed overrides", func(t *testing.T) {
+		assert.Equal(t, []Function{{Name: "biller"}}, crawl([]string{}))
+	})
+
+	t.Run("Should honor all overrides if allowed", func(t *testing.T) {
+		assert.Equal(t, []Function{{Name: "biller", Method: "PUT", MaxInFlight: 4}}, crawl([]string{AllOverrides}))
+		assert.Equal(t, []Function{{Name: "biller", Method: "PUT", MaxInFlight: 4}}, crawl(nil))
+	})
+}
+
+func TestCacher_InvocationDeadline(t *testing.T) {
+	annotations := map[string]string{"topic": "billing"}
+	deadlineWithin := func(from time.Time, to time.Time) interface{} {
+		return mock.MatchedBy(func(ctx context.Context) bool {
+			deadline, ok := ctx.Deadline()
+			return ok && !deadline.Before(from) && !deadline.After(to)
+		})
+	}
+
+	t.Run("Should bound the invocation by the deadline of the message", func(t *testing.T) {
+		deadline := time.Now().Add(5 * time.Second)
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+		clientMock.On("InvokeAsync", deadlineWithin(deadline, deadline), mock.Anything, mock.Anything).Return(true, nil)
+
+		target := NewController(&config.Controller{InvokeTimeout: time.Minute}, clientMock, NewTopicFunctionCache())
+		target.refreshTick(context.Background(), false)
+
+		_, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing", Deadline: deadline})
+		assert.NoError(t, err, "should not throw")
+		clientMock.AssertExpectations(t)
+	})
+
+	t.Run("Should keep the invoke timeout if the deadline of the message is later", func(t *testing.T) {
+		start := time.Now()
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+		clientMock.On("InvokeAsync", deadlineWithin(start.Add(time.Minute), start.Add(time.Minute+5*time.Second)), mock.Anything, mock.Anything).Return(true, nil)
+
+		target := NewController(&config.Controller{InvokeTimeout: time.Minute}, clientMock, NewTopicFunctionCache())
+		target.refreshTick(context.Background(), false)
+
+		_, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing", Deadline: start.Add(time.Hour)})
+		assert.NoError(t, err, "should not throw")
+		clientMock.AssertExpectations(t)
+	})
+
+	t.Run("Should keep the annotated timeout if the deadline of the message is later", func(t *testing.T) {
+		start := time.Now()
+		timed := map[string]string{"topic": "billing", TimeoutAnnotation: "2s"}
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &timed}}, nil)
+		clientMock.On("InvokeAsync", deadlineWithin(start.Add(2*time.Second), start.Add(7*time.Second)), mock.Anything, mock.Anything).Return(true, nil)
+
+		target := NewController(&config.Controller{InvokeTimeout: time.Minute}, clientMock, NewTopicFunctionCache())
+		target.refreshTick(context.Background(), false)
+
+		_, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing", Deadline: start.Add(time.Hour)})
+		assert.NoError(t, err, "should not throw")
+		clientMock.AssertExpectations(t)
+	})
+
+	t.Run("Should cap the invoke timeout by a shorter ttl of the message", func(t *testing.T) {
+		expiry := time.Now().Add(5 * time.Second)
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+		clientMock.On("InvokeAsync", deadlineWithin(expiry, expiry), mock.Anything, mock.Anything).Return(true, nil)
+
+		target := NewController(&config.Controller{InvokeTimeout: time.Minute}, clientMock, NewTopicFunctionCache())
+		target.refreshTick(context.Background(), false)
+
+		_, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing", Expiry: expiry})
+		assert.NoError(t, err, "should not throw")
+		clientMock.AssertExpectations(t)
+	})
+
+	t.Run("Should keep the invoke timeout if the ttl of the message is longer", func(t *testing.T) {
+		start := time.Now()
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+		clientMock.On("InvokeAsync", deadlineWithin(start.Add(time.Minute), start.Add(time.Minute+5*time.Second)), mock.Anything, mock.Anything).Return(true, nil)
+
+		target := NewController(&config.Controller{InvokeTimeout: time.Minute}, clientMock, NewTopicFunctionCache())
+		target.refreshTick(context.Background(), false)
+
+		_, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing", Expiry: start.Add(time.Hour)})
+		assert.NoError(t, err, "should not throw")
+		clientMock.AssertExpectations(t)
+	})
+
+	t.Run("Should cap the deadline of the message by a shorter ttl", func(t *testing.T) {
+		expiry := time.Now().Add(5 * time.Second)
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+		clientMock.On("InvokeAsync", deadlineWithin(expiry, expiry), mock.Anything, mock.Anything).Return(true, nil)
+
+		target := NewController(&config.Controller{InvokeTimeout: time.Minute}, clientMock, NewTopicFunctionCache())
+		target.refreshTick(context.Background(), false)
+
+		_, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing", Deadline: expiry.Add(time.Hour), Expiry: expiry})
+		assert.NoError(t, err, "should not throw")
+		clientMock.AssertExpectations(t)
+	})
+
+	t.Run("Should fall back to the invoke timeout without deadline", func(t *testing.T) {
+		start := time.Now()
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+		clientMock.On("InvokeAsync", deadlineWithin(start.Add(time.Minute), start.Add(time.Minute+5*time.Second)), mock.Anything, mock.Anything).Return(true, nil)
+
+		target := NewController(&config.Controller{InvokeTimeout: time.Minute}, clientMock, NewTopicFunctionCache())
+		target.refreshTick(context.Background(), false)
+
+		_, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing"})
+		assert.NoError(t, err, "should not throw")
+		clientMock.AssertExpectations(t)
+	})
+}
+
+func TestCacher_StaticMappings(t *testing.T) {
+	annotations := map[string]string{"topic": "billing"}
+
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil).Once()
+	clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{}, nil)
+	clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+	conf := &config.Controller{
+		StaticMappings:  map[string][]string{"billing": {"invoicer.legacy", "https://billing.example.com/hook"}},
+		PausedFunctions: []string{"invoicer.legacy"},
+	}
+	cache := NewTopicFunctionCache()
+	target := NewController(conf, clientMock, cache)
+
+	static := []Function{
+		{Name: "https://billing.example.com/hook", URL: "https://billing.example.com/hook", Static: true},
+	}
+
+	t.Run("Should merge static mappings with the crawled functions", func(t *testing.T) {
+		target.refreshTick(context.Background(), false)
+
+		assert.ElementsMatch(t, append([]Function{{Name: "biller"}}, static...), cache.GetCachedValues("billing"))
+		assert.Contains(t, cache.topicMap["billing"], Function{Name: "invoicer", Namespace: "legacy", Static: true, Paused: true}, "Expected static function refs to be pausable")
+	})
+
+	t.Run("Should keep static mappings once the crawled functions are gone", func(t *testing.T) {
+		target.refreshTick(context.Background(), false)
+
+		assert.Equal(t, static, cache.GetCachedValues("billing"))
+	})
+
+	t.Run("Should invoke static mappings", func(t *testing.T) {
+		results, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing"})
+
+		assert.NoError(t, err, "should not throw")
+		assert.Len(t, results, 1)
+		clientMock.AssertCalled(t, "InvokeAsync", mock.Anything, static[0], mock.Anything)
+	})
+}
+
+func TestCacher_StaticMappingsFile(t *testing.T) {
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{}, nil)
+
+	fs := afero.NewMemMapFs()
+	_ = afero.WriteFile(fs, "static.yaml", []byte("billing: [invoicer]"), 0644)
+
+	conf := &config.Controller{StaticMappings: map[string][]string{"billing": {"invoicer"}}}
+	cache := NewTopicFunctionCache()
+	target := NewController(conf, clientMock, cache).WithStaticMappingsFile(fs, "static.yaml")
+
+	t.Run("Should apply the static mappings of the config", func(t *testing.T) {
+		target.refreshTick(context.Background(), false)
+
+		assert.Equal(t, []Function{{Name: "invoicer", Static: true}}, cache.GetCachedValues("billing"))
+	})
+
+	t.Run("Should apply changes of the file with the next refresh", func(t *testing.T) {
+		_ = afero.WriteFile(fs, "static.yaml", []byte("support: [helpdesk.faas]"), 0644)
+
+		target.refreshTick(context.Background(), false)
+
+		assert.Empty(t, cache.GetCachedValues("billing"), "Expected the removed mapping to be gone")
+		assert.Equal(t, []Function{{Name: "helpdesk", Namespace: "faas", Static: true}}, cache.GetCachedValues("support"))
+	})
+
+	t.Run("Should keep the previous mappings if the file became invalid", func(t *testing.T) {
+		_ = afero.WriteFile(fs, "static.yaml", []byte("support: [\" \"]"), 0644)
+
+		target.refreshTick(context.Background(), false)
+
+		assert.Equal(t, []Function{{Name: "helpdesk", Namespace: "faas", Static: true}}, cache.GetCachedValues("support"))
+	})
+}
+
+func TestCacher_Invoke(t *testing.T) {
+	cacheMock := new(MockTopicMap)
+	cacheMock.On("GetCachedValues", "Security").Return([]Function{})
+	cacheMock.On("GetCachedValues", "Billing").Return([]Function{{Name: "billing"}, {Name: "secret", Namespace: "faas"}, {Name: "transport"}})
+
+	const TOPIC = "Billing"
+
+	t.Run("Should invoke all functions for specified Topic", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+		cacher := NewController(nil, clientMock, cacheMock)
+
+		results, err := cacher.Invoke(TOPIC, nil)
+
+		assert.NoError(t, err, "should not throw")
+		assert.Len(t, results, 3, "should report a result per function")
+		clientMock.AssertNumberOfCalls(t, "InvokeAsync", 3)
+		clientMock.AssertExpectations(t)
+	})
+
+	t.Run("Should abort invocation of functions on receiving first error further returning it", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(false, errors.New("failed"))
+
+		cacher := NewController(nil, clientMock, cacheMock)
+
+		results, err := cacher.Invoke(TOPIC, nil)
+
+		assert.Error(t, err, "failed")
+		assert.Len(t, results, 1, "should only report the failed function")
+		assert.Equal(t, types2.StatusFailure, results[0].Status)
+		clientMock.AssertNumberOfCalls(t, "InvokeAsync", 1)
+		clientMock.AssertExpectations(t)
+	})
+
+	t.Run("Should not invoke if there is no function for specified Topic", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+		cacher := NewController(nil, clientMock, cacheMock)
+
+		results, err := cacher.Invoke("Security", nil)
+
+		assert.NoError(t, err, "should not throw")
+		assert.Empty(t, results, "should not report any result")
+		clientMock.AssertNotCalled(t, "InvokeAsync")
+	})
+
+	t.Run("Should report outcome including namespace and correlation id", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+		cacher := NewController(nil, clientMock, cacheMock)
+
+		results, err := cacher.Invoke(TOPIC, &types2.OpenFaaSInvocation{Topic: TOPIC, CorrelationID: "4711"})
+
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, "secret", results[1].Function)
+		assert.Equal(t, "faas", results[1].Namespace)
+		assert.Equal(t, TOPIC, results[1].Topic)
+		assert.Equal(t, "4711", results[1].CorrelationID)
+		assert.Equal(t, types2.StatusSuccess, results[1].Status)
+	})
+}
+
+func TestCacher_InterInvocationDelay(t *testing.T) {
+	cacheMock := new(MockTopicMap)
+	cacheMock.On("GetCachedValues", "Billing").Return([]Function{{Name: "billing"}, {Name: "secret"}, {Name: "transport"}})
+
+	t.Run("Should pause between invocations", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+		cacher := NewController(&config.Controller{InterInvocationDelay: 50 * time.Millisecond}, clientMock, cacheMock)
+
+		start := time.Now()
+		results, err := cacher.Invoke("Billing", nil)
+
+		assert.NoError(t, err, "should not throw")
+		assert.Len(t, results, 3)
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond, "Expected a delay between each of the invocations")
+	})
+
+	t.Run("Should not pause without a delay", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+		cacher := NewController(&config.Controller{}, clientMock, cacheMock)
+
+		start := time.Now()
+		_, err := cacher.Invoke("Billing", nil)
+
+		assert.NoError(t, err, "should not throw")
+		assert.Less(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("Should abort promptly once the context is done", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cacher := NewController(&config.Controller{InterInvocationDelay: time.Minute}, clientMock, cacheMock)
+		cacher.ctx = ctx
+
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		start := time.Now()
+		results, err := cacher.Invoke("Billing", nil)
+
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Len(t, results, 1, "Expected only the first function to be invoked")
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("Should abort promptly once the context of the invocation is done", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cacher := NewController(&config.Controller{InterInvocationDelay: time.Minute}, clientMock, cacheMock)
+
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		start := time.Now()
+		results, err := cacher.InvokeContext(ctx, "Billing", nil)
+
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Len(t, results, 1, "Expected only the first function to be invoked")
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("Should abort promptly once the message expired", func(t *testing.T) {
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+		cacher := NewController(&config.Controller{InterInvocationDelay: time.Minute}, clientMock, cacheMock)
+		invocation := &types2.OpenFaaSInvocation{Expiry: time.Now().Add(20 * time.Millisecond)}
+
+		start := time.Now()
+		results, err := cacher.Invoke("Billing", invocation)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Len(t, results, 1, "Expected only the first function to be invoked")
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestCacher_InvokeTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := NewClient(types2.MakeHTTPClient(true, 256, 30*time.Second, 5*time.Second), nil, server.URL, "")
+	conf := &config.Controller{InvokeTimeout: 5 * time.Second}
+	message := []byte("Hello World")
+
+	t.Run("Should abort invocation once the annotated timeout is exceeded", func(t *testing.T) {
+		cacheMock := new(MockTopicMap)
+		cacheMock.On("GetCachedValues", "billing").Return([]Function{{Name: "fast", Timeout: 50 * time.Millisecond}})
+
+		target := NewController(conf, client, cacheMock)
+		results, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Message: &message})
+
+		assert.Error(t, err, "Should time out")
+		assert.Len(t, results, 1)
+		assert.Equal(t, types2.StatusFailure, results[0].Status)
+	})
+
+	t.Run("Should succeed if the annotated timeout is long enough", func(t *testing.T) {
+		cacheMock := new(MockTopicMap)
+		cacheMock.On("GetCachedValues", "billing").Return([]Function{{Name: "slow", Timeout: 2 * time.Second}})
+
+		target := NewController(conf, client, cacheMock)
+		results, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Message: &message})
+
+		assert.NoError(t, err, "Should not time out")
+		assert.Len(t, results, 1)
+		assert.Equal(t, types2.StatusSuccess, results[0].Status)
+	})
+
+	t.Run("Should fallback to the global invoke timeout", func(t *testing.T) {
+		cacheMock := new(MockTopicMap)
+		cacheMock.On("GetCachedValues", "billing").Return([]Function{{Name: "unannotated"}})
+
+		target := NewController(&config.Controller{InvokeTimeout: 50 * time.Millisecond}, client, cacheMock)
+		_, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Message: &message})
+
+		assert.Error(t, err, "Should time out")
+	})
+}
+
+func TestExtractTimeoutFromAnnotations(t *testing.T) {
+	t.Run("Should read the timeout annotation", func(t *testing.T) {
+		annotations := map[string]string{TimeoutAnnotation: "500ms", "invoke-timeout": "5m"}
+		assert.Equal(t, 500*time.Millisecond, extractTimeoutFromAnnotations(types.FunctionStatus{Annotations: &annotations}))
+	})
+
+	t.Run("Should read the short invoke-timeout annotation", func(t *testing.T) {
+		annotations := map[string]string{"invoke-timeout": "5m"}
+		assert.Equal(t, 5*time.Minute, extractTimeoutFromAnnotations(types.FunctionStatus{Annotations: &annotations}))
+	})
+
+	t.Run("Should return zero if annotation is absent or unparseable", func(t *testing.T) {
+		annotations := map[string]string{TimeoutAnnotation: "soon"}
+		assert.Zero(t, extractTimeoutFromAnnotations(types.FunctionStatus{Annotations: &annotations}))
+		assert.Zero(t, extractTimeoutFromAnnotations(types.FunctionStatus{}))
+	})
+}
+
+func TestExtractMethodFromAnnotations(t *testing.T) {
+	t.Run("Should read the allowed methods regardless of their case", func(t *testing.T) {
+		for _, method := range []string{"POST", "put", "Patch"} {
+			annotations := map[string]string{MethodAnnotation: method}
+			assert.Equal(t, strings.ToUpper(method), extractMethodFromAnnotations(types.FunctionStatus{Annotations: &annotations}))
+		}
+	})
+
+	t.Run("Should reject methods that are not allowed", func(t *testing.T) {
+		annotations := map[string]string{MethodAnnotation: "GET"}
+		assert.Empty(t, extractMethodFromAnnotations(types.FunctionStatus{Annotations: &annotations}))
+	})
+
+	t.Run("Should return empty if annotation is absent", func(t *testing.T) {
+		assert.Empty(t, extractMethodFromAnnotations(types.FunctionStatus{}))
+	})
+}
+
+// fakeCrawler serves a fixed set of functions and accepts every invocation without allocating
+type fakeCrawler struct {
+	functions []types.FunctionStatus
+}
+
+func (f *fakeCrawler) InvokeSync(ctx context.Context, fn Function, invocation *types2.OpenFaaSInvocation) ([]byte, error) {
+	return nil, nil
+}
+
+func (f *fakeCrawler) InvokeAsync(ctx context.Context, fn Function, invocation *types2.OpenFaaSInvocation) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeCrawler) HasNamespaceSupport(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeCrawler) GetNamespaces(ctx context.Context) ([]string, error) {
+	return []string{}, nil
+}
+
+func (f *fakeCrawler) GetFunctions(ctx context.Context, namespace string) ([]types.FunctionStatus, error) {
+	return f.functions, nil
+}
+
+func newFakeCrawler(count int) *fakeCrawler {
+	functions := make([]types.FunctionStatus, 0, count)
+	for i := 0; i < count; i++ {
+		annotations := map[string]string{"topic": "billing,transport,secret"}
+		functions = append(functions, types.FunctionStatus{Name: fmt.Sprintf("function-%d", i), Annotations: &annotations})
+	}
+	return &fakeCrawler{functions: functions}
+}
+
+func BenchmarkInvoke(b *testing.B) {
+	message := []byte(`{"meta":{"eventType":"billing"}}`)
+	invocation := &types2.OpenFaaSInvocation{Topic: "billing", Message: &message, ContentType: "application/json"}
+
+	b.Run("controller", func(b *testing.B) {
+		cache := NewTopicFunctionCache()
+		target := NewController(&config.Controller{}, newFakeCrawler(3), cache)
+		target.refreshTick(context.Background(), false)
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := target.Invoke("billing", invocation); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("client", func(b *testing.B) {
+		listener := fasthttputil.NewInmemoryListener()
+		defer listener.Close()
+
+		server := &fasthttp.Server{Handler: func(ctx *fasthttp.RequestCtx) {
+			ctx.SetStatusCode(fasthttp.StatusAccepted)
+		}}
+		go func() { _ = server.Serve(listener) }()
+
+		httpClient := &fasthttp.Client{Dial: func(addr string) (net.Conn, error) { return listener.Dial() }}
+		client := NewClient(httpClient, &auth.BasicAuthCredentials{User: "user", Password: "pass"}, "http://gateway:8080", "")
+		fn := Function{Name: "biller", Namespace: "faas"}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := client.InvokeAsync(context.Background(), fn, invocation); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkRefresh(b *testing.B) {
+	target := NewController(&config.Controller{}, newFakeCrawler(200), NewTopicFunctionCache())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		target.refreshTick(context.Background(), false)
+	}
+}
+
+func TestCacher_InvokeContext(t *testing.T) {
+	t.Run("Should continue the trace of the message on the outgoing request", func(t *testing.T) {
+		headers := make(chan http.Header, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers <- r.Header.Clone()
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		cache := NewTopicFunctionCache()
+		cache.Refresh(map[string][]Function{"billing": {{Name: "biller"}}})
+		target := NewController(nil, new(MockOpenFaaSClient), cache).
+			WithInvoker(NewGatewayInvoker(CreateClient(server), nil, server.URL, ""))
+
+		trace := types2.NewTraceContext("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "congo=t61rcWkgMzE", "tenant=acme")
+		_, err := target.InvokeContext(types2.ContextWithTrace(context.Background(), trace), "billing", &types2.OpenFaaSInvocation{Topic: "billing"})
+		assert.NoError(t, err, "should not throw")
+
+		received := <-headers
+		outgoing := types2.NewTraceContext(received.Get(types2.TraceParentHeader), received.Get(types2.TraceStateHeader), received.Get(types2.BaggageHeader))
+		assert.Equal(t, trace.TraceID(), outgoing.TraceID())
+		assert.Equal(t, trace, outgoing, "Expected the trace state and baggage to be intact")
+	})
+
+	t.Run("Should inject the OpenTelemetry span context and baggage of the context", func(t *testing.T) {
+		headers := make(chan http.Header, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers <- r.Header.Clone()
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		cache := NewTopicFunctionCache()
+		cache.Refresh(map[string][]Function{"billing": {{Name: "biller"}}})
+		target := NewController(nil, new(MockOpenFaaSClient), cache).
+			WithInvoker(NewGatewayInvoker(CreateClient(server), nil, server.URL, ""))
+
+		traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+		spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+		tenant, _ := baggage.NewMember("tenant", "acme")
+		bag, _ := baggage.New(tenant)
+		ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled, Remote: true}))
+		ctx = baggage.ContextWithBaggage(ctx, bag)
+
+		_, err := target.InvokeContext(ctx, "billing", &types2.OpenFaaSInvocation{Topic: "billing"})
+		assert.NoError(t, err, "should not throw")
+
+		received := <-headers
+		outgoing := types2.TracePropagator.Extract(context.Background(), propagation.HeaderCarrier(received))
+		assert.Equal(t, traceID, trace.SpanContextFromContext(outgoing).TraceID(), "Expected the function to continue the trace")
+		assert.Equal(t, "acme", baggage.FromContext(outgoing).Member("tenant").Value(), "Expected the baggage to be intact")
+	})
+
+	t.Run("Should not set trace headers without a trace", func(t *testing.T) {
+		headers := make(chan http.Header, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers <- r.Header.Clone()
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		cache := NewTopicFunctionCache()
+		cache.Refresh(map[string][]Function{"billing": {{Name: "biller"}}})
+		target := NewController(nil, new(MockOpenFaaSClient), cache).
+			WithInvoker(NewGatewayInvoker(CreateClient(server), nil, server.URL, ""))
+
+		_, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing"})
+		assert.NoError(t, err, "should not throw")
+
+		received := <-headers
+		assert.Empty(t, received.Get(types2.TraceParentHeader))
+		assert.Empty(t, received.Get(types2.BaggageHeader))
 	})
 }
@@ -11,7 +11,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
 	internal "github.com/Templum/rabbitmq-connector/pkg/types"
 	"github.com/valyala/fasthttp"
 
@@ -20,12 +24,6 @@ import (
 	"github.com/pkg/errors"
 )
 
-// Invoker defines interfaces that invoke deployed OpenFaaS Functions.
-type Invoker interface {
-	InvokeSync(ctx context.Context, name string, invocation *internal.OpenFaaSInvocation) ([]byte, error)
-	InvokeAsync(ctx context.Context, name string, invocation *internal.OpenFaaSInvocation) (bool, error)
-}
-
 // NamespaceFetcher defines interfaces to explore namespaces of an OpenFaaS installation.
 type NamespaceFetcher interface {
 	HasNamespaceSupport(ctx context.Context) (bool, error)
@@ -37,114 +35,216 @@ type FunctionFetcher interface {
 	GetFunctions(ctx context.Context, namespace string) ([]types.FunctionStatus, error)
 }
 
-// FunctionCrawler defines interfaces required to crawl OpenFaaS for functions
+// FunctionCrawler defines interfaces required to crawl OpenFaaS for functions. Its Invoker is used
+// by the Controller, unless another transport is plugged in via Controller.WithInvoker.
 type FunctionCrawler interface {
 	NamespaceFetcher
 	FunctionFetcher
 	Invoker
 }
 
-// Client is used for interacting with Open FaaS
+// gateway holds the connection to the OpenFaaS gateway, which is shared between crawling and invoking
+type gateway struct {
+	client        Transport
+	credentials   *auth.BasicAuthCredentials
+	authorization string
+	url           string
+	closeConns    bool
+	metrics       metrics.Sink
+	// sleep awaits the Retry-After of rate limited requests
+	sleep func(ctx context.Context, wait time.Duration) error
+	// failover is present if fallback gateways are configured
+	failover *gatewayFailover
+	// hostHeader overrides the Host header of requests to the gateway, while the url is still dialed
+	hostHeader string
+}
+
+func newGateway(client *fasthttp.Client, creds *auth.BasicAuthCredentials, gatewayURL string) *gateway {
+	authorization := ""
+	if creds != nil {
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(creds.User+":"+creds.Password))
+	}
+
+	return &gateway{
+		client:        client,
+		credentials:   creds,
+		authorization: authorization,
+		url:           gatewayURL,
+		metrics:       metrics.Prometheus{},
+		sleep:         sleepContext,
+	}
+}
+
+// Client is used for interacting with Open FaaS, functions are invoked using a GatewayInvoker
 type Client struct {
-	client      *fasthttp.Client
-	credentials *auth.BasicAuthCredentials
-	url         string
+	*gateway
+	invoker *GatewayInvoker
 }
 
 // NewClient creates a new instance of an OpenFaaS Client using
-// the provided information
-func NewClient(client *fasthttp.Client, creds *auth.BasicAuthCredentials, gatewayURL string) *Client {
+// the provided information. The namespace style controls how the namespace of a function
+// is encoded during invocation, if empty the OpenFaaS name.namespace convention is used.
+func NewClient(client *fasthttp.Client, creds *auth.BasicAuthCredentials, gatewayURL string, namespaceStyle string) *Client {
+	gw := newGateway(client, creds, gatewayURL)
+
 	return &Client{
-		client:      client,
-		credentials: creds,
-		url:         gatewayURL,
+		gateway: gw,
+		invoker: &GatewayInvoker{gateway: gw, namespaceStyle: namespaceStyle},
 	}
 }
 
-// InvokeSync calls a given function in a synchronous way waiting for the response using the provided payload while considering the provided context
-func (c *Client) InvokeSync(ctx context.Context, name string, invocation *internal.OpenFaaSInvocation) ([]byte, error) {
-	functionURL := fmt.Sprintf("%s/function/%s", c.url, name)
-	req := fasthttp.AcquireRequest()
-	resp := fasthttp.AcquireResponse()
+// WithMetrics counts the crawled functions and throttled requests using the sink instead of Prometheus
+func (c *Client) WithMetrics(sink metrics.Sink) *Client {
+	c.metrics = sink
+	return c
+}
 
-	defer fasthttp.ReleaseRequest(req)
-	defer fasthttp.ReleaseResponse(resp)
+// WithFallbackGateways sends the requests to the fallback gateways in order while the gateway is unreachable, e.g.
+// for an active/passive setup. The gateway is preferred again once it recovers.
+func (c *Client) WithFallbackGateways(urls ...string) *Client {
+	c.withFallbackGateways(urls)
+	return c
+}
 
-	req.SetRequestURI(functionURL)
-	if invocation.Message != nil {
-		req.SetBody(*invocation.Message)
-	} else {
-		req.SetBody(nil)
+func (g *gateway) withFallbackGateways(urls []string) {
+	g.failover = nil
+	if len(urls) > 0 {
+		g.failover = newGatewayFailover(g.url, urls)
 	}
+}
 
-	req.Header.SetMethod(fasthttp.MethodPost)
-	req.Header.Set("Content-Type", invocation.ContentType)
-	req.Header.Set("Content-Encoding", invocation.ContentEncoding)
-	req.Header.Set("Topic", invocation.Topic);
-	req.Header.SetUserAgent("OpenFaaS - Rabbit MQ Connector")
-	if c.credentials != nil {
-		credentials := c.credentials.User + ":" + c.credentials.Password
-		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
-	}
+// WithHostHeader sets the Host header of all requests to the gateway, including the fallback gateways, while the
+// gateway url is still dialed. This is required behind ingresses that route by Host. An empty host keeps the one
+// of the url.
+func (c *Client) WithHostHeader(host string) *Client {
+	c.hostHeader = host
+	return c
+}
 
-	err := c.client.Do(req, resp)
-	if err != nil {
-		return nil, errors.Wrapf(err, "unable to invoke function %s", name)
+// WithAsyncQueue publishes asynchronous invocations onto the named queue instead of the default one,
+// which isolates them from other asynchronous work. An empty name uses the default queue.
+func (c *Client) WithAsyncQueue(name string) *Client {
+	c.invoker.WithAsyncQueue(name)
+	return c
+}
+
+// WithKeepAlives controls whether connections to the gateway are kept alive, without keep-alives a
+// connection is used for a single request, which avoids stale sockets behind load balancers.
+func (c *Client) WithKeepAlives(enabled bool) *Client {
+	c.closeConns = !enabled
+	return c
+}
+
+// WithHeaders sets static headers on every invocation, headers derived from the message or set by the
+// connector itself take precedence on conflicts.
+func (c *Client) WithHeaders(headers map[string]string) *Client {
+	c.invoker.WithHeaders(headers)
+	return c
+}
+
+// SetHeaders replaces the static headers while invoking, see GatewayInvoker.SetHeaders
+func (c *Client) SetHeaders(headers map[string]string) {
+	c.invoker.SetHeaders(headers)
+}
+
+// WithHMACSecret signs the body of every invocation using the secret, see GatewayInvoker.WithHMACSecret
+func (c *Client) WithHMACSecret(secret string) *Client {
+	c.invoker.WithHMACSecret(secret)
+	return c
+}
+
+// WithContentTypeSniffing detects the content type of messages without one, see GatewayInvoker.WithContentTypeSniffing
+func (c *Client) WithContentTypeSniffing(enabled bool, fallback string) *Client {
+	c.invoker.WithContentTypeSniffing(enabled, fallback)
+	return c
+}
+
+// Invoker returns the invoker used by the client, which shares the connection to the gateway
+func (c *Client) Invoker() *GatewayInvoker {
+	return c.invoker
+}
+
+// InvokeSync calls the function via the gateway, see GatewayInvoker.InvokeSync
+func (c *Client) InvokeSync(ctx context.Context, fn Function, invocation *internal.OpenFaaSInvocation) ([]byte, error) {
+	return c.invoker.InvokeSync(ctx, fn, invocation)
+}
+
+// InvokeAsync calls the function via the gateway, see GatewayInvoker.InvokeAsync
+func (c *Client) InvokeAsync(ctx context.Context, fn Function, invocation *internal.OpenFaaSInvocation) (bool, error) {
+	return c.invoker.InvokeAsync(ctx, fn, invocation)
+}
+
+// do performs the request while respecting the deadline and cancellation of the provided context. Idempotent
+// requests are retried once if the connection was reset. Requests rate limited with 429 are retried after the
+// Retry-After of the gateway, a ThrottledError is returned once the retry budget or deadline is exceeded.
+// Requests to the gateway are sent to the fallback gateways while it is unreachable.
+func (g *gateway) do(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response) error {
+	if g.closeConns {
+		req.SetConnectionClose()
 	}
 
-	switch resp.StatusCode() {
-	case fasthttp.StatusOK:
-		return resp.Body(), nil
-	case fasthttp.StatusUnauthorized:
-		return nil, errors.New("OpenFaaS Credentials are invalid")
-	case fasthttp.StatusNotFound:
-		return nil, errors.New(fmt.Sprintf("Function %s is not deployed", name))
-	default:
-		return nil, errors.New(fmt.Sprintf("Received unexpected Status Code %d", resp.StatusCode()))
+	uri := req.URI().String()
+	toGateway := strings.HasPrefix(uri, g.url)
+	if toGateway && len(g.hostHeader) > 0 {
+		// fasthttp dials the host of the uri regardless, the header only changes what is sent
+		req.UseHostHeader = true
+		req.Header.SetHost(g.hostHeader)
 	}
-}
 
-// InvokeAsync calls a given function in a asynchronous way waiting for the response using the provided payload while considering the provided context
-func (c *Client) InvokeAsync(ctx context.Context, name string, invocation *internal.OpenFaaSInvocation) (bool, error) {
-	functionURL := fmt.Sprintf("%s/async-function/%s", c.url, name)
-	req := fasthttp.AcquireRequest()
-	resp := fasthttp.AcquireResponse()
+	if g.failover == nil || !toGateway {
+		return g.doOn(ctx, g.url, req, resp)
+	}
 
-	defer fasthttp.ReleaseRequest(req)
-	defer fasthttp.ReleaseResponse(resp)
+	path := strings.TrimPrefix(uri, g.url)
+	var err error
+	for _, index := range g.failover.candidates() {
+		base := g.failover.urls[index]
+		req.SetRequestURI(base + path)
+
+		err = g.doOn(ctx, base, req, resp)
+		if err == nil || !isUnreachable(err, req) {
+			g.failover.reached(index)
+			return err
+		}
+		log.Printf("Gateway %s is unreachable due to %s", base, err)
+	}
+	return err
+}
 
-	req.SetRequestURI(functionURL)
-	if invocation.Message != nil {
-		req.SetBody(*invocation.Message)
-	} else {
-		req.SetBody(nil)
+// doOn sends the request to the gateway with the provided base url, retrying reset and rate limited requests
+func (g *gateway) doOn(ctx context.Context, base string, req *fasthttp.Request, resp *fasthttp.Response) error {
+	err := g.send(ctx, req, resp)
+	if err != nil && isConnectionReset(err) && isIdempotent(req) {
+		// Intermediaries silently drop idle connections, the first request on such a connection is reset
+		log.Printf("Received %s for %s, will retry once", err, req.URI().Path())
+		err = g.send(ctx, req, resp)
 	}
 
-	req.Header.SetMethod(fasthttp.MethodPost)
-	req.Header.Set("Content-Type", invocation.ContentType)
-	req.Header.Set("Content-Encoding", invocation.ContentEncoding)
-	req.Header.Set("Topic", invocation.Topic);
-	req.Header.SetUserAgent("OpenFaaS - Rabbit MQ Connector")
-	if c.credentials != nil {
-		credentials := c.credentials.User + ":" + c.credentials.Password
-		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	for attempt := 0; err == nil && resp.StatusCode() == fasthttp.StatusTooManyRequests; attempt++ {
+		if err = g.awaitRetryAfter(ctx, base, req, resp, attempt); err == nil {
+			err = g.send(ctx, req, resp)
+		}
 	}
+	return err
+}
 
-	err := c.client.Do(req, resp)
-	if err != nil {
-		return false, errors.Wrapf(err, "unable to invoke function %s", name)
+func (g *gateway) send(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	switch resp.StatusCode() {
-	case fasthttp.StatusAccepted:
-		return true, nil
-	case fasthttp.StatusUnauthorized:
-		return false, errors.New("OpenFaaS Credentials are invalid")
-	case fasthttp.StatusNotFound:
-		return false, errors.New(fmt.Sprintf("Function %s is not deployed", name))
-	default:
-		return false, errors.New(fmt.Sprintf("Received unexpected Status Code %d", resp.StatusCode()))
+	if deadline, ok := ctx.Deadline(); ok {
+		return g.client.DoDeadline(req, resp, deadline)
 	}
+	return g.client.Do(req, resp)
+}
+
+func isConnectionReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, fasthttp.ErrConnectionClosed)
+}
+
+func isIdempotent(req *fasthttp.Request) bool {
+	return req.Header.IsGet() || req.Header.IsHead() || req.Header.IsPut() || req.Header.IsDelete() || req.Header.IsOptions()
 }
 
 // HasNamespaceSupport Checks if the version of OpenFaaS does support Namespace
@@ -161,11 +261,10 @@ func (c *Client) HasNamespaceSupport(ctx context.Context) (bool, error) {
 	req.Header.SetMethod(fasthttp.MethodGet)
 	req.Header.SetUserAgent("OpenFaaS - Rabbit MQ Connector")
 	if c.credentials != nil {
-		credentials := c.credentials.User + ":" + c.credentials.Password
-		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+		req.Header.Set("Authorization", c.authorization)
 	}
 
-	err := c.client.Do(req, resp)
+	err := c.do(ctx, req, resp)
 	if err != nil {
 		return false, errors.Wrapf(err, "unable to determine namespace support")
 	}
@@ -198,11 +297,10 @@ func (c *Client) GetNamespaces(ctx context.Context) ([]string, error) {
 	req.Header.SetMethod(fasthttp.MethodGet)
 	req.Header.SetUserAgent("OpenFaaS - Rabbit MQ Connector")
 	if c.credentials != nil {
-		credentials := c.credentials.User + ":" + c.credentials.Password
-		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+		req.Header.Set("Authorization", c.authorization)
 	}
 
-	err := c.client.Do(req, resp)
+	err := c.do(ctx, req, resp)
 	if err != nil {
 		return nil, errors.Wrapf(err, "unable to fetch namespaces")
 	}
@@ -221,31 +319,68 @@ func (c *Client) GetNamespaces(ctx context.Context) ([]string, error) {
 	}
 }
 
-// GetFunctions returns a list of all functions in the given namespace or in the default namespace
+// maxFunctionPages guards against gateways that keep linking to further pages
+const maxFunctionPages = 1000
+
+// GetFunctions returns a list of all functions in the given namespace or in the default namespace. If the gateway
+// paginates the functions via a Link header with rel="next", all pages are fetched.
 func (c *Client) GetFunctions(ctx context.Context, namespace string) ([]types.FunctionStatus, error) {
-	getFunctions := fmt.Sprintf("%s/system/functions", c.url)
+	uri := fasthttp.AcquireURI()
+	defer fasthttp.ReleaseURI(uri)
+
+	if err := uri.Parse(nil, []byte(fmt.Sprintf("%s/system/functions", c.url))); err != nil {
+		return nil, errors.Wrap(err, "unable to obtain functions")
+	}
+	if len(namespace) > 0 {
+		uri.QueryArgs().Add("namespace", namespace)
+	}
+	host := string(uri.Host())
+
+	var functions []types.FunctionStatus
+	for page := 1; ; page++ {
+		found, next, err := c.getFunctionsPage(ctx, uri)
+		if err != nil {
+			return nil, err
+		}
+		functions = append(functions, found...)
+
+		if len(next) == 0 {
+			break
+		}
+		if page == maxFunctionPages {
+			return nil, fmt.Errorf("functions of namespace %s exceed %d pages", namespace, maxFunctionPages)
+		}
+
+		// The next page is resolved relative to the current one, it has to be served by the gateway as credentials are sent
+		uri.Update(next)
+		if string(uri.Host()) != host {
+			return nil, fmt.Errorf("next page of functions %s is not served by the gateway", uri.String())
+		}
+	}
+
+	c.metrics.AddFunctionsCrawled(namespace, len(functions))
+	return functions, nil
+}
+
+// getFunctionsPage fetches a single page of functions and returns the link to the next page, which is empty for the last one
+func (c *Client) getFunctionsPage(ctx context.Context, uri *fasthttp.URI) ([]types.FunctionStatus, string, error) {
 	req := fasthttp.AcquireRequest()
 	resp := fasthttp.AcquireResponse()
 
 	defer fasthttp.ReleaseRequest(req)
 	defer fasthttp.ReleaseResponse(resp)
 
-	req.SetRequestURI(getFunctions)
+	req.SetRequestURI(uri.String())
 
 	req.Header.SetMethod(fasthttp.MethodGet)
 	req.Header.SetUserAgent("OpenFaaS - Rabbit MQ Connector")
 	if c.credentials != nil {
-		credentials := c.credentials.User + ":" + c.credentials.Password
-		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+		req.Header.Set("Authorization", c.authorization)
 	}
 
-	if len(namespace) > 0 {
-		req.URI().QueryArgs().Add("namespace", namespace)
-	}
-
-	err := c.client.Do(req, resp)
+	err := c.do(ctx, req, resp)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to obtain functions")
+		return nil, "", errors.Wrap(err, "unable to obtain functions")
 	}
 
 	switch resp.StatusCode() {
@@ -253,10 +388,33 @@ func (c *Client) GetFunctions(ctx context.Context, namespace string) ([]types.Fu
 		var functions []types.FunctionStatus
 		_ = json.Unmarshal(resp.Body(), &functions)
 		// Swarm edition of OF does not support namespaces and is simply returning empty array
-		return functions, nil
-	case fasthttp.StatusUnauthorized:
-		return nil, errors.New("OpenFaaS Credentials are invalid")
+		return functions, nextLink(string(resp.Header.Peek("Link"))), nil
 	default:
-		return nil, errors.New(fmt.Sprintf("Received unexpected Status Code %d", resp.StatusCode()))
+		return nil, "", newStatusError(resp.StatusCode())
+	}
+}
+
+// nextLink extracts the target of the rel="next" link from a Link header (RFC 8288), returning empty if there is none
+func nextLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+
+		for _, param := range parts[1:] {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || !strings.EqualFold(strings.TrimSpace(key), "rel") {
+				continue
+			}
+
+			for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)) {
+				if strings.EqualFold(rel, "next") {
+					return strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+				}
+			}
+		}
 	}
+	return ""
 }
@@ -9,21 +9,29 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
 	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
 	"github.com/valyala/fasthttp"
 
 	"github.com/openfaas/faas-provider/auth"
 	"github.com/openfaas/faas-provider/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
 func CreateClient(server *httptest.Server) *fasthttp.Client {
-	client := types2.MakeHTTPClient(true, 256, 30*time.Second)
+	client := types2.MakeHTTPClient(true, 256, 30*time.Second, 5*time.Second)
 	// TODO: For the future configure client with cert pool from the server
 	return client
 }
@@ -63,12 +71,12 @@ func TestClient_InvokeSync(t *testing.T) {
 	}))
 	defer server.Close()
 
-	openfaasClient := NewClient(CreateClient(server), nil, server.URL)
+	openfaasClient := NewClient(CreateClient(server), nil, server.URL, "")
 
 	authenticatedOpenFaaSClient := NewClient(CreateClient(server), &auth.BasicAuthCredentials{
 		User:     "User",
 		Password: "Invalid",
-	}, server.URL)
+	}, server.URL, "")
 
 	message := []byte("Test")
 	payload := types2.OpenFaaSInvocation{
@@ -87,33 +95,33 @@ func TestClient_InvokeSync(t *testing.T) {
 	t.Parallel()
 
 	t.Run("Should invoke the specified function", func(t *testing.T) {
-		resp, err := openfaasClient.InvokeSync(context.Background(), "exists", &payload)
+		resp, err := openfaasClient.InvokeSync(context.Background(), Function{Name: "exists"}, &payload)
 
 		assert.Nil(t, err, "Should not fail")
 		assert.Equal(t, string(resp), expectedResponse, "Did not receive expected response")
 	})
 
 	t.Run("Should except nil as body", func(t *testing.T) {
-		resp, err := openfaasClient.InvokeSync(context.Background(), "exists", &nilPayload)
+		resp, err := openfaasClient.InvokeSync(context.Background(), Function{Name: "exists"}, &nilPayload)
 
 		assert.Nil(t, err, "Should not fail")
 		assert.Equal(t, string(resp), expectedResponse, "Did not receive expected response")
 	})
 
 	t.Run("Should throw error if function does not exist", func(t *testing.T) {
-		_, err := openfaasClient.InvokeSync(context.Background(), "nonexisting", &payload)
+		_, err := openfaasClient.InvokeSync(context.Background(), Function{Name: "nonexisting"}, &payload)
 
 		assert.Error(t, err, "Function nonexisting is not deployed", "Did receive unexpected error")
 	})
 
 	t.Run("Should throw error if unauthorized", func(t *testing.T) {
-		_, err := authenticatedOpenFaaSClient.InvokeSync(context.Background(), "exists", &nilPayload)
+		_, err := authenticatedOpenFaaSClient.InvokeSync(context.Background(), Function{Name: "exists"}, &nilPayload)
 
 		assert.Error(t, err, "OpenFaaS Credentials are invalid", "Did receive unexpected error")
 	})
 
 	t.Run("Should throw error on unexpected status code", func(t *testing.T) {
-		_, err := openfaasClient.InvokeSync(context.Background(), "internal", &payload)
+		_, err := openfaasClient.InvokeSync(context.Background(), Function{Name: "internal"}, &payload)
 
 		assert.Error(t, err, "Received unexpected Status Code 500", "Did receive unexpected error")
 	})
@@ -153,12 +161,12 @@ func TestClient_InvokeAsync(t *testing.T) {
 	}))
 	defer server.Close()
 
-	openfaasClient := NewClient(CreateClient(server), nil, server.URL)
+	openfaasClient := NewClient(CreateClient(server), nil, server.URL, "")
 
 	authenticatedOpenFaaSClient := NewClient(CreateClient(server), &auth.BasicAuthCredentials{
 		User:     "User",
 		Password: "Invalid",
-	}, server.URL)
+	}, server.URL, "")
 
 	message := []byte("Test")
 	payload := types2.OpenFaaSInvocation{
@@ -177,38 +185,329 @@ func TestClient_InvokeAsync(t *testing.T) {
 	t.Parallel()
 
 	t.Run("Should invoke the specified function", func(t *testing.T) {
-		ok, err := openfaasClient.InvokeAsync(context.Background(), "exists", &payload)
+		ok, err := openfaasClient.InvokeAsync(context.Background(), Function{Name: "exists"}, &payload)
 
 		assert.Nil(t, err, "Should not fail")
 		assert.Equal(t, ok, true, "Did not receive expected response")
 	})
 
 	t.Run("Should except nil as body", func(t *testing.T) {
-		ok, err := openfaasClient.InvokeAsync(context.Background(), "exists", &nilPayload)
+		ok, err := openfaasClient.InvokeAsync(context.Background(), Function{Name: "exists"}, &nilPayload)
 
 		assert.Nil(t, err, "Should not fail")
 		assert.Equal(t, ok, true, "Did not receive expected response")
 	})
 
 	t.Run("Should throw error if function does not exist", func(t *testing.T) {
-		_, err := openfaasClient.InvokeAsync(context.Background(), "nonexisting", &payload)
+		_, err := openfaasClient.InvokeAsync(context.Background(), Function{Name: "nonexisting"}, &payload)
 
 		assert.Error(t, err, "Function nonexisting is not deployed", "Did receive unexpected error")
 	})
 
 	t.Run("Should throw error if unauthorized", func(t *testing.T) {
-		_, err := authenticatedOpenFaaSClient.InvokeAsync(context.Background(), "exists", &nilPayload)
+		_, err := authenticatedOpenFaaSClient.InvokeAsync(context.Background(), Function{Name: "exists"}, &nilPayload)
 
 		assert.Error(t, err, "OpenFaaS Credentials are invalid", "Did receive unexpected error")
 	})
 
 	t.Run("Should throw error on unexpected status code", func(t *testing.T) {
-		_, err := openfaasClient.InvokeAsync(context.Background(), "internal", &payload)
+		_, err := openfaasClient.InvokeAsync(context.Background(), Function{Name: "internal"}, &payload)
 
 		assert.Error(t, err, "Received unexpected Status Code 500", "Did receive unexpected error")
 	})
 }
 
+func TestClient_NamespaceInvocationStyle(t *testing.T) {
+	type received struct {
+		path      string
+		namespace string
+	}
+	requests := make(chan received, 1)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- received{path: r.URL.Path, namespace: r.Header.Get(NamespaceHeader)}
+		w.WriteHeader(202)
+	}))
+	defer server.Close()
+
+	message := []byte("Test")
+	payload := types2.OpenFaaSInvocation{
+		Topic:       "Billing",
+		Message:     &message,
+		ContentType: "text/plain",
+	}
+	namespaced := Function{Name: "biller", Namespace: "tenant"}
+
+	tests := []struct {
+		style     string
+		fn        Function
+		path      string
+		namespace string
+	}{
+		{style: "", fn: namespaced, path: "/async-function/biller.tenant"},
+		{style: config.NamespaceStyleSuffix, fn: namespaced, path: "/async-function/biller.tenant"},
+		{style: config.NamespaceStylePath, fn: namespaced, path: "/async-function/tenant/biller"},
+		{style: config.NamespaceStyleHeader, fn: namespaced, path: "/async-function/biller", namespace: "tenant"},
+		{style: config.NamespaceStylePath, fn: Function{Name: "biller"}, path: "/async-function/biller"},
+		{style: config.NamespaceStyleHeader, fn: Function{Name: "biller"}, path: "/async-function/biller"},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("Should target %s using style '%s'", tc.path, tc.style), func(t *testing.T) {
+			openfaasClient := NewClient(CreateClient(server), nil, server.URL, tc.style)
+
+			ok, err := openfaasClient.InvokeAsync(context.Background(), tc.fn, &payload)
+			assert.NoError(t, err, "Should not fail")
+			assert.True(t, ok, "Should be accepted")
+
+			req := <-requests
+			assert.Equal(t, tc.path, req.path, "Did not target expected url")
+			assert.Equal(t, tc.namespace, req.namespace, "Did not transmit expected namespace header")
+		})
+	}
+}
+
+func TestClient_AsyncQueue(t *testing.T) {
+	type received struct {
+		path  string
+		queue string
+	}
+	requests := make(chan received, 1)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- received{path: r.URL.Path, queue: r.Header.Get(QueueHeader)}
+		w.WriteHeader(202)
+	}))
+	defer server.Close()
+
+	message := []byte("Test")
+	payload := types2.OpenFaaSInvocation{Topic: "Billing", Message: &message, ContentType: "text/plain"}
+
+	t.Run("Should publish onto the named queue", func(t *testing.T) {
+		openfaasClient := NewClient(CreateClient(server), nil, server.URL, "").WithAsyncQueue("rabbitmq-work")
+
+		ok, err := openfaasClient.InvokeAsync(context.Background(), Function{Name: "biller"}, &payload)
+		assert.NoError(t, err, "Should not fail")
+		assert.True(t, ok, "Should be accepted")
+
+		req := <-requests
+		assert.Equal(t, "/async-function/biller", req.path, "Did not target expected url")
+		assert.Equal(t, "rabbitmq-work", req.queue, "Did not transmit expected queue header")
+	})
+
+	t.Run("Should use the default queue without a name", func(t *testing.T) {
+		openfaasClient := NewClient(CreateClient(server), nil, server.URL, "")
+
+		_, err := openfaasClient.InvokeAsync(context.Background(), Function{Name: "biller"}, &payload)
+		assert.NoError(t, err, "Should not fail")
+
+		req := <-requests
+		assert.Empty(t, req.queue, "Did not expect a queue header")
+	})
+}
+
+func TestClient_WithHeaders(t *testing.T) {
+	requests := make(chan http.Header, 1)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.Header.Clone()
+		if strings.HasPrefix(r.URL.Path, "/async-function/") {
+			w.WriteHeader(202)
+			return
+		}
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	message := []byte("Test")
+	payload := types2.OpenFaaSInvocation{Topic: "Billing", Message: &message, ContentType: "text/plain"}
+	openfaasClient := NewClient(CreateClient(server), nil, server.URL, "").WithHeaders(map[string]string{
+		"X-Tenant-Id":  "acme",
+		"Content-Type": "application/json",
+		"Topic":        "Static",
+	})
+
+	t.Run("Should set static headers on asynchronous invocations", func(t *testing.T) {
+		_, err := openfaasClient.InvokeAsync(context.Background(), Function{Name: "biller"}, &payload)
+		assert.NoError(t, err, "Should not fail")
+
+		headers := <-requests
+		assert.Equal(t, "acme", headers.Get("X-Tenant-Id"), "Did not transmit static header")
+		assert.Equal(t, "text/plain", headers.Get("Content-Type"), "Expected header of the message to take precedence")
+		assert.Equal(t, "Billing", headers.Get("Topic"), "Expected header of the message to take precedence")
+	})
+
+	t.Run("Should set static headers on synchronous invocations", func(t *testing.T) {
+		_, err := openfaasClient.InvokeSync(context.Background(), Function{Name: "biller"}, &payload)
+		assert.NoError(t, err, "Should not fail")
+
+		headers := <-requests
+		assert.Equal(t, "acme", headers.Get("X-Tenant-Id"), "Did not transmit static header")
+		assert.Equal(t, "text/plain", headers.Get("Content-Type"), "Expected header of the message to take precedence")
+	})
+}
+
+func TestClient_InvokeURL(t *testing.T) {
+	type received struct {
+		path   string
+		header http.Header
+	}
+	requests := make(chan received, 1)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- received{path: r.URL.Path, header: r.Header.Clone()}
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(500)
+			return
+		}
+		w.WriteHeader(201)
+		_, _ = w.Write([]byte("Hello"))
+	}))
+	defer server.Close()
+
+	message := []byte("Test")
+	payload := types2.OpenFaaSInvocation{Topic: "Billing", Message: &message, ContentType: "text/plain"}
+	openfaasClient := NewClient(CreateClient(server), &auth.BasicAuthCredentials{User: "User", Password: "Pass"}, "http://gateway:8080", "").WithHeaders(map[string]string{"X-Tenant-Id": "acme"})
+
+	t.Run("Should invoke the url without gateway credentials", func(t *testing.T) {
+		fn := Function{Name: server.URL + "/hook", URL: server.URL + "/hook", Static: true}
+
+		response, err := openfaasClient.InvokeSync(context.Background(), fn, &payload)
+		assert.NoError(t, err, "Should accept any 2xx status")
+		assert.Equal(t, []byte("Hello"), response)
+
+		request := <-requests
+		assert.Equal(t, "/hook", request.path)
+		assert.Empty(t, request.header.Get("Authorization"), "Should not transmit gateway credentials")
+		assert.Equal(t, "acme", request.header.Get("X-Tenant-Id"), "Did not transmit static header")
+		assert.Equal(t, "Billing", request.header.Get("Topic"), "Did not transmit topic")
+	})
+
+	t.Run("Should invoke the url synchronously for asynchronous invocations", func(t *testing.T) {
+		fn := Function{Name: server.URL + "/hook", URL: server.URL + "/hook", Static: true}
+
+		ok, err := openfaasClient.InvokeAsync(context.Background(), fn, &payload)
+		assert.NoError(t, err, "Should not fail")
+		assert.True(t, ok)
+		assert.Equal(t, "/hook", (<-requests).path)
+	})
+
+	t.Run("Should fail on other status codes", func(t *testing.T) {
+		fn := Function{Name: server.URL + "/broken", URL: server.URL + "/broken", Static: true}
+
+		_, err := openfaasClient.InvokeSync(context.Background(), fn, &payload)
+		<-requests
+		assert.Error(t, err, "Should fail")
+		assert.Contains(t, err.Error(), "Received unexpected Status Code 500")
+	})
+}
+
+func TestClient_RedeliveryHeaders(t *testing.T) {
+	requests := make(chan http.Header, 1)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.Header.Clone()
+		w.WriteHeader(202)
+	}))
+	defer server.Close()
+
+	message := []byte("Test")
+	openfaasClient := NewClient(CreateClient(server), nil, server.URL, "")
+
+	t.Run("Should mark the first delivery as not redelivered", func(t *testing.T) {
+		_, err := openfaasClient.InvokeAsync(context.Background(), Function{Name: "biller"}, &types2.OpenFaaSInvocation{Topic: "Billing", Message: &message})
+		assert.NoError(t, err, "Should not fail")
+
+		headers := <-requests
+		assert.Equal(t, "false", headers.Get(RedeliveredHeader))
+		assert.Empty(t, headers.Get(RetryCountHeader), "Expected no retry count on the first attempt")
+	})
+
+	t.Run("Should mark redelivered messages and transmit the retry count", func(t *testing.T) {
+		_, err := openfaasClient.InvokeAsync(context.Background(), Function{Name: "biller"}, &types2.OpenFaaSInvocation{Topic: "Billing", Message: &message, Redelivered: true, Retries: 2})
+		assert.NoError(t, err, "Should not fail")
+
+		headers := <-requests
+		assert.Equal(t, "true", headers.Get(RedeliveredHeader))
+		assert.Equal(t, "2", headers.Get(RetryCountHeader))
+	})
+}
+
+func TestClient_DeadlineHeader(t *testing.T) {
+	requests := make(chan http.Header, 1)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.Header.Clone()
+		w.WriteHeader(202)
+	}))
+	defer server.Close()
+
+	message := []byte("Test")
+	openfaasClient := NewClient(CreateClient(server), nil, server.URL, "")
+
+	t.Run("Should transmit the remaining time until the deadline", func(t *testing.T) {
+		invocation := &types2.OpenFaaSInvocation{Topic: "Billing", Message: &message, Deadline: time.Now().Add(time.Minute)}
+		_, err := openfaasClient.InvokeAsync(context.Background(), Function{Name: "biller"}, invocation)
+		assert.NoError(t, err, "Should not fail")
+
+		remaining, err := strconv.Atoi((<-requests).Get(DeadlineHeader))
+		assert.NoError(t, err, "Expected the remaining milliseconds")
+		assert.InDelta(t, time.Minute.Milliseconds(), remaining, float64(5*time.Second.Milliseconds()))
+	})
+
+	t.Run("Should not transmit a deadline if the message has none", func(t *testing.T) {
+		_, err := openfaasClient.InvokeAsync(context.Background(), Function{Name: "biller"}, &types2.OpenFaaSInvocation{Topic: "Billing", Message: &message})
+		assert.NoError(t, err, "Should not fail")
+
+		assert.Empty(t, (<-requests).Get(DeadlineHeader))
+	})
+}
+
+func TestClient_InvokeMethod(t *testing.T) {
+	methods := make(chan string, 1)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods <- r.Method
+		if r.URL.Path == "/function/biller" {
+			w.WriteHeader(200)
+			return
+		}
+		w.WriteHeader(202)
+	}))
+	defer server.Close()
+
+	openfaasClient := NewClient(CreateClient(server), nil, server.URL, "")
+	message := []byte("Test")
+	payload := types2.OpenFaaSInvocation{Topic: "Billing", Message: &message, ContentType: "text/plain"}
+
+	for method, expected := range map[string]string{"": "POST", "POST": "POST", "PUT": "PUT", "PATCH": "PATCH"} {
+		t.Run(fmt.Sprintf("Should invoke using %s if method is '%s'", expected, method), func(t *testing.T) {
+			fn := Function{Name: "biller", Method: method}
+
+			ok, err := openfaasClient.InvokeAsync(context.Background(), fn, &payload)
+			assert.NoError(t, err, "Should not fail")
+			assert.True(t, ok, "Should be accepted")
+			assert.Equal(t, expected, <-methods)
+
+			_, err = openfaasClient.InvokeSync(context.Background(), fn, &payload)
+			assert.NoError(t, err, "Should not fail")
+			assert.Equal(t, expected, <-methods)
+		})
+	}
+
+	t.Run("Should reject methods that are not allowed", func(t *testing.T) {
+		fn := Function{Name: "biller", Method: "DELETE"}
+
+		_, err := openfaasClient.InvokeAsync(context.Background(), fn, &payload)
+		assert.Error(t, err, "Should fail")
+		assert.Contains(t, err.Error(), "is not one of POST, PUT, PATCH")
+
+		_, err = openfaasClient.InvokeSync(context.Background(), fn, &payload)
+		assert.Error(t, err, "Should fail")
+		assert.Len(t, methods, 0, "Should not perform a request")
+	})
+}
+
 func TestClient_HasNamespaceSupport(t *testing.T) {
 	k8sOF := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if user, pass, ok := r.BasicAuth(); ok {
@@ -245,19 +544,19 @@ func TestClient_HasNamespaceSupport(t *testing.T) {
 		_, _ = w.Write(out)
 	}))
 
-	ofK8SClient := NewClient(CreateClient(k8sOF), nil, k8sOF.URL)
+	ofK8SClient := NewClient(CreateClient(k8sOF), nil, k8sOF.URL, "")
 
-	ofSwarmClient := NewClient(CreateClient(swarmOF), nil, swarmOF.URL)
+	ofSwarmClient := NewClient(CreateClient(swarmOF), nil, swarmOF.URL, "")
 
 	authenticatedOpenFaaSClient := NewClient(CreateClient(k8sOF), &auth.BasicAuthCredentials{
 		User:     "User",
 		Password: "Invalid",
-	}, k8sOF.URL)
+	}, k8sOF.URL, "")
 
 	failingOpenFaaSClient := NewClient(CreateClient(k8sOF), &auth.BasicAuthCredentials{
 		User:     "User",
 		Password: "Pass",
-	}, k8sOF.URL)
+	}, k8sOF.URL, "")
 
 	t.Parallel()
 
@@ -368,12 +667,12 @@ func TestClient_GetFunctions(t *testing.T) {
 	}))
 	defer server.Close()
 
-	openfaasClient := NewClient(CreateClient(server), nil, server.URL)
+	openfaasClient := NewClient(CreateClient(server), nil, server.URL, "")
 
 	authenticatedOpenFaaSClient := NewClient(CreateClient(server), &auth.BasicAuthCredentials{
 		User:     "User",
 		Password: "Invalid",
-	}, server.URL)
+	}, server.URL, "")
 
 	t.Parallel()
 
@@ -415,6 +714,95 @@ func TestClient_GetFunctions(t *testing.T) {
 	})
 }
 
+// newPaginatedGateway serves the functions of the namespaces in pages of the provided size, linking to the next page
+func newPaginatedGateway(functions map[string][]types.FunctionStatus, size int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespace := r.URL.Query().Get("namespace")
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+		all := functions[namespace]
+		start, end := page*size, (page+1)*size
+		if end < len(all) {
+			w.Header().Set("Link", fmt.Sprintf(`</system/functions?namespace=%s&page=%d>; rel="next", </system/functions?namespace=%s&page=0>; rel="first"`, namespace, page+1, namespace))
+		} else {
+			end = len(all)
+		}
+
+		out, _ := json.Marshal(all[start:end])
+		_, _ = w.Write(out)
+	}))
+}
+
+func TestClient_GetFunctionsPagination(t *testing.T) {
+	var functions []types.FunctionStatus
+	for i := 0; i < 7; i++ {
+		functions = append(functions, types.FunctionStatus{Name: fmt.Sprintf("function-%d", i), Namespace: "paginated"})
+	}
+	server := newPaginatedGateway(map[string][]types.FunctionStatus{"paginated": functions, "": functions[:2]}, 3)
+	defer server.Close()
+
+	client := NewClient(CreateClient(server), nil, server.URL, "")
+
+	t.Run("Should follow the next links until the last page", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.FunctionsCrawled.WithLabelValues("paginated"))
+
+		found, err := client.GetFunctions(context.Background(), "paginated")
+
+		assert.NoError(t, err, "Should not fail")
+		assert.Equal(t, functions, found, "Expected the functions of all pages")
+		assert.Equal(t, before+7, testutil.ToFloat64(metrics.FunctionsCrawled.WithLabelValues("paginated")))
+	})
+
+	t.Run("Should behave unchanged if the gateway does not paginate", func(t *testing.T) {
+		found, err := client.GetFunctions(context.Background(), "")
+
+		assert.NoError(t, err, "Should not fail")
+		assert.Equal(t, functions[:2], found)
+	})
+
+	t.Run("Should refuse next links to other hosts", func(t *testing.T) {
+		redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Link", `<http://attacker.example/system/functions>; rel="next"`)
+			_, _ = w.Write([]byte("[]"))
+		}))
+		defer redirecting.Close()
+
+		_, err := NewClient(CreateClient(redirecting), nil, redirecting.URL, "").GetFunctions(context.Background(), "")
+
+		assert.Error(t, err, "Should fail")
+		assert.Contains(t, err.Error(), "not served by the gateway")
+	})
+
+	t.Run("Should stop following next links after the maximum of pages", func(t *testing.T) {
+		var requests int32
+		looping := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.Header().Set("Link", `</system/functions>; rel="next"`)
+			_, _ = w.Write([]byte("[]"))
+		}))
+		defer looping.Close()
+
+		_, err := NewClient(CreateClient(looping), nil, looping.URL, "").GetFunctions(context.Background(), "")
+
+		assert.Error(t, err, "Should fail")
+		assert.Equal(t, int32(maxFunctionPages), atomic.LoadInt32(&requests))
+	})
+}
+
+func TestNextLink(t *testing.T) {
+	t.Run("Should return the target of the next link", func(t *testing.T) {
+		assert.Equal(t, "/system/functions?page=2", nextLink(`</system/functions?page=0>; rel="first", </system/functions?page=2>; rel="next"`))
+		assert.Equal(t, "http://gateway:8080/page/2", nextLink(`<http://gateway:8080/page/2>; title="more"; REL=next`))
+		assert.Equal(t, "/page/2", nextLink(`</page/2>; rel="prefetch next"`))
+	})
+
+	t.Run("Should return empty without a next link", func(t *testing.T) {
+		assert.Empty(t, nextLink(""))
+		assert.Empty(t, nextLink(`</system/functions?page=0>; rel="first"`))
+		assert.Empty(t, nextLink(`/page/2; rel="next"`))
+	})
+}
+
 func TestClient_GetNamespaces(t *testing.T) {
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		namespaces := []string{
@@ -446,17 +834,17 @@ func TestClient_GetNamespaces(t *testing.T) {
 	}))
 	defer server.Close()
 
-	openfaasClient := NewClient(CreateClient(server), nil, server.URL)
+	openfaasClient := NewClient(CreateClient(server), nil, server.URL, "")
 
 	authenticatedOpenFaaSClient := NewClient(CreateClient(server), &auth.BasicAuthCredentials{
 		User:     "User",
 		Password: "Invalid",
-	}, server.URL)
+	}, server.URL, "")
 
 	failingOpenFaaSClient := NewClient(CreateClient(server), &auth.BasicAuthCredentials{
 		User:     "User",
 		Password: "Pass",
-	}, server.URL)
+	}, server.URL, "")
 
 	t.Parallel()
 
@@ -482,7 +870,7 @@ func TestClient_GetNamespaces(t *testing.T) {
 }
 
 func TestClient_Edge(t *testing.T) {
-	openfaasClient := NewClient(CreateClient(nil), nil, "ftp://localhost/")
+	openfaasClient := NewClient(CreateClient(nil), nil, "ftp://localhost/", "")
 
 	payload := types2.OpenFaaSInvocation{
 		Topic:           "",
@@ -494,10 +882,10 @@ func TestClient_Edge(t *testing.T) {
 	t.Run("Should throw error if invalid base URL is provided", func(t *testing.T) {
 		var err error
 
-		_, err = openfaasClient.InvokeSync(context.Background(), "exists", &payload)
+		_, err = openfaasClient.InvokeSync(context.Background(), Function{Name: "exists"}, &payload)
 		assert.Error(t, err, "unsupported protocol ftp. http and https are supported", "Did receive unexpected error")
 
-		_, err = openfaasClient.InvokeAsync(context.Background(), "exists", &payload)
+		_, err = openfaasClient.InvokeAsync(context.Background(), Function{Name: "exists"}, &payload)
 		assert.Error(t, err, "unsupported protocol ftp. http and https are supported", "Did receive unexpected error")
 
 		_, err = openfaasClient.GetNamespaces(context.Background())
@@ -510,3 +898,130 @@ func TestClient_Edge(t *testing.T) {
 		assert.Error(t, err, "unsupported protocol ftp. http and https are supported", "Did receive unexpected error")
 	})
 }
+
+// resettingServer resets the first accepted connection after reading the request and answers the following ones
+func resettingServer(t *testing.T, body string) (string, *int32) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	var accepted int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			_, _ = conn.Read(make([]byte, 4096))
+			if atomic.AddInt32(&accepted, 1) == 1 {
+				_ = conn.(*net.TCPConn).SetLinger(0)
+				_ = conn.Close()
+				continue
+			}
+
+			fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", len(body), body)
+			_ = conn.Close()
+		}
+	}()
+
+	return "http://" + listener.Addr().String(), &accepted
+}
+
+func TestClient_ConnectionReset(t *testing.T) {
+	// Disables the retries of fasthttp itself, so that only the retry of the client is exercised
+	newClient := func(url string) *Client {
+		return NewClient(&fasthttp.Client{MaxIdemponentCallAttempts: 1}, nil, url, "")
+	}
+
+	t.Run("Should retry an idempotent request once", func(t *testing.T) {
+		url, accepted := resettingServer(t, `["faas"]`)
+
+		namespaces, err := newClient(url).GetNamespaces(context.Background())
+
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, []string{"faas"}, namespaces)
+		assert.Equal(t, int32(2), atomic.LoadInt32(accepted))
+	})
+
+	t.Run("Should not retry a non idempotent request", func(t *testing.T) {
+		url, accepted := resettingServer(t, "")
+
+		_, err := newClient(url).InvokeSync(context.Background(), Function{Name: "exists"}, &types2.OpenFaaSInvocation{})
+
+		assert.Error(t, err, "should throw")
+		assert.Equal(t, int32(1), atomic.LoadInt32(accepted))
+	})
+}
+
+func TestClient_WithHostHeader(t *testing.T) {
+	var lock sync.Mutex
+	var hosts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		hosts = append(hosts, r.Host)
+		lock.Unlock()
+
+		if r.URL.Path == "/system/functions" {
+			_, _ = w.Write([]byte("[]"))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	message := []byte("Test")
+	invocation := &types2.OpenFaaSInvocation{Topic: "billing", Message: &message}
+
+	t.Run("Should send the overridden host while dialing the gateway url", func(t *testing.T) {
+		hosts = nil
+		client := NewClient(CreateClient(server), nil, server.URL, "").WithHostHeader("gateway.example.com")
+
+		_, err := client.GetFunctions(context.Background(), "")
+		assert.NoError(t, err, "should not throw")
+		_, err = client.InvokeAsync(context.Background(), Function{Name: "biller"}, invocation)
+		assert.NoError(t, err, "should not throw")
+
+		assert.Equal(t, []string{"gateway.example.com", "gateway.example.com"}, hosts, "Expected crawl and invoke to use the override")
+	})
+
+	t.Run("Should send the host of the url without override", func(t *testing.T) {
+		hosts = nil
+		client := NewClient(CreateClient(server), nil, server.URL, "")
+
+		_, err := client.InvokeAsync(context.Background(), Function{Name: "biller"}, invocation)
+		assert.NoError(t, err, "should not throw")
+
+		assert.Equal(t, []string{strings.TrimPrefix(server.URL, "http://")}, hosts)
+	})
+}
+
+func TestClient_WithKeepAlives(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Close", strconv.FormatBool(r.Close))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	closes := func(openfaasClient *Client) string {
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+
+		req.SetRequestURI(server.URL)
+		err := openfaasClient.do(context.Background(), req, resp)
+		assert.NoError(t, err, "should not throw")
+		return string(resp.Header.Peek("X-Close"))
+	}
+
+	t.Run("Should keep connections alive by default", func(t *testing.T) {
+		assert.Equal(t, "false", closes(NewClient(CreateClient(server), nil, server.URL, "")))
+	})
+
+	t.Run("Should close connections after each request if disabled", func(t *testing.T) {
+		assert.Equal(t, "true", closes(NewClient(CreateClient(server), nil, server.URL, "").WithKeepAlives(false)))
+	})
+}
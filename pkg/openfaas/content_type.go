@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"bytes"
+	"encoding/json"
+	"unicode"
+	"unicode/utf8"
+
+	internal "github.com/Templum/rabbitmq-connector/pkg/types"
+)
+
+// Content types detected by sniffContentType
+const (
+	ContentTypeJSON   = "application/json"
+	ContentTypeText   = "text/plain; charset=utf-8"
+	ContentTypeBinary = "application/octet-stream"
+)
+
+// WithContentTypeSniffing detects the content type of messages without one from their body if enabled, messages
+// whose content type can not be detected, like empty ones, are sent with the fallback. An empty fallback sends none.
+func (g *GatewayInvoker) WithContentTypeSniffing(enabled bool, fallback string) *GatewayInvoker {
+	g.sniffContentType = enabled
+	g.defaultContentType = fallback
+	return g
+}
+
+// contentType returns the content type of the message, falling back to the sniffed or default one if it has none
+func (g *GatewayInvoker) contentType(invocation *internal.OpenFaaSInvocation) string {
+	if len(invocation.ContentType) > 0 {
+		return invocation.ContentType
+	}
+
+	if g.sniffContentType && invocation.Message != nil {
+		if sniffed := sniffContentType(*invocation.Message); len(sniffed) > 0 {
+			return sniffed
+		}
+	}
+	return g.defaultContentType
+}
+
+// sniffContentType detects json objects and arrays, utf-8 text without control characters and binary bodies.
+// Json scalars like 42 are considered text, as they are indistinguishable from it. Empty bodies are not detected.
+func sniffContentType(body []byte) string {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return ""
+	}
+
+	if (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		return ContentTypeJSON
+	}
+
+	if !utf8.Valid(body) {
+		return ContentTypeBinary
+	}
+	for _, r := range string(body) {
+		if unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r' {
+			return ContentTypeBinary
+		}
+	}
+	return ContentTypeText
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSniffContentType(t *testing.T) {
+	t.Run("Should detect json objects and arrays", func(t *testing.T) {
+		assert.Equal(t, ContentTypeJSON, sniffContentType([]byte(`{"amount": 42}`)))
+		assert.Equal(t, ContentTypeJSON, sniffContentType([]byte("\n [1, 2]\n")))
+	})
+
+	t.Run("Should detect plaintext", func(t *testing.T) {
+		assert.Equal(t, ContentTypeText, sniffContentType([]byte("Hello World\n")))
+		assert.Equal(t, ContentTypeText, sniffContentType([]byte("Grüße")))
+		assert.Equal(t, ContentTypeText, sniffContentType([]byte(`{"broken": `)), "Expected invalid json to be text")
+		assert.Equal(t, ContentTypeText, sniffContentType([]byte(`42`)), "Expected json scalars to be text")
+	})
+
+	t.Run("Should detect binary", func(t *testing.T) {
+		assert.Equal(t, ContentTypeBinary, sniffContentType([]byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a}))
+		assert.Equal(t, ContentTypeBinary, sniffContentType([]byte("text\x00with nul")))
+	})
+
+	t.Run("Should not detect empty bodies", func(t *testing.T) {
+		assert.Empty(t, sniffContentType([]byte(" \n")))
+		assert.Empty(t, sniffContentType(nil))
+	})
+}
+
+func TestClient_WithContentTypeSniffing(t *testing.T) {
+	contentTypes := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentTypes <- r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	invoke := func(client *Client, contentType string, message []byte) string {
+		_, err := client.InvokeAsync(context.Background(), Function{Name: "biller"}, &types2.OpenFaaSInvocation{Topic: "billing", ContentType: contentType, Message: &message})
+		assert.NoError(t, err, "should not throw")
+		return <-contentTypes
+	}
+
+	sniffing := NewClient(CreateClient(server), nil, server.URL, "").WithContentTypeSniffing(true, "application/x-custom")
+
+	t.Run("Should send a json body as application/json", func(t *testing.T) {
+		assert.Equal(t, ContentTypeJSON, invoke(sniffing, "", []byte(`{"amount": 42}`)))
+	})
+
+	t.Run("Should send a plaintext body as text/plain", func(t *testing.T) {
+		assert.Equal(t, ContentTypeText, invoke(sniffing, "", []byte("Hello World")))
+	})
+
+	t.Run("Should send a binary body as application/octet-stream", func(t *testing.T) {
+		assert.Equal(t, ContentTypeBinary, invoke(sniffing, "", []byte{0x00, 0xff, 0xfe}))
+	})
+
+	t.Run("Should fall back to the default for undetectable bodies", func(t *testing.T) {
+		assert.Equal(t, "application/x-custom", invoke(sniffing, "", []byte{}))
+	})
+
+	t.Run("Should keep the content type of the message", func(t *testing.T) {
+		assert.Equal(t, "text/csv", invoke(sniffing, "text/csv", []byte(`{"amount": 42}`)))
+	})
+
+	t.Run("Should only use the default while sniffing is disabled", func(t *testing.T) {
+		client := NewClient(CreateClient(server), nil, server.URL, "").WithContentTypeSniffing(false, "application/x-custom")
+
+		assert.Equal(t, "application/x-custom", invoke(client, "", []byte(`{"amount": 42}`)))
+	})
+}
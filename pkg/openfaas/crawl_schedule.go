@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"hash/fnv"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+// CrawlSchedule adapts the crawl interval of every namespace to how often its functions change. A namespace starts
+// at the min interval, which doubles on every crawl without changes up to the max interval, so that stable
+// namespaces are rarely crawled. Once a crawl finds changes, the namespace returns to the min interval. Between two
+// crawls the functions of the previous one are reused, hence changes of stable namespaces take up to the max
+// interval to be picked up. It is safe for concurrent use.
+type CrawlSchedule struct {
+	min time.Duration
+	max time.Duration
+	now func() time.Time
+
+	lock       sync.Mutex
+	namespaces map[string]*namespaceSchedule
+}
+
+type namespaceSchedule struct {
+	interval    time.Duration
+	next        time.Time
+	fingerprint uint64
+	functions   []types.FunctionStatus
+}
+
+// NewCrawlSchedule creates a schedule bounded by the intervals, a min interval below the refresh time means a
+// namespace is crawled on every refresh while it changes
+func NewCrawlSchedule(minInterval time.Duration, maxInterval time.Duration) *CrawlSchedule {
+	return &CrawlSchedule{
+		min:        minInterval,
+		max:        maxInterval,
+		now:        time.Now,
+		namespaces: map[string]*namespaceSchedule{},
+	}
+}
+
+// Cached returns the functions of the previous crawl, as long as the namespace is not due for crawling
+func (s *CrawlSchedule) Cached(namespace string) ([]types.FunctionStatus, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	schedule, known := s.namespaces[namespace]
+	if !known || !s.now().Before(schedule.next) {
+		return nil, false
+	}
+	return schedule.functions, true
+}
+
+// Crawled records the functions of a crawl and schedules the next crawl of the namespace
+func (s *CrawlSchedule) Crawled(namespace string, functions []types.FunctionStatus) {
+	fingerprint := fingerprintFunctions(functions)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	schedule, known := s.namespaces[namespace]
+	switch {
+	case !known:
+		schedule = &namespaceSchedule{interval: s.min}
+		s.namespaces[namespace] = schedule
+	case schedule.fingerprint != fingerprint:
+		schedule.interval = s.min
+	default:
+		schedule.interval *= 2
+		if schedule.interval < s.min {
+			schedule.interval = s.min
+		}
+		if schedule.interval > s.max {
+			schedule.interval = s.max
+		}
+	}
+
+	schedule.fingerprint = fingerprint
+	schedule.functions = functions
+	schedule.next = s.now().Add(schedule.interval)
+}
+
+// Retain forgets the namespaces that no longer exist, so that a recreated namespace is crawled right away
+func (s *CrawlSchedule) Retain(namespaces []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	existing := make(map[string]struct{}, len(namespaces))
+	for _, ns := range namespaces {
+		existing[ns] = struct{}{}
+	}
+	for ns := range s.namespaces {
+		if _, exists := existing[ns]; !exists {
+			delete(s.namespaces, ns)
+		}
+	}
+}
+
+// Interval returns the current crawl interval of the namespace, zero if it was not crawled yet
+func (s *CrawlSchedule) Interval(namespace string) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if schedule, known := s.namespaces[namespace]; known {
+		return schedule.interval
+	}
+	return 0
+}
+
+// fingerprintFunctions hashes the parts of the functions the topic map is derived from, ignoring volatile
+// ones like the invocation count
+func fingerprintFunctions(functions []types.FunctionStatus) uint64 {
+	sorted := make([]types.FunctionStatus, len(functions))
+	copy(sorted, functions)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	hash := fnv.New64a()
+	for _, fn := range sorted {
+		_, _ = hash.Write([]byte(fn.Name))
+		_, _ = hash.Write([]byte{0, boolByte(fn.AvailableReplicas > 0), 0})
+
+		if fn.Annotations != nil {
+			fingerprintMap(hash, *fn.Annotations)
+		}
+		// Topics may be read from the environment as well
+		_, _ = hash.Write([]byte{1})
+		fingerprintMap(hash, fn.EnvVars)
+	}
+	return hash.Sum64()
+}
+
+// fingerprintMap writes the sorted entries of the map to the hash
+func fingerprintMap(hash io.Writer, entries map[string]string) {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		_, _ = hash.Write([]byte(key + "=" + strconv.Quote(entries[key])))
+		_, _ = hash.Write([]byte{0})
+	}
+}
+
+func boolByte(value bool) byte {
+	if value {
+		return 1
+	}
+	return 0
+}
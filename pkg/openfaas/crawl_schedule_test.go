@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCrawlSchedule(t *testing.T) {
+	billing := map[string]string{"topic": "billing"}
+	invoice := map[string]string{"topic": "billing,invoice"}
+	stable := []types.FunctionStatus{{Name: "biller", Annotations: &billing, AvailableReplicas: 1}}
+
+	now := time.Now()
+	target := NewCrawlSchedule(time.Minute, 8*time.Minute)
+	target.now = func() time.Time { return now }
+
+	t.Run("Should crawl unknown namespaces right away", func(t *testing.T) {
+		_, cached := target.Cached("faas")
+		assert.False(t, cached)
+		assert.Equal(t, time.Duration(0), target.Interval("faas"))
+	})
+
+	t.Run("Should back off stable namespaces up to the max interval", func(t *testing.T) {
+		for _, expected := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 8 * time.Minute} {
+			// Volatile fields like the invocation count are no change
+			stable[0].InvocationCount++
+			target.Crawled("faas", stable)
+			assert.Equal(t, expected, target.Interval("faas"))
+
+			now = now.Add(expected - time.Second)
+			functions, cached := target.Cached("faas")
+			assert.True(t, cached, "Expected the namespace not to be due within its interval")
+			assert.Equal(t, stable, functions)
+
+			now = now.Add(time.Second)
+			_, cached = target.Cached("faas")
+			assert.False(t, cached, "Expected the namespace to be due after its interval")
+		}
+	})
+
+	t.Run("Should return to the min interval once the namespace changes", func(t *testing.T) {
+		target.Crawled("faas", []types.FunctionStatus{{Name: "biller", Annotations: &invoice, AvailableReplicas: 1}})
+		assert.Equal(t, time.Minute, target.Interval("faas"))
+
+		target.Crawled("faas", []types.FunctionStatus{{Name: "biller", Annotations: &invoice}})
+		assert.Equal(t, time.Minute, target.Interval("faas"), "Expected the readiness to be a change")
+
+		target.Crawled("faas", []types.FunctionStatus{{Name: "biller", Annotations: &invoice}})
+		assert.Equal(t, 2*time.Minute, target.Interval("faas"))
+
+		target.Crawled("faas", []types.FunctionStatus{{Name: "biller", Annotations: &invoice, EnvVars: map[string]string{"CONNECTOR_TOPICS": "transport"}}})
+		assert.Equal(t, time.Minute, target.Interval("faas"), "Expected the environment to be a change")
+	})
+
+	t.Run("Should forget namespaces that no longer exist", func(t *testing.T) {
+		target.Retain([]string{"other"})
+
+		_, cached := target.Cached("faas")
+		assert.False(t, cached)
+		assert.Equal(t, time.Duration(0), target.Interval("faas"))
+	})
+}
+
+func TestCacher_CrawlSchedule(t *testing.T) {
+	annotations := map[string]string{"topic": "billing"}
+
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetNamespaces", mock.Anything).Return([]string{"faas"}, nil)
+	clientMock.On("GetFunctions", "faas").Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+
+	cache := NewTopicFunctionCache()
+	target := NewController(&config.Controller{CrawlMinInterval: time.Minute, CrawlMaxInterval: time.Hour}, clientMock, cache)
+
+	t.Run("Should reuse the functions of a namespace that is not due", func(t *testing.T) {
+		target.refreshTick(context.Background(), true)
+		target.refreshTick(context.Background(), true)
+
+		clientMock.AssertNumberOfCalls(t, "GetFunctions", 1)
+		assert.Equal(t, []Function{{Name: "biller", Namespace: "faas"}}, cache.GetCachedValues("billing"))
+	})
+
+	t.Run("Should crawl the namespace again once it is due", func(t *testing.T) {
+		target.schedule.now = func() time.Time { return time.Now().Add(time.Minute) }
+		target.refreshTick(context.Background(), true)
+
+		clientMock.AssertNumberOfCalls(t, "GetFunctions", 2)
+		assert.Equal(t, 2*time.Minute, target.schedule.Interval("faas"))
+	})
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	internal "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/valyala/fasthttp"
+)
+
+// InvokeEncoding decides how the message is encoded as body of an invocation
+type InvokeEncoding string
+
+const (
+	// EncodingRaw passes the message body through as is, which is the default
+	EncodingRaw InvokeEncoding = "raw"
+	// EncodingJSON wraps the message body and its properties into a json object
+	EncodingJSON InvokeEncoding = "json"
+	// EncodingForm sends the message body and its properties as form fields
+	EncodingForm InvokeEncoding = "form"
+)
+
+// ParseInvokeEncoding validates the provided encoding, ignoring its case
+func ParseInvokeEncoding(encoding string) (InvokeEncoding, error) {
+	switch normalized := InvokeEncoding(strings.ToLower(strings.TrimSpace(encoding))); normalized {
+	case EncodingRaw, EncodingJSON, EncodingForm:
+		return normalized, nil
+	default:
+		return "", fmt.Errorf("invoke encoding %s is not one of %s, %s, %s", encoding, EncodingRaw, EncodingJSON, EncodingForm)
+	}
+}
+
+// invocationEnvelope is the json body of an invocation with json encoding
+type invocationEnvelope struct {
+	Topic           string          `json:"topic"`
+	CorrelationID   string          `json:"correlation_id,omitempty"`
+	ContentType     string          `json:"content_type,omitempty"`
+	ContentEncoding string          `json:"content_encoding,omitempty"`
+	Redelivered     bool            `json:"redelivered"`
+	Retries         int             `json:"retries,omitempty"`
+	Body            json.RawMessage `json:"body"`
+}
+
+// setBody encodes the message as body of the request according to the encoding of the function. It has to be
+// called after the message headers were set, as wrapping the message replaces its content type.
+func setBody(req *fasthttp.Request, fn Function, invocation *internal.OpenFaaSInvocation) error {
+	var message []byte
+	if invocation.Message != nil {
+		message = *invocation.Message
+	}
+
+	switch fn.Encoding {
+	case EncodingJSON:
+		body, err := json.Marshal(invocationEnvelope{
+			Topic:           invocation.Topic,
+			CorrelationID:   invocation.CorrelationID,
+			ContentType:     invocation.ContentType,
+			ContentEncoding: invocation.ContentEncoding,
+			Redelivered:     invocation.Redelivered,
+			Retries:         invocation.Retries,
+			Body:            jsonBody(message),
+		})
+		if err != nil {
+			return err
+		}
+		req.SetBodyRaw(body)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Del("Content-Encoding")
+	case EncodingForm:
+		form := url.Values{}
+		form.Set("topic", invocation.Topic)
+		form.Set("correlation_id", invocation.CorrelationID)
+		form.Set("content_type", invocation.ContentType)
+		form.Set("redelivered", strconv.FormatBool(invocation.Redelivered))
+		form.Set("retries", strconv.Itoa(invocation.Retries))
+		form.Set("body", string(message))
+		req.SetBodyString(form.Encode())
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Del("Content-Encoding")
+	default:
+		// The body is only read during the request, hence it is used directly instead of copying it
+		req.SetBodyRaw(message)
+	}
+	return nil
+}
+
+// jsonBody embeds the message as is if it is valid json, otherwise as json string
+func jsonBody(message []byte) json.RawMessage {
+	if len(message) > 0 && json.Valid(message) {
+		return message
+	}
+
+	quoted, _ := json.Marshal(string(message))
+	return quoted
+}
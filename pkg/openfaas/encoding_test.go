@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInvokeEncoding(t *testing.T) {
+	t.Run("Should accept the encodings regardless of their case", func(t *testing.T) {
+		for value, expected := range map[string]InvokeEncoding{"raw": EncodingRaw, "JSON": EncodingJSON, " Form ": EncodingForm} {
+			encoding, err := ParseInvokeEncoding(value)
+
+			assert.NoError(t, err, "should not throw")
+			assert.Equal(t, expected, encoding)
+		}
+	})
+
+	t.Run("Should reject unknown encodings", func(t *testing.T) {
+		_, err := ParseInvokeEncoding("xml")
+
+		assert.Error(t, err, "should throw")
+	})
+}
+
+func TestExtractEncodingFromAnnotations(t *testing.T) {
+	t.Run("Should read the encoding", func(t *testing.T) {
+		annotations := map[string]string{EncodingAnnotation: "form"}
+		assert.Equal(t, EncodingForm, extractEncodingFromAnnotations(types.FunctionStatus{Annotations: &annotations}))
+	})
+
+	t.Run("Should pass the message through for raw, invalid or absent encodings", func(t *testing.T) {
+		for _, value := range []string{"raw", "xml"} {
+			annotations := map[string]string{EncodingAnnotation: value}
+			assert.Empty(t, extractEncodingFromAnnotations(types.FunctionStatus{Annotations: &annotations}))
+		}
+		assert.Empty(t, extractEncodingFromAnnotations(types.FunctionStatus{}))
+	})
+}
+
+func TestClient_InvokeEncoding(t *testing.T) {
+	type received struct {
+		contentType     string
+		contentEncoding string
+		body            []byte
+	}
+	requests := make(chan received, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{contentType: r.Header.Get("Content-Type"), contentEncoding: r.Header.Get("Content-Encoding"), body: body}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := NewClient(CreateClient(server), nil, server.URL, "")
+	invoke := func(t *testing.T, encoding InvokeEncoding, message string) received {
+		body := []byte(message)
+		invocation := &types2.OpenFaaSInvocation{Topic: "billing", CorrelationID: "4711", ContentType: "text/plain", ContentEncoding: "identity", Message: &body, Retries: 2}
+
+		_, err := client.InvokeAsync(context.Background(), Function{Name: "biller", Encoding: encoding}, invocation)
+		assert.NoError(t, err, "should not throw")
+		return <-requests
+	}
+
+	t.Run("Should pass the message through by default", func(t *testing.T) {
+		req := invoke(t, "", "amount=42")
+
+		assert.Equal(t, "text/plain", req.contentType)
+		assert.Equal(t, "identity", req.contentEncoding)
+		assert.Equal(t, "amount=42", string(req.body))
+	})
+
+	t.Run("Should wrap the message into a json object", func(t *testing.T) {
+		req := invoke(t, EncodingJSON, `{"amount":42}`)
+
+		assert.Equal(t, "application/json", req.contentType)
+		assert.Empty(t, req.contentEncoding)
+		var envelope map[string]interface{}
+		assert.NoError(t, json.Unmarshal(req.body, &envelope), "should be valid json")
+		assert.Equal(t, map[string]interface{}{
+			"topic":            "billing",
+			"correlation_id":   "4711",
+			"content_type":     "text/plain",
+			"content_encoding": "identity",
+			"redelivered":      false,
+			"retries":          2.0,
+			"body":             map[string]interface{}{"amount": 42.0},
+		}, envelope)
+	})
+
+	t.Run("Should embed messages that are no json as string", func(t *testing.T) {
+		req := invoke(t, EncodingJSON, "amount=42")
+
+		var envelope map[string]interface{}
+		assert.NoError(t, json.Unmarshal(req.body, &envelope), "should be valid json")
+		assert.Equal(t, "amount=42", envelope["body"])
+	})
+
+	t.Run("Should send the message and its properties as form fields", func(t *testing.T) {
+		req := invoke(t, EncodingForm, "Hello & Goodbye")
+
+		assert.Equal(t, "application/x-www-form-urlencoded", req.contentType)
+		assert.Empty(t, req.contentEncoding)
+		form, err := url.ParseQuery(string(req.body))
+		assert.NoError(t, err, "should be form encoded")
+		assert.Equal(t, url.Values{
+			"topic":          {"billing"},
+			"correlation_id": {"4711"},
+			"content_type":   {"text/plain"},
+			"redelivered":    {"false"},
+			"retries":        {"2"},
+			"body":           {"Hello & Goodbye"},
+		}, form)
+	})
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Kinds of errors, which are used as label of the error metrics
+const (
+	ErrorKindTimeout    = "timeout"
+	ErrorKindConnection = "connection"
+	ErrorKind4xx        = "4xx"
+	ErrorKind5xx        = "5xx"
+	ErrorKindOther      = "other"
+)
+
+// StatusError is returned if the gateway responds with an unexpected status code
+type StatusError struct {
+	StatusCode int
+	message    string
+}
+
+func newStatusError(statusCode int) *StatusError {
+	if statusCode == fasthttp.StatusUnauthorized {
+		return &StatusError{StatusCode: statusCode, message: "OpenFaaS Credentials are invalid"}
+	}
+	return &StatusError{StatusCode: statusCode, message: fmt.Sprintf("Received unexpected Status Code %d", statusCode)}
+}
+
+func (e *StatusError) Error() string {
+	return e.message
+}
+
+// Retryable is false for 4xx responses, as the function rejected the message itself. Responses caused by the
+// connector or the deployment, like invalid credentials, a missing function or rate limiting, remain retryable.
+func (e *StatusError) Retryable() bool {
+	switch e.StatusCode {
+	case fasthttp.StatusUnauthorized, fasthttp.StatusForbidden, fasthttp.StatusNotFound, fasthttp.StatusRequestTimeout, fasthttp.StatusTooManyRequests:
+		return true
+	default:
+		return e.StatusCode < 400 || e.StatusCode >= 500
+	}
+}
+
+// ErrorKind classifies the error returned by a request to the gateway, wrapped errors are unwrapped
+func ErrorKind(err error) string {
+	var throttledErr *ThrottledError
+	if errors.As(err, &throttledErr) {
+		return ErrorKind4xx
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode >= 400 && statusErr.StatusCode < 500:
+			return ErrorKind4xx
+		case statusErr.StatusCode >= 500:
+			return ErrorKind5xx
+		default:
+			return ErrorKindOther
+		}
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, fasthttp.ErrTimeout) || errors.Is(err, fasthttp.ErrDialTimeout) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrorKindTimeout
+	}
+
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) || isConnectionReset(err) || errors.Is(err, fasthttp.ErrNoFreeConns) {
+		return ErrorKindConnection
+	}
+
+	return ErrorKindOther
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestErrorKind(t *testing.T) {
+	t.Run("Should classify status errors by their status code", func(t *testing.T) {
+		assert.Equal(t, ErrorKind4xx, ErrorKind(newStatusError(fasthttp.StatusUnauthorized)))
+		assert.Equal(t, ErrorKind4xx, ErrorKind(newStatusError(fasthttp.StatusNotFound)))
+		assert.Equal(t, ErrorKind5xx, ErrorKind(newStatusError(fasthttp.StatusBadGateway)))
+		assert.Equal(t, ErrorKindOther, ErrorKind(newStatusError(fasthttp.StatusFound)))
+	})
+
+	t.Run("Should keep the messages of the status errors", func(t *testing.T) {
+		assert.EqualError(t, newStatusError(fasthttp.StatusUnauthorized), "OpenFaaS Credentials are invalid")
+		assert.EqualError(t, newStatusError(fasthttp.StatusInternalServerError), "Received unexpected Status Code 500")
+	})
+
+	t.Run("Should only consider 4xx of the function as non-retryable", func(t *testing.T) {
+		assert.False(t, newStatusError(fasthttp.StatusBadRequest).Retryable())
+		assert.False(t, newStatusError(fasthttp.StatusUnprocessableEntity).Retryable())
+		assert.True(t, newStatusError(fasthttp.StatusUnauthorized).Retryable())
+		assert.True(t, newStatusError(fasthttp.StatusNotFound).Retryable())
+		assert.True(t, newStatusError(fasthttp.StatusTooManyRequests).Retryable())
+		assert.True(t, newStatusError(fasthttp.StatusServiceUnavailable).Retryable())
+		assert.True(t, types2.IsNonRetryable(errors.Wrap(newStatusError(fasthttp.StatusBadRequest), "unable to invoke")))
+	})
+
+	t.Run("Should classify timeouts", func(t *testing.T) {
+		assert.Equal(t, ErrorKindTimeout, ErrorKind(context.DeadlineExceeded))
+		assert.Equal(t, ErrorKindTimeout, ErrorKind(fasthttp.ErrTimeout))
+		assert.Equal(t, ErrorKindTimeout, ErrorKind(fasthttp.ErrDialTimeout))
+	})
+
+	t.Run("Should classify connection errors", func(t *testing.T) {
+		assert.Equal(t, ErrorKindConnection, ErrorKind(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}))
+		assert.Equal(t, ErrorKindConnection, ErrorKind(&net.DNSError{Err: "no such host", Name: "gateway"}))
+	})
+
+	t.Run("Should unwrap wrapped errors", func(t *testing.T) {
+		assert.Equal(t, ErrorKind5xx, ErrorKind(errors.Wrap(newStatusError(fasthttp.StatusServiceUnavailable), "page 2")))
+		assert.Equal(t, ErrorKindTimeout, ErrorKind(errors.Wrap(context.DeadlineExceeded, "page 2")))
+	})
+
+	t.Run("Should classify unknown errors as other", func(t *testing.T) {
+		assert.Equal(t, ErrorKindOther, ErrorKind(errors.New("unexpected")))
+	})
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// failoverRecheckInterval after which a request is sent to the primary gateway again, while failed over
+const failoverRecheckInterval = 30 * time.Second
+
+// gatewayFailover tracks which of the gateways is used, the primary gateway is the first one. Once a gateway is
+// unreachable the next one is used, until the primary recovers. The primary is re-checked by sending a request to
+// it every failoverRecheckInterval. It is safe for concurrent use.
+type gatewayFailover struct {
+	urls    []string
+	recheck time.Duration
+	now     func() time.Time
+
+	lock   sync.Mutex
+	active int
+	// checked is the last time the primary was tried, while failed over
+	checked time.Time
+}
+
+func newGatewayFailover(primary string, fallbacks []string) *gatewayFailover {
+	return &gatewayFailover{
+		urls:    append([]string{primary}, fallbacks...),
+		recheck: failoverRecheckInterval,
+		now:     time.Now,
+	}
+}
+
+// candidates returns the indexes of the gateways in the order they should be tried, starting with the active one.
+// Once the recheck is due, the primary is tried first.
+func (f *gatewayFailover) candidates() []int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	first := f.active
+	if f.active != 0 && !f.now().Before(f.checked.Add(f.recheck)) {
+		first = 0
+		f.checked = f.now()
+	}
+
+	order := make([]int, 0, len(f.urls))
+	order = append(order, first)
+	for i := range f.urls {
+		if i != first {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// reached records that the gateway was reachable, which makes it the active one
+func (f *gatewayFailover) reached(index int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if index == f.active {
+		return
+	}
+
+	if index == 0 {
+		log.Printf("Gateway %s recovered, will use it again", f.urls[0])
+	} else {
+		log.Printf("WARNING: Failing over to gateway %s", f.urls[index])
+		f.checked = f.now()
+	}
+	f.active = index
+}
+
+// isUnreachable is true if the request did not reach the gateway, hence it can be sent to another gateway without
+// being processed twice. Connection resets are only considered for idempotent requests, as they may happen after
+// the gateway received the request.
+func isUnreachable(err error, req *fasthttp.Request) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if (errors.As(err, &opErr) && opErr.Op == "dial") || errors.As(err, &dnsErr) {
+		return true
+	}
+	if errors.Is(err, fasthttp.ErrDialTimeout) || errors.Is(err, fasthttp.ErrNoFreeConns) {
+		return true
+	}
+	return isConnectionReset(err) && isIdempotent(req)
+}
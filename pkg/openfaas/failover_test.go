@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGatewayFailover(t *testing.T) {
+	now := time.Now()
+	target := newGatewayFailover("http://primary", []string{"http://secondary", "http://tertiary"})
+	target.now = func() time.Time { return now }
+
+	t.Run("Should prefer the primary gateway", func(t *testing.T) {
+		assert.Equal(t, []int{0, 1, 2}, target.candidates())
+	})
+
+	t.Run("Should start with the gateway that was reached last", func(t *testing.T) {
+		target.reached(2)
+
+		assert.Equal(t, []int{2, 0, 1}, target.candidates())
+	})
+
+	t.Run("Should re-check the primary gateway once due", func(t *testing.T) {
+		now = now.Add(failoverRecheckInterval)
+
+		assert.Equal(t, []int{0, 1, 2}, target.candidates())
+		assert.Equal(t, []int{2, 0, 1}, target.candidates(), "Expected a single re-check per interval")
+
+		target.reached(0)
+		assert.Equal(t, []int{0, 1, 2}, target.candidates())
+	})
+}
+
+// unreachableURL returns the url of a port nobody listens on
+func unreachableURL(t *testing.T) (string, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	return "http://" + addr, addr
+}
+
+func countingServer(t *testing.T, status int, body string) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func TestClient_Failover(t *testing.T) {
+	message := []byte("Test")
+	invocation := &types2.OpenFaaSInvocation{Topic: "billing", Message: &message}
+
+	t.Run("Should invoke via the fallback gateway while the primary is unreachable", func(t *testing.T) {
+		primary, _ := unreachableURL(t)
+		fallback, requests := countingServer(t, http.StatusAccepted, "")
+		client := NewClient(CreateClient(fallback), nil, primary, "").WithFallbackGateways(fallback.URL)
+
+		ok, err := client.InvokeAsync(context.Background(), Function{Name: "biller"}, invocation)
+
+		assert.NoError(t, err, "should not throw")
+		assert.True(t, ok)
+		assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+	})
+
+	t.Run("Should crawl via the fallback gateway while the primary is unreachable", func(t *testing.T) {
+		primary, _ := unreachableURL(t)
+		fallback, _ := countingServer(t, http.StatusOK, `[{"name":"biller"}]`)
+		client := NewClient(CreateClient(fallback), nil, primary, "").WithFallbackGateways(fallback.URL)
+
+		functions, err := client.GetFunctions(context.Background(), "")
+
+		assert.NoError(t, err, "should not throw")
+		assert.Len(t, functions, 1)
+	})
+
+	t.Run("Should not fail over on errors of the function", func(t *testing.T) {
+		primary, primaryRequests := countingServer(t, http.StatusNotFound, "")
+		fallback, fallbackRequests := countingServer(t, http.StatusAccepted, "")
+		client := NewClient(CreateClient(primary), nil, primary.URL, "").WithFallbackGateways(fallback.URL)
+
+		_, err := client.InvokeAsync(context.Background(), Function{Name: "biller"}, invocation)
+
+		assert.Error(t, err, "should throw")
+		assert.Equal(t, int32(1), atomic.LoadInt32(primaryRequests))
+		assert.Equal(t, int32(0), atomic.LoadInt32(fallbackRequests))
+	})
+
+	t.Run("Should return to the primary gateway once it recovered", func(t *testing.T) {
+		primaryURL, addr := unreachableURL(t)
+		fallback, fallbackRequests := countingServer(t, http.StatusAccepted, "")
+		client := NewClient(CreateClient(fallback), nil, primaryURL, "").WithFallbackGateways(fallback.URL)
+
+		_, err := client.InvokeAsync(context.Background(), Function{Name: "biller"}, invocation)
+		assert.NoError(t, err, "should not throw")
+
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Skipf("Unable to listen on %s again: %s", addr, err)
+		}
+		var primaryRequests int32
+		primary := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&primaryRequests, 1)
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		_ = primary.Listener.Close()
+		primary.Listener = listener
+		primary.Start()
+		defer primary.Close()
+
+		_, err = client.InvokeAsync(context.Background(), Function{Name: "biller"}, invocation)
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, int32(0), atomic.LoadInt32(&primaryRequests), "Expected the fallback to be used until the re-check is due")
+
+		client.failover.now = func() time.Time { return time.Now().Add(failoverRecheckInterval) }
+		_, err = client.InvokeAsync(context.Background(), Function{Name: "biller"}, invocation)
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, int32(1), atomic.LoadInt32(&primaryRequests))
+		assert.Equal(t, int32(2), atomic.LoadInt32(fallbackRequests))
+	})
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// freshnessGate holds back deliveries while the topic map is cold or stale, as they would otherwise be dropped for
+// lack of subscribers. It starts closed and is opened by the first successful refresh. A nil gate is always open.
+type freshnessGate struct {
+	lock sync.Mutex
+	// open is closed while the gate is open, waiting on it blocks while the gate is closed
+	open  chan struct{}
+	fresh bool
+	// populated is true once the gate was opened, which distinguishes a stale topic map from a cold one
+	populated bool
+}
+
+func newFreshnessGate() *freshnessGate {
+	return &freshnessGate{open: make(chan struct{})}
+}
+
+// Wait blocks while the topic map is cold or stale, it returns early once the context is done
+func (g *freshnessGate) Wait(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	g.lock.Lock()
+	open := g.open
+	g.lock.Unlock()
+
+	select {
+	case <-open:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Update opens the gate while the topic map is fresh and closes it otherwise, transitions are logged
+func (g *freshnessGate) Update(fresh bool) {
+	if g == nil {
+		return
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if fresh == g.fresh {
+		return
+	}
+
+	if fresh {
+		if g.populated {
+			log.Printf("Resuming consumption as the topic map was refreshed again")
+		} else {
+			log.Printf("Starting consumption as the topic map was populated")
+		}
+		close(g.open)
+		g.populated = true
+	} else {
+		log.Printf("WARNING: Pausing consumption as the topic map is stale, deliveries stay in the queue until it was refreshed")
+		g.open = make(chan struct{})
+	}
+	g.fresh = fresh
+}
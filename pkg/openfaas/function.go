@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// AllowedInvokeMethods contains the http methods that can be used for invoking a function
+var AllowedInvokeMethods = []string{fasthttp.MethodPost, fasthttp.MethodPut, fasthttp.MethodPatch}
+
+// DeliveryMode decides how the functions of a topic are invoked once one of them failed
+type DeliveryMode string
+
+const (
+	// FailFast stops invoking the functions of a topic on the first failure, which is the default
+	FailFast DeliveryMode = "fail-fast"
+	// BestEffort invokes all functions of a topic and reports their failures together
+	BestEffort DeliveryMode = "best-effort"
+)
+
+// ParseDeliveryMode validates the provided delivery mode, ignoring its case
+func ParseDeliveryMode(mode string) (DeliveryMode, error) {
+	switch normalized := DeliveryMode(strings.ToLower(strings.TrimSpace(mode))); normalized {
+	case FailFast, BestEffort:
+		return normalized, nil
+	default:
+		return "", fmt.Errorf("delivery mode %s is not one of %s, %s", mode, FailFast, BestEffort)
+	}
+}
+
+// Function describes a deployed OpenFaaS Function that subscribed to a topic.
+// Name and Namespace are stored separately, how they are addressed during an
+// invocation is decided by the client.
+type Function struct {
+	Name      string
+	Namespace string
+	// Timeout of an invocation, if zero the global invoke timeout applies
+	Timeout time.Duration
+	// Method used for invocation, if empty POST is used
+	Method string
+	// MaxInFlight limits the concurrent invocations, if zero the global default applies
+	MaxInFlight int
+	// Weight shares the invocation pool once it is saturated, if zero the weight is 1
+	Weight int
+	// DeliveryMode requested for the topics of the function, if empty the function has no preference
+	DeliveryMode DeliveryMode
+	// Encoding of the message as body of an invocation, if empty the message is passed through
+	Encoding InvokeEncoding
+	// Schema the messages are validated against before invocation, if empty only the schema of the topic applies
+	Schema string
+	// Warmup is the interval in which the function is invoked with a warmup, if zero it is not warmed up
+	Warmup time.Duration
+	// Paused functions are still crawled but not invoked
+	Paused bool
+	// Draining functions are temporarily unavailable and only kept routed for the removal grace period
+	Draining bool
+	// Static functions are configured rather than crawled, hence they are never evicted by a refresh
+	Static bool
+	// URL of an endpoint outside of OpenFaaS, which is invoked directly instead of via the gateway
+	URL string
+	// Target addresses the function during invocation as resolved by the FunctionResolver, if empty it is derived
+	// from the name and namespace according to the NamespaceInvocationStyle
+	Target string
+}
+
+// String returns the name.namespace representation of the function or its url, which is used for logging
+func (f Function) String() string {
+	if len(f.URL) > 0 {
+		return f.URL
+	}
+	if len(f.Namespace) > 0 {
+		return fmt.Sprintf("%s.%s", f.Name, f.Namespace)
+	}
+	return f.Name
+}
+
+// InvokeMethod returns the http method used for invoking the function
+func (f Function) InvokeMethod() string {
+	if len(f.Method) == 0 {
+		return fasthttp.MethodPost
+	}
+	return f.Method
+}
+
+// ParseInvokeMethod validates the provided method against the allowed invoke methods, ignoring its case
+func ParseInvokeMethod(method string) (string, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(method))
+	for _, allowed := range AllowedInvokeMethods {
+		if normalized == allowed {
+			return allowed, nil
+		}
+	}
+
+	return "", fmt.Errorf("invoke method %s is not one of %s", method, strings.Join(AllowedInvokeMethods, ", "))
+}
@@ -5,29 +5,83 @@
 
 package openfaas
 
-import "strings"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
 
-// TopicMapBuilder defines an interface that allows to build a TopicMap
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+)
+
+// TopicMapBuilder defines an interface that allows to build a TopicMap, Append has to be safe for concurrent use
 type TopicMapBuilder interface {
-	Append(topic string, function string)
-	Build() map[string][]string
+	Append(topic string, function Function)
+	Build() map[string][]Function
 }
 
 // FunctionMapBuilder convenient construct to build a map
-// of function <=> topic
+// of function <=> topic. It is safe for concurrent use.
 type FunctionMapBuilder struct {
-	target map[string][]string
+	lock   sync.Mutex
+	target map[string][]Function
+	// maxTopics caps the number of topics on Build, functions of further topics are rejected. 0 disables the cap.
+	maxTopics int
+	// previous are the topics of the last build, which are kept first once the cap is reached
+	previous map[string][]Function
+	rejected map[string]struct{}
+	metrics  metrics.Sink
+	// allowed restricts the topics, functions of other topics are ignored. nil allows all topics.
+	allowed map[string]struct{}
+	ignored map[string]struct{}
 }
 
 // NewFunctionMapBuilder returns a new instance with an empty build target
 func NewFunctionMapBuilder() *FunctionMapBuilder {
 	return &FunctionMapBuilder{
-		target: make(map[string][]string),
+		target:   make(map[string][]Function),
+		rejected: make(map[string]struct{}),
+		ignored:  make(map[string]struct{}),
+		metrics:  metrics.Prometheus{},
+	}
+}
+
+// WithMaxTopics caps the number of topics, once exceeded functions of further topics are rejected. 0 disables the cap.
+func (b *FunctionMapBuilder) WithMaxTopics(limit int) *FunctionMapBuilder {
+	b.maxTopics = limit
+	return b
+}
+
+// WithPreviousTopics keeps the topics of the previous topic map first once the cap is reached, so that the kept
+// topics do not change unless the cluster does
+func (b *FunctionMapBuilder) WithPreviousTopics(previous map[string][]Function) *FunctionMapBuilder {
+	b.previous = previous
+	return b
+}
+
+// WithMetrics counts the rejected topics using the sink instead of Prometheus
+func (b *FunctionMapBuilder) WithMetrics(sink metrics.Sink) *FunctionMapBuilder {
+	b.metrics = sink
+	return b
+}
+
+// WithAllowedTopics restricts the topics to the provided ones, functions of other topics are ignored. An empty list
+// allows all topics.
+func (b *FunctionMapBuilder) WithAllowedTopics(topics []string) *FunctionMapBuilder {
+	if len(topics) == 0 {
+		b.allowed = nil
+		return b
 	}
+
+	b.allowed = make(map[string]struct{}, len(topics))
+	for _, topic := range topics {
+		b.allowed[strings.TrimSpace(topic)] = struct{}{}
+	}
+	return b
 }
 
 // Append the provided function to the specified topic
-func (b *FunctionMapBuilder) Append(topic string, function string) {
+func (b *FunctionMapBuilder) Append(topic string, function Function) {
 	key := strings.TrimSpace(topic)
 
 	if len(key) == 0 {
@@ -35,14 +89,74 @@ func (b *FunctionMapBuilder) Append(topic string, function string) {
 		return
 	}
 
-	if b.target[key] == nil {
-		b.target[key] = []string{}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.allowed != nil {
+		if _, allowed := b.allowed[key]; !allowed {
+			b.ignored[fmt.Sprintf("%s (%s)", key, function)] = struct{}{}
+			return
+		}
 	}
 
 	b.target[key] = append(b.target[key], function)
 }
 
-// Build returns a map containing values based on previous Append calls
-func (b *FunctionMapBuilder) Build() map[string][]string {
+// Build returns a map containing values based on previous Append calls. Once the topics exceed the cap, the previous
+// topics are kept first and the remaining ones in sorted order, regardless of the order they were appended in.
+func (b *FunctionMapBuilder) Build() map[string][]Function {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.maxTopics <= 0 || len(b.target) <= b.maxTopics {
+		return b.target
+	}
+
+	topics := make([]string, 0, len(b.target))
+	for topic := range b.target {
+		topics = append(topics, topic)
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		_, previousI := b.previous[topics[i]]
+		_, previousJ := b.previous[topics[j]]
+		if previousI != previousJ {
+			return previousI
+		}
+		return topics[i] < topics[j]
+	})
+
+	for _, topic := range topics[b.maxTopics:] {
+		delete(b.target, topic)
+		if _, exists := b.rejected[topic]; !exists {
+			b.rejected[topic] = struct{}{}
+			b.metrics.IncRejectedTopics()
+		}
+	}
 	return b.target
 }
+
+// Rejected returns the sorted topics whose functions were rejected by Build, as the topic cap was reached
+func (b *FunctionMapBuilder) Rejected() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	rejected := make([]string, 0, len(b.rejected))
+	for topic := range b.rejected {
+		rejected = append(rejected, topic)
+	}
+	sort.Strings(rejected)
+	return rejected
+}
+
+// Ignored returns the sorted subscriptions as topic (function), which were ignored as their topic is not allowed
+func (b *FunctionMapBuilder) Ignored() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	ignored := make([]string, 0, len(b.ignored))
+	for subscription := range b.ignored {
+		ignored = append(ignored, subscription)
+	}
+	sort.Strings(ignored)
+	return ignored
+}
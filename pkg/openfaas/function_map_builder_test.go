@@ -6,8 +6,12 @@
 package openfaas
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,8 +21,8 @@ func TestFunctionMapBuilder_Append(t *testing.T) {
 	t.Run("Should skip appending if topic is '' or ' '", func(t *testing.T) {
 		target := NewFunctionMapBuilder()
 
-		target.Append("", "NotIncluded")
-		target.Append(" ", "NotIncluded")
+		target.Append("", Function{Name: "NotIncluded"})
+		target.Append(" ", Function{Name: "NotIncluded"})
 
 		build := target.Build()
 
@@ -28,13 +32,141 @@ func TestFunctionMapBuilder_Append(t *testing.T) {
 	t.Run("Should append to existing entries", func(t *testing.T) {
 		target := NewFunctionMapBuilder()
 
-		target.Append("Billing", "CalcTax")
-		target.Append("Billing", "NotifyLogistic")
+		target.Append("Billing", Function{Name: "CalcTax"})
+		target.Append("Billing", Function{Name: "NotifyLogistic"})
 		build := target.Build()
 
 		assert.NotNil(t, build["Billing"], "Expected added Topic to be present")
 		assert.Len(t, build["Billing"], 2, "Expected two entries")
 	})
+
+	t.Run("Should be safe for concurrent use", func(t *testing.T) {
+		target := NewFunctionMapBuilder()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					target.Append("Billing", Function{Name: fmt.Sprintf("CalcTax-%d-%d", i, j)})
+					target.Append(fmt.Sprintf("Topic-%d", i), Function{Name: "NotifyLogistic"})
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		build := target.Build()
+		assert.Len(t, build, 51, "Expected shared and per goroutine topics")
+		assert.Len(t, build["Billing"], 1000, "Expected every append to be present")
+		assert.Contains(t, build["Billing"], Function{Name: "CalcTax-49-19"})
+		assert.Len(t, build["Topic-7"], 20, "Expected every append to be present")
+	})
+}
+
+func TestFunctionMapBuilder_WithMaxTopics(t *testing.T) {
+	t.Run("Should reject the topics beyond the cap in sorted order", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.RejectedTopics)
+		target := NewFunctionMapBuilder().WithMaxTopics(2)
+
+		target.Append("Support", Function{Name: "OpenTicket"})
+		target.Append("Shipping", Function{Name: "NotifyLogistic"})
+		target.Append("Billing", Function{Name: "CalcTax"})
+		target.Append("Marketing", Function{Name: "SendNewsletter"})
+		target.Append("Support", Function{Name: "CloseTicket"})
+		build := target.Build()
+
+		assert.Len(t, build, 2, "Expected the cap to be enforced")
+		assert.Contains(t, build, "Billing")
+		assert.Contains(t, build, "Marketing")
+		assert.Equal(t, []string{"Shipping", "Support"}, target.Rejected())
+		assert.Equal(t, before+2, testutil.ToFloat64(metrics.RejectedTopics), "Expected every rejected topic to be counted once")
+
+		assert.Len(t, target.Build(), 2, "Expected a repeated build to keep the same topics")
+		assert.Equal(t, before+2, testutil.ToFloat64(metrics.RejectedTopics), "Expected a repeated build to not count again")
+	})
+
+	t.Run("Should keep the previous topics first once the cap is reached", func(t *testing.T) {
+		target := NewFunctionMapBuilder().WithMaxTopics(2).WithPreviousTopics(map[string][]Function{"Support": {{Name: "OpenTicket"}}})
+
+		target.Append("Billing", Function{Name: "CalcTax"})
+		target.Append("Marketing", Function{Name: "SendNewsletter"})
+		target.Append("Support", Function{Name: "OpenTicket"})
+		build := target.Build()
+
+		assert.Contains(t, build, "Support", "Expected the previous topic to be kept")
+		assert.Contains(t, build, "Billing")
+		assert.Equal(t, []string{"Marketing"}, target.Rejected())
+	})
+
+	t.Run("Should keep the same topics regardless of the order of concurrent appends", func(t *testing.T) {
+		for run := 0; run < 20; run++ {
+			target := NewFunctionMapBuilder().WithMaxTopics(5)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					target.Append(fmt.Sprintf("Topic-%02d", i), Function{Name: "CalcTax"})
+				}(i)
+			}
+			wg.Wait()
+
+			build := target.Build()
+			assert.Len(t, build, 5, "Expected the cap to be enforced")
+			for i := 0; i < 5; i++ {
+				assert.Contains(t, build, fmt.Sprintf("Topic-%02d", i))
+			}
+		}
+	})
+
+	t.Run("Should keep appending to admitted topics once the cap is reached", func(t *testing.T) {
+		target := NewFunctionMapBuilder().WithMaxTopics(1)
+
+		target.Append("Billing", Function{Name: "CalcTax"})
+		target.Append("Billing", Function{Name: "NotifyLogistic"})
+		build := target.Build()
+
+		assert.Len(t, build["Billing"], 2, "Expected two entries")
+		assert.Empty(t, target.Rejected())
+	})
+
+	t.Run("Should not cap the topics by default", func(t *testing.T) {
+		target := NewFunctionMapBuilder()
+
+		for i := 0; i < 100; i++ {
+			target.Append(fmt.Sprintf("Topic-%d", i), Function{Name: "CalcTax"})
+		}
+
+		assert.Len(t, target.Build(), 100)
+		assert.Empty(t, target.Rejected())
+	})
+}
+
+func TestFunctionMapBuilder_WithAllowedTopics(t *testing.T) {
+	t.Run("Should ignore functions of topics that are not allowed", func(t *testing.T) {
+		target := NewFunctionMapBuilder().WithAllowedTopics([]string{"Billing", " Shipping "})
+
+		target.Append("Billing", Function{Name: "CalcTax"})
+		target.Append("Shipping", Function{Name: "NotifyLogistic"})
+		target.Append("Rogue", Function{Name: "CalcTax", Namespace: "faas"})
+		build := target.Build()
+
+		assert.Len(t, build, 2, "Expected only the allowed topics")
+		assert.NotContains(t, build, "Rogue")
+		assert.Equal(t, []string{"Rogue (CalcTax.faas)"}, target.Ignored())
+	})
+
+	t.Run("Should allow all topics by default", func(t *testing.T) {
+		target := NewFunctionMapBuilder().WithAllowedTopics(nil)
+
+		target.Append("Billing", Function{Name: "CalcTax"})
+		target.Append("Rogue", Function{Name: "CalcTax"})
+
+		assert.Len(t, target.Build(), 2)
+		assert.Empty(t, target.Ignored())
+	})
 }
 
 func TestFunctionMapBuilder_Build(t *testing.T) {
@@ -50,7 +182,7 @@ func TestFunctionMapBuilder_Build(t *testing.T) {
 	t.Run("Should return a map based on previous append", func(t *testing.T) {
 		target := NewFunctionMapBuilder()
 
-		target.Append("Billing", "CalcTax")
+		target.Append("Billing", Function{Name: "CalcTax"})
 		build := target.Build()
 
 		assert.NotNil(t, build["Billing"], "Expected added Topic to be present")
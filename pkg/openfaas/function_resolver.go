@@ -0,0 +1,30 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"github.com/openfaas/faas-provider/types"
+)
+
+// FunctionResolver maps a crawled function of the namespace to the identifier it is invoked by, e.g. a UID or FQDN
+// for gateways that do not address functions by name.namespace. The resolved target only affects the invocation,
+// functions are still logged and reported by their name and namespace. An empty target falls back to the
+// NamespaceInvocationStyle.
+type FunctionResolver interface {
+	Resolve(fn types.FunctionStatus, namespace string) string
+}
+
+// NameNamespaceResolver resolves functions to the name.namespace convention of OpenFaaS CE, which is also used
+// without resolver unless another NamespaceInvocationStyle is configured
+type NameNamespaceResolver struct{}
+
+// Resolve returns name.namespace, or only the name if the namespace is empty
+func (NameNamespaceResolver) Resolve(fn types.FunctionStatus, namespace string) string {
+	if len(namespace) == 0 {
+		return fn.Name
+	}
+	return fn.Name + "." + namespace
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// uidResolver addresses functions by the uid label, like gateways invoking functions by their UID
+type uidResolver struct{}
+
+func (uidResolver) Resolve(fn types.FunctionStatus, _ string) string {
+	if fn.Labels == nil {
+		return ""
+	}
+	return (*fn.Labels)["uid"]
+}
+
+func TestNameNamespaceResolver(t *testing.T) {
+	t.Run("Should resolve to name.namespace", func(t *testing.T) {
+		assert.Equal(t, "biller.openfaas-fn", NameNamespaceResolver{}.Resolve(types.FunctionStatus{Name: "biller"}, "openfaas-fn"))
+	})
+
+	t.Run("Should resolve to the name without namespace", func(t *testing.T) {
+		assert.Equal(t, "biller", NameNamespaceResolver{}.Resolve(types.FunctionStatus{Name: "biller"}, ""))
+	})
+}
+
+func TestCacher_FunctionResolver(t *testing.T) {
+	annotations := map[string]string{"topic": "billing"}
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetNamespaces", mock.Anything).Return([]string{"openfaas-fn"}, nil)
+	clientMock.On("GetFunctions", "openfaas-fn").Return([]types.FunctionStatus{
+		{Name: "biller", Annotations: &annotations, Labels: &map[string]string{"uid": "4f2c9a"}},
+		{Name: "invoicer", Annotations: &annotations},
+	}, nil)
+
+	t.Run("Should invoke the target resolved by the resolver", func(t *testing.T) {
+		paths := make(chan string, 2)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths <- r.URL.Path
+			w.WriteHeader(202)
+		}))
+		defer server.Close()
+
+		cache := NewTopicFunctionCache()
+		target := NewController(&config.Controller{}, clientMock, cache).
+			WithFunctionResolver(uidResolver{}).
+			WithInvoker(NewGatewayInvoker(CreateClient(server), nil, server.URL, ""))
+		target.refreshTick(context.Background(), true)
+
+		assert.ElementsMatch(t, []Function{
+			{Name: "biller", Namespace: "openfaas-fn", Target: "4f2c9a"},
+			{Name: "invoicer", Namespace: "openfaas-fn"},
+		}, cache.GetCachedValues("billing"), "Expected the identity to be kept")
+
+		message := []byte("Test")
+		_, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing", Message: &message})
+		assert.NoError(t, err, "should not throw")
+		assert.ElementsMatch(t, []string{"/async-function/4f2c9a", "/async-function/invoicer.openfaas-fn"}, []string{<-paths, <-paths})
+	})
+
+	t.Run("Should use the namespace style without resolver", func(t *testing.T) {
+		cache := NewTopicFunctionCache()
+		NewController(&config.Controller{}, clientMock, cache).refreshTick(context.Background(), true)
+
+		for _, fn := range cache.GetCachedValues("billing") {
+			assert.Empty(t, fn.Target)
+		}
+	})
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	healthBuckets = 10
+	// minHealthSamples avoids pausing a function because of a few unlucky invocations
+	minHealthSamples = 10
+)
+
+// FunctionStats describes the invocation outcomes of a function within the rolling window
+type FunctionStats struct {
+	Function    string     `json:"function"`
+	Successes   int        `json:"successes"`
+	Failures    int        `json:"failures"`
+	ErrorRatio  float64    `json:"error_ratio"`
+	Paused      bool       `json:"auto_paused"`
+	PausedSince *time.Time `json:"auto_paused_since,omitempty"`
+}
+
+type healthBucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+type functionHealth struct {
+	buckets     [healthBuckets]healthBucket
+	paused      bool
+	pausedSince time.Time
+}
+
+// HealthTracker records invocation outcomes per function over a rolling window. If a threshold is set,
+// functions whose error ratio exceeds it are paused until the ratio recovers, which happens at the latest
+// once their failures aged out of the window.
+type HealthTracker struct {
+	window    time.Duration
+	threshold float64
+	now       func() time.Time
+
+	lock      sync.Mutex
+	functions map[string]*functionHealth
+}
+
+// NewHealthTracker creates a tracker for the provided window, a threshold of zero disables pausing
+func NewHealthTracker(window time.Duration, threshold float64) *HealthTracker {
+	if window <= 0 {
+		window = time.Minute
+	}
+
+	return &HealthTracker{
+		window:    window,
+		threshold: threshold,
+		now:       time.Now,
+		functions: map[string]*functionHealth{},
+	}
+}
+
+// Record adds the outcome of an invocation and updates the paused state of the function
+func (h *HealthTracker) Record(fn Function, failed bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	key := fn.String()
+	health, exists := h.functions[key]
+	if !exists {
+		health = &functionHealth{}
+		h.functions[key] = health
+	}
+
+	bucket := h.bucket(health)
+	if failed {
+		bucket.failures++
+	} else {
+		bucket.successes++
+	}
+
+	h.transition(key, health)
+}
+
+// IsPaused reports whether the function is currently paused due to its error ratio
+func (h *HealthTracker) IsPaused(fn Function) bool {
+	if h.threshold <= 0 {
+		return false
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	key := fn.String()
+	health, exists := h.functions[key]
+	if !exists || !health.paused {
+		return false
+	}
+
+	h.transition(key, health)
+	return health.paused
+}
+
+// Stats returns the current stats of all functions that were invoked, sorted by function
+func (h *HealthTracker) Stats() []FunctionStats {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	stats := make([]FunctionStats, 0, len(h.functions))
+	for key, health := range h.functions {
+		h.transition(key, health)
+
+		successes, failures := h.count(health)
+		entry := FunctionStats{
+			Function:   key,
+			Successes:  successes,
+			Failures:   failures,
+			ErrorRatio: ratio(successes, failures),
+			Paused:     health.paused,
+		}
+		if health.paused {
+			since := health.pausedSince
+			entry.PausedSince = &since
+		}
+
+		stats = append(stats, entry)
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Function < stats[j].Function })
+	return stats
+}
+
+// bucket returns the bucket of the current point in time, resetting it if it belongs to an elapsed window
+func (h *HealthTracker) bucket(health *functionHealth) *healthBucket {
+	size := h.window / healthBuckets
+	now := h.now()
+	start := now.Truncate(size)
+	bucket := &health.buckets[(start.UnixNano()/int64(size))%healthBuckets]
+
+	if !bucket.start.Equal(start) {
+		*bucket = healthBucket{start: start}
+	}
+	return bucket
+}
+
+func (h *HealthTracker) count(health *functionHealth) (int, int) {
+	cutoff := h.now().Add(-h.window)
+
+	successes, failures := 0, 0
+	for _, bucket := range health.buckets {
+		if bucket.start.After(cutoff) {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+	}
+	return successes, failures
+}
+
+func (h *HealthTracker) transition(key string, health *functionHealth) {
+	if h.threshold <= 0 {
+		return
+	}
+
+	successes, failures := h.count(health)
+	exceeded := successes+failures >= minHealthSamples && ratio(successes, failures) > h.threshold
+
+	switch {
+	case exceeded && !health.paused:
+		health.paused = true
+		health.pausedSince = h.now()
+		log.Printf("Auto-paused function %s as its error ratio %.2f exceeds %.2f", key, ratio(successes, failures), h.threshold)
+	case !exceeded && health.paused:
+		health.paused = false
+		log.Printf("Auto-resumed function %s as its error ratio recovered", key)
+	}
+}
+
+func ratio(successes int, failures int) float64 {
+	if successes+failures == 0 {
+		return 0
+	}
+	return float64(failures) / float64(successes+failures)
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTracker(threshold float64) (*HealthTracker, *time.Time) {
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewHealthTracker(time.Minute, threshold)
+	tracker.now = func() time.Time { return now }
+	return tracker, &now
+}
+
+func record(tracker *HealthTracker, fn Function, successes int, failures int) {
+	for i := 0; i < successes; i++ {
+		tracker.Record(fn, false)
+	}
+	for i := 0; i < failures; i++ {
+		tracker.Record(fn, true)
+	}
+}
+
+func TestHealthTracker(t *testing.T) {
+	fn := Function{Name: "biller", Namespace: "faas"}
+
+	t.Run("Should pause once the error ratio exceeds the threshold", func(t *testing.T) {
+		tracker, _ := newTestTracker(0.5)
+
+		record(tracker, fn, 5, 5)
+		assert.False(t, tracker.IsPaused(fn), "Expected ratio of exactly 0.5 to not pause")
+
+		record(tracker, fn, 0, 1)
+		assert.True(t, tracker.IsPaused(fn), "Expected ratio above 0.5 to pause")
+	})
+
+	t.Run("Should not pause before enough invocations were recorded", func(t *testing.T) {
+		tracker, _ := newTestTracker(0.5)
+
+		record(tracker, fn, 0, minHealthSamples-1)
+		assert.False(t, tracker.IsPaused(fn))
+	})
+
+	t.Run("Should resume once the error ratio drops below the threshold", func(t *testing.T) {
+		tracker, _ := newTestTracker(0.5)
+
+		record(tracker, fn, 4, 6)
+		assert.True(t, tracker.IsPaused(fn))
+
+		record(tracker, fn, 3, 0)
+		assert.False(t, tracker.IsPaused(fn), "Expected ratio of 6/13 to resume")
+	})
+
+	t.Run("Should resume once the failures aged out of the window", func(t *testing.T) {
+		tracker, now := newTestTracker(0.5)
+
+		record(tracker, fn, 0, 10)
+		assert.True(t, tracker.IsPaused(fn))
+
+		*now = now.Add(30 * time.Second)
+		assert.True(t, tracker.IsPaused(fn), "Expected to stay paused within the window")
+
+		*now = now.Add(31 * time.Second)
+		assert.False(t, tracker.IsPaused(fn), "Expected to resume after the window")
+	})
+
+	t.Run("Should never pause if threshold is zero", func(t *testing.T) {
+		tracker, _ := newTestTracker(0)
+
+		record(tracker, fn, 0, 50)
+		assert.False(t, tracker.IsPaused(fn))
+	})
+
+	t.Run("Should expose stats per function", func(t *testing.T) {
+		tracker, now := newTestTracker(0.5)
+
+		record(tracker, fn, 0, 10)
+		record(tracker, Function{Name: "notifier"}, 3, 1)
+
+		stats := tracker.Stats()
+		assert.Len(t, stats, 2)
+		assert.Equal(t, FunctionStats{Function: "biller.faas", Failures: 10, ErrorRatio: 1, Paused: true, PausedSince: now}, stats[0])
+		assert.Equal(t, FunctionStats{Function: "notifier", Successes: 3, Failures: 1, ErrorRatio: 0.25}, stats[1])
+	})
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// inFlightLimiter bounds the concurrent invocations per function using a semaphore per function
+type inFlightLimiter struct {
+	lock       sync.Mutex
+	semaphores map[string]chan struct{}
+}
+
+func newInFlightLimiter() *inFlightLimiter {
+	return &inFlightLimiter{semaphores: map[string]chan struct{}{}}
+}
+
+// Acquire waits until the function has less than limit invocations in flight or the context is done. The returned
+// release has to be called once the invocation finished. If the limit of a function changes, a new semaphore is
+// used, while invocations holding the previous one release it on their own.
+func (l *inFlightLimiter) Acquire(ctx context.Context, fn Function, limit int) (func(), error) {
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	semaphore := l.semaphore(fn.String(), limit)
+	select {
+	case semaphore <- struct{}{}:
+		return func() { <-semaphore }, nil
+	case <-ctx.Done():
+		return nil, errors.Wrapf(ctx.Err(), "function %s has %d invocations in flight", fn, limit)
+	}
+}
+
+func (l *inFlightLimiter) semaphore(key string, limit int) chan struct{} {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	semaphore, exists := l.semaphores[key]
+	if !exists || cap(semaphore) != limit {
+		semaphore = make(chan struct{}, limit)
+		l.semaphores[key] = semaphore
+	}
+	return semaphore
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInFlightLimiter_Acquire(t *testing.T) {
+	t.Run("Should never exceed the limit of a function", func(t *testing.T) {
+		limiter := newInFlightLimiter()
+		var current, peak int32
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release, err := limiter.Acquire(context.Background(), Function{Name: "biller"}, 3)
+				if !assert.NoError(t, err, "Should not fail") {
+					return
+				}
+				defer release()
+
+				now := atomic.AddInt32(&current, 1)
+				for {
+					seen := atomic.LoadInt32(&peak)
+					if now <= seen || atomic.CompareAndSwapInt32(&peak, seen, now) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&current, -1)
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(3), peak, "Expected the limit to be used but never exceeded")
+	})
+
+	t.Run("Should limit every function separately", func(t *testing.T) {
+		limiter := newInFlightLimiter()
+
+		_, err := limiter.Acquire(context.Background(), Function{Name: "biller"}, 1)
+		assert.NoError(t, err, "Should not fail")
+		_, err = limiter.Acquire(context.Background(), Function{Name: "biller", Namespace: "legacy"}, 1)
+		assert.NoError(t, err, "Expected functions of other namespaces to have their own limit")
+	})
+
+	t.Run("Should give up once the context is done", func(t *testing.T) {
+		limiter := newInFlightLimiter()
+		release, _ := limiter.Acquire(context.Background(), Function{Name: "biller"}, 1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := limiter.Acquire(ctx, Function{Name: "biller"}, 1)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		release()
+		_, err = limiter.Acquire(context.Background(), Function{Name: "biller"}, 1)
+		assert.NoError(t, err, "Expected the released slot to be available")
+	})
+
+	t.Run("Should not limit without a limit", func(t *testing.T) {
+		limiter := newInFlightLimiter()
+
+		for i := 0; i < 100; i++ {
+			_, err := limiter.Acquire(context.Background(), Function{Name: "biller"}, 0)
+			assert.NoError(t, err, "Should not fail")
+		}
+	})
+}
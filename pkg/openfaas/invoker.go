@@ -0,0 +1,338 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+	internal "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/openfaas/faas-provider/auth"
+	"github.com/pkg/errors"
+	"github.com/valyala/fasthttp"
+)
+
+// Invoker defines the transport used to invoke deployed OpenFaaS Functions. The GatewayInvoker calls them via the
+// http gateway, alternative transports like gRPC or NATS implement this interface and are plugged in via
+// Controller.WithInvoker, while discovering the functions remains with the FunctionCrawler.
+type Invoker interface {
+	InvokeSync(ctx context.Context, fn Function, invocation *internal.OpenFaaSInvocation) ([]byte, error)
+	InvokeAsync(ctx context.Context, fn Function, invocation *internal.OpenFaaSInvocation) (bool, error)
+}
+
+// NamespaceHeader transmits the namespace of the invoked function when the header invocation style is used
+const NamespaceHeader = "X-Function-Namespace"
+
+// QueueHeader selects the named queue onto which the gateway publishes an asynchronous invocation
+const QueueHeader = "X-Function-Queue"
+
+const (
+	// RedeliveredHeader is true if the message was delivered before, but not acknowledged
+	RedeliveredHeader = "X-Redelivered"
+	// RetryCountHeader holds the failed delivery attempts of a republished message, it is absent on the first attempt
+	RetryCountHeader = "X-Retry-Count"
+	// DeadlineHeader holds the milliseconds remaining until the deadline of the message, it is absent without deadline
+	DeadlineHeader = "X-Deadline"
+	// HashKeyHeader holds the hash of the affinity key of the message, which allows routing it to a pinned replica
+	HashKeyHeader = "X-Hash-Key"
+)
+
+// GatewayInvoker invokes functions via the http endpoints of the OpenFaaS gateway
+type GatewayInvoker struct {
+	*gateway
+	namespaceStyle string
+	asyncQueue     string
+	headersLock    sync.RWMutex
+	headers        map[string]string
+	hmacSecret     []byte
+
+	sniffContentType   bool
+	defaultContentType string
+}
+
+// NewGatewayInvoker creates an invoker for the gateway at the provided url. The namespace style controls how the
+// namespace of a function is encoded during invocation, if empty the OpenFaaS name.namespace convention is used.
+func NewGatewayInvoker(client *fasthttp.Client, creds *auth.BasicAuthCredentials, gatewayURL string, namespaceStyle string) *GatewayInvoker {
+	return &GatewayInvoker{
+		gateway:        newGateway(client, creds, gatewayURL),
+		namespaceStyle: namespaceStyle,
+	}
+}
+
+// WithAsyncQueue publishes asynchronous invocations onto the named queue instead of the default one,
+// which isolates them from other asynchronous work. An empty name uses the default queue.
+func (g *GatewayInvoker) WithAsyncQueue(name string) *GatewayInvoker {
+	g.asyncQueue = name
+	return g
+}
+
+// WithMetrics counts the throttled requests using the sink instead of Prometheus
+func (g *GatewayInvoker) WithMetrics(sink metrics.Sink) *GatewayInvoker {
+	g.metrics = sink
+	return g
+}
+
+// WithKeepAlives controls whether connections to the gateway are kept alive, see Client.WithKeepAlives
+func (g *GatewayInvoker) WithKeepAlives(enabled bool) *GatewayInvoker {
+	g.closeConns = !enabled
+	return g
+}
+
+// WithFallbackGateways sends the invocations to the fallback gateways in order while the gateway is unreachable,
+// see Client.WithFallbackGateways
+func (g *GatewayInvoker) WithFallbackGateways(urls ...string) *GatewayInvoker {
+	g.withFallbackGateways(urls)
+	return g
+}
+
+// WithHeaders sets static headers on every invocation, headers derived from the message or set by the
+// connector itself take precedence on conflicts.
+func (g *GatewayInvoker) WithHeaders(headers map[string]string) *GatewayInvoker {
+	g.SetHeaders(headers)
+	return g
+}
+
+// SetHeaders replaces the static headers, it is safe to call while invoking, e.g. once the headers were reloaded
+func (g *GatewayInvoker) SetHeaders(headers map[string]string) {
+	g.headersLock.Lock()
+	defer g.headersLock.Unlock()
+
+	g.headers = headers
+}
+
+// WithHMACSecret signs the body of every invocation using the secret, see SignatureHeader. An empty secret disables signing.
+func (g *GatewayInvoker) WithHMACSecret(secret string) *GatewayInvoker {
+	g.hmacSecret = []byte(secret)
+	return g
+}
+
+// InvokeSync calls a given function in a synchronous way waiting for the response using the provided payload while considering the provided context
+func (g *GatewayInvoker) InvokeSync(ctx context.Context, fn Function, invocation *internal.OpenFaaSInvocation) ([]byte, error) {
+	if len(fn.URL) > 0 {
+		return g.invokeURL(ctx, fn, invocation)
+	}
+
+	method, err := ParseInvokeMethod(fn.InvokeMethod())
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to invoke function %s", fn)
+	}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	g.setFunctionTarget(req, "function", fn)
+
+	req.Header.SetMethod(method)
+	g.setStaticHeaders(req)
+	g.setMessageHeaders(req, invocation)
+	if err := setBody(req, fn, invocation); err != nil {
+		return nil, errors.Wrapf(err, "unable to encode invocation of function %s", fn)
+	}
+	g.sign(req)
+	setTraceHeaders(ctx, req)
+	req.Header.SetUserAgent("OpenFaaS - Rabbit MQ Connector")
+	if g.credentials != nil {
+		req.Header.Set("Authorization", g.authorization)
+	}
+
+	err = g.do(ctx, req, resp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to invoke function %s", fn)
+	}
+
+	switch resp.StatusCode() {
+	case fasthttp.StatusOK:
+		// The response is released to the pool afterwards, hence the body has to be copied
+		return append([]byte(nil), resp.Body()...), nil
+	case fasthttp.StatusNotFound:
+		return nil, &StatusError{StatusCode: fasthttp.StatusNotFound, message: fmt.Sprintf("Function %s is not deployed", fn)}
+	default:
+		return nil, newStatusError(resp.StatusCode())
+	}
+}
+
+// InvokeAsync calls a given function in a asynchronous way waiting for the response using the provided payload while considering the provided context
+func (g *GatewayInvoker) InvokeAsync(ctx context.Context, fn Function, invocation *internal.OpenFaaSInvocation) (bool, error) {
+	if len(fn.URL) > 0 {
+		// Endpoints outside of OpenFaaS have no async support, hence they are invoked synchronously
+		_, err := g.invokeURL(ctx, fn, invocation)
+		return err == nil, err
+	}
+
+	method, err := ParseInvokeMethod(fn.InvokeMethod())
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to invoke function %s", fn)
+	}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	g.setFunctionTarget(req, "async-function", fn)
+
+	req.Header.SetMethod(method)
+	g.setStaticHeaders(req)
+	g.setMessageHeaders(req, invocation)
+	if err := setBody(req, fn, invocation); err != nil {
+		return false, errors.Wrapf(err, "unable to encode invocation of function %s", fn)
+	}
+	g.sign(req)
+	setTraceHeaders(ctx, req)
+	req.Header.SetUserAgent("OpenFaaS - Rabbit MQ Connector")
+	if len(g.asyncQueue) > 0 {
+		req.Header.Set(QueueHeader, g.asyncQueue)
+	}
+	if g.credentials != nil {
+		req.Header.Set("Authorization", g.authorization)
+	}
+
+	err = g.do(ctx, req, resp)
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to invoke function %s", fn)
+	}
+
+	switch resp.StatusCode() {
+	case fasthttp.StatusAccepted:
+		return true, nil
+	case fasthttp.StatusNotFound:
+		return false, &StatusError{StatusCode: fasthttp.StatusNotFound, message: fmt.Sprintf("Function %s is not deployed", fn)}
+	default:
+		return false, newStatusError(resp.StatusCode())
+	}
+}
+
+// invokeURL calls an endpoint outside of OpenFaaS, any 2xx status is treated as success. The gateway credentials
+// are not sent, as the endpoint is not part of OpenFaaS.
+func (g *GatewayInvoker) invokeURL(ctx context.Context, fn Function, invocation *internal.OpenFaaSInvocation) ([]byte, error) {
+	method, err := ParseInvokeMethod(fn.InvokeMethod())
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to invoke %s", fn)
+	}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(fn.URL)
+
+	req.Header.SetMethod(method)
+	g.setStaticHeaders(req)
+	g.setMessageHeaders(req, invocation)
+	if err := setBody(req, fn, invocation); err != nil {
+		return nil, errors.Wrapf(err, "unable to encode invocation of %s", fn)
+	}
+	g.sign(req)
+	setTraceHeaders(ctx, req)
+	req.Header.SetUserAgent("OpenFaaS - Rabbit MQ Connector")
+
+	err = g.do(ctx, req, resp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to invoke %s", fn)
+	}
+
+	if resp.StatusCode() < 200 || resp.StatusCode() > 299 {
+		return nil, &StatusError{StatusCode: resp.StatusCode(), message: fmt.Sprintf("Received unexpected Status Code %d from %s", resp.StatusCode(), fn)}
+	}
+
+	return append([]byte(nil), resp.Body()...), nil
+}
+
+// setStaticHeaders sets the static headers, which are overwritten by the headers derived from the message
+func (g *GatewayInvoker) setStaticHeaders(req *fasthttp.Request) {
+	g.headersLock.RLock()
+	defer g.headersLock.RUnlock()
+
+	for name, value := range g.headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// setMessageHeaders sets the headers derived from the message, which take precedence over the static headers
+func (g *GatewayInvoker) setMessageHeaders(req *fasthttp.Request, invocation *internal.OpenFaaSInvocation) {
+	req.Header.Set("Content-Type", g.contentType(invocation))
+	req.Header.Set("Content-Encoding", invocation.ContentEncoding)
+	req.Header.Set("Topic", invocation.Topic)
+	req.Header.Set(RedeliveredHeader, strconv.FormatBool(invocation.Redelivered))
+	if invocation.Retries > 0 {
+		req.Header.Set(RetryCountHeader, strconv.Itoa(invocation.Retries))
+	}
+	if !invocation.Deadline.IsZero() {
+		remaining := time.Until(invocation.Deadline).Milliseconds()
+		if remaining < 0 {
+			remaining = 0
+		}
+		req.Header.Set(DeadlineHeader, strconv.FormatInt(remaining, 10))
+	}
+	if len(invocation.HashKey) > 0 {
+		req.Header.Set(HashKeyHeader, invocation.HashKey)
+	}
+	if invocation.Warmup {
+		req.Header.Set(WarmupHeader, "true")
+	}
+}
+
+// setTraceHeaders continues the trace carried by the context, injecting its span context and baggage via
+// types.TracePropagator
+func setTraceHeaders(ctx context.Context, req *fasthttp.Request) {
+	internal.TracePropagator.Inject(ctx, fasthttpHeaderCarrier{header: &req.Header})
+}
+
+// fasthttpHeaderCarrier adapts the headers of a request to the propagation.TextMapCarrier of OpenTelemetry
+type fasthttpHeaderCarrier struct {
+	header *fasthttp.RequestHeader
+}
+
+func (c fasthttpHeaderCarrier) Get(key string) string {
+	return string(c.header.Peek(key))
+}
+
+func (c fasthttpHeaderCarrier) Set(key string, value string) {
+	c.header.Set(key, value)
+}
+
+func (c fasthttpHeaderCarrier) Keys() []string {
+	var keys []string
+	c.header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// setFunctionTarget sets the request uri for the provided function on the given endpoint. Encoding the namespace
+// according to the configured namespace style, unless the function was resolved to a target.
+func (g *GatewayInvoker) setFunctionTarget(req *fasthttp.Request, endpoint string, fn Function) {
+	if len(fn.Target) > 0 {
+		req.SetRequestURI(g.url + "/" + endpoint + "/" + fn.Target)
+		return
+	}
+	if len(fn.Namespace) == 0 {
+		req.SetRequestURI(g.url + "/" + endpoint + "/" + fn.Name)
+		return
+	}
+
+	// Concatenation is used over fmt as this is part of every invocation
+	switch g.namespaceStyle {
+	case config.NamespaceStylePath:
+		req.SetRequestURI(g.url + "/" + endpoint + "/" + fn.Namespace + "/" + fn.Name)
+	case config.NamespaceStyleHeader:
+		req.SetRequestURI(g.url + "/" + endpoint + "/" + fn.Name)
+		req.Header.Set(NamespaceHeader, fn.Namespace)
+	default:
+		req.SetRequestURI(g.url + "/" + endpoint + "/" + fn.Name + "." + fn.Namespace)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/openfaas/faas-provider/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGatewayInvoker(t *testing.T) {
+	type received struct {
+		path  string
+		user  string
+		queue string
+	}
+	requests := make(chan received, 1)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		requests <- received{path: r.URL.Path, user: user, queue: r.Header.Get(QueueHeader)}
+
+		if r.URL.Path == "/function/biller" {
+			w.WriteHeader(200)
+			_, _ = w.Write([]byte("Hello"))
+			return
+		}
+		w.WriteHeader(202)
+	}))
+	defer server.Close()
+
+	message := []byte("Test")
+	payload := types2.OpenFaaSInvocation{Topic: "Billing", Message: &message}
+	invoker := NewGatewayInvoker(CreateClient(server), &auth.BasicAuthCredentials{User: "User", Password: "Pass"}, server.URL, "").
+		WithAsyncQueue("billing-queue")
+
+	t.Run("Should invoke functions without a crawling client", func(t *testing.T) {
+		response, err := invoker.InvokeSync(context.Background(), Function{Name: "biller"}, &payload)
+		assert.NoError(t, err, "Should not fail")
+		assert.Equal(t, []byte("Hello"), response)
+		assert.Equal(t, received{path: "/function/biller", user: "User"}, <-requests)
+
+		ok, err := invoker.InvokeAsync(context.Background(), Function{Name: "biller"}, &payload)
+		assert.NoError(t, err, "Should not fail")
+		assert.True(t, ok)
+		assert.Equal(t, received{path: "/async-function/biller", user: "User", queue: "billing-queue"}, <-requests)
+	})
+
+	t.Run("Should pass the hash key on", func(t *testing.T) {
+		hashKeys := make(chan string, 1)
+		pinned := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hashKeys <- r.Header.Get(HashKeyHeader)
+			w.WriteHeader(202)
+		}))
+		defer pinned.Close()
+		target := NewGatewayInvoker(CreateClient(pinned), nil, pinned.URL, "")
+
+		for _, hashKey := range []string{"a1b2c3", ""} {
+			_, err := target.InvokeAsync(context.Background(), Function{Name: "biller"}, &types2.OpenFaaSInvocation{Topic: "Billing", Message: &message, HashKey: hashKey})
+			assert.NoError(t, err, "Should not fail")
+			assert.Equal(t, hashKey, <-hashKeys)
+		}
+	})
+
+	t.Run("Should be shared with the client", func(t *testing.T) {
+		client := NewClient(CreateClient(server), nil, server.URL, "").WithAsyncQueue("billing-queue")
+
+		assert.Equal(t, "billing-queue", client.Invoker().asyncQueue)
+		assert.Same(t, client.gateway, client.Invoker().gateway, "Expected the connection to the gateway to be shared")
+	})
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+// Package openfaastest provides fakes for testing code that builds upon the openfaas package,
+// without requiring a running OpenFaaS gateway.
+package openfaastest
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/Templum/rabbitmq-connector/pkg/openfaas"
+	internal "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/openfaas/faas-provider/types"
+)
+
+// Invocation describes a call received by the FakeCrawler
+type Invocation struct {
+	Function openfaas.Function
+	Topic    string
+	Message  []byte
+	// Sync is true for invocations using InvokeSync
+	Sync bool
+}
+
+// FakeCrawler implements openfaas.FunctionCrawler by serving scripted namespaces, functions and errors.
+// Every invocation is recorded. It is safe to script the crawler while it is used.
+type FakeCrawler struct {
+	lock sync.Mutex
+
+	namespaces   []string
+	functions    map[string][]types.FunctionStatus
+	responses    map[string][]byte
+	namespaceErr error
+	functionErrs map[string]error
+	invokeErrs   map[string]error
+	invocations  []Invocation
+}
+
+// NewFakeCrawler returns a crawler without namespace support, that serves no functions
+func NewFakeCrawler() *FakeCrawler {
+	return &FakeCrawler{
+		functions:    map[string][]types.FunctionStatus{},
+		responses:    map[string][]byte{},
+		functionErrs: map[string]error{},
+		invokeErrs:   map[string]error{},
+	}
+}
+
+// WithNamespaces enables namespace support and serves the provided namespaces
+func (f *FakeCrawler) WithNamespaces(namespaces ...string) *FakeCrawler {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.namespaces = namespaces
+	return f
+}
+
+// WithFunctions adds functions to the namespace, use an empty namespace if namespace support is disabled
+func (f *FakeCrawler) WithFunctions(namespace string, functions ...types.FunctionStatus) *FakeCrawler {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.functions[namespace] = append(f.functions[namespace], functions...)
+	return f
+}
+
+// WithFunction adds a ready function to the namespace, which subscribes the provided topics via its annotation
+func (f *FakeCrawler) WithFunction(namespace string, name string, topics ...string) *FakeCrawler {
+	return f.WithFunctions(namespace, NewFunctionStatus(name, topics...))
+}
+
+// WithoutFunctions removes all functions from the namespace
+func (f *FakeCrawler) WithoutFunctions(namespace string) *FakeCrawler {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	delete(f.functions, namespace)
+	return f
+}
+
+// WithResponse sets the body returned by InvokeSync for the function, which is addressed as name.namespace
+func (f *FakeCrawler) WithResponse(function string, body []byte) *FakeCrawler {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.responses[function] = body
+	return f
+}
+
+// WithNamespacesError lets fetching the namespaces fail, nil clears the error
+func (f *FakeCrawler) WithNamespacesError(err error) *FakeCrawler {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.namespaceErr = err
+	return f
+}
+
+// WithFunctionsError lets fetching the functions of the namespace fail, nil clears the error
+func (f *FakeCrawler) WithFunctionsError(namespace string, err error) *FakeCrawler {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.setError(f.functionErrs, namespace, err)
+	return f
+}
+
+// WithInvokeError lets invocations of the function fail, which is addressed as name.namespace. Nil clears the error.
+func (f *FakeCrawler) WithInvokeError(function string, err error) *FakeCrawler {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.setError(f.invokeErrs, function, err)
+	return f
+}
+
+// Invocations returns the recorded invocations in the order they were received
+func (f *FakeCrawler) Invocations() []Invocation {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return append([]Invocation(nil), f.invocations...)
+}
+
+// Reset clears the recorded invocations
+func (f *FakeCrawler) Reset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.invocations = nil
+}
+
+// HasNamespaceSupport is true once namespaces were set
+func (f *FakeCrawler) HasNamespaceSupport(_ context.Context) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return len(f.namespaces) > 0, nil
+}
+
+// GetNamespaces returns the scripted namespaces
+func (f *FakeCrawler) GetNamespaces(_ context.Context) ([]string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.namespaceErr != nil {
+		return nil, f.namespaceErr
+	}
+	return append([]string(nil), f.namespaces...), nil
+}
+
+// GetFunctions returns the scripted functions of the namespace
+func (f *FakeCrawler) GetFunctions(_ context.Context, namespace string) ([]types.FunctionStatus, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err, exists := f.functionErrs[namespace]; exists {
+		return nil, err
+	}
+	return append([]types.FunctionStatus(nil), f.functions[namespace]...), nil
+}
+
+// InvokeSync records the invocation and returns the scripted response
+func (f *FakeCrawler) InvokeSync(ctx context.Context, fn openfaas.Function, invocation *internal.OpenFaaSInvocation) ([]byte, error) {
+	if err := f.record(ctx, fn, invocation, true); err != nil {
+		return nil, err
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.responses[fn.String()], nil
+}
+
+// InvokeAsync records the invocation
+func (f *FakeCrawler) InvokeAsync(ctx context.Context, fn openfaas.Function, invocation *internal.OpenFaaSInvocation) (bool, error) {
+	if err := f.record(ctx, fn, invocation, false); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// record adds the invocation, even if it fails, and returns the scripted error of the function or the one of the context
+func (f *FakeCrawler) record(ctx context.Context, fn openfaas.Function, invocation *internal.OpenFaaSInvocation, synchronous bool) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	recorded := Invocation{Function: fn, Sync: synchronous}
+	if invocation != nil {
+		recorded.Topic = invocation.Topic
+		if invocation.Message != nil {
+			recorded.Message = append([]byte(nil), *invocation.Message...)
+		}
+	}
+	f.invocations = append(f.invocations, recorded)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.invokeErrs[fn.String()]
+}
+
+func (f *FakeCrawler) setError(errs map[string]error, key string, err error) {
+	if err == nil {
+		delete(errs, key)
+		return
+	}
+	errs[key] = err
+}
+
+// NewFunctionStatus returns a ready function, which subscribes the provided topics via its annotation
+func NewFunctionStatus(name string, topics ...string) types.FunctionStatus {
+	status := types.FunctionStatus{Name: name, Replicas: 1, AvailableReplicas: 1}
+	if len(topics) > 0 {
+		annotations := map[string]string{"topic": strings.Join(topics, ",")}
+		status.Annotations = &annotations
+	}
+	return status
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaastest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Templum/rabbitmq-connector/pkg/openfaas"
+	internal "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ openfaas.FunctionCrawler = &FakeCrawler{}
+
+func TestFakeCrawler(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should not support namespaces by default", func(t *testing.T) {
+		target := NewFakeCrawler().WithFunction("", "biller", "billing")
+
+		supported, _ := target.HasNamespaceSupport(ctx)
+		functions, err := target.GetFunctions(ctx, "")
+
+		assert.False(t, supported)
+		assert.NoError(t, err, "should not throw")
+		assert.Len(t, functions, 1)
+		assert.Equal(t, "billing", (*functions[0].Annotations)["topic"])
+	})
+
+	t.Run("Should serve the scripted namespaces", func(t *testing.T) {
+		target := NewFakeCrawler().WithNamespaces("faas", "billing")
+
+		supported, _ := target.HasNamespaceSupport(ctx)
+		namespaces, err := target.GetNamespaces(ctx)
+
+		assert.True(t, supported)
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, []string{"faas", "billing"}, namespaces)
+	})
+
+	t.Run("Should return the scripted errors until they are cleared", func(t *testing.T) {
+		target := NewFakeCrawler().
+			WithNamespacesError(errors.New("expected")).
+			WithFunctionsError("faas", errors.New("expected"))
+
+		_, err := target.GetNamespaces(ctx)
+		assert.Error(t, err, "should throw")
+		_, err = target.GetFunctions(ctx, "faas")
+		assert.Error(t, err, "should throw")
+
+		target.WithNamespacesError(nil).WithFunctionsError("faas", nil)
+
+		_, err = target.GetNamespaces(ctx)
+		assert.NoError(t, err, "should not throw")
+		_, err = target.GetFunctions(ctx, "faas")
+		assert.NoError(t, err, "should not throw")
+	})
+
+	t.Run("Should record every invocation including failed ones", func(t *testing.T) {
+		message := []byte("Hello World")
+		target := NewFakeCrawler().
+			WithResponse("biller.faas", []byte("billed")).
+			WithInvokeError("wrencher", errors.New("expected"))
+
+		body, err := target.InvokeSync(ctx, openfaas.Function{Name: "biller", Namespace: "faas"}, &internal.OpenFaaSInvocation{Topic: "billing", Message: &message})
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, []byte("billed"), body)
+
+		_, err = target.InvokeAsync(ctx, openfaas.Function{Name: "wrencher"}, &internal.OpenFaaSInvocation{Topic: "transport"})
+		assert.Error(t, err, "should throw")
+
+		assert.Equal(t, []Invocation{
+			{Function: openfaas.Function{Name: "biller", Namespace: "faas"}, Topic: "billing", Message: []byte("Hello World"), Sync: true},
+			{Function: openfaas.Function{Name: "wrencher"}, Topic: "transport"},
+		}, target.Invocations())
+
+		target.Reset()
+		assert.Empty(t, target.Invocations())
+	})
+
+	t.Run("Should fail invocations once the context is done", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := NewFakeCrawler().InvokeAsync(cancelled, openfaas.Function{Name: "biller"}, nil)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
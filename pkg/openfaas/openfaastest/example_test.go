@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaastest_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/Templum/rabbitmq-connector/pkg/openfaas"
+	"github.com/Templum/rabbitmq-connector/pkg/openfaas/openfaastest"
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+)
+
+// Example wires a Controller against the fakes, which crawls the scripted functions and invokes
+// the ones subscribed to the topic.
+func Example() {
+	crawler := openfaastest.NewFakeCrawler().
+		WithNamespaces("faas").
+		WithFunction("faas", "biller", "billing", "invoice").
+		WithFunction("faas", "wrencher", "transport")
+	topics := openfaastest.NewTopicMap()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	controller := openfaas.NewController(&config.Controller{TopicRefreshTime: time.Minute}, crawler, topics)
+	controller.Start(ctx)
+
+	message := []byte(`{"amount":42}`)
+	_, err := controller.Invoke("billing", &types.OpenFaaSInvocation{Topic: "billing", Message: &message})
+
+	fmt.Println(err)
+	for _, invocation := range crawler.Invocations() {
+		fmt.Println(invocation.Function, invocation.Topic, string(invocation.Message))
+	}
+	// Output:
+	// <nil>
+	// biller.faas billing {"amount":42}
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaastest
+
+import (
+	"sync"
+
+	"github.com/Templum/rabbitmq-connector/pkg/openfaas"
+)
+
+// TopicMap implements openfaas.TopicMap in memory. Like the real cache it does not return paused functions
+// for invocation, while Topics exposes exactly what the controller crawled.
+type TopicMap struct {
+	lock      sync.RWMutex
+	mapping   map[string][]openfaas.Function
+	refreshes int
+}
+
+// NewTopicMap returns an empty topic map
+func NewTopicMap() *TopicMap {
+	return &TopicMap{mapping: map[string][]openfaas.Function{}}
+}
+
+// GetCachedValues returns the functions of the topic, excluding paused functions
+func (m *TopicMap) GetCachedValues(name string) []openfaas.Function {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	var active []openfaas.Function
+	for _, fn := range m.mapping[name] {
+		if !fn.Paused {
+			active = append(active, fn)
+		}
+	}
+	return active
+}
+
+// GetDeliveryMode derives the delivery mode of the topic like the real cache
+func (m *TopicMap) GetDeliveryMode(name string) openfaas.DeliveryMode {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return openfaas.TopicDeliveryMode(name, m.mapping[name])
+}
+
+// Refresh replaces the mapping
+func (m *TopicMap) Refresh(update map[string][]openfaas.Function) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.mapping = update
+	m.refreshes++
+}
+
+// Topics returns a copy of the current mapping
+func (m *TopicMap) Topics() map[string][]openfaas.Function {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	topics := make(map[string][]openfaas.Function, len(m.mapping))
+	for topic, functions := range m.mapping {
+		topics[topic] = append([]openfaas.Function(nil), functions...)
+	}
+	return topics
+}
+
+// Refreshes returns how often the mapping was refreshed
+func (m *TopicMap) Refreshes() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.refreshes
+}
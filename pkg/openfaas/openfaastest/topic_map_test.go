@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaastest
+
+import (
+	"testing"
+
+	"github.com/Templum/rabbitmq-connector/pkg/openfaas"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ openfaas.TopicMap = &TopicMap{}
+
+func TestTopicMap(t *testing.T) {
+	t.Run("Should serve the refreshed mapping without paused functions", func(t *testing.T) {
+		update := map[string][]openfaas.Function{
+			"billing": {{Name: "biller"}, {Name: "notifier", Paused: true}},
+		}
+		target := NewTopicMap()
+
+		target.Refresh(update)
+
+		assert.Equal(t, []openfaas.Function{{Name: "biller"}}, target.GetCachedValues("billing"))
+		assert.Empty(t, target.GetCachedValues("transport"))
+		assert.Equal(t, update, target.Topics())
+		assert.Equal(t, 1, target.Refreshes())
+	})
+
+	t.Run("Should derive the delivery mode like the real cache", func(t *testing.T) {
+		target := NewTopicMap()
+
+		target.Refresh(map[string][]openfaas.Function{
+			"billing":   {{Name: "biller", DeliveryMode: openfaas.BestEffort}, {Name: "notifier"}},
+			"transport": {{Name: "biller", DeliveryMode: openfaas.BestEffort}, {Name: "notifier", DeliveryMode: openfaas.FailFast}},
+		})
+
+		assert.Equal(t, openfaas.BestEffort, target.GetDeliveryMode("billing"))
+		assert.Equal(t, openfaas.FailFast, target.GetDeliveryMode("transport"))
+		assert.Equal(t, openfaas.FailFast, target.GetDeliveryMode("invoice"))
+	})
+}
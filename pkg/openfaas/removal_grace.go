@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+type trackedFunction struct {
+	function      Function
+	topics        []string
+	notReadySince time.Time
+}
+
+// RemovalGrace keeps functions that were routed during the previous crawl, but are now either missing
+// or report no available replicas, as draining until the grace period elapsed. This bridges rolling
+// updates, where a function briefly has no ready replica. Functions that never were routed while being
+// unavailable are not added. It is safe for concurrent use during a crawl.
+type RemovalGrace struct {
+	grace time.Duration
+	now   func() time.Time
+
+	lock     sync.Mutex
+	previous map[string]*trackedFunction
+	current  map[string]*trackedFunction
+}
+
+// NewRemovalGrace returns a tracker for the provided grace period
+func NewRemovalGrace(grace time.Duration) *RemovalGrace {
+	return &RemovalGrace{
+		grace:    grace,
+		now:      time.Now,
+		previous: map[string]*trackedFunction{},
+		current:  map[string]*trackedFunction{},
+	}
+}
+
+// Begin starts a new crawl, functions admitted during the previous crawl are considered routed
+func (r *RemovalGrace) Begin() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.current = make(map[string]*trackedFunction, len(r.previous))
+}
+
+// Admit reports whether the crawled function should be routed for the topic, draining functions are marked as such
+func (r *RemovalGrace) Admit(topic string, fn Function, ready bool) (Function, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	key := fn.String()
+	tracked, exists := r.current[key]
+	if !exists {
+		since := r.now()
+		if previous, routed := r.previous[key]; routed && !previous.notReadySince.IsZero() {
+			since = previous.notReadySince
+		} else if !routed && !ready {
+			return fn, false
+		}
+
+		if !ready && r.now().Sub(since) >= r.grace {
+			log.Printf("Removing function %s as it has no available replica since %s", key, since.Format(time.RFC3339))
+			return fn, false
+		}
+
+		tracked = &trackedFunction{function: fn}
+		if !ready {
+			tracked.notReadySince = since
+		}
+		r.current[key] = tracked
+	}
+
+	tracked.topics = append(tracked.topics, topic)
+	if !tracked.notReadySince.IsZero() {
+		fn.Draining = true
+	}
+	return fn, true
+}
+
+// Finish completes the crawl and calls retain for every topic of functions that went missing but are still within their grace period
+func (r *RemovalGrace) Finish(retain func(topic string, fn Function)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for key, previous := range r.previous {
+		if _, crawled := r.current[key]; crawled {
+			continue
+		}
+
+		since := previous.notReadySince
+		if since.IsZero() {
+			since = r.now()
+		}
+		if r.now().Sub(since) >= r.grace {
+			log.Printf("Removing function %s as it is missing since %s", key, since.Format(time.RFC3339))
+			continue
+		}
+
+		fn := previous.function
+		fn.Draining = true
+		r.current[key] = &trackedFunction{function: fn, topics: previous.topics, notReadySince: since}
+		for _, topic := range previous.topics {
+			retain(topic, fn)
+		}
+	}
+
+	r.previous = r.current
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// replicaCrawlerStub serves a mutable list of functions, so that tests can simulate rolling updates
+type replicaCrawlerStub struct {
+	fakeCrawler
+}
+
+func (r *replicaCrawlerStub) set(functions ...types.FunctionStatus) {
+	r.functions = functions
+}
+
+func billingFunction(name string, available uint64) types.FunctionStatus {
+	annotations := map[string]string{"topic": "billing"}
+	return types.FunctionStatus{Name: name, Annotations: &annotations, AvailableReplicas: available}
+}
+
+func TestRemovalGrace(t *testing.T) {
+	newTarget := func() (*Controller, *TopicFunctionCache, *replicaCrawlerStub, *time.Time) {
+		now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+		crawler := &replicaCrawlerStub{}
+		cache := NewTopicFunctionCache()
+
+		target := NewController(&config.Controller{FunctionRemovalGrace: time.Minute}, crawler, cache)
+		target.removal.now = func() time.Time { return now }
+		return target, cache, crawler, &now
+	}
+
+	t.Run("Should keep a function without available replica as draining within the grace period", func(t *testing.T) {
+		target, cache, crawler, now := newTarget()
+
+		crawler.set(billingFunction("biller", 1))
+		target.refreshTick(context.Background(), false)
+		assert.Equal(t, []Function{{Name: "biller"}}, cache.GetCachedValues("billing"))
+
+		crawler.set(billingFunction("biller", 0))
+		*now = now.Add(30 * time.Second)
+		target.refreshTick(context.Background(), false)
+		assert.Equal(t, []Function{{Name: "biller", Draining: true}}, cache.GetCachedValues("billing"), "Expected function to be draining")
+
+		*now = now.Add(20 * time.Second)
+		target.refreshTick(context.Background(), false)
+		assert.Equal(t, []Function{{Name: "biller", Draining: true}}, cache.GetCachedValues("billing"), "Expected grace to count from the first crawl without replica")
+
+		crawler.set(billingFunction("biller", 2))
+		target.refreshTick(context.Background(), false)
+		assert.Equal(t, []Function{{Name: "biller"}}, cache.GetCachedValues("billing"), "Expected function to be ready again")
+	})
+
+	t.Run("Should remove a function once the grace period elapsed", func(t *testing.T) {
+		target, cache, crawler, now := newTarget()
+
+		crawler.set(billingFunction("biller", 1))
+		target.refreshTick(context.Background(), false)
+
+		crawler.set(billingFunction("biller", 0))
+		target.refreshTick(context.Background(), false)
+
+		*now = now.Add(time.Minute)
+		target.refreshTick(context.Background(), false)
+		assert.Empty(t, cache.GetCachedValues("billing"), "Expected function to be removed")
+
+		target.refreshTick(context.Background(), false)
+		assert.Empty(t, cache.GetCachedValues("billing"), "Expected function to stay removed")
+	})
+
+	t.Run("Should keep a missing function within the grace period", func(t *testing.T) {
+		target, cache, crawler, now := newTarget()
+
+		crawler.set(billingFunction("biller", 1), billingFunction("notifier", 1))
+		target.refreshTick(context.Background(), false)
+
+		crawler.set(billingFunction("notifier", 1))
+		*now = now.Add(10 * time.Second)
+		target.refreshTick(context.Background(), false)
+		assert.ElementsMatch(t, []Function{{Name: "notifier"}, {Name: "biller", Draining: true}}, cache.GetCachedValues("billing"))
+
+		crawler.set(billingFunction("notifier", 1), billingFunction("biller", 1))
+		target.refreshTick(context.Background(), false)
+		assert.ElementsMatch(t, []Function{{Name: "notifier"}, {Name: "biller"}}, cache.GetCachedValues("billing"), "Expected function to reappear")
+
+		crawler.set(billingFunction("notifier", 1))
+		target.refreshTick(context.Background(), false)
+		*now = now.Add(time.Minute)
+		target.refreshTick(context.Background(), false)
+		assert.Equal(t, []Function{{Name: "notifier"}}, cache.GetCachedValues("billing"), "Expected missing function to be removed")
+	})
+
+	t.Run("Should not add a function that never had an available replica", func(t *testing.T) {
+		target, cache, crawler, _ := newTarget()
+
+		crawler.set(billingFunction("biller", 0))
+		target.refreshTick(context.Background(), false)
+
+		assert.Empty(t, cache.GetCachedValues("billing"))
+	})
+
+	t.Run("Should ignore replicas without a grace period", func(t *testing.T) {
+		crawler := &replicaCrawlerStub{}
+		crawler.set(billingFunction("biller", 0))
+		cache := NewTopicFunctionCache()
+
+		target := NewController(&config.Controller{}, crawler, cache)
+		target.refreshTick(context.Background(), false)
+
+		assert.Equal(t, []Function{{Name: "biller"}}, cache.GetCachedValues("billing"))
+	})
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"log"
+	"strings"
+
+	"github.com/Templum/rabbitmq-connector/pkg/schema"
+	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/openfaas/faas-provider/types"
+)
+
+// schemas returns the configured schemas, nil if validation is disabled
+func (c *Controller) schemas() *schema.Registry {
+	if c.conf == nil {
+		return nil
+	}
+	return c.conf.Schemas
+}
+
+// validateTopic validates the message against the schema named like the topic, topics without schema pass. A message
+// that does not match is rejected without invoking any function.
+func (c *Controller) validateTopic(topic string, invocation *types2.OpenFaaSInvocation) error {
+	s, ok := c.schemas().Get(topic)
+	if !ok {
+		return nil
+	}
+	return validateMessage(s, invocation)
+}
+
+// validateFunction validates the message against the schema referenced via schema annotation, if any. A message that
+// does not match fails the invocation of the function instead of invoking it.
+func (c *Controller) validateFunction(fn Function, invocation *types2.OpenFaaSInvocation) error {
+	if len(fn.Schema) == 0 {
+		return nil
+	}
+
+	s, ok := c.schemas().Get(fn.Schema)
+	if !ok {
+		return nil
+	}
+	return validateMessage(s, invocation)
+}
+
+// validateMessage returns a schema.ValidationError if the message does not match, it is not retryable
+func validateMessage(s *schema.Schema, invocation *types2.OpenFaaSInvocation) error {
+	var message []byte
+	if invocation != nil && invocation.Message != nil {
+		message = *invocation.Message
+	}
+	return s.Validate(message)
+}
+
+// extractSchemaFromAnnotations reads the schema annotation, unknown schemas are ignored with a warning
+func (c *Controller) extractSchemaFromAnnotations(fn types.FunctionStatus) string {
+	if fn.Annotations == nil {
+		return ""
+	}
+
+	ref := strings.TrimSpace((*fn.Annotations)[SchemaAnnotation])
+	if len(ref) == 0 {
+		return ""
+	}
+
+	if _, ok := c.schemas().Get(ref); !ok {
+		log.Printf("Function %s references the unknown schema %s via %s annotation, will not validate its messages", fn.Name, ref, SchemaAnnotation)
+		return ""
+	}
+	return ref
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/Templum/rabbitmq-connector/pkg/schema"
+	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCacher_SchemaValidation(t *testing.T) {
+	order, err := schema.Compile("order", []byte(`{"type": "object", "required": ["id"]}`))
+	assert.NoError(t, err, "should not throw")
+
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{
+		{Name: "shipper", Annotations: &map[string]string{"topic": "order"}},
+		{Name: "auditor", Annotations: &map[string]string{"topic": "audit"}},
+		{Name: "ledger", Annotations: &map[string]string{"topic": "payment", SchemaAnnotation: "order.json"}},
+		{Name: "mistyped", Annotations: &map[string]string{"topic": "refund", SchemaAnnotation: "unknown"}},
+	}, nil)
+	clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+	target := NewController(&config.Controller{Schemas: schema.NewRegistry(order)}, clientMock, NewTopicFunctionCache())
+	target.refreshTick(context.Background(), false)
+
+	invoke := func(topic string, message string) ([]types2.InvocationResult, error) {
+		body := []byte(message)
+		return target.Invoke(topic, &types2.OpenFaaSInvocation{Topic: topic, Message: &body})
+	}
+
+	t.Run("Should invoke messages matching the schema of the topic", func(t *testing.T) {
+		results, err := invoke("order", `{"id": "order-42"}`)
+
+		assert.NoError(t, err, "should not throw")
+		assert.Len(t, results, 1)
+	})
+
+	t.Run("Should reject messages not matching the schema of the topic without invoking", func(t *testing.T) {
+		clientMock.Calls = nil
+
+		results, err := invoke("order", `{"amount": 42}`)
+
+		var validationErr *schema.ValidationError
+		assert.True(t, errors.As(err, &validationErr), "Expected a validation error")
+		assert.True(t, types2.IsNonRetryable(err))
+		assert.Empty(t, results)
+		clientMock.AssertNotCalled(t, "InvokeAsync", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Should pass messages of topics without schema through", func(t *testing.T) {
+		results, err := invoke("audit", `not json`)
+
+		assert.NoError(t, err, "should not throw")
+		assert.Len(t, results, 1)
+	})
+
+	t.Run("Should validate against the schema referenced by the function", func(t *testing.T) {
+		clientMock.Calls = nil
+
+		results, err := invoke("payment", `[]`)
+
+		assert.EqualError(t, err, "message does not match schema order at $: expected object, got array")
+		assert.Len(t, results, 1)
+		assert.Equal(t, types2.StatusFailure, results[0].Status)
+		clientMock.AssertNotCalled(t, "InvokeAsync", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Should ignore unknown schemas referenced by the function", func(t *testing.T) {
+		_, err := invoke("refund", `not json`)
+
+		assert.NoError(t, err, "should not throw")
+	})
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/spf13/afero"
+)
+
+// headerSetter is implemented by invokers whose static headers can be replaced while invoking, like the Client
+type headerSetter interface {
+	SetHeaders(headers map[string]string)
+}
+
+// settingsFile polls the modification time of the settings file, so that the reloadable settings are applied without
+// a restart
+type settingsFile struct {
+	fs   afero.Fs
+	path string
+	// startup are the settings applied on startup, changes of the settings that require a restart are compared to them
+	startup *config.Settings
+	modTime time.Time
+}
+
+// poll returns the settings and true if the file was modified since the last poll. If the file can not be read or is
+// invalid, the previous settings are kept.
+func (f *settingsFile) poll() (*config.Settings, bool) {
+	info, err := f.fs.Stat(f.path)
+	if err != nil {
+		if !f.modTime.IsZero() {
+			log.Printf("Failed to stat settings %s due to %s, will keep the previous settings", f.path, err)
+			f.modTime = time.Time{}
+		}
+		return nil, false
+	}
+	if info.ModTime().Equal(f.modTime) {
+		return nil, false
+	}
+	f.modTime = info.ModTime()
+
+	settings, err := config.ReadSettings(f.fs, f.path)
+	if err != nil {
+		log.Printf("Failed to reload settings due to %s, will keep the previous settings", err)
+		return nil, false
+	}
+
+	if changed := settings.RestartRequired(f.startup); len(changed) > 0 {
+		log.Printf("WARNING: Settings %s changed %s, which requires a restart to be applied", f.path, strings.Join(changed, ", "))
+	}
+	return settings, true
+}
+
+// applySettings applies the reloadable settings, the ones absent from the settings fall back to the config
+func (c *Controller) applySettings(settings *config.Settings) {
+	c.annotations.SetKeys(settings.TopicAnnotations)
+	c.settingsStatic = newStaticMappings(settings.StaticMappings)
+
+	if setter, ok := c.invoker.(headerSetter); ok {
+		var headers map[string]string
+		if c.conf != nil {
+			headers = c.conf.InvocationHeaders
+		}
+		setter.SetHeaders(mergeHeaders(headers, settings.InvocationHeaders))
+	}
+}
+
+// mergeHeaders returns a copy of the headers, with the overrides taking precedence
+func mergeHeaders(headers map[string]string, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(headers)+len(overrides))
+	for name, value := range headers {
+		merged[name] = value
+	}
+	for name, value := range overrides {
+		merged[name] = value
+	}
+	return merged
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// headerInvokerStub records the headers set by the controller
+type headerInvokerStub struct {
+	*MockOpenFaaSClient
+	headers []map[string]string
+}
+
+func (h *headerInvokerStub) SetHeaders(headers map[string]string) {
+	h.headers = append(h.headers, headers)
+}
+
+func TestController_SettingsFile(t *testing.T) {
+	annotations := map[string]string{"topic": "billing", "subscribes": "invoice"}
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetFunctions", mock.Anything).Return([]types.FunctionStatus{{Name: "biller", Annotations: &annotations}}, nil)
+
+	// writeSettings advances the modification time, so that every write is detected
+	modTime := time.Now()
+	writeSettings := func(fs afero.Fs, content string) {
+		_ = afero.WriteFile(fs, "settings.yaml", []byte(content), 0644)
+		modTime = modTime.Add(time.Second)
+		_ = fs.Chtimes("settings.yaml", modTime, modTime)
+	}
+
+	t.Run("Should use the changed annotation key with the next refresh", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		writeSettings(fs, `topic_annotations: [topic]`)
+
+		cache := NewTopicFunctionCache()
+		target := NewController(&config.Controller{}, clientMock, cache).WithSettingsFile(fs, "settings.yaml")
+
+		target.refreshTick(context.Background(), false)
+		assert.Equal(t, []Function{{Name: "biller"}}, cache.GetCachedValues("billing"))
+		assert.Empty(t, cache.GetCachedValues("invoice"))
+
+		writeSettings(fs, `topic_annotations: [subscribes]`)
+		target.refreshTick(context.Background(), false)
+		assert.Empty(t, cache.GetCachedValues("billing"), "Expected the previous annotation to be ignored")
+		assert.Equal(t, []Function{{Name: "biller"}}, cache.GetCachedValues("invoice"))
+	})
+
+	t.Run("Should keep the previous settings if the changed file is invalid", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		writeSettings(fs, `topic_annotations: [subscribes]`)
+
+		cache := NewTopicFunctionCache()
+		target := NewController(&config.Controller{}, clientMock, cache).WithSettingsFile(fs, "settings.yaml")
+		target.refreshTick(context.Background(), false)
+
+		writeSettings(fs, `topic_annotations: subscribes`)
+		target.refreshTick(context.Background(), false)
+		assert.Equal(t, []Function{{Name: "biller"}}, cache.GetCachedValues("invoice"))
+		assert.Empty(t, cache.GetCachedValues("billing"))
+	})
+
+	t.Run("Should merge the invocation headers with the configured ones", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		writeSettings(fs, `invocation_headers: {X-Tenant: acme, X-Env: settings}`)
+
+		invoker := &headerInvokerStub{MockOpenFaaSClient: clientMock}
+		conf := &config.Controller{InvocationHeaders: map[string]string{"X-Env": "env", "X-Auth": "token"}}
+		target := NewController(conf, clientMock, NewTopicFunctionCache()).WithInvoker(invoker).WithSettingsFile(fs, "settings.yaml")
+
+		target.refreshTick(context.Background(), false)
+		target.refreshTick(context.Background(), false)
+		assert.Equal(t, []map[string]string{{"X-Tenant": "acme", "X-Env": "settings", "X-Auth": "token"}}, invoker.headers, "Expected the unchanged file to be applied once")
+
+		writeSettings(fs, `topic_annotations: [topic]`)
+		target.refreshTick(context.Background(), false)
+		assert.Equal(t, map[string]string{"X-Env": "env", "X-Auth": "token"}, invoker.headers[1], "Expected removed headers to fall back to the configured ones")
+	})
+
+	t.Run("Should replace the static mappings of the same topic", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		writeSettings(fs, `static_mappings: {invoice: [invoicer.legacy]}`)
+
+		conf := &config.Controller{StaticMappings: map[string][]string{"invoice": {"archiver"}, "audit": {"auditor"}}}
+		cache := NewTopicFunctionCache()
+		target := NewController(conf, clientMock, cache).WithSettingsFile(fs, "settings.yaml")
+
+		target.refreshTick(context.Background(), false)
+		assert.Equal(t, []Function{{Name: "invoicer", Namespace: "legacy", Static: true}}, cache.GetCachedValues("invoice"))
+		assert.Equal(t, []Function{{Name: "auditor", Static: true}}, cache.GetCachedValues("audit"))
+	})
+}
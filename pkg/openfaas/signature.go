@@ -0,0 +1,36 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/valyala/fasthttp"
+)
+
+// SignatureHeader holds the HMAC-SHA256 of the invocation body as sha256=<hex>, like the X-Hub-Signature-256 of
+// GitHub webhooks, if a HMAC secret is configured. Functions verify it using the same secret.
+const SignatureHeader = "X-Hub-Signature-256"
+
+// signaturePrefix names the hash function within the signature header value
+const signaturePrefix = "sha256="
+
+// Sign computes the value of the SignatureHeader for the body
+func Sign(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sign sets the signature header for the final body of the request, hence it has to be called once the body is set
+func (g *GatewayInvoker) sign(req *fasthttp.Request) {
+	if len(g.hmacSecret) == 0 {
+		return
+	}
+	req.Header.Set(SignatureHeader, Sign(g.hmacSecret, req.Body()))
+}
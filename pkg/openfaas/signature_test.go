@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	t.Run("Should compute the HMAC-SHA256 of the body", func(t *testing.T) {
+		// Test case 2 of RFC 4231
+		assert.Equal(t, "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843", Sign([]byte("Jefe"), []byte("what do ya want for nothing?")))
+	})
+}
+
+func TestGatewayInvoker_WithHMACSecret(t *testing.T) {
+	type received struct {
+		body      []byte
+		signature string
+	}
+
+	requests := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{body: body, signature: r.Header.Get(SignatureHeader)}
+		if strings.HasPrefix(r.URL.Path, "/async-function/") {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	verifies := func(secret string, request received) bool {
+		signature, err := hex.DecodeString(strings.TrimPrefix(request.signature, "sha256="))
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(request.body)
+		return hmac.Equal(signature, mac.Sum(nil))
+	}
+
+	message := []byte("Invoice #42")
+	invocation := &types2.OpenFaaSInvocation{Topic: "billing", Message: &message}
+	target := NewGatewayInvoker(CreateClient(server), nil, server.URL, "").WithHMACSecret("s3cr3t")
+
+	t.Run("Should sign synchronous invocations", func(t *testing.T) {
+		_, err := target.InvokeSync(context.Background(), Function{Name: "biller"}, invocation)
+		assert.NoError(t, err, "Should not fail")
+
+		request := <-requests
+		assert.Equal(t, message, request.body)
+		assert.True(t, verifies("s3cr3t", request), "Expected the signature %s to verify", request.signature)
+		assert.False(t, verifies("other", request), "Expected the signature to not verify with another secret")
+	})
+
+	t.Run("Should sign the encoded body of asynchronous invocations", func(t *testing.T) {
+		_, err := target.InvokeAsync(context.Background(), Function{Name: "biller", Encoding: EncodingJSON}, invocation)
+		assert.NoError(t, err, "Should not fail")
+
+		request := <-requests
+		assert.NotEqual(t, message, request.body, "Expected the encoded body")
+		assert.True(t, verifies("s3cr3t", request), "Expected the signature %s to verify", request.signature)
+	})
+
+	t.Run("Should not sign without secret", func(t *testing.T) {
+		unsigned := NewGatewayInvoker(CreateClient(server), nil, server.URL, "")
+
+		_, err := unsigned.InvokeSync(context.Background(), Function{Name: "biller"}, invocation)
+		assert.NoError(t, err, "Should not fail")
+		assert.Empty(t, (<-requests).signature)
+	})
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// podOrdinal extracts the ordinal of a StatefulSet pod from its hostname, e.g. 2 for connector-2
+func podOrdinal(hostname string) (int, bool) {
+	index := strings.LastIndex(hostname, "-")
+	if index < 0 {
+		return 0, false
+	}
+
+	suffix := hostname[index+1:]
+	if len(suffix) == 0 || strings.Trim(suffix, "0123456789") != "" {
+		return 0, false
+	}
+
+	ordinal, err := strconv.Atoi(suffix)
+	return ordinal, err == nil
+}
+
+// startupSplay returns the delay of the initial crawl, which is the pod ordinal times the splay. This spreads the
+// crawls of the replicas deterministically. Without an ordinal in the hostname, there is no delay.
+func startupSplay(hostname string, splay time.Duration) time.Duration {
+	if splay <= 0 {
+		return 0
+	}
+
+	ordinal, ok := podOrdinal(hostname)
+	if !ok {
+		return 0
+	}
+	return time.Duration(ordinal) * splay
+}
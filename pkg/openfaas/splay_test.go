@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPodOrdinal(t *testing.T) {
+	t.Run("Should parse the ordinal of StatefulSet pods", func(t *testing.T) {
+		for hostname, expected := range map[string]int{"connector-0": 0, "connector-2": 2, "rabbitmq-connector-12": 12} {
+			ordinal, ok := podOrdinal(hostname)
+
+			assert.True(t, ok, "Expected an ordinal for %s", hostname)
+			assert.Equal(t, expected, ordinal)
+		}
+	})
+
+	t.Run("Should not parse an ordinal from other hostnames", func(t *testing.T) {
+		for _, hostname := range []string{"connector", "connector-", "connector-7d9f8b6c5-x2k4p", "connector-+1", ""} {
+			_, ok := podOrdinal(hostname)
+
+			assert.False(t, ok, "Expected no ordinal for %s", hostname)
+		}
+	})
+}
+
+func TestStartupSplay(t *testing.T) {
+	t.Run("Should delay by the ordinal times the splay", func(t *testing.T) {
+		assert.Equal(t, time.Duration(0), startupSplay("connector-0", 5*time.Second))
+		assert.Equal(t, 10*time.Second, startupSplay("connector-2", 5*time.Second))
+	})
+
+	t.Run("Should not delay without ordinal or splay", func(t *testing.T) {
+		assert.Equal(t, time.Duration(0), startupSplay("connector-7d9f8b6c5-x2k4p", 5*time.Second))
+		assert.Equal(t, time.Duration(0), startupSplay("connector-2", 0))
+	})
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/spf13/afero"
+)
+
+// newStaticMappings converts the configured static mappings into functions. Targets containing a scheme are
+// invoked as url, all others are function refs in the form of name or name.namespace.
+func newStaticMappings(mappings map[string][]string) map[string][]Function {
+	static := make(map[string][]Function, len(mappings))
+	for topic, targets := range mappings {
+		for _, target := range targets {
+			static[topic] = append(static[topic], newStaticFunction(strings.TrimSpace(target)))
+		}
+	}
+	return static
+}
+
+func newStaticFunction(target string) Function {
+	if strings.Contains(target, "://") {
+		return Function{Name: target, URL: target, Static: true}
+	}
+
+	name, namespace, _ := strings.Cut(target, ".")
+	return Function{Name: name, Namespace: namespace, Static: true}
+}
+
+// staticMappingsFile rereads the static mappings from their file, so that changes are applied without a restart
+type staticMappingsFile struct {
+	fs       afero.Fs
+	path     string
+	mappings map[string][]string
+}
+
+// reload returns the converted mappings and true if the file changed since the last read. If the file can not be
+// read or is invalid, the previous mappings are kept.
+func (f *staticMappingsFile) reload() (map[string][]Function, bool) {
+	mappings, err := config.ReadStaticMappings(f.fs, f.path)
+	if err != nil {
+		log.Printf("Failed to reload static mappings due to %s, will keep the previous mappings", err)
+		return nil, false
+	}
+	if reflect.DeepEqual(mappings, f.mappings) {
+		return nil, false
+	}
+
+	log.Printf("Static mappings %s changed, will apply them with this refresh", f.path)
+	f.mappings = mappings
+	return newStaticMappings(mappings), true
+}
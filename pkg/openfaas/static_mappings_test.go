@@ -0,0 +1,32 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStaticMappings(t *testing.T) {
+	t.Run("Should convert function refs and urls", func(t *testing.T) {
+		mappings := newStaticMappings(map[string][]string{
+			"billing": {"biller", " invoicer.legacy ", "http://billing.internal:8080/hook"},
+		})
+
+		assert.Equal(t, []Function{
+			{Name: "biller", Static: true},
+			{Name: "invoicer", Namespace: "legacy", Static: true},
+			{Name: "http://billing.internal:8080/hook", URL: "http://billing.internal:8080/hook", Static: true},
+		}, mappings["billing"])
+	})
+
+	t.Run("Should use the url as string representation", func(t *testing.T) {
+		fn := newStaticFunction("https://billing.example.com/hook")
+
+		assert.Equal(t, "https://billing.example.com/hook", fn.String())
+	})
+}
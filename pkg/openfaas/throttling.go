@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// maxThrottledRetries of a request the gateway rate limited, afterwards a ThrottledError is returned
+	maxThrottledRetries = 3
+	// defaultRetryAfter is awaited if the gateway rate limited a request without a valid Retry-After header
+	defaultRetryAfter = time.Second
+	// maxRetryAfter caps the awaited time, requests asked to retry later are not retried
+	maxRetryAfter = time.Minute
+)
+
+// Operations of the gateway, which are used as label of the throttling metric
+const (
+	OperationCrawl  = "crawl"
+	OperationInvoke = "invoke"
+)
+
+// ThrottledError is returned once the gateway keeps rate limiting a request beyond the retry budget, or asks to
+// retry after the deadline of the request
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("gateway rate limited the request, retry after %s", e.RetryAfter)
+}
+
+// Retryable is always true, as the request may succeed once the rate limit elapsed
+func (e *ThrottledError) Retryable() bool {
+	return true
+}
+
+// awaitRetryAfter waits as requested by the Retry-After header of a rate limited request, unless the retry budget
+// is exhausted or the wait exceeds the deadline of the context
+func (g *gateway) awaitRetryAfter(ctx context.Context, base string, req *fasthttp.Request, resp *fasthttp.Response, attempt int) error {
+	operation := OperationInvoke
+	if strings.HasPrefix(strings.TrimPrefix(req.URI().String(), base), "/system/") {
+		operation = OperationCrawl
+	}
+	g.metrics.IncGatewayThrottled(operation)
+
+	wait, ok := parseRetryAfter(string(resp.Header.Peek(fasthttp.HeaderRetryAfter)), time.Now())
+	if !ok {
+		wait = defaultRetryAfter
+	}
+
+	if attempt >= maxThrottledRetries || wait > maxRetryAfter {
+		return &ThrottledError{RetryAfter: wait}
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+		return &ThrottledError{RetryAfter: wait}
+	}
+
+	log.Printf("Gateway rate limited %s, will retry after %s", req.URI().Path(), wait)
+	return g.sleep(ctx, wait)
+}
+
+// parseRetryAfter parses the Retry-After header (RFC 9110), which is either delay seconds or a http date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := fasthttp.ParseHTTPDate([]byte(value))
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
+// sleepContext waits for the duration, it returns early once the context is done
+func sleepContext(ctx context.Context, wait time.Duration) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Should parse delay seconds", func(t *testing.T) {
+		wait, ok := parseRetryAfter(" 120 ", now)
+		assert.True(t, ok)
+		assert.Equal(t, 2*time.Minute, wait)
+	})
+
+	t.Run("Should parse a http date", func(t *testing.T) {
+		wait, ok := parseRetryAfter("Tue, 01 Jun 2021 12:00:30 GMT", now)
+		assert.True(t, ok)
+		assert.Equal(t, 30*time.Second, wait)
+
+		wait, ok = parseRetryAfter("Tue, 01 Jun 2021 11:59:00 GMT", now)
+		assert.True(t, ok)
+		assert.Equal(t, time.Duration(0), wait, "Expected dates in the past to retry right away")
+	})
+
+	t.Run("Should reject invalid values", func(t *testing.T) {
+		for _, value := range []string{"", "-1", "soon"} {
+			_, ok := parseRetryAfter(value, now)
+			assert.False(t, ok, "Expected %s to be invalid", value)
+		}
+	})
+}
+
+// throttlingServer rate limits the first requests with the provided Retry-After, afterwards it responds with status
+func throttlingServer(t *testing.T, throttled int32, retryAfter string, status int, body string) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= throttled {
+			if len(retryAfter) > 0 {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func TestClient_Throttling(t *testing.T) {
+	newClient := func(server *httptest.Server) (*Client, *[]time.Duration) {
+		waits := &[]time.Duration{}
+		client := NewClient(CreateClient(server), nil, server.URL, "")
+		client.sleep = func(_ context.Context, wait time.Duration) error {
+			*waits = append(*waits, wait)
+			return nil
+		}
+		return client, waits
+	}
+
+	t.Run("Should await the Retry-After before crawling again", func(t *testing.T) {
+		server, requests := throttlingServer(t, 2, "2", http.StatusOK, `[{"name":"biller"}]`)
+		client, waits := newClient(server)
+		before := testutil.ToFloat64(metrics.GatewayThrottled.WithLabelValues(OperationCrawl))
+
+		functions, err := client.GetFunctions(context.Background(), "")
+
+		assert.NoError(t, err, "should not throw")
+		assert.Len(t, functions, 1)
+		assert.Equal(t, []time.Duration{2 * time.Second, 2 * time.Second}, *waits)
+		assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+		assert.Equal(t, before+2, testutil.ToFloat64(metrics.GatewayThrottled.WithLabelValues(OperationCrawl)))
+	})
+
+	t.Run("Should await the Retry-After before invoking again", func(t *testing.T) {
+		retryAfter := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+		server, _ := throttlingServer(t, 1, retryAfter, http.StatusAccepted, "")
+		client, waits := newClient(server)
+		before := testutil.ToFloat64(metrics.GatewayThrottled.WithLabelValues(OperationInvoke))
+
+		ok, err := client.InvokeAsync(context.Background(), Function{Name: "biller"}, &types2.OpenFaaSInvocation{})
+
+		assert.NoError(t, err, "should not throw")
+		assert.True(t, ok)
+		assert.Len(t, *waits, 1)
+		assert.InDelta(t, 10*time.Second, (*waits)[0], float64(2*time.Second))
+		assert.Equal(t, before+1, testutil.ToFloat64(metrics.GatewayThrottled.WithLabelValues(OperationInvoke)))
+	})
+
+	t.Run("Should give up once the retry budget is exhausted", func(t *testing.T) {
+		server, requests := throttlingServer(t, 10, "", http.StatusOK, "[]")
+		client, waits := newClient(server)
+
+		_, err := client.GetNamespaces(context.Background())
+
+		var throttled *ThrottledError
+		assert.True(t, errors.As(err, &throttled), "Expected a ThrottledError")
+		assert.Equal(t, ErrorKind4xx, ErrorKind(err))
+		assert.Equal(t, []time.Duration{defaultRetryAfter, defaultRetryAfter, defaultRetryAfter}, *waits)
+		assert.Equal(t, int32(maxThrottledRetries+1), atomic.LoadInt32(requests))
+	})
+
+	t.Run("Should not wait beyond the deadline of the request", func(t *testing.T) {
+		server, requests := throttlingServer(t, 1, "30", http.StatusAccepted, "")
+		client, waits := newClient(server)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err := client.InvokeAsync(ctx, Function{Name: "biller"}, &types2.OpenFaaSInvocation{})
+
+		var throttled *ThrottledError
+		assert.True(t, errors.As(err, &throttled), "Expected a ThrottledError")
+		assert.Equal(t, 30*time.Second, throttled.RetryAfter)
+		assert.Empty(t, *waits)
+		assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+	})
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+// topicAliases maps an incoming topic to the topics whose subscribers additionally receive its messages, e.g. a
+// legacy routing key to its new name
+type topicAliases map[string][]string
+
+// Expand returns the topic followed by the topics it is an alias of, including those of further aliases. Every
+// topic is returned once, which also ends cyclic aliases.
+func (a topicAliases) Expand(topic string) []string {
+	if len(a[topic]) == 0 {
+		return []string{topic}
+	}
+
+	expanded := []string{topic}
+	seen := map[string]struct{}{topic: {}}
+	for i := 0; i < len(expanded); i++ {
+		for _, target := range a[expanded[i]] {
+			if _, exists := seen[target]; exists {
+				continue
+			}
+
+			seen[target] = struct{}{}
+			expanded = append(expanded, target)
+		}
+	}
+
+	return expanded
+}
+
+// subscribers returns the functions subscribed to any of the topics, a function subscribed to several of them is
+// only returned once. Functions are ordered by the first topic they are subscribed to.
+func subscribers(cache TopicMap, topics []string) []Function {
+	if len(topics) == 1 {
+		return cache.GetCachedValues(topics[0])
+	}
+
+	var functions []Function
+	seen := map[Function]struct{}{}
+	for _, topic := range topics {
+		for _, fn := range cache.GetCachedValues(topic) {
+			if _, exists := seen[fn]; exists {
+				continue
+			}
+
+			seen[fn] = struct{}{}
+			functions = append(functions, fn)
+		}
+	}
+
+	return functions
+}
+
+// deliveryMode returns best-effort only if all of the topics are best-effort, as fail-fast wins conflicts
+func deliveryMode(cache TopicMap, topics []string) DeliveryMode {
+	for _, topic := range topics {
+		if cache.GetDeliveryMode(topic) != BestEffort {
+			return FailFast
+		}
+	}
+
+	return BestEffort
+}
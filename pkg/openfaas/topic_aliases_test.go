@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicAliases_Expand(t *testing.T) {
+	t.Run("Should return only the topic if it is no alias", func(t *testing.T) {
+		assert.Equal(t, []string{"orders"}, topicAliases(nil).Expand("orders"))
+		assert.Equal(t, []string{"orders"}, topicAliases{"v1.orders": {"orders"}}.Expand("orders"))
+	})
+
+	t.Run("Should expand an alias to its topics", func(t *testing.T) {
+		target := topicAliases{"v1.orders": {"orders", "audit"}}
+
+		assert.Equal(t, []string{"v1.orders", "orders", "audit"}, target.Expand("v1.orders"))
+	})
+
+	t.Run("Should expand aliases transitively and dedupe the topics", func(t *testing.T) {
+		target := topicAliases{"legacy": {"v1.orders", "orders"}, "v1.orders": {"orders"}}
+
+		assert.Equal(t, []string{"legacy", "v1.orders", "orders"}, target.Expand("legacy"))
+	})
+
+	t.Run("Should end cyclic aliases", func(t *testing.T) {
+		target := topicAliases{"orders": {"v1.orders"}, "v1.orders": {"orders", "v1.orders"}}
+
+		assert.Equal(t, []string{"v1.orders", "orders"}, target.Expand("v1.orders"))
+		assert.Equal(t, []string{"orders", "v1.orders"}, target.Expand("orders"))
+	})
+}
+
+func TestSubscribers(t *testing.T) {
+	cache := NewTopicFunctionCache()
+	cache.Refresh(map[string][]Function{
+		"orders":    {{Name: "shipper"}, {Name: "biller"}},
+		"v1.orders": {{Name: "biller"}, {Name: "legacy"}},
+	})
+
+	t.Run("Should return every subscribed function once", func(t *testing.T) {
+		functions := subscribers(cache, []string{"v1.orders", "orders"})
+
+		assert.Equal(t, []Function{{Name: "biller"}, {Name: "legacy"}, {Name: "shipper"}}, functions)
+	})
+
+	t.Run("Should be fail-fast unless all topics are best-effort", func(t *testing.T) {
+		cache := NewTopicFunctionCache()
+		cache.Refresh(map[string][]Function{
+			"orders":    {{Name: "shipper", DeliveryMode: BestEffort}},
+			"v1.orders": {{Name: "legacy"}},
+			"audit":     {{Name: "auditor", DeliveryMode: BestEffort}},
+		})
+
+		assert.Equal(t, FailFast, deliveryMode(cache, []string{"v1.orders", "orders"}))
+		assert.Equal(t, BestEffort, deliveryMode(cache, []string{"audit", "orders"}))
+	})
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+)
+
+// TopicHealth describes how many subscribers of a topic are able to handle its messages
+type TopicHealth struct {
+	Topic            string `json:"topic"`
+	Subscribers      int    `json:"subscribers"`
+	ReadySubscribers int    `json:"ready_subscribers"`
+	// Unhandled is true while no subscriber is ready, messages of the topic pile up meanwhile
+	Unhandled bool `json:"unhandled"`
+}
+
+// topicHealth derives the ready subscribers of every topic from the crawled replicas. A subscriber is ready if it
+// has an available replica and is neither paused nor draining. The readiness of static subscribers is unknown,
+// hence they are considered ready.
+type topicHealth struct {
+	sink metrics.Sink
+
+	lock    sync.Mutex
+	current []TopicHealth
+}
+
+func newTopicHealth(sink metrics.Sink) *topicHealth {
+	return &topicHealth{sink: sink, current: []TopicHealth{}}
+}
+
+// Update derives the health of the topic map, ready contains the crawled functions with an available replica
+func (t *topicHealth) Update(mapping map[string][]Function, ready map[string]bool) {
+	current := make([]TopicHealth, 0, len(mapping))
+	for topic, functions := range mapping {
+		health := TopicHealth{Topic: topic, Subscribers: len(functions)}
+		for _, fn := range functions {
+			if fn.Paused || fn.Draining {
+				continue
+			}
+			if fn.Static || ready[fn.String()] {
+				health.ReadySubscribers++
+			}
+		}
+		health.Unhandled = health.ReadySubscribers == 0
+
+		current = append(current, health)
+		t.sink.SetTopicReadySubscribers(topic, health.ReadySubscribers, true)
+	}
+	sort.Slice(current, func(i, j int) bool { return current[i].Topic < current[j].Topic })
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, previous := range t.current {
+		if _, exists := mapping[previous.Topic]; !exists {
+			t.sink.SetTopicReadySubscribers(previous.Topic, 0, false)
+		}
+	}
+	t.current = current
+}
+
+// Health returns the health of every topic of the last refresh, ordered by topic
+func (t *topicHealth) Health() []TopicHealth {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return append([]TopicHealth{}, t.current...)
+}
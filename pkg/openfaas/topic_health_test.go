@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type readySubscribersSink struct {
+	metrics.NoOp
+	ready map[string]int
+}
+
+func (s *readySubscribersSink) SetTopicReadySubscribers(topic string, ready int, subscribed bool) {
+	if !subscribed {
+		delete(s.ready, topic)
+		return
+	}
+	s.ready[topic] = ready
+}
+
+func TestTopicHealth(t *testing.T) {
+	sink := &readySubscribersSink{ready: map[string]int{}}
+	target := newTopicHealth(sink)
+
+	t.Run("Should count the ready subscribers of every topic", func(t *testing.T) {
+		target.Update(map[string][]Function{
+			"billing": {{Name: "biller"}, {Name: "invoicer", Namespace: "faas"}, {Name: "paused", Paused: true}},
+			"support": {{Name: "helpdesk"}, {Name: "draining", Draining: true}},
+			"legacy":  {{Name: "https://legacy.example.com", URL: "https://legacy.example.com", Static: true}},
+		}, map[string]bool{"biller": true, "invoicer.faas": true, "paused": true, "draining": true})
+
+		assert.Equal(t, []TopicHealth{
+			{Topic: "billing", Subscribers: 3, ReadySubscribers: 2},
+			{Topic: "legacy", Subscribers: 1, ReadySubscribers: 1},
+			{Topic: "support", Subscribers: 2, ReadySubscribers: 0, Unhandled: true},
+		}, target.Health())
+		assert.Equal(t, map[string]int{"billing": 2, "legacy": 1, "support": 0}, sink.ready)
+	})
+
+	t.Run("Should remove the series of topics that are gone", func(t *testing.T) {
+		target.Update(map[string][]Function{"billing": {{Name: "biller"}}}, map[string]bool{})
+
+		assert.Equal(t, []TopicHealth{{Topic: "billing", Subscribers: 1, Unhandled: true}}, target.Health())
+		assert.Equal(t, map[string]int{"billing": 0}, sink.ready)
+	})
+}
+
+func TestCacher_TopicHealth(t *testing.T) {
+	annotations := map[string]string{"topic": "billing,archive"}
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{
+		{Name: "biller", Annotations: &annotations, AvailableReplicas: 2},
+		{Name: "invoicer", Annotations: &map[string]string{"topic": "billing"}},
+		{Name: "archiver", Annotations: &map[string]string{"topic": "archive"}, AvailableReplicas: 0},
+		{Name: "scaled-down", Annotations: &map[string]string{"topic": "reports"}},
+	}, nil)
+
+	target := NewController(&config.Controller{}, clientMock, NewTopicFunctionCache())
+
+	t.Run("Should flag topics whose subscribers are all scaled to zero", func(t *testing.T) {
+		target.refreshTick(context.Background(), false)
+
+		assert.Equal(t, []TopicHealth{
+			{Topic: "archive", Subscribers: 2, ReadySubscribers: 1},
+			{Topic: "billing", Subscribers: 2, ReadySubscribers: 1},
+			{Topic: "reports", Subscribers: 1, ReadySubscribers: 0, Unhandled: true},
+		}, target.TopicHealth())
+		assert.Equal(t, 0.0, testutil.ToFloat64(metrics.TopicReadySubscribers.WithLabelValues("reports")))
+		assert.Equal(t, 1.0, testutil.ToFloat64(metrics.TopicReadySubscribers.WithLabelValues("billing")))
+	})
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+)
+
+type topicInfoKey struct {
+	function  string
+	namespace string
+	topic     string
+	source    string
+}
+
+// topicInfo exposes every topic <=> function mapping as info series. Only the difference to the previous
+// mapping is applied, so removed mappings no longer show up. It is only used by the refresh.
+type topicInfo struct {
+	sink     metrics.Sink
+	previous map[topicInfoKey]struct{}
+}
+
+func newTopicInfo(sink metrics.Sink) *topicInfo {
+	return &topicInfo{sink: sink, previous: map[topicInfoKey]struct{}{}}
+}
+
+// Update applies the provided topic map to the series
+func (t *topicInfo) Update(mapping map[string][]Function) {
+	current := make(map[topicInfoKey]struct{}, len(t.previous))
+	for topic, functions := range mapping {
+		for _, fn := range functions {
+			key := topicInfoKey{function: fn.Name, namespace: fn.Namespace, topic: topic, source: "crawled"}
+			if fn.Static {
+				key.source = "static"
+			}
+			current[key] = struct{}{}
+
+			if _, exists := t.previous[key]; !exists {
+				t.sink.SetTopicGauge(key.function, key.namespace, key.topic, key.source, true)
+			}
+		}
+	}
+
+	for key := range t.previous {
+		if _, exists := current[key]; !exists {
+			t.sink.SetTopicGauge(key.function, key.namespace, key.topic, key.source, false)
+		}
+	}
+
+	t.previous = current
+}
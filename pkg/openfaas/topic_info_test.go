@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// gaugeSink records the topic map on its own gauge, so that the series of a test are isolated
+type gaugeSink struct {
+	metrics.NoOp
+	gauge *prometheus.GaugeVec
+}
+
+func (s gaugeSink) SetTopicGauge(function string, namespace string, topic string, source string, subscribed bool) {
+	if subscribed {
+		s.gauge.WithLabelValues(function, namespace, topic, source).Set(1)
+		return
+	}
+	s.gauge.DeleteLabelValues(function, namespace, topic, source)
+}
+
+func TestTopicInfo_Update(t *testing.T) {
+	newGauge := func() *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "connector_function_topic_info", Help: "test"}, []string{"function", "namespace", "topic", "source"})
+	}
+
+	t.Run("Should expose a series per mapping", func(t *testing.T) {
+		gauge := newGauge()
+		target := newTopicInfo(gaugeSink{gauge: gauge})
+
+		target.Update(map[string][]Function{
+			"billing":   {{Name: "biller", Namespace: "faas"}, {Name: "notifier"}},
+			"transport": {{Name: "biller", Namespace: "faas"}},
+		})
+
+		assert.Equal(t, 3, testutil.CollectAndCount(gauge))
+		assert.Equal(t, 1.0, testutil.ToFloat64(gauge.WithLabelValues("biller", "faas", "transport", "crawled")))
+	})
+
+	t.Run("Should remove series of mappings that are gone", func(t *testing.T) {
+		gauge := newGauge()
+		target := newTopicInfo(gaugeSink{gauge: gauge})
+
+		target.Update(map[string][]Function{
+			"billing":   {{Name: "biller", Namespace: "faas"}, {Name: "notifier"}},
+			"transport": {{Name: "biller", Namespace: "faas"}},
+		})
+		target.Update(map[string][]Function{
+			"billing": {{Name: "biller", Namespace: "faas"}},
+			"invoice": {{Name: "invoicer", Static: true}},
+		})
+
+		expected := `
+# HELP connector_function_topic_info test
+# TYPE connector_function_topic_info gauge
+connector_function_topic_info{function="biller",namespace="faas",source="crawled",topic="billing"} 1
+connector_function_topic_info{function="invoicer",namespace="",source="static",topic="invoice"} 1
+`
+		assert.NoError(t, testutil.CollectAndCompare(gauge, strings.NewReader(expected)))
+	})
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"sort"
+)
+
+// TopicListener is notified after a refresh, if functions subscribed to new topics or no function is
+// subscribed to a topic anymore. It is called from the refresh, hence it should not block for long.
+type TopicListener interface {
+	TopicsChanged(added []string, removed []string)
+}
+
+// Subscription of a function, referenced as name.namespace, to a topic
+type Subscription struct {
+	Topic    string
+	Function string
+}
+
+// SubscriptionListener is notified after a refresh, if functions subscribed to or unsubscribed from topics. The
+// initial refresh is not reported. It is called from the refresh, hence it should not block for long.
+type SubscriptionListener interface {
+	SubscriptionsChanged(subscribed []Subscription, unsubscribed []Subscription)
+}
+
+// FunctionListener is notified after a refresh about the functions, referenced as name.namespace, that vanished from
+// the topic map, e.g. as they were deleted. As the gateway offers no watch API, removals are detected by the refresh.
+// Every removal is reported once and the initial refresh is not reported. It is called from the refresh, hence it
+// should not block for long.
+type FunctionListener interface {
+	FunctionsRemoved(removed []string)
+}
+
+// topicDiff tracks the subscribed topics between refreshes. It is only used by the refresh.
+type topicDiff struct {
+	previous map[string]struct{}
+}
+
+func newTopicDiff() *topicDiff {
+	return &topicDiff{previous: map[string]struct{}{}}
+}
+
+// Update applies the provided topic map and returns the sorted topics that were added and removed since the last update
+func (t *topicDiff) Update(mapping map[string][]Function) ([]string, []string) {
+	current := make(map[string]struct{}, len(mapping))
+	var added []string
+	for topic, functions := range mapping {
+		if len(functions) == 0 {
+			continue
+		}
+
+		current[topic] = struct{}{}
+		if _, exists := t.previous[topic]; !exists {
+			added = append(added, topic)
+		}
+	}
+
+	var removed []string
+	for topic := range t.previous {
+		if _, exists := current[topic]; !exists {
+			removed = append(removed, topic)
+		}
+	}
+
+	t.previous = current
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// functionDiff tracks the functions of the topic map between refreshes, including the ones subscribed via
+// topic-regex annotation. It is only used by the refresh.
+type functionDiff struct {
+	// known maps the functions of the last update to their namespace, it is nil until the initial update
+	known map[string]string
+}
+
+func newFunctionDiff() *functionDiff {
+	return &functionDiff{}
+}
+
+// Update applies the functions of the refresh and returns the sorted functions that were removed since the last
+// update. Functions of namespaces whose crawl failed are kept, as the refresh can not tell whether they were removed.
+func (d *functionDiff) Update(mapping map[string][]Function, patterns []topicPattern, failed map[string]bool) []string {
+	current := map[string]string{}
+	for _, functions := range mapping {
+		for _, fn := range functions {
+			current[fn.String()] = fn.Namespace
+		}
+	}
+	for _, pattern := range patterns {
+		current[pattern.function.String()] = pattern.function.Namespace
+	}
+
+	if d.known == nil {
+		d.known = current
+		return nil
+	}
+
+	var removed []string
+	for name, namespace := range d.known {
+		if _, exists := current[name]; exists {
+			continue
+		}
+		if failed[namespace] {
+			current[name] = namespace
+			continue
+		}
+		removed = append(removed, name)
+	}
+
+	d.known = current
+	sort.Strings(removed)
+	return removed
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicDiff_Update(t *testing.T) {
+	t.Run("Should report every topic as added on the first update", func(t *testing.T) {
+		target := newTopicDiff()
+
+		added, removed := target.Update(map[string][]Function{
+			"transport": {{Name: "wrencher"}},
+			"billing":   {{Name: "biller"}},
+		})
+
+		assert.Equal(t, []string{"billing", "transport"}, added)
+		assert.Empty(t, removed)
+	})
+
+	t.Run("Should report the difference to the previous update", func(t *testing.T) {
+		target := newTopicDiff()
+
+		target.Update(map[string][]Function{
+			"billing":   {{Name: "biller"}},
+			"transport": {{Name: "wrencher"}},
+		})
+		added, removed := target.Update(map[string][]Function{
+			"billing": {{Name: "biller"}, {Name: "notifier"}},
+			"invoice": {{Name: "invoicer"}},
+		})
+
+		assert.Equal(t, []string{"invoice"}, added)
+		assert.Equal(t, []string{"transport"}, removed)
+	})
+
+	t.Run("Should ignore topics without functions", func(t *testing.T) {
+		target := newTopicDiff()
+
+		added, _ := target.Update(map[string][]Function{"billing": {}})
+
+		assert.Empty(t, added)
+	})
+}
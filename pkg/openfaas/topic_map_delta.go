@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"fmt"
+	"sort"
+)
+
+// topicMapDelta summarizes the changes between two refreshes of the topic map
+type topicMapDelta struct {
+	AddedTopics      int
+	RemovedTopics    int
+	AddedFunctions   int
+	RemovedFunctions int
+	// ChangedTopics are kept between the refreshes but their subscribed functions changed, e.g. an annotation
+	ChangedTopics int
+}
+
+// IsEmpty is true if both topic maps are equal, the order of the functions of a topic does not matter
+func (d topicMapDelta) IsEmpty() bool {
+	return d == topicMapDelta{}
+}
+
+func (d topicMapDelta) String() string {
+	return fmt.Sprintf("+%d/-%d topic(s), +%d/-%d function(s), %d topic(s) with changed subscriptions",
+		d.AddedTopics, d.RemovedTopics, d.AddedFunctions, d.RemovedFunctions, d.ChangedTopics)
+}
+
+// diffTopicMaps compares the topic maps, functions are identified by their name.namespace representation
+func diffTopicMaps(previous map[string][]Function, current map[string][]Function) topicMapDelta {
+	var delta topicMapDelta
+
+	for topic, functions := range current {
+		before, exists := previous[topic]
+		switch {
+		case !exists:
+			delta.AddedTopics++
+		case !sameFunctions(before, functions):
+			delta.ChangedTopics++
+		}
+	}
+	for topic := range previous {
+		if _, exists := current[topic]; !exists {
+			delta.RemovedTopics++
+		}
+	}
+
+	before, after := functionNames(previous), functionNames(current)
+	for name := range after {
+		if _, exists := before[name]; !exists {
+			delta.AddedFunctions++
+		}
+	}
+	for name := range before {
+		if _, exists := after[name]; !exists {
+			delta.RemovedFunctions++
+		}
+	}
+
+	return delta
+}
+
+// diffSubscriptions returns the sorted subscriptions that were added and removed between the topic maps
+func diffSubscriptions(previous map[string][]Function, current map[string][]Function) ([]Subscription, []Subscription) {
+	before, after := subscriptions(previous), subscriptions(current)
+
+	var subscribed, unsubscribed []Subscription
+	for subscription := range after {
+		if _, exists := before[subscription]; !exists {
+			subscribed = append(subscribed, subscription)
+		}
+	}
+	for subscription := range before {
+		if _, exists := after[subscription]; !exists {
+			unsubscribed = append(unsubscribed, subscription)
+		}
+	}
+
+	sortSubscriptions(subscribed)
+	sortSubscriptions(unsubscribed)
+	return subscribed, unsubscribed
+}
+
+func subscriptions(mapping map[string][]Function) map[Subscription]struct{} {
+	subscriptions := map[Subscription]struct{}{}
+	for topic, functions := range mapping {
+		for _, fn := range functions {
+			subscriptions[Subscription{Topic: topic, Function: fn.String()}] = struct{}{}
+		}
+	}
+	return subscriptions
+}
+
+func sortSubscriptions(subscriptions []Subscription) {
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if subscriptions[i].Topic != subscriptions[j].Topic {
+			return subscriptions[i].Topic < subscriptions[j].Topic
+		}
+		return subscriptions[i].Function < subscriptions[j].Function
+	})
+}
+
+func sameFunctions(previous []Function, current []Function) bool {
+	if len(previous) != len(current) {
+		return false
+	}
+
+	counts := make(map[Function]int, len(previous))
+	for _, fn := range previous {
+		counts[fn]++
+	}
+	for _, fn := range current {
+		if counts[fn] == 0 {
+			return false
+		}
+		counts[fn]--
+	}
+	return true
+}
+
+func functionNames(mapping map[string][]Function) map[string]struct{} {
+	names := map[string]struct{}{}
+	for _, functions := range mapping {
+		for _, fn := range functions {
+			names[fn.String()] = struct{}{}
+		}
+	}
+	return names
+}
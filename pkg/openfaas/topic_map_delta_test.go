@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffTopicMaps(t *testing.T) {
+	previous := map[string][]Function{
+		"billing":   {{Name: "biller"}, {Name: "invoicer", Namespace: "faas"}},
+		"transport": {{Name: "wrencher"}},
+	}
+
+	t.Run("Should be empty for equal topic maps regardless of the function order", func(t *testing.T) {
+		delta := diffTopicMaps(previous, map[string][]Function{
+			"billing":   {{Name: "invoicer", Namespace: "faas"}, {Name: "biller"}},
+			"transport": {{Name: "wrencher"}},
+		})
+
+		assert.True(t, delta.IsEmpty(), "Expected no changes but got %s", delta)
+	})
+
+	t.Run("Should count added and removed topics and functions", func(t *testing.T) {
+		delta := diffTopicMaps(previous, map[string][]Function{
+			"billing": {{Name: "biller"}, {Name: "invoicer", Namespace: "faas"}},
+			"invoice": {{Name: "invoicer", Namespace: "faas"}},
+			"secret":  {{Name: "vault"}},
+		})
+
+		assert.Equal(t, topicMapDelta{AddedTopics: 2, RemovedTopics: 1, AddedFunctions: 1, RemovedFunctions: 1}, delta)
+		assert.Equal(t, "+2/-1 topic(s), +1/-1 function(s), 0 topic(s) with changed subscriptions", delta.String())
+	})
+
+	t.Run("Should count topics whose functions changed", func(t *testing.T) {
+		delta := diffTopicMaps(previous, map[string][]Function{
+			"billing":   {{Name: "biller", Timeout: time.Second}, {Name: "invoicer", Namespace: "faas"}},
+			"transport": {{Name: "wrencher"}},
+		})
+
+		assert.Equal(t, topicMapDelta{ChangedTopics: 1}, delta)
+	})
+
+	t.Run("Should count everything as added on the first refresh", func(t *testing.T) {
+		assert.Equal(t, topicMapDelta{AddedTopics: 2, AddedFunctions: 3}, diffTopicMaps(nil, previous))
+	})
+}
+
+func TestDiffSubscriptions(t *testing.T) {
+	t.Run("Should return sorted subscriptions that were added and removed", func(t *testing.T) {
+		subscribed, unsubscribed := diffSubscriptions(map[string][]Function{
+			"billing":   {{Name: "biller"}},
+			"transport": {{Name: "wrencher"}},
+		}, map[string][]Function{
+			"billing":   {{Name: "invoicer", Namespace: "faas"}, {Name: "biller"}},
+			"invoice":   {{Name: "biller"}},
+			"transport": {{Name: "wrencher"}},
+		})
+
+		assert.Equal(t, []Subscription{{Topic: "billing", Function: "invoicer.faas"}, {Topic: "invoice", Function: "biller"}}, subscribed)
+		assert.Empty(t, unsubscribed)
+	})
+
+	t.Run("Should return removed subscriptions of kept and removed topics", func(t *testing.T) {
+		subscribed, unsubscribed := diffSubscriptions(map[string][]Function{
+			"billing":   {{Name: "biller"}, {Name: "invoicer"}},
+			"transport": {{Name: "wrencher"}},
+		}, map[string][]Function{
+			"billing": {{Name: "biller"}},
+		})
+
+		assert.Empty(t, subscribed)
+		assert.Equal(t, []Subscription{{Topic: "billing", Function: "invoicer"}, {Topic: "transport", Function: "wrencher"}}, unsubscribed)
+	})
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// WriteDOT renders the topic map as Graphviz DOT graph, with topics as boxes, functions as ellipses and an edge for
+// every subscription. Static functions are dashed. Nodes and edges are sorted, so that equal maps render equally.
+func WriteDOT(w io.Writer, mapping map[string][]Function) error {
+	topics := make([]string, 0, len(mapping))
+	functions := map[string]Function{}
+	for topic, subscribed := range mapping {
+		topics = append(topics, topic)
+		for _, fn := range subscribed {
+			functions[fn.String()] = fn
+		}
+	}
+	sort.Strings(topics)
+
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "digraph topics {")
+	fmt.Fprintln(out, "  rankdir=LR;")
+
+	for _, topic := range topics {
+		fmt.Fprintf(out, "  %s [label=%s, shape=box];\n", topicNode(topic), strconv.Quote(topic))
+	}
+	for _, name := range names {
+		style := ""
+		if functions[name].Static {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(out, "  %s [label=%s, shape=ellipse%s];\n", functionNode(name), strconv.Quote(name), style)
+	}
+
+	for _, topic := range topics {
+		subscribed := make([]string, 0, len(mapping[topic]))
+		for _, fn := range mapping[topic] {
+			subscribed = append(subscribed, fn.String())
+		}
+		sort.Strings(subscribed)
+
+		for _, name := range subscribed {
+			fmt.Fprintf(out, "  %s -> %s;\n", topicNode(topic), functionNode(name))
+		}
+	}
+
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+// topicNode and functionNode are prefixed, as a topic may be named like a function
+func topicNode(topic string) string {
+	return strconv.Quote("topic:" + topic)
+}
+
+func functionNode(name string) string {
+	return strconv.Quote("function:" + name)
+}
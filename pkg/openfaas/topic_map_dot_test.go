@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDOT(t *testing.T) {
+	t.Run("Should render topics, functions and their subscriptions", func(t *testing.T) {
+		var out bytes.Buffer
+		err := WriteDOT(&out, map[string][]Function{
+			"billing": {{Name: "invoicer", Namespace: "finance"}, {Name: "biller"}},
+			"archive": {{Name: "biller"}, {Name: "https://archive.example.com/hook", URL: "https://archive.example.com/hook", Static: true}},
+		})
+
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, `digraph topics {
+  rankdir=LR;
+  "topic:archive" [label="archive", shape=box];
+  "topic:billing" [label="billing", shape=box];
+  "function:biller" [label="biller", shape=ellipse];
+  "function:https://archive.example.com/hook" [label="https://archive.example.com/hook", shape=ellipse, style=dashed];
+  "function:invoicer.finance" [label="invoicer.finance", shape=ellipse];
+  "topic:archive" -> "function:biller";
+  "topic:archive" -> "function:https://archive.example.com/hook";
+  "topic:billing" -> "function:biller";
+  "topic:billing" -> "function:invoicer.finance";
+}
+`, out.String())
+	})
+
+	t.Run("Should escape quotes within names", func(t *testing.T) {
+		var out bytes.Buffer
+		err := WriteDOT(&out, map[string][]Function{`say "hi"`: {{Name: "greeter"}}})
+
+		assert.NoError(t, err, "should not throw")
+		assert.Contains(t, out.String(), `"topic:say \"hi\"" [label="say \"hi\"", shape=box];`)
+	})
+
+	t.Run("Should render an empty graph without topics", func(t *testing.T) {
+		var out bytes.Buffer
+		err := WriteDOT(&out, map[string][]Function{})
+
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, "digraph topics {\n  rankdir=LR;\n}\n", out.String())
+	})
+}
+
+func TestCacher_TopicMap(t *testing.T) {
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{
+		{Name: "biller", Annotations: &map[string]string{"topic": "billing"}},
+	}, nil)
+
+	target := NewController(&config.Controller{}, clientMock, NewTopicFunctionCache())
+
+	t.Run("Should be empty before the first refresh", func(t *testing.T) {
+		assert.Empty(t, target.TopicMap())
+	})
+
+	t.Run("Should return the topic map of the last refresh", func(t *testing.T) {
+		expected, err := target.refreshTick(context.Background(), false)
+
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, expected, target.TopicMap())
+		assert.Len(t, target.TopicMap()["billing"], 1)
+	})
+}
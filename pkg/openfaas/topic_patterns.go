@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/openfaas/faas-provider/types"
+)
+
+// TopicRegexAnnotation subscribes a function to every topic fully matching the regular expression, e.g. order\..*
+const TopicRegexAnnotation = "topic-regex"
+
+// topicPattern subscribes a function to the topics matching the expression
+type topicPattern struct {
+	expr     *regexp.Regexp
+	function Function
+}
+
+// topicPatterns holds the pattern subscriptions of the last refresh, which are matched against the topic of every
+// invocation. As annotations rarely change between crawls, the compiled expressions are memorized per annotation
+// value, invalid ones are memorized as nil.
+type topicPatterns struct {
+	// allowed restricts the matched topics like the allowed topics of the topic map. nil allows all topics.
+	allowed map[string]struct{}
+
+	compileLock sync.Mutex
+	current     map[string]*regexp.Regexp
+	previous    map[string]*regexp.Regexp
+
+	lock     sync.RWMutex
+	patterns []topicPattern
+}
+
+func newTopicPatterns(allowed []string) *topicPatterns {
+	p := &topicPatterns{current: map[string]*regexp.Regexp{}}
+	if len(allowed) > 0 {
+		p.allowed = make(map[string]struct{}, len(allowed))
+		for _, topic := range allowed {
+			p.allowed[strings.TrimSpace(topic)] = struct{}{}
+		}
+	}
+	return p
+}
+
+// Refresh starts a new crawl, only expressions seen during the previous crawl are kept memorized
+func (p *topicPatterns) Refresh() {
+	p.compileLock.Lock()
+	defer p.compileLock.Unlock()
+
+	p.previous = p.current
+	p.current = make(map[string]*regexp.Regexp, len(p.previous))
+}
+
+// Compile returns the expression annotated on the function, nil if it is absent or invalid
+func (p *topicPatterns) Compile(fn types.FunctionStatus) *regexp.Regexp {
+	if fn.Annotations == nil {
+		return nil
+	}
+
+	value, exist := (*fn.Annotations)[TopicRegexAnnotation]
+	if !exist || len(strings.TrimSpace(value)) == 0 {
+		return nil
+	}
+
+	p.compileLock.Lock()
+	defer p.compileLock.Unlock()
+
+	expr, known := p.current[value]
+	if !known {
+		if expr, known = p.previous[value]; !known {
+			var err error
+			if expr, err = regexp.Compile("^(?:" + strings.TrimSpace(value) + ")$"); err != nil {
+				expr = nil
+			}
+		}
+		p.current[value] = expr
+	}
+
+	if expr == nil {
+		log.Printf("Function %s has the invalid %s annotation %s, will skip it", fn.Name, TopicRegexAnnotation, value)
+	}
+	return expr
+}
+
+// Update replaces the pattern subscriptions with the ones of the last crawl
+func (p *topicPatterns) Update(patterns []topicPattern) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.patterns = patterns
+}
+
+// Len returns the number of pattern subscriptions
+func (p *topicPatterns) Len() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return len(p.patterns)
+}
+
+// Match returns the functions whose expression matches the topic, excluding paused functions
+func (p *topicPatterns) Match(topic string) []Function {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if len(p.patterns) == 0 {
+		return nil
+	}
+	if p.allowed != nil {
+		if _, allowed := p.allowed[topic]; !allowed {
+			return nil
+		}
+	}
+
+	var functions []Function
+	for _, pattern := range p.patterns {
+		if !pattern.function.Paused && pattern.expr.MatchString(topic) {
+			functions = append(functions, pattern.function)
+		}
+	}
+	return functions
+}
+
+// withPatternSubscribers appends the matched functions that are not subscribed to the topic already. The subscribers
+// are shared with the topic map, hence a new slice is returned.
+func withPatternSubscribers(subscribed []Function, matched []Function) []Function {
+	if len(matched) == 0 {
+		return subscribed
+	}
+
+	functions := make([]Function, 0, len(subscribed)+len(matched))
+	seen := make(map[Function]struct{}, len(subscribed))
+	for _, fn := range subscribed {
+		seen[fn] = struct{}{}
+		functions = append(functions, fn)
+	}
+	for _, fn := range matched {
+		if _, exists := seen[fn]; !exists {
+			seen[fn] = struct{}{}
+			functions = append(functions, fn)
+		}
+	}
+	return functions
+}
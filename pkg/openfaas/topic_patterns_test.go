@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestTopicPatterns_Compile(t *testing.T) {
+	t.Run("Should memorize the compiled expressions across crawls", func(t *testing.T) {
+		annotations := map[string]string{TopicRegexAnnotation: `order\..*`}
+		target := newTopicPatterns(nil)
+
+		first := target.Compile(types.FunctionStatus{Name: "orders", Annotations: &annotations})
+		target.Refresh()
+		second := target.Compile(types.FunctionStatus{Name: "orders", Annotations: &annotations})
+
+		assert.NotNil(t, first)
+		assert.Same(t, first, second, "Expected the expression to be compiled once")
+	})
+
+	t.Run("Should skip absent and invalid expressions", func(t *testing.T) {
+		invalid := map[string]string{TopicRegexAnnotation: `order\.(`}
+		target := newTopicPatterns(nil)
+
+		assert.Nil(t, target.Compile(types.FunctionStatus{Name: "orders"}))
+		assert.Nil(t, target.Compile(types.FunctionStatus{Name: "orders", Annotations: &invalid}))
+	})
+}
+
+func TestCacher_TopicPatterns(t *testing.T) {
+	orders := map[string]string{TopicRegexAnnotation: `order\..*`}
+	invalid := map[string]string{TopicRegexAnnotation: `order\.(`}
+	billing := map[string]string{"topic": "order.created", TopicRegexAnnotation: `order\.created|order\.paid`}
+
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{
+		{Name: "orders", Annotations: &orders},
+		{Name: "broken", Annotations: &invalid},
+		{Name: "biller", Annotations: &billing},
+	}, nil)
+	clientMock.On("InvokeAsync", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+	target := NewController(&config.Controller{}, clientMock, NewTopicFunctionCache())
+	target.refreshTick(context.Background(), false)
+
+	t.Run("Should invoke the functions whose expression matches", func(t *testing.T) {
+		results, err := target.Invoke("order.created", &types2.OpenFaaSInvocation{Topic: "order.created"})
+		assert.NoError(t, err, "should not throw")
+
+		invoked := []string{}
+		for _, result := range results {
+			invoked = append(invoked, result.Function)
+		}
+		assert.Equal(t, []string{"biller", "orders"}, invoked, "Expected biller to be invoked once, although it matches twice")
+	})
+
+	t.Run("Should not invoke functions whose expression does not match", func(t *testing.T) {
+		results, err := target.Invoke("invoice.created", &types2.OpenFaaSInvocation{Topic: "invoice.created"})
+		assert.NoError(t, err, "should not throw")
+		assert.Empty(t, results)
+
+		results, err = target.Invoke("my.order.created", &types2.OpenFaaSInvocation{Topic: "my.order.created"})
+		assert.NoError(t, err, "should not throw")
+		assert.Empty(t, results, "Expected the expression to match the whole topic")
+	})
+
+	t.Run("Should skip functions with an invalid expression", func(t *testing.T) {
+		assert.Equal(t, 2, target.patterns.Len())
+		clientMock.AssertNotCalled(t, "InvokeAsync", mock.Anything, Function{Name: "broken"}, mock.Anything)
+	})
+}
+
+func BenchmarkTopicPatterns_Match(b *testing.B) {
+	target := newTopicPatterns(nil)
+	patterns := make([]topicPattern, 0, 100)
+	for i := 0; i < 100; i++ {
+		annotations := map[string]string{TopicRegexAnnotation: fmt.Sprintf(`order%d\..*`, i)}
+		fn := types.FunctionStatus{Name: fmt.Sprintf("fn%d", i), Annotations: &annotations}
+		patterns = append(patterns, topicPattern{expr: target.Compile(fn), function: Function{Name: fn.Name}})
+	}
+	target.Update(patterns)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		target.Match("order50.created")
+	}
+}
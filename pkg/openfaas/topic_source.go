@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/openfaas/faas-provider/types"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+// TopicSource provides the topics a function subscribes to. Topics may be called concurrently while crawling.
+type TopicSource interface {
+	// Refresh is called once per crawl, before the topics of the found functions are requested
+	Refresh()
+	Topics(fn types.FunctionStatus, namespace string) []string
+}
+
+// TopicAnnotations are the annotations read by default, the bare key of older tooling and the prefixed key of newer one
+var TopicAnnotations = []string{"topic", "com.openfaas.topic"}
+
+// AnnotationTopicSource reads the topics from the comma separated topic annotations of a function. If multiple of
+// the annotations are present, their topics are merged. As annotations rarely change between crawls, the split
+// topics are memorized per annotation value.
+type AnnotationTopicSource struct {
+	// Keys of the annotations that are checked in order, if empty TopicAnnotations are used
+	Keys []string
+
+	lock     sync.Mutex
+	current  map[string][]string
+	previous map[string][]string
+}
+
+// Refresh starts a new crawl, only annotation values seen during the previous crawl are kept memorized
+func (a *AnnotationTopicSource) Refresh() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.previous = a.current
+	a.current = make(map[string][]string, len(a.previous))
+}
+
+// SetKeys replaces the keys of the annotations, it is safe to call while crawling. Empty keys use TopicAnnotations.
+func (a *AnnotationTopicSource) SetKeys(keys []string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.Keys = keys
+}
+
+// Topics returns the merged topics of the topic annotations
+func (a *AnnotationTopicSource) Topics(fn types.FunctionStatus, _ string) []string {
+	if fn.Annotations == nil {
+		return nil
+	}
+
+	a.lock.Lock()
+	keys := a.Keys
+	a.lock.Unlock()
+	if len(keys) == 0 {
+		keys = TopicAnnotations
+	}
+
+	var values []string
+	for _, key := range keys {
+		if value, exist := (*fn.Annotations)[key]; exist {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	topicNames := strings.Join(values, ",")
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if topics, ok := a.current[topicNames]; ok {
+		return topics
+	}
+
+	topics, ok := a.previous[topicNames]
+	if !ok {
+		topics = strings.Split(topicNames, ",")
+		if len(values) > 1 {
+			topics = withoutDuplicates(topics)
+		}
+	}
+
+	if a.current == nil {
+		a.current = map[string][]string{}
+	}
+	a.current[topicNames] = topics
+	return topics
+}
+
+func withoutDuplicates(topics []string) []string {
+	seen := make(map[string]struct{}, len(topics))
+	unique := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		if _, exists := seen[topic]; !exists {
+			seen[topic] = struct{}{}
+			unique = append(unique, topic)
+		}
+	}
+	return unique
+}
+
+// EnvTopicSource reads the topics from the comma separated value of an environment variable of a function, for
+// functions that can not be annotated. Functions are only subscribed if the gateway exposes their environment.
+type EnvTopicSource struct {
+	// Key of the environment variable holding the topics
+	Key string
+}
+
+// NewEnvTopicSource returns a source reading the topics from the environment variable of the provided key
+func NewEnvTopicSource(key string) *EnvTopicSource {
+	return &EnvTopicSource{Key: key}
+}
+
+// Refresh does nothing, as the environment is part of the crawled function
+func (e *EnvTopicSource) Refresh() {}
+
+// Topics returns the topics of the environment variable, ignoring blank entries
+func (e *EnvTopicSource) Topics(fn types.FunctionStatus, _ string) []string {
+	value, exist := fn.EnvVars[e.Key]
+	if !exist {
+		return nil
+	}
+
+	var topics []string
+	for _, topic := range strings.Split(value, ",") {
+		if topic = strings.TrimSpace(topic); len(topic) > 0 {
+			topics = append(topics, topic)
+		}
+	}
+	return withoutDuplicates(topics)
+}
+
+// FileTopicSource reads the topics from a yaml file, for example mounted from a Kubernetes ConfigMap,
+// that maps either name.namespace or name of a function to a list of topics
+type FileTopicSource struct {
+	fs      afero.Fs
+	path    string
+	mapping map[string][]string
+}
+
+// NewFileTopicSource returns a source reading the mapping from the provided path
+func NewFileTopicSource(fs afero.Fs, path string) *FileTopicSource {
+	return &FileTopicSource{
+		fs:      fs,
+		path:    path,
+		mapping: map[string][]string{},
+	}
+}
+
+// Refresh rereads the mapping, so that changes to the file are picked up. If reading fails the previous mapping is kept.
+func (f *FileTopicSource) Refresh() {
+	content, err := afero.ReadFile(f.fs, f.path)
+	if err != nil {
+		log.Printf("Received %s while reading topic mapping %s, will keep the previous mapping", err, f.path)
+		return
+	}
+
+	mapping := map[string][]string{}
+	if err := yaml.Unmarshal(content, &mapping); err != nil {
+		log.Printf("Received %s while parsing topic mapping %s, will keep the previous mapping", err, f.path)
+		return
+	}
+
+	f.mapping = mapping
+}
+
+// Topics returns the mapped topics, preferring an entry for name.namespace over one for the plain name
+func (f *FileTopicSource) Topics(fn types.FunctionStatus, namespace string) []string {
+	if len(namespace) > 0 {
+		if topics, exist := f.mapping[fn.Name+"."+namespace]; exist {
+			return topics
+		}
+	}
+
+	return f.mapping[fn.Name]
+}
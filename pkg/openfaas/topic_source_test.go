@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnotationTopicSource_Topics(t *testing.T) {
+	source := &AnnotationTopicSource{}
+
+	t.Run("Should split the topic annotation", func(t *testing.T) {
+		fn := types.FunctionStatus{Name: "biller", Annotations: &map[string]string{"topic": "billing,invoice"}}
+		assert.Equal(t, []string{"billing", "invoice"}, source.Topics(fn, ""))
+	})
+
+	t.Run("Should return no topics if annotation is absent", func(t *testing.T) {
+		assert.Empty(t, source.Topics(types.FunctionStatus{Name: "biller"}, ""))
+		assert.Empty(t, source.Topics(types.FunctionStatus{Name: "biller", Annotations: &map[string]string{"com.openfaas.topic.timeout": "5s"}}, ""))
+	})
+
+	t.Run("Should split the prefixed topic annotation", func(t *testing.T) {
+		fn := types.FunctionStatus{Name: "biller", Annotations: &map[string]string{"com.openfaas.topic": "billing,invoice"}}
+		assert.Equal(t, []string{"billing", "invoice"}, source.Topics(fn, ""))
+	})
+
+	t.Run("Should merge the topics of both annotations", func(t *testing.T) {
+		fn := types.FunctionStatus{Name: "biller", Annotations: &map[string]string{"topic": "billing,invoice", "com.openfaas.topic": "invoice,transport"}}
+		assert.Equal(t, []string{"billing", "invoice", "transport"}, source.Topics(fn, ""))
+
+		source.Refresh()
+		assert.Equal(t, []string{"billing", "invoice", "transport"}, source.Topics(fn, ""), "Expected the memorized topics")
+	})
+
+	t.Run("Should only read the configured keys", func(t *testing.T) {
+		custom := &AnnotationTopicSource{Keys: []string{"example.com/topics"}}
+		fn := types.FunctionStatus{Name: "biller", Annotations: &map[string]string{"topic": "billing", "example.com/topics": "transport"}}
+		assert.Equal(t, []string{"transport"}, custom.Topics(fn, ""))
+	})
+}
+
+func TestFileTopicSource(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	_ = afero.WriteFile(fs, "topics.yaml", []byte(`
+biller: [billing]
+biller.special: [special-billing, invoice]
+`), 0644)
+
+	source := NewFileTopicSource(fs, "topics.yaml")
+
+	t.Run("Should return no topics before a refresh", func(t *testing.T) {
+		assert.Empty(t, source.Topics(types.FunctionStatus{Name: "biller"}, ""))
+	})
+
+	t.Run("Should prefer name.namespace over name", func(t *testing.T) {
+		source.Refresh()
+
+		assert.Equal(t, []string{"special-billing", "invoice"}, source.Topics(types.FunctionStatus{Name: "biller"}, "special"))
+		assert.Equal(t, []string{"billing"}, source.Topics(types.FunctionStatus{Name: "biller"}, "faas"))
+		assert.Equal(t, []string{"billing"}, source.Topics(types.FunctionStatus{Name: "biller"}, ""))
+		assert.Empty(t, source.Topics(types.FunctionStatus{Name: "unknown"}, ""))
+	})
+
+	t.Run("Should pick up changes on the next refresh", func(t *testing.T) {
+		_ = afero.WriteFile(fs, "topics.yaml", []byte(`biller: [accounting]`), 0644)
+		source.Refresh()
+
+		assert.Equal(t, []string{"accounting"}, source.Topics(types.FunctionStatus{Name: "biller"}, ""))
+	})
+
+	t.Run("Should keep the previous mapping if the file is invalid", func(t *testing.T) {
+		_ = afero.WriteFile(fs, "topics.yaml", []byte(`biller: {`), 0644)
+		source.Refresh()
+
+		assert.Equal(t, []string{"accounting"}, source.Topics(types.FunctionStatus{Name: "biller"}, ""))
+	})
+
+	t.Run("Should keep the previous mapping if the file is missing", func(t *testing.T) {
+		_ = fs.Remove("topics.yaml")
+		source.Refresh()
+
+		assert.Equal(t, []string{"accounting"}, source.Topics(types.FunctionStatus{Name: "biller"}, ""))
+	})
+}
+
+func TestEnvTopicSource(t *testing.T) {
+	source := NewEnvTopicSource("CONNECTOR_TOPICS")
+
+	t.Run("Should split the topics of the environment variable", func(t *testing.T) {
+		fn := types.FunctionStatus{Name: "biller", EnvVars: map[string]string{"CONNECTOR_TOPICS": "billing, invoice,,billing"}}
+		assert.Equal(t, []string{"billing", "invoice"}, source.Topics(fn, ""))
+	})
+
+	t.Run("Should return no topics if the environment variable is absent", func(t *testing.T) {
+		assert.Empty(t, source.Topics(types.FunctionStatus{Name: "biller"}, ""))
+		assert.Empty(t, source.Topics(types.FunctionStatus{Name: "biller", EnvVars: map[string]string{"fprocess": "./handler"}}, ""))
+	})
+
+	t.Run("Should merge the topics with the annotation derived ones", func(t *testing.T) {
+		envOnly := types.FunctionStatus{Name: "env-biller", EnvVars: map[string]string{"CONNECTOR_TOPICS": "billing"}}
+		annotationOnly := types.FunctionStatus{Name: "annotated-biller", Annotations: &map[string]string{"topic": "billing"}}
+		both := types.FunctionStatus{Name: "invoicer", Annotations: &map[string]string{"topic": "billing,invoice"}, EnvVars: map[string]string{"CONNECTOR_TOPICS": "invoice,transport"}}
+		neither := types.FunctionStatus{Name: "notifier", EnvVars: map[string]string{"OTHER_TOPICS": "billing"}}
+
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{envOnly, annotationOnly, both, neither}, nil)
+
+		cache := NewTopicFunctionCache()
+		NewController(&config.Controller{}, clientMock, cache).WithTopicSources(source).refreshTick(context.Background(), false)
+
+		assert.ElementsMatch(t, []Function{{Name: "env-biller"}, {Name: "annotated-biller"}, {Name: "invoicer"}}, cache.GetCachedValues("billing"))
+		assert.ElementsMatch(t, []Function{{Name: "invoicer"}}, cache.GetCachedValues("invoice"))
+		assert.ElementsMatch(t, []Function{{Name: "invoicer"}}, cache.GetCachedValues("transport"))
+	})
+}
@@ -0,0 +1,26 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Transport sends the requests of the client to the gateway, it is satisfied by *fasthttp.Client. Wrapping the
+// default transport allows to instrument, record or proxy the requests without touching the client.
+type Transport interface {
+	Do(req *fasthttp.Request, resp *fasthttp.Response) error
+	DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error
+}
+
+// WithTransport sends the requests of the crawler and the invoker via the transport instead of the fasthttp client
+// passed to NewClient. Retries, failover and rate limiting are still handled by the client on top of it.
+func (c *Client) WithTransport(transport Transport) *Client {
+	c.client = transport
+	return c
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+type recordedExchange struct {
+	method   string
+	path     string
+	status   int
+	response []byte
+}
+
+// recordingTransport records every exchange with the gateway, if next is absent it replays the recorded responses
+type recordingTransport struct {
+	next Transport
+
+	lock      sync.Mutex
+	exchanges []recordedExchange
+}
+
+func (r *recordingTransport) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	return r.record(req, resp, func() error { return r.next.Do(req, resp) })
+}
+
+func (r *recordingTransport) DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
+	return r.record(req, resp, func() error { return r.next.DoDeadline(req, resp, deadline) })
+}
+
+func (r *recordingTransport) record(req *fasthttp.Request, resp *fasthttp.Response, send func() error) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	method, path := string(req.Header.Method()), string(req.URI().Path())
+	if r.next == nil {
+		for _, exchange := range r.exchanges {
+			if exchange.method == method && exchange.path == path {
+				resp.SetStatusCode(exchange.status)
+				resp.SetBody(exchange.response)
+				return nil
+			}
+		}
+		return fmt.Errorf("no recorded exchange for %s %s", method, path)
+	}
+
+	err := send()
+	if err == nil {
+		r.exchanges = append(r.exchanges, recordedExchange{method: method, path: path, status: resp.StatusCode(), response: append([]byte(nil), resp.Body()...)})
+	}
+	return err
+}
+
+func TestClient_WithTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/system/functions":
+			fmt.Fprint(w, `[{"name": "biller", "annotations": {"topic": "billing"}}]`)
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	recorder := &recordingTransport{next: CreateClient(server)}
+	message := []byte("Hello World")
+
+	t.Run("Should send the requests of crawler and invoker via the transport", func(t *testing.T) {
+		client := NewClient(CreateClient(server), nil, server.URL, "").WithTransport(recorder)
+
+		functions, err := client.GetFunctions(context.Background(), "")
+		assert.NoError(t, err, "should not throw")
+		assert.Len(t, functions, 1)
+
+		_, err = client.InvokeAsync(context.Background(), Function{Name: "biller"}, &types2.OpenFaaSInvocation{Topic: "billing", Message: &message})
+		assert.NoError(t, err, "should not throw")
+
+		assert.Equal(t, []recordedExchange{
+			{method: "GET", path: "/system/functions", status: http.StatusOK, response: []byte(`[{"name": "biller", "annotations": {"topic": "billing"}}]`)},
+			{method: "POST", path: "/async-function/biller", status: http.StatusAccepted},
+		}, recorder.exchanges)
+	})
+
+	t.Run("Should replay the recorded exchanges without gateway", func(t *testing.T) {
+		server.Close()
+		client := NewClient(CreateClient(server), nil, server.URL, "").WithTransport(&recordingTransport{exchanges: recorder.exchanges})
+
+		functions, err := client.GetFunctions(context.Background(), "")
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, "biller", functions[0].Name)
+
+		_, err = client.InvokeAsync(context.Background(), Function{Name: "biller"}, &types2.OpenFaaSInvocation{Topic: "billing", Message: &message})
+		assert.NoError(t, err, "should not throw")
+
+		_, err = client.InvokeAsync(context.Background(), Function{Name: "shipper"}, &types2.OpenFaaSInvocation{Topic: "billing", Message: &message})
+		assert.Error(t, err, "Expected unrecorded requests to fail")
+	})
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/logging"
+	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/openfaas/faas-provider/types"
+)
+
+// WarmupAnnotation sets the interval in which a function is warmed up, e.g. 30s, if warmups are enabled
+const WarmupAnnotation = "warmup"
+
+// WarmupHeader is true on warmup invocations, which carry no message and should be answered without doing any work
+const WarmupHeader = "X-Warmup"
+
+// warmupResolution is the interval in which the functions are checked for being due for a warmup
+const warmupResolution = time.Second
+
+// warmups remembers when every function was warmed up last
+type warmups struct {
+	lock sync.Mutex
+	last map[string]time.Time
+}
+
+func newWarmups() *warmups {
+	return &warmups{last: map[string]time.Time{}}
+}
+
+// due returns the functions whose warmup interval elapsed, they are considered warmed up from now on. Functions that
+// are gone from the provided ones are forgotten.
+func (w *warmups) due(functions map[string]Function, now time.Time) []Function {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for name := range w.last {
+		if _, exists := functions[name]; !exists {
+			delete(w.last, name)
+		}
+	}
+
+	var due []Function
+	for name, fn := range functions {
+		if last, warmed := w.last[name]; warmed && now.Sub(last) < fn.Warmup {
+			continue
+		}
+		w.last[name] = now
+		due = append(due, fn)
+	}
+	return due
+}
+
+// warmup sends the warmups on every tick until the context is done
+func (c *Controller) warmup(ctx context.Context, ticker *time.Ticker) {
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			c.warmupTick(ctx, now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// warmupTick invokes the functions of the topic map, whose warmup interval elapsed, concurrently and waits for them.
+// Warmups bypass Invoke, hence they are neither counted as invocations nor affect the auto-pause of a function.
+func (c *Controller) warmupTick(ctx context.Context, now time.Time) {
+	functions := map[string]Function{}
+	for _, subscribed := range c.TopicMap() {
+		for _, fn := range subscribed {
+			// Endpoints outside of OpenFaaS are not scaled by it
+			if fn.Warmup <= 0 || fn.Paused || fn.Draining || len(fn.URL) > 0 {
+				continue
+			}
+			functions[fn.String()] = fn
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, fn := range c.warmups.due(functions, now) {
+		wg.Add(1)
+		go func(fn Function) {
+			defer wg.Done()
+			c.sendWarmup(ctx, fn)
+		}(fn)
+	}
+	wg.Wait()
+}
+
+// sendWarmup invokes the function synchronously without message, so that a replica is scaled up and serves it
+func (c *Controller) sendWarmup(ctx context.Context, fn Function) {
+	ctx, cancel := context.WithTimeout(ctx, c.invokeTimeout(fn))
+	defer cancel()
+
+	if _, err := c.invoker.InvokeSync(ctx, fn, &types2.OpenFaaSInvocation{Warmup: true}); err != nil {
+		log.Printf("Failed to warm up function %s due to %s", fn, err)
+		return
+	}
+	logging.Debugf("Warmed up function %s", fn)
+}
+
+// extractWarmupFromAnnotations reads the warmup interval of a function, returning zero if it is absent or invalid
+func extractWarmupFromAnnotations(fn types.FunctionStatus) time.Duration {
+	if fn.Annotations == nil {
+		return 0
+	}
+
+	value, exist := (*fn.Annotations)[WarmupAnnotation]
+	if !exist {
+		return 0
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		log.Printf("Function %s has the invalid %s annotation %s, will not warm it up", fn.Name, WarmupAnnotation, value)
+		return 0
+	}
+	return interval
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractWarmupFromAnnotations(t *testing.T) {
+	t.Run("Should read the warmup interval", func(t *testing.T) {
+		assert.Equal(t, 30*time.Second, extractWarmupFromAnnotations(types.FunctionStatus{Annotations: &map[string]string{"warmup": "30s"}}))
+	})
+
+	t.Run("Should ignore absent and invalid intervals", func(t *testing.T) {
+		assert.Zero(t, extractWarmupFromAnnotations(types.FunctionStatus{}))
+		assert.Zero(t, extractWarmupFromAnnotations(types.FunctionStatus{Annotations: &map[string]string{"warmup": "often"}}))
+		assert.Zero(t, extractWarmupFromAnnotations(types.FunctionStatus{Annotations: &map[string]string{"warmup": "-5s"}}))
+	})
+}
+
+func TestCacher_Warmup(t *testing.T) {
+	type received struct {
+		path   string
+		warmup string
+	}
+
+	var lock sync.Mutex
+	var requests []received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		requests = append(requests, received{path: r.URL.Path, warmup: r.Header.Get(WarmupHeader)})
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sent := func() []received {
+		lock.Lock()
+		defer lock.Unlock()
+
+		defer func() { requests = nil }()
+		return requests
+	}
+
+	clientMock := new(MockOpenFaaSClient)
+	clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{
+		{Name: "biller", Annotations: &map[string]string{"topic": "billing", "warmup": "30s"}},
+		{Name: "invoicer", Annotations: &map[string]string{"topic": "billing"}},
+		{Name: "reporter", Annotations: &map[string]string{"topic": "reports", "warmup": "10s", "com.openfaas.topic.paused": "true"}},
+	}, nil)
+
+	sink := &recordingSink{}
+	target := NewController(&config.Controller{EnableWarmups: true}, clientMock, NewTopicFunctionCache()).
+		WithInvoker(NewClient(CreateClient(server), nil, server.URL, "")).
+		WithMetrics(sink)
+	target.refreshTick(context.Background(), false)
+	start := time.Now()
+
+	t.Run("Should warm up annotated functions right away with the marker header", func(t *testing.T) {
+		target.warmupTick(context.Background(), start)
+
+		assert.Equal(t, []received{{path: "/function/biller", warmup: "true"}}, sent(), "Expected only the annotated function, which is not paused")
+	})
+
+	t.Run("Should warm up again once the interval elapsed", func(t *testing.T) {
+		target.warmupTick(context.Background(), start.Add(10*time.Second))
+		assert.Empty(t, sent(), "Expected no warmup within the interval")
+
+		target.warmupTick(context.Background(), start.Add(30*time.Second))
+		assert.Equal(t, []received{{path: "/function/biller", warmup: "true"}}, sent())
+	})
+
+	t.Run("Should not count warmups as invocations", func(t *testing.T) {
+		sink.lock.Lock()
+		defer sink.lock.Unlock()
+
+		assert.Empty(t, sink.invocations, "Expected no invocation to be counted")
+		assert.Zero(t, sink.latencies, "Expected no latency to be observed")
+		assert.Empty(t, target.FunctionStats(), "Expected no outcome to be recorded")
+	})
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"sync"
+
+	wrap "github.com/pkg/errors"
+)
+
+// weightedPool bounds the concurrent invocations across all functions by its size. Once it is saturated the freed
+// slots are granted using start-time fair queueing, so that every function receives slots proportional to its
+// weight while none of them starves. Each granted slot advances the virtual time of a function by 1/weight and the
+// waiter of the lowest virtual time is granted the next slot. Hence equal weights take turns between the functions.
+// A nil weightedPool does not limit at all.
+type weightedPool struct {
+	size int
+
+	lock    sync.Mutex
+	inUse   int
+	waiting []*poolWaiter
+	// clock is the virtual time of the last granted slot, functions that were idle start from it
+	clock float64
+	// finish is the virtual time at which the last granted slot of every function ends
+	finish   map[string]float64
+	sequence uint64
+}
+
+type poolWaiter struct {
+	start    float64
+	sequence uint64
+	ready    chan struct{}
+}
+
+func newWeightedPool(size int) *weightedPool {
+	return &weightedPool{size: size, finish: map[string]float64{}}
+}
+
+// Acquire waits until a slot of the pool is granted to the function or the context is done. The returned release
+// has to be called once the invocation finished.
+func (p *weightedPool) Acquire(ctx context.Context, fn Function) (func(), error) {
+	if p == nil {
+		return func() {}, nil
+	}
+
+	p.lock.Lock()
+	start := p.schedule(fn)
+	if p.inUse < p.size && len(p.waiting) == 0 {
+		p.inUse++
+		p.clock = start
+		p.lock.Unlock()
+		return p.release(), nil
+	}
+
+	waiter := &poolWaiter{start: start, sequence: p.sequence, ready: make(chan struct{})}
+	p.sequence++
+	p.waiting = append(p.waiting, waiter)
+	p.lock.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return p.release(), nil
+	case <-ctx.Done():
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		if !p.remove(waiter) {
+			// The slot was granted meanwhile
+			p.inUse--
+			p.wake()
+		}
+		return nil, wrap.Wrapf(ctx.Err(), "invocation pool of %d slots is saturated", p.size)
+	}
+}
+
+// schedule returns the virtual start of the next slot of the function and advances its finish, the lock has to be held
+func (p *weightedPool) schedule(fn Function) float64 {
+	start := p.finish[fn.String()]
+	if start < p.clock {
+		start = p.clock
+	}
+	p.finish[fn.String()] = start + 1/float64(weightOf(fn))
+	return start
+}
+
+func (p *weightedPool) release() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.lock.Lock()
+			defer p.lock.Unlock()
+
+			p.inUse--
+			p.wake()
+		})
+	}
+}
+
+// wake grants the free slots to the waiters of the lowest virtual start, the lock has to be held
+func (p *weightedPool) wake() {
+	for len(p.waiting) > 0 && p.inUse < p.size {
+		next := 0
+		for i, candidate := range p.waiting {
+			if candidate.start < p.waiting[next].start || (candidate.start == p.waiting[next].start && candidate.sequence < p.waiting[next].sequence) {
+				next = i
+			}
+		}
+		waiter := p.waiting[next]
+		p.waiting = append(p.waiting[:next], p.waiting[next+1:]...)
+
+		p.inUse++
+		p.clock = waiter.start
+		close(waiter.ready)
+	}
+}
+
+// remove drops the waiter, it returns false if the waiter was already granted a slot
+func (p *weightedPool) remove(waiter *poolWaiter) bool {
+	for i, candidate := range p.waiting {
+		if candidate == waiter {
+			p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// weightOf returns the weight of the function, which is 1 unless annotated otherwise
+func weightOf(fn Function) int {
+	if fn.Weight > 0 {
+		return fn.Weight
+	}
+	return 1
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package openfaas
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/config"
+	types2 "github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeightedPool(t *testing.T) {
+	// awaitWaiting blocks until the pool has the number of waiters
+	awaitWaiting := func(target *weightedPool, count int) {
+		assert.Eventually(t, func() bool {
+			target.lock.Lock()
+			defer target.lock.Unlock()
+			return len(target.waiting) == count
+		}, time.Second, time.Millisecond)
+	}
+
+	t.Run("Should grant the slots of a saturated pool proportional to the weights", func(t *testing.T) {
+		target := newWeightedPool(1)
+		critical := Function{Name: "critical", Weight: 3}
+		batch := Function{Name: "batch"}
+
+		release, err := target.Acquire(context.Background(), Function{Name: "holder"})
+		assert.NoError(t, err, "should not throw")
+
+		var lock sync.Mutex
+		var granted []string
+		var wg sync.WaitGroup
+		for i := 0; i < 40; i++ {
+			for _, fn := range []Function{critical, batch} {
+				wg.Add(1)
+				go func(fn Function) {
+					defer wg.Done()
+					done, err := target.Acquire(context.Background(), fn)
+					assert.NoError(t, err, "should not throw")
+
+					lock.Lock()
+					granted = append(granted, fn.Name)
+					lock.Unlock()
+					done()
+				}(fn)
+			}
+		}
+		awaitWaiting(target, 80)
+		release()
+		wg.Wait()
+
+		shares := map[string]int{}
+		for _, name := range granted[:40] {
+			shares[name]++
+		}
+		assert.InDelta(t, 30, shares["critical"], 1, "Expected three of four slots to be granted to the weight of 3")
+		assert.InDelta(t, 10, shares["batch"], 1, "Expected the weight of 1 not to starve")
+	})
+
+	t.Run("Should let equal weights take turns", func(t *testing.T) {
+		target := newWeightedPool(1)
+		release, err := target.Acquire(context.Background(), Function{Name: "holder"})
+		assert.NoError(t, err, "should not throw")
+
+		var lock sync.Mutex
+		var granted []string
+		var wg sync.WaitGroup
+		for i, name := range []string{"biller", "biller", "biller", "invoicer"} {
+			wg.Add(1)
+			go func(fn Function) {
+				defer wg.Done()
+				done, err := target.Acquire(context.Background(), fn)
+				assert.NoError(t, err, "should not throw")
+
+				lock.Lock()
+				granted = append(granted, fn.Name)
+				lock.Unlock()
+				done()
+			}(Function{Name: name})
+			awaitWaiting(target, i+1)
+		}
+		release()
+		wg.Wait()
+
+		assert.Contains(t, granted[:2], "invoicer", "Expected the invoicer not to wait for all invocations of the biller")
+	})
+
+	t.Run("Should give up the slot of a waiter whose context is done", func(t *testing.T) {
+		target := newWeightedPool(1)
+		release, err := target.Acquire(context.Background(), Function{Name: "biller"})
+		assert.NoError(t, err, "should not throw")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = target.Acquire(ctx, Function{Name: "invoicer"})
+		assert.Error(t, err, "should throw")
+
+		release()
+		release()
+		done, err := target.Acquire(context.Background(), Function{Name: "invoicer"})
+		assert.NoError(t, err, "Expected the slot to be free again")
+		done()
+	})
+
+	t.Run("Should not limit without pool", func(t *testing.T) {
+		var target *weightedPool
+
+		done, err := target.Acquire(context.Background(), Function{Name: "biller"})
+		assert.NoError(t, err, "should not throw")
+		done()
+	})
+}
+
+func TestCacher_InvocationPool(t *testing.T) {
+	t.Run("Should read the weight annotation", func(t *testing.T) {
+		annotations := map[string]string{"topic": "billing", WeightAnnotation: "5"}
+		invalid := map[string]string{"topic": "billing", WeightAnnotation: "heavy"}
+
+		clientMock := new(MockOpenFaaSClient)
+		clientMock.On("GetFunctions", "").Return([]types.FunctionStatus{
+			{Name: "biller", Annotations: &annotations},
+			{Name: "invoicer", Annotations: &invalid},
+		}, nil)
+
+		cache := NewTopicFunctionCache()
+		NewController(&config.Controller{}, clientMock, cache).refreshTick(context.Background(), false)
+
+		assert.ElementsMatch(t, []Function{{Name: "biller", Weight: 5}, {Name: "invoicer"}}, cache.GetCachedValues("billing"))
+	})
+
+	t.Run("Should never exceed the pool size", func(t *testing.T) {
+		recorder := &concurrencyRecorder{current: map[string]int{}, peak: map[string]int{}}
+		cache := NewTopicFunctionCache()
+		cache.Refresh(map[string][]Function{"billing": {{Name: "biller", Weight: 5}}})
+
+		target := NewController(&config.Controller{InvocationPoolSize: 2, InvokeTimeout: time.Minute}, new(MockOpenFaaSClient), cache).WithInvoker(recorder)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := target.Invoke("billing", &types2.OpenFaaSInvocation{Topic: "billing"})
+				assert.NoError(t, err, "should not throw")
+			}()
+		}
+		wg.Wait()
+
+		assert.LessOrEqual(t, recorder.peak["biller"], 2, "Expected the pool size to be respected")
+	})
+}
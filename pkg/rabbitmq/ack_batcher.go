@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/backoff"
+	"github.com/streadway/amqp"
+)
+
+// ackBatcher acknowledges deliveries of a channel with a single multiple-ack, either once size deliveries
+// are ready to be acknowledged or every interval. As deliveries complete out of order, only the deliveries
+// up to the highest contiguous settled delivery tag are acknowledged. Delivery tags of a channel start at 1
+// and increase by 1, so a gap is a delivery that is still being processed.
+type ackBatcher struct {
+	size     int
+	interval time.Duration
+
+	lock         sync.Mutex
+	acknowledger amqp.Acknowledger
+	// watermark is the highest delivery tag up to which every delivery is settled
+	watermark uint64
+	// settled contains the tags above the watermark, true if they still need to be acknowledged
+	settled map[uint64]bool
+	// pending is the highest tag up to the watermark that still needs to be acknowledged, 0 if none
+	pending      uint64
+	pendingCount int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newAckBatcher(size int, interval time.Duration) *ackBatcher {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	return &ackBatcher{
+		size:     size,
+		interval: interval,
+		settled:  map[uint64]bool{},
+	}
+}
+
+// Start flushes the batch every interval until Stop is called
+func (b *ackBatcher) Start() {
+	b.stop = make(chan struct{})
+	b.done = make(chan struct{})
+
+	go func() {
+		defer close(b.done)
+
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				b.flush()
+			case <-b.stop:
+				b.flush()
+				return
+			}
+		}
+	}()
+}
+
+// Stop flushes the remaining batch and stops the interval
+func (b *ackBatcher) Stop() {
+	if b.stop == nil {
+		return
+	}
+
+	close(b.stop)
+	<-b.done
+	b.stop = nil
+}
+
+// reset forgets the settled deliveries, which is required once the channel is replaced, as the delivery tags of the
+// new channel start at 1 again. The batch has to be stopped and thereby flushed beforehand.
+func (b *ackBatcher) reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.acknowledger = nil
+	b.watermark = 0
+	b.settled = map[uint64]bool{}
+	b.pending = 0
+	b.pendingCount = 0
+}
+
+// Ack marks the delivery as processed, it is acknowledged with the next flush
+func (b *ackBatcher) Ack(delivery amqp.Delivery) {
+	b.lock.Lock()
+	b.acknowledger = delivery.Acknowledger
+	b.settle(delivery.DeliveryTag, true)
+	full := b.pendingCount >= b.size
+	b.lock.Unlock()
+
+	if full {
+		b.flush()
+	}
+}
+
+// Settled marks a delivery that was nacked or rejected individually, so that it no longer blocks the batch
+func (b *ackBatcher) Settled(delivery amqp.Delivery) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.settle(delivery.DeliveryTag, false)
+}
+
+func (b *ackBatcher) settle(tag uint64, ack bool) {
+	if tag <= b.watermark {
+		return
+	}
+	b.settled[tag] = ack
+
+	for {
+		needsAck, ok := b.settled[b.watermark+1]
+		if !ok {
+			return
+		}
+
+		b.watermark++
+		delete(b.settled, b.watermark)
+		if needsAck {
+			b.pending = b.watermark
+			b.pendingCount++
+		}
+	}
+}
+
+// flush acknowledges all deliveries up to the highest contiguous pending tag
+func (b *ackBatcher) flush() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.pending == 0 {
+		return
+	}
+
+	delays := backoff.New(acknowledgeBackoff)
+	for retry := 0; retry < MaxAttempts; retry++ {
+		err := b.acknowledger.Ack(b.pending, true)
+		if err == nil {
+			b.pending = 0
+			b.pendingCount = 0
+			return
+		}
+
+		log.Printf("Failed to acknowledge deliveries up to %d due to %s. Attempt %d/3", b.pending, err, retry+1)
+		time.Sleep(delays.Next())
+	}
+
+	log.Printf("Failed to acknowledge deliveries up to %d, will retry with the next flush", b.pending)
+}
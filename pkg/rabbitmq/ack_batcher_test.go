@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/mock"
+)
+
+func tagged(acker amqp.Acknowledger, tag uint64) amqp.Delivery {
+	return amqp.Delivery{Acknowledger: acker, DeliveryTag: tag}
+}
+
+func TestAckBatcher(t *testing.T) {
+	t.Run("Should acknowledge in order deliveries once the batch is full", func(t *testing.T) {
+		acker := new(acknowledgerMock)
+		acker.On("Ack", uint64(3), true).Return(nil).Once()
+
+		target := newAckBatcher(3, time.Hour)
+		target.Ack(tagged(acker, 1))
+		target.Ack(tagged(acker, 2))
+		acker.AssertNotCalled(t, "Ack", mock.Anything, mock.Anything)
+
+		target.Ack(tagged(acker, 3))
+		acker.AssertExpectations(t)
+	})
+
+	t.Run("Should only acknowledge up to the highest contiguous tag for out of order completion", func(t *testing.T) {
+		acker := new(acknowledgerMock)
+		acker.On("Ack", uint64(2), true).Return(nil).Once()
+		acker.On("Ack", uint64(5), true).Return(nil).Once()
+
+		target := newAckBatcher(2, time.Hour)
+		target.Ack(tagged(acker, 2))
+		target.Ack(tagged(acker, 4))
+		target.Ack(tagged(acker, 5))
+		acker.AssertNotCalled(t, "Ack", mock.Anything, mock.Anything)
+
+		target.Ack(tagged(acker, 1))
+		acker.AssertCalled(t, "Ack", uint64(2), true)
+
+		target.Ack(tagged(acker, 3))
+		acker.AssertExpectations(t)
+	})
+
+	t.Run("Should skip individually settled deliveries without acknowledging them", func(t *testing.T) {
+		acker := new(acknowledgerMock)
+		acker.On("Ack", uint64(2), true).Return(nil).Once()
+
+		target := newAckBatcher(2, time.Hour)
+		target.Ack(tagged(acker, 1))
+		target.Ack(tagged(acker, 2))
+		acker.AssertExpectations(t)
+
+		acker.On("Ack", uint64(3), true).Return(nil).Once()
+		target.Settled(tagged(acker, 4))
+		target.Ack(tagged(acker, 3))
+		target.flush()
+		target.flush()
+
+		acker.AssertExpectations(t)
+		acker.AssertNotCalled(t, "Ack", uint64(4), true)
+	})
+
+	t.Run("Should flush a partial batch every interval and on stop", func(t *testing.T) {
+		acker := new(acknowledgerMock)
+		acker.On("Ack", uint64(1), true).Return(nil).Once()
+		acker.On("Ack", uint64(2), true).Return(nil).Once()
+
+		target := newAckBatcher(10, 20*time.Millisecond)
+		target.Start()
+
+		target.Ack(tagged(acker, 1))
+		time.Sleep(60 * time.Millisecond)
+		acker.AssertCalled(t, "Ack", uint64(1), true)
+
+		target.Ack(tagged(acker, 2))
+		target.Stop()
+		acker.AssertExpectations(t)
+	})
+
+	t.Run("Should keep the batch if acknowledging failed", func(t *testing.T) {
+		acker := new(acknowledgerMock)
+		acker.On("Ack", uint64(1), true).Return(amqp.ErrClosed).Times(MaxAttempts)
+
+		target := newAckBatcher(5, time.Hour)
+		target.Ack(tagged(acker, 1))
+		target.flush()
+		acker.AssertExpectations(t)
+
+		acker.On("Ack", uint64(2), true).Return(nil).Once()
+		target.Ack(tagged(acker, 2))
+		target.flush()
+		acker.AssertExpectations(t)
+	})
+}
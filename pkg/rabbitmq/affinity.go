@@ -0,0 +1,35 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"github.com/streadway/amqp"
+)
+
+// AffinityHash returns the hex encoded 64 bit FNV-1a hash of the key. It is stable across invocations and
+// connector replicas, so that the routing in front of the functions can pin messages of a key to one replica.
+func AffinityHash(key string) string {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(key))
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
+
+// hashKey returns the hash of the affinity key of the delivery, it is empty if none is configured or the delivery
+// does not contain the key
+func (e *Exchange) hashKey(delivery amqp.Delivery) string {
+	if e.affinity == nil {
+		return ""
+	}
+
+	key, ok := e.affinity.Extract(delivery)
+	if !ok {
+		return ""
+	}
+	return AffinityHash(key)
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"testing"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAffinityHash(t *testing.T) {
+	t.Run("Should hash the same key equally", func(t *testing.T) {
+		assert.Equal(t, "af63dc4c8601ec8c", AffinityHash("a"))
+		assert.Equal(t, AffinityHash("customer-42"), AffinityHash("customer-42"))
+	})
+
+	t.Run("Should hash different keys differently", func(t *testing.T) {
+		assert.NotEqual(t, AffinityHash("customer-42"), AffinityHash("customer-43"))
+	})
+}
+
+func TestExchange_HashKey(t *testing.T) {
+	definition := types.Exchange{Name: "Nasdaq", Topics: []string{"Orders"}}
+
+	invoke := func(target *Exchange, body string) string {
+		var hashKey string
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Orders", mock.Anything).Run(func(args mock.Arguments) {
+			hashKey = args.Get(1).(*types.OpenFaaSInvocation).HashKey
+		}).Return([]types.InvocationResult{}, nil)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		target.client = invoker
+		target.handleInvocation("Orders", amqp.Delivery{Acknowledger: acker, RoutingKey: "Orders", Body: []byte(body)})
+		invoker.AssertExpectations(t)
+		return hashKey
+	}
+
+	t.Run("Should produce the same hash key for the same key across invocations", func(t *testing.T) {
+		target := &Exchange{definition: &definition, affinity: &JSONPathExtractor{path: []string{"customer", "id"}}}
+
+		first := invoke(target, `{"customer": {"id": "42"}, "total": 10}`)
+		second := invoke(target, `{"customer": {"id": "42"}, "total": 99}`)
+		other := invoke(target, `{"customer": {"id": "43"}, "total": 10}`)
+
+		assert.Equal(t, AffinityHash("42"), first)
+		assert.Equal(t, first, second, "Expected the same key to be hashed equally")
+		assert.NotEqual(t, first, other, "Expected another key to be hashed differently")
+	})
+
+	t.Run("Should not set a hash key for deliveries without key", func(t *testing.T) {
+		target := &Exchange{definition: &definition, affinity: &JSONPathExtractor{path: []string{"customer", "id"}}}
+
+		assert.Empty(t, invoke(target, `{"total": 10}`))
+	})
+
+	t.Run("Should not set a hash key without affinity", func(t *testing.T) {
+		assert.Empty(t, invoke(&Exchange{definition: &definition}, `{"customer": {"id": "42"}}`))
+	})
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// ArchiveSinkNoOp discards the archived messages
+	ArchiveSinkNoOp = "noop"
+	// ArchiveSinkFilePrefix writes every archived message as json file into the directory, e.g. file:/var/archive
+	ArchiveSinkFilePrefix = "file:"
+
+	// archiveQueueSize of messages that are buffered for archiving, further messages are dropped
+	archiveQueueSize = 1024
+)
+
+// ArchivedMessage is the raw delivery, which can be replayed via the invoke endpoint using its topic and body
+type ArchivedMessage struct {
+	CorrelationID   string                 `json:"correlationId"`
+	Exchange        string                 `json:"exchange"`
+	RoutingKey      string                 `json:"routingKey"`
+	Topic           string                 `json:"topic"`
+	ContentType     string                 `json:"contentType"`
+	ContentEncoding string                 `json:"contentEncoding"`
+	Headers         map[string]interface{} `json:"headers"`
+	Body            []byte                 `json:"body"`
+	Timestamp       time.Time              `json:"timestamp"`
+}
+
+// NewArchivedMessage copies the delivery, the topic is the one resolved for invocation. Deliveries without
+// a timestamp are archived with the time they were received.
+func NewArchivedMessage(topic string, delivery amqp.Delivery) ArchivedMessage {
+	timestamp := delivery.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	headers := make(map[string]interface{}, len(delivery.Headers))
+	for key, value := range delivery.Headers {
+		headers[key] = value
+	}
+
+	return ArchivedMessage{
+		CorrelationID:   delivery.CorrelationId,
+		Exchange:        delivery.Exchange,
+		RoutingKey:      delivery.RoutingKey,
+		Topic:           topic,
+		ContentType:     delivery.ContentType,
+		ContentEncoding: delivery.ContentEncoding,
+		Headers:         headers,
+		Body:            append([]byte(nil), delivery.Body...),
+		Timestamp:       timestamp.UTC(),
+	}
+}
+
+// MessageArchiver persists messages keyed by their correlation id, so that they can be replayed later
+type MessageArchiver interface {
+	Archive(message ArchivedMessage) error
+}
+
+// NewMessageArchiver creates the archiver matching the provided sink
+func NewMessageArchiver(fs afero.Fs, sink string) (MessageArchiver, error) {
+	switch {
+	case sink == ArchiveSinkNoOp:
+		return &NoOpArchiver{}, nil
+	case strings.HasPrefix(sink, ArchiveSinkFilePrefix) && len(strings.TrimPrefix(sink, ArchiveSinkFilePrefix)) > 0:
+		return NewFileArchiver(fs, strings.TrimPrefix(sink, ArchiveSinkFilePrefix))
+	default:
+		return nil, fmt.Errorf("archive sink %s is not one of noop or file:<dir>", sink)
+	}
+}
+
+// NoOpArchiver discards every message
+type NoOpArchiver struct{}
+
+// Archive discards the message
+func (a *NoOpArchiver) Archive(_ ArchivedMessage) error {
+	return nil
+}
+
+// unsafeKeyChars are replaced within the correlation id, so that it can be used as file name
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// FileArchiver writes every message as {correlation id}.json into a directory. Messages without correlation id
+// are keyed by their timestamp, a message archived again with the same key replaces the previous one.
+type FileArchiver struct {
+	fs  afero.Fs
+	dir string
+}
+
+// NewFileArchiver creates the directory if it does not exist yet
+func NewFileArchiver(fs afero.Fs, dir string) (*FileArchiver, error) {
+	if err := fs.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory %s due to %s", dir, err)
+	}
+	return &FileArchiver{fs: fs, dir: dir}, nil
+}
+
+// Archive writes the message as json file
+func (a *FileArchiver) Archive(message ArchivedMessage) error {
+	key := message.CorrelationID
+	if len(key) == 0 {
+		key = fmt.Sprintf("message-%d", message.Timestamp.UnixNano())
+	}
+	key = unsafeKeyChars.ReplaceAllString(key, "_")
+
+	content, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return afero.WriteFile(a.fs, path.Join(a.dir, key+".json"), content, 0o640)
+}
+
+// AsyncArchiver archives the messages in the background, so that archiving never delays an invocation.
+// Messages are dropped while the buffer is full and failures are only logged.
+type AsyncArchiver struct {
+	archiver MessageArchiver
+	pending  chan ArchivedMessage
+	done     chan struct{}
+
+	lock    sync.RWMutex
+	stopped bool
+}
+
+// NewAsyncArchiver starts archiving the messages using the provided archiver
+func NewAsyncArchiver(archiver MessageArchiver) *AsyncArchiver {
+	a := &AsyncArchiver{
+		archiver: archiver,
+		pending:  make(chan ArchivedMessage, archiveQueueSize),
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(a.done)
+		for message := range a.pending {
+			if err := a.archiver.Archive(message); err != nil {
+				log.Printf("Failed to archive message %s of topic %s due to %s", message.CorrelationID, message.Topic, err)
+			}
+		}
+	}()
+	return a
+}
+
+// Archive queues the message and returns immediately, an error is returned if the message was dropped
+func (a *AsyncArchiver) Archive(message ArchivedMessage) error {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	if a.stopped {
+		return fmt.Errorf("archiver is stopped")
+	}
+
+	select {
+	case a.pending <- message:
+		return nil
+	default:
+		return fmt.Errorf("archive buffer of %d messages is full", archiveQueueSize)
+	}
+}
+
+// Stop archives the queued messages and returns afterwards, further messages are rejected
+func (a *AsyncArchiver) Stop() {
+	a.lock.Lock()
+	if !a.stopped {
+		a.stopped = true
+		close(a.pending)
+	}
+	a.lock.Unlock()
+
+	<-a.done
+}
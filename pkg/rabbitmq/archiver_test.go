@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingArchiver struct {
+	lock     sync.Mutex
+	messages []ArchivedMessage
+}
+
+func (a *recordingArchiver) Archive(message ArchivedMessage) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.messages = append(a.messages, message)
+	return nil
+}
+
+func TestNewMessageArchiver(t *testing.T) {
+	t.Run("Should create the archiver of the sink", func(t *testing.T) {
+		archiver, err := NewMessageArchiver(afero.NewMemMapFs(), "noop")
+		assert.NoError(t, err, "should not throw")
+		assert.IsType(t, &NoOpArchiver{}, archiver)
+
+		archiver, err = NewMessageArchiver(afero.NewMemMapFs(), "file:/var/archive")
+		assert.NoError(t, err, "should not throw")
+		assert.IsType(t, &FileArchiver{}, archiver)
+	})
+
+	t.Run("Should reject unknown sinks", func(t *testing.T) {
+		_, err := NewMessageArchiver(afero.NewMemMapFs(), "s3://bucket")
+		assert.Error(t, err, "should throw")
+
+		_, err = NewMessageArchiver(afero.NewMemMapFs(), "file:")
+		assert.Error(t, err, "should throw")
+	})
+}
+
+func TestFileArchiver_Archive(t *testing.T) {
+	timestamp := time.Date(2021, 6, 1, 12, 30, 0, 0, time.UTC)
+
+	t.Run("Should write the message keyed by its correlation id", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		target, err := NewFileArchiver(fs, "/var/archive")
+		assert.NoError(t, err, "should not throw")
+
+		err = target.Archive(NewArchivedMessage("billing", amqp.Delivery{
+			CorrelationId:   "order-42",
+			Exchange:        "Nasdaq",
+			RoutingKey:      "billing.eu",
+			ContentType:     "application/json",
+			ContentEncoding: "utf-8",
+			Headers:         amqp.Table{"x-tenant": "acme"},
+			Body:            []byte(`{"amount":42}`),
+			Timestamp:       timestamp,
+		}))
+		assert.NoError(t, err, "should not throw")
+
+		content, err := afero.ReadFile(fs, "/var/archive/order-42.json")
+		assert.NoError(t, err, "Expected the message to be written")
+
+		var archived ArchivedMessage
+		assert.NoError(t, json.Unmarshal(content, &archived), "should not throw")
+		assert.Equal(t, "order-42", archived.CorrelationID)
+		assert.Equal(t, "Nasdaq", archived.Exchange)
+		assert.Equal(t, "billing.eu", archived.RoutingKey)
+		assert.Equal(t, "billing", archived.Topic)
+		assert.Equal(t, "application/json", archived.ContentType)
+		assert.Equal(t, "utf-8", archived.ContentEncoding)
+		assert.Equal(t, map[string]interface{}{"x-tenant": "acme"}, archived.Headers)
+		assert.Equal(t, []byte(`{"amount":42}`), archived.Body)
+		assert.True(t, timestamp.Equal(archived.Timestamp))
+	})
+
+	t.Run("Should derive a safe key", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		target, _ := NewFileArchiver(fs, "/var/archive")
+
+		assert.NoError(t, target.Archive(ArchivedMessage{CorrelationID: "../order/42"}))
+		assert.NoError(t, target.Archive(ArchivedMessage{Timestamp: timestamp}))
+
+		exists, _ := afero.Exists(fs, "/var/archive/.._order_42.json")
+		assert.True(t, exists, "Expected path separators to be replaced")
+		exists, _ = afero.Exists(fs, "/var/archive/message-1622550600000000000.json")
+		assert.True(t, exists, "Expected messages without correlation id to be keyed by their timestamp")
+	})
+}
+
+func TestAsyncArchiver(t *testing.T) {
+	t.Run("Should archive the messages in the background", func(t *testing.T) {
+		archiver := &recordingArchiver{}
+		target := NewAsyncArchiver(archiver)
+
+		assert.NoError(t, target.Archive(ArchivedMessage{CorrelationID: "1"}))
+		assert.NoError(t, target.Archive(ArchivedMessage{CorrelationID: "2"}))
+		target.Stop()
+
+		assert.Equal(t, []ArchivedMessage{{CorrelationID: "1"}, {CorrelationID: "2"}}, archiver.messages)
+	})
+
+	t.Run("Should reject messages once stopped", func(t *testing.T) {
+		target := NewAsyncArchiver(&recordingArchiver{})
+		target.Stop()
+
+		assert.Error(t, target.Archive(ArchivedMessage{CorrelationID: "1"}))
+		target.Stop()
+	})
+}
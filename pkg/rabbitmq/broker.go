@@ -7,27 +7,84 @@ package rabbitmq
 
 import (
 	"crypto/tls"
+	"time"
 
+	"github.com/Templum/rabbitmq-connector/pkg/version"
 	"github.com/streadway/amqp"
 )
 
+// ConnectionNameProperty is the client property RabbitMQ displays as name of a connection
+const ConnectionNameProperty = "connection_name"
+
 // NewBroker generates a new wrapper around the RabbitMQ Client lib
-func NewBroker() RBDialer {
+func NewBroker() *Broker {
 	return &Broker{}
 }
 
+// NewProxyBroker generates a new wrapper around the RabbitMQ Client lib, which connects through the provided proxy
+func NewProxyBroker(proxyURL string) (*Broker, error) {
+	dial, err := NewProxyDialer(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Broker{dial: dial}, nil
+}
+
 // Broker is a wrapper around the RabbitMQ Client lib, which allows better
 // unit testing. By abstracting away the RabbitMQ raw types, which are struct based.
-type Broker struct{}
+type Broker struct {
+	dial           DialFunc
+	vhost          string
+	connectionName string
+}
+
+// WithVHost connects to the provided vhost regardless of the path of the url. As the vhost is passed
+// to the lib as is, it must not be escaped. An empty vhost keeps using the one of the url.
+func (b *Broker) WithVHost(vhost string) *Broker {
+	b.vhost = vhost
+	return b
+}
+
+// WithConnectionName advertises the name as client property, which identifies the connection in the management UI.
+// An empty name keeps the connection unnamed.
+func (b *Broker) WithConnectionName(name string) *Broker {
+	b.connectionName = name
+	return b
+}
 
 // Dial tries to connect to the providing url, returning either a RBConnection or
 // the received connection error.
 func (b *Broker) Dial(url string) (RBConnection, error) {
-	return amqp.Dial(url)
+	return amqp.DialConfig(url, b.config(nil))
 }
 
 // DialTLS tries to connect to the providing url using TLS, returning either a RBConnection or
 // the received connection error.
 func (b *Broker) DialTLS(url string, conf *tls.Config) (RBConnection, error) {
-	return amqp.DialTLS(url, conf)
+	// If a proxy is used, the TLS handshake is performed by the lib on top of the established tunnel
+	return amqp.DialConfig(url, b.config(conf))
+}
+
+// config mirrors the defaults used by amqp.Dial, while applying the proxy, vhost and connection name if present
+func (b *Broker) config(conf *tls.Config) amqp.Config {
+	var properties amqp.Table
+	if len(b.connectionName) > 0 {
+		// Advertised properties replace the defaults of the lib, hence product and version are set as well
+		_, release := version.GetReleaseInfo()
+		properties = amqp.Table{
+			"product":              "OpenFaaS - Rabbit MQ Connector",
+			"version":              release,
+			ConnectionNameProperty: b.connectionName,
+		}
+	}
+
+	return amqp.Config{
+		Heartbeat:       10 * time.Second,
+		Locale:          "en_US",
+		TLSClientConfig: conf,
+		Vhost:           b.vhost,
+		Dial:            b.dial,
+		Properties:      properties,
+	}
 }
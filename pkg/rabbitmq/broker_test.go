@@ -8,7 +8,10 @@ package rabbitmq
 import (
 	"context"
 	"crypto/tls"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"net"
 	"testing"
 
 	"github.com/docker/go-connections/nat"
@@ -18,10 +21,16 @@ import (
 )
 
 func SkipIfProviderIsNotHealthy(t *testing.T) {
-	_, err := testcontainers.ProviderDocker.GetProvider()
+	provider, err := testcontainers.ProviderDocker.GetProvider()
 	if err != nil {
 		t.Skipf("Docker is not running. TestContainers can't perform is work without it: %s", err)
 	}
+
+	if docker, ok := provider.(*testcontainers.DockerProvider); ok {
+		if err := docker.Health(context.Background()); err != nil {
+			t.Skipf("Docker is not running. TestContainers can't perform is work without it: %s", err)
+		}
+	}
 }
 
 func TestBroker_Dial(t *testing.T) {
@@ -106,3 +115,99 @@ func TestBroker_DialTLS(t *testing.T) {
 	assert.Nil(t, con, "should not support TLS")
 	assert.Error(t, err, "should raise an error")
 }
+
+// vhostRecorder performs the opening handshake of AMQP 0-9-1 until the client requests the vhost, which is recorded
+func vhostRecorder(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	requested := make(chan string, 1)
+	go func() {
+		// A failed handshake closes the channel, so that the test is not blocked
+		defer close(requested)
+
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+
+		// connection.start with version 0-9, no server properties, PLAIN mechanism and en_US locale
+		start := []byte{0, 10, 0, 10, 0, 9, 0, 0, 0, 0, 0, 0, 0, 5, 'P', 'L', 'A', 'I', 'N', 0, 0, 0, 5, 'e', 'n', '_', 'U', 'S'}
+		// connection.tune without limits and heartbeats
+		tune := []byte{0, 10, 0, 30, 0, 0, 0, 0, 0, 0, 0, 0}
+
+		writeMethodFrame(conn, start)
+		readMethodFrame(conn) // start-ok
+		writeMethodFrame(conn, tune)
+		readMethodFrame(conn) // tune-ok
+
+		open := readMethodFrame(conn)
+		if len(open) < 5 {
+			return
+		}
+		requested <- string(open[5 : 5+int(open[4])])
+	}()
+
+	return listener.Addr().String(), requested
+}
+
+func writeMethodFrame(w io.Writer, payload []byte) {
+	frame := []byte{1, 0, 0}
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	frame = append(frame, payload...)
+	_, _ = w.Write(append(frame, 0xCE))
+}
+
+func readMethodFrame(r io.Reader) []byte {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[3:])+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil
+	}
+	return payload[:len(payload)-1]
+}
+
+func TestBroker_WithVHost(t *testing.T) {
+	t.Run("Should request the vhost of the url by default", func(t *testing.T) {
+		addr, requested := vhostRecorder(t)
+
+		_, _ = NewBroker().Dial("amqp://user:pass@" + addr + "/%2Fteam%20a")
+
+		assert.Equal(t, "/team a", <-requested)
+	})
+
+	t.Run("Should request the explicit vhost regardless of the url", func(t *testing.T) {
+		addr, requested := vhostRecorder(t)
+
+		_, _ = NewBroker().WithVHost("/team a/päyments%").Dial("amqp://user:pass@" + addr + "/other")
+
+		assert.Equal(t, "/team a/päyments%", <-requested)
+	})
+}
+
+func TestBroker_WithConnectionName(t *testing.T) {
+	t.Run("Should advertise the connection name in the dial config", func(t *testing.T) {
+		conf := NewBroker().WithConnectionName("rabbitmq-connector-pod-1").config(nil)
+
+		assert.Equal(t, "rabbitmq-connector-pod-1", conf.Properties[ConnectionNameProperty])
+		assert.NotEmpty(t, conf.Properties["product"], "Expected the product to be kept")
+		assert.NotEmpty(t, conf.Properties["version"], "Expected the version to be kept")
+	})
+
+	t.Run("Should keep the defaults of the lib without a name", func(t *testing.T) {
+		assert.Nil(t, NewBroker().config(nil).Properties)
+	})
+}
@@ -19,6 +19,8 @@ type ChannelCreator interface {
 // ChannelConsumer are interacting on channels
 type ChannelConsumer interface {
 	Consume(queue string, consumer string, autoAck bool, exclusive bool, noLocal bool, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Cancel(consumer string, noWait bool) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
 	NotifyClose(c chan *amqp.Error) chan *amqp.Error
 	Close() error
 }
@@ -34,6 +36,12 @@ type ExchangeHandler interface {
 type QueueHandler interface {
 	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
 	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	QueueUnbind(name, key, exchange string, args amqp.Table) error
+}
+
+// ChannelPublisher allows publishing messages onto an exchange using an existing channel
+type ChannelPublisher interface {
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
 }
 
 // RBDialer is a abstraction of the RabbitMQ Dial methods
@@ -47,6 +55,7 @@ type RabbitChannel interface {
 	ExchangeHandler
 	QueueHandler
 	ChannelConsumer
+	ChannelPublisher
 }
 
 // RBConnection is a abstraction of a RabbitMQ Connection
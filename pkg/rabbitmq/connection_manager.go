@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Templum/rabbitmq-connector/pkg/backoff"
 	"github.com/pkg/errors"
 	"github.com/streadway/amqp"
 )
@@ -34,21 +35,25 @@ type ConnectionManager struct {
 	lock    sync.RWMutex
 	dialer  RBDialer
 	tlsConf *tls.Config
+	backoff backoff.Config
 }
 
-// NewConnectionManager creates a new instance using the provided dialer
-func NewConnectionManager(dialer RBDialer, conf *tls.Config) Manager {
+// NewConnectionManager creates a new instance using the provided dialer, failed connects are retried using the provided backoff
+func NewConnectionManager(dialer RBDialer, conf *tls.Config, retry backoff.Config) Manager {
 	return &ConnectionManager{
 		lock:    sync.RWMutex{},
 		con:     nil,
 		dialer:  dialer,
 		tlsConf: conf,
+		backoff: retry,
 	}
 }
 
 // Connect uses the provided connection urls and tries up to 3 times to establish a connection.
-// The retries are performed exponentially starting with 2s. It also creates a listener for close notifications.
+// The retries are delayed by the configured backoff. It also creates a listener for close notifications.
 func (m *ConnectionManager) Connect(connectionURL string) (<-chan *amqp.Error, error) {
+	delays := backoff.New(m.backoff)
+
 	for attempt := 0; attempt < 3; attempt++ {
 
 		con, err := m.dial(connectionURL)
@@ -64,8 +69,10 @@ func (m *ConnectionManager) Connect(connectionURL string) (<-chan *amqp.Error, e
 			return closeChannel, nil
 		}
 
-		log.Printf("Failed to establish connection due to %s. Attempt: %d/3", err, attempt)
-		time.Sleep(time.Duration(2*attempt+1) * time.Second)
+		log.Printf("Failed to establish connection due to %s. Attempt: %d/3", err, attempt+1)
+		if attempt < 2 {
+			time.Sleep(delays.Next())
+		}
 	}
 
 	return nil, errors.New("could not establish connection to Rabbit MQ Cluster")
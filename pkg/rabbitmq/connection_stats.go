@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+)
+
+// Connection states reported by ConnectionStats
+const (
+	ConnectionConnected    = "connected"
+	ConnectionReconnecting = "reconnecting"
+	ConnectionClosed       = "closed"
+)
+
+// ConnectionStatus describes the connection to a vhost, including the last time it was lost and why
+type ConnectionStatus struct {
+	VHost               string     `json:"vhost"`
+	State               string     `json:"state"`
+	ConnectedSince      *time.Time `json:"connected_since,omitempty"`
+	Uptime              string     `json:"uptime"`
+	Channels            int        `json:"channels"`
+	Reconnects          int        `json:"reconnects"`
+	LastReconnect       *time.Time `json:"last_reconnect,omitempty"`
+	LastReconnectReason string     `json:"last_reconnect_reason,omitempty"`
+}
+
+// ConnectionStats tracks the state of the connection to a vhost across reconnects, it is updated by the bridge and
+// reported by /status/amqp. Channels are counted if created using Track, channels of a lost connection are dropped.
+// A nil ConnectionStats records nothing.
+type ConnectionStats struct {
+	vhost string
+	sink  metrics.Sink
+	now   func() time.Time
+
+	lock           sync.Mutex
+	state          string
+	connectedSince time.Time
+	channels       int
+	// generation is increased with every connection, which keeps channels of previous ones from being uncounted
+	generation    uint64
+	reconnects    int
+	lastReconnect time.Time
+	lastReason    string
+}
+
+// NewConnectionStats creates new stats of the connection to the vhost, which are recorded using the sink as well
+func NewConnectionStats(vhost string, sink metrics.Sink) *ConnectionStats {
+	return &ConnectionStats{vhost: vhost, sink: sink, now: time.Now, state: ConnectionClosed}
+}
+
+// WithMetrics records the stats using the sink instead
+func (s *ConnectionStats) WithMetrics(sink metrics.Sink) *ConnectionStats {
+	if s == nil {
+		return s
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.sink = sink
+	return s
+}
+
+// Connected records that the connection was established
+func (s *ConnectionStats) Connected() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.state = ConnectionConnected
+	s.connectedSince = s.now()
+	s.reset()
+}
+
+// Reconnecting records that the connection was lost for the reason and is about to be recovered
+func (s *ConnectionStats) Reconnecting(reason string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.state = ConnectionReconnecting
+	s.reconnects++
+	s.lastReconnect = s.now()
+	s.lastReason = reason
+	s.sink.IncAMQPReconnects(s.vhost)
+	s.reset()
+}
+
+// Closed records that the connection was closed, either on purpose or due to an unrecoverable error
+func (s *ConnectionStats) Closed() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.state = ConnectionClosed
+	s.reset()
+}
+
+// Track counts the channels created by the creator, until they are closed or their connection is gone
+func (s *ConnectionStats) Track(creator ChannelCreator) ChannelCreator {
+	if s == nil {
+		return creator
+	}
+	return &trackedChannelCreator{creator: creator, stats: s}
+}
+
+// Status describes the connection right now
+func (s *ConnectionStats) Status() ConnectionStatus {
+	if s == nil {
+		return ConnectionStatus{State: ConnectionClosed}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	status := ConnectionStatus{
+		VHost:               s.vhost,
+		State:               s.state,
+		Uptime:              time.Duration(0).String(),
+		Channels:            s.channels,
+		Reconnects:          s.reconnects,
+		LastReconnectReason: s.lastReason,
+	}
+	if s.state == ConnectionConnected {
+		since := s.connectedSince.UTC()
+		status.ConnectedSince = &since
+		status.Uptime = s.now().Sub(s.connectedSince).Truncate(time.Second).String()
+	}
+	if !s.lastReconnect.IsZero() {
+		last := s.lastReconnect.UTC()
+		status.LastReconnect = &last
+	}
+
+	return status
+}
+
+// reset drops the channels of the previous connection, the lock has to be held
+func (s *ConnectionStats) reset() {
+	s.generation++
+	s.channels = 0
+	s.sink.SetAMQPConnection(s.vhost, s.state == ConnectionConnected, 0)
+}
+
+func (s *ConnectionStats) opened() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.channels++
+	s.sink.SetAMQPConnection(s.vhost, s.state == ConnectionConnected, s.channels)
+	return s.generation
+}
+
+func (s *ConnectionStats) closed(generation uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if generation != s.generation || s.channels == 0 {
+		return
+	}
+	s.channels--
+	s.sink.SetAMQPConnection(s.vhost, s.state == ConnectionConnected, s.channels)
+}
+
+type trackedChannelCreator struct {
+	creator ChannelCreator
+	stats   *ConnectionStats
+}
+
+func (c *trackedChannelCreator) Channel() (RabbitChannel, error) {
+	channel, err := c.creator.Channel()
+	if err != nil {
+		return channel, err
+	}
+
+	return &trackedChannel{RabbitChannel: channel, stats: c.stats, generation: c.stats.opened()}, nil
+}
+
+// trackedChannel uncounts itself once it is closed, repeated closes are only counted once
+type trackedChannel struct {
+	RabbitChannel
+	stats      *ConnectionStats
+	generation uint64
+	closeOnce  sync.Once
+}
+
+func (c *trackedChannel) Close() error {
+	c.closeOnce.Do(func() { c.stats.closed(c.generation) })
+	return c.RabbitChannel.Close()
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionStats(t *testing.T) {
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	newStats := func(vhost string) (*ConnectionStats, *time.Time) {
+		now := start
+		stats := NewConnectionStats(vhost, metrics.Prometheus{})
+		stats.now = func() time.Time { return now }
+		return stats, &now
+	}
+
+	newCreator := func() *creatorMock {
+		channel := new(channelMock)
+		channel.On("Close", nil).Return(nil)
+
+		creator := new(creatorMock)
+		creator.On("Channel", nil).Return(channel, nil)
+		return creator
+	}
+
+	t.Run("Should report a connection that was never established as closed", func(t *testing.T) {
+		stats, _ := newStats("never")
+
+		status := stats.Status()
+
+		assert.Equal(t, "never", status.VHost)
+		assert.Equal(t, ConnectionClosed, status.State)
+		assert.Nil(t, status.ConnectedSince)
+		assert.Equal(t, "0s", status.Uptime)
+		assert.Nil(t, status.LastReconnect)
+	})
+
+	t.Run("Should report the uptime of an established connection", func(t *testing.T) {
+		stats, now := newStats("uptime")
+
+		stats.Connected()
+		*now = start.Add(90 * time.Second)
+		status := stats.Status()
+
+		assert.Equal(t, ConnectionConnected, status.State)
+		assert.Equal(t, start, *status.ConnectedSince)
+		assert.Equal(t, "1m30s", status.Uptime)
+		assert.Equal(t, 1.0, testutil.ToFloat64(metrics.AMQPConnections.WithLabelValues("uptime")))
+	})
+
+	t.Run("Should count the open channels", func(t *testing.T) {
+		stats, _ := newStats("channels")
+		stats.Connected()
+		creator := stats.Track(newCreator())
+
+		first, _ := creator.Channel()
+		second, _ := creator.Channel()
+		assert.Equal(t, 2, stats.Status().Channels)
+		assert.Equal(t, 2.0, testutil.ToFloat64(metrics.AMQPChannels.WithLabelValues("channels")))
+
+		_ = first.Close()
+		_ = first.Close()
+		assert.Equal(t, 1, stats.Status().Channels, "should count repeated closes once")
+
+		_ = second.Close()
+		assert.Equal(t, 0, stats.Status().Channels)
+		assert.Equal(t, 0.0, testutil.ToFloat64(metrics.AMQPChannels.WithLabelValues("channels")))
+	})
+
+	t.Run("Should count a reconnect alongside its reason", func(t *testing.T) {
+		stats, now := newStats("reconnect")
+		before := testutil.ToFloat64(metrics.AMQPReconnects.WithLabelValues("reconnect"))
+		stats.Connected()
+		stale, _ := stats.Track(newCreator()).Channel()
+
+		*now = start.Add(time.Minute)
+		stats.Reconnecting("CONNECTION_FORCED")
+		status := stats.Status()
+
+		assert.Equal(t, ConnectionReconnecting, status.State)
+		assert.Equal(t, 1, status.Reconnects)
+		assert.Equal(t, start.Add(time.Minute), *status.LastReconnect)
+		assert.Equal(t, "CONNECTION_FORCED", status.LastReconnectReason)
+		assert.Zero(t, status.Channels, "should drop the channels of the lost connection")
+		assert.Equal(t, before+1, testutil.ToFloat64(metrics.AMQPReconnects.WithLabelValues("reconnect")))
+		assert.Equal(t, 0.0, testutil.ToFloat64(metrics.AMQPConnections.WithLabelValues("reconnect")))
+
+		*now = start.Add(2 * time.Minute)
+		stats.Connected()
+		_, _ = stats.Track(newCreator()).Channel()
+		_ = stale.Close()
+		status = stats.Status()
+
+		assert.Equal(t, ConnectionConnected, status.State)
+		assert.Equal(t, start.Add(2*time.Minute), *status.ConnectedSince)
+		assert.Equal(t, 1, status.Channels, "should not uncount channels of the lost connection")
+		assert.Equal(t, "CONNECTION_FORCED", status.LastReconnectReason, "should keep the reason of the last reconnect")
+	})
+
+	t.Run("Should record nothing without stats", func(t *testing.T) {
+		var stats *ConnectionStats
+		creator := newCreator()
+
+		stats.Connected()
+		stats.Reconnecting("CONNECTION_FORCED")
+
+		assert.Equal(t, creator, stats.Track(creator))
+		assert.Equal(t, ConnectionClosed, stats.Status().State)
+	})
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"sync"
+	"time"
+)
+
+// Consumer states reported by ConsumerActivity
+const (
+	ConsumerActive = "active"
+	ConsumerIdle   = "idle"
+)
+
+// activityBuckets the window is divided into for counting the recent deliveries
+const activityBuckets = 60
+
+// ConsumerStatus describes whether the consumer is receiving deliveries, e.g. to tell the active replica apart from
+// the standby ones when running with consumer priorities
+type ConsumerStatus struct {
+	State            string     `json:"state"`
+	Active           bool       `json:"active"`
+	ConsumerPriority int        `json:"consumer_priority"`
+	LastDelivery     *time.Time `json:"last_delivery,omitempty"`
+	Deliveries       uint64     `json:"deliveries"`
+	RecentDeliveries uint64     `json:"recent_deliveries"`
+	Window           string     `json:"window"`
+	Throughput       float64    `json:"throughput_per_second"`
+}
+
+// ConsumerActivity counts the deliveries received by the consumers of a connector. It is shared by all exchanges
+// and kept across reconnects. The consumer is active if it received a delivery within the window, otherwise idle.
+type ConsumerActivity struct {
+	window   time.Duration
+	priority int
+	now      func() time.Time
+
+	lock         sync.Mutex
+	total        uint64
+	lastDelivery time.Time
+	buckets      [activityBuckets]uint64
+	// slots holds the index of the slice of time every bucket counts, which expires buckets of earlier windows
+	slots [activityBuckets]int64
+}
+
+// NewConsumerActivity creates a new activity tracker, reporting the provided consumer priority. A window below a
+// second falls back to a minute.
+func NewConsumerActivity(window time.Duration, priority int) *ConsumerActivity {
+	if window < time.Second {
+		window = time.Minute
+	}
+
+	return &ConsumerActivity{window: window, priority: priority, now: time.Now}
+}
+
+// Record counts a received delivery
+func (a *ConsumerActivity) Record() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := a.now()
+	slot := a.slot(now)
+	index := slot % activityBuckets
+	if a.slots[index] != slot {
+		a.slots[index] = slot
+		a.buckets[index] = 0
+	}
+
+	a.buckets[index]++
+	a.total++
+	a.lastDelivery = now
+}
+
+// Status reports whether deliveries were received within the window and how many
+func (a *ConsumerActivity) Status() ConsumerStatus {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := a.now()
+	current := a.slot(now)
+
+	var recent uint64
+	for index, slot := range a.slots {
+		if slot > current-activityBuckets && slot <= current {
+			recent += a.buckets[index]
+		}
+	}
+
+	status := ConsumerStatus{
+		State:            ConsumerIdle,
+		ConsumerPriority: a.priority,
+		Deliveries:       a.total,
+		RecentDeliveries: recent,
+		Window:           a.window.String(),
+		Throughput:       float64(recent) / a.window.Seconds(),
+	}
+
+	if !a.lastDelivery.IsZero() {
+		last := a.lastDelivery.UTC()
+		status.LastDelivery = &last
+		if now.Sub(a.lastDelivery) < a.window {
+			status.State = ConsumerActive
+			status.Active = true
+		}
+	}
+
+	return status
+}
+
+func (a *ConsumerActivity) slot(now time.Time) int64 {
+	return now.UnixNano() / int64(a.window/activityBuckets)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumerActivity(t *testing.T) {
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	newActivity := func(priority int) (*ConsumerActivity, *time.Time) {
+		now := start
+		activity := NewConsumerActivity(time.Minute, priority)
+		activity.now = func() time.Time { return now }
+		return activity, &now
+	}
+
+	t.Run("Should report a replica without deliveries as idle", func(t *testing.T) {
+		activity, _ := newActivity(5)
+
+		status := activity.Status()
+
+		assert.Equal(t, ConsumerIdle, status.State)
+		assert.False(t, status.Active)
+		assert.Equal(t, 5, status.ConsumerPriority)
+		assert.Nil(t, status.LastDelivery)
+		assert.Zero(t, status.Deliveries)
+		assert.Zero(t, status.Throughput)
+	})
+
+	t.Run("Should report a replica with recent deliveries as active", func(t *testing.T) {
+		activity, now := newActivity(10)
+
+		for i := 0; i < 30; i++ {
+			activity.Record()
+			*now = now.Add(time.Second)
+		}
+		status := activity.Status()
+
+		assert.Equal(t, ConsumerActive, status.State)
+		assert.True(t, status.Active)
+		assert.Equal(t, 10, status.ConsumerPriority)
+		assert.Equal(t, start.Add(29*time.Second), *status.LastDelivery)
+		assert.Equal(t, uint64(30), status.Deliveries)
+		assert.Equal(t, uint64(30), status.RecentDeliveries)
+		assert.Equal(t, 0.5, status.Throughput)
+	})
+
+	t.Run("Should report a replica as idle once the deliveries fall out of the window", func(t *testing.T) {
+		activity, now := newActivity(0)
+
+		activity.Record()
+		activity.Record()
+		*now = now.Add(30 * time.Second)
+		activity.Record()
+
+		*now = now.Add(45 * time.Second)
+		status := activity.Status()
+		assert.Equal(t, ConsumerActive, status.State)
+		assert.Equal(t, uint64(1), status.RecentDeliveries, "Expected the first deliveries to be expired")
+
+		*now = now.Add(15 * time.Second)
+		status = activity.Status()
+		assert.Equal(t, ConsumerIdle, status.State)
+		assert.Equal(t, uint64(3), status.Deliveries)
+		assert.Zero(t, status.RecentDeliveries)
+		assert.NotNil(t, status.LastDelivery)
+	})
+
+	t.Run("Should fall back to a minute for invalid windows", func(t *testing.T) {
+		assert.Equal(t, "1m0s", NewConsumerActivity(0, 0).Status().Window)
+	})
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// DeadlineHeader holds the RFC3339 timestamp after which the data of a delivery is expired
+const DeadlineHeader = "x-deadline"
+
+// Deadline returns the deadline of the delivery, it is zero if the header is absent or malformed. In the
+// latter case the invocation falls back to the invoke timeout.
+func Deadline(delivery amqp.Delivery) time.Time {
+	var raw string
+	switch value := delivery.Headers[DeadlineHeader].(type) {
+	case nil:
+		return time.Time{}
+	case string:
+		raw = value
+	case []byte:
+		raw = string(value)
+	default:
+		log.Printf("Ignoring header %s of delivery %d, as %v is not a RFC3339 timestamp", DeadlineHeader, delivery.DeliveryTag, value)
+		return time.Time{}
+	}
+
+	deadline, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		log.Printf("Ignoring header %s of delivery %d, as %s is not a RFC3339 timestamp", DeadlineHeader, delivery.DeliveryTag, raw)
+		return time.Time{}
+	}
+	return deadline
+}
+
+// MessageTTLArgument is the queue argument holding the TTL of its messages in milliseconds
+const MessageTTLArgument = "x-message-ttl"
+
+// Expiry returns when the delivery expires by the smaller of its expiration and the TTL of its queue, it is zero if
+// neither is known. As RabbitMQ does not pass on when a message was enqueued, the TTL is counted from the timestamp of
+// the message or, if absent, from now, which is the upper bound. A TTL of 0 is ignored, as such messages are only
+// delivered to a consumer that is ready right away, just like a malformed expiration.
+func Expiry(delivery amqp.Delivery, queueTTL time.Duration) time.Time {
+	ttl := queueTTL
+	if len(delivery.Expiration) > 0 {
+		expiration, err := strconv.ParseInt(delivery.Expiration, 10, 64)
+		if err != nil || expiration < 0 {
+			log.Printf("Ignoring expiration %s of delivery %d, as it is not a number of milliseconds", delivery.Expiration, delivery.DeliveryTag)
+		} else if messageTTL := time.Duration(expiration) * time.Millisecond; messageTTL > 0 && (ttl <= 0 || messageTTL < ttl) {
+			ttl = messageTTL
+		}
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+
+	enqueued := delivery.Timestamp
+	if enqueued.IsZero() {
+		enqueued = time.Now()
+	}
+	return enqueued.Add(ttl)
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadline(t *testing.T) {
+	t.Run("Should parse the deadline header", func(t *testing.T) {
+		expected := time.Date(2021, 6, 1, 12, 30, 0, 0, time.UTC)
+
+		assert.True(t, expected.Equal(Deadline(amqp.Delivery{Headers: amqp.Table{DeadlineHeader: "2021-06-01T12:30:00Z"}})))
+		assert.True(t, expected.Equal(Deadline(amqp.Delivery{Headers: amqp.Table{DeadlineHeader: []byte("2021-06-01T14:30:00+02:00")}})))
+	})
+
+	t.Run("Should return no deadline if the header is absent", func(t *testing.T) {
+		assert.True(t, Deadline(amqp.Delivery{}).IsZero())
+	})
+
+	t.Run("Should return no deadline if the header is malformed", func(t *testing.T) {
+		assert.True(t, Deadline(amqp.Delivery{Headers: amqp.Table{DeadlineHeader: "tomorrow"}}).IsZero())
+		assert.True(t, Deadline(amqp.Delivery{Headers: amqp.Table{DeadlineHeader: int64(1622550600)}}).IsZero())
+	})
+}
+
+func TestExpiry(t *testing.T) {
+	published := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Should count the expiration of the message from its timestamp", func(t *testing.T) {
+		expiry := Expiry(amqp.Delivery{Expiration: "5000", Timestamp: published}, 0)
+
+		assert.True(t, published.Add(5*time.Second).Equal(expiry))
+	})
+
+	t.Run("Should count the ttl of the queue from its timestamp", func(t *testing.T) {
+		expiry := Expiry(amqp.Delivery{Timestamp: published}, time.Minute)
+
+		assert.True(t, published.Add(time.Minute).Equal(expiry))
+	})
+
+	t.Run("Should use the smaller of the expiration and the ttl of the queue", func(t *testing.T) {
+		assert.True(t, published.Add(5*time.Second).Equal(Expiry(amqp.Delivery{Expiration: "5000", Timestamp: published}, time.Minute)))
+		assert.True(t, published.Add(time.Second).Equal(Expiry(amqp.Delivery{Expiration: "5000", Timestamp: published}, time.Second)))
+	})
+
+	t.Run("Should count from now without timestamp", func(t *testing.T) {
+		before := time.Now()
+		expiry := Expiry(amqp.Delivery{Expiration: "5000"}, 0)
+
+		assert.False(t, expiry.Before(before.Add(5*time.Second)))
+		assert.False(t, expiry.After(time.Now().Add(5*time.Second)))
+	})
+
+	t.Run("Should return no expiry without ttl", func(t *testing.T) {
+		assert.True(t, Expiry(amqp.Delivery{Timestamp: published}, 0).IsZero())
+		assert.True(t, Expiry(amqp.Delivery{Expiration: "0", Timestamp: published}, 0).IsZero())
+	})
+
+	t.Run("Should ignore a malformed expiration", func(t *testing.T) {
+		assert.True(t, Expiry(amqp.Delivery{Expiration: "soon", Timestamp: published}, 0).IsZero())
+		assert.True(t, published.Add(time.Minute).Equal(Expiry(amqp.Delivery{Expiration: "-1", Timestamp: published}, time.Minute)))
+	})
+}
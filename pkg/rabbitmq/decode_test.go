@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"testing"
+
+	"github.com/Templum/rabbitmq-connector/pkg/decoder"
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// decoderStub exposes the region of the known bodies and fails for every other body
+type decoderStub map[string]string
+
+func (d decoderStub) Decode(body []byte) (map[string]string, error) {
+	if region, ok := d[string(body)]; ok {
+		return map[string]string{"x-region": region}, nil
+	}
+	return nil, &decoder.DecodeError{Message: "shop.v1.Order", Reason: "unexpected EOF"}
+}
+
+func TestExchange_Decode(t *testing.T) {
+	definition := types.Exchange{Name: "Nasdaq", Topics: []string{"Orders"}}
+	decoders := map[string]decoder.Decoder{"Orders": decoderStub{"\x12\x06\x0a\x04emea": "emea"}}
+
+	t.Run("Should route by the decoded fields while invoking the original body", func(t *testing.T) {
+		body := []byte("\x12\x06\x0a\x04emea")
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "emea", mock.MatchedBy(func(invocation *types.OpenFaaSInvocation) bool {
+			return string(*invocation.Message) == string(body)
+		})).Return([]types.InvocationResult{}, nil)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		target := Exchange{client: invoker, definition: &definition, decoders: decoders, extractor: &HeaderExtractor{name: "x-region"}}
+
+		headers := amqp.Table{"x-origin": "shop"}
+		target.handleInvocation("Orders", amqp.Delivery{Acknowledger: acker, RoutingKey: "Orders", Headers: headers, Body: body})
+
+		invoker.AssertExpectations(t)
+		acker.AssertExpectations(t)
+		assert.Equal(t, amqp.Table{"x-origin": "shop"}, headers, "Expected the headers of the delivery to be copied")
+	})
+
+	t.Run("Should quarantine deliveries that can not be decoded without invoking them", func(t *testing.T) {
+		invoker := new(invokerMock)
+
+		channel := new(channelMock)
+		channel.On("Publish", "quarantine", "Orders", false, false, mock.MatchedBy(func(msg amqp.Publishing) bool {
+			return msg.Headers[FailureHeader] == "message can not be decoded as shop.v1.Order: unexpected EOF"
+		})).Return(nil)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		target := Exchange{channel: channel, client: invoker, definition: &definition, decoders: decoders, quarantineExchange: "quarantine", extractor: &HeaderExtractor{name: "x-region"}}
+
+		target.handleInvocation("Orders", amqp.Delivery{Acknowledger: acker, RoutingKey: "Orders", Body: []byte("garbage")})
+
+		invoker.AssertNotCalled(t, "Invoke", mock.Anything, mock.Anything)
+		channel.AssertExpectations(t)
+		acker.AssertExpectations(t)
+	})
+
+	t.Run("Should reject deliveries that can not be decoded without requeue if no quarantine exchange is set", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.RejectedMessages.WithLabelValues("Orders"))
+		invoker := new(invokerMock)
+
+		acker := new(acknowledgerMock)
+		acker.On("Nack", mock.Anything, false, false).Return(nil)
+
+		target := Exchange{channel: new(channelMock), client: invoker, definition: &definition, decoders: decoders, extractor: &HeaderExtractor{name: "x-region"}}
+
+		target.handleInvocation("Orders", amqp.Delivery{Acknowledger: acker, RoutingKey: "Orders", Body: []byte("garbage")})
+
+		invoker.AssertNotCalled(t, "Invoke", mock.Anything, mock.Anything)
+		acker.AssertExpectations(t)
+		acker.AssertNotCalled(t, "Nack", mock.Anything, false, true)
+		assert.Equal(t, before+1, testutil.ToFloat64(metrics.RejectedMessages.WithLabelValues("Orders")))
+	})
+
+	t.Run("Should not decode deliveries of topics without decoder", func(t *testing.T) {
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, nil)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		target := Exchange{client: invoker, definition: &definition, decoders: decoders}
+
+		target.handleInvocation("Billing", amqp.Delivery{Acknowledger: acker, RoutingKey: "Billing", Body: []byte("garbage")})
+
+		invoker.AssertExpectations(t)
+	})
+}
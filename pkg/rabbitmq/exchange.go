@@ -6,11 +6,16 @@
 package rabbitmq
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/Templum/rabbitmq-connector/pkg/backoff"
+	"github.com/Templum/rabbitmq-connector/pkg/decoder"
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
 	"github.com/Templum/rabbitmq-connector/pkg/types"
 	"github.com/streadway/amqp"
 )
@@ -31,23 +36,172 @@ type ExchangeOrganizer interface {
 	Stopper
 }
 
+// TopicReconciler consumes a set of topics in addition to the ones of the exchange definition
+type TopicReconciler interface {
+	Reconcile(topics []string) error
+}
+
+// Reconfigurer replaces the definition of a running exchange without reconnecting, see Exchange.Reconfigure
+type Reconfigurer interface {
+	Reconfigure(definition *types.Exchange) error
+}
+
+// Drainer stops consuming new deliveries of a running exchange, while the in-flight ones are finished
+type Drainer interface {
+	Drain()
+}
+
+// CapacityGate applies back-pressure by blocking until further deliveries may be invoked
+type CapacityGate interface {
+	AwaitCapacity()
+}
+
 // Exchange contains all of the relevant units to handle communication with an exchange
 type Exchange struct {
-	channel ChannelConsumer
-	client  types.Invoker
+	channel   RabbitChannel
+	creator   ChannelCreator
+	client    types.Invoker
+	reporter  StatusReporter
+	extractor TopicExtractor
+	affinity  TopicExtractor
+	gate      CapacityGate
+	limiter   *MessageLimiter
+	ranks     map[string]int
+	activity  *ConsumerActivity
+	inFlight  *InFlightDeliveries
+	decoders  map[string]decoder.Decoder
+	archiver  MessageArchiver
+	transform *PayloadTransform
+	metrics   metrics.Sink
+	replies   bool
+
+	checkpoints *StreamCheckpoints
+	// recent keeps the last processed deliveries of every topic, if configured
+	recent *RecentMessages
+	// priorityDispatch dispatches the buffered deliveries highest priority first, see consumeByPriority
+	priorityDispatch bool
+
+	maxDeliveryAttempts int
+	quarantineExchange  string
+	deadLetterExchange  string
+	retryDelayExchange  string
+	retryBackoff        backoff.Config
+	consumerPriority    int
+	batcher             *ackBatcher
+
+	// desired topics are consumed once started, dynamic contains the ones that are currently consumed
+	desired []string
+	dynamic map[string]struct{}
+	started bool
+
+	// generation is increased by every reconfiguration, consumers of a previous generation no longer invoke deliveries
+	generation int
+	inflight   sync.WaitGroup
 
 	definition *types.Exchange
 	lock       sync.RWMutex
 }
 
+// ExchangeOptions contains the optional behaviour of an exchange
+type ExchangeOptions struct {
+	// Reporter receives the outcome of every invocation if present
+	Reporter StatusReporter
+	// Extractor determines the topic used for invocation, if absent the routing key is used
+	Extractor TopicExtractor
+	// Affinity extracts the key whose hash is passed on as X-Hash-Key, which pins the messages of a key to a replica
+	Affinity TopicExtractor
+	// Gate is awaited before a delivery is invoked, which pauses consumption while it blocks
+	Gate CapacityGate
+	// MaxDeliveryAttempts after which a failing delivery is dropped, 0 requeues failing deliveries forever
+	MaxDeliveryAttempts int
+	// QuarantineExchange receives deliveries that failed with a non-retryable error, if absent they are retried
+	QuarantineExchange string
+	// DeadLetterExchange receives deliveries that exceeded the MaxDeliveryAttempts, if absent they are dropped
+	DeadLetterExchange string
+	// RetryDelayExchange is a delayed message exchange, which receives the retries of failed deliveries delayed by the
+	// RetryBackoff. If absent they are retried right away.
+	RetryDelayExchange string
+	RetryBackoff       backoff.Config
+	// ConsumerPriority is passed as x-priority, consumers with a higher priority receive deliveries first
+	ConsumerPriority int
+	// AckBatchSize of deliveries that are acknowledged together, values below 2 acknowledge every delivery individually
+	AckBatchSize int
+	// AckFlushInterval after which a partial batch is acknowledged
+	AckFlushInterval time.Duration
+	// Creator opens the channel that replaces the current one during Reconfigure
+	Creator ChannelCreator
+	// Limiter caps the deliveries that are invoked at once, it is usually shared by all exchanges
+	Limiter *MessageLimiter
+	// QueuePriorities lists queues highest priority first, their deliveries are handed the slots of the Limiter first
+	QueuePriorities []string
+	// Activity counts the received deliveries, it is usually shared by all exchanges
+	Activity *ConsumerActivity
+	// InFlight tracks the invoked deliveries, so that they can be requeued with a delay during shutdown
+	InFlight *InFlightDeliveries
+	// Decoders expose fields of the binary deliveries of their topic as headers, before the topic is extracted
+	Decoders map[string]decoder.Decoder
+	// Metrics records the instrumentation of the exchange, if absent Prometheus is used
+	Metrics metrics.Sink
+	// Archiver receives every delivery before it is invoked, it must not block, see AsyncArchiver
+	Archiver MessageArchiver
+	// Transform is applied to the payload of every delivery after it was archived and before it is invoked
+	Transform *PayloadTransform
+	// Replies publishes the responses of deliveries with reply_to onto that queue, see Exchange.reply
+	Replies bool
+	// Checkpoints commit the offsets of acknowledged deliveries of stream queues, which are resumed after the
+	// committed offset. If absent stream queues are consumed from the next message on.
+	Checkpoints *StreamCheckpoints
+	// PriorityDispatch invokes the deliveries waiting for the Gate or the Limiter highest AMQP priority first,
+	// deliveries of the same priority are invoked in order
+	PriorityDispatch bool
+	// Recent records the metadata and outcome of every invoked delivery, which is served for debugging
+	Recent *RecentMessages
+}
+
 // MaxAttempts of retries that will be performed
 const MaxAttempts = 3
 
+// acknowledgeBackoff delays the retries of failed acks, nacks and rejects
+var acknowledgeBackoff = backoff.Config{Base: 250 * time.Millisecond, Max: time.Second, Multiplier: 2, Jitter: backoff.JitterFull}
+
 // NewExchange creates a new exchange instance using the provided parameter
-func NewExchange(channel ChannelConsumer, client types.Invoker, definition *types.Exchange) ExchangeOrganizer {
+func NewExchange(channel RabbitChannel, client types.Invoker, definition *types.Exchange, options ExchangeOptions) ExchangeOrganizer {
+	var batcher *ackBatcher
+	if options.AckBatchSize > 1 {
+		batcher = newAckBatcher(options.AckBatchSize, options.AckFlushInterval)
+	}
+
 	return &Exchange{
-		channel: channel,
-		client:  client,
+		channel:   channel,
+		creator:   options.Creator,
+		client:    client,
+		reporter:  options.Reporter,
+		extractor: options.Extractor,
+		affinity:  options.Affinity,
+		gate:      options.Gate,
+		limiter:   options.Limiter,
+		ranks:     queueRanks(options.QueuePriorities),
+		activity:  options.Activity,
+		inFlight:  options.InFlight,
+		decoders:  options.Decoders,
+		archiver:  options.Archiver,
+		transform: options.Transform,
+		metrics:   options.Metrics,
+		replies:   options.Replies,
+
+		checkpoints:      options.Checkpoints,
+		recent:           options.Recent,
+		priorityDispatch: options.PriorityDispatch,
+
+		maxDeliveryAttempts: options.MaxDeliveryAttempts,
+		quarantineExchange:  options.QuarantineExchange,
+		deadLetterExchange:  options.DeadLetterExchange,
+		retryDelayExchange:  options.RetryDelayExchange,
+		retryBackoff:        options.RetryBackoff,
+		consumerPriority:    options.ConsumerPriority,
+		batcher:             batcher,
+
+		dynamic: map[string]struct{}{},
 
 		definition: definition,
 		lock:       sync.RWMutex{},
@@ -60,34 +214,251 @@ func (e *Exchange) Start() error {
 	e.lock.Lock()
 	defer e.lock.Unlock()
 
+	return e.start()
+}
+
+func (e *Exchange) start() error {
 	closeChannel := make(chan *amqp.Error)
 	e.channel.NotifyClose(closeChannel)
 	go e.handleChanFailure(closeChannel)
 
+	if e.batcher != nil {
+		e.batcher.Start()
+	}
+	if e.definition.Stream {
+		if err := e.channel.Qos(streamPrefetchCount, 0, false); err != nil {
+			return err
+		}
+	}
+
+	if err := e.declareRetryDelay(); err != nil {
+		return err
+	}
+
+	for _, topic := range e.definition.Topics {
+		// The queue name doubles as consumer tag, which allows cancelling the consumer during Drain
+		queueName := GenerateQueueName(e.definition.Name, topic)
+		if err := e.bindRetryDelay(queueName); err != nil {
+			return err
+		}
+		deliveries, err := e.channel.Consume(queueName, queueName, false, false, false, false, e.consumeArgs(queueName))
+		if err != nil {
+			return err
+		}
+
+		go e.StartConsuming(topic, deliveries)
+	}
+
+	e.started = true
+	return e.reconcile()
+}
+
+// Reconfigure replaces the definition of the exchange. It stops invoking new deliveries and waits for the in-flight
+// invocations to finish, before the channel is replaced by a new one of the same connection. Deliveries received
+// but not yet invoked are requeued by RabbitMQ, once the previous channel is closed. On the new channel the topology
+// is declared and the bindings of removed topics are deleted, afterwards the topics are consumed again if the exchange
+// was started. Reconfigure is serialized with the other operations of the exchange. If it fails, the exchange does
+// not consume until it is reconfigured successfully.
+func (e *Exchange) Reconfigure(definition *types.Exchange) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.creator == nil {
+		return fmt.Errorf("exchange %s can not be reconfigured without a channel creator", e.definition.Name)
+	}
+	definition.EnsureCorrectType()
+
+	log.Printf("Reconfiguring exchange %s, waiting for in-flight invocations", e.definition.Name)
+	e.generation++
+	e.inflight.Wait()
+
+	if e.batcher != nil {
+		e.batcher.Stop()
+		e.batcher.reset()
+	}
+	_ = e.channel.Close()
+
+	channel, err := e.creator.Channel()
+	if err != nil {
+		return err
+	}
+	e.channel = channel
+	e.dynamic = map[string]struct{}{}
+	e.sink().IncConsumerReconfigures()
+
+	if err := declareTopology(channel, definition); err != nil {
+		return err
+	}
+	for _, topic := range removedTopics(e.definition, definition) {
+		if err := channel.QueueUnbind(GenerateQueueName(e.definition.Name, topic), topic, e.definition.Name, amqp.Table{}); err != nil {
+			return err
+		}
+		log.Printf("Removed binding of topic %s from exchange %s", topic, e.definition.Name)
+	}
+	e.definition = definition
+
+	if !e.started {
+		return nil
+	}
+	return e.start()
+}
+
+// Drain cancels the consumers of the exchange, so that RabbitMQ delivers to the other consumers of its queues, and
+// waits for the in-flight invocations to be acknowledged. Unlike on Reconfigure the channel is kept open, deliveries
+// that were received but not yet invoked are requeued once it is closed by Stop. A drained exchange does not consume
+// again, unless it is started.
+func (e *Exchange) Drain() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if !e.started {
+		return
+	}
+
+	log.Printf("Draining exchange %s, waiting for in-flight invocations", e.definition.Name)
+	e.generation++
+	e.started = false
+
+	topics := make([]string, 0, len(e.definition.Topics)+len(e.dynamic))
+	topics = append(topics, e.definition.Topics...)
+	for topic := range e.dynamic {
+		topics = append(topics, topic)
+	}
+	for _, topic := range topics {
+		queueName := GenerateQueueName(e.definition.Name, topic)
+		if err := e.channel.Cancel(queueName, false); err != nil {
+			log.Printf("Failed to cancel consumer %s due to %s", queueName, err)
+		}
+	}
+	e.dynamic = map[string]struct{}{}
+
+	e.inflight.Wait()
+	if e.batcher != nil {
+		e.batcher.Stop()
+	}
+	log.Printf("Drained exchange %s", e.definition.Name)
+}
+
+// removedTopics returns the topics of the previous definition, that are not bound by the current one
+func removedTopics(previous *types.Exchange, current *types.Exchange) []string {
+	if previous.Name != current.Name {
+		return previous.Topics
+	}
+
+	kept := make(map[string]struct{}, len(current.Topics))
+	for _, topic := range current.Topics {
+		kept[topic] = struct{}{}
+	}
+
+	var removed []string
+	for _, topic := range previous.Topics {
+		if _, exists := kept[topic]; !exists {
+			removed = append(removed, topic)
+		}
+	}
+	return removed
+}
+
+// Reconcile declares, binds and consumes a queue for every provided topic, that is not part of the definition.
+// Topics consumed by a previous call, but no longer provided, have their consumer cancelled and binding removed.
+// The queues themselves are kept, so that deliveries which are still in it are not lost. Before the exchange is
+// started the topics are only memorized.
+func (e *Exchange) Reconcile(topics []string) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.desired = topics
+	if !e.started {
+		return nil
+	}
+	return e.reconcile()
+}
+
+func (e *Exchange) reconcile() error {
+	desired := make(map[string]struct{}, len(e.desired))
+	for _, topic := range e.desired {
+		desired[topic] = struct{}{}
+	}
 	for _, topic := range e.definition.Topics {
+		delete(desired, topic)
+	}
+
+	for topic := range e.dynamic {
+		if _, exists := desired[topic]; exists {
+			continue
+		}
+
+		queueName := GenerateQueueName(e.definition.Name, topic)
+		if err := e.channel.Cancel(queueName, false); err != nil {
+			return err
+		}
+		if err := e.channel.QueueUnbind(queueName, topic, e.definition.Name, amqp.Table{}); err != nil {
+			return err
+		}
+
+		delete(e.dynamic, topic)
+		log.Printf("Stopped consuming topic %s of exchange %s", topic, e.definition.Name)
+	}
+
+	for topic := range desired {
+		if _, exists := e.dynamic[topic]; exists {
+			continue
+		}
+
+		if err := declareQueue(e.channel, e.definition, topic); err != nil {
+			return err
+		}
+
+		// The queue name doubles as consumer tag, which allows cancelling the consumer once the topic is gone
 		queueName := GenerateQueueName(e.definition.Name, topic)
-		deliveries, err := e.channel.Consume(queueName, "", false, false, false, false, amqp.Table{})
+		if err := e.bindRetryDelay(queueName); err != nil {
+			return err
+		}
+		deliveries, err := e.channel.Consume(queueName, queueName, false, false, false, false, e.consumeArgs(queueName))
 		if err != nil {
 			return err
 		}
 
+		e.dynamic[topic] = struct{}{}
 		go e.StartConsuming(topic, deliveries)
+		log.Printf("Started consuming topic %s of exchange %s", topic, e.definition.Name)
 	}
 
 	return nil
 }
 
+// consumeArgs returns the consumer arguments of the queue, which carry the optional consumer priority and the offset
+// a stream queue is resumed at
+func (e *Exchange) consumeArgs(queueName string) amqp.Table {
+	args := amqp.Table{}
+	if e.consumerPriority != 0 {
+		args["x-priority"] = int32(e.consumerPriority)
+	}
+	if e.definition.Stream {
+		args[StreamOffsetArgument] = e.checkpoints.Resume(queueName)
+	}
+	return args
+}
+
 // Stop s consuming messages
 func (e *Exchange) Stop() {
 	e.lock.Lock()
 	defer e.lock.Unlock()
 
+	if e.batcher != nil {
+		e.batcher.Stop()
+	}
+
 	// We ignore the issue since this method is usually called after connection failure.
 	_ = e.channel.Close()
 }
 
 func (e *Exchange) handleChanFailure(ch <-chan *amqp.Error) {
-	err := <-ch
+	err, ok := <-ch
+	if !ok {
+		// The channel was closed on purpose
+		return
+	}
 	log.Printf("Received following error %s on channel for exchange %s", err, e.definition.Name)
 }
 
@@ -95,58 +466,406 @@ func (e *Exchange) handleChanFailure(ch <-chan *amqp.Error) {
 // is for the target topic it will invoke it. If the delivery is not for the correct topic it will
 // reject it so that the delivery is returned to the exchange. Retries are exponential and up to 3 times.
 func (e *Exchange) StartConsuming(topic string, deliveries <-chan amqp.Delivery) {
+	e.lock.RLock()
+	generation := e.generation
+	rank := e.rank(topic)
+	e.lock.RUnlock()
+
+	if e.priorityDispatch {
+		e.consumeByPriority(generation, rank, topic, deliveries)
+		return
+	}
+
 	for delivery := range deliveries {
-		if topic == delivery.RoutingKey {
-			// TODO: Maybe we want to send the deliveries into a general queue
-			// https://medium.com/justforfunc/two-ways-of-merging-n-channels-in-go-43c0b57cd1de
-			bodyStr := strings.Replace(string(delivery.Body), "\n", "", -1) ;
-			log.Printf("Received body %s", bodyStr)
-			go e.handleInvocation(topic, delivery)
-		} else {
-			log.Printf("Received message for topic %s that did not match subscribed topic %s will reject it", delivery.RoutingKey, topic)
+		delivery = restoreRoutingKey(delivery)
 
-			for retry := 0; retry < MaxAttempts; retry++ {
-				err := delivery.Reject(true)
-				if err == nil {
+		if topic != delivery.RoutingKey {
+			if e.rejectForeign(topic, delivery) {
+				return
+			}
+			continue
+		}
+
+		e.received(delivery)
+		e.awaitSlot(rank)
+		if !e.dispatch(generation, topic, delivery) {
+			if e.limiter != nil {
+				e.limiter.Release()
+			}
+			// The exchange is reconfigured or drained, the delivery is requeued once the channel is closed
+			return
+		}
+	}
+}
+
+// consumeByPriority buffers the deliveries while they wait for the gate and a slot of the limiter, once one is free
+// the buffered delivery of the highest priority is dispatched
+func (e *Exchange) consumeByPriority(generation int, rank int, topic string, deliveries <-chan amqp.Delivery) {
+	buffer := newPriorityBuffer()
+	go func() {
+		defer buffer.Close()
+
+		for delivery := range deliveries {
+			delivery = restoreRoutingKey(delivery)
+
+			if topic != delivery.RoutingKey {
+				if e.rejectForeign(topic, delivery) {
 					return
 				}
+				continue
+			}
 
-				log.Printf("Failed to reject delivery %d due to %s. Attempt %d/3", delivery.DeliveryTag, err, retry+1)
-				time.Sleep(time.Duration(retry+1*250) * time.Millisecond)
+			e.received(delivery)
+			buffer.Push(delivery)
+		}
+	}()
+
+	for buffer.Wait() {
+		e.awaitSlot(rank)
+		if !e.dispatch(generation, topic, buffer.Pop()) {
+			if e.limiter != nil {
+				e.limiter.Release()
 			}
+			// The exchange is reconfigured or drained, the buffered deliveries are requeued once the channel is closed
+			return
+		}
+	}
+}
+
+// received records the arrival of a delivery for the topic
+func (e *Exchange) received(delivery amqp.Delivery) {
+	if e.activity != nil {
+		e.activity.Record()
+	}
+	if offset, ok := e.streamOffset(delivery); ok {
+		e.checkpoints.Delivered(delivery.ConsumerTag, offset)
+	}
+	// TODO: Maybe we want to send the deliveries into a general queue
+	// https://medium.com/justforfunc/two-ways-of-merging-n-channels-in-go-43c0b57cd1de
+	bodyStr := strings.Replace(string(delivery.Body), "\n", "", -1)
+	log.Printf("Received body %s", bodyStr)
+}
 
-			log.Printf("Failed to reject delivery %d, will abort reject now", delivery.DeliveryTag)
+// awaitSlot blocks until the gate and the limiter allow a further delivery of the rank to be invoked
+func (e *Exchange) awaitSlot(rank int) {
+	if e.gate != nil {
+		e.gate.AwaitCapacity()
+	}
+	if e.limiter != nil {
+		e.limiter.AcquireRank(rank)
+	}
+}
+
+// rejectForeign returns a delivery for another topic to the exchange, it reports whether the reject succeeded
+func (e *Exchange) rejectForeign(topic string, delivery amqp.Delivery) bool {
+	log.Printf("Received message for topic %s that did not match subscribed topic %s will reject it", delivery.RoutingKey, topic)
+
+	delays := backoff.New(acknowledgeBackoff)
+	for retry := 0; retry < MaxAttempts; retry++ {
+		err := delivery.Reject(true)
+		if err == nil {
+			if e.batcher != nil {
+				e.batcher.Settled(delivery)
+			}
+			return true
 		}
+
+		log.Printf("Failed to reject delivery %d due to %s. Attempt %d/3", delivery.DeliveryTag, err, retry+1)
+		time.Sleep(delays.Next())
+	}
+
+	log.Printf("Failed to reject delivery %d, will abort reject now", delivery.DeliveryTag)
+	return false
+}
+
+// queueRanks maps every queue to its position within the priorities, the first one is preferred
+func queueRanks(priorities []string) map[string]int {
+	ranks := make(map[string]int, len(priorities))
+	for rank, queue := range priorities {
+		ranks[queue] = rank
+	}
+	return ranks
+}
+
+// rank returns the rank of the queue of the topic, queues without a priority are Unprioritized
+func (e *Exchange) rank(topic string) int {
+	if rank, exists := e.ranks[GenerateQueueName(e.definition.Name, topic)]; exists {
+		return rank
+	}
+	return Unprioritized
+}
+
+// invoke passes the trace context of the delivery on, if the client supports it
+func (e *Exchange) invoke(delivery amqp.Delivery, invocation *types.OpenFaaSInvocation) ([]types.InvocationResult, error) {
+	if invoker, ok := e.client.(types.ContextInvoker); ok {
+		ctx := ContextFromDelivery(context.Background(), delivery)
+		return invoker.InvokeContext(ctx, invocation.Topic, invocation)
 	}
+	return e.client.Invoke(invocation.Topic, invocation)
+}
+
+// dispatch invokes the delivery in the background, unless the exchange was reconfigured or drained since the consumer started
+func (e *Exchange) dispatch(generation int, topic string, delivery amqp.Delivery) bool {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	if generation != e.generation {
+		return false
+	}
+
+	e.inflight.Add(1)
+	go func() {
+		defer e.inflight.Done()
+		e.handleInvocation(topic, delivery)
+		if e.limiter != nil {
+			e.limiter.Release()
+		}
+	}()
+	return true
 }
 
 func (e *Exchange) handleInvocation(topic string, delivery amqp.Delivery) {
+	delivery, decodeErr := e.decode(topic, delivery)
+	invocation := types.NewInvocation(delivery)
+	invocation.Topic = e.resolveTopic(topic, delivery)
+	invocation.Retries = RetryCount(delivery)
+	invocation.Deadline = Deadline(delivery)
+	invocation.Expiry = Expiry(delivery, e.queueTTL())
+	invocation.HashKey = e.hashKey(delivery)
+
+	if e.archiver != nil {
+		if err := e.archiver.Archive(NewArchivedMessage(invocation.Topic, delivery)); err != nil {
+			log.Printf("Skipped archiving delivery %d for topic %s due to %s", delivery.DeliveryTag, invocation.Topic, err)
+		}
+	}
+
+	if decodeErr != nil {
+		e.fail(topic, invocation.Topic, delivery, decodeErr)
+		return
+	}
+
+	if !invocation.Deadline.IsZero() && !time.Now().Before(invocation.Deadline) {
+		log.Printf("Skipping delivery %d for topic %s, as its deadline %s expired", delivery.DeliveryTag, invocation.Topic, invocation.Deadline.Format(time.RFC3339))
+		e.ack(delivery)
+		return
+	}
+	if !invocation.Expiry.IsZero() && !time.Now().Before(invocation.Expiry) {
+		log.Printf("Skipping delivery %d for topic %s, as its TTL expired at %s", delivery.DeliveryTag, invocation.Topic, invocation.Expiry.Format(time.RFC3339))
+		e.ack(delivery)
+		return
+	}
+
+	if e.transform != nil && invocation.Message != nil {
+		payload, ok := e.transform.Apply(invocation.Topic, *invocation.Message)
+		if !ok {
+			e.ack(delivery)
+			return
+		}
+		invocation.Message = &payload
+	}
+
 	// Call Function via Client
-	err := e.client.Invoke(topic, types.NewInvocation(delivery))
+	tracked := e.trackInFlight(topic, delivery)
+	results, err := e.invoke(delivery, invocation)
+	if e.reporter != nil {
+		e.reporter.Report(results)
+	}
+	e.recent.Record(invocation.Topic, delivery, results, err)
+	if !e.claimInFlight(tracked) {
+		log.Printf("Discarding outcome of delivery %d for topic %s, as it was handed over to the shutdown", delivery.DeliveryTag, invocation.Topic)
+		return
+	}
+
 	if err == nil {
-		for retry := 0; retry < MaxAttempts; retry++ {
-			ackErr := delivery.Ack(false)
-			if ackErr == nil {
-				return
-			}
+		if e.replies && len(delivery.ReplyTo) > 0 {
+			e.reply(delivery, results)
+		}
+		e.ack(delivery)
+		return
+	}
+
+	e.fail(topic, invocation.Topic, delivery, err)
+}
 
-			log.Printf("Failed to acknowledge delivery %d due to %s. Attempt %d/3", delivery.DeliveryTag, ackErr, retry+1)
-			time.Sleep(time.Duration(retry+1*250) * time.Millisecond)
+// fail quarantines deliveries that failed with a non-retryable error if configured, otherwise they are rejected
+// without requeue, as invoking them again cannot succeed. Deliveries that failed with other errors are retried.
+func (e *Exchange) fail(subscribed string, topic string, delivery amqp.Delivery, err error) {
+	if types.IsNonRetryable(err) {
+		if len(e.quarantineExchange) > 0 {
+			e.quarantine(topic, delivery, err)
+		} else {
+			e.reject(topic, delivery, err)
 		}
+		return
+	}
 
-		log.Printf("Failed to acknowledge delivery %d, will abort ack now", delivery.DeliveryTag)
-	} else {
-		for retry := 0; retry < MaxAttempts; retry++ {
-			nackErr := delivery.Nack(false, true)
-			if nackErr == nil {
-				return
+	if e.maxDeliveryAttempts > 0 {
+		e.retry(subscribed, topic, delivery, err)
+		return
+	}
+
+	e.nack(delivery)
+}
+
+// decode exposes the fields of the delivery as headers, if a decoder is registered for the subscribed topic. The
+// headers are copied, as the table may be shared with other copies of the delivery.
+func (e *Exchange) decode(subscribed string, delivery amqp.Delivery) (amqp.Delivery, error) {
+	dec, exists := e.decoders[subscribed]
+	if !exists {
+		return delivery, nil
+	}
+
+	fields, err := dec.Decode(delivery.Body)
+	if err != nil {
+		log.Printf("Failed to decode delivery %d for topic %s due to %s", delivery.DeliveryTag, subscribed, err)
+		return delivery, err
+	}
+
+	headers := make(amqp.Table, len(delivery.Headers)+len(fields))
+	for key, value := range delivery.Headers {
+		headers[key] = value
+	}
+	for key, value := range fields {
+		headers[key] = value
+	}
+	delivery.Headers = headers
+	return delivery, nil
+}
+
+// ack acknowledges the delivery. Deliveries of stream queues are acknowledged individually, as their offset is
+// committed only once the ack succeeded.
+func (e *Exchange) ack(delivery amqp.Delivery) {
+	offset, stream := e.streamOffset(delivery)
+	if e.batcher != nil && !stream {
+		e.batcher.Ack(delivery)
+		return
+	}
+
+	delays := backoff.New(acknowledgeBackoff)
+	for retry := 0; retry < MaxAttempts; retry++ {
+		ackErr := delivery.Ack(false)
+		if ackErr == nil {
+			if stream {
+				if e.batcher != nil {
+					e.batcher.Settled(delivery)
+				}
+				e.checkpoints.Acked(delivery.ConsumerTag, offset)
 			}
+			return
+		}
+
+		log.Printf("Failed to acknowledge delivery %d due to %s. Attempt %d/3", delivery.DeliveryTag, ackErr, retry+1)
+		time.Sleep(delays.Next())
+	}
 
-			log.Printf("Failed to nack delivery %d due to %s. Attempt %d/3", delivery.DeliveryTag, nackErr, retry+1)
-			time.Sleep(time.Duration(retry+1*250) * time.Millisecond)
+	log.Printf("Failed to acknowledge delivery %d, will abort ack now", delivery.DeliveryTag)
+}
+
+func (e *Exchange) nack(delivery amqp.Delivery) {
+	delays := backoff.New(acknowledgeBackoff)
+	for retry := 0; retry < MaxAttempts; retry++ {
+		nackErr := delivery.Nack(false, true)
+		if nackErr == nil {
+			if e.batcher != nil {
+				e.batcher.Settled(delivery)
+			}
+			return
 		}
 
-		log.Printf("Failed to nack delivery %d, will abort nack now", delivery.DeliveryTag)
+		log.Printf("Failed to nack delivery %d due to %s. Attempt %d/3", delivery.DeliveryTag, nackErr, retry+1)
+		time.Sleep(delays.Next())
 	}
 
+	log.Printf("Failed to nack delivery %d, will abort nack now", delivery.DeliveryTag)
+}
+
+// retry republishes a failed delivery onto its queue with an incremented retry header, instead of requeueing it.
+// If a retry delay exchange is configured, the retry is routed to the queue via it once the retry backoff elapsed.
+// Once the maximum delivery attempts are reached the delivery is dead-lettered if configured and dropped otherwise,
+// which prevents endless requeue loops.
+func (e *Exchange) retry(subscribed string, topic string, delivery amqp.Delivery, cause error) {
+	attempts := RetryCount(delivery) + 1
+	if attempts >= e.maxDeliveryAttempts && len(e.deadLetterExchange) > 0 {
+		e.deadLetter(topic, delivery, attempts, cause)
+		return
+	}
+	if attempts >= e.maxDeliveryAttempts {
+		log.Printf("WARNING: Dropping delivery %d for topic %s after %d failed delivery attempts", delivery.DeliveryTag, topic, attempts)
+		e.sink().IncDroppedPoison(topic)
+		e.ack(delivery)
+		return
+	}
+
+	queueName := GenerateQueueName(e.definition.Name, subscribed)
+	publishing := newRetryPublishing(delivery, attempts)
+	exchange := ""
+	if len(e.retryDelayExchange) > 0 {
+		exchange = e.retryDelayExchange
+		publishing.Headers[DelayHeader] = int32(e.retryDelay(attempts).Milliseconds())
+	}
+
+	err := e.channel.Publish(exchange, queueName, false, false, publishing)
+	if err != nil {
+		log.Printf("Failed to republish delivery %d onto queue %s due to %s, will requeue it instead", delivery.DeliveryTag, queueName, err)
+		e.nack(delivery)
+		return
+	}
+
+	e.ack(delivery)
+}
+
+// trackInFlight registers the delivery of the subscribed topic as in-flight, if the exchange tracks them
+func (e *Exchange) trackInFlight(subscribed string, delivery amqp.Delivery) uint64 {
+	if e.inFlight == nil {
+		return 0
+	}
+	return e.inFlight.track(e.channel, GenerateQueueName(e.definition.Name, subscribed), delivery, e.ack)
+}
+
+// claimInFlight returns whether the invocation settles the delivery, which is not the case once it was requeued
+func (e *Exchange) claimInFlight(id uint64) bool {
+	if e.inFlight == nil {
+		return true
+	}
+	return e.inFlight.claim(id)
+}
+
+// streamOffset returns the offset of a delivery from a stream queue of the exchange, whose consumer tag is the queue
+func (e *Exchange) streamOffset(delivery amqp.Delivery) (int64, bool) {
+	if e.definition == nil || !e.definition.Stream {
+		return 0, false
+	}
+	return StreamOffset(delivery)
+}
+
+// queueTTL returns the message TTL declared for the queues of the exchange, it is 0 if none is declared
+func (e *Exchange) queueTTL() time.Duration {
+	if e.definition == nil {
+		return 0
+	}
+	return time.Duration(e.definition.MessageTTL) * time.Millisecond
+}
+
+// resolveTopic determines the topic used for invocation using the configured extractor. Deliveries
+// that do not contain a topic, follow the default path and use the subscribed topic.
+func (e *Exchange) resolveTopic(subscribed string, delivery amqp.Delivery) string {
+	if e.extractor == nil {
+		return subscribed
+	}
+
+	topic, ok := e.extractor.Extract(delivery)
+	if !ok {
+		log.Printf("Could not determine topic of delivery %d, will fallback to %s", delivery.DeliveryTag, subscribed)
+		return subscribed
+	}
+
+	return topic
+}
+
+// sink returns the configured metrics sink, falling back to Prometheus
+func (e *Exchange) sink() metrics.Sink {
+	if e.metrics == nil {
+		return metrics.Prometheus{}
+	}
+	return e.metrics
 }
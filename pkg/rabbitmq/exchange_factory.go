@@ -19,6 +19,7 @@ type Factory interface {
 	WithInvoker(client types.Invoker) Factory
 	WithChanCreator(creator ChannelCreator) Factory
 	WithExchange(ex *types.Exchange) Factory
+	WithOptions(options ExchangeOptions) Factory
 	Build() (ExchangeOrganizer, error)
 }
 
@@ -31,6 +32,7 @@ func NewFactory() Factory {
 type ExchangeFactory struct {
 	creator  ChannelCreator
 	client   types.Invoker
+	options  ExchangeOptions
 	exchange *types.Exchange
 }
 
@@ -46,6 +48,12 @@ func (f *ExchangeFactory) WithInvoker(client types.Invoker) Factory {
 	return f
 }
 
+// WithOptions sets the optional behaviour that will be applied to every build exchange
+func (f *ExchangeFactory) WithOptions(options ExchangeOptions) Factory {
+	f.options = options
+	return f
+}
+
 // WithExchange sets the exchange definition and further ensures that the correct type is used
 func (f *ExchangeFactory) WithExchange(ex *types.Exchange) Factory {
 	log.Printf("Factory is configured for exchange %s", ex.Name)
@@ -76,51 +84,92 @@ func (f *ExchangeFactory) Build() (ExchangeOrganizer, error) {
 		return nil, topologyErr
 	}
 
-	return NewExchange(channel, f.client, f.exchange), nil
+	options := f.options
+	options.Creator = f.creator
+	return NewExchange(channel, f.client, f.exchange, options), nil
 }
 
 func declareTopology(con RabbitChannel, ex *types.Exchange) error {
 	if ex.Declare {
-		err := con.ExchangeDeclare(ex.Name, ex.Type, ex.Durable, ex.AutoDeleted, false, false, amqp.Table{})
+		err := con.ExchangeDeclare(ex.Name, ex.Type, ex.Durable, ex.AutoDeleted, ex.Internal, false, amqp.Table{})
+		var amqpErr *amqp.Error
+		if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+			// Redeclaring with other parameters fails on every attempt, hence reconnecting would not help
+			return fmt.Errorf("declaration of exchange %s of type %s { Durable: %t Auto-Delete: %t Internal: %t } conflicts with the existing exchange: %s",
+				ex.Name, ex.Type, ex.Durable, ex.AutoDeleted, ex.Internal, amqpErr.Reason)
+		}
 		if err != nil {
 			return err
 		}
-		log.Printf("Successfully declared exchange %s of type %s { Durable: %t Auto-Delete: %t }", ex.Name, ex.Type, ex.Durable, ex.AutoDeleted)
+		log.Printf("Successfully declared exchange %s of type %s { Durable: %t Auto-Delete: %t Internal: %t }", ex.Name, ex.Type, ex.Durable, ex.AutoDeleted, ex.Internal)
 	}
 
 	for _, topic := range ex.Topics {
-		name := GenerateQueueName(ex.Name, topic)
-
-		_, declareErr := con.QueueDeclare(
-			name,
-			ex.Durable,
-			ex.AutoDeleted,
-			false,
-			false,
-			amqp.Table{},
-		)
-		if declareErr != nil {
-			return declareErr
-		}
-		log.Printf("Successfully declared Queue %s", name)
-
-		bindErr := con.QueueBind(
-			name,
-			topic,
-			ex.Name,
-			false,
-			amqp.Table{},
-		)
-
-		if bindErr != nil {
-			return bindErr
+		if err := declareQueue(con, ex, topic); err != nil {
+			return err
 		}
-		log.Printf("Successfully bound Queue %s to exchange %s", name, ex.Name)
 	}
 
 	return nil
 }
 
+// declareQueue declares the queue of the topic and binds it to the exchange using the topic as binding key
+func declareQueue(con RabbitChannel, ex *types.Exchange, topic string) error {
+	name := GenerateQueueName(ex.Name, topic)
+
+	args := amqp.Table{}
+	if ex.MessageTTL > 0 {
+		args[MessageTTLArgument] = int32(ex.MessageTTL)
+	}
+	durable, autoDelete := ex.Durable, ex.AutoDeleted
+	if ex.Stream {
+		// RabbitMQ only supports durable stream queues
+		args[QueueTypeArgument] = QueueTypeStream
+		durable, autoDelete = true, false
+	} else if ex.Lazy {
+		args[QueueModeArgument] = QueueModeLazy
+	}
+
+	_, declareErr := con.QueueDeclare(
+		name,
+		durable,
+		autoDelete,
+		false,
+		false,
+		args,
+	)
+	if declareErr != nil {
+		return declareErr
+	}
+	log.Printf("Successfully declared Queue %s", name)
+
+	bindErr := con.QueueBind(
+		name,
+		topic,
+		ex.Name,
+		false,
+		amqp.Table{},
+	)
+
+	if bindErr != nil {
+		return bindErr
+	}
+	log.Printf("Successfully bound Queue %s to exchange %s", name, ex.Name)
+
+	return nil
+}
+
+const (
+	// QueueTypeArgument is the queue argument selecting its type
+	QueueTypeArgument = "x-queue-type"
+	// QueueTypeStream declares an append-only stream queue, whose messages are kept once consumed
+	QueueTypeStream = "stream"
+	// QueueModeArgument is the queue argument selecting where a classic queue keeps its messages
+	QueueModeArgument = "x-queue-mode"
+	// QueueModeLazy keeps the messages on disk, which bounds the memory of the broker on large backlogs
+	QueueModeLazy = "lazy"
+)
+
 // GenerateQueueName is responsible to generate a unique queue for the connector to use
 // It follows the naming schema [EXCHANGE_NAME]_[TOPIC]
 func GenerateQueueName(ex string, topic string) string {
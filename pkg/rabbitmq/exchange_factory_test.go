@@ -38,6 +38,11 @@ func (ch *channelMock) QueueBind(name, key, exchange string, noWait bool, args a
 	return params.Error(0)
 }
 
+func (ch *channelMock) QueueUnbind(name, key, exchange string, args amqp.Table) error {
+	params := ch.Called(name, key, exchange, args)
+	return params.Error(0)
+}
+
 func (ch *channelMock) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
 	params := ch.Called(name, kind, durable, autoDelete, internal, noWait, args)
 	return params.Error(0)
@@ -48,6 +53,21 @@ func (ch *channelMock) Consume(queue string, consumer string, autoAck, exclusive
 	return params.Get(0).(<-chan amqp.Delivery), params.Error(1)
 }
 
+func (ch *channelMock) Cancel(consumer string, noWait bool) error {
+	params := ch.Called(consumer, noWait)
+	return params.Error(0)
+}
+
+func (ch *channelMock) Qos(prefetchCount, prefetchSize int, global bool) error {
+	params := ch.Called(prefetchCount, prefetchSize, global)
+	return params.Error(0)
+}
+
+func (ch *channelMock) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	params := ch.Called(exchange, key, mandatory, immediate, msg)
+	return params.Error(0)
+}
+
 func (ch *channelMock) NotifyClose(c chan *amqp.Error) chan *amqp.Error {
 	args := ch.Called(c)
 	return args.Get(0).(chan *amqp.Error)
@@ -101,6 +121,64 @@ func TestExchangeFactory_Build(t *testing.T) {
 		channel.AssertExpectations(t)
 	})
 
+	t.Run("Should declare the message ttl of the queues", func(t *testing.T) {
+		channel := new(channelMock)
+		channel.On("ExchangeDeclare", "Dax", "direct", true, true, false, false, amqp.Table{}).Return(nil)
+		channel.On("QueueDeclare", "Dax_Wirecard", true, true, false, false, amqp.Table{MessageTTLArgument: int32(30000)}).Return(amqp.Queue{}, nil)
+		channel.On("QueueBind", "Dax_Wirecard", "Wirecard", "Dax", false, amqp.Table{}).Return(nil)
+
+		creator := new(creatorMock)
+		creator.On("Channel", nil).Return(channel, nil)
+
+		target := NewFactory()
+		target.WithChanCreator(creator)
+		target.WithInvoker(new(invokerMock))
+		target.WithExchange(&types.Exchange{Name: "Dax", Topics: []string{"Wirecard"}, Declare: true, Type: "direct", Durable: true, AutoDeleted: true, MessageTTL: 30000})
+
+		_, err := target.Build()
+
+		assert.NoError(t, err, "should not throw")
+		channel.AssertExpectations(t)
+	})
+
+	t.Run("Should declare durable stream queues", func(t *testing.T) {
+		channel := new(channelMock)
+		channel.On("QueueDeclare", "Dax_Wirecard", true, false, false, false, amqp.Table{QueueTypeArgument: QueueTypeStream}).Return(amqp.Queue{}, nil)
+		channel.On("QueueBind", "Dax_Wirecard", "Wirecard", "Dax", false, amqp.Table{}).Return(nil)
+
+		creator := new(creatorMock)
+		creator.On("Channel", nil).Return(channel, nil)
+
+		target := NewFactory()
+		target.WithChanCreator(creator)
+		target.WithInvoker(new(invokerMock))
+		target.WithExchange(&types.Exchange{Name: "Dax", Topics: []string{"Wirecard"}, Type: "direct", AutoDeleted: true, Stream: true})
+
+		_, err := target.Build()
+
+		assert.NoError(t, err, "should not throw")
+		channel.AssertExpectations(t)
+	})
+
+	t.Run("Should declare lazy queues", func(t *testing.T) {
+		channel := new(channelMock)
+		channel.On("QueueDeclare", "Dax_Wirecard", false, true, false, false, amqp.Table{QueueModeArgument: QueueModeLazy}).Return(amqp.Queue{}, nil)
+		channel.On("QueueBind", "Dax_Wirecard", "Wirecard", "Dax", false, amqp.Table{}).Return(nil)
+
+		creator := new(creatorMock)
+		creator.On("Channel", nil).Return(channel, nil)
+
+		target := NewFactory()
+		target.WithChanCreator(creator)
+		target.WithInvoker(new(invokerMock))
+		target.WithExchange(&types.Exchange{Name: "Dax", Topics: []string{"Wirecard"}, Type: "direct", AutoDeleted: true, Lazy: true})
+
+		_, err := target.Build()
+
+		assert.NoError(t, err, "should not throw")
+		channel.AssertExpectations(t)
+	})
+
 	t.Run("Should raise error if no creator was provided", func(t *testing.T) {
 		target := NewFactory()
 		organizer, err := target.Build()
@@ -173,6 +251,47 @@ func TestExchangeFactory_Build(t *testing.T) {
 		channel.AssertExpectations(t)
 	})
 
+	t.Run("Should declare the exchange using the configured parameters", func(t *testing.T) {
+		invoker := new(invokerMock)
+		channel := new(channelMock)
+		channel.On("ExchangeDeclare", "Nasdaq", "fanout", true, false, true, false, amqp.Table{}).Return(nil)
+
+		creator := new(creatorMock)
+		creator.On("Channel", nil).Return(channel, nil)
+
+		target := NewFactory()
+		target.WithChanCreator(creator)
+		target.WithInvoker(invoker)
+		target.WithExchange(&types.Exchange{Name: "Nasdaq", Declare: true, Type: "Fanout", Durable: true, Internal: true})
+
+		organizer, err := target.Build()
+
+		assert.NoError(t, err, "should not throw")
+		assert.NotNil(t, organizer, "should not be nil")
+		channel.AssertExpectations(t)
+	})
+
+	t.Run("Should surface conflicts with an existing exchange", func(t *testing.T) {
+		invoker := new(invokerMock)
+		channel := new(channelMock)
+		channel.On("ExchangeDeclare", "Dax", "direct", true, true, false, false, amqp.Table{}).
+			Return(&amqp.Error{Code: amqp.PreconditionFailed, Reason: "PRECONDITION_FAILED - inequivalent arg 'durable' for exchange 'Dax'"})
+
+		creator := new(creatorMock)
+		creator.On("Channel", nil).Return(channel, nil)
+
+		target := NewFactory()
+		target.WithChanCreator(creator)
+		target.WithInvoker(invoker)
+		target.WithExchange(exchange)
+
+		organizer, err := target.Build()
+
+		assert.Nil(t, organizer, "should be nil in error case")
+		assert.EqualError(t, err, "declaration of exchange Dax of type direct { Durable: true Auto-Delete: true Internal: false } conflicts with the existing exchange: PRECONDITION_FAILED - inequivalent arg 'durable' for exchange 'Dax'")
+		channel.AssertExpectations(t)
+	})
+
 	t.Run("Should raise error if queue declaration fails", func(t *testing.T) {
 		invoker := new(invokerMock)
 		channel := new(channelMock)
@@ -10,7 +10,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Templum/rabbitmq-connector/pkg/backoff"
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
 	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/streadway/amqp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -39,9 +42,28 @@ type invokerMock struct {
 	mock.Mock
 }
 
-func (i *invokerMock) Invoke(topic string, invocation *types.OpenFaaSInvocation) error {
+func (i *invokerMock) Invoke(topic string, invocation *types.OpenFaaSInvocation) ([]types.InvocationResult, error) {
 	args := i.Called(topic, invocation)
-	return args.Error(0)
+	return args.Get(0).([]types.InvocationResult), args.Error(1)
+}
+
+type reporterMock struct {
+	mock.Mock
+}
+
+func (r *reporterMock) Report(results []types.InvocationResult) {
+	r.Called(results)
+}
+
+// gateStub blocks AwaitCapacity until it is released
+type gateStub struct {
+	awaited  chan struct{}
+	released chan struct{}
+}
+
+func (g *gateStub) AwaitCapacity() {
+	g.awaited <- struct{}{}
+	<-g.released
 }
 
 func TestExchange_Start(t *testing.T) {
@@ -52,13 +74,13 @@ func TestExchange_Start(t *testing.T) {
 
 	t.Run("Should successfully start consuming for defined topics", func(t *testing.T) {
 		channel := new(channelMock)
-		channel.On("Consume", "Nasdaq_Billing", "", false, false, false, false, amqp.Table{}).Return(make(<-chan amqp.Delivery), nil)
-		channel.On("Consume", "Nasdaq_Transport", "", false, false, false, false, amqp.Table{}).Return(make(<-chan amqp.Delivery), nil)
+		channel.On("Consume", "Nasdaq_Billing", "Nasdaq_Billing", false, false, false, false, amqp.Table{}).Return(make(<-chan amqp.Delivery), nil)
+		channel.On("Consume", "Nasdaq_Transport", "Nasdaq_Transport", false, false, false, false, amqp.Table{}).Return(make(<-chan amqp.Delivery), nil)
 		channel.On("NotifyClose", mock.Anything).Return(make(chan *amqp.Error))
 
 		invoker := new(invokerMock)
 
-		target := NewExchange(channel, invoker, &definition)
+		target := NewExchange(channel, invoker, &definition, ExchangeOptions{})
 
 		err := target.Start()
 		assert.NoError(t, err, "should not throw")
@@ -67,14 +89,45 @@ func TestExchange_Start(t *testing.T) {
 		channel.AssertExpectations(t)
 	})
 
+	t.Run("Should pass the consumer priority as x-priority argument", func(t *testing.T) {
+		channel := new(channelMock)
+		channel.On("Consume", "Nasdaq_Billing", "Nasdaq_Billing", false, false, false, false, amqp.Table{"x-priority": int32(10)}).Return(make(<-chan amqp.Delivery), nil)
+		channel.On("Consume", "Nasdaq_Transport", "Nasdaq_Transport", false, false, false, false, amqp.Table{"x-priority": int32(10)}).Return(make(<-chan amqp.Delivery), nil)
+		channel.On("NotifyClose", mock.Anything).Return(make(chan *amqp.Error))
+
+		target := NewExchange(channel, new(invokerMock), &definition, ExchangeOptions{ConsumerPriority: 10})
+
+		err := target.Start()
+		assert.NoError(t, err, "should not throw")
+
+		channel.AssertExpectations(t)
+	})
+
+	t.Run("Should declare the retry delay exchange and bind the queues to it", func(t *testing.T) {
+		channel := new(channelMock)
+		channel.On("ExchangeDeclare", "retries", "x-delayed-message", true, false, false, false, amqp.Table{"x-delayed-type": "direct"}).Return(nil)
+		channel.On("QueueBind", "Nasdaq_Billing", "Nasdaq_Billing", "retries", false, amqp.Table{}).Return(nil)
+		channel.On("QueueBind", "Nasdaq_Transport", "Nasdaq_Transport", "retries", false, amqp.Table{}).Return(nil)
+		channel.On("Consume", "Nasdaq_Billing", "Nasdaq_Billing", false, false, false, false, amqp.Table{}).Return(make(<-chan amqp.Delivery), nil)
+		channel.On("Consume", "Nasdaq_Transport", "Nasdaq_Transport", false, false, false, false, amqp.Table{}).Return(make(<-chan amqp.Delivery), nil)
+		channel.On("NotifyClose", mock.Anything).Return(make(chan *amqp.Error))
+
+		target := NewExchange(channel, new(invokerMock), &definition, ExchangeOptions{RetryDelayExchange: "retries"})
+
+		err := target.Start()
+		assert.NoError(t, err, "should not throw")
+
+		channel.AssertExpectations(t)
+	})
+
 	t.Run("Should return occurred error when starting consume failed", func(t *testing.T) {
 		channel := new(channelMock)
-		channel.On("Consume", "Nasdaq_Billing", "", false, false, false, false, amqp.Table{}).Return(make(<-chan amqp.Delivery), errors.New("expected"))
+		channel.On("Consume", "Nasdaq_Billing", "Nasdaq_Billing", false, false, false, false, amqp.Table{}).Return(make(<-chan amqp.Delivery), errors.New("expected"))
 		channel.On("NotifyClose", mock.Anything).Return(make(chan *amqp.Error))
 
 		invoker := new(invokerMock)
 
-		target := NewExchange(channel, invoker, &definition)
+		target := NewExchange(channel, invoker, &definition, ExchangeOptions{})
 
 		err := target.Start()
 		assert.Error(t, err, "expected")
@@ -84,6 +137,226 @@ func TestExchange_Start(t *testing.T) {
 	})
 }
 
+func TestExchange_Reconcile(t *testing.T) {
+	definition := types.Exchange{
+		Name:   "Nasdaq",
+		Topics: []string{"Billing"},
+	}
+
+	newChannel := func() *channelMock {
+		channel := new(channelMock)
+		channel.On("Consume", "Nasdaq_Billing", "Nasdaq_Billing", false, false, false, false, amqp.Table{}).Return(make(<-chan amqp.Delivery), nil)
+		channel.On("NotifyClose", mock.Anything).Return(make(chan *amqp.Error))
+		return channel
+	}
+
+	t.Run("Should only memorize topics before the exchange is started", func(t *testing.T) {
+		channel := newChannel()
+		channel.On("QueueDeclare", "Nasdaq_Invoice", false, false, false, false, amqp.Table{}).Return(amqp.Queue{}, nil)
+		channel.On("QueueBind", "Nasdaq_Invoice", "Invoice", "Nasdaq", false, amqp.Table{}).Return(nil)
+		channel.On("Consume", "Nasdaq_Invoice", "Nasdaq_Invoice", false, false, false, false, amqp.Table{}).Return(make(<-chan amqp.Delivery), nil)
+
+		target := NewExchange(channel, new(invokerMock), &definition, ExchangeOptions{}).(*Exchange)
+
+		err := target.Reconcile([]string{"Invoice"})
+		assert.NoError(t, err, "should not throw")
+		channel.AssertNotCalled(t, "QueueDeclare", "Nasdaq_Invoice", false, false, false, false, amqp.Table{})
+
+		err = target.Start()
+		assert.NoError(t, err, "should not throw")
+		channel.AssertExpectations(t)
+	})
+
+	t.Run("Should consume new topics and tear down removed ones", func(t *testing.T) {
+		channel := newChannel()
+		channel.On("QueueDeclare", "Nasdaq_Invoice", false, false, false, false, amqp.Table{}).Return(amqp.Queue{}, nil).Once()
+		channel.On("QueueBind", "Nasdaq_Invoice", "Invoice", "Nasdaq", false, amqp.Table{}).Return(nil).Once()
+		channel.On("Consume", "Nasdaq_Invoice", "Nasdaq_Invoice", false, false, false, false, amqp.Table{}).Return(make(<-chan amqp.Delivery), nil).Once()
+		channel.On("Cancel", "Nasdaq_Invoice", false).Return(nil).Once()
+		channel.On("QueueUnbind", "Nasdaq_Invoice", "Invoice", "Nasdaq", amqp.Table{}).Return(nil).Once()
+
+		target := NewExchange(channel, new(invokerMock), &definition, ExchangeOptions{}).(*Exchange)
+		_ = target.Start()
+
+		err := target.Reconcile([]string{"Billing", "Invoice"})
+		assert.NoError(t, err, "should not throw")
+		err = target.Reconcile([]string{"Billing", "Invoice"})
+		assert.NoError(t, err, "should not redeclare consumed topics")
+		err = target.Reconcile([]string{"Billing"})
+		assert.NoError(t, err, "should not throw")
+
+		channel.AssertExpectations(t)
+		channel.AssertNotCalled(t, "Cancel", "Nasdaq_Billing", false)
+	})
+
+	t.Run("Should retry failed topics with the next reconcile", func(t *testing.T) {
+		channel := newChannel()
+		channel.On("QueueDeclare", "Nasdaq_Invoice", false, false, false, false, amqp.Table{}).Return(amqp.Queue{}, errors.New("expected")).Once()
+		channel.On("QueueDeclare", "Nasdaq_Invoice", false, false, false, false, amqp.Table{}).Return(amqp.Queue{}, nil).Once()
+		channel.On("QueueBind", "Nasdaq_Invoice", "Invoice", "Nasdaq", false, amqp.Table{}).Return(nil).Once()
+		channel.On("Consume", "Nasdaq_Invoice", "Nasdaq_Invoice", false, false, false, false, amqp.Table{}).Return(make(<-chan amqp.Delivery), nil).Once()
+
+		target := NewExchange(channel, new(invokerMock), &definition, ExchangeOptions{}).(*Exchange)
+		_ = target.Start()
+
+		err := target.Reconcile([]string{"Invoice"})
+		assert.Error(t, err, "expected")
+		err = target.Reconcile([]string{"Invoice"})
+		assert.NoError(t, err, "should not throw")
+
+		channel.AssertExpectations(t)
+	})
+}
+
+func TestExchange_Reconfigure(t *testing.T) {
+	newOldChannel := func(deliveries <-chan amqp.Delivery) *channelMock {
+		channel := new(channelMock)
+		channel.On("Consume", "Nasdaq_Billing", "Nasdaq_Billing", false, false, false, false, amqp.Table{}).Return(deliveries, nil)
+		channel.On("NotifyClose", mock.Anything).Return(make(chan *amqp.Error))
+		channel.On("Close", nil).Return(nil)
+		return channel
+	}
+
+	newInvoiceChannel := func(deliveries <-chan amqp.Delivery) *channelMock {
+		channel := new(channelMock)
+		channel.On("QueueDeclare", "Nasdaq_Invoice", false, false, false, false, amqp.Table{}).Return(amqp.Queue{}, nil)
+		channel.On("QueueBind", "Nasdaq_Invoice", "Invoice", "Nasdaq", false, amqp.Table{}).Return(nil)
+		channel.On("QueueUnbind", "Nasdaq_Billing", "Billing", "Nasdaq", amqp.Table{}).Return(nil)
+		channel.On("Consume", "Nasdaq_Invoice", "Nasdaq_Invoice", false, false, false, false, amqp.Table{}).Return(deliveries, nil)
+		channel.On("NotifyClose", mock.Anything).Return(make(chan *amqp.Error))
+		return channel
+	}
+
+	t.Run("Should consume the new bindings on a new channel", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.ConsumerReconfigures)
+		oldChannel := newOldChannel(make(chan amqp.Delivery))
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", uint64(1), false).Return(nil)
+		newChannel := newInvoiceChannel(createDeliveries(amqp.Delivery{Acknowledger: acker, DeliveryTag: 1, RoutingKey: "Invoice", Body: []byte("Hello World")}))
+
+		creator := new(creatorMock)
+		creator.On("Channel", nil).Return(newChannel, nil)
+
+		invoked := make(chan string, 1)
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Invoice", mock.Anything).Return([]types.InvocationResult{}, nil).Run(func(args mock.Arguments) {
+			invoked <- args.String(0)
+		})
+
+		target := NewExchange(oldChannel, invoker, &types.Exchange{Name: "Nasdaq", Topics: []string{"Billing"}}, ExchangeOptions{Creator: creator}).(*Exchange)
+		assert.NoError(t, target.Start(), "should not throw")
+
+		err := target.Reconfigure(&types.Exchange{Name: "Nasdaq", Topics: []string{"Invoice"}})
+		assert.NoError(t, err, "should not throw")
+
+		select {
+		case topic := <-invoked:
+			assert.Equal(t, "Invoice", topic)
+		case <-time.After(time.Second):
+			t.Fatal("Expected the delivery of the new binding to be invoked")
+		}
+
+		oldChannel.AssertCalled(t, "Close", nil)
+		newChannel.AssertExpectations(t)
+		assert.Equal(t, before+1, testutil.ToFloat64(metrics.ConsumerReconfigures))
+	})
+
+	t.Run("Should acknowledge the batched deliveries of the new channel", func(t *testing.T) {
+		acked := make(chan uint64, 2)
+		oldAcker := new(acknowledgerMock)
+		oldAcker.On("Ack", uint64(2), true).Return(nil).Once().Run(func(args mock.Arguments) { acked <- args.Get(0).(uint64) })
+		oldDeliveries := make(chan amqp.Delivery, 2)
+		oldDeliveries <- amqp.Delivery{Acknowledger: oldAcker, DeliveryTag: 1, RoutingKey: "Billing"}
+		oldDeliveries <- amqp.Delivery{Acknowledger: oldAcker, DeliveryTag: 2, RoutingKey: "Billing"}
+		oldChannel := newOldChannel(oldDeliveries)
+
+		// Delivery tags of the new channel start at 1 again
+		newAcker := new(acknowledgerMock)
+		newAcker.On("Ack", uint64(2), true).Return(nil).Once().Run(func(args mock.Arguments) { acked <- args.Get(0).(uint64) })
+		newDeliveries := make(chan amqp.Delivery, 2)
+		newDeliveries <- amqp.Delivery{Acknowledger: newAcker, DeliveryTag: 1, RoutingKey: "Invoice"}
+		newDeliveries <- amqp.Delivery{Acknowledger: newAcker, DeliveryTag: 2, RoutingKey: "Invoice"}
+		newChannel := newInvoiceChannel(newDeliveries)
+
+		creator := new(creatorMock)
+		creator.On("Channel", nil).Return(newChannel, nil)
+
+		invoker := new(invokerMock)
+		invoker.On("Invoke", mock.Anything, mock.Anything).Return([]types.InvocationResult{}, nil)
+
+		target := NewExchange(oldChannel, invoker, &types.Exchange{Name: "Nasdaq", Topics: []string{"Billing"}}, ExchangeOptions{Creator: creator, AckBatchSize: 2, AckFlushInterval: time.Hour}).(*Exchange)
+		assert.NoError(t, target.Start(), "should not throw")
+		select {
+		case <-acked:
+		case <-time.After(time.Second):
+			t.Fatal("Expected the deliveries of the old channel to be acknowledged")
+		}
+
+		err := target.Reconfigure(&types.Exchange{Name: "Nasdaq", Topics: []string{"Invoice"}})
+		assert.NoError(t, err, "should not throw")
+
+		select {
+		case <-acked:
+		case <-time.After(time.Second):
+			t.Fatal("Expected the deliveries of the new channel to be acknowledged")
+		}
+		oldAcker.AssertExpectations(t)
+		newAcker.AssertExpectations(t)
+	})
+
+	t.Run("Should wait for in-flight invocations before replacing the channel", func(t *testing.T) {
+		acker := new(acknowledgerMock)
+		acker.On("Ack", uint64(1), false).Return(nil)
+		deliveries := make(chan amqp.Delivery, 1)
+		deliveries <- amqp.Delivery{Acknowledger: acker, DeliveryTag: 1, RoutingKey: "Billing", Body: []byte("Hello World")}
+		oldChannel := newOldChannel(deliveries)
+
+		creator := new(creatorMock)
+		creator.On("Channel", nil).Return(newInvoiceChannel(make(chan amqp.Delivery)), nil)
+
+		started, release := make(chan struct{}), make(chan struct{})
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, nil).Run(func(args mock.Arguments) {
+			close(started)
+			<-release
+		})
+
+		target := NewExchange(oldChannel, invoker, &types.Exchange{Name: "Nasdaq", Topics: []string{"Billing"}}, ExchangeOptions{Creator: creator}).(*Exchange)
+		assert.NoError(t, target.Start(), "should not throw")
+		<-started
+
+		reconfigured := make(chan error)
+		go func() {
+			reconfigured <- target.Reconfigure(&types.Exchange{Name: "Nasdaq", Topics: []string{"Invoice"}})
+		}()
+
+		select {
+		case <-reconfigured:
+			t.Fatal("Expected reconfigure to wait for the in-flight invocation")
+		case <-time.After(50 * time.Millisecond):
+		}
+		oldChannel.AssertNotCalled(t, "Close", nil)
+
+		close(release)
+		select {
+		case err := <-reconfigured:
+			assert.NoError(t, err, "should not throw")
+		case <-time.After(time.Second):
+			t.Fatal("Expected reconfigure to finish once the invocation finished")
+		}
+		acker.AssertCalled(t, "Ack", uint64(1), false)
+		oldChannel.AssertCalled(t, "Close", nil)
+	})
+
+	t.Run("Should fail without a channel creator", func(t *testing.T) {
+		target := NewExchange(new(channelMock), new(invokerMock), &types.Exchange{Name: "Nasdaq"}, ExchangeOptions{}).(*Exchange)
+
+		err := target.Reconfigure(&types.Exchange{Name: "Nasdaq", Topics: []string{"Invoice"}})
+		assert.Error(t, err, "should throw")
+	})
+}
+
 func createDeliveries(message amqp.Delivery) <-chan amqp.Delivery {
 	deliveries := make(chan amqp.Delivery, 1)
 	deliveries <- message
@@ -104,7 +377,7 @@ func TestExchange_StartConsuming(t *testing.T) {
 
 	t.Run("Should invoke function when message is for registered routing key and further ack processing of message if no error occurred", func(t *testing.T) {
 		invoker := new(invokerMock)
-		invoker.On("Invoke", "Billing", mock.Anything).Return(nil)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, nil)
 
 		acker := new(acknowledgerMock)
 		acker.On("Ack", mock.Anything, false).Return(nil)
@@ -126,9 +399,89 @@ func TestExchange_StartConsuming(t *testing.T) {
 		acker.AssertExpectations(t)
 	})
 
+	t.Run("Should report invocation results if a reporter is present", func(t *testing.T) {
+		results := []types.InvocationResult{{Topic: "Billing", Function: "biller", Status: types.StatusSuccess}}
+
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return(results, nil)
+
+		reporter := new(reporterMock)
+		reporter.On("Report", results)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		target := Exchange{
+			client:     invoker,
+			reporter:   reporter,
+			definition: &definition,
+		}
+
+		target.handleInvocation("Billing", amqp.Delivery{
+			Acknowledger: acker,
+			RoutingKey:   "Billing",
+			Body:         []byte("Hello World"),
+		})
+
+		reporter.AssertExpectations(t)
+		acker.AssertExpectations(t)
+	})
+
+	t.Run("Should invoke the topic determined by the extractor", func(t *testing.T) {
+		extractor, _ := NewTopicExtractor("jsonpath:$.eventType")
+
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "order.created", mock.MatchedBy(func(invocation *types.OpenFaaSInvocation) bool {
+			return invocation.Topic == "order.created"
+		})).Return([]types.InvocationResult{}, nil)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		target := Exchange{
+			client:     invoker,
+			extractor:  extractor,
+			definition: &definition,
+		}
+
+		target.handleInvocation("Billing", amqp.Delivery{
+			Acknowledger: acker,
+			RoutingKey:   "Billing",
+			Body:         []byte(`{"eventType": "order.created"}`),
+		})
+
+		invoker.AssertExpectations(t)
+		acker.AssertExpectations(t)
+	})
+
+	t.Run("Should fallback to subscribed topic if extractor finds no topic", func(t *testing.T) {
+		extractor, _ := NewTopicExtractor("header:eventType")
+
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, nil)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		target := Exchange{
+			client:     invoker,
+			extractor:  extractor,
+			definition: &definition,
+		}
+
+		target.handleInvocation("Billing", amqp.Delivery{
+			Acknowledger: acker,
+			RoutingKey:   "Billing",
+			Body:         []byte("Hello World"),
+		})
+
+		invoker.AssertExpectations(t)
+		acker.AssertExpectations(t)
+	})
+
 	t.Run("Should attempt to ack successful invocations up to 3 times", func(t *testing.T) {
 		invoker := new(invokerMock)
-		invoker.On("Invoke", "Billing", mock.Anything).Return(nil)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, nil)
 
 		acker := new(acknowledgerMock)
 		acker.On("Ack", mock.Anything, false).Return(errors.New("failed"))
@@ -154,7 +507,7 @@ func TestExchange_StartConsuming(t *testing.T) {
 
 	t.Run("Should invoke function when message is for registered routing key and further send back to queue when error occurred", func(t *testing.T) {
 		invoker := new(invokerMock)
-		invoker.On("Invoke", "Billing", mock.Anything).Return(errors.New("failed to invoke"))
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, errors.New("failed to invoke"))
 
 		acker := new(acknowledgerMock)
 		acker.On("Nack", mock.Anything, false, true).Return(nil)
@@ -178,7 +531,7 @@ func TestExchange_StartConsuming(t *testing.T) {
 
 	t.Run("Should attempt to nack unsuccessful invocations up to 3 times", func(t *testing.T) {
 		invoker := new(invokerMock)
-		invoker.On("Invoke", "Billing", mock.Anything).Return(errors.New("failed to invoke"))
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, errors.New("failed to invoke"))
 
 		acker := new(acknowledgerMock)
 		acker.On("Nack", mock.Anything, false, true).Return(errors.New("failed"))
@@ -202,9 +555,155 @@ func TestExchange_StartConsuming(t *testing.T) {
 		acker.AssertNumberOfCalls(t, "Nack", 3)
 	})
 
+	t.Run("Should republish failed invocations with an incremented retry header if max delivery attempts are set", func(t *testing.T) {
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, errors.New("expected"))
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		channel := new(channelMock)
+		channel.On("Publish", "", "Nasdaq_Billing", false, false, mock.MatchedBy(func(msg amqp.Publishing) bool {
+			return msg.Headers[RetryHeader] == int32(2) && msg.Headers[RoutingKeyHeader] == "Billing" && string(msg.Body) == "Hello World"
+		})).Return(nil)
+
+		target := Exchange{
+			channel:             channel,
+			client:              invoker,
+			definition:          &definition,
+			maxDeliveryAttempts: 3,
+		}
+
+		target.StartConsuming("Billing", createDeliveries(amqp.Delivery{
+			Acknowledger: acker,
+			Headers:      amqp.Table{RetryHeader: int32(1)},
+			RoutingKey:   "Billing",
+			Body:         []byte("Hello World"),
+		}))
+
+		invoker.AssertExpectations(t)
+		acker.AssertExpectations(t)
+		channel.AssertExpectations(t)
+	})
+
+	t.Run("Should delay the republished invocations by the retry backoff if a retry delay exchange is set", func(t *testing.T) {
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, errors.New("expected"))
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		channel := new(channelMock)
+		channel.On("Publish", "retries", "Nasdaq_Billing", false, false, mock.MatchedBy(func(msg amqp.Publishing) bool {
+			// The second attempt failed, which is delayed by base * multiplier
+			return msg.Headers[RetryHeader] == int32(2) && msg.Headers[DelayHeader] == int32(4000)
+		})).Return(nil)
+
+		target := Exchange{
+			channel:             channel,
+			client:              invoker,
+			definition:          &definition,
+			maxDeliveryAttempts: 3,
+			retryDelayExchange:  "retries",
+			retryBackoff:        backoff.Config{Base: 2 * time.Second, Max: time.Minute, Multiplier: 2},
+		}
+
+		target.StartConsuming("Billing", createDeliveries(amqp.Delivery{
+			Acknowledger: acker,
+			Headers:      amqp.Table{RetryHeader: int32(1)},
+			RoutingKey:   "Billing",
+			Body:         []byte("Hello World"),
+		}))
+
+		invoker.AssertExpectations(t)
+		acker.AssertExpectations(t)
+		channel.AssertExpectations(t)
+	})
+
+	t.Run("Should drop failed invocations once max delivery attempts are reached", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.DroppedPoisonMessages.WithLabelValues("Billing"))
+
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, errors.New("expected"))
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		channel := new(channelMock)
+
+		target := Exchange{
+			channel:             channel,
+			client:              invoker,
+			definition:          &definition,
+			maxDeliveryAttempts: 3,
+		}
+
+		target.StartConsuming("Billing", createDeliveries(amqp.Delivery{
+			Acknowledger: acker,
+			Headers:      amqp.Table{RetryHeader: int32(2), RoutingKeyHeader: "Billing"},
+			RoutingKey:   "Nasdaq_Billing",
+			Body:         []byte("Hello World"),
+		}))
+
+		invoker.AssertExpectations(t)
+		acker.AssertExpectations(t)
+		channel.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		assert.Equal(t, before+1, testutil.ToFloat64(metrics.DroppedPoisonMessages.WithLabelValues("Billing")))
+	})
+
+	t.Run("Should requeue failed invocations if republishing fails", func(t *testing.T) {
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, errors.New("expected"))
+
+		acker := new(acknowledgerMock)
+		acker.On("Nack", mock.Anything, false, true).Return(nil)
+
+		channel := new(channelMock)
+		channel.On("Publish", "", "Nasdaq_Billing", false, false, mock.Anything).Return(errors.New("expected"))
+
+		target := Exchange{
+			channel:             channel,
+			client:              invoker,
+			definition:          &definition,
+			maxDeliveryAttempts: 3,
+		}
+
+		target.StartConsuming("Billing", createDeliveries(amqp.Delivery{
+			Acknowledger: acker,
+			RoutingKey:   "Billing",
+			Body:         []byte("Hello World"),
+		}))
+
+		invoker.AssertExpectations(t)
+		acker.AssertExpectations(t)
+		channel.AssertExpectations(t)
+	})
+
+	t.Run("Should record the deliveries of the subscribed topic as activity", func(t *testing.T) {
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, nil)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+		acker.On("Reject", mock.Anything, true).Return(nil)
+
+		activity := NewConsumerActivity(time.Minute, 0)
+		target := Exchange{
+			client:     invoker,
+			definition: &definition,
+			activity:   activity,
+		}
+
+		target.StartConsuming("Billing", createDeliveries(amqp.Delivery{Acknowledger: acker, RoutingKey: "Billing", Body: []byte("Hello World")}))
+		target.StartConsuming("Billing", createDeliveries(amqp.Delivery{Acknowledger: acker, RoutingKey: "Account", Body: []byte("Hello World")}))
+
+		assert.Equal(t, uint64(1), activity.Status().Deliveries, "Expected only the subscribed topic to be recorded")
+		assert.True(t, activity.Status().Active)
+	})
+
 	t.Run("Should not invoke when received message is of no registered topic and further reject message and send it back to queue", func(t *testing.T) {
 		invoker := new(invokerMock)
-		invoker.On("Invoke", "Billing", mock.Anything).Return(nil)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, nil)
 
 		acker := new(acknowledgerMock)
 		acker.On("Reject", mock.Anything, true).Return(nil)
@@ -228,7 +727,7 @@ func TestExchange_StartConsuming(t *testing.T) {
 
 	t.Run("Should attempt to reject deliveries for unregistered topics up to 3 times", func(t *testing.T) {
 		invoker := new(invokerMock)
-		invoker.On("Invoke", "Billing", mock.Anything).Return(nil)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, nil)
 
 		acker := new(acknowledgerMock)
 		acker.On("Reject", mock.Anything, true).Return(errors.New("failed"))
@@ -249,6 +748,243 @@ func TestExchange_StartConsuming(t *testing.T) {
 		acker.AssertExpectations(t)
 		acker.AssertNumberOfCalls(t, "Reject", 3)
 	})
+
+	t.Run("Should pass the redelivery flag and retry count along", func(t *testing.T) {
+		for _, delivery := range []amqp.Delivery{
+			{RoutingKey: "Billing"},
+			{RoutingKey: "Billing", Redelivered: true},
+			{RoutingKey: "Billing", Headers: amqp.Table{RetryHeader: int32(2)}},
+		} {
+			expected := delivery
+			invoker := new(invokerMock)
+			invoker.On("Invoke", "Billing", mock.MatchedBy(func(invocation *types.OpenFaaSInvocation) bool {
+				return invocation.Redelivered == expected.Redelivered && invocation.Retries == RetryCount(expected)
+			})).Return([]types.InvocationResult{}, nil)
+
+			acker := new(acknowledgerMock)
+			acker.On("Ack", mock.Anything, false).Return(nil)
+			delivery.Acknowledger = acker
+
+			target := Exchange{
+				client:     invoker,
+				definition: &definition,
+			}
+
+			target.handleInvocation("Billing", delivery)
+			invoker.AssertExpectations(t)
+		}
+	})
+
+	t.Run("Should pass a future deadline along", func(t *testing.T) {
+		deadline := time.Now().Add(time.Minute).Truncate(time.Second)
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.MatchedBy(func(invocation *types.OpenFaaSInvocation) bool {
+			return invocation.Deadline.Equal(deadline)
+		})).Return([]types.InvocationResult{}, nil)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		target := Exchange{
+			client:     invoker,
+			definition: &definition,
+		}
+
+		target.handleInvocation("Billing", amqp.Delivery{Acknowledger: acker, RoutingKey: "Billing", Headers: amqp.Table{DeadlineHeader: deadline.Format(time.RFC3339)}})
+		invoker.AssertExpectations(t)
+		acker.AssertExpectations(t)
+	})
+
+	t.Run("Should skip and acknowledge deliveries whose deadline expired", func(t *testing.T) {
+		invoker := new(invokerMock)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		target := Exchange{
+			client:     invoker,
+			definition: &definition,
+		}
+
+		target.handleInvocation("Billing", amqp.Delivery{Acknowledger: acker, RoutingKey: "Billing", Headers: amqp.Table{DeadlineHeader: time.Now().Add(-time.Minute).Format(time.RFC3339)}})
+		invoker.AssertNotCalled(t, "Invoke", mock.Anything, mock.Anything)
+		acker.AssertExpectations(t)
+	})
+
+	t.Run("Should pass the expiry by the message ttl of the queue on", func(t *testing.T) {
+		published := time.Now()
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.MatchedBy(func(invocation *types.OpenFaaSInvocation) bool {
+			return invocation.Expiry.Equal(published.Add(30 * time.Second))
+		})).Return([]types.InvocationResult{}, nil)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		target := Exchange{
+			client:     invoker,
+			definition: &types.Exchange{Name: "Nasdaq", Topics: []string{"Billing"}, MessageTTL: 30000},
+		}
+
+		target.handleInvocation("Billing", amqp.Delivery{Acknowledger: acker, RoutingKey: "Billing", Timestamp: published})
+		invoker.AssertExpectations(t)
+	})
+
+	t.Run("Should skip and acknowledge deliveries whose ttl expired", func(t *testing.T) {
+		invoker := new(invokerMock)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		target := Exchange{
+			client:     invoker,
+			definition: &definition,
+		}
+
+		target.handleInvocation("Billing", amqp.Delivery{Acknowledger: acker, RoutingKey: "Billing", Expiration: "1000", Timestamp: time.Now().Add(-time.Minute)})
+		invoker.AssertNotCalled(t, "Invoke", mock.Anything, mock.Anything)
+		acker.AssertExpectations(t)
+	})
+
+	t.Run("Should invoke without deadline if the deadline is malformed", func(t *testing.T) {
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.MatchedBy(func(invocation *types.OpenFaaSInvocation) bool {
+			return invocation.Deadline.IsZero()
+		})).Return([]types.InvocationResult{}, nil)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		target := Exchange{
+			client:     invoker,
+			definition: &definition,
+		}
+
+		target.handleInvocation("Billing", amqp.Delivery{Acknowledger: acker, RoutingKey: "Billing", Headers: amqp.Table{DeadlineHeader: "soon"}})
+		invoker.AssertExpectations(t)
+	})
+
+	t.Run("Should archive deliveries before invoking them", func(t *testing.T) {
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, nil)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		archiver := &recordingArchiver{}
+		target := Exchange{
+			client:     invoker,
+			archiver:   archiver,
+			definition: &definition,
+		}
+
+		target.handleInvocation("Billing", amqp.Delivery{Acknowledger: acker, RoutingKey: "Billing", CorrelationId: "order-42", Body: []byte("Hello World")})
+
+		assert.Len(t, archiver.messages, 1)
+		assert.Equal(t, "order-42", archiver.messages[0].CorrelationID)
+		assert.Equal(t, "Billing", archiver.messages[0].Topic)
+		assert.Equal(t, []byte("Hello World"), archiver.messages[0].Body)
+		invoker.AssertExpectations(t)
+	})
+
+	t.Run("Should invoke the transformed payload", func(t *testing.T) {
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.MatchedBy(func(invocation *types.OpenFaaSInvocation) bool {
+			return string(*invocation.Message) == "HELLO WORLD"
+		})).Return([]types.InvocationResult{}, nil)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		target := Exchange{
+			client:     invoker,
+			transform:  &PayloadTransform{Mapper: upperMapper},
+			definition: &definition,
+		}
+
+		target.handleInvocation("Billing", amqp.Delivery{Acknowledger: acker, RoutingKey: "Billing", Body: []byte("Hello World")})
+
+		invoker.AssertExpectations(t)
+		acker.AssertExpectations(t)
+	})
+
+	t.Run("Should drop the delivery once a fail-closed transformation failed", func(t *testing.T) {
+		invoker := new(invokerMock)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		target := Exchange{
+			client:     invoker,
+			transform:  &PayloadTransform{Mapper: erroringMapper},
+			definition: &definition,
+		}
+
+		target.handleInvocation("Billing", amqp.Delivery{Acknowledger: acker, RoutingKey: "Billing", Body: []byte("Hello World")})
+
+		invoker.AssertNotCalled(t, "Invoke", mock.Anything, mock.Anything)
+		acker.AssertExpectations(t)
+	})
+
+	t.Run("Should await the gate before invoking a delivery", func(t *testing.T) {
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, nil)
+
+		acked := make(chan struct{})
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil).Run(func(_ mock.Arguments) { close(acked) })
+
+		gate := &gateStub{awaited: make(chan struct{}), released: make(chan struct{})}
+		target := Exchange{
+			client:     invoker,
+			gate:       gate,
+			definition: &definition,
+		}
+
+		deliveries := make(chan amqp.Delivery, 1)
+		deliveries <- amqp.Delivery{Acknowledger: acker, RoutingKey: "Billing"}
+		close(deliveries)
+
+		done := make(chan struct{})
+		go func() {
+			target.StartConsuming("Billing", deliveries)
+			close(done)
+		}()
+
+		<-gate.awaited
+		invoker.AssertNotCalled(t, "Invoke", mock.Anything, mock.Anything)
+
+		close(gate.released)
+		<-done
+		select {
+		case <-acked:
+		case <-time.After(time.Second):
+			t.Fatal("Expected delivery to be invoked once the gate opened")
+		}
+		invoker.AssertExpectations(t)
+	})
+
+	t.Run("Should batch acknowledgements and flush them on stop", func(t *testing.T) {
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, nil)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", uint64(3), true).Return(nil).Once()
+
+		channel := new(channelMock)
+		channel.On("Close", nil).Return(nil)
+
+		target := NewExchange(channel, invoker, &definition, ExchangeOptions{AckBatchSize: 10, AckFlushInterval: time.Hour}).(*Exchange)
+		target.batcher.Start()
+
+		for tag := uint64(1); tag <= 3; tag++ {
+			target.handleInvocation("Billing", amqp.Delivery{Acknowledger: acker, DeliveryTag: tag, RoutingKey: "Billing"})
+		}
+		acker.AssertNotCalled(t, "Ack", mock.Anything, mock.Anything)
+
+		target.Stop()
+		acker.AssertExpectations(t)
+	})
 }
 
 func TestExchange_Stop(t *testing.T) {
@@ -276,3 +1012,84 @@ func TestExchange_Stop(t *testing.T) {
 		channel.AssertExpectations(t)
 	})
 }
+
+// blockingInvoker blocks every invocation until it is released
+type blockingInvoker struct {
+	invoked  chan string
+	released chan struct{}
+}
+
+func (i *blockingInvoker) Invoke(topic string, invocation *types.OpenFaaSInvocation) ([]types.InvocationResult, error) {
+	i.invoked <- string(*invocation.Message)
+	<-i.released
+	return []types.InvocationResult{}, nil
+}
+
+func TestExchange_Drain(t *testing.T) {
+	definition := types.Exchange{
+		Name:   "Nasdaq",
+		Topics: []string{"Billing"},
+	}
+
+	t.Run("Should cancel the consumers and finish in-flight invocations without accepting new deliveries", func(t *testing.T) {
+		deliveries := make(chan amqp.Delivery, 2)
+		cancelled := make(chan struct{})
+
+		channel := new(channelMock)
+		channel.On("Consume", "Nasdaq_Billing", "Nasdaq_Billing", false, false, false, false, amqp.Table{}).Return((<-chan amqp.Delivery)(deliveries), nil)
+		channel.On("NotifyClose", mock.Anything).Return(make(chan *amqp.Error))
+		channel.On("Cancel", "Nasdaq_Billing", false).Return(nil).Run(func(args mock.Arguments) { close(cancelled) })
+
+		inFlight := new(acknowledgerMock)
+		inFlight.On("Ack", uint64(1), false).Return(nil)
+		pending := new(acknowledgerMock)
+
+		invoker := &blockingInvoker{invoked: make(chan string, 2), released: make(chan struct{})}
+		target := NewExchange(channel, invoker, &definition, ExchangeOptions{})
+		assert.NoError(t, target.Start(), "should not throw")
+
+		deliveries <- amqp.Delivery{Acknowledger: inFlight, DeliveryTag: 1, RoutingKey: "Billing", Body: []byte("in-flight")}
+		assert.Equal(t, "in-flight", <-invoker.invoked)
+
+		drained := make(chan struct{})
+		go func() {
+			target.(Drainer).Drain()
+			close(drained)
+		}()
+
+		<-cancelled
+		deliveries <- amqp.Delivery{Acknowledger: pending, DeliveryTag: 2, RoutingKey: "Billing", Body: []byte("pending")}
+		select {
+		case <-drained:
+			t.Fatal("Expected drain to wait for the in-flight invocation")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		close(invoker.released)
+		<-drained
+		time.Sleep(20 * time.Millisecond)
+
+		assert.Empty(t, invoker.invoked, "Expected no delivery to be invoked after drain")
+		inFlight.AssertExpectations(t)
+		pending.AssertNotCalled(t, "Ack", mock.Anything, mock.Anything)
+		pending.AssertNotCalled(t, "Nack", mock.Anything, mock.Anything, mock.Anything)
+		channel.AssertExpectations(t)
+	})
+
+	t.Run("Should not restart consuming on reconcile once drained", func(t *testing.T) {
+		channel := new(channelMock)
+		channel.On("Consume", "Nasdaq_Billing", "Nasdaq_Billing", false, false, false, false, amqp.Table{}).Return(make(<-chan amqp.Delivery), nil)
+		channel.On("NotifyClose", mock.Anything).Return(make(chan *amqp.Error))
+		channel.On("Cancel", "Nasdaq_Billing", false).Return(errors.New("channel closed"))
+
+		target := NewExchange(channel, new(invokerMock), &definition, ExchangeOptions{})
+		assert.NoError(t, target.Start(), "should not throw")
+
+		target.(Drainer).Drain()
+		target.(Drainer).Drain()
+		assert.NoError(t, target.(TopicReconciler).Reconcile([]string{"Invoice"}), "should not throw")
+
+		channel.AssertNumberOfCalls(t, "Cancel", 1)
+		channel.AssertNumberOfCalls(t, "Consume", 1)
+	})
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Heartbeat is the liveness record that is published periodically, external monitors can alert once they stop
+type Heartbeat struct {
+	Pod        string    `json:"pod"`
+	Version    string    `json:"version"`
+	Commit     string    `json:"commit"`
+	Timestamp  time.Time `json:"timestamp"`
+	Connected  bool      `json:"connected"`
+	Reconnects int       `json:"reconnects"`
+	// Topics and Functions describe the topic map of the last refresh
+	Topics          int       `json:"topics"`
+	Functions       int       `json:"functions"`
+	LastRefresh     time.Time `json:"last_refresh"`
+	RefreshOverruns int       `json:"refresh_overruns"`
+}
+
+// HeartbeatPublisher publishes a heartbeat to the configured exchange on every interval. Like the StatusPublisher
+// it is best-effort, heartbeats are published in the background and failures are only logged.
+type HeartbeatPublisher struct {
+	channel    ChannelPublisher
+	exchange   string
+	routingKey string
+	interval   time.Duration
+	collect    func() Heartbeat
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewHeartbeatPublisher creates a new publisher, which publishes a heartbeat right away and afterwards on every
+// interval. The content of every heartbeat is provided by collect, the timestamp is set on publishing.
+func NewHeartbeatPublisher(channel ChannelPublisher, exchange string, routingKey string, interval time.Duration, collect func() Heartbeat) *HeartbeatPublisher {
+	p := &HeartbeatPublisher{
+		channel:    channel,
+		exchange:   exchange,
+		routingKey: routingKey,
+		interval:   interval,
+		collect:    collect,
+
+		stop: make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.run()
+
+	return p
+}
+
+// Stop ends publishing and waits for a heartbeat that is currently published
+func (p *HeartbeatPublisher) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	p.wg.Wait()
+}
+
+func (p *HeartbeatPublisher) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	p.publish()
+	for {
+		select {
+		case <-ticker.C:
+			p.publish()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *HeartbeatPublisher) publish() {
+	heartbeat := p.collect()
+	heartbeat.Timestamp = time.Now().UTC()
+
+	body, err := json.Marshal(heartbeat)
+	if err != nil {
+		log.Printf("Failed to marshal heartbeat due to %s", err)
+		return
+	}
+
+	err = p.channel.Publish(p.exchange, p.routingKey, false, false, amqp.Publishing{
+		ContentType: "application/json",
+		Timestamp:   heartbeat.Timestamp,
+		Body:        body,
+	})
+	if err != nil {
+		log.Printf("Failed to publish heartbeat due to %s", err)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeatPublisher(t *testing.T) {
+	lastRefresh := time.Date(2021, 3, 14, 15, 9, 26, 0, time.UTC)
+	collect := func() Heartbeat {
+		return Heartbeat{Pod: "connector-0", Version: "1.2.3", Commit: "abc", Connected: true, Reconnects: 2, Topics: 3, Functions: 5, LastRefresh: lastRefresh, RefreshOverruns: 1}
+	}
+
+	t.Run("Should publish a heartbeat on every interval", func(t *testing.T) {
+		stub := newPublisherStub(nil)
+		target := NewHeartbeatPublisher(stub, "monitoring", "connector.heartbeat", 20*time.Millisecond, collect)
+		defer target.Stop()
+
+		first := stub.await(t)
+		second := stub.await(t)
+
+		assert.Equal(t, "monitoring", first.exchange)
+		assert.Equal(t, "connector.heartbeat", first.key)
+		assert.Equal(t, "application/json", first.msg.ContentType)
+		assert.GreaterOrEqual(t, second.msg.Timestamp.Sub(first.msg.Timestamp), 10*time.Millisecond, "Expected heartbeats to be published on the interval")
+	})
+
+	t.Run("Should contain identity, version, connection status and cache stats", func(t *testing.T) {
+		stub := newPublisherStub(nil)
+		target := NewHeartbeatPublisher(stub, "monitoring", "", time.Hour, collect)
+		defer target.Stop()
+
+		var shape map[string]interface{}
+		assert.NoError(t, json.Unmarshal(stub.await(t).msg.Body, &shape), "should not throw")
+
+		assert.Len(t, shape, 10, "should only contain the documented fields")
+		assert.Equal(t, "connector-0", shape["pod"])
+		assert.Equal(t, "1.2.3", shape["version"])
+		assert.Equal(t, "abc", shape["commit"])
+		assert.NotEmpty(t, shape["timestamp"])
+		assert.Equal(t, true, shape["connected"])
+		assert.EqualValues(t, 2, shape["reconnects"])
+		assert.EqualValues(t, 3, shape["topics"])
+		assert.EqualValues(t, 5, shape["functions"])
+		assert.Equal(t, "2021-03-14T15:09:26Z", shape["last_refresh"])
+		assert.EqualValues(t, 1, shape["refresh_overruns"])
+	})
+
+	t.Run("Should keep publishing if publishing fails", func(t *testing.T) {
+		stub := newPublisherStub(errors.New("channel closed"))
+		target := NewHeartbeatPublisher(stub, "monitoring", "", 10*time.Millisecond, collect)
+		defer target.Stop()
+
+		stub.await(t)
+		stub.await(t)
+	})
+
+	t.Run("Should stop publishing once stopped", func(t *testing.T) {
+		stub := newPublisherStub(nil)
+		target := NewHeartbeatPublisher(stub, "monitoring", "", 10*time.Millisecond, collect)
+		stub.await(t)
+
+		target.Stop()
+		target.Stop()
+		for len(stub.published) > 0 {
+			<-stub.published
+		}
+
+		select {
+		case <-stub.published:
+			t.Fatal("Expected no heartbeat after stop")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"math"
+	"sync"
+)
+
+// Unprioritized is the rank of deliveries from queues without a priority, they wait behind all prioritized ones
+const Unprioritized = math.MaxInt32
+
+// MessageLimiter caps the deliveries that are invoked at once, it is shared by all exchanges of a connection.
+// Consumers acquire a slot before a delivery is invoked and therefore stop pulling deliveries once the cap is reached.
+// A freed slot is handed to the waiting delivery of the lowest rank, deliveries of the same rank are served in order.
+type MessageLimiter struct {
+	size int
+
+	lock     sync.Mutex
+	inFlight int
+	waiting  []limiterWaiter
+}
+
+type limiterWaiter struct {
+	rank  int
+	ready chan struct{}
+}
+
+// NewMessageLimiter creates a new limiter allowing up to size deliveries in-flight
+func NewMessageLimiter(size int) *MessageLimiter {
+	return &MessageLimiter{size: size}
+}
+
+// Acquire blocks until a delivery of an unprioritized queue may be invoked
+func (l *MessageLimiter) Acquire() {
+	l.AcquireRank(Unprioritized)
+}
+
+// AcquireRank blocks until a delivery of the rank may be invoked. While deliveries of a lower rank are waiting, it
+// is not served, so that lower ranked queues are drained first.
+func (l *MessageLimiter) AcquireRank(rank int) {
+	l.lock.Lock()
+	if l.inFlight < l.size && len(l.waiting) == 0 {
+		l.inFlight++
+		l.lock.Unlock()
+		return
+	}
+
+	ready := make(chan struct{})
+	l.waiting = append(l.waiting, limiterWaiter{rank: rank, ready: ready})
+	l.lock.Unlock()
+
+	<-ready
+}
+
+// Release frees the slot of a delivery once it was acknowledged, rejected or retried. If deliveries are waiting,
+// the slot is handed over to the one of the lowest rank instead.
+func (l *MessageLimiter) Release() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if len(l.waiting) == 0 {
+		l.inFlight--
+		return
+	}
+
+	next := 0
+	for i, waiter := range l.waiting {
+		if waiter.rank < l.waiting[next].rank {
+			next = i
+		}
+	}
+
+	close(l.waiting[next].ready)
+	l.waiting = append(l.waiting[:next], l.waiting[next+1:]...)
+}
+
+// InFlight reports the deliveries that currently hold a slot
+func (l *MessageLimiter) InFlight() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.inFlight
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// concurrencyInvoker records the highest number of concurrent invocations
+type concurrencyInvoker struct {
+	current atomic.Int32
+	peak    atomic.Int32
+	done    sync.WaitGroup
+}
+
+func (i *concurrencyInvoker) Invoke(topic string, invocation *types.OpenFaaSInvocation) ([]types.InvocationResult, error) {
+	defer i.done.Done()
+
+	current := i.current.Add(1)
+	for {
+		peak := i.peak.Load()
+		if current <= peak || i.peak.CompareAndSwap(peak, current) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	i.current.Add(-1)
+
+	return []types.InvocationResult{}, nil
+}
+
+// orderInvoker records the topics in order of invocation
+type orderInvoker struct {
+	lock   sync.Mutex
+	topics []string
+	done   sync.WaitGroup
+}
+
+func (i *orderInvoker) Invoke(topic string, invocation *types.OpenFaaSInvocation) ([]types.InvocationResult, error) {
+	defer i.done.Done()
+
+	i.lock.Lock()
+	i.topics = append(i.topics, topic)
+	i.lock.Unlock()
+	time.Sleep(5 * time.Millisecond)
+
+	return []types.InvocationResult{}, nil
+}
+
+func TestMessageLimiter(t *testing.T) {
+	t.Run("Should block acquiring once all slots are taken", func(t *testing.T) {
+		target := NewMessageLimiter(1)
+		target.Acquire()
+
+		acquired := make(chan struct{})
+		go func() {
+			target.Acquire()
+			close(acquired)
+		}()
+
+		select {
+		case <-acquired:
+			t.Fatal("Expected acquire to block")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		target.Release()
+		<-acquired
+		assert.Equal(t, 1, target.InFlight())
+	})
+
+	t.Run("Should hand a freed slot to the lowest rank waiting", func(t *testing.T) {
+		target := NewMessageLimiter(1)
+		target.Acquire()
+
+		order := make(chan int, 3)
+		for _, rank := range []int{Unprioritized, 1, 0} {
+			go func(rank int) {
+				target.AcquireRank(rank)
+				order <- rank
+			}(rank)
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		for _, expected := range []int{0, 1, Unprioritized} {
+			target.Release()
+			assert.Equal(t, expected, <-order)
+		}
+		assert.Equal(t, 1, target.InFlight())
+	})
+
+	t.Run("Should process urgent deliveries ahead of normal ones under contention", func(t *testing.T) {
+		const perQueue = 5
+
+		limiter := NewMessageLimiter(1)
+		invoker := &orderInvoker{}
+		invoker.done.Add(2 * perQueue)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		definition := types.Exchange{Name: "Orders", Topics: []string{"normal", "urgent"}}
+		channel := new(channelMock)
+		channel.On("NotifyClose", mock.Anything).Return(make(chan *amqp.Error))
+		for _, topic := range definition.Topics {
+			deliveries := make(chan amqp.Delivery, perQueue)
+			for j := 0; j < perQueue; j++ {
+				deliveries <- amqp.Delivery{Acknowledger: acker, RoutingKey: topic, DeliveryTag: uint64(j)}
+			}
+			channel.On("Consume", "Orders_"+topic, "Orders_"+topic, false, false, false, false, amqp.Table{}).Return((<-chan amqp.Delivery)(deliveries), nil)
+		}
+
+		// The slot is taken until both consumers wait for it, so that they contend for every freed slot
+		limiter.Acquire()
+		target := NewExchange(channel, invoker, &definition, ExchangeOptions{Limiter: limiter, QueuePriorities: []string{"Orders_urgent", "Orders_normal"}})
+		assert.NoError(t, target.Start(), "should not throw")
+		time.Sleep(20 * time.Millisecond)
+		limiter.Release()
+
+		invoker.done.Wait()
+		expected := []string{"urgent", "urgent", "urgent", "urgent", "urgent", "normal", "normal", "normal", "normal", "normal"}
+		assert.Equal(t, expected, invoker.topics, "Expected the urgent queue to be drained first")
+	})
+
+	t.Run("Should never exceed the cap across exchanges", func(t *testing.T) {
+		const exchanges, perTopic, limit = 4, 25, 3
+
+		limiter := NewMessageLimiter(limit)
+		invoker := &concurrencyInvoker{}
+		invoker.done.Add(exchanges * perTopic)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		for i := 0; i < exchanges; i++ {
+			deliveries := make(chan amqp.Delivery, perTopic)
+			for j := 0; j < perTopic; j++ {
+				deliveries <- amqp.Delivery{Acknowledger: acker, RoutingKey: "Billing", DeliveryTag: uint64(j)}
+			}
+
+			definition := types.Exchange{Name: fmt.Sprintf("Exchange%d", i), Topics: []string{"Billing"}}
+			channel := new(channelMock)
+			channel.On("Consume", definition.Name+"_Billing", definition.Name+"_Billing", false, false, false, false, amqp.Table{}).Return((<-chan amqp.Delivery)(deliveries), nil)
+			channel.On("NotifyClose", mock.Anything).Return(make(chan *amqp.Error))
+
+			target := NewExchange(channel, invoker, &definition, ExchangeOptions{Limiter: limiter})
+			assert.NoError(t, target.Start(), "should not throw")
+		}
+
+		invoker.done.Wait()
+		assert.Eventually(t, func() bool { return limiter.InFlight() == 0 }, time.Second, time.Millisecond, "Expected all slots to be released")
+		assert.LessOrEqual(t, invoker.peak.Load(), int32(limit), "Expected the cap to be respected")
+		assert.Equal(t, int32(limit), invoker.peak.Load(), "Expected the cap to be used")
+	})
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// defaultTransformTimeout bounds a transformation, unless the PayloadTransform configures its own timeout
+const defaultTransformTimeout = time.Second
+
+// PayloadMapper transforms the body of a delivery before it is invoked, e.g. to add fields or redact personal data.
+// Implementations have to return once the context is done.
+type PayloadMapper interface {
+	Map(ctx context.Context, topic string, payload []byte) ([]byte, error)
+}
+
+// PayloadTransform applies a PayloadMapper to every delivery with a strict timeout, so that a misbehaving mapper
+// can not wedge the consumption
+type PayloadTransform struct {
+	Mapper PayloadMapper
+	// Timeout of a single transformation, if zero defaultTransformTimeout applies
+	Timeout time.Duration
+	// FailOpen invokes the original payload once the transformation failed, otherwise the delivery is dropped
+	FailOpen bool
+}
+
+type mapResult struct {
+	payload []byte
+	err     error
+}
+
+// Apply transforms the payload, it returns false if the delivery should be dropped
+func (t *PayloadTransform) Apply(topic string, payload []byte) ([]byte, bool) {
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = defaultTransformTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// The mapper runs on its own goroutine, so that the deadline is enforced even if it ignores the context
+	done := make(chan mapResult, 1)
+	go func() {
+		transformed, err := t.Mapper.Map(ctx, topic, payload)
+		done <- mapResult{payload: transformed, err: err}
+	}()
+
+	var err error
+	select {
+	case result := <-done:
+		if result.err == nil {
+			return result.payload, true
+		}
+		err = result.err
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if t.FailOpen {
+		log.Printf("Transformation of payload for topic %s failed due to %s, will invoke the original payload", topic, err)
+		return payload, true
+	}
+	log.Printf("WARNING: Transformation of payload for topic %s failed due to %s, will drop the delivery", topic, err)
+	return nil, false
+}
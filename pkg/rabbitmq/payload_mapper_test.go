@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mapperFunc func(ctx context.Context, topic string, payload []byte) ([]byte, error)
+
+func (f mapperFunc) Map(ctx context.Context, topic string, payload []byte) ([]byte, error) {
+	return f(ctx, topic, payload)
+}
+
+var (
+	identityMapper = mapperFunc(func(_ context.Context, _ string, payload []byte) ([]byte, error) {
+		return payload, nil
+	})
+	erroringMapper = mapperFunc(func(_ context.Context, _ string, _ []byte) ([]byte, error) {
+		return nil, errors.New("malformed payload")
+	})
+	upperMapper = mapperFunc(func(_ context.Context, _ string, payload []byte) ([]byte, error) {
+		return bytes.ToUpper(payload), nil
+	})
+)
+
+func TestPayloadTransform_Apply(t *testing.T) {
+	t.Run("Should return the transformed payload", func(t *testing.T) {
+		payload, ok := (&PayloadTransform{Mapper: identityMapper}).Apply("billing", []byte("Hello World"))
+		assert.True(t, ok)
+		assert.Equal(t, []byte("Hello World"), payload)
+
+		payload, ok = (&PayloadTransform{Mapper: upperMapper}).Apply("billing", []byte("Hello World"))
+		assert.True(t, ok)
+		assert.Equal(t, []byte("HELLO WORLD"), payload)
+	})
+
+	t.Run("Should apply the failure policy once the mapper failed", func(t *testing.T) {
+		payload, ok := (&PayloadTransform{Mapper: erroringMapper, FailOpen: true}).Apply("billing", []byte("Hello World"))
+		assert.True(t, ok, "Expected fail-open to invoke the delivery")
+		assert.Equal(t, []byte("Hello World"), payload, "Expected the original payload")
+
+		_, ok = (&PayloadTransform{Mapper: erroringMapper}).Apply("billing", []byte("Hello World"))
+		assert.False(t, ok, "Expected fail-closed to drop the delivery")
+	})
+
+	t.Run("Should abort a mapper exceeding the timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		stuck := mapperFunc(func(_ context.Context, _ string, payload []byte) ([]byte, error) {
+			<-release
+			return payload, nil
+		})
+
+		start := time.Now()
+		payload, ok := (&PayloadTransform{Mapper: stuck, Timeout: 20 * time.Millisecond, FailOpen: true}).Apply("billing", []byte("Hello World"))
+
+		assert.Less(t, time.Since(start), time.Second, "Expected the timeout to be enforced although the mapper ignores its context")
+		assert.True(t, ok)
+		assert.Equal(t, []byte("Hello World"), payload)
+	})
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"container/heap"
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+// priorityBuffer holds the deliveries of a consumer until they are dispatched, the one of the highest priority is
+// dispatched first and deliveries of the same priority in order. It is filled by a single goroutine and emptied by
+// another one.
+type priorityBuffer struct {
+	lock     sync.Mutex
+	ready    *sync.Cond
+	queue    bufferedDeliveries
+	sequence uint64
+	closed   bool
+}
+
+type bufferedDelivery struct {
+	delivery amqp.Delivery
+	sequence uint64
+}
+
+func newPriorityBuffer() *priorityBuffer {
+	buffer := &priorityBuffer{}
+	buffer.ready = sync.NewCond(&buffer.lock)
+	return buffer
+}
+
+// Push buffers the delivery
+func (b *priorityBuffer) Push(delivery amqp.Delivery) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	heap.Push(&b.queue, bufferedDelivery{delivery: delivery, sequence: b.sequence})
+	b.sequence++
+	b.ready.Signal()
+}
+
+// Close marks that no further deliveries are pushed
+func (b *priorityBuffer) Close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.closed = true
+	b.ready.Broadcast()
+}
+
+// Wait blocks until a delivery is buffered, it returns false once the buffer was closed and emptied
+func (b *priorityBuffer) Wait() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for b.queue.Len() == 0 && !b.closed {
+		b.ready.Wait()
+	}
+	return b.queue.Len() > 0
+}
+
+// Pop returns the buffered delivery of the highest priority, Wait has to report one first
+func (b *priorityBuffer) Pop() amqp.Delivery {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return heap.Pop(&b.queue).(bufferedDelivery).delivery
+}
+
+// bufferedDeliveries implements heap.Interface ordered by descending priority and ascending sequence
+type bufferedDeliveries []bufferedDelivery
+
+func (q bufferedDeliveries) Len() int { return len(q) }
+
+func (q bufferedDeliveries) Less(i, j int) bool {
+	if q[i].delivery.Priority != q[j].delivery.Priority {
+		return q[i].delivery.Priority > q[j].delivery.Priority
+	}
+	return q[i].sequence < q[j].sequence
+}
+
+func (q bufferedDeliveries) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *bufferedDeliveries) Push(x interface{}) { *q = append(*q, x.(bufferedDelivery)) }
+
+func (q *bufferedDeliveries) Pop() interface{} {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return last
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type bodyInvoker struct {
+	lock   sync.Mutex
+	bodies []string
+	done   sync.WaitGroup
+}
+
+func (i *bodyInvoker) Invoke(topic string, invocation *types.OpenFaaSInvocation) ([]types.InvocationResult, error) {
+	defer i.done.Done()
+
+	i.lock.Lock()
+	i.bodies = append(i.bodies, string(*invocation.Message))
+	i.lock.Unlock()
+	time.Sleep(5 * time.Millisecond)
+
+	return []types.InvocationResult{}, nil
+}
+
+func TestPriorityBuffer(t *testing.T) {
+	t.Run("Should pop the highest priority first and equal priorities in order", func(t *testing.T) {
+		target := newPriorityBuffer()
+		for i, priority := range []uint8{1, 5, 1, 9, 5} {
+			target.Push(amqp.Delivery{Priority: priority, DeliveryTag: uint64(i)})
+		}
+		target.Close()
+
+		var tags []uint64
+		for target.Wait() {
+			tags = append(tags, target.Pop().DeliveryTag)
+		}
+		assert.Equal(t, []uint64{3, 1, 4, 0, 2}, tags)
+	})
+
+	t.Run("Should wait for a delivery until closed", func(t *testing.T) {
+		target := newPriorityBuffer()
+
+		waited := make(chan bool)
+		go func() { waited <- target.Wait() }()
+		target.Push(amqp.Delivery{DeliveryTag: 1})
+		assert.True(t, <-waited, "Expected the pushed delivery to end the wait")
+		target.Pop()
+
+		go func() { waited <- target.Wait() }()
+		target.Close()
+		assert.False(t, <-waited, "Expected the closed buffer to end the wait")
+	})
+}
+
+func TestExchange_PriorityDispatch(t *testing.T) {
+	t.Run("Should invoke higher priority deliveries first under contention", func(t *testing.T) {
+		priorities := map[string]uint8{"low-1": 1, "medium-1": 5, "low-2": 1, "high": 9, "medium-2": 5}
+		order := []string{"low-1", "medium-1", "low-2", "high", "medium-2"}
+
+		limiter := NewMessageLimiter(1)
+		invoker := &bodyInvoker{}
+		invoker.done.Add(len(order))
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		deliveries := make(chan amqp.Delivery, len(order))
+		for i, body := range order {
+			deliveries <- amqp.Delivery{Acknowledger: acker, RoutingKey: "Billing", DeliveryTag: uint64(i + 1), Priority: priorities[body], Body: []byte(body)}
+		}
+
+		definition := types.Exchange{Name: "Orders", Topics: []string{"Billing"}}
+		channel := new(channelMock)
+		channel.On("NotifyClose", mock.Anything).Return(make(chan *amqp.Error))
+		channel.On("Consume", "Orders_Billing", "Orders_Billing", false, false, false, false, amqp.Table{}).Return((<-chan amqp.Delivery)(deliveries), nil)
+
+		// The slot is taken until all deliveries are buffered, so that they contend for every freed slot
+		limiter.Acquire()
+		target := NewExchange(channel, invoker, &definition, ExchangeOptions{Limiter: limiter, PriorityDispatch: true})
+		assert.NoError(t, target.Start(), "should not throw")
+		time.Sleep(20 * time.Millisecond)
+		limiter.Release()
+
+		invoker.done.Wait()
+		assert.Equal(t, []string{"high", "medium-1", "medium-2", "low-1", "low-2"}, invoker.bodies)
+	})
+}
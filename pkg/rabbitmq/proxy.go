@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+// DialFunc establishes the tcp connection towards Rabbit MQ, it is compatible with amqp.Config.Dial
+type DialFunc func(network, addr string) (net.Conn, error)
+
+const proxyDialTimeout = 30 * time.Second
+
+// NewProxyDialer returns a DialFunc that tunnels the connection through the provided proxy. Supported are
+// socks5 and socks5h proxies as well as http proxies using CONNECT.
+func NewProxyDialer(proxyURL string) (DialFunc, error) {
+	parsed, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse proxy url")
+	}
+
+	direct := &net.Dialer{Timeout: proxyDialTimeout}
+
+	switch parsed.Scheme {
+	case "socks5", "socks5h":
+		dialer, err := proxy.FromURL(parsed, direct)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to create socks5 dialer")
+		}
+		return dialer.Dial, nil
+	case "http":
+		return func(network, addr string) (net.Conn, error) {
+			return dialHTTPConnect(direct, parsed, network, addr)
+		}, nil
+	default:
+		return nil, fmt.Errorf("proxy scheme %s is not one of socks5, socks5h or http", parsed.Scheme)
+	}
+}
+
+// dialHTTPConnect opens a tunnel towards addr using the CONNECT method of the http proxy
+func dialHTTPConnect(direct *net.Dialer, proxyURL *url.URL, network, addr string) (net.Conn, error) {
+	conn, err := direct.Dial(network, proxyURL.Host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to reach proxy %s", proxyURL.Host)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := proxyURL.User.Username() + ":" + password
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(proxyDialTimeout))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "unable to send CONNECT to proxy %s", proxyURL.Host)
+	}
+
+	// The broker only speaks after the client sent the protocol header, so nothing is buffered past the response
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "unable to read CONNECT response of proxy %s", proxyURL.Host)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused CONNECT with %s", proxyURL.Host, resp.Status)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
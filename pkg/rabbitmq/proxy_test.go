@@ -0,0 +1,240 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// proxyStub is a minimal proxy, which records the requested targets and tunnels towards them
+type proxyStub struct {
+	listener net.Listener
+	lock     sync.Mutex
+	targets  []string
+	auth     string
+}
+
+func newProxyStub(t *testing.T, serve func(p *proxyStub, conn net.Conn)) *proxyStub {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub := &proxyStub{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(stub, conn)
+		}
+	}()
+
+	t.Cleanup(func() { listener.Close() })
+	return stub
+}
+
+func (p *proxyStub) record(target string, auth string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.targets = append(p.targets, target)
+	p.auth = auth
+}
+
+func (p *proxyStub) Targets() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.targets
+}
+
+func tunnel(client net.Conn, target string) {
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		client.Close()
+		return
+	}
+
+	go func() {
+		_, _ = io.Copy(upstream, client)
+		upstream.Close()
+	}()
+	_, _ = io.Copy(client, upstream)
+	client.Close()
+}
+
+func serveSocks5(p *proxyStub, conn net.Conn) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		conn.Close()
+		return
+	}
+	methods := make([]byte, header[1])
+	_, _ = io.ReadFull(conn, methods)
+	_, _ = conn.Write([]byte{0x05, 0x00})
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		conn.Close()
+		return
+	}
+
+	var host string
+	switch request[3] {
+	case 0x01:
+		ip := make([]byte, 4)
+		_, _ = io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 0x03:
+		length := make([]byte, 1)
+		_, _ = io.ReadFull(conn, length)
+		name := make([]byte, length[0])
+		_, _ = io.ReadFull(conn, name)
+		host = string(name)
+	}
+	port := make([]byte, 2)
+	_, _ = io.ReadFull(conn, port)
+
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	p.record(target, "")
+
+	_, _ = conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	tunnel(conn, target)
+}
+
+func serveHTTPConnect(p *proxyStub, conn net.Conn) {
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil || req.Method != http.MethodConnect {
+		conn.Close()
+		return
+	}
+
+	p.record(req.Host, req.Header.Get("Proxy-Authorization"))
+	_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	tunnel(conn, req.Host)
+}
+
+func newEchoServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				_, _ = io.Copy(c, c)
+				c.Close()
+			}(conn)
+		}
+	}()
+
+	t.Cleanup(func() { listener.Close() })
+	return listener.Addr().String()
+}
+
+func assertEcho(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+
+	_, err := conn.Write([]byte("AMQP"))
+	assert.NoError(t, err, "should not throw")
+
+	reply := make([]byte, 4)
+	_, err = io.ReadFull(conn, reply)
+	assert.NoError(t, err, "should not throw")
+	assert.Equal(t, "AMQP", string(reply))
+}
+
+func TestNewProxyDialer(t *testing.T) {
+	target := newEchoServer(t)
+
+	t.Run("Should tunnel the connection through a socks5 proxy", func(t *testing.T) {
+		stub := newProxyStub(t, serveSocks5)
+
+		dial, err := NewProxyDialer("socks5://" + stub.listener.Addr().String())
+		assert.NoError(t, err, "should not throw")
+
+		conn, err := dial("tcp", target)
+		assert.NoError(t, err, "should not throw")
+		assertEcho(t, conn)
+
+		assert.Equal(t, []string{target}, stub.Targets())
+	})
+
+	t.Run("Should tunnel the connection through a http proxy using CONNECT", func(t *testing.T) {
+		stub := newProxyStub(t, serveHTTPConnect)
+
+		dial, err := NewProxyDialer("http://user:pass@" + stub.listener.Addr().String())
+		assert.NoError(t, err, "should not throw")
+
+		conn, err := dial("tcp", target)
+		assert.NoError(t, err, "should not throw")
+		assertEcho(t, conn)
+
+		assert.Equal(t, []string{target}, stub.Targets())
+		assert.Equal(t, "Basic dXNlcjpwYXNz", stub.auth)
+	})
+
+	t.Run("Should return error if the http proxy refuses CONNECT", func(t *testing.T) {
+		stub := newProxyStub(t, func(p *proxyStub, conn net.Conn) {
+			_, _ = http.ReadRequest(bufio.NewReader(conn))
+			_, _ = conn.Write([]byte("HTTP/1.1 403 Forbidden\r\n\r\n"))
+			conn.Close()
+		})
+
+		dial, _ := NewProxyDialer("http://" + stub.listener.Addr().String())
+		_, err := dial("tcp", target)
+		assert.Error(t, err, "should throw")
+		assert.Contains(t, err.Error(), "refused CONNECT")
+	})
+
+	t.Run("Should return error for unsupported schemes", func(t *testing.T) {
+		_, err := NewProxyDialer("ftp://localhost:21")
+		assert.Error(t, err, "should throw")
+	})
+}
+
+func TestProxyBroker_Dial(t *testing.T) {
+	t.Run("Should dial the broker through the proxy", func(t *testing.T) {
+		stub := newProxyStub(t, serveSocks5)
+		closer, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer closer.Close()
+		go func() {
+			for {
+				conn, err := closer.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+		target := closer.Addr().String()
+
+		broker, err := NewProxyBroker("socks5://" + stub.listener.Addr().String())
+		assert.NoError(t, err, "should not throw")
+
+		// The target is no broker, hence the handshake fails after the tunnel was established
+		_, err = broker.Dial("amqp://user:pass@" + target + "/")
+		assert.Error(t, err, "should throw")
+		assert.Equal(t, []string{target}, stub.Targets())
+	})
+}
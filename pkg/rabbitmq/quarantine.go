@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"log"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/backoff"
+	"github.com/streadway/amqp"
+)
+
+// FailureHeader holds the error of the last failed delivery attempt of a quarantined or dead-lettered delivery
+const FailureHeader = "x-connector-error"
+
+// quarantine publishes a delivery that failed with a non-retryable error onto the quarantine exchange, where it
+// awaits human review instead of being retried. The topic is used as routing key.
+func (e *Exchange) quarantine(topic string, delivery amqp.Delivery, cause error) {
+	log.Printf("WARNING: Quarantining delivery %d for topic %s due to non-retryable %s", delivery.DeliveryTag, topic, cause)
+	if e.publishFailed(e.quarantineExchange, topic, delivery, RetryCount(delivery), cause) {
+		e.sink().IncQuarantined(topic)
+	}
+}
+
+// reject drops a delivery that failed with a non-retryable error if no quarantine exchange is configured, as requeueing
+// it would redeliver it endlessly. RabbitMQ dead-letters it instead, if the queue has a dead-letter exchange.
+func (e *Exchange) reject(topic string, delivery amqp.Delivery, cause error) {
+	log.Printf("WARNING: Rejecting delivery %d for topic %s due to non-retryable %s", delivery.DeliveryTag, topic, cause)
+
+	delays := backoff.New(acknowledgeBackoff)
+	for retry := 0; retry < MaxAttempts; retry++ {
+		err := delivery.Nack(false, false)
+		if err == nil {
+			if e.batcher != nil {
+				e.batcher.Settled(delivery)
+			}
+			e.sink().IncRejected(topic)
+			return
+		}
+
+		log.Printf("Failed to reject delivery %d due to %s. Attempt %d/3", delivery.DeliveryTag, err, retry+1)
+		time.Sleep(delays.Next())
+	}
+
+	log.Printf("Failed to reject delivery %d, will abort reject now", delivery.DeliveryTag)
+}
+
+// deadLetter publishes a delivery that exceeded the maximum delivery attempts onto the dead-letter exchange, where it
+// awaits automated reprocessing. The topic is used as routing key.
+func (e *Exchange) deadLetter(topic string, delivery amqp.Delivery, attempts int, cause error) {
+	log.Printf("WARNING: Dead-lettering delivery %d for topic %s after %d failed delivery attempts", delivery.DeliveryTag, topic, attempts)
+	if e.publishFailed(e.deadLetterExchange, topic, delivery, attempts, cause) {
+		e.sink().IncDeadLettered(topic)
+	}
+}
+
+// publishFailed publishes a copy of the failed delivery onto the exchange and acknowledges it, while a failed
+// publish requeues the delivery so it is not lost. It returns whether the delivery was published.
+func (e *Exchange) publishFailed(exchange string, topic string, delivery amqp.Delivery, retries int, cause error) bool {
+	publishing := newRetryPublishing(delivery, retries)
+	publishing.Headers[FailureHeader] = cause.Error()
+
+	err := e.channel.Publish(exchange, topic, false, false, publishing)
+	if err != nil {
+		log.Printf("Failed to publish delivery %d onto exchange %s due to %s, will requeue it instead", delivery.DeliveryTag, exchange, err)
+		e.nack(delivery)
+		return false
+	}
+
+	e.ack(delivery)
+	return true
+}
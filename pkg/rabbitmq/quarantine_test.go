@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Templum/rabbitmq-connector/pkg/metrics"
+	"github.com/Templum/rabbitmq-connector/pkg/schema"
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// functionError mimics the status errors of the invoker, which are retryable unless the function responded with 4xx
+type functionError int
+
+func (e functionError) Error() string {
+	return fmt.Sprintf("Received unexpected Status Code %d", int(e))
+}
+
+func (e functionError) Retryable() bool {
+	return e < 400 || e >= 500
+}
+
+func TestExchange_Quarantine(t *testing.T) {
+	definition := types.Exchange{Name: "Nasdaq", Topics: []string{"Billing"}}
+	run := func(t *testing.T, err error, retries int32, channel *channelMock) *acknowledgerMock {
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, err)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+		acker.On("Nack", mock.Anything, false, true).Return(nil)
+
+		target := Exchange{
+			channel:             channel,
+			client:              invoker,
+			definition:          &definition,
+			maxDeliveryAttempts: 3,
+			quarantineExchange:  "quarantine",
+			deadLetterExchange:  "dead-letter",
+		}
+
+		target.StartConsuming("Billing", createDeliveries(amqp.Delivery{
+			Acknowledger: acker,
+			Headers:      amqp.Table{RetryHeader: retries},
+			RoutingKey:   "Billing",
+			Body:         []byte("Hello World"),
+		}))
+
+		invoker.AssertExpectations(t)
+		return acker
+	}
+
+	t.Run("Should quarantine deliveries that failed with a 4xx of the function", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.QuarantinedMessages.WithLabelValues("Billing"))
+
+		channel := new(channelMock)
+		channel.On("Publish", "quarantine", "Billing", false, false, mock.MatchedBy(func(msg amqp.Publishing) bool {
+			return msg.Headers[FailureHeader] == "function biller: Received unexpected Status Code 400" && string(msg.Body) == "Hello World"
+		})).Return(nil)
+
+		acker := run(t, fmt.Errorf("function biller: %w", functionError(400)), 0, channel)
+
+		channel.AssertExpectations(t)
+		acker.AssertCalled(t, "Ack", mock.Anything, false)
+		assert.Equal(t, before+1, testutil.ToFloat64(metrics.QuarantinedMessages.WithLabelValues("Billing")))
+	})
+
+	t.Run("Should dead-letter deliveries that exhausted the delivery attempts with a 5xx of the function", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.DeadLetteredMessages.WithLabelValues("Billing"))
+		dropped := testutil.ToFloat64(metrics.DroppedPoisonMessages.WithLabelValues("Billing"))
+
+		channel := new(channelMock)
+		channel.On("Publish", "dead-letter", "Billing", false, false, mock.MatchedBy(func(msg amqp.Publishing) bool {
+			return msg.Headers[RetryHeader] == int32(3) && msg.Headers[FailureHeader] == "Received unexpected Status Code 503"
+		})).Return(nil)
+
+		acker := run(t, functionError(503), 2, channel)
+
+		channel.AssertExpectations(t)
+		acker.AssertCalled(t, "Ack", mock.Anything, false)
+		assert.Equal(t, before+1, testutil.ToFloat64(metrics.DeadLetteredMessages.WithLabelValues("Billing")))
+		assert.Equal(t, dropped, testutil.ToFloat64(metrics.DroppedPoisonMessages.WithLabelValues("Billing")))
+	})
+
+	t.Run("Should retry transient failures before the delivery attempts are exhausted", func(t *testing.T) {
+		channel := new(channelMock)
+		channel.On("Publish", "", "Nasdaq_Billing", false, false, mock.Anything).Return(nil)
+
+		run(t, functionError(503), 0, channel)
+
+		channel.AssertExpectations(t)
+	})
+
+	t.Run("Should only quarantine if all combined errors are non-retryable", func(t *testing.T) {
+		channel := new(channelMock)
+		channel.On("Publish", "", "Nasdaq_Billing", false, false, mock.Anything).Return(nil)
+
+		run(t, errors.Join(functionError(400), functionError(502)), 0, channel)
+
+		channel.AssertExpectations(t)
+		channel.AssertNotCalled(t, "Publish", "quarantine", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Should requeue the delivery if quarantining fails", func(t *testing.T) {
+		channel := new(channelMock)
+		channel.On("Publish", "quarantine", "Billing", false, false, mock.Anything).Return(errors.New("expected"))
+
+		acker := run(t, functionError(422), 0, channel)
+
+		acker.AssertCalled(t, "Nack", mock.Anything, false, true)
+		acker.AssertNotCalled(t, "Ack", mock.Anything, false)
+	})
+}
+
+func TestExchange_RejectNonRetryable(t *testing.T) {
+	definition := types.Exchange{Name: "Nasdaq", Topics: []string{"Billing"}}
+	run := func(t *testing.T, err error) *acknowledgerMock {
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, err)
+
+		acker := new(acknowledgerMock)
+		acker.On("Nack", mock.Anything, false, false).Return(nil)
+		acker.On("Nack", mock.Anything, false, true).Return(nil)
+
+		// Neither a quarantine exchange nor delivery attempts are configured
+		target := Exchange{channel: new(channelMock), client: invoker, definition: &definition}
+		target.handleInvocation("Billing", amqp.Delivery{Acknowledger: acker, RoutingKey: "Billing", Body: []byte(`{"amount": "ten"}`)})
+
+		invoker.AssertExpectations(t)
+		return acker
+	}
+
+	t.Run("Should reject deliveries that do not match the schema without requeue", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.RejectedMessages.WithLabelValues("Billing"))
+
+		acker := run(t, &schema.ValidationError{Schema: "Billing", Path: "/amount", Reason: "expected number"})
+
+		acker.AssertCalled(t, "Nack", mock.Anything, false, false)
+		acker.AssertNotCalled(t, "Nack", mock.Anything, false, true)
+		assert.Equal(t, before+1, testutil.ToFloat64(metrics.RejectedMessages.WithLabelValues("Billing")))
+	})
+
+	t.Run("Should still requeue deliveries that failed with a retryable error", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.RejectedMessages.WithLabelValues("Billing"))
+
+		acker := run(t, functionError(503))
+
+		acker.AssertCalled(t, "Nack", mock.Anything, false, true)
+		acker.AssertNotCalled(t, "Nack", mock.Anything, false, false)
+		assert.Equal(t, before, testutil.ToFloat64(metrics.RejectedMessages.WithLabelValues("Billing")))
+	})
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/streadway/amqp"
+)
+
+// RecentMessage describes a processed delivery, which is served by /debug/recent/{topic}
+type RecentMessage struct {
+	Timestamp     time.Time          `json:"timestamp"`
+	Topic         string             `json:"topic"`
+	RoutingKey    string             `json:"routing_key"`
+	CorrelationID string             `json:"correlation_id"`
+	Status        string             `json:"status"`
+	Error         string             `json:"error,omitempty"`
+	Invocations   []RecentInvocation `json:"invocations"`
+	// Body is only kept if bodies are enabled, as messages may contain personal data
+	Body []byte `json:"body,omitempty"`
+}
+
+// RecentInvocation is the outcome of a function invoked for a RecentMessage
+type RecentInvocation struct {
+	Function  string `json:"function"`
+	Namespace string `json:"namespace"`
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// RecentMessages keeps the last processed deliveries of every topic in a ring buffer of the configured size, so that
+// operators can see what happened recently on a misbehaving topic without searching the logs. Only the metadata and
+// outcome are kept, unless bodies are enabled. A nil RecentMessages records nothing.
+type RecentMessages struct {
+	size   int
+	bodies bool
+
+	lock   sync.Mutex
+	topics map[string]*recentRing
+}
+
+// recentRing overwrites the oldest message once it is full
+type recentRing struct {
+	messages []RecentMessage
+	next     int
+}
+
+// NewRecentMessages keeps up to size messages per topic, their bodies only if bodies is set
+func NewRecentMessages(size int, bodies bool) *RecentMessages {
+	return &RecentMessages{size: size, bodies: bodies, topics: map[string]*recentRing{}}
+}
+
+// Record adds the delivery of the topic alongside the results and error of its invocation
+func (r *RecentMessages) Record(topic string, delivery amqp.Delivery, results []types.InvocationResult, err error) {
+	if r == nil || r.size <= 0 {
+		return
+	}
+
+	message := RecentMessage{
+		Timestamp:     time.Now().UTC(),
+		Topic:         topic,
+		RoutingKey:    delivery.RoutingKey,
+		CorrelationID: delivery.CorrelationId,
+		Status:        types.StatusSuccess,
+		Invocations:   make([]RecentInvocation, 0, len(results)),
+	}
+	if err != nil {
+		message.Status = types.StatusFailure
+		message.Error = err.Error()
+	}
+	if r.bodies {
+		message.Body = append([]byte(nil), delivery.Body...)
+	}
+	for _, result := range results {
+		invocation := RecentInvocation{
+			Function:  result.Function,
+			Namespace: result.Namespace,
+			Status:    result.Status,
+			LatencyMs: result.Latency.Milliseconds(),
+		}
+		if result.Error != nil {
+			invocation.Error = result.Error.Error()
+		}
+		message.Invocations = append(message.Invocations, invocation)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	ring, exists := r.topics[topic]
+	if !exists {
+		ring = &recentRing{messages: make([]RecentMessage, 0, r.size)}
+		r.topics[topic] = ring
+	}
+	if len(ring.messages) < r.size {
+		ring.messages = append(ring.messages, message)
+		return
+	}
+	ring.messages[ring.next] = message
+	ring.next = (ring.next + 1) % r.size
+}
+
+// Recent returns the recorded messages of the topic, oldest first
+func (r *RecentMessages) Recent(topic string) []RecentMessage {
+	if r == nil {
+		return []RecentMessage{}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	ring, exists := r.topics[topic]
+	if !exists {
+		return []RecentMessage{}
+	}
+
+	recent := make([]RecentMessage, 0, len(ring.messages))
+	recent = append(recent, ring.messages[ring.next:]...)
+	return append(recent, ring.messages[:ring.next]...)
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRecentMessages(t *testing.T) {
+	delivery := func(correlationID string) amqp.Delivery {
+		return amqp.Delivery{RoutingKey: "billing", CorrelationId: correlationID, Body: []byte("secret")}
+	}
+	correlationIDs := func(messages []RecentMessage) []string {
+		ids := make([]string, 0, len(messages))
+		for _, message := range messages {
+			ids = append(ids, message.CorrelationID)
+		}
+		return ids
+	}
+
+	t.Run("Should wrap at capacity and keep the newest messages in order", func(t *testing.T) {
+		target := NewRecentMessages(3, false)
+		for _, id := range []string{"1", "2", "3", "4", "5"} {
+			target.Record("billing", delivery(id), nil, nil)
+		}
+
+		assert.Equal(t, []string{"3", "4", "5"}, correlationIDs(target.Recent("billing")))
+		assert.Empty(t, target.Recent("invoice"), "Expected every topic to have its own buffer")
+	})
+
+	t.Run("Should record the outcome of every invoked function", func(t *testing.T) {
+		target := NewRecentMessages(3, false)
+		results := []types.InvocationResult{
+			{Topic: "billing", Function: "biller", Namespace: "openfaas-fn", Status: types.StatusSuccess, Latency: 20 * time.Millisecond},
+			{Topic: "billing", Function: "invoicer", Namespace: "openfaas-fn", Status: types.StatusFailure, Error: errors.New("expected")},
+		}
+		target.Record("billing", delivery("1"), results, errors.New("1 of 2 function(s) failed"))
+
+		recent := target.Recent("billing")
+		assert.Len(t, recent, 1)
+		assert.Equal(t, "billing", recent[0].RoutingKey)
+		assert.Equal(t, types.StatusFailure, recent[0].Status)
+		assert.Equal(t, "1 of 2 function(s) failed", recent[0].Error)
+		assert.Equal(t, []RecentInvocation{
+			{Function: "biller", Namespace: "openfaas-fn", Status: types.StatusSuccess, LatencyMs: 20},
+			{Function: "invoicer", Namespace: "openfaas-fn", Status: types.StatusFailure, Error: "expected"},
+		}, recent[0].Invocations)
+		assert.Nil(t, recent[0].Body, "Expected the body to be excluded")
+	})
+
+	t.Run("Should only keep the body if enabled", func(t *testing.T) {
+		target := NewRecentMessages(3, true)
+		target.Record("billing", delivery("1"), nil, nil)
+
+		recent := target.Recent("billing")
+		assert.Equal(t, types.StatusSuccess, recent[0].Status)
+		assert.Equal(t, []byte("secret"), recent[0].Body)
+	})
+
+	t.Run("Should record nothing without recent messages", func(t *testing.T) {
+		var target *RecentMessages
+
+		target.Record("billing", delivery("1"), nil, nil)
+		assert.Empty(t, target.Recent("billing"))
+	})
+}
+
+func TestExchange_RecentMessages(t *testing.T) {
+	t.Run("Should record the invoked deliveries under their topic", func(t *testing.T) {
+		results := []types.InvocationResult{{Topic: "Billing", Function: "biller", Status: types.StatusFailure, Error: errors.New("expected")}}
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return(results, errors.New("expected"))
+
+		acker := new(acknowledgerMock)
+		acker.On("Nack", mock.Anything, false, true).Return(nil)
+
+		recent := NewRecentMessages(5, false)
+		target := Exchange{client: invoker, recent: recent, definition: &types.Exchange{Name: "Nasdaq", Topics: []string{"Billing"}}}
+		target.handleInvocation("Billing", amqp.Delivery{Acknowledger: acker, RoutingKey: "Billing", CorrelationId: "42", Body: []byte("Hello World")})
+
+		recorded := recent.Recent("Billing")
+		assert.Len(t, recorded, 1)
+		assert.Equal(t, "42", recorded[0].CorrelationID)
+		assert.Equal(t, types.StatusFailure, recorded[0].Status)
+		assert.Len(t, recorded[0].Invocations, 1)
+	})
+}
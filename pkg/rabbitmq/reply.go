@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"log"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/streadway/amqp"
+)
+
+// ReplyFunctionHeader names the function that produced a reply, as a topic may be subscribed by several functions
+const ReplyFunctionHeader = "x-connector-function"
+
+// reply publishes the response of every invoked function onto the reply_to queue of the delivery, using its
+// correlation id so that the requester can match the reply. Replies are best-effort, as the functions already
+// processed the delivery, a failed publish is logged instead of invoking the delivery again.
+func (e *Exchange) reply(delivery amqp.Delivery, results []types.InvocationResult) {
+	for _, result := range results {
+		err := e.channel.Publish("", delivery.ReplyTo, false, false, newReplyPublishing(delivery, result))
+		if err != nil {
+			log.Printf("Failed to publish reply of function %s for delivery %d onto queue %s due to %s", result.Function, delivery.DeliveryTag, delivery.ReplyTo, err)
+		}
+	}
+}
+
+func newReplyPublishing(delivery amqp.Delivery, result types.InvocationResult) amqp.Publishing {
+	function := result.Function
+	if len(result.Namespace) > 0 {
+		function += "." + result.Namespace
+	}
+
+	return amqp.Publishing{
+		Headers:       amqp.Table{ReplyFunctionHeader: function},
+		CorrelationId: delivery.CorrelationId,
+		Body:          result.Response,
+	}
+}
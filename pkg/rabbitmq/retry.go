@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"github.com/streadway/amqp"
+)
+
+const (
+	// RetryHeader holds the amount of failed delivery attempts of a republished delivery
+	RetryHeader = "x-connector-retries"
+	// RoutingKeyHeader holds the original routing key of a republished delivery
+	RoutingKeyHeader = "x-connector-routing-key"
+)
+
+// RetryCount returns the amount of failed delivery attempts recorded on the delivery
+func RetryCount(delivery amqp.Delivery) int {
+	switch count := delivery.Headers[RetryHeader].(type) {
+	case int:
+		return count
+	case int8:
+		return int(count)
+	case int16:
+		return int(count)
+	case int32:
+		return int(count)
+	case int64:
+		return int(count)
+	default:
+		return 0
+	}
+}
+
+// newRetryPublishing creates a copy of the delivery that records the provided retries. As the copy is
+// published directly onto the queue, the original routing key is preserved in a header.
+func newRetryPublishing(delivery amqp.Delivery, retries int) amqp.Publishing {
+	headers := amqp.Table{}
+	for key, value := range delivery.Headers {
+		headers[key] = value
+	}
+	headers[RetryHeader] = int32(retries)
+	headers[RoutingKeyHeader] = delivery.RoutingKey
+
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     delivery.ContentType,
+		ContentEncoding: delivery.ContentEncoding,
+		DeliveryMode:    delivery.DeliveryMode,
+		Priority:        delivery.Priority,
+		CorrelationId:   delivery.CorrelationId,
+		ReplyTo:         delivery.ReplyTo,
+		Expiration:      delivery.Expiration,
+		MessageId:       delivery.MessageId,
+		Timestamp:       delivery.Timestamp,
+		Type:            delivery.Type,
+		AppId:           delivery.AppId,
+		Body:            delivery.Body,
+	}
+}
+
+// restoreRoutingKey reverts the routing key of deliveries that were republished for a retry
+func restoreRoutingKey(delivery amqp.Delivery) amqp.Delivery {
+	if original, ok := delivery.Headers[RoutingKeyHeader].(string); ok && len(original) > 0 {
+		delivery.RoutingKey = original
+	}
+	return delivery
+}
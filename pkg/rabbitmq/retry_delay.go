@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/backoff"
+	"github.com/streadway/amqp"
+)
+
+// declareRetryDelay declares the delayed message exchange that retries are published onto, if configured. Routing
+// of the exchange is direct, every queue is bound using its name as binding key.
+func (e *Exchange) declareRetryDelay() error {
+	if len(e.retryDelayExchange) == 0 {
+		return nil
+	}
+	return e.channel.ExchangeDeclare(e.retryDelayExchange, delayedExchangeType, true, false, false, false, amqp.Table{"x-delayed-type": "direct"})
+}
+
+// bindRetryDelay binds the queue to the delayed message exchange, so that the delayed retries of its deliveries reach it
+func (e *Exchange) bindRetryDelay(queueName string) error {
+	if len(e.retryDelayExchange) == 0 {
+		return nil
+	}
+	return e.channel.QueueBind(queueName, queueName, e.retryDelayExchange, false, amqp.Table{})
+}
+
+// retryDelay returns the delay before the retry following the failed attempts, calculated using the retry backoff
+func (e *Exchange) retryDelay(attempts int) time.Duration {
+	delays := backoff.New(e.retryBackoff)
+
+	var delay time.Duration
+	for attempt := 0; attempt < attempts; attempt++ {
+		delay = delays.Next()
+	}
+	return delay
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryCount(t *testing.T) {
+	t.Run("Should return 0 if header is absent", func(t *testing.T) {
+		assert.Equal(t, 0, RetryCount(amqp.Delivery{}))
+	})
+
+	t.Run("Should return 0 if header is not a number", func(t *testing.T) {
+		assert.Equal(t, 0, RetryCount(amqp.Delivery{Headers: amqp.Table{RetryHeader: "3"}}))
+	})
+
+	t.Run("Should support the different integer types", func(t *testing.T) {
+		for _, value := range []interface{}{int(3), int8(3), int16(3), int32(3), int64(3)} {
+			assert.Equal(t, 3, RetryCount(amqp.Delivery{Headers: amqp.Table{RetryHeader: value}}))
+		}
+	})
+}
+
+func TestNewRetryPublishing(t *testing.T) {
+	t.Run("Should copy the delivery without altering the original headers", func(t *testing.T) {
+		delivery := amqp.Delivery{
+			Headers:       amqp.Table{"custom": "value"},
+			ContentType:   "application/json",
+			CorrelationId: "abc",
+			RoutingKey:    "Billing",
+			Body:          []byte("{}"),
+		}
+
+		publishing := newRetryPublishing(delivery, 1)
+
+		assert.Equal(t, amqp.Table{"custom": "value", RetryHeader: int32(1), RoutingKeyHeader: "Billing"}, publishing.Headers)
+		assert.Equal(t, amqp.Table{"custom": "value"}, delivery.Headers)
+		assert.Equal(t, "application/json", publishing.ContentType)
+		assert.Equal(t, "abc", publishing.CorrelationId)
+		assert.Equal(t, []byte("{}"), publishing.Body)
+	})
+}
+
+func TestRestoreRoutingKey(t *testing.T) {
+	t.Run("Should restore the routing key of republished deliveries", func(t *testing.T) {
+		delivery := restoreRoutingKey(amqp.Delivery{RoutingKey: "Nasdaq_Billing", Headers: amqp.Table{RoutingKeyHeader: "Billing"}})
+		assert.Equal(t, "Billing", delivery.RoutingKey)
+	})
+
+	t.Run("Should keep the routing key of regular deliveries", func(t *testing.T) {
+		delivery := restoreRoutingKey(amqp.Delivery{RoutingKey: "Billing"})
+		assert.Equal(t, "Billing", delivery.RoutingKey)
+	})
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	// DelayHeader holds the milliseconds the delayed message exchange holds a message back before routing it
+	DelayHeader = "x-delay"
+	// delayedExchangeType is provided by the rabbitmq_delayed_message_exchange plugin
+	delayedExchangeType = "x-delayed-message"
+)
+
+// InFlightDeliveries tracks the deliveries whose function is invoked right now, so that they can be requeued with a
+// delay during shutdown instead of being redelivered right away once the channel is closed. A delivery is settled
+// either by its invocation or by RequeueDelayed, whichever claims it first.
+type InFlightDeliveries struct {
+	exchange string
+	delay    time.Duration
+
+	lock    sync.Mutex
+	next    uint64
+	pending map[uint64]inFlightDelivery
+}
+
+type inFlightDelivery struct {
+	channel  RabbitChannel
+	queue    string
+	delivery amqp.Delivery
+	ack      func(delivery amqp.Delivery)
+}
+
+// NewInFlightDeliveries creates a new tracker, which requeues onto the delayed message exchange with the provided delay
+func NewInFlightDeliveries(delayedExchange string, delay time.Duration) *InFlightDeliveries {
+	return &InFlightDeliveries{exchange: delayedExchange, delay: delay, pending: map[uint64]inFlightDelivery{}}
+}
+
+// track registers the delivery of the queue as in-flight and returns the id its invocation claims it with
+func (d *InFlightDeliveries) track(channel RabbitChannel, queue string, delivery amqp.Delivery, ack func(delivery amqp.Delivery)) uint64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.next++
+	d.pending[d.next] = inFlightDelivery{channel: channel, queue: queue, delivery: delivery, ack: ack}
+	return d.next
+}
+
+// claim removes the delivery and returns whether the caller settles it, it is false once it was requeued
+func (d *InFlightDeliveries) claim(id uint64) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	_, exists := d.pending[id]
+	delete(d.pending, id)
+	return exists
+}
+
+// RequeueDelayed republishes every in-flight delivery onto the delayed message exchange, which routes it back to its
+// queue after the delay, and acknowledges it. The invocations keep running, but their outcome is discarded. If the
+// delayed exchange can not be used, the delivery is left to RabbitMQ, which requeues it once the channel is closed.
+// It returns the amount of requeued deliveries.
+func (d *InFlightDeliveries) RequeueDelayed() int {
+	d.lock.Lock()
+	pending := d.pending
+	d.pending = map[uint64]inFlightDelivery{}
+	d.lock.Unlock()
+
+	declared := map[RabbitChannel]bool{}
+	requeued := 0
+	for _, inFlight := range pending {
+		channel := inFlight.channel
+		if _, attempted := declared[channel]; !attempted {
+			declared[channel] = d.declare(channel)
+		}
+		if !declared[channel] {
+			continue
+		}
+
+		if err := channel.QueueBind(inFlight.queue, inFlight.queue, d.exchange, false, amqp.Table{}); err != nil {
+			log.Printf("Failed to bind queue %s to delayed exchange %s due to %s, will leave delivery %d to be requeued", inFlight.queue, d.exchange, err, inFlight.delivery.DeliveryTag)
+			continue
+		}
+
+		publishing := newRetryPublishing(inFlight.delivery, RetryCount(inFlight.delivery))
+		publishing.Headers[DelayHeader] = int32(d.delay.Milliseconds())
+		if err := channel.Publish(d.exchange, inFlight.queue, false, false, publishing); err != nil {
+			log.Printf("Failed to publish delivery %d onto delayed exchange %s due to %s, will leave it to be requeued", inFlight.delivery.DeliveryTag, d.exchange, err)
+			continue
+		}
+
+		inFlight.ack(inFlight.delivery)
+		requeued++
+	}
+
+	if requeued > 0 {
+		log.Printf("Requeued %d in-flight deliveries with a delay of %s", requeued, d.delay)
+	}
+	return requeued
+}
+
+func (d *InFlightDeliveries) declare(channel RabbitChannel) bool {
+	err := channel.ExchangeDeclare(d.exchange, delayedExchangeType, true, false, false, false, amqp.Table{"x-delayed-type": "direct"})
+	if err != nil {
+		log.Printf("Failed to declare delayed exchange %s due to %s, is the rabbitmq_delayed_message_exchange plugin enabled?", d.exchange, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestInFlightDeliveries_RequeueDelayed(t *testing.T) {
+	definition := types.Exchange{Name: "Nasdaq", Topics: []string{"Billing"}}
+	delayedPublishing := mock.MatchedBy(func(msg amqp.Publishing) bool {
+		return msg.Headers[DelayHeader] == int32(5000) && msg.Headers[RoutingKeyHeader] == "Billing" && string(msg.Body) == "Hello World"
+	})
+
+	pending := func(inFlight *InFlightDeliveries) func() bool {
+		return func() bool {
+			inFlight.lock.Lock()
+			defer inFlight.lock.Unlock()
+			return len(inFlight.pending) == 1
+		}
+	}
+
+	t.Run("Should republish deliveries that did not complete with a delay header instead of requeueing them", func(t *testing.T) {
+		release := make(chan time.Time)
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, errors.New("aborted")).WaitUntil(release)
+
+		channel := new(channelMock)
+		channel.On("ExchangeDeclare", "connector.delayed", "x-delayed-message", true, false, false, false, amqp.Table{"x-delayed-type": "direct"}).Return(nil)
+		channel.On("QueueBind", "Nasdaq_Billing", "Nasdaq_Billing", "connector.delayed", false, amqp.Table{}).Return(nil)
+		channel.On("Publish", "connector.delayed", "Nasdaq_Billing", false, false, delayedPublishing).Return(nil)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", uint64(7), false).Return(nil)
+
+		inFlight := NewInFlightDeliveries("connector.delayed", 5*time.Second)
+		target := Exchange{client: invoker, channel: channel, definition: &definition, inFlight: inFlight}
+
+		done := make(chan struct{})
+		go func() {
+			target.handleInvocation("Billing", amqp.Delivery{Acknowledger: acker, DeliveryTag: 7, RoutingKey: "Billing", Body: []byte("Hello World")})
+			close(done)
+		}()
+		assert.Eventually(t, pending(inFlight), time.Second, time.Millisecond)
+
+		assert.Equal(t, 1, inFlight.RequeueDelayed())
+		close(release)
+		<-done
+
+		channel.AssertExpectations(t)
+		acker.AssertExpectations(t)
+		acker.AssertNotCalled(t, "Nack", mock.Anything, mock.Anything, mock.Anything)
+		acker.AssertNumberOfCalls(t, "Ack", 1)
+	})
+
+	t.Run("Should settle deliveries that completed before as usual", func(t *testing.T) {
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, nil)
+
+		channel := new(channelMock)
+		acker := new(acknowledgerMock)
+		acker.On("Ack", uint64(7), false).Return(nil)
+
+		inFlight := NewInFlightDeliveries("connector.delayed", 5*time.Second)
+		target := Exchange{client: invoker, channel: channel, definition: &definition, inFlight: inFlight}
+
+		target.handleInvocation("Billing", amqp.Delivery{Acknowledger: acker, DeliveryTag: 7, RoutingKey: "Billing", Body: []byte("Hello World")})
+
+		assert.Zero(t, inFlight.RequeueDelayed())
+		acker.AssertExpectations(t)
+		channel.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Should leave deliveries to be requeued if the delayed exchange can not be declared", func(t *testing.T) {
+		release := make(chan time.Time)
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Billing", mock.Anything).Return([]types.InvocationResult{}, nil).WaitUntil(release)
+
+		channel := new(channelMock)
+		channel.On("ExchangeDeclare", "connector.delayed", "x-delayed-message", true, false, false, false, mock.Anything).Return(errors.New("unknown exchange type"))
+
+		acker := new(acknowledgerMock)
+		inFlight := NewInFlightDeliveries("connector.delayed", 5*time.Second)
+		target := Exchange{client: invoker, channel: channel, definition: &definition, inFlight: inFlight}
+
+		done := make(chan struct{})
+		go func() {
+			target.handleInvocation("Billing", amqp.Delivery{Acknowledger: acker, DeliveryTag: 7, RoutingKey: "Billing", Body: []byte("Hello World")})
+			close(done)
+		}()
+		assert.Eventually(t, pending(inFlight), time.Second, time.Millisecond)
+
+		assert.Zero(t, inFlight.RequeueDelayed())
+		close(release)
+		<-done
+
+		channel.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		acker.AssertNotCalled(t, "Ack", mock.Anything, mock.Anything)
+	})
+}
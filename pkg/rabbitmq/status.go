@@ -0,0 +1,296 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/streadway/amqp"
+)
+
+// StatusReporter receives the outcome of invocations in order to keep an audit trail
+type StatusReporter interface {
+	Report(results []types.InvocationResult)
+}
+
+// StatusReporters report the results to every reporter, which allows combining them
+type StatusReporters []StatusReporter
+
+// Report passes the results on to every reporter in order
+func (r StatusReporters) Report(results []types.InvocationResult) {
+	for _, reporter := range r {
+		reporter.Report(results)
+	}
+}
+
+// StatusRecord is the audit record that is published for every invocation outcome
+type StatusRecord struct {
+	Topic         string    `json:"topic"`
+	Function      string    `json:"function"`
+	Namespace     string    `json:"namespace"`
+	Status        string    `json:"status"`
+	LatencyMs     int64     `json:"latency_ms"`
+	Timestamp     time.Time `json:"timestamp"`
+	CorrelationID string    `json:"correlation_id"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// NewStatusRecord converts the provided invocation result into its published representation
+func NewStatusRecord(result types.InvocationResult) StatusRecord {
+	record := StatusRecord{
+		Topic:         result.Topic,
+		Function:      result.Function,
+		Namespace:     result.Namespace,
+		Status:        result.Status,
+		LatencyMs:     result.Latency.Milliseconds(),
+		Timestamp:     result.Timestamp.UTC(),
+		CorrelationID: result.CorrelationID,
+	}
+
+	if result.Error != nil {
+		record.Error = result.Error.Error()
+	}
+
+	return record
+}
+
+// statusBufferSize is the amount of records that can be queued before new records get dropped
+const statusBufferSize = 1024
+
+// StatusPublisher publishes status records to the configured exchange. Publishing is best-effort,
+// records are queued and published in the background, so a slow or failing broker never blocks an invocation.
+type StatusPublisher struct {
+	channel    ChannelPublisher
+	exchange   string
+	routingKey string
+
+	// sample decides which results are published, if absent all of them are
+	sample func(result types.InvocationResult) bool
+	// batchSize of records published together as a compressed json array, if below 2 records are published individually
+	batchSize     int
+	flushInterval time.Duration
+
+	records  chan types.InvocationResult
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewStatusPublisher creates a new publisher and starts publishing queued records onto the provided channel
+func NewStatusPublisher(channel ChannelPublisher, exchange string, routingKey string) *StatusPublisher {
+	p := &StatusPublisher{
+		channel:    channel,
+		exchange:   exchange,
+		routingKey: routingKey,
+
+		records: make(chan types.InvocationResult, statusBufferSize),
+		stop:    make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.run()
+
+	return p
+}
+
+// WithSampling publishes only the provided fraction of results, which bounds the volume of the audit trail. If
+// recordFailures is set, all failed results are published regardless of the rate. It has to be called before
+// the first Report.
+func (p *StatusPublisher) WithSampling(rate float64, recordFailures bool) *StatusPublisher {
+	p.sample = func(result types.InvocationResult) bool {
+		return sampled(result, rate, recordFailures)
+	}
+	return p
+}
+
+// WithBatching publishes up to size records together as a gzip compressed json array, which saves the overhead of
+// many tiny publishes. A partial batch is published once the interval elapsed. Sizes below 2 keep publishing every
+// record individually. It has to be called before the first Report.
+func (p *StatusPublisher) WithBatching(size int, interval time.Duration) *StatusPublisher {
+	if size < 2 {
+		return p
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	// Restarts publishing in the background, so that the batching is picked up
+	close(p.stop)
+	p.wg.Wait()
+
+	p.batchSize = size
+	p.flushInterval = interval
+	p.stop = make(chan struct{})
+	p.wg.Add(1)
+	go p.run()
+
+	return p
+}
+
+// Report queues the provided results for publishing. If the queue is full the records are dropped.
+func (p *StatusPublisher) Report(results []types.InvocationResult) {
+	for _, result := range results {
+		if p.sample != nil && !p.sample(result) {
+			continue
+		}
+
+		select {
+		case p.records <- result:
+		default:
+			log.Printf("Status queue is full, dropping status record for function %s on topic %s", result.Function, result.Topic)
+		}
+	}
+}
+
+// sampled decides whether the result is published. The decision is derived from the correlation id, so that either
+// all or none of the results of a message are published. Results without correlation id are sampled randomly.
+func sampled(result types.InvocationResult, rate float64, recordFailures bool) bool {
+	if rate >= 1 || (recordFailures && result.Status == types.StatusFailure) {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+
+	if len(result.CorrelationID) == 0 {
+		return rand.Float64() < rate // #nosec G404 sampling does not need to be unpredictable
+	}
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(result.CorrelationID))
+	return float64(mix(hash.Sum64()))/math.MaxUint64 < rate
+}
+
+// mix spreads the bits of the hash, as FNV barely changes the high bits for ids that only differ in their suffix
+func mix(hash uint64) uint64 {
+	hash ^= hash >> 33
+	hash *= 0xff51afd7ed558ccd
+	hash ^= hash >> 33
+	hash *= 0xc4ceb9fe1a85ec53
+	hash ^= hash >> 33
+	return hash
+}
+
+// Stop ends publishing, records that are still queued at that point will not be published. With batching, the queued
+// records are published together with the pending batch instead.
+func (p *StatusPublisher) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	p.wg.Wait()
+}
+
+func (p *StatusPublisher) run() {
+	defer p.wg.Done()
+
+	if p.batchSize > 1 {
+		p.runBatched()
+		return
+	}
+
+	for {
+		select {
+		case result := <-p.records:
+			p.publish(result)
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *StatusPublisher) runBatched() {
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]StatusRecord, 0, p.batchSize)
+	add := func(result types.InvocationResult) {
+		batch = append(batch, NewStatusRecord(result))
+		if len(batch) >= p.batchSize {
+			batch = p.publishBatch(batch)
+		}
+	}
+
+	for {
+		select {
+		case result := <-p.records:
+			add(result)
+		case <-ticker.C:
+			batch = p.publishBatch(batch)
+		case <-p.stop:
+			for {
+				select {
+				case result := <-p.records:
+					add(result)
+				default:
+					p.publishBatch(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// publishBatch publishes the records as a single gzip compressed json array and returns the emptied batch
+func (p *StatusPublisher) publishBatch(batch []StatusRecord) []StatusRecord {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	body, err := compressRecords(batch)
+	if err != nil {
+		log.Printf("Failed to compress %d status records due to %s", len(batch), err)
+		return batch[:0]
+	}
+
+	err = p.channel.Publish(p.exchange, p.routingKey, false, false, amqp.Publishing{
+		ContentType:     "application/json",
+		ContentEncoding: "gzip",
+		Timestamp:       time.Now(),
+		Body:            body,
+	})
+	if err != nil {
+		log.Printf("Failed to publish %d status records due to %s", len(batch), err)
+	}
+	return batch[:0]
+}
+
+func compressRecords(records []StatusRecord) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if err := json.NewEncoder(writer).Encode(records); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (p *StatusPublisher) publish(result types.InvocationResult) {
+	body, err := json.Marshal(NewStatusRecord(result))
+	if err != nil {
+		log.Printf("Failed to marshal status record due to %s", err)
+		return
+	}
+
+	err = p.channel.Publish(p.exchange, p.routingKey, false, false, amqp.Publishing{
+		ContentType:   "application/json",
+		CorrelationId: result.CorrelationID,
+		Timestamp:     result.Timestamp,
+		Body:          body,
+	})
+	if err != nil {
+		log.Printf("Failed to publish status record for function %s on topic %s due to %s", result.Function, result.Topic, err)
+	}
+}
@@ -0,0 +1,284 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+type publishedMessage struct {
+	exchange string
+	key      string
+	msg      amqp.Publishing
+}
+
+type publisherStub struct {
+	published chan publishedMessage
+	err       error
+}
+
+func newPublisherStub(err error) *publisherStub {
+	return &publisherStub{published: make(chan publishedMessage, 10), err: err}
+}
+
+func (p *publisherStub) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	p.published <- publishedMessage{exchange: exchange, key: key, msg: msg}
+	return p.err
+}
+
+func (p *publisherStub) await(t *testing.T) publishedMessage {
+	select {
+	case msg := <-p.published:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("expected a status record to be published")
+		return publishedMessage{}
+	}
+}
+
+func TestNewStatusRecord(t *testing.T) {
+	timestamp := time.Date(2021, 3, 14, 15, 9, 26, 0, time.UTC)
+
+	t.Run("Should contain all relevant fields of the invocation", func(t *testing.T) {
+		record := NewStatusRecord(types.InvocationResult{
+			Topic:         "Billing",
+			Function:      "biller",
+			Namespace:     "faas",
+			Status:        types.StatusSuccess,
+			Latency:       42 * time.Millisecond,
+			Timestamp:     timestamp,
+			CorrelationID: "4711",
+		})
+
+		raw, err := json.Marshal(record)
+		assert.NoError(t, err, "should not throw")
+
+		var shape map[string]interface{}
+		_ = json.Unmarshal(raw, &shape)
+
+		assert.Len(t, shape, 7, "should only contain the documented fields")
+		assert.Equal(t, "Billing", shape["topic"])
+		assert.Equal(t, "biller", shape["function"])
+		assert.Equal(t, "faas", shape["namespace"])
+		assert.Equal(t, types.StatusSuccess, shape["status"])
+		assert.EqualValues(t, 42, shape["latency_ms"])
+		assert.Equal(t, "2021-03-14T15:09:26Z", shape["timestamp"])
+		assert.Equal(t, "4711", shape["correlation_id"])
+	})
+
+	t.Run("Should include the error for failed invocations", func(t *testing.T) {
+		record := NewStatusRecord(types.InvocationResult{
+			Function:  "biller",
+			Status:    types.StatusFailure,
+			Timestamp: timestamp,
+			Error:     errors.New("Function biller is not deployed"),
+		})
+
+		assert.Equal(t, types.StatusFailure, record.Status)
+		assert.Equal(t, "Function biller is not deployed", record.Error)
+	})
+}
+
+func TestStatusPublisher_Report(t *testing.T) {
+	result := types.InvocationResult{
+		Topic:         "Billing",
+		Function:      "biller",
+		Status:        types.StatusSuccess,
+		Timestamp:     time.Now(),
+		CorrelationID: "4711",
+	}
+
+	t.Run("Should publish a record for every reported result", func(t *testing.T) {
+		channel := newPublisherStub(nil)
+		target := NewStatusPublisher(channel, "Audit", "connector.status")
+		defer target.Stop()
+
+		target.Report([]types.InvocationResult{result, result})
+
+		for i := 0; i < 2; i++ {
+			published := channel.await(t)
+
+			assert.Equal(t, "Audit", published.exchange)
+			assert.Equal(t, "connector.status", published.key)
+			assert.Equal(t, "application/json", published.msg.ContentType)
+			assert.Equal(t, "4711", published.msg.CorrelationId)
+
+			var record StatusRecord
+			assert.NoError(t, json.Unmarshal(published.msg.Body, &record), "should be valid json")
+			assert.Equal(t, "biller", record.Function)
+		}
+	})
+
+	t.Run("Should swallow publishing errors", func(t *testing.T) {
+		channel := newPublisherStub(errors.New("channel closed"))
+		target := NewStatusPublisher(channel, "Audit", "connector.status")
+		defer target.Stop()
+
+		target.Report([]types.InvocationResult{result})
+		channel.await(t)
+
+		target.Report([]types.InvocationResult{result})
+		channel.await(t)
+	})
+
+	t.Run("Should not block if the queue is full", func(t *testing.T) {
+		target := &StatusPublisher{records: make(chan types.InvocationResult, 1)}
+
+		done := make(chan struct{})
+		go func() {
+			target.Report([]types.InvocationResult{result, result, result})
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("report should not block")
+		}
+	})
+}
+
+func TestStatusPublisher_Sampling(t *testing.T) {
+	const total = 2000
+
+	results := make([]types.InvocationResult, 0, 2*total)
+	for i := 0; i < total; i++ {
+		id := fmt.Sprintf("message-%d", i)
+		results = append(results,
+			types.InvocationResult{Topic: "Billing", Function: "biller", Status: types.StatusSuccess, CorrelationID: id},
+			types.InvocationResult{Topic: "Billing", Function: "invoicer", Status: types.StatusFailure, CorrelationID: id},
+		)
+	}
+
+	count := func(rate float64, recordFailures bool) (int, int) {
+		target := &StatusPublisher{}
+		target.WithSampling(rate, recordFailures)
+
+		var successes, failures int
+		for _, result := range results {
+			if !target.sample(result) {
+				continue
+			}
+			if result.Status == types.StatusSuccess {
+				successes++
+			} else {
+				failures++
+			}
+		}
+		return successes, failures
+	}
+
+	t.Run("Should publish about the configured fraction of successes and all failures", func(t *testing.T) {
+		successes, failures := count(0.1, true)
+
+		assert.InDelta(t, 0.1*total, successes, 0.02*total, "Expected about 10%% of the successes")
+		assert.Equal(t, total, failures, "Expected all failures")
+	})
+
+	t.Run("Should sample failures as well unless they are always recorded", func(t *testing.T) {
+		successes, failures := count(0.25, false)
+
+		assert.InDelta(t, 0.25*total, successes, 0.03*total, "Expected about 25%% of the successes")
+		assert.Equal(t, successes, failures, "Expected results of the same message to share the decision")
+	})
+
+	t.Run("Should publish everything or only failures at the bounds", func(t *testing.T) {
+		successes, failures := count(1, false)
+		assert.Equal(t, total, successes)
+		assert.Equal(t, total, failures)
+
+		successes, failures = count(0, true)
+		assert.Equal(t, 0, successes)
+		assert.Equal(t, total, failures)
+	})
+
+	t.Run("Should only queue sampled results", func(t *testing.T) {
+		target := &StatusPublisher{records: make(chan types.InvocationResult, 2*total)}
+		target.WithSampling(0.1, true)
+
+		target.Report(results)
+
+		assert.InDelta(t, 1.1*total, len(target.records), 0.02*total)
+	})
+}
+
+func decompressRecords(t *testing.T, published publishedMessage) []StatusRecord {
+	assert.Equal(t, "gzip", published.msg.ContentEncoding)
+	assert.Equal(t, "application/json", published.msg.ContentType)
+
+	reader, err := gzip.NewReader(bytes.NewReader(published.msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []StatusRecord
+	assert.NoError(t, json.NewDecoder(reader).Decode(&records), "should be a compressed json array")
+	return records
+}
+
+func TestStatusPublisher_Batching(t *testing.T) {
+	result := types.InvocationResult{Topic: "Billing", Function: "biller", Status: types.StatusSuccess, Timestamp: time.Now()}
+
+	t.Run("Should publish full batches as a single compressed message", func(t *testing.T) {
+		channel := newPublisherStub(nil)
+		target := NewStatusPublisher(channel, "Audit", "connector.status").WithBatching(3, time.Hour)
+		defer target.Stop()
+
+		target.Report([]types.InvocationResult{result, result, result, result})
+
+		published := channel.await(t)
+		assert.Equal(t, "Audit", published.exchange)
+		assert.Equal(t, "connector.status", published.key)
+		records := decompressRecords(t, published)
+		assert.Len(t, records, 3)
+		assert.Equal(t, "biller", records[0].Function)
+		assert.Empty(t, channel.published, "Expected the partial batch to be held back")
+	})
+
+	t.Run("Should publish partial batches once the interval elapsed", func(t *testing.T) {
+		channel := newPublisherStub(nil)
+		target := NewStatusPublisher(channel, "Audit", "connector.status").WithBatching(100, 20*time.Millisecond)
+		defer target.Stop()
+
+		target.Report([]types.InvocationResult{result, result})
+
+		assert.Len(t, decompressRecords(t, channel.await(t)), 2)
+	})
+
+	t.Run("Should publish the pending batch and queued records on stop", func(t *testing.T) {
+		channel := newPublisherStub(nil)
+		target := NewStatusPublisher(channel, "Audit", "connector.status").WithBatching(100, time.Hour)
+
+		target.Report([]types.InvocationResult{result, result, result})
+		target.Stop()
+
+		assert.Len(t, decompressRecords(t, channel.await(t)), 3)
+		assert.Empty(t, channel.published, "Expected a single message")
+	})
+
+	t.Run("Should publish individually below a batch size of 2", func(t *testing.T) {
+		channel := newPublisherStub(nil)
+		target := NewStatusPublisher(channel, "Audit", "connector.status").WithBatching(1, time.Hour)
+		defer target.Stop()
+
+		target.Report([]types.InvocationResult{result})
+
+		published := channel.await(t)
+		assert.Empty(t, published.msg.ContentEncoding)
+		var record StatusRecord
+		assert.NoError(t, json.Unmarshal(published.msg.Body, &record), "should be valid json")
+	})
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// StreamOffsetArgument selects the offset a consumer of a stream queue starts at
+	StreamOffsetArgument = "x-stream-offset"
+	// StreamOffsetNext consumes only the messages published after the consumer started
+	StreamOffsetNext = "next"
+	// streamPrefetchCount of unacknowledged deliveries, RabbitMQ requires a prefetch for consumers of stream queues
+	streamPrefetchCount = 100
+)
+
+// StreamCheckpoints persist the committed offset of every stream queue, so that a restarted connector resumes
+// after it. An offset is committed once it and all offsets delivered before it were acknowledged, which preserves
+// at-least-once delivery as the uncommitted ones are consumed again. The offsets are kept per consumer reference,
+// which allows connectors consuming the same streams to share a file. A nil StreamCheckpoints commits nothing.
+type StreamCheckpoints struct {
+	fs        afero.Fs
+	path      string
+	reference string
+
+	lock sync.Mutex
+	// committed is the highest committed offset of every queue
+	committed map[string]int64
+	// pending are the offsets delivered since the queue was resumed, in order, and whether they were acknowledged
+	pending map[string]*pendingOffsets
+	dirty   bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type pendingOffsets struct {
+	offsets []int64
+	acked   map[int64]bool
+}
+
+// NewStreamCheckpoints creates checkpoints of the consumer reference, which are persisted as json to the path
+func NewStreamCheckpoints(fs afero.Fs, path string, reference string) *StreamCheckpoints {
+	return &StreamCheckpoints{
+		fs:        fs,
+		path:      path,
+		reference: reference,
+		committed: map[string]int64{},
+		pending:   map[string]*pendingOffsets{},
+	}
+}
+
+// Load reads the committed offsets of the consumer reference, a missing file is treated as no offsets committed
+func (c *StreamCheckpoints) Load() error {
+	if c == nil {
+		return nil
+	}
+
+	all, err := c.read()
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for queue, offset := range all[c.reference] {
+		c.committed[queue] = offset
+	}
+	return nil
+}
+
+// Resume returns the x-stream-offset a consumer of the queue starts at, which is the one after the committed offset.
+// Without committed offset only new messages are consumed. Offsets the queue delivered before are forgotten, as they
+// are delivered again.
+func (c *StreamCheckpoints) Resume(queue string) interface{} {
+	if c == nil {
+		return StreamOffsetNext
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.pending[queue] = &pendingOffsets{acked: map[int64]bool{}}
+	if offset, exists := c.committed[queue]; exists {
+		return offset + 1
+	}
+	return StreamOffsetNext
+}
+
+// Delivered records that the offset of the queue was delivered, offsets have to be delivered in order
+func (c *StreamCheckpoints) Delivered(queue string, offset int64) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	pending, exists := c.pending[queue]
+	if !exists {
+		pending = &pendingOffsets{acked: map[int64]bool{}}
+		c.pending[queue] = pending
+	}
+	pending.offsets = append(pending.offsets, offset)
+}
+
+// Acked records that the offset of the queue was acknowledged, which commits it and the contiguous acknowledged
+// offsets after it once all offsets delivered before it were acknowledged as well
+func (c *StreamCheckpoints) Acked(queue string, offset int64) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	pending, exists := c.pending[queue]
+	if !exists {
+		return
+	}
+	pending.acked[offset] = true
+
+	for len(pending.offsets) > 0 && pending.acked[pending.offsets[0]] {
+		committed := pending.offsets[0]
+		delete(pending.acked, committed)
+		pending.offsets = pending.offsets[1:]
+
+		c.committed[queue] = committed
+		c.dirty = true
+	}
+}
+
+// Committed returns the committed offset of the queue
+func (c *StreamCheckpoints) Committed(queue string) (int64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	offset, exists := c.committed[queue]
+	return offset, exists
+}
+
+// Start persists the committed offsets every interval until Stop is called
+func (c *StreamCheckpoints) Start(interval time.Duration) {
+	if c == nil {
+		return
+	}
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+
+	go func() {
+		defer close(c.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.Flush(); err != nil {
+					log.Printf("Failed to persist stream offsets to %s due to %s", c.path, err)
+				}
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the interval and persists the offsets committed since the last flush
+func (c *StreamCheckpoints) Stop() error {
+	if c == nil {
+		return nil
+	}
+	if c.stop != nil {
+		close(c.stop)
+		<-c.done
+		c.stop = nil
+	}
+	return c.Flush()
+}
+
+// Flush persists the committed offsets, if they changed since the last flush. The offsets of other consumer
+// references are kept. The file is replaced atomically, so that a crash does not leave it partially written.
+func (c *StreamCheckpoints) Flush() error {
+	if c == nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	all, err := c.read()
+	if err != nil {
+		return err
+	}
+	offsets := make(map[string]int64, len(c.committed))
+	for queue, offset := range c.committed {
+		offsets[queue] = offset
+	}
+	all[c.reference] = offsets
+
+	content, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := afero.WriteFile(c.fs, c.path+".tmp", content, 0644); err != nil {
+		return err
+	}
+	if err := c.fs.Rename(c.path+".tmp", c.path); err != nil {
+		return err
+	}
+
+	c.dirty = false
+	return nil
+}
+
+// read returns the offsets of all consumer references within the file
+func (c *StreamCheckpoints) read() (map[string]map[string]int64, error) {
+	all := map[string]map[string]int64{}
+
+	content, err := afero.ReadFile(c.fs, c.path)
+	if os.IsNotExist(err) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stream offsets %s can not be read: %s", c.path, err)
+	}
+	if err := json.Unmarshal(content, &all); err != nil {
+		return nil, fmt.Errorf("stream offsets %s are invalid: %s", c.path, err)
+	}
+	return all, nil
+}
+
+// StreamOffset returns the offset of a delivery from a stream queue
+func StreamOffset(delivery amqp.Delivery) (int64, bool) {
+	offset, ok := delivery.Headers[StreamOffsetArgument].(int64)
+	return offset, ok
+}
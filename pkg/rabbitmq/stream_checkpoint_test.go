@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/spf13/afero"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestStreamCheckpoints(t *testing.T) {
+	t.Run("Should commit an offset once all offsets before it were acknowledged", func(t *testing.T) {
+		target := NewStreamCheckpoints(afero.NewMemMapFs(), "offsets.json", "connector")
+		assert.Equal(t, StreamOffsetNext, target.Resume("Events_Orders"), "Expected new messages without committed offset")
+
+		for offset := int64(10); offset < 14; offset++ {
+			target.Delivered("Events_Orders", offset)
+		}
+
+		target.Acked("Events_Orders", 11)
+		_, committed := target.Committed("Events_Orders")
+		assert.False(t, committed, "Expected no commit while offset 10 is in-flight")
+
+		target.Acked("Events_Orders", 10)
+		offset, _ := target.Committed("Events_Orders")
+		assert.Equal(t, int64(11), offset)
+
+		target.Acked("Events_Orders", 13)
+		offset, _ = target.Committed("Events_Orders")
+		assert.Equal(t, int64(11), offset, "Expected no commit while offset 12 is in-flight")
+	})
+
+	t.Run("Should keep the offsets of other consumer references", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		_ = afero.WriteFile(fs, "offsets.json", []byte(`{"other": {"Events_Orders": 99}}`), 0644)
+
+		target := NewStreamCheckpoints(fs, "offsets.json", "connector")
+		assert.NoError(t, target.Load(), "should not throw")
+		target.Resume("Events_Orders")
+		target.Delivered("Events_Orders", 5)
+		target.Acked("Events_Orders", 5)
+		assert.NoError(t, target.Flush(), "should not throw")
+
+		content, _ := afero.ReadFile(fs, "offsets.json")
+		assert.JSONEq(t, `{"connector": {"Events_Orders": 5}, "other": {"Events_Orders": 99}}`, string(content))
+	})
+
+	t.Run("Should fail to load invalid offsets", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		_ = afero.WriteFile(fs, "offsets.json", []byte(`[]`), 0644)
+
+		assert.Error(t, NewStreamCheckpoints(fs, "offsets.json", "connector").Load())
+	})
+
+	t.Run("Should commit nothing without checkpoints", func(t *testing.T) {
+		var target *StreamCheckpoints
+
+		target.Delivered("Events_Orders", 1)
+		target.Acked("Events_Orders", 1)
+
+		assert.Equal(t, StreamOffsetNext, target.Resume("Events_Orders"))
+		assert.NoError(t, target.Stop())
+	})
+}
+
+func TestExchange_StreamCheckpoints(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	definition := types.Exchange{Name: "Events", Topics: []string{"Orders"}, Stream: true}
+
+	// consume runs an exchange until the deliveries of the offsets were settled, the one of the failing offset is nacked
+	consume := func(checkpoints *StreamCheckpoints, resumeAt interface{}, offsets []int64, failing int64) *channelMock {
+		var settled sync.WaitGroup
+		settled.Add(len(offsets))
+
+		acknowledger := new(acknowledgerMock)
+		acknowledger.On("Ack", mock.Anything, false).Return(nil).Run(func(mock.Arguments) { settled.Done() })
+		acknowledger.On("Nack", mock.Anything, false, true).Return(nil).Run(func(mock.Arguments) { settled.Done() })
+
+		invoker := new(invokerMock)
+		invoker.On("Invoke", "Orders", mock.MatchedBy(func(invocation *types.OpenFaaSInvocation) bool {
+			return string(*invocation.Message) != "failing"
+		})).Return([]types.InvocationResult{}, nil)
+		invoker.On("Invoke", "Orders", mock.Anything).Return([]types.InvocationResult{}, errors.New("expected"))
+
+		deliveries := make(chan amqp.Delivery, len(offsets))
+		for i, offset := range offsets {
+			body := "order"
+			if offset == failing {
+				body = "failing"
+			}
+			deliveries <- amqp.Delivery{
+				Acknowledger: acknowledger,
+				DeliveryTag:  uint64(i + 1),
+				ConsumerTag:  "Events_Orders",
+				RoutingKey:   "Orders",
+				Headers:      amqp.Table{StreamOffsetArgument: offset},
+				Body:         []byte(body),
+			}
+		}
+		close(deliveries)
+
+		channel := new(channelMock)
+		channel.On("NotifyClose", mock.Anything).Return(make(chan *amqp.Error))
+		channel.On("Qos", streamPrefetchCount, 0, false).Return(nil)
+		channel.On("Consume", "Events_Orders", "Events_Orders", false, false, false, false, amqp.Table{StreamOffsetArgument: resumeAt}).Return((<-chan amqp.Delivery)(deliveries), nil)
+		channel.On("Cancel", "Events_Orders", false).Return(nil)
+
+		target := NewExchange(channel, invoker, &definition, ExchangeOptions{Checkpoints: checkpoints})
+		assert.NoError(t, target.Start(), "should not throw")
+		settled.Wait()
+		// Waits for the settled deliveries to be committed
+		target.(Drainer).Drain()
+		return channel
+	}
+
+	t.Run("Should resume after the last committed offset once restarted", func(t *testing.T) {
+		checkpoints := NewStreamCheckpoints(fs, "offsets.json", "connector")
+		assert.NoError(t, checkpoints.Load(), "should not throw")
+		checkpoints.Start(time.Hour)
+
+		channel := consume(checkpoints, StreamOffsetNext, []int64{0, 1, 2, 3}, 2)
+		channel.AssertExpectations(t)
+		assert.NoError(t, checkpoints.Stop(), "should persist the offsets")
+
+		restarted := NewStreamCheckpoints(fs, "offsets.json", "connector")
+		assert.NoError(t, restarted.Load(), "should not throw")
+		offset, _ := restarted.Committed("Events_Orders")
+		assert.Equal(t, int64(1), offset, "Expected the commit to stop before the failed offset")
+
+		channel = consume(restarted, int64(2), []int64{2, 3}, -1)
+		channel.AssertExpectations(t)
+		offset, _ = restarted.Committed("Events_Orders")
+		assert.Equal(t, int64(3), offset)
+	})
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	// TopicSourceRoutingKey uses the routing key of a delivery as topic
+	TopicSourceRoutingKey = "routing-key"
+	// TopicSourceHeaderPrefix uses the value of the named header as topic, e.g. header:eventType
+	TopicSourceHeaderPrefix = "header:"
+	// TopicSourceJSONPathPrefix uses the value found at the path within the json body as topic, e.g. jsonpath:$.meta.eventType
+	TopicSourceJSONPathPrefix = "jsonpath:"
+)
+
+// TopicExtractor determines the topic of a delivery, which is used to look up the subscribed functions.
+// It reports false if the delivery does not contain a topic.
+type TopicExtractor interface {
+	Extract(delivery amqp.Delivery) (string, bool)
+}
+
+// NewTopicExtractor creates the extractor matching the provided source. An empty source
+// will fallback to the routing key.
+func NewTopicExtractor(source string) (TopicExtractor, error) {
+	switch {
+	case source == "" || source == TopicSourceRoutingKey:
+		return &RoutingKeyExtractor{}, nil
+	case strings.HasPrefix(source, TopicSourceHeaderPrefix):
+		name := strings.TrimPrefix(source, TopicSourceHeaderPrefix)
+		if len(name) == 0 {
+			return nil, fmt.Errorf("topic source %s is missing the header name", source)
+		}
+		return &HeaderExtractor{name: name}, nil
+	case strings.HasPrefix(source, TopicSourceJSONPathPrefix):
+		path, err := parseJSONPath(strings.TrimPrefix(source, TopicSourceJSONPathPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("topic source %s is invalid: %s", source, err)
+		}
+		return &JSONPathExtractor{path: path}, nil
+	default:
+		return nil, fmt.Errorf("topic source %s is not one of routing-key, header:<name> or jsonpath:<expr>", source)
+	}
+}
+
+// RoutingKeyExtractor uses the routing key of the delivery as topic
+type RoutingKeyExtractor struct{}
+
+// Extract returns the routing key of the delivery
+func (e *RoutingKeyExtractor) Extract(delivery amqp.Delivery) (string, bool) {
+	return delivery.RoutingKey, len(delivery.RoutingKey) > 0
+}
+
+// HeaderExtractor uses the value of a header as topic
+type HeaderExtractor struct {
+	name string
+}
+
+// Extract returns the value of the configured header. Header names are matched case-insensitive.
+func (e *HeaderExtractor) Extract(delivery amqp.Delivery) (string, bool) {
+	value, exists := delivery.Headers[e.name]
+	if !exists {
+		for key, candidate := range delivery.Headers {
+			if strings.EqualFold(key, e.name) {
+				value, exists = candidate, true
+				break
+			}
+		}
+	}
+
+	if !exists {
+		return "", false
+	}
+
+	return stringify(value)
+}
+
+// JSONPathExtractor uses the value at a path within the json body as topic
+type JSONPathExtractor struct {
+	path []string
+}
+
+// Extract parses the body of the delivery and returns the value found at the configured path. Only the
+// objects and arrays along the path are decoded, which avoids decoding unrelated parts of large bodies.
+func (e *JSONPathExtractor) Extract(delivery amqp.Delivery) (string, bool) {
+	current := json.RawMessage(delivery.Body)
+
+	for _, segment := range e.path {
+		next, ok := descend(current, segment)
+		if !ok {
+			return "", false
+		}
+		current = next
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(current, &value); err != nil {
+		return "", false
+	}
+
+	return stringify(value)
+}
+
+// descend returns the raw value of the key or index segment within the provided object or array
+func descend(raw json.RawMessage, segment string) (json.RawMessage, bool) {
+	trimmed := bytes.TrimLeft(raw, " \t\r\n")
+	if len(trimmed) == 0 {
+		return nil, false
+	}
+
+	switch trimmed[0] {
+	case '{':
+		var node map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &node); err != nil {
+			return nil, false
+		}
+		value, exists := node[segment]
+		return value, exists
+	case '[':
+		index, err := strconv.Atoi(segment)
+		if err != nil || index < 0 {
+			return nil, false
+		}
+
+		var node []json.RawMessage
+		if err := json.Unmarshal(trimmed, &node); err != nil || index >= len(node) {
+			return nil, false
+		}
+		return node[index], true
+	default:
+		return nil, false
+	}
+}
+
+// parseJSONPath supports a simple subset of jsonpath, which are dot separated keys and array indices
+// like $.events[0].type. The leading $ is optional.
+func parseJSONPath(expr string) ([]string, error) {
+	expr = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(expr), "$"), ".")
+	if len(expr) == 0 {
+		return nil, fmt.Errorf("path is empty")
+	}
+
+	expr = strings.ReplaceAll(strings.ReplaceAll(expr, "[", "."), "]", "")
+
+	segments := strings.Split(expr, ".")
+	for _, segment := range segments {
+		if len(segment) == 0 {
+			return nil, fmt.Errorf("path contains an empty segment")
+		}
+	}
+
+	return segments, nil
+}
+
+func stringify(value interface{}) (string, bool) {
+	var topic string
+
+	switch v := value.(type) {
+	case string:
+		topic = v
+	case []byte:
+		topic = string(v)
+	case float64:
+		topic = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool, int, int8, int16, int32, int64:
+		topic = fmt.Sprint(v)
+	default:
+		return "", false
+	}
+
+	topic = strings.TrimSpace(topic)
+	return topic, len(topic) > 0
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTopicExtractor(t *testing.T) {
+	t.Run("Should default to routing key", func(t *testing.T) {
+		extractor, err := NewTopicExtractor("")
+
+		assert.NoError(t, err, "should not throw")
+		assert.IsType(t, &RoutingKeyExtractor{}, extractor)
+	})
+
+	t.Run("Should create extractor for each supported source", func(t *testing.T) {
+		routing, _ := NewTopicExtractor("routing-key")
+		header, _ := NewTopicExtractor("header:eventType")
+		jsonPath, _ := NewTopicExtractor("jsonpath:$.eventType")
+
+		assert.IsType(t, &RoutingKeyExtractor{}, routing)
+		assert.IsType(t, &HeaderExtractor{}, header)
+		assert.IsType(t, &JSONPathExtractor{}, jsonPath)
+	})
+
+	t.Run("Should reject invalid sources", func(t *testing.T) {
+		for _, source := range []string{"header:", "jsonpath:$", "jsonpath:a..b", "body"} {
+			_, err := NewTopicExtractor(source)
+			assert.Error(t, err, "should throw for %s", source)
+		}
+	})
+}
+
+func TestRoutingKeyExtractor_Extract(t *testing.T) {
+	extractor, _ := NewTopicExtractor("routing-key")
+
+	t.Run("Should return routing key", func(t *testing.T) {
+		topic, ok := extractor.Extract(amqp.Delivery{RoutingKey: "Billing"})
+
+		assert.True(t, ok, "should find topic")
+		assert.Equal(t, "Billing", topic)
+	})
+
+	t.Run("Should report missing routing key", func(t *testing.T) {
+		_, ok := extractor.Extract(amqp.Delivery{})
+		assert.False(t, ok, "should not find topic")
+	})
+}
+
+func TestHeaderExtractor_Extract(t *testing.T) {
+	extractor, _ := NewTopicExtractor("header:eventType")
+
+	t.Run("Should return header value", func(t *testing.T) {
+		topic, ok := extractor.Extract(amqp.Delivery{RoutingKey: "Events", Headers: amqp.Table{"eventType": "order.created"}})
+
+		assert.True(t, ok, "should find topic")
+		assert.Equal(t, "order.created", topic)
+	})
+
+	t.Run("Should match header name case-insensitive", func(t *testing.T) {
+		topic, ok := extractor.Extract(amqp.Delivery{Headers: amqp.Table{"EventType": []byte("order.created")}})
+
+		assert.True(t, ok, "should find topic")
+		assert.Equal(t, "order.created", topic)
+	})
+
+	t.Run("Should report missing or empty header", func(t *testing.T) {
+		_, ok := extractor.Extract(amqp.Delivery{RoutingKey: "Events", Headers: amqp.Table{"other": "value"}})
+		assert.False(t, ok, "should not find topic")
+
+		_, ok = extractor.Extract(amqp.Delivery{Headers: amqp.Table{"eventType": " "}})
+		assert.False(t, ok, "should not accept whitespace topic")
+	})
+}
+
+func TestJSONPathExtractor_Extract(t *testing.T) {
+	t.Run("Should return value of top level field", func(t *testing.T) {
+		extractor, _ := NewTopicExtractor("jsonpath:$.eventType")
+		topic, ok := extractor.Extract(amqp.Delivery{Body: []byte(`{"eventType": "order.created"}`)})
+
+		assert.True(t, ok, "should find topic")
+		assert.Equal(t, "order.created", topic)
+	})
+
+	t.Run("Should return value of nested fields and array elements", func(t *testing.T) {
+		extractor, _ := NewTopicExtractor("jsonpath:meta.events[1].type")
+		topic, ok := extractor.Extract(amqp.Delivery{Body: []byte(`{"meta": {"events": [{"type": "a"}, {"type": "b"}]}}`)})
+
+		assert.True(t, ok, "should find topic")
+		assert.Equal(t, "b", topic)
+	})
+
+	t.Run("Should report missing field", func(t *testing.T) {
+		extractor, _ := NewTopicExtractor("jsonpath:$.eventType")
+		_, ok := extractor.Extract(amqp.Delivery{Body: []byte(`{"type": "order.created"}`)})
+
+		assert.False(t, ok, "should not find topic")
+	})
+
+	t.Run("Should report malformed body", func(t *testing.T) {
+		extractor, _ := NewTopicExtractor("jsonpath:$.eventType")
+		_, ok := extractor.Extract(amqp.Delivery{Body: []byte(`Hello World`)})
+
+		assert.False(t, ok, "should not find topic")
+	})
+
+	t.Run("Should report non scalar values", func(t *testing.T) {
+		extractor, _ := NewTopicExtractor("jsonpath:$.meta")
+		_, ok := extractor.Extract(amqp.Delivery{Body: []byte(`{"meta": {"eventType": "order.created"}}`)})
+
+		assert.False(t, ok, "should not find topic")
+	})
+}
+
+func BenchmarkTopicExtraction(b *testing.B) {
+	delivery := amqp.Delivery{
+		RoutingKey: "billing",
+		Headers:    amqp.Table{"eventType": "billing", "tenant": "acme"},
+		Body:       []byte(`{"meta":{"eventType":"billing","tenant":"acme"},"items":[{"sku":"a","amount":1},{"sku":"b","amount":2}],"note":"` + strings.Repeat("x", 512) + `"}`),
+	}
+
+	for _, source := range []string{"routing-key", "header:eventType", "jsonpath:$.meta.eventType"} {
+		extractor, _ := NewTopicExtractor(source)
+
+		b.Run(source, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, ok := extractor.Extract(delivery); !ok {
+					b.Fatal("expected topic")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"context"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/streadway/amqp"
+)
+
+// TraceContext extracts the W3C trace context and baggage from the headers of the delivery
+func TraceContext(delivery amqp.Delivery) types.TraceContext {
+	headers := AMQPHeaderCarrier(delivery.Headers)
+	return types.NewTraceContext(
+		headers.Get(types.TraceParentHeader),
+		headers.Get(types.TraceStateHeader),
+		headers.Get(types.BaggageHeader),
+	)
+}
+
+// ContextFromDelivery restores the W3C trace context and baggage of the delivery into the context, see
+// types.TracePropagator
+func ContextFromDelivery(ctx context.Context, delivery amqp.Delivery) context.Context {
+	return types.TracePropagator.Extract(ctx, AMQPHeaderCarrier(delivery.Headers))
+}
+
+// AMQPHeaderCarrier adapts the headers of a message to the propagation.TextMapCarrier of OpenTelemetry
+type AMQPHeaderCarrier amqp.Table
+
+// Get returns the header as string, publishers set text headers either as string or byte array
+func (c AMQPHeaderCarrier) Get(key string) string {
+	switch value := c[key].(type) {
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	default:
+		return ""
+	}
+}
+
+// Set sets the header as string
+func (c AMQPHeaderCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+// Keys lists the names of all headers
+func (c AMQPHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
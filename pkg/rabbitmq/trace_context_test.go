@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTraceContext(t *testing.T) {
+	t.Run("Should extract the trace context and the baggage", func(t *testing.T) {
+		trace := TraceContext(amqp.Delivery{Headers: amqp.Table{
+			types.TraceParentHeader: traceParent,
+			types.TraceStateHeader:  []byte("congo=t61rcWkgMzE"),
+			types.BaggageHeader:     "tenant=acme,experiment=blue",
+		}})
+
+		assert.Equal(t, types.TraceContext{TraceParent: traceParent, TraceState: "congo=t61rcWkgMzE", Baggage: "tenant=acme,experiment=blue"}, trace)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", trace.TraceID())
+	})
+
+	t.Run("Should discard an invalid traceparent together with the tracestate", func(t *testing.T) {
+		for _, invalid := range []string{
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+			"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		} {
+			trace := TraceContext(amqp.Delivery{Headers: amqp.Table{
+				types.TraceParentHeader: invalid,
+				types.TraceStateHeader:  "congo=t61rcWkgMzE",
+				types.BaggageHeader:     "tenant=acme",
+			}})
+
+			assert.Equal(t, types.TraceContext{Baggage: "tenant=acme"}, trace, "Expected %s to be invalid", invalid)
+		}
+	})
+
+	t.Run("Should accept future versions with further fields", func(t *testing.T) {
+		future := "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"
+		trace := TraceContext(amqp.Delivery{Headers: amqp.Table{types.TraceParentHeader: future}})
+
+		assert.Equal(t, future, trace.TraceParent)
+	})
+
+	t.Run("Should be empty without headers", func(t *testing.T) {
+		assert.True(t, TraceContext(amqp.Delivery{}).IsEmpty())
+	})
+}
+
+func TestContextFromDelivery(t *testing.T) {
+	t.Run("Should restore the trace context and the baggage into the context", func(t *testing.T) {
+		ctx := ContextFromDelivery(context.Background(), amqp.Delivery{Headers: amqp.Table{
+			types.TraceParentHeader: []byte(traceParent),
+			types.TraceStateHeader:  "congo=t61rcWkgMzE",
+			types.BaggageHeader:     "tenant=acme,experiment=blue",
+		}})
+
+		span := trace.SpanContextFromContext(ctx)
+		assert.True(t, span.IsRemote(), "Expected the span context of the producer")
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", span.SpanID().String())
+		assert.Equal(t, "congo=t61rcWkgMzE", span.TraceState().String())
+		assert.Equal(t, "acme", baggage.FromContext(ctx).Member("tenant").Value())
+		assert.Equal(t, "blue", baggage.FromContext(ctx).Member("experiment").Value())
+	})
+
+	t.Run("Should keep the baggage of an invalid traceparent", func(t *testing.T) {
+		ctx := ContextFromDelivery(context.Background(), amqp.Delivery{Headers: amqp.Table{
+			types.TraceParentHeader: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			types.BaggageHeader:     "tenant=acme",
+		}})
+
+		assert.False(t, trace.SpanContextFromContext(ctx).IsValid())
+		assert.Equal(t, "acme", baggage.FromContext(ctx).Member("tenant").Value())
+	})
+}
+
+func TestAMQPHeaderCarrier(t *testing.T) {
+	t.Run("Should read string and byte array headers", func(t *testing.T) {
+		carrier := AMQPHeaderCarrier{"tracestate": []byte("congo=t61rcWkgMzE"), "baggage": "tenant=acme", "x-connector-retries": int32(1)}
+
+		assert.Equal(t, "congo=t61rcWkgMzE", carrier.Get("tracestate"))
+		assert.Equal(t, "tenant=acme", carrier.Get("baggage"))
+		assert.Empty(t, carrier.Get("x-connector-retries"), "Expected non text headers to be ignored")
+		assert.ElementsMatch(t, []string{"tracestate", "baggage", "x-connector-retries"}, carrier.Keys())
+	})
+
+	t.Run("Should inject the trace context as string headers", func(t *testing.T) {
+		carrier := AMQPHeaderCarrier{}
+		types.TracePropagator.Inject(ContextFromDelivery(context.Background(), amqp.Delivery{Headers: amqp.Table{types.TraceParentHeader: traceParent}}), carrier)
+
+		assert.Equal(t, AMQPHeaderCarrier{types.TraceParentHeader: traceParent}, carrier)
+	})
+}
+
+type contextInvokerMock struct {
+	invokerMock
+}
+
+func (m *contextInvokerMock) InvokeContext(ctx context.Context, topic string, invocation *types.OpenFaaSInvocation) ([]types.InvocationResult, error) {
+	args := m.Called(ctx, topic, invocation)
+	return args.Get(0).([]types.InvocationResult), args.Error(1)
+}
+
+func TestExchange_TraceContext(t *testing.T) {
+	t.Run("Should pass the trace context of the delivery to the invoker", func(t *testing.T) {
+		withTrace := mock.MatchedBy(func(ctx context.Context) bool {
+			return types.TraceFromContext(ctx) == types.TraceContext{TraceParent: traceParent, Baggage: "tenant=acme"}
+		})
+		invoker := new(contextInvokerMock)
+		invoker.On("InvokeContext", withTrace, "Billing", mock.Anything).Return([]types.InvocationResult{}, nil)
+
+		acker := new(acknowledgerMock)
+		acker.On("Ack", mock.Anything, false).Return(nil)
+
+		target := Exchange{
+			client:     invoker,
+			definition: &types.Exchange{Name: "Nasdaq", Topics: []string{"Billing"}},
+		}
+
+		target.handleInvocation("Billing", amqp.Delivery{
+			Acknowledger: acker,
+			RoutingKey:   "Billing",
+			Headers:      amqp.Table{types.TraceParentHeader: traceParent, types.BaggageHeader: "tenant=acme"},
+		})
+
+		invoker.AssertExpectations(t)
+		invoker.AssertNotCalled(t, "Invoke", mock.Anything, mock.Anything)
+		acker.AssertExpectations(t)
+	})
+}
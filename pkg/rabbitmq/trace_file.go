@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/spf13/afero"
+)
+
+// traceFlushInterval after which buffered spans are written to the trace file
+const traceFlushInterval = time.Second
+
+// TraceSpan is the line written to the trace file for every invocation
+type TraceSpan struct {
+	Topic         string        `json:"topic"`
+	Function      string        `json:"function"`
+	Namespace     string        `json:"namespace"`
+	Start         time.Time     `json:"start"`
+	Duration      time.Duration `json:"duration_ns"`
+	Status        string        `json:"status"`
+	CorrelationID string        `json:"correlation_id"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// NewTraceSpan converts the provided invocation result into its span
+func NewTraceSpan(result types.InvocationResult) TraceSpan {
+	span := TraceSpan{
+		Topic:         result.Topic,
+		Function:      result.Function,
+		Namespace:     result.Namespace,
+		Start:         result.Timestamp.UTC(),
+		Duration:      result.Latency,
+		Status:        result.Status,
+		CorrelationID: result.CorrelationID,
+	}
+
+	if result.Error != nil {
+		span.Error = result.Error.Error()
+	}
+
+	return span
+}
+
+// TraceFile writes a span per invocation as json line to a local file, which can be shipped and analyzed offline
+// where no tracing backend is available. Spans are buffered and written every traceFlushInterval. Once the file
+// would exceed maxBytes it is rotated to path.1, which replaces the previously rotated file, so that at most twice
+// maxBytes are used. A nil TraceFile writes nothing.
+type TraceFile struct {
+	fs       afero.Fs
+	path     string
+	maxBytes int64
+
+	lock   sync.Mutex
+	file   afero.File
+	writer *bufio.Writer
+	size   int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewTraceFile opens the trace file at path, spans are appended to an existing file
+func NewTraceFile(fs afero.Fs, path string, maxBytes int64) (*TraceFile, error) {
+	t := &TraceFile{fs: fs, path: path, maxBytes: maxBytes}
+	if err := t.open(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Report writes a span for every result, failures to write are only logged
+func (t *TraceFile) Report(results []types.InvocationResult) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.writer == nil {
+		return
+	}
+
+	for _, result := range results {
+		line, err := json.Marshal(NewTraceSpan(result))
+		if err != nil {
+			log.Printf("Failed to marshal span of function %s on topic %s due to %s", result.Function, result.Topic, err)
+			continue
+		}
+		line = append(line, '\n')
+
+		if t.size > 0 && t.size+int64(len(line)) > t.maxBytes {
+			if err := t.rotate(); err != nil {
+				log.Printf("Failed to rotate trace file %s due to %s", t.path, err)
+				return
+			}
+		}
+
+		written, err := t.writer.Write(line)
+		t.size += int64(written)
+		if err != nil {
+			log.Printf("Failed to write span of function %s on topic %s due to %s", result.Function, result.Topic, err)
+		}
+	}
+}
+
+// Start writes the buffered spans every traceFlushInterval until Stop is called, a stopped file is opened again
+func (t *TraceFile) Start() {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	if t.writer == nil {
+		if err := t.open(); err != nil {
+			log.Printf("Failed to reopen trace file due to %s", err)
+		}
+	}
+	t.lock.Unlock()
+
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+
+	go func() {
+		defer close(t.done)
+
+		ticker := time.NewTicker(traceFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := t.Flush(); err != nil {
+					log.Printf("Failed to write spans to %s due to %s", t.path, err)
+				}
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the interval, writes the buffered spans and closes the file. Spans reported afterwards are dropped.
+func (t *TraceFile) Stop() error {
+	if t == nil {
+		return nil
+	}
+	if t.stop != nil {
+		close(t.stop)
+		<-t.done
+		t.stop = nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.writer == nil {
+		return nil
+	}
+	err := t.close()
+	t.writer = nil
+	return err
+}
+
+// Flush writes the buffered spans to the file
+func (t *TraceFile) Flush() error {
+	if t == nil {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.writer == nil {
+		return nil
+	}
+	return t.writer.Flush()
+}
+
+// open appends to the file at path, the lock has to be held if the file is in use
+func (t *TraceFile) open() error {
+	file, err := t.fs.OpenFile(t.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("trace file %s can not be opened: %s", t.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("trace file %s can not be read: %s", t.path, err)
+	}
+
+	t.file = file
+	t.writer = bufio.NewWriter(file)
+	t.size = info.Size()
+	return nil
+}
+
+// close writes the buffered spans and closes the file, the lock has to be held
+func (t *TraceFile) close() error {
+	flushErr := t.writer.Flush()
+	if err := t.file.Close(); err != nil {
+		return err
+	}
+	return flushErr
+}
+
+// rotate moves the full file to path.1 and starts a new one, the lock has to be held
+func (t *TraceFile) rotate() error {
+	if err := t.close(); err != nil {
+		t.writer = nil
+		return err
+	}
+	if err := t.fs.Rename(t.path, t.path+".1"); err != nil {
+		t.writer = nil
+		return err
+	}
+	if err := t.open(); err != nil {
+		t.writer = nil
+		return err
+	}
+	return nil
+}
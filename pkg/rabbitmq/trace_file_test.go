@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package rabbitmq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceFile(t *testing.T) {
+	start := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	result := func(correlationID string) types.InvocationResult {
+		return types.InvocationResult{
+			Topic:         "billing",
+			Function:      "biller",
+			Namespace:     "openfaas-fn",
+			Status:        types.StatusSuccess,
+			Latency:       150 * time.Millisecond,
+			Timestamp:     start,
+			CorrelationID: correlationID,
+		}
+	}
+	spans := func(fs afero.Fs, path string) []map[string]interface{} {
+		content, err := afero.ReadFile(fs, path)
+		assert.NoError(t, err, "should not throw")
+
+		var spans []map[string]interface{}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			var span map[string]interface{}
+			assert.NoError(t, json.Unmarshal(scanner.Bytes(), &span), "Expected every line to be json")
+			spans = append(spans, span)
+		}
+		return spans
+	}
+
+	t.Run("Should write a line per invocation once flushed", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		target, err := NewTraceFile(fs, "traces.jsonl", 1024*1024)
+		assert.NoError(t, err, "should not throw")
+
+		failed := result("2")
+		failed.Status = types.StatusFailure
+		failed.Error = errors.New("expected")
+		target.Report([]types.InvocationResult{result("1"), failed})
+		assert.Empty(t, spans(fs, "traces.jsonl"), "Expected the spans to be buffered")
+
+		assert.NoError(t, target.Stop(), "should not throw")
+		assert.Equal(t, []map[string]interface{}{
+			{
+				"topic": "billing", "function": "biller", "namespace": "openfaas-fn", "start": "2021-03-01T12:00:00Z",
+				"duration_ns": float64(150 * time.Millisecond), "status": types.StatusSuccess, "correlation_id": "1",
+			},
+			{
+				"topic": "billing", "function": "biller", "namespace": "openfaas-fn", "start": "2021-03-01T12:00:00Z",
+				"duration_ns": float64(150 * time.Millisecond), "status": types.StatusFailure, "correlation_id": "2", "error": "expected",
+			},
+		}, spans(fs, "traces.jsonl"))
+	})
+
+	t.Run("Should rotate the file once it would exceed the max bytes", func(t *testing.T) {
+		line, _ := json.Marshal(NewTraceSpan(result("1")))
+		size := int64(len(line) + 1)
+
+		fs := afero.NewMemMapFs()
+		target, err := NewTraceFile(fs, "traces.jsonl", 2*size)
+		assert.NoError(t, err, "should not throw")
+
+		target.Report([]types.InvocationResult{result("1"), result("2"), result("3"), result("4"), result("5")})
+		assert.NoError(t, target.Stop(), "should not throw")
+
+		rotated := spans(fs, "traces.jsonl.1")
+		assert.Len(t, rotated, 2, "Expected the rotated file to be capped")
+		assert.Equal(t, "3", rotated[0]["correlation_id"], "Expected the previously rotated file to be replaced")
+		current := spans(fs, "traces.jsonl")
+		assert.Len(t, current, 1)
+		assert.Equal(t, "5", current[0]["correlation_id"])
+	})
+
+	t.Run("Should append to an existing file across restarts", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		target, err := NewTraceFile(fs, "traces.jsonl", 1024*1024)
+		assert.NoError(t, err, "should not throw")
+		target.Report([]types.InvocationResult{result("1")})
+		assert.NoError(t, target.Stop(), "should not throw")
+
+		target.Start()
+		target.Report([]types.InvocationResult{result("2")})
+		assert.NoError(t, target.Stop(), "should not throw")
+
+		assert.Len(t, spans(fs, "traces.jsonl"), 2)
+	})
+
+	t.Run("Should write nothing without trace file", func(t *testing.T) {
+		var target *TraceFile
+
+		target.Start()
+		target.Report([]types.InvocationResult{result("1")})
+		assert.NoError(t, target.Stop())
+	})
+}
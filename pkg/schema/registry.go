@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package schema
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// Extension of the schema files within the schema directory
+const Extension = ".json"
+
+// Registry holds the compiled schemas of a directory, which are referenced by their file name without extension
+type Registry struct {
+	schemas map[string]*Schema
+}
+
+// NewRegistry creates a registry from already compiled schemas, which are referenced by their name
+func NewRegistry(schemas ...*Schema) *Registry {
+	registry := &Registry{schemas: make(map[string]*Schema, len(schemas))}
+	for _, schema := range schemas {
+		registry.schemas[schema.Name()] = schema
+	}
+	return registry
+}
+
+// Load compiles every schema file of the directory, an invalid schema fails the whole directory
+func Load(fs afero.Fs, dir string) (*Registry, error) {
+	files, err := afero.ReadDir(fs, dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read schema directory %s: %w", dir, err)
+	}
+
+	var schemas []*Schema
+	for _, file := range files {
+		if file.IsDir() || !strings.EqualFold(filepath.Ext(file.Name()), Extension) {
+			continue
+		}
+
+		raw, err := afero.ReadFile(fs, filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read schema %s: %w", file.Name(), err)
+		}
+
+		schema, err := Compile(strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())), raw)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+
+	return NewRegistry(schemas...), nil
+}
+
+// Get returns the schema referenced by its name, the extension of the file is optional
+func (r *Registry) Get(ref string) (*Schema, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	name := strings.TrimSpace(ref)
+	if strings.EqualFold(filepath.Ext(name), Extension) {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	schema, ok := r.schemas[name]
+	return schema, ok
+}
+
+// Len returns the amount of schemas
+func (r *Registry) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.schemas)
+}
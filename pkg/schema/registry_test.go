@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package schema
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("Should compile every schema of the directory", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		_ = afero.WriteFile(fs, "/schemas/order.json", []byte(orderSchema), 0644)
+		_ = afero.WriteFile(fs, "/schemas/invoice.JSON", []byte(`{"type": "object"}`), 0644)
+		_ = afero.WriteFile(fs, "/schemas/README.md", []byte(`# Schemas`), 0644)
+
+		registry, err := Load(fs, "/schemas")
+
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, 2, registry.Len())
+
+		order, ok := registry.Get("order")
+		assert.True(t, ok)
+		assert.Equal(t, "order", order.Name())
+
+		_, ok = registry.Get("order.json")
+		assert.True(t, ok, "Expected the extension to be optional")
+		_, ok = registry.Get("invoice")
+		assert.True(t, ok)
+		_, ok = registry.Get("README")
+		assert.False(t, ok)
+	})
+
+	t.Run("Should fail on an invalid schema", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		_ = afero.WriteFile(fs, "/schemas/order.json", []byte(orderSchema), 0644)
+		_ = afero.WriteFile(fs, "/schemas/broken.json", []byte(`{"type": "text"}`), 0644)
+
+		_, err := Load(fs, "/schemas")
+
+		assert.EqualError(t, err, "schema broken is invalid: $.type contains the unknown type text")
+	})
+
+	t.Run("Should fail on a missing directory", func(t *testing.T) {
+		_, err := Load(afero.NewMemMapFs(), "/schemas")
+
+		assert.Error(t, err, "should throw")
+	})
+
+	t.Run("Should not find schemas in a nil registry", func(t *testing.T) {
+		var registry *Registry
+
+		_, ok := registry.Get("order")
+		assert.False(t, ok)
+		assert.Equal(t, 0, registry.Len())
+	})
+}
@@ -0,0 +1,430 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+// Package schema validates messages against JSON Schemas. It supports the commonly used validation keywords
+// type, enum, const, properties, required, additionalProperties, items, minItems, maxItems, minLength, maxLength,
+// pattern, minimum, maximum, exclusiveMinimum and exclusiveMaximum. Other keywords are ignored.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationError is returned if a message does not match the schema. It is not retryable, as invoking the same
+// message again cannot succeed.
+type ValidationError struct {
+	Schema string
+	Path   string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("message does not match schema %s at %s: %s", e.Schema, e.Path, e.Reason)
+}
+
+// Retryable is always false, see types.RetryableError
+func (e *ValidationError) Retryable() bool {
+	return false
+}
+
+// Schema is a compiled JSON Schema, it is safe for concurrent use
+type Schema struct {
+	name string
+	root *node
+}
+
+type node struct {
+	types    []string
+	enum     []interface{}
+	constant *interface{}
+
+	properties           map[string]*node
+	required             []string
+	additionalProperties *node
+	noAdditional         bool
+
+	items    *node
+	minItems *int
+	maxItems *int
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+}
+
+var knownTypes = map[string]bool{"object": true, "array": true, "string": true, "number": true, "integer": true, "boolean": true, "null": true}
+
+// Compile parses the raw JSON Schema, the name is used to report validation errors
+func Compile(name string, raw []byte) (*Schema, error) {
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("schema %s is not valid json: %w", name, err)
+	}
+
+	root, err := compileNode(doc, "$")
+	if err != nil {
+		return nil, fmt.Errorf("schema %s is invalid: %w", name, err)
+	}
+	return &Schema{name: name, root: root}, nil
+}
+
+// Name of the schema
+func (s *Schema) Name() string {
+	return s.name
+}
+
+// Validate checks the json message against the schema, a ValidationError is returned if it does not match
+func (s *Schema) Validate(message []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return &ValidationError{Schema: s.name, Path: "$", Reason: fmt.Sprintf("message is not valid json: %s", err)}
+	}
+	if decoder.More() {
+		return &ValidationError{Schema: s.name, Path: "$", Reason: "message contains more than one json value"}
+	}
+
+	if path, reason, ok := s.root.validate(value, "$"); !ok {
+		return &ValidationError{Schema: s.name, Path: path, Reason: reason}
+	}
+	return nil
+}
+
+func compileNode(doc interface{}, path string) (*node, error) {
+	switch doc := doc.(type) {
+	case bool:
+		// true accepts everything, false nothing
+		if doc {
+			return &node{}, nil
+		}
+		return &node{types: []string{}}, nil
+	case map[string]interface{}:
+		return compileObject(doc, path)
+	default:
+		return nil, fmt.Errorf("%s is neither an object nor a boolean", path)
+	}
+}
+
+func compileObject(doc map[string]interface{}, path string) (*node, error) {
+	n := &node{}
+	var err error
+
+	if raw, ok := doc["type"]; ok {
+		if n.types, err = compileTypes(raw, path); err != nil {
+			return nil, err
+		}
+	}
+
+	if raw, ok := doc["enum"]; ok {
+		values, ok := raw.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s.enum is not an array", path)
+		}
+		n.enum = values
+	}
+	if raw, ok := doc["const"]; ok {
+		n.constant = &raw
+	}
+
+	if raw, ok := doc["properties"]; ok {
+		properties, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s.properties is not an object", path)
+		}
+		n.properties = make(map[string]*node, len(properties))
+		for name, property := range properties {
+			if n.properties[name], err = compileNode(property, path+".properties."+name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if raw, ok := doc["required"]; ok {
+		required, ok := raw.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s.required is not an array", path)
+		}
+		for _, name := range required {
+			s, ok := name.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s.required contains %v, which is not a string", path, name)
+			}
+			n.required = append(n.required, s)
+		}
+	}
+	if raw, ok := doc["additionalProperties"]; ok {
+		if allowed, ok := raw.(bool); ok {
+			n.noAdditional = !allowed
+		} else if n.additionalProperties, err = compileNode(raw, path+".additionalProperties"); err != nil {
+			return nil, err
+		}
+	}
+
+	if raw, ok := doc["items"]; ok {
+		if n.items, err = compileNode(raw, path+".items"); err != nil {
+			return nil, err
+		}
+	}
+
+	for keyword, target := range map[string]**int{"minItems": &n.minItems, "maxItems": &n.maxItems, "minLength": &n.minLength, "maxLength": &n.maxLength} {
+		if raw, ok := doc[keyword]; ok {
+			count, ok := raw.(float64)
+			if !ok || count < 0 || count != math.Trunc(count) {
+				return nil, fmt.Errorf("%s.%s is not a positive integer", path, keyword)
+			}
+			value := int(count)
+			*target = &value
+		}
+	}
+
+	if raw, ok := doc["pattern"]; ok {
+		expression, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s.pattern is not a string", path)
+		}
+		if n.pattern, err = regexp.Compile(expression); err != nil {
+			return nil, fmt.Errorf("%s.pattern is not a valid regular expression: %w", path, err)
+		}
+	}
+
+	for keyword, target := range map[string]**float64{"minimum": &n.minimum, "maximum": &n.maximum, "exclusiveMinimum": &n.exclusiveMinimum, "exclusiveMaximum": &n.exclusiveMaximum} {
+		if raw, ok := doc[keyword]; ok {
+			limit, ok := raw.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s.%s is not a number", path, keyword)
+			}
+			*target = &limit
+		}
+	}
+
+	return n, nil
+}
+
+func compileTypes(raw interface{}, path string) ([]string, error) {
+	var names []interface{}
+	switch raw := raw.(type) {
+	case string:
+		names = []interface{}{raw}
+	case []interface{}:
+		names = raw
+	default:
+		return nil, fmt.Errorf("%s.type is neither a string nor an array", path)
+	}
+
+	types := make([]string, 0, len(names))
+	for _, name := range names {
+		s, ok := name.(string)
+		if !ok || !knownTypes[s] {
+			return nil, fmt.Errorf("%s.type contains the unknown type %v", path, name)
+		}
+		types = append(types, s)
+	}
+	return types, nil
+}
+
+// validate returns the path and reason of the first mismatch, ok is true if the value matches
+func (n *node) validate(value interface{}, path string) (string, string, bool) {
+	if n.types != nil && !n.matchesType(value) {
+		if len(n.types) == 0 {
+			return path, "no value is allowed", false
+		}
+		return path, fmt.Sprintf("expected %s, got %s", strings.Join(n.types, " or "), typeOf(value)), false
+	}
+
+	if n.enum != nil && !containsValue(n.enum, value) {
+		return path, "value is not one of the allowed values", false
+	}
+	if n.constant != nil && !equalValues(*n.constant, value) {
+		return path, "value does not equal the constant", false
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return n.validateObject(value, path)
+	case []interface{}:
+		return n.validateArray(value, path)
+	case string:
+		return n.validateString(value, path)
+	case json.Number:
+		return n.validateNumber(value, path)
+	}
+	return "", "", true
+}
+
+func (n *node) validateObject(value map[string]interface{}, path string) (string, string, bool) {
+	for _, name := range n.required {
+		if _, ok := value[name]; !ok {
+			return path, fmt.Sprintf("required property %s is missing", name), false
+		}
+	}
+
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	// Sorted to report the same mismatch for the same message
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, known := n.properties[name]
+		switch {
+		case known:
+		case n.noAdditional:
+			return path, fmt.Sprintf("property %s is not allowed", name), false
+		case n.additionalProperties != nil:
+			property = n.additionalProperties
+		default:
+			continue
+		}
+
+		if at, reason, ok := property.validate(value[name], path+"."+name); !ok {
+			return at, reason, false
+		}
+	}
+	return "", "", true
+}
+
+func (n *node) validateArray(value []interface{}, path string) (string, string, bool) {
+	if n.minItems != nil && len(value) < *n.minItems {
+		return path, fmt.Sprintf("expected at least %d items, got %d", *n.minItems, len(value)), false
+	}
+	if n.maxItems != nil && len(value) > *n.maxItems {
+		return path, fmt.Sprintf("expected at most %d items, got %d", *n.maxItems, len(value)), false
+	}
+
+	if n.items != nil {
+		for i, item := range value {
+			if at, reason, ok := n.items.validate(item, fmt.Sprintf("%s[%d]", path, i)); !ok {
+				return at, reason, false
+			}
+		}
+	}
+	return "", "", true
+}
+
+func (n *node) validateString(value string, path string) (string, string, bool) {
+	length := utf8.RuneCountInString(value)
+	if n.minLength != nil && length < *n.minLength {
+		return path, fmt.Sprintf("expected at least %d characters, got %d", *n.minLength, length), false
+	}
+	if n.maxLength != nil && length > *n.maxLength {
+		return path, fmt.Sprintf("expected at most %d characters, got %d", *n.maxLength, length), false
+	}
+	if n.pattern != nil && !n.pattern.MatchString(value) {
+		return path, fmt.Sprintf("value does not match pattern %s", n.pattern), false
+	}
+	return "", "", true
+}
+
+func (n *node) validateNumber(value json.Number, path string) (string, string, bool) {
+	number, err := value.Float64()
+	if err != nil {
+		return path, fmt.Sprintf("%s is not a valid number", value), false
+	}
+
+	switch {
+	case n.minimum != nil && number < *n.minimum:
+		return path, fmt.Sprintf("expected at least %v, got %s", *n.minimum, value), false
+	case n.maximum != nil && number > *n.maximum:
+		return path, fmt.Sprintf("expected at most %v, got %s", *n.maximum, value), false
+	case n.exclusiveMinimum != nil && number <= *n.exclusiveMinimum:
+		return path, fmt.Sprintf("expected more than %v, got %s", *n.exclusiveMinimum, value), false
+	case n.exclusiveMaximum != nil && number >= *n.exclusiveMaximum:
+		return path, fmt.Sprintf("expected less than %v, got %s", *n.exclusiveMaximum, value), false
+	}
+	return "", "", true
+}
+
+func (n *node) matchesType(value interface{}) bool {
+	actual := typeOf(value)
+	for _, expected := range n.types {
+		if expected == actual || (expected == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if number, err := value.Float64(); err == nil && number == math.Trunc(number) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return reflect.TypeOf(value).String()
+	}
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, candidate := range values {
+		if equalValues(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalValues compares a value of the schema with one of the message, which represents numbers as json.Number
+func equalValues(expected interface{}, actual interface{}) bool {
+	if number, ok := actual.(json.Number); ok {
+		limit, isNumber := expected.(float64)
+		value, err := number.Float64()
+		return isNumber && err == nil && limit == value
+	}
+
+	switch actual := actual.(type) {
+	case []interface{}:
+		expected, ok := expected.([]interface{})
+		if !ok || len(expected) != len(actual) {
+			return false
+		}
+		for i := range actual {
+			if !equalValues(expected[i], actual[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		expected, ok := expected.(map[string]interface{})
+		if !ok || len(expected) != len(actual) {
+			return false
+		}
+		for key, value := range actual {
+			other, present := expected[key]
+			if !present || !equalValues(other, value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(expected, actual)
+	}
+}
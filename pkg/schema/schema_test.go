@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package schema
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const orderSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["id", "amount"],
+	"additionalProperties": false,
+	"properties": {
+		"id": {"type": "string", "pattern": "^order-[0-9]+$"},
+		"amount": {"type": "number", "exclusiveMinimum": 0},
+		"currency": {"enum": ["EUR", "USD"]},
+		"items": {"type": "array", "minItems": 1, "items": {"type": "integer", "minimum": 1}},
+		"note": {"type": ["string", "null"], "maxLength": 5}
+	}
+}`
+
+func TestSchema_Validate(t *testing.T) {
+	schema, err := Compile("order", []byte(orderSchema))
+	assert.NoError(t, err, "should not throw")
+
+	t.Run("Should accept a matching message", func(t *testing.T) {
+		assert.NoError(t, schema.Validate([]byte(`{"id": "order-42", "amount": 9.5, "currency": "EUR", "items": [1, 2], "note": null}`)))
+	})
+
+	t.Run("Should reject mismatching messages with the path and reason", func(t *testing.T) {
+		for message, expected := range map[string]string{
+			`{"id": "order-42"}`:                               "message does not match schema order at $: required property amount is missing",
+			`{"id": 42, "amount": 1}`:                          "message does not match schema order at $.id: expected string, got integer",
+			`{"id": "42", "amount": 1}`:                        "message does not match schema order at $.id: value does not match pattern ^order-[0-9]+$",
+			`{"id": "order-1", "amount": 0}`:                   "message does not match schema order at $.amount: expected more than 0, got 0",
+			`{"id": "order-1", "amount": 1, "currency": "X"}`:  "message does not match schema order at $.currency: value is not one of the allowed values",
+			`{"id": "order-1", "amount": 1, "items": []}`:      "message does not match schema order at $.items: expected at least 1 items, got 0",
+			`{"id": "order-1", "amount": 1, "items": [1.5]}`:   "message does not match schema order at $.items[0]: expected integer, got number",
+			`{"id": "order-1", "amount": 1, "note": "long!!"}`: "message does not match schema order at $.note: expected at most 5 characters, got 6",
+			`{"id": "order-1", "amount": 1, "extra": true}`:    "message does not match schema order at $: property extra is not allowed",
+			`not json`: "message does not match schema order at $: message is not valid json: invalid character 'o' in literal null (expecting 'u')",
+		} {
+			err := schema.Validate([]byte(message))
+
+			assert.EqualError(t, err, expected, "Unexpected error for %s", message)
+		}
+	})
+
+	t.Run("Should not be retryable", func(t *testing.T) {
+		err := schema.Validate([]byte(`[]`))
+
+		var validationErr *ValidationError
+		assert.True(t, errors.As(err, &validationErr))
+		assert.True(t, types.IsNonRetryable(err))
+	})
+}
+
+func TestCompile(t *testing.T) {
+	t.Run("Should accept boolean schemas", func(t *testing.T) {
+		schema, err := Compile("nothing", []byte(`{"properties": {"forbidden": false, "anything": true}}`))
+
+		assert.NoError(t, err, "should not throw")
+		assert.NoError(t, schema.Validate([]byte(`{"anything": 1}`)))
+		assert.EqualError(t, schema.Validate([]byte(`{"forbidden": 1}`)), "message does not match schema nothing at $.forbidden: no value is allowed")
+	})
+
+	t.Run("Should reject invalid schemas", func(t *testing.T) {
+		for raw, expected := range map[string]string{
+			`{`:                              "schema broken is not valid json: unexpected end of JSON input",
+			`[]`:                             "schema broken is invalid: $ is neither an object nor a boolean",
+			`{"type": "text"}`:               "schema broken is invalid: $.type contains the unknown type text",
+			`{"required": "id"}`:             "schema broken is invalid: $.required is not an array",
+			`{"minLength": -1}`:              "schema broken is invalid: $.minLength is not a positive integer",
+			`{"items": {"pattern": "("}}`:    "schema broken is invalid: $.items.pattern is not a valid regular expression: error parsing regexp: missing closing ): `(`",
+			`{"properties": {"id": "text"}}`: "schema broken is invalid: $.properties.id is neither an object nor a boolean",
+		} {
+			_, err := Compile("broken", []byte(raw))
+
+			assert.EqualError(t, err, expected, "Unexpected error for %s", raw)
+		}
+	})
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package server
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+)
+
+// DOTPath serves the topic map as Graphviz DOT graph
+const DOTPath = "/cache.dot"
+
+// DOTHandler serves the graph written by render as text/vnd.graphviz. The graph is rendered before it is sent, so
+// that a failed render responds with 500 instead of a truncated graph.
+func DOTHandler(render func(w io.Writer) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var graph bytes.Buffer
+		if err := render(&graph); err != nil {
+			log.Printf("Received %s while rendering %s", err, r.URL.Path)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		_, _ = w.Write(graph.Bytes())
+	})
+}
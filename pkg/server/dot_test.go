@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDOTHandler(t *testing.T) {
+	t.Run("Should serve the rendered graph", func(t *testing.T) {
+		target := DOTHandler(func(w io.Writer) error {
+			_, err := io.WriteString(w, "digraph topics {}\n")
+			return err
+		})
+
+		recorder := httptest.NewRecorder()
+		target.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, DOTPath, nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "text/vnd.graphviz; charset=utf-8", recorder.Header().Get("Content-Type"))
+		assert.Equal(t, "digraph topics {}\n", recorder.Body.String())
+	})
+
+	t.Run("Should respond with 500 if rendering fails", func(t *testing.T) {
+		target := DOTHandler(func(w io.Writer) error {
+			_, _ = io.WriteString(w, "digraph topics {")
+			return errors.New("expected")
+		})
+
+		recorder := httptest.NewRecorder()
+		target.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, DOTPath, nil))
+
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "digraph")
+	})
+
+	t.Run("Should only allow GET", func(t *testing.T) {
+		target := DOTHandler(func(w io.Writer) error { return nil })
+
+		recorder := httptest.NewRecorder()
+		target.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, DOTPath, nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	})
+}
@@ -0,0 +1,27 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package server
+
+import (
+	"net/http"
+)
+
+// DrainPath triggers draining the connector, the same as sending SIGUSR1
+const DrainPath = "/drain"
+
+// DrainHandler calls trigger on every POST and responds with 202, as draining continues in the background. Triggering
+// a drain repeatedly has to be safe.
+func DrainHandler(trigger func()) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		trigger()
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
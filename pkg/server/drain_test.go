@@ -0,0 +1,35 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainHandler(t *testing.T) {
+	triggered := 0
+	target := DrainHandler(func() { triggered++ })
+
+	t.Run("Should trigger the drain", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		target.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, DrainPath, nil))
+
+		assert.Equal(t, http.StatusAccepted, recorder.Code)
+		assert.Equal(t, 1, triggered)
+	})
+
+	t.Run("Should only allow POST", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		target.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, DrainPath, nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+		assert.Equal(t, 1, triggered, "Expected no further drain")
+	})
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Templum/rabbitmq-connector/pkg/rabbitmq"
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+)
+
+// InvokePath is the prefix under which topics can be invoked manually, e.g. /invoke/billing
+const InvokePath = "/invoke/"
+
+// maxInvokeBodySize limits the payload accepted by the invoke endpoint
+const maxInvokeBodySize = 10 << 20
+
+type invokeResponse struct {
+	Topic   string                  `json:"topic"`
+	Results []rabbitmq.StatusRecord `json:"results"`
+	Error   string                  `json:"error,omitempty"`
+}
+
+// InvokeHandler invokes the functions subscribed to the topic of the path with the request body as payload,
+// using the same invocation path as messages received from RabbitMQ. It is intended for debugging only.
+func InvokeHandler(invoker types.Invoker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		topic := strings.TrimPrefix(r.URL.Path, InvokePath)
+		if len(topic) == 0 {
+			writeInvokeResponse(w, http.StatusBadRequest, invokeResponse{Error: "topic is missing"})
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxInvokeBodySize))
+		if err != nil {
+			writeInvokeResponse(w, http.StatusBadRequest, invokeResponse{Topic: topic, Error: err.Error()})
+			return
+		}
+
+		invocation := &types.OpenFaaSInvocation{
+			ContentType:     r.Header.Get("Content-Type"),
+			ContentEncoding: r.Header.Get("Content-Encoding"),
+			Topic:           topic,
+			CorrelationID:   r.Header.Get("X-Correlation-Id"),
+			Message:         &body,
+		}
+
+		results, err := invoker.Invoke(topic, invocation)
+
+		response := invokeResponse{Topic: topic, Results: make([]rabbitmq.StatusRecord, 0, len(results))}
+		for _, result := range results {
+			response.Results = append(response.Results, rabbitmq.NewStatusRecord(result))
+		}
+
+		switch {
+		case err != nil:
+			response.Error = err.Error()
+			writeInvokeResponse(w, http.StatusBadGateway, response)
+		case len(results) == 0:
+			response.Error = "no functions are subscribed to topic " + topic
+			writeInvokeResponse(w, http.StatusNotFound, response)
+		default:
+			writeInvokeResponse(w, http.StatusOK, response)
+		}
+	})
+}
+
+func writeInvokeResponse(w http.ResponseWriter, status int, response invokeResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Received %s while encoding invoke response for topic %s", err, response.Topic)
+	}
+}
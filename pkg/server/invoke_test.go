@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Templum/rabbitmq-connector/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type invokerStub struct {
+	results    []types.InvocationResult
+	err        error
+	invocation *types.OpenFaaSInvocation
+}
+
+func (i *invokerStub) Invoke(topic string, invocation *types.OpenFaaSInvocation) ([]types.InvocationResult, error) {
+	i.invocation = invocation
+	return i.results, i.err
+}
+
+func invoke(target http.Handler, method string, path string, body string) (*httptest.ResponseRecorder, invokeResponse) {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	target.ServeHTTP(recorder, request)
+
+	var response invokeResponse
+	_ = json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder, response
+}
+
+func TestInvokeHandler(t *testing.T) {
+	t.Run("Should invoke the topic with the body as payload", func(t *testing.T) {
+		invoker := &invokerStub{results: []types.InvocationResult{{Topic: "billing", Function: "biller", Status: types.StatusSuccess}}}
+
+		recorder, response := invoke(InvokeHandler(invoker), http.MethodPost, "/invoke/billing", `{"amount":3}`)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		assert.Equal(t, "billing", invoker.invocation.Topic)
+		assert.Equal(t, "application/json", invoker.invocation.ContentType)
+		assert.Equal(t, `{"amount":3}`, string(*invoker.invocation.Message))
+		assert.Len(t, response.Results, 1)
+		assert.Equal(t, "biller", response.Results[0].Function)
+		assert.Empty(t, response.Error)
+	})
+
+	t.Run("Should return not found if no function is subscribed", func(t *testing.T) {
+		recorder, response := invoke(InvokeHandler(&invokerStub{}), http.MethodPost, "/invoke/billing", "")
+
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+		assert.Empty(t, response.Results)
+		assert.Contains(t, response.Error, "no functions are subscribed")
+	})
+
+	t.Run("Should return the results up to the failing function", func(t *testing.T) {
+		invoker := &invokerStub{
+			results: []types.InvocationResult{{Function: "biller", Status: types.StatusFailure, Error: errors.New("expected")}},
+			err:     errors.New("expected"),
+		}
+
+		recorder, response := invoke(InvokeHandler(invoker), http.MethodPost, "/invoke/billing", "")
+
+		assert.Equal(t, http.StatusBadGateway, recorder.Code)
+		assert.Equal(t, "expected", response.Results[0].Error)
+		assert.Equal(t, "expected", response.Error)
+	})
+
+	t.Run("Should require a topic", func(t *testing.T) {
+		recorder, _ := invoke(InvokeHandler(&invokerStub{}), http.MethodPost, "/invoke/", "")
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("Should only allow POST", func(t *testing.T) {
+		recorder, _ := invoke(InvokeHandler(&invokerStub{}), http.MethodGet, "/invoke/billing", "")
+
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	})
+}
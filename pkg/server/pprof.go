@@ -0,0 +1,23 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package server
+
+import (
+	"net/http/pprof"
+)
+
+// PprofPath is the prefix of the runtime profiles, e.g. /debug/pprof/heap or /debug/pprof/goroutine?debug=2
+const PprofPath = "/debug/pprof/"
+
+// EnablePprof serves the runtime profiles of net/http/pprof, which expose internals of the process and are not
+// authenticated. Hence they should only be enabled while diagnosing and never be reachable from outside the cluster.
+func (s *Server) EnablePprof() {
+	s.mux.HandleFunc(PprofPath, pprof.Index)
+	s.mux.HandleFunc(PprofPath+"cmdline", pprof.Cmdline)
+	s.mux.HandleFunc(PprofPath+"profile", pprof.Profile)
+	s.mux.HandleFunc(PprofPath+"symbol", pprof.Symbol)
+	s.mux.HandleFunc(PprofPath+"trace", pprof.Trace)
+}
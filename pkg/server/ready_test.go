@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadyHandler(t *testing.T) {
+	var notReady error
+	target := ReadyHandler(func() error { return notReady })
+
+	t.Run("Should be ready without error", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		target.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+
+	t.Run("Should not be ready with the error as reason", func(t *testing.T) {
+		notReady = errors.New("topic map is stale")
+
+		recorder := httptest.NewRecorder()
+		target.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "topic map is stale")
+	})
+
+	t.Run("Should only allow GET", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		target.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, ReadyPath, nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	})
+}
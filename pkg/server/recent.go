@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Templum/rabbitmq-connector/pkg/rabbitmq"
+)
+
+// RecentPath is the prefix under which the recently processed messages of a topic are served, e.g. /debug/recent/billing
+const RecentPath = "/debug/recent/"
+
+// RecentHandler serves the messages of the topic of the path returned by recent as json, oldest first
+func RecentHandler(recent func(topic string) []rabbitmq.RecentMessage) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		topic := strings.TrimPrefix(r.URL.Path, RecentPath)
+		if len(topic) == 0 {
+			http.Error(w, "topic is missing", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(recent(topic)); err != nil {
+			log.Printf("Received %s while encoding recent messages of topic %s", err, topic)
+		}
+	})
+}
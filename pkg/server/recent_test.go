@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Templum/rabbitmq-connector/pkg/rabbitmq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecentHandler(t *testing.T) {
+	recent := func(topic string) []rabbitmq.RecentMessage {
+		if topic != "billing" {
+			return []rabbitmq.RecentMessage{}
+		}
+		return []rabbitmq.RecentMessage{{Topic: topic, CorrelationID: "1", Status: "success"}}
+	}
+
+	t.Run("Should serve the recent messages of the topic", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		RecentHandler(recent).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, RecentPath+"billing", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+		var messages []rabbitmq.RecentMessage
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &messages), "should not throw")
+		assert.Len(t, messages, 1)
+		assert.Equal(t, "1", messages[0].CorrelationID)
+	})
+
+	t.Run("Should serve an empty list for an unknown topic", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		RecentHandler(recent).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, RecentPath+"invoice", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, "[]", recorder.Body.String())
+	})
+
+	t.Run("Should respond with 400 without topic", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		RecentHandler(recent).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, RecentPath, nil))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("Should only allow GET", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		RecentHandler(recent).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, RecentPath+"billing", nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	})
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Server exposes the operational endpoints of the connector, like the metrics endpoint
+type Server struct {
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+// New creates a new server listening on the provided address, which already serves /metrics
+func New(addr string) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	return &Server{
+		mux: mux,
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+}
+
+// Handle registers an additional handler for the given pattern
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// JSONHandler serves the value returned by the provider as json, which is used for the stats endpoints
+func JSONHandler(provider func() interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(provider()); err != nil {
+			log.Printf("Received %s while encoding response for %s", err, r.URL.Path)
+		}
+	})
+}
+
+// Router returns the handler serving all registered endpoints
+func (s *Server) Router() http.Handler {
+	return s.mux
+}
+
+// Start begins serving in the background
+func (s *Server) Start() {
+	go func() {
+		log.Printf("Serving operational endpoints on %s", s.server.Addr)
+		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Received %s while serving operational endpoints", err)
+		}
+	}()
+}
+
+// Shutdown stops serving gracefully, respecting the deadline of the provided context
+func (s *Server) Shutdown(ctx context.Context) {
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Printf("Received %s during shutdown of operational endpoints", err)
+	}
+}
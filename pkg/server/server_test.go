@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Router(t *testing.T) {
+	t.Run("Should serve prometheus metrics", func(t *testing.T) {
+		target := New(":0")
+
+		recorder := httptest.NewRecorder()
+		target.Router().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "go_goroutines")
+	})
+
+	t.Run("Should serve additionally registered handlers", func(t *testing.T) {
+		target := New(":0")
+		target.Handle("/custom", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}))
+
+		recorder := httptest.NewRecorder()
+		target.Router().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/custom", nil))
+
+		assert.Equal(t, http.StatusTeapot, recorder.Code)
+	})
+
+	t.Run("Should only serve the runtime profiles once enabled", func(t *testing.T) {
+		target := New(":0")
+
+		recorder := httptest.NewRecorder()
+		target.Router().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+		target.EnablePprof()
+
+		recorder = httptest.NewRecorder()
+		target.Router().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "goroutine profile")
+
+		recorder = httptest.NewRecorder()
+		target.Router().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/pprof/cmdline", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+}
+
+func TestJSONHandler(t *testing.T) {
+	target := JSONHandler(func() interface{} {
+		return map[string]int{"invocations": 3}
+	})
+
+	t.Run("Should serve the provided value as json", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		target.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"invocations": 3}`, recorder.Body.String())
+	})
+
+	t.Run("Should only allow GET", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		target.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/stats", nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	})
+}
@@ -6,6 +6,8 @@
 package types
 
 import (
+	"time"
+
 	"github.com/streadway/amqp"
 )
 
@@ -14,7 +16,23 @@ type OpenFaaSInvocation struct {
 	ContentType     string
 	ContentEncoding string
 	Topic           string
+	CorrelationID   string
 	Message         *[]byte
+	// Redelivered is true if the delivery was delivered before, but not acknowledged
+	Redelivered bool
+	// Retries are the failed delivery attempts recorded on a republished delivery
+	Retries int
+	// Deadline after which the message is expired, zero if the message carries no deadline
+	Deadline time.Time
+	// Expiry at which the message expires by the TTL of the message or its queue, zero if neither carries one. Unlike
+	// the deadline it only caps the invoke timeout
+	Expiry time.Time
+	// ReplyTo is the queue the requester awaits the response on, empty if no response is expected
+	ReplyTo string
+	// Warmup marks an invocation without message, which only keeps the function warm
+	Warmup bool
+	// HashKey is the hash of the affinity key of the message, it is empty if no affinity key is configured
+	HashKey string
 }
 
 // NewInvocation creates a OpenFaaSInvocation from an amqp.Delivery.
@@ -23,6 +41,9 @@ func NewInvocation(delivery amqp.Delivery) *OpenFaaSInvocation {
 		ContentType:     delivery.ContentType,
 		ContentEncoding: delivery.ContentEncoding,
 		Topic:           delivery.RoutingKey,
+		CorrelationID:   delivery.CorrelationId,
 		Message:         &delivery.Body,
+		Redelivered:     delivery.Redelivered,
+		ReplyTo:         delivery.ReplyTo,
 	}
 }
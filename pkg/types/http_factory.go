@@ -13,8 +13,9 @@ import (
 	"github.com/valyala/fasthttp/fasthttpproxy"
 )
 
-// MakeHTTPClient generates an HTTP Client setting basic properties including timeouts
-func MakeHTTPClient(insecure bool, maxConnections int, timeout time.Duration) *fasthttp.Client {
+// MakeHTTPClient generates an HTTP Client setting basic properties including timeouts. Idle keep-alive connections
+// are closed after idleTimeout, which should be below the idle timeout of load balancers in front of the gateway.
+func MakeHTTPClient(insecure bool, maxConnections int, timeout time.Duration, idleTimeout time.Duration) *fasthttp.Client {
 	client := fasthttp.Client{
 		Name: "Main_Client",
 
@@ -25,7 +26,7 @@ func MakeHTTPClient(insecure bool, maxConnections int, timeout time.Duration) *f
 		ReadTimeout:  timeout,
 		WriteTimeout: timeout,
 
-		MaxIdleConnDuration: 5 * time.Second,
+		MaxIdleConnDuration: idleTimeout,
 		/* #nosec G402 as default is false*/
 		TLSConfig: &tls.Config{InsecureSkipVerify: insecure},
 
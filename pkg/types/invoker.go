@@ -5,8 +5,16 @@
 
 package types
 
+import "context"
+
 // Invoker is the Interface used by the OpenFaaS Connector SDK to perform invocations
-// of Lambdas based on a provided topic and message
+// of Lambdas based on a provided topic and message. It reports the outcome for every
+// invoked function alongside the first encountered error.
 type Invoker interface {
-	Invoke(topic string, invocation *OpenFaaSInvocation) error
+	Invoke(topic string, invocation *OpenFaaSInvocation) ([]InvocationResult, error)
+}
+
+// ContextInvoker is implemented by invokers, which pass values of the context like the trace on to the functions
+type ContextInvoker interface {
+	InvokeContext(ctx context.Context, topic string, invocation *OpenFaaSInvocation) ([]InvocationResult, error)
 }
@@ -0,0 +1,29 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package types
+
+import "time"
+
+const (
+	// StatusSuccess indicates that the function accepted the invocation
+	StatusSuccess = "success"
+	// StatusFailure indicates that the invocation of the function failed
+	StatusFailure = "failure"
+)
+
+// InvocationResult describes the outcome of invoking a single function for a topic
+type InvocationResult struct {
+	Topic         string
+	Function      string
+	Namespace     string
+	Status        string
+	Latency       time.Duration
+	Timestamp     time.Time
+	CorrelationID string
+	Error         error
+	// Response of the function, only present for invocations expecting a reply
+	Response []byte
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package types
+
+// RetryableError is implemented by errors that know whether invoking the message again can succeed
+type RetryableError interface {
+	error
+	Retryable() bool
+}
+
+// IsNonRetryable is true if invoking the message again cannot succeed, as the error or the error it wraps says so.
+// Combined errors are only non-retryable if all of them are, errors that do not know are considered retryable.
+func IsNonRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch wrapped := err.(type) {
+	case RetryableError:
+		return !wrapped.Retryable()
+	case interface{ Unwrap() []error }:
+		errs := wrapped.Unwrap()
+		for _, e := range errs {
+			if !IsNonRetryable(e) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	case interface{ Unwrap() error }:
+		return IsNonRetryable(wrapped.Unwrap())
+	default:
+		return false
+	}
+}
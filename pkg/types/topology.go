@@ -20,6 +20,11 @@ type Topology []struct {
 	Type        string   `json:"type,omitempty"`
 	Durable     bool     `json:"durable,omitempty"`
 	AutoDeleted bool     `json:"auto-deleted,omitempty"`
+	Internal    bool     `json:"internal,omitempty"`
+	VHost       string   `json:"vhost,omitempty"`
+	MessageTTL  int      `json:"message-ttl,omitempty" yaml:"message-ttl,omitempty"`
+	Stream      bool     `json:"stream,omitempty"`
+	Lazy        bool     `json:"lazy,omitempty"`
 }
 
 // Exchange Definition of a RabbitMQ Exchange
@@ -30,16 +35,28 @@ type Exchange struct {
 	Type        string
 	Durable     bool
 	AutoDeleted bool
+	Internal    bool
+	VHost       string
+	// MessageTTL in milliseconds is declared as x-message-ttl of the queues, 0 declares none
+	MessageTTL int
+	// Stream declares the queues as durable stream queues, which are consumed from the offset after the committed one
+	Stream bool
+	// Lazy declares the queues with x-queue-mode lazy, which keeps their messages on disk instead of in memory
+	Lazy bool
 }
 
 // EnsureCorrectType is responsible to make sure that the read-in type is one of the allowed
-// which right now is direct or topic. If it is not a valid type, will default to direct.
+// which right now is direct, topic, fanout or headers. If it is not a valid type, will default to direct.
 func (e *Exchange) EnsureCorrectType() {
 	switch strings.ToLower(e.Type) {
 	case "direct":
 		e.Type = "direct"
 	case "topic":
 		e.Type = "topic"
+	case "fanout":
+		e.Type = "fanout"
+	case "headers":
+		e.Type = "headers"
 	default:
 		e.Type = "direct"
 	}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package types
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Headers of the W3C Trace Context and Baggage specifications, which are used on messages and requests alike
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+	BaggageHeader     = "baggage"
+)
+
+// TracePropagator restores the W3C trace context and baggage of messages into a context as OpenTelemetry span context
+// and baggage, and injects them into the requests of the invocation
+var TracePropagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// TraceContext is the distributed trace a message is part of, alongside its baggage. It is passed on unchanged,
+// so that the invoked function continues the trace of the producer.
+type TraceContext struct {
+	TraceParent string
+	TraceState  string
+	Baggage     string
+}
+
+// NewTraceContext creates a TraceContext from the raw header values. An invalid traceparent is discarded together
+// with the tracestate, as the latter is meaningless without the former. The baggage is kept regardless.
+func NewTraceContext(traceParent string, traceState string, baggage string) TraceContext {
+	trace := TraceContext{Baggage: strings.TrimSpace(baggage)}
+
+	traceParent = strings.TrimSpace(traceParent)
+	if isValidTraceParent(traceParent) {
+		trace.TraceParent = traceParent
+		trace.TraceState = strings.TrimSpace(traceState)
+	}
+	return trace
+}
+
+// IsEmpty is true if neither a trace nor baggage is present
+func (t TraceContext) IsEmpty() bool {
+	return len(t.TraceParent) == 0 && len(t.Baggage) == 0
+}
+
+// TraceID returns the trace id of the traceparent, empty if the context is not part of a trace
+func (t TraceContext) TraceID() string {
+	if len(t.TraceParent) == 0 {
+		return ""
+	}
+	return strings.Split(t.TraceParent, "-")[1]
+}
+
+// ContextWithTrace returns a copy of the context carrying the trace as OpenTelemetry span context and baggage, see
+// TracePropagator. An empty trace returns the context as is.
+func ContextWithTrace(ctx context.Context, trace TraceContext) context.Context {
+	if trace.IsEmpty() {
+		return ctx
+	}
+
+	carrier := propagation.MapCarrier{}
+	if len(trace.TraceParent) > 0 {
+		carrier.Set(TraceParentHeader, trace.TraceParent)
+		carrier.Set(TraceStateHeader, trace.TraceState)
+	}
+	if len(trace.Baggage) > 0 {
+		carrier.Set(BaggageHeader, trace.Baggage)
+	}
+	return TracePropagator.Extract(ctx, carrier)
+}
+
+// TraceFromContext returns the OpenTelemetry span context and baggage carried by the context in their W3C encoding,
+// which is empty if there is none
+func TraceFromContext(ctx context.Context) TraceContext {
+	carrier := propagation.MapCarrier{}
+	TracePropagator.Inject(ctx, carrier)
+	return NewTraceContext(carrier.Get(TraceParentHeader), carrier.Get(TraceStateHeader), carrier.Get(BaggageHeader))
+}
+
+// isValidTraceParent verifies the format version-traceid-parentid-flags, ids consisting only of zeros are invalid.
+// Future versions may append further fields, which are accepted as long as the known ones are valid.
+func isValidTraceParent(traceParent string) bool {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) < 4 || !isLowerHex(parts[0], 2) || parts[0] == "ff" {
+		return false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return false
+	}
+
+	return isLowerHex(parts[1], 32) && strings.Trim(parts[1], "0") != "" &&
+		isLowerHex(parts[2], 16) && strings.Trim(parts[2], "0") != "" &&
+		isLowerHex(parts[3], 2)
+}
+
+func isLowerHex(value string, length int) bool {
+	if len(value) != length {
+		return false
+	}
+	for _, char := range value {
+		if (char < '0' || char > '9') && (char < 'a' || char > 'f') {
+			return false
+		}
+	}
+	return true
+}
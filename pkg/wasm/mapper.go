@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/afero"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// Functions a transform plugin has to export alongside its memory
+const (
+	// AllocFunction reserves size bytes within the memory of the plugin and returns their offset: alloc(size i32) i32
+	AllocFunction = "alloc"
+	// TransformFunction transforms the payload of the topic, both passed as offset and length within the memory of the
+	// plugin: transform(topic i32, topic_len i32, payload i32, payload_len i32) i64. The transformed payload is returned
+	// as offset in the upper and length in the lower 32 bits, negative results are error codes of the plugin.
+	TransformFunction = "transform"
+)
+
+// pageSize of the WebAssembly memory, the memory limit is rounded down to whole pages
+const pageSize = 64 * 1024
+
+// Mapper transforms payloads using a WebAssembly plugin. Every transformation runs in a fresh instance of the module,
+// so that transformations neither share state nor leak memory, and is aborted once its context is done.
+type Mapper struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+}
+
+// Load compiles the plugin at the path, whose memory may not grow beyond memoryLimit bytes. The plugin must not import
+// any host functions, which keeps it sandboxed.
+func Load(ctx context.Context, fs afero.Fs, path string, memoryLimit int) (*Mapper, error) {
+	pages := memoryLimit / pageSize
+	if pages < 1 {
+		return nil, fmt.Errorf("memory limit of %d bytes is less than a single page of %d bytes", memoryLimit, pageSize)
+	}
+
+	binary, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read transform plugin %s: %w", path, err)
+	}
+
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(uint32(pages)).
+		WithCloseOnContextDone(true))
+
+	compiled, err := runtime.CompileModule(ctx, binary)
+	if err != nil {
+		_ = runtime.Close(ctx)
+		return nil, fmt.Errorf("transform plugin %s is invalid: %w", path, err)
+	}
+	if err := validateExports(compiled); err != nil {
+		_ = runtime.Close(ctx)
+		return nil, fmt.Errorf("transform plugin %s is invalid: %w", path, err)
+	}
+
+	return &Mapper{runtime: runtime, compiled: compiled}, nil
+}
+
+// validateExports ensures the plugin exports its memory and the functions with their expected signature
+func validateExports(compiled wazero.CompiledModule) error {
+	if len(compiled.ImportedFunctions()) > 0 {
+		return errors.New("host functions can not be imported")
+	}
+	if _, ok := compiled.ExportedMemories()["memory"]; !ok {
+		return errors.New("memory is not exported")
+	}
+
+	expected := map[string]struct {
+		params  []api.ValueType
+		results []api.ValueType
+	}{
+		AllocFunction:     {params: []api.ValueType{api.ValueTypeI32}, results: []api.ValueType{api.ValueTypeI32}},
+		TransformFunction: {params: []api.ValueType{api.ValueTypeI32, api.ValueTypeI32, api.ValueTypeI32, api.ValueTypeI32}, results: []api.ValueType{api.ValueTypeI64}},
+	}
+	functions := compiled.ExportedFunctions()
+	for name, signature := range expected {
+		fn, ok := functions[name]
+		if !ok {
+			return fmt.Errorf("function %s is not exported", name)
+		}
+		if !equalTypes(fn.ParamTypes(), signature.params) || !equalTypes(fn.ResultTypes(), signature.results) {
+			return fmt.Errorf("function %s does not match its expected signature", name)
+		}
+	}
+	return nil
+}
+
+func equalTypes(actual []api.ValueType, expected []api.ValueType) bool {
+	if len(actual) != len(expected) {
+		return false
+	}
+	for i := range actual {
+		if actual[i] != expected[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Map transforms the payload in a fresh instance of the plugin, see TransformFunction. It implements the
+// rabbitmq.PayloadMapper.
+func (m *Mapper) Map(ctx context.Context, topic string, payload []byte) ([]byte, error) {
+	// Without a name the instance is not registered, which allows concurrent instances of the same module
+	module, err := m.runtime.InstantiateModule(ctx, m.compiled, wazero.NewModuleConfig().WithName("").WithStartFunctions())
+	if err != nil {
+		return nil, fmt.Errorf("unable to instantiate transform plugin: %w", err)
+	}
+	defer module.Close(context.Background())
+
+	topicOffset, err := write(ctx, module, []byte(topic))
+	if err != nil {
+		return nil, err
+	}
+	payloadOffset, err := write(ctx, module, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := module.ExportedFunction(TransformFunction).Call(ctx, uint64(topicOffset), uint64(len(topic)), uint64(payloadOffset), uint64(len(payload)))
+	if err != nil {
+		return nil, fmt.Errorf("transform plugin failed: %w", err)
+	}
+	if code := int64(results[0]); code < 0 {
+		return nil, fmt.Errorf("transform plugin failed with error code %d", code)
+	}
+
+	offset, length := uint32(results[0]>>32), uint32(results[0])
+	transformed, ok := module.Memory().Read(offset, length)
+	if !ok {
+		return nil, fmt.Errorf("transform plugin returned %d bytes at %d, which exceed its memory", length, offset)
+	}
+	// The memory is released once the instance is closed
+	return append([]byte(nil), transformed...), nil
+}
+
+// write copies the data into memory reserved via AllocFunction and returns its offset
+func write(ctx context.Context, module api.Module, data []byte) (uint32, error) {
+	results, err := module.ExportedFunction(AllocFunction).Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, fmt.Errorf("transform plugin failed to allocate %d bytes: %w", len(data), err)
+	}
+
+	offset := uint32(results[0])
+	if !module.Memory().Write(offset, data) {
+		return 0, fmt.Errorf("transform plugin allocated %d bytes at %d, which exceed its memory", len(data), offset)
+	}
+	return offset, nil
+}
+
+// Close releases the compiled plugin, afterwards transformations fail
+func (m *Mapper) Close(ctx context.Context) error {
+	return m.runtime.Close(ctx)
+}
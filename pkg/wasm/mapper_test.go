@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) Simon Pelczer 2021. All rights reserved.
+ *  Licensed under the MIT license. See LICENSE file in the project root for full license information.
+ */
+
+package wasm
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// Bodies of the transform function, see TransformFunction
+var (
+	// identity returns the payload as is: (local.get 2) << 32 | (local.get 3)
+	identity = []byte{0x20, 0x02, 0xad, 0x42, 0x20, 0x86, 0x20, 0x03, 0xad, 0x84, 0x0b}
+	// trap fails the transformation via unreachable
+	trap = []byte{0x00, 0x0b}
+	// errorCode returns the error code -1
+	errorCode = []byte{0x42, 0x7f, 0x0b}
+	// endless loops until the transformation is aborted
+	endless = []byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x42, 0x00, 0x0b}
+)
+
+// module assembles a plugin with a bump allocator and the transform function, whose memory starts at the pages
+func module(transform []byte, pages byte) []byte {
+	section := func(id byte, content ...byte) []byte {
+		return append([]byte{id, byte(len(content))}, content...)
+	}
+	name := func(value string) []byte {
+		return append([]byte{byte(len(value))}, value...)
+	}
+	body := func(code []byte) []byte {
+		return append([]byte{byte(len(code) + 1), 0x00}, code...)
+	}
+
+	// alloc returns the current offset and advances it by the size: (global.get 0) (global.set 0 (global.get 0) + (local.get 0))
+	alloc := []byte{0x23, 0x00, 0x23, 0x00, 0x20, 0x00, 0x6a, 0x24, 0x00, 0x0b}
+
+	binary := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	binary = append(binary, section(0x01, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x04, 0x7f, 0x7f, 0x7f, 0x7f, 0x01, 0x7e)...)
+	binary = append(binary, section(0x03, 0x02, 0x00, 0x01)...)
+	binary = append(binary, section(0x05, 0x01, 0x00, pages)...)
+	binary = append(binary, section(0x06, 0x01, 0x7f, 0x01, 0x41, 0x00, 0x0b)...)
+
+	exports := []byte{0x03}
+	exports = append(append(exports, name("memory")...), 0x02, 0x00)
+	exports = append(append(exports, name(AllocFunction)...), 0x00, 0x00)
+	exports = append(append(exports, name(TransformFunction)...), 0x00, 0x01)
+	binary = append(binary, section(0x07, exports...)...)
+
+	code := append([]byte{0x02}, body(alloc)...)
+	code = append(code, body(transform)...)
+	return append(binary, section(0x0a, code...)...)
+}
+
+func load(t *testing.T, binary []byte, memoryLimit int) (*Mapper, error) {
+	fs := afero.NewMemMapFs()
+	_ = afero.WriteFile(fs, "plugin.wasm", binary, 0644)
+
+	mapper, err := Load(context.Background(), fs, "plugin.wasm", memoryLimit)
+	if mapper != nil {
+		t.Cleanup(func() { _ = mapper.Close(context.Background()) })
+	}
+	return mapper, err
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("Should load a valid plugin", func(t *testing.T) {
+		_, err := load(t, module(identity, 1), pageSize)
+		assert.NoError(t, err, "should not throw")
+	})
+
+	t.Run("Should reject a plugin whose memory exceeds the limit", func(t *testing.T) {
+		_, err := load(t, module(identity, 2), pageSize)
+		assert.ErrorContains(t, err, "over limit of 1 pages")
+	})
+
+	t.Run("Should reject a memory limit below a single page", func(t *testing.T) {
+		_, err := load(t, module(identity, 1), pageSize-1)
+		assert.EqualError(t, err, "memory limit of 65535 bytes is less than a single page of 65536 bytes")
+	})
+
+	t.Run("Should reject invalid plugins", func(t *testing.T) {
+		_, err := load(t, []byte("not a module"), pageSize)
+		assert.Error(t, err)
+
+		_, err = load(t, module([]byte{0x41, 0x00, 0x0b}, 1), pageSize)
+		assert.Error(t, err, "Expected a transform function returning i32 to be invalid")
+	})
+
+	t.Run("Should fail for a missing plugin", func(t *testing.T) {
+		_, err := Load(context.Background(), afero.NewMemMapFs(), "missing.wasm", pageSize)
+		assert.Error(t, err)
+	})
+}
+
+func TestMapper_Map(t *testing.T) {
+	t.Run("Should return the payload of the identity plugin", func(t *testing.T) {
+		mapper, err := load(t, module(identity, 1), pageSize)
+		assert.NoError(t, err, "should not throw")
+
+		transformed, err := mapper.Map(context.Background(), "billing", []byte(`{"amount": 10}`))
+		assert.NoError(t, err, "should not throw")
+		assert.Equal(t, []byte(`{"amount": 10}`), transformed)
+	})
+
+	t.Run("Should transform concurrently in separate instances", func(t *testing.T) {
+		mapper, err := load(t, module(identity, 1), pageSize)
+		assert.NoError(t, err, "should not throw")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(payload []byte) {
+				defer wg.Done()
+				transformed, err := mapper.Map(context.Background(), "billing", payload)
+				assert.NoError(t, err, "should not throw")
+				assert.Equal(t, payload, transformed)
+			}([]byte{byte(i)})
+		}
+		wg.Wait()
+	})
+
+	t.Run("Should fail once the plugin traps", func(t *testing.T) {
+		mapper, err := load(t, module(trap, 1), pageSize)
+		assert.NoError(t, err, "should not throw")
+
+		_, err = mapper.Map(context.Background(), "billing", []byte("Hello World"))
+		assert.ErrorContains(t, err, "transform plugin failed")
+	})
+
+	t.Run("Should fail with the error code of the plugin", func(t *testing.T) {
+		mapper, err := load(t, module(errorCode, 1), pageSize)
+		assert.NoError(t, err, "should not throw")
+
+		_, err = mapper.Map(context.Background(), "billing", []byte("Hello World"))
+		assert.EqualError(t, err, "transform plugin failed with error code -1")
+	})
+
+	t.Run("Should fail once the payload exceeds the memory of the plugin", func(t *testing.T) {
+		mapper, err := load(t, module(identity, 1), pageSize)
+		assert.NoError(t, err, "should not throw")
+
+		_, err = mapper.Map(context.Background(), "billing", make([]byte, pageSize))
+		assert.ErrorContains(t, err, "which exceed its memory")
+	})
+
+	t.Run("Should abort the plugin once the context is done", func(t *testing.T) {
+		mapper, err := load(t, module(endless, 1), pageSize)
+		assert.NoError(t, err, "should not throw")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err = mapper.Map(ctx, "billing", []byte("Hello World"))
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), time.Second, "Expected the endless loop to be aborted")
+	})
+}